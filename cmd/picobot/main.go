@@ -3,27 +3,42 @@ package main
 import (
 	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"log"
 
+	"github.com/local/picobot/internal/access"
 	"github.com/local/picobot/internal/agent"
 	"github.com/local/picobot/internal/agent/memory"
 	"github.com/local/picobot/internal/channels"
 	"github.com/local/picobot/internal/chat"
 	"github.com/local/picobot/internal/config"
 	"github.com/local/picobot/internal/cron"
+	"github.com/local/picobot/internal/diskguard"
 	"github.com/local/picobot/internal/heartbeat"
+	"github.com/local/picobot/internal/hooks"
+	"github.com/local/picobot/internal/keyring"
 	"github.com/local/picobot/internal/providers"
+	"github.com/local/picobot/internal/stt"
+	"github.com/local/picobot/internal/telemetry"
+	"github.com/local/picobot/internal/templates"
+	"github.com/local/picobot/internal/tts"
+	"github.com/local/picobot/internal/useragent"
+	"github.com/local/picobot/internal/watchdog"
 )
 
 const version = "0.1.5"
@@ -32,6 +47,13 @@ func NewRootCmd() *cobra.Command {
 	rootCmd := &cobra.Command{
 		Use:   "picobot",
 		Short: "picobot — lightweight clawbot in Go",
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			// identify ourselves on all outbound HTTP: config override > default
+			useragent.Set(useragent.Default(version))
+			if cfg, err := config.LoadConfig(); err == nil {
+				useragent.Set(cfg.HTTP.UserAgent)
+			}
+		},
 	}
 
 	rootCmd.AddCommand(&cobra.Command{
@@ -105,6 +127,53 @@ func NewRootCmd() *cobra.Command {
 	}
 
 	channelsCmd.AddCommand(loginCmd)
+
+	// whatsapp backup/restore — move the WhatsApp session to another machine
+	// without pairing again.
+	whatsappCmd := &cobra.Command{
+		Use:   "whatsapp",
+		Short: "Back up or restore the WhatsApp session",
+	}
+	backupCmd := &cobra.Command{
+		Use:   "backup <file>",
+		Short: "Export the WhatsApp session to a file encrypted with a passphrase",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			dbPath := whatsappDBPath()
+			pass, err := readPassphrase(cmd, true)
+			if err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), "backup failed:", err)
+				return
+			}
+			if err := channels.BackupWhatsApp(cmd.Context(), dbPath, args[0], pass); err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), "backup failed:", err)
+				return
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "WhatsApp session saved to %s. Keep it safe: with the passphrase it gives access to the account.\n", args[0])
+		},
+	}
+	restoreCmd := &cobra.Command{
+		Use:   "restore <file>",
+		Short: "Import a WhatsApp session exported with backup (stop the gateway first)",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			dbPath := whatsappDBPath()
+			force, _ := cmd.Flags().GetBool("force")
+			pass, err := readPassphrase(cmd, false)
+			if err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), "restore failed:", err)
+				return
+			}
+			if err := channels.RestoreWhatsApp(args[0], dbPath, pass, force); err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), "restore failed:", err)
+				return
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "WhatsApp session restored to %s. Do not keep the gateway running on the old machine too.\n", dbPath)
+		},
+	}
+	restoreCmd.Flags().Bool("force", false, "Replace an existing WhatsApp session")
+	whatsappCmd.AddCommand(backupCmd, restoreCmd)
+	channelsCmd.AddCommand(whatsappCmd)
 	rootCmd.AddCommand(channelsCmd)
 
 	agentCmd := &cobra.Command{
@@ -112,36 +181,12 @@ func NewRootCmd() *cobra.Command {
 		Short: "Run a single-shot agent query (use -m)",
 		Run: func(cmd *cobra.Command, args []string) {
 			msg, _ := cmd.Flags().GetString("message")
-			modelFlag, _ := cmd.Flags().GetString("model")
 			if msg == "" {
 				fmt.Println("Specify a message with -m \"your message\"")
 				return
 			}
 
-			hub := chat.NewHub(100)
-			cfg, _ := config.LoadConfig()
-			var provider providers.LLMProvider
-			if cfg.Providers.OpenAI != nil && cfg.Providers.OpenAI.APIKey != "" {
-				provider = providers.NewOpenAIProvider(cfg.Providers.OpenAI.APIKey, cfg.Providers.OpenAI.APIBase, cfg.Agents.Defaults.RequestTimeoutS)
-			} else {
-				provider = providers.NewStubProvider()
-			}
-
-			// choose model: flag > config default > provider default
-			model := modelFlag
-			if model == "" && cfg.Agents.Defaults.Model != "" {
-				model = cfg.Agents.Defaults.Model
-			}
-			if model == "" {
-				model = provider.GetDefaultModel()
-			}
-
-			maxIter := cfg.Agents.Defaults.MaxToolIterations
-			if maxIter <= 0 {
-				maxIter = 100
-			}
-			ag := agent.NewAgentLoop(hub, provider, model, maxIter, cfg.Agents.Defaults.Workspace, nil)
-
+			ag := newLocalAgent(cmd, chat.NewHub(100), loadRuntimeConfig(cmd))
 			resp, err := ag.ProcessDirect(msg, 60*time.Second)
 			if err != nil {
 				fmt.Fprintln(cmd.ErrOrStderr(), "error:", err)
@@ -152,15 +197,110 @@ func NewRootCmd() *cobra.Command {
 	}
 	agentCmd.Flags().StringP("message", "m", "", "Message to send to the agent")
 	agentCmd.Flags().StringP("model", "M", "", "Model to use (overrides config/provider default)")
+	agentCmd.Flags().Int64("seed", 0, "Sampling seed of a turn logged or traced, to reproduce it given the same context (overrides agents.defaults.seed)")
 	rootCmd.AddCommand(agentCmd)
 
+	replCmd := &cobra.Command{
+		Use:   "repl",
+		Short: "Chat with the agent in the terminal, with streamed replies",
+		Run: func(cmd *cobra.Command, args []string) {
+			hub := chat.NewHub(100)
+			ag := newLocalAgent(cmd, hub, loadRuntimeConfig(cmd))
+			// The agent's log would interleave with the conversation.
+			if verbose, _ := cmd.Flags().GetBool("verbose"); !verbose {
+				log.SetOutput(io.Discard)
+			}
+			ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+			defer stop()
+			repl := channels.NewREPL(hub)
+			hub.StartRouter(ctx)
+			go ag.RunLocal(ctx)
+
+			fmt.Fprintln(cmd.OutOrStdout(), "Talking to picobot: /help lists the commands, /quit leaves.")
+			if err := repl.Run(ctx, cmd.InOrStdin(), cmd.OutOrStdout()); err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), "error:", err)
+			}
+		},
+	}
+	replCmd.Flags().StringP("model", "M", "", "Model to use (overrides config/provider default)")
+	replCmd.Flags().Int64("seed", 0, "Sampling seed of a turn logged or traced, to reproduce it given the same context (overrides agents.defaults.seed)")
+	replCmd.Flags().BoolP("verbose", "v", false, "Show the agent's log")
+	rootCmd.AddCommand(replCmd)
+
+	pipeCmd := &cobra.Command{
+		Use:   "pipe",
+		Short: "Answer the message read from stdin on stdout, for shell pipelines and cron jobs",
+		Long: `Reads a message from stdin, runs it through the agent (tools and memory
+included) and prints the final reply on stdout. With --prompt, the prompt
+comes first and stdin is appended to it as the material to work on.
+
+Exit status: 0 with a reply, 1 when the agent failed, timed out or ran out
+of tool iterations, 2 when there was nothing to send or stdin was over 1 MB.`,
+		Example: `  echo "What's on my calendar today?" | picobot pipe
+  git diff | picobot pipe -p "Write a commit message for this change"`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			input, err := io.ReadAll(io.LimitReader(cmd.InOrStdin(), maxPipeInput+1))
+			if err != nil {
+				return exitError{code: 1, err: fmt.Errorf("reading stdin: %w", err)}
+			}
+			if len(input) > maxPipeInput {
+				return exitError{code: 2, err: fmt.Errorf("stdin is over %d KB", maxPipeInput>>10)}
+			}
+			msg := strings.TrimSpace(string(input))
+			if prompt, _ := cmd.Flags().GetString("prompt"); strings.TrimSpace(prompt) != "" {
+				msg = strings.TrimSpace(prompt + "\n\n" + msg)
+			}
+			if msg == "" {
+				return exitError{code: 2, err: fmt.Errorf("no message: pipe one to stdin, or use --prompt")}
+			}
+			// Only the reply goes to stdout; the log would clutter stderr.
+			if verbose, _ := cmd.Flags().GetBool("verbose"); !verbose {
+				log.SetOutput(io.Discard)
+			}
+			timeout, _ := cmd.Flags().GetDuration("timeout")
+			ag := newLocalAgent(cmd, chat.NewHub(100), loadRuntimeConfig(cmd))
+			resp, err := ag.ProcessDirect(msg, timeout)
+			if err != nil {
+				return exitError{code: 1, err: err}
+			}
+			if strings.TrimSpace(resp) == "" {
+				return exitError{code: 1, err: fmt.Errorf("the agent gave no reply")}
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), resp)
+			return nil
+		},
+	}
+	pipeCmd.Flags().StringP("prompt", "p", "", "Instruction sent before the text read from stdin")
+	pipeCmd.Flags().StringP("model", "M", "", "Model to use (overrides config/provider default)")
+	pipeCmd.Flags().Int64("seed", 0, "Sampling seed of a turn logged or traced, to reproduce it given the same context (overrides agents.defaults.seed)")
+	pipeCmd.Flags().Duration("timeout", 5*time.Minute, "Give up on the reply after this long")
+	pipeCmd.Flags().BoolP("verbose", "v", false, "Show the agent's log on stderr")
+	rootCmd.AddCommand(pipeCmd)
+
 	gatewayCmd := &cobra.Command{
 		Use:   "gateway",
 		Short: "Start long-running gateway (agent, telegram, heartbeat)",
 		Run: func(cmd *cobra.Command, args []string) {
 			hub := chat.NewHub(200)
-			cfg, _ := config.LoadConfig()
+			cfg := loadRuntimeConfig(cmd)
+			if cfg.Channels.Prefixes != nil {
+				hub.SetPrefixes(cfg.Channels.Prefixes)
+			}
+			if qh := cfg.Channels.QuietHours; qh.Default != "" || len(qh.Chats) > 0 {
+				if q, err := chat.NewQuietHours(qh.Default, qh.Chats, qh.Timezone); err != nil {
+					fmt.Fprintf(os.Stderr, "ignoring channels.quietHours: %v\n", err)
+				} else {
+					hub.SetQuietHours(q)
+				}
+			}
+			setSanitizer(hub, cfg)
 			provider := providers.NewProviderFromConfig(cfg)
+			if op, ok := provider.(*providers.OpenAIProvider); ok {
+				log.Printf("provider: using API key %s (%d fallback)", op.ActiveKey(), len(op.FallbackKeys))
+			}
 
 			// choose model: flag > config > provider default
 			modelFlag, _ := cmd.Flags().GetString("model")
@@ -172,9 +312,42 @@ func NewRootCmd() *cobra.Command {
 				model = provider.GetDefaultModel()
 			}
 
+			workspace := cfg.Agents.Defaults.Workspace
+			if strings.HasPrefix(workspace, "~/") {
+				home, _ := os.UserHomeDir()
+				workspace = filepath.Join(home, workspace[2:])
+			}
+
 			// create scheduler with fire callback that routes back through the agent loop, so the LLM can process the reminder and respond naturally to the user.
+			// Jobs made from a template skip the agent: the rendered text is the notification.
 			scheduler := cron.NewScheduler(func(job cron.Job) {
 				log.Printf("cron fired: %s — %s", job.Name, job.Message)
+				// The scheduler waits for this callback: never block it on a
+				// full outbound queue.
+				send := func(out chat.Outbound) {
+					select {
+					case hub.Out <- out:
+					default:
+						log.Printf("cron: job %q: outbound channel full, dropping message", job.Name)
+					}
+				}
+				if job.Post {
+					send(chat.Outbound{Channel: job.Channel, ChatID: job.ChatID, Content: job.Message, Media: job.Media,
+						Metadata: map[string]interface{}{"channel_post": true}})
+					return
+				}
+				if job.Template != "" {
+					out := chat.Outbound{Channel: job.Channel, ChatID: job.ChatID}
+					text, err := templates.Render(os.DirFS(workspace), job.Template, job.Vars)
+					if err != nil {
+						log.Printf("cron: job %q: %v", job.Name, err)
+						out.Type = chat.TypeError
+						text = fmt.Sprintf("Scheduled notification %q failed: %v", job.Name, err)
+					}
+					out.Content = text
+					send(out)
+					return
+				}
 				hub.In <- chat.Inbound{
 					Channel:  job.Channel,
 					SenderID: "cron",
@@ -188,6 +361,42 @@ func NewRootCmd() *cobra.Command {
 				maxIter = 100
 			}
 			ag := agent.NewAgentLoop(hub, provider, model, maxIter, cfg.Agents.Defaults.Workspace, scheduler)
+			ag.SetDraftModel(cfg.Agents.Defaults.DraftModel)
+			ag.SetArchiveLinks(cfg.Agents.Defaults.ArchiveLinks)
+			if seed := cfg.Agents.Defaults.Seed; seed != nil {
+				ag.SetSeed(*seed)
+			}
+			if ranker, err := memory.NewRanker("", cfg, provider, model); err != nil {
+				fmt.Fprintf(os.Stderr, "%v; ranking memories with the model\n", err)
+			} else {
+				ag.SetMemoryRanker(ranker)
+			}
+			ag.SetBriefings(cfg.Briefings)
+			if cfg.Channels.Telegram.Enabled {
+				ag.SetPublishChannels(cfg.Channels.Telegram.PublishTo)
+			}
+			if cfg.Channels.WhatsApp.Enabled {
+				ag.EnableWhatsAppStatus()
+			}
+			if len(cfg.Broadcast.Limits) > 0 {
+				ag.SetBroadcastLimits(cfg.Broadcast.Limits)
+			}
+			ag.SetCredentials(cfg.Credentials)
+			ag.SetEventWebhooks(cfg.Events.Webhooks)
+			ag.SetOnboarding(cfg.Onboarding)
+			ag.SetCostPreview(cfg.CostPreview)
+			ag.SetResearch(cfg.Research)
+			if err := ag.SetTurnJournal(filepath.Join(workspace, "turns.db")); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to open the turn journal: %v\n", err)
+			}
+			ag.SetPromptSnapshot(filepath.Join(workspace, "prompt-snapshot.json.gz"))
+			if vault := cfg.Agents.Defaults.ObsidianVault; vault != "" {
+				if strings.HasPrefix(vault, "~/") {
+					home, _ := os.UserHomeDir()
+					vault = filepath.Join(home, vault[2:])
+				}
+				ag.SetObsidianVault(vault)
+			}
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
 
@@ -204,20 +413,166 @@ func NewRootCmd() *cobra.Command {
 			}
 			heartbeat.StartHeartbeat(ctx, cfg.Agents.Defaults.Workspace, hbInterval, hub)
 
+			// start the watchdog; channels register with it as they start
+			wdCfg := cfg.Watchdog
+			var alert func(msg string)
+			if wdCfg.AlertChannel != "" && wdCfg.AlertChatID != "" {
+				alert = func(msg string) {
+					select {
+					case hub.Out <- chat.Outbound{Channel: wdCfg.AlertChannel, ChatID: wdCfg.AlertChatID, Content: msg}:
+					default:
+						log.Printf("alert: outbound queue full, alert not sent")
+					}
+				}
+				watchdog.Default.SetAlert(alert)
+			}
+			wdInterval := time.Duration(wdCfg.IntervalS) * time.Second
+			if wdInterval <= 0 {
+				wdInterval = 60 * time.Second
+			}
+			watchdog.Default.Start(ctx, wdInterval)
+
+			// start the disk guard if enabled; it alerts to the watchdog's chat
+			if dk := cfg.Disk; dk.Enabled {
+				keep := dk.KeepDays
+				if keep <= 0 {
+					keep = 7
+				}
+				g, err := diskguard.New(diskguard.Config{
+					Workspace:    workspace,
+					MaxWorkspace: int64(dk.MaxWorkspaceMB) << 20,
+					MinFree:      int64(dk.MinFreeMB) << 20,
+					Prune:        dk.Prune,
+					KeepFor:      time.Duration(keep) * 24 * time.Hour,
+				}, alert)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "failed to start disk guard: %v\n", err)
+				} else {
+					interval := time.Duration(dk.IntervalS) * time.Second
+					if interval <= 0 {
+						interval = 10 * time.Minute
+					}
+					g.Start(ctx, interval)
+				}
+			}
+
+			// start the webhook endpoint if enabled
+			if cfg.Hooks.Enabled {
+				hooksCfg := cfg.Hooks
+				hooksCfg.Workspace = workspace
+				if err := hooks.StartHooks(ctx, hub, hooksCfg); err != nil {
+					fmt.Fprintf(os.Stderr, "failed to start hooks: %v\n", err)
+				}
+			}
+
 			// start telegram if enabled
 			if cfg.Channels.Telegram.Enabled {
-				if err := channels.StartTelegram(ctx, hub, cfg.Channels.Telegram.Token, cfg.Channels.Telegram.AllowFrom); err != nil {
+				tgCfg := cfg.Channels.Telegram
+				if tgCfg.StatePath == "" {
+					tgCfg.StatePath = "~/.picobot/telegram-state.json"
+				}
+				if strings.HasPrefix(tgCfg.StatePath, "~/") {
+					home, _ := os.UserHomeDir()
+					tgCfg.StatePath = filepath.Join(home, tgCfg.StatePath[2:])
+				}
+				if tgCfg.Sending.DeadLetterPath == "" {
+					tgCfg.Sending.DeadLetterPath = "~/.picobot/telegram-dead-letters.jsonl"
+				}
+				if strings.HasPrefix(tgCfg.Sending.DeadLetterPath, "~/") {
+					home, _ := os.UserHomeDir()
+					tgCfg.Sending.DeadLetterPath = filepath.Join(home, tgCfg.Sending.DeadLetterPath[2:])
+				}
+				if tgCfg.QueuePath == "" {
+					tgCfg.QueuePath = "~/.picobot/telegram-queue.db"
+				}
+				if strings.HasPrefix(tgCfg.QueuePath, "~/") {
+					home, _ := os.UserHomeDir()
+					tgCfg.QueuePath = filepath.Join(home, tgCfg.QueuePath[2:])
+				}
+				tgCfg.Inbox.Workspace = workspace
+				tgCfg.AllowFrom, tgCfg.Deny = channelAccess("telegram", tgCfg.AllowFrom, cfg.Access)
+				if err := channels.StartTelegram(ctx, hub, tgCfg); err != nil {
 					fmt.Fprintf(os.Stderr, "failed to start telegram: %v\n", err)
 				}
 			}
 
 			// start discord if enabled
 			if cfg.Channels.Discord.Enabled {
-				if err := channels.StartDiscord(ctx, hub, cfg.Channels.Discord.Token, cfg.Channels.Discord.AllowFrom); err != nil {
+				dcCfg := cfg.Channels.Discord
+				dcCfg.AllowFrom, dcCfg.Deny = channelAccess("discord", dcCfg.AllowFrom, cfg.Access)
+				if err := channels.StartDiscord(ctx, hub, dcCfg); err != nil {
 					fmt.Fprintf(os.Stderr, "failed to start discord: %v\n", err)
 				}
 			}
 
+			// start slack if enabled
+			if cfg.Channels.Slack.Enabled {
+				slCfg := cfg.Channels.Slack
+				slCfg.AllowFrom, slCfg.Deny = channelAccess("slack", slCfg.AllowFrom, cfg.Access)
+				if err := channels.StartSlack(ctx, hub, slCfg); err != nil {
+					fmt.Fprintf(os.Stderr, "failed to start slack: %v\n", err)
+				}
+			}
+
+			// start rocketchat if enabled
+			if cfg.Channels.RocketChat.Enabled {
+				rcCfg := cfg.Channels.RocketChat
+				if rcCfg.StatePath == "" {
+					rcCfg.StatePath = "~/.picobot/rocketchat-state.json"
+				}
+				if strings.HasPrefix(rcCfg.StatePath, "~/") {
+					home, _ := os.UserHomeDir()
+					rcCfg.StatePath = filepath.Join(home, rcCfg.StatePath[2:])
+				}
+				rcCfg.AllowFrom, rcCfg.Deny = channelAccess("rocketchat", rcCfg.AllowFrom, cfg.Access)
+				if err := channels.StartRocketChat(ctx, hub, rcCfg); err != nil {
+					fmt.Fprintf(os.Stderr, "failed to start rocketchat: %v\n", err)
+				}
+			}
+
+			// start line if enabled
+			if cfg.Channels.LINE.Enabled {
+				lineCfg := cfg.Channels.LINE
+				lineCfg.AllowFrom, lineCfg.Deny = channelAccess("line", lineCfg.AllowFrom, cfg.Access)
+				if err := channels.StartLINE(ctx, hub, lineCfg); err != nil {
+					fmt.Fprintf(os.Stderr, "failed to start line: %v\n", err)
+				}
+			}
+
+			// start the web chat if enabled
+			if cfg.Channels.Web.Enabled {
+				webCfg := cfg.Channels.Web
+				webCfg.Workspace = workspace
+				webCfg.AllowFrom, webCfg.Deny = channelAccess("web", webCfg.AllowFrom, cfg.Access)
+				if err := channels.StartWeb(ctx, hub, webCfg); err != nil {
+					fmt.Fprintf(os.Stderr, "failed to start web chat: %v\n", err)
+				}
+			}
+
+			// start the REST API if enabled
+			if cfg.Channels.API.Enabled {
+				if err := channels.StartAPI(ctx, hub, cfg.Channels.API); err != nil {
+					fmt.Fprintf(os.Stderr, "failed to start api: %v\n", err)
+				}
+			}
+
+			// start the gRPC channel if enabled
+			if cfg.Channels.GRPC.Enabled {
+				if err := channels.StartGRPC(ctx, hub, cfg.Channels.GRPC); err != nil {
+					fmt.Fprintf(os.Stderr, "failed to start grpc: %v\n", err)
+				}
+			}
+
+			// start email if enabled
+			if cfg.Channels.Email.Enabled {
+				emCfg := cfg.Channels.Email
+				emCfg.Workspace = workspace
+				emCfg.AllowFrom, emCfg.Deny = channelAccess("email", emCfg.AllowFrom, cfg.Access)
+				if err := channels.StartEmail(ctx, hub, emCfg); err != nil {
+					fmt.Fprintf(os.Stderr, "failed to start email: %v\n", err)
+				}
+			}
+
 			// start whatsapp if enabled
 			if cfg.Channels.WhatsApp.Enabled {
 				dbPath := cfg.Channels.WhatsApp.DBPath
@@ -229,7 +584,11 @@ func NewRootCmd() *cobra.Command {
 					home, _ := os.UserHomeDir()
 					dbPath = filepath.Join(home, dbPath[2:])
 				}
-				if err := channels.StartWhatsApp(ctx, hub, dbPath, cfg.Channels.WhatsApp.AllowFrom); err != nil {
+				waCfg := cfg.Channels.WhatsApp
+				waCfg.DBPath = dbPath
+				waCfg.Inbox.Workspace = workspace
+				waCfg.AllowFrom, waCfg.Deny = channelAccess("whatsapp", waCfg.AllowFrom, cfg.Access)
+				if err := channels.StartWhatsApp(ctx, hub, waCfg, stt.NewFromConfig(cfg), tts.NewFromConfig(cfg)); err != nil {
 					fmt.Fprintf(os.Stderr, "failed to start whatsapp: %v\n", err)
 				}
 			}
@@ -240,10 +599,15 @@ func NewRootCmd() *cobra.Command {
 			// are active simultaneously.
 			hub.StartRouter(ctx)
 
-			// wait for signal
+			// wait for signal; SIGHUP reloads the provider's API keys
 			sigCh := make(chan os.Signal, 1)
-			signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-			<-sigCh
+			signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+			for sig := range sigCh {
+				if sig != syscall.SIGHUP {
+					break
+				}
+				reloadKeys(cmd, provider)
+			}
 			fmt.Println("shutting down gateway")
 			cancel()
 		},
@@ -315,12 +679,7 @@ func NewRootCmd() *cobra.Command {
 				}
 				fmt.Fprintln(cmd.OutOrStdout(), "appended to today")
 			case "long":
-				lt, err := mem.ReadLongTerm()
-				if err != nil {
-					fmt.Fprintln(cmd.ErrOrStderr(), "append long failed:", err)
-					return
-				}
-				if err := mem.WriteLongTerm(lt + "\n" + content); err != nil {
+				if err := mem.AppendLongTerm(content); err != nil {
 					fmt.Fprintln(cmd.ErrOrStderr(), "append long failed:", err)
 					return
 				}
@@ -391,6 +750,100 @@ func NewRootCmd() *cobra.Command {
 	memoryCmd.AddCommand(writeCmd)
 	memoryCmd.AddCommand(recentCmd)
 
+	// import subcommand: bring notes from other tools into memory
+	importCmd := &cobra.Command{
+		Use:   "import <path>",
+		Short: "Import an Obsidian vault, a Markdown folder or a ChatGPT export into memory",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			src := args[0]
+			format, _ := cmd.Flags().GetString("format")
+			name, _ := cmd.Flags().GetString("name")
+			info, err := os.Stat(src)
+			if err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), "import failed:", err)
+				return
+			}
+			if format == "auto" {
+				switch {
+				case !info.IsDir():
+					format = "chatgpt"
+				default:
+					format = "markdown"
+					if st, err := os.Stat(filepath.Join(src, ".obsidian")); err == nil && st.IsDir() {
+						format = "obsidian"
+					}
+				}
+			}
+			var notes []memory.ImportedNote
+			switch format {
+			case "obsidian", "markdown":
+				notes, err = memory.ImportMarkdownDir(src, format == "obsidian")
+			case "chatgpt":
+				notes, err = memory.ImportChatGPT(src)
+			default:
+				fmt.Fprintln(cmd.ErrOrStderr(), "unknown format:", format)
+				return
+			}
+			if err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), "import failed:", err)
+				return
+			}
+			if name == "" {
+				name = format + "-" + strings.TrimSuffix(filepath.Base(filepath.Clean(src)), filepath.Ext(src))
+			}
+			cfg, _ := config.LoadConfig()
+			ws := cfg.Agents.Defaults.Workspace
+			if ws == "" {
+				ws = "~/.picobot/workspace"
+			}
+			home, _ := os.UserHomeDir()
+			if strings.HasPrefix(ws, "~/") {
+				ws = filepath.Join(home, ws[2:])
+			}
+			mem := memory.NewMemoryStoreWithWorkspace(ws, 100)
+			n, err := mem.SaveImported(name, memory.ChunkNotes(notes, memory.ImportChunkSize))
+			if err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), "import failed:", err)
+				return
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "imported %d notes as %d chunks (%s)\n", len(notes), n, name)
+		},
+	}
+	importCmd.Flags().StringP("format", "f", "auto", "Source format: auto, obsidian, markdown or chatgpt")
+	importCmd.Flags().StringP("name", "n", "", "Name of the import (re-importing with the same name replaces it)")
+	memoryCmd.AddCommand(importCmd)
+
+	// export subcommand: mirror memory into an Obsidian vault
+	exportCmd := &cobra.Command{
+		Use:   "export <vault>",
+		Short: "Export memory and daily notes into an Obsidian vault (under Picobot/)",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, _ := config.LoadConfig()
+			ws := cfg.Agents.Defaults.Workspace
+			if ws == "" {
+				ws = "~/.picobot/workspace"
+			}
+			home, _ := os.UserHomeDir()
+			if strings.HasPrefix(ws, "~/") {
+				ws = filepath.Join(home, ws[2:])
+			}
+			vault := args[0]
+			if strings.HasPrefix(vault, "~/") {
+				vault = filepath.Join(home, vault[2:])
+			}
+			mem := memory.NewMemoryStoreWithWorkspace(ws, 100)
+			n, err := mem.ExportVault(vault)
+			if err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), "export failed:", err)
+				return
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "exported long-term memory and %d daily notes to %s\n", n, filepath.Join(vault, "Picobot"))
+		},
+	}
+	memoryCmd.AddCommand(exportCmd)
+
 	// rank subcommand: rank recent memories by relevance to a query
 	rankCmd := &cobra.Command{
 		Use:   "rank -q <query>",
@@ -403,7 +856,7 @@ func NewRootCmd() *cobra.Command {
 			}
 			top, _ := cmd.Flags().GetInt("top")
 			verbose, _ := cmd.Flags().GetBool("verbose")
-			cfg, _ := config.LoadConfig()
+			cfg := loadRuntimeConfig(cmd)
 			ws := cfg.Agents.Defaults.Workspace
 			if ws == "" {
 				ws = "~/.picobot/workspace"
@@ -413,36 +866,21 @@ func NewRootCmd() *cobra.Command {
 				ws = filepath.Join(home, ws[2:])
 			}
 			mem := memory.NewMemoryStoreWithWorkspace(ws, 100)
-			// Build memory items from today's file (split into lines) and long-term memory
-			items := make([]memory.MemoryItem, 0)
-			if td, err := mem.ReadToday(); err == nil && td != "" {
-				for _, line := range strings.Split(td, "\n") {
-					line = strings.TrimSpace(line)
-					if line == "" {
-						continue
-					}
-					// strip leading timestamp [2026-02-07...] if present
-					if idx := strings.Index(line, "] "); idx != -1 && strings.HasPrefix(line, "[") {
-						line = strings.TrimSpace(line[idx+2:])
-					}
-					items = append(items, memory.MemoryItem{Kind: "today", Text: line})
-				}
-			}
-			if lt, err := mem.ReadLongTerm(); err == nil && lt != "" {
-				for _, line := range strings.Split(lt, "\n") {
-					line = strings.TrimSpace(line)
-					if line == "" {
-						continue
-					}
-					items = append(items, memory.MemoryItem{Kind: "long", Text: line})
-				}
-			}
+			items := rankableMemories(mem)
 			provider := providers.NewProviderFromConfig(cfg)
 			var logger *log.Logger
 			if verbose {
 				logger = log.New(cmd.OutOrStdout(), "ranker: ", 0)
 			}
-			ranker := memory.NewLLMRankerWithLogger(provider, provider.GetDefaultModel(), logger)
+			var ranker memory.Ranker = memory.NewLLMRankerWithLogger(provider, provider.GetDefaultModel(), logger)
+			if name, _ := cmd.Flags().GetString("ranker"); name != "" || cfg.Memory.Ranker != "" {
+				r, err := memory.NewRanker(name, cfg, provider, provider.GetDefaultModel())
+				if err != nil {
+					fmt.Fprintln(cmd.ErrOrStderr(), err)
+					return
+				}
+				ranker = r
+			}
 			res := ranker.Rank(q, items, top)
 			for i, m := range res {
 				fmt.Fprintf(cmd.OutOrStdout(), "%d: %s (%s)\n", i+1, m.Text, m.Kind)
@@ -452,16 +890,260 @@ func NewRootCmd() *cobra.Command {
 	rankCmd.Flags().StringP("query", "q", "", "Query to rank memories against")
 	rankCmd.Flags().IntP("top", "k", 5, "Number of top memories to show")
 	rankCmd.Flags().BoolP("verbose", "v", false, "Enable verbose diagnostic logging (to stdout)")
+	rankCmd.Flags().String("ranker", "", "Ranker to use: "+strings.Join(memory.RankerNames, ", ")+" (default: memory.ranker, else llm)")
 	memoryCmd.AddCommand(rankCmd)
 
+	// eval subcommand: measure how well each ranker finds the relevant memories
+	evalCmd := &cobra.Command{
+		Use:   "eval -f <cases.json>",
+		Short: "Measure the retrieval quality of memory rankers",
+		Long: `Ranks the memories for each query of a cases file and reports recall@k and MRR@k
+for each ranker. The file is a JSON list of cases such as
+  [{"query": "when is the dentist?", "relevant": ["dentist"]}]
+where "relevant" holds pieces of the texts of the memories that should be found.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			file, _ := cmd.Flags().GetString("file")
+			if file == "" {
+				fmt.Fprintln(cmd.ErrOrStderr(), "-f cases file required")
+				return
+			}
+			b, err := os.ReadFile(file)
+			if err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), err)
+				return
+			}
+			var cases []memory.EvalCase
+			if err := json.Unmarshal(b, &cases); err != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "%s: %v\n", file, err)
+				return
+			}
+			k, _ := cmd.Flags().GetInt("top")
+			names, _ := cmd.Flags().GetStringSlice("ranker")
+			cfg := loadRuntimeConfig(cmd)
+			ws := cfg.Agents.Defaults.Workspace
+			if ws == "" {
+				ws = "~/.picobot/workspace"
+			}
+			home, _ := os.UserHomeDir()
+			if strings.HasPrefix(ws, "~/") {
+				ws = filepath.Join(home, ws[2:])
+			}
+			items := rankableMemories(memory.NewMemoryStoreWithWorkspace(ws, 100))
+			provider := providers.NewProviderFromConfig(cfg)
+			fmt.Fprintf(cmd.OutOrStdout(), "%-12s %5s  %8s  %6s\n", "ranker", "cases", fmt.Sprintf("recall@%d", k), fmt.Sprintf("MRR@%d", k))
+			for _, name := range names {
+				ranker, err := memory.NewRanker(name, cfg, provider, provider.GetDefaultModel())
+				if err != nil {
+					fmt.Fprintln(cmd.ErrOrStderr(), err)
+					return
+				}
+				res := memory.Evaluate(ranker, items, cases, k)
+				fmt.Fprintf(cmd.OutOrStdout(), "%-12s %5d  %8.2f  %6.2f\n", name, res.Cases, res.Recall, res.MRR)
+			}
+		},
+	}
+	evalCmd.Flags().StringP("file", "f", "", "JSON file of queries and the memories relevant to them")
+	evalCmd.Flags().IntP("top", "k", 5, "Number of top memories considered")
+	evalCmd.Flags().StringSlice("ranker", []string{"simple", "bm25", "embeddings", "hybrid"}, "Rankers to compare")
+	memoryCmd.AddCommand(evalCmd)
+
 	rootCmd.AddCommand(memoryCmd)
+
+	// telemetry subcommands: prompt, trace
+	telemetryCmd := &cobra.Command{
+		Use:   "telemetry",
+		Short: "Inspect metrics recorded in the workspace",
+	}
+
+	promptCmd := &cobra.Command{
+		Use:   "prompt -days N",
+		Short: "Show how prompt tokens were spent over the last N days",
+		Run: func(cmd *cobra.Command, args []string) {
+			days, _ := cmd.Flags().GetInt("days")
+			cfg, _ := config.LoadConfig()
+			ws := cfg.Agents.Defaults.Workspace
+			if ws == "" {
+				ws = "~/.picobot/workspace"
+			}
+			home, _ := os.UserHomeDir()
+			if strings.HasPrefix(ws, "~/") {
+				ws = filepath.Join(home, ws[2:])
+			}
+			recs, err := telemetry.LoadPrompt(ws, days)
+			if err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), "failed to load telemetry:", err)
+				return
+			}
+			if len(recs) == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "no prompt telemetry recorded")
+				return
+			}
+			avg := telemetry.AveragePrompt(recs)
+			total := avg.Total()
+			fmt.Fprintf(cmd.OutOrStdout(), "turns: %d, average prompt: ~%d tokens\n", len(recs), total)
+			sections := []struct {
+				name   string
+				tokens int
+			}{
+				{"system", avg.System},
+				{"bootstrap", avg.Bootstrap},
+				{"skills", avg.Skills},
+				{"memory", avg.Memory},
+				{"history", avg.History},
+				{"current", avg.Current},
+				{"tools", avg.Tools},
+			}
+			for _, sec := range sections {
+				pct := 0.0
+				if total > 0 {
+					pct = float64(sec.tokens) * 100 / float64(total)
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "  %-10s %6d  %5.1f%%\n", sec.name, sec.tokens, pct)
+			}
+			// Total spend by feature, follow-up calls of tool-driven turns included.
+			perFeature := map[string]int{}
+			var spent int
+			for _, r := range recs {
+				perFeature[r.FeatureName()] += r.Tokens()
+				spent += r.Tokens()
+			}
+			features := make([]string, 0, len(perFeature))
+			for f := range perFeature {
+				features = append(features, f)
+			}
+			slices.SortFunc(features, func(a, b string) int { return perFeature[b] - perFeature[a] })
+			fmt.Fprintf(cmd.OutOrStdout(), "by feature, ~%d tokens in all:\n", spent)
+			for _, f := range features {
+				fmt.Fprintf(cmd.OutOrStdout(), "  %-20s %8d  %5.1f%%\n", f, perFeature[f], float64(perFeature[f])*100/float64(max(spent, 1)))
+			}
+		},
+	}
+	promptCmd.Flags().IntP("days", "d", 1, "Number of days to include")
+	telemetryCmd.AddCommand(promptCmd)
+
+	traceCmd := &cobra.Command{
+		Use:   "trace <id>",
+		Short: "Show the trace of a failed turn by the ID given to the user",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, _ := config.LoadConfig()
+			ws := cfg.Agents.Defaults.Workspace
+			if ws == "" {
+				ws = "~/.picobot/workspace"
+			}
+			home, _ := os.UserHomeDir()
+			if strings.HasPrefix(ws, "~/") {
+				ws = filepath.Join(home, ws[2:])
+			}
+			rec, ok, err := telemetry.FindTrace(ws, args[0])
+			if err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), "failed to load traces:", err)
+				return
+			}
+			if !ok {
+				fmt.Fprintf(cmd.OutOrStdout(), "no trace %s in the last %d days\n", args[0], telemetry.TraceDays)
+				return
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), rec.Format())
+		},
+	}
+	telemetryCmd.AddCommand(traceCmd)
+
+	fixtureCmd := &cobra.Command{
+		Use:   "fixture <id>... [-o file]",
+		Short: "Turn traces of failed turns into a redacted stub provider scenario file",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, _ := config.LoadConfig()
+			ws := cfg.Agents.Defaults.Workspace
+			if ws == "" {
+				ws = "~/.picobot/workspace"
+			}
+			home, _ := os.UserHomeDir()
+			if strings.HasPrefix(ws, "~/") {
+				ws = filepath.Join(home, ws[2:])
+			}
+			var recs []telemetry.TraceRecord
+			for _, id := range args {
+				rec, ok, err := telemetry.FindTrace(ws, id)
+				if err != nil {
+					fmt.Fprintln(cmd.ErrOrStderr(), "failed to load traces:", err)
+					return
+				}
+				if !ok {
+					fmt.Fprintf(cmd.ErrOrStderr(), "no trace %s in the last %d days\n", id, telemetry.TraceDays)
+					return
+				}
+				recs = append(recs, rec)
+			}
+			b, err := telemetry.Fixture(recs)
+			if err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), "failed to build fixture:", err)
+				return
+			}
+			out, _ := cmd.Flags().GetString("output")
+			if out == "" {
+				cmd.OutOrStdout().Write(b)
+				return
+			}
+			if err := os.WriteFile(out, b, 0o644); err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), "failed to write fixture:", err)
+				return
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "wrote %s\n", out)
+		},
+	}
+	fixtureCmd.Flags().StringP("output", "o", "", "File to write (default: stdout)")
+	telemetryCmd.AddCommand(fixtureCmd)
+
+	rootCmd.AddCommand(telemetryCmd)
+
+	keyringCmd := &cobra.Command{
+		Use:   "keyring",
+		Short: "Keep tokens and API keys in the OS keyring",
+	}
+	keyringSetCmd := &cobra.Command{
+		Use:   "set <name>",
+		Short: "Store a secret in the OS keyring (read from the terminal or stdin)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			secret, err := readSecret(cmd)
+			if err != nil {
+				return err
+			}
+			if err := keyring.Set(keyring.Service, args[0], secret); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Stored. Use \"%s%s\" in place of the secret in config.json.\n", config.KeyringPrefix, args[0])
+			return nil
+		},
+	}
+	keyringCmd.AddCommand(keyringSetCmd)
+	rootCmd.AddCommand(keyringCmd)
 	return rootCmd
 }
 
+// maxPipeInput bounds the message `picobot pipe` reads from stdin.
+const maxPipeInput = 1 << 20
+
+// exitError is an error of a command that sets the exit status of picobot,
+// for commands used in scripts (see pipe).
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e exitError) Error() string { return e.err.Error() }
+func (e exitError) Unwrap() error { return e.err }
+
 func main() {
 	rootCmd := NewRootCmd()
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
+		var exit exitError
+		if errors.As(err, &exit) {
+			os.Exit(exit.code)
+		}
 		os.Exit(1)
 	}
 }
@@ -473,6 +1155,42 @@ func promptLine(reader *bufio.Reader, prompt string) string {
 	return strings.TrimSpace(line)
 }
 
+// rankableMemories returns the lines of today's note and of long-term
+// memory as memory items, without the timestamps of today's entries.
+func rankableMemories(mem *memory.MemoryStore) []memory.MemoryItem {
+	items := make([]memory.MemoryItem, 0)
+	if td, err := mem.ReadToday(); err == nil && td != "" {
+		for _, line := range strings.Split(td, "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			// strip leading timestamp [2026-02-07...] if present
+			if idx := strings.Index(line, "] "); idx != -1 && strings.HasPrefix(line, "[") {
+				line = strings.TrimSpace(line[idx+2:])
+			}
+			items = append(items, memory.MemoryItem{Kind: "today", Text: line})
+		}
+	}
+	if lt, err := mem.ReadLongTerm(); err == nil && lt != "" {
+		for _, line := range strings.Split(lt, "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			items = append(items, memory.MemoryItem{Kind: "long", Text: line})
+		}
+	}
+	return items
+}
+
+// channelAccess returns the allow and deny entries of channel: its own
+// allowFrom plus the entries of the shared access block that apply to it.
+func channelAccess(channel string, allowFrom []string, shared config.AccessConfig) (allow, deny []string) {
+	allow = slices.Concat(allowFrom, access.ForChannel(channel, shared.Allow))
+	return allow, access.ForChannel(channel, shared.Deny)
+}
+
 // parseAllowFrom splits a comma-separated string into a trimmed slice.
 // Returns an empty slice (not nil) if the input is blank.
 func parseAllowFrom(s string) []string {
@@ -567,6 +1285,163 @@ func setupDiscordInteractive(reader *bufio.Reader, cfg config.Config, cfgPath st
 	fmt.Println("Discord configured! Run 'picobot gateway' to start.")
 }
 
+// whatsappDBPath returns the configured WhatsApp session database, with
+// "~/" expanded.
+func whatsappDBPath() string {
+	cfg, _ := config.LoadConfig()
+	dbPath := cfg.Channels.WhatsApp.DBPath
+	if dbPath == "" {
+		dbPath = "~/.picobot/whatsapp.db"
+	}
+	if strings.HasPrefix(dbPath, "~/") {
+		home, _ := os.UserHomeDir()
+		dbPath = filepath.Join(home, dbPath[2:])
+	}
+	return dbPath
+}
+
+// newLocalAgent builds the agent of the commands that talk to it from this
+// machine (agent, repl, pipe): the provider and model from cfg, or the --model
+// and --seed flags of cmd, without a scheduler.
+func newLocalAgent(cmd *cobra.Command, hub *chat.Hub, cfg config.Config) *agent.AgentLoop {
+	setSanitizer(hub, cfg)
+	modelFlag, _ := cmd.Flags().GetString("model")
+	var provider providers.LLMProvider
+	if cfg.Providers.OpenAI != nil && cfg.Providers.OpenAI.APIKey != "" {
+		p := providers.NewOpenAIProvider(cfg.Providers.OpenAI.APIKey, cfg.Providers.OpenAI.APIBase, cfg.Agents.Defaults.RequestTimeoutS)
+		p.FallbackKeys = cfg.Providers.OpenAI.APIKeys
+		p.PromptCaching = cfg.Providers.OpenAI.PromptCaching
+		p.Stop = cfg.Providers.OpenAI.Stop
+		provider = p
+	} else {
+		provider = providers.NewStubProviderFromConfig(cfg)
+	}
+
+	// choose model: flag > config default > provider default
+	model := modelFlag
+	if model == "" && cfg.Agents.Defaults.Model != "" {
+		model = cfg.Agents.Defaults.Model
+	}
+	if model == "" {
+		model = provider.GetDefaultModel()
+	}
+
+	maxIter := cfg.Agents.Defaults.MaxToolIterations
+	if maxIter <= 0 {
+		maxIter = 100
+	}
+	ag := agent.NewAgentLoop(hub, provider, model, maxIter, cfg.Agents.Defaults.Workspace, nil)
+	ag.SetDraftModel(cfg.Agents.Defaults.DraftModel)
+	ag.SetArchiveLinks(cfg.Agents.Defaults.ArchiveLinks)
+	if seed := cfg.Agents.Defaults.Seed; seed != nil {
+		ag.SetSeed(*seed)
+	}
+	if ranker, err := memory.NewRanker("", cfg, provider, model); err != nil {
+		fmt.Fprintf(os.Stderr, "%v; ranking memories with the model\n", err)
+	} else {
+		ag.SetMemoryRanker(ranker)
+	}
+	if cmd.Flags().Changed("seed") {
+		seed, _ := cmd.Flags().GetInt64("seed")
+		ag.SetSeed(seed)
+	}
+	ag.SetCredentials(cfg.Credentials)
+	ag.SetEventWebhooks(cfg.Events.Webhooks)
+	if vault := cfg.Agents.Defaults.ObsidianVault; vault != "" {
+		if strings.HasPrefix(vault, "~/") {
+			home, _ := os.UserHomeDir()
+			vault = filepath.Join(home, vault[2:])
+		}
+		ag.SetObsidianVault(vault)
+	}
+	return ag
+}
+
+// loadRuntimeConfig loads the config for running the agent, with the
+// keyring references among its secrets resolved. Secrets that cannot be
+// read are reported and left empty.
+func loadRuntimeConfig(cmd *cobra.Command) config.Config {
+	cfg, _ := config.LoadConfig()
+	if err := config.ResolveSecrets(&cfg, keyring.Get); err != nil {
+		fmt.Fprintln(cmd.ErrOrStderr(), "warning: reading secrets from the keyring:", err)
+	}
+	return cfg
+}
+
+// reloadKeys gives provider the API keys of the configuration as it now is
+// on disk and in the keyring, so that a key can be rotated without a
+// restart. Channel tokens are not reloaded.
+func reloadKeys(cmd *cobra.Command, provider providers.LLMProvider) {
+	op, ok := provider.(*providers.OpenAIProvider)
+	if !ok {
+		log.Printf("provider: no API keys to reload")
+		return
+	}
+	cfg := loadRuntimeConfig(cmd)
+	if cfg.Providers.OpenAI == nil || (cfg.Providers.OpenAI.APIKey == "" && len(cfg.Providers.OpenAI.APIKeys) == 0) {
+		log.Printf("provider: the configuration has no API key, keeping %s", op.KeyStatus())
+		return
+	}
+	op.SetKeys(cfg.Providers.OpenAI.APIKey, cfg.Providers.OpenAI.APIKeys)
+	log.Printf("provider: reloaded API keys, using %s", op.KeyStatus())
+}
+
+// readSecret returns the secret to store in the keyring: typed on the
+// terminal without echo, else the first line of stdin.
+func readSecret(cmd *cobra.Command) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("reading the secret from stdin: %w", err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	fmt.Fprint(cmd.ErrOrStderr(), "Secret: ")
+	secret, err := term.ReadPassword(fd)
+	fmt.Fprintln(cmd.ErrOrStderr())
+	if err != nil {
+		return "", err
+	}
+	if len(secret) == 0 {
+		return "", fmt.Errorf("a secret is required")
+	}
+	return string(secret), nil
+}
+
+// readPassphrase returns the backup passphrase: $PICOBOT_BACKUP_PASSPHRASE
+// for scripts, else typed on the terminal, twice when confirm is set.
+func readPassphrase(cmd *cobra.Command, confirm bool) ([]byte, error) {
+	if p := os.Getenv("PICOBOT_BACKUP_PASSPHRASE"); p != "" {
+		return []byte(p), nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("no terminal to type the passphrase in; set PICOBOT_BACKUP_PASSPHRASE")
+	}
+	fmt.Fprint(cmd.ErrOrStderr(), "Passphrase: ")
+	pass, err := term.ReadPassword(fd)
+	fmt.Fprintln(cmd.ErrOrStderr())
+	if err != nil {
+		return nil, err
+	}
+	if len(pass) == 0 {
+		return nil, fmt.Errorf("a passphrase is required")
+	}
+	if confirm {
+		fmt.Fprint(cmd.ErrOrStderr(), "Passphrase again: ")
+		again, err := term.ReadPassword(fd)
+		fmt.Fprintln(cmd.ErrOrStderr())
+		if err != nil {
+			return nil, err
+		}
+		if string(again) != string(pass) {
+			return nil, fmt.Errorf("the passphrases differ")
+		}
+	}
+	return pass, nil
+}
+
 func setupWhatsAppInteractive(cfg config.Config, cfgPath string) {
 	fmt.Println()
 	fmt.Println("=== WhatsApp Setup ===")
@@ -596,3 +1471,22 @@ func setupWhatsAppInteractive(cfg config.Config, cfgPath string) {
 
 	fmt.Println("\nWhatsApp setup complete! Run 'picobot gateway' to start.")
 }
+
+// setSanitizer makes hub clean replies with the rules of channels.sanitize.
+// Invalid rules are reported and ignored.
+func setSanitizer(hub *chat.Hub, cfg config.Config) {
+	if len(cfg.Channels.Sanitize) == 0 {
+		return
+	}
+	rules := make(map[string][]chat.SanitizeRule, len(cfg.Channels.Sanitize))
+	for channel, list := range cfg.Channels.Sanitize {
+		for _, r := range list {
+			rules[channel] = append(rules[channel], chat.SanitizeRule(r))
+		}
+	}
+	if s, err := chat.NewSanitizer(rules); err != nil {
+		fmt.Fprintf(os.Stderr, "ignoring channels.sanitize: %v\n", err)
+	} else {
+		hub.SetSanitizer(s)
+	}
+}
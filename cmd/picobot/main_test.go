@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
@@ -123,6 +124,37 @@ func TestMemoryCLI_Rank(t *testing.T) {
 	}
 }
 
+func TestMemoryCLI_Eval(t *testing.T) {
+	tmp := t.TempDir()
+	os.Setenv("HOME", tmp)
+	if _, _, err := config.Onboard(); err != nil {
+		t.Fatalf("onboard failed: %v", err)
+	}
+	cfg, _ := config.LoadConfig()
+	ws := cfg.Agents.Defaults.Workspace
+	if strings.HasPrefix(ws, "~") {
+		home, _ := os.UserHomeDir()
+		ws = filepath.Join(home, ws[2:])
+	}
+	mem := memory.NewMemoryStoreWithWorkspace(ws, 100)
+	_ = mem.AppendToday("dentist on tuesday at 10")
+	_ = mem.AppendToday("buy milk and eggs")
+	cases := filepath.Join(tmp, "cases.json")
+	os.WriteFile(cases, []byte(`[{"query":"dentist appointment","relevant":["dentist"]}]`), 0o644)
+
+	cmd := NewRootCmd()
+	buf := &bytes.Buffer{}
+	cmd.SetOut(buf)
+	cmd.SetArgs([]string{"memory", "eval", "-f", cases, "-k", "1", "--ranker", "simple,bm25"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("eval failed: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "recall@1") || !strings.Contains(out, "bm25") || !strings.Contains(out, "1.00") {
+		t.Fatalf("unexpected output: %q", out)
+	}
+}
+
 func TestAgentCLI_ModelFlag(t *testing.T) {
 	// set HOME to a temp dir so onboard writes to temp
 	tmp := t.TempDir()
@@ -148,3 +180,61 @@ func TestAgentCLI_ModelFlag(t *testing.T) {
 		t.Fatalf("expected stub echo output, got: %q", out)
 	}
 }
+
+func TestREPLCLI(t *testing.T) {
+	tmp := t.TempDir()
+	os.Setenv("HOME", tmp)
+	if _, _, err := config.Onboard(); err != nil {
+		t.Fatalf("onboard failed: %v", err)
+	}
+	cfgPath, _, _ := config.ResolveDefaultPaths()
+	cfg2, _ := config.LoadConfig()
+	cfg2.Providers.OpenAI = nil
+	_ = config.SaveConfig(cfg2, cfgPath)
+
+	cmd := NewRootCmd()
+	buf := &bytes.Buffer{}
+	cmd.SetOut(buf)
+	cmd.SetIn(strings.NewReader("hello\n/quit\n"))
+	cmd.SetArgs([]string{"repl"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("repl failed: %v", err)
+	}
+	if out := buf.String(); !strings.Contains(out, "(stub) Echo") {
+		t.Fatalf("expected stub echo output, got: %q", out)
+	}
+}
+
+func TestPipeCLI(t *testing.T) {
+	tmp := t.TempDir()
+	os.Setenv("HOME", tmp)
+	if _, _, err := config.Onboard(); err != nil {
+		t.Fatalf("onboard failed: %v", err)
+	}
+	cfgPath, _, _ := config.ResolveDefaultPaths()
+	cfg2, _ := config.LoadConfig()
+	cfg2.Providers.OpenAI = nil
+	_ = config.SaveConfig(cfg2, cfgPath)
+
+	cmd := NewRootCmd()
+	buf := &bytes.Buffer{}
+	cmd.SetOut(buf)
+	cmd.SetIn(strings.NewReader("line one\nline two\n"))
+	cmd.SetArgs([]string{"pipe", "-p", "Summarize:"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("pipe failed: %v", err)
+	}
+	if out := buf.String(); !strings.Contains(out, "(stub) Echo") || !strings.Contains(out, "line two") {
+		t.Fatalf("expected stub echo output, got: %q", out)
+	}
+
+	// Nothing to send is a usage error, with its own exit status.
+	cmd = NewRootCmd()
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.SetIn(strings.NewReader("  \n"))
+	cmd.SetArgs([]string{"pipe"})
+	var exit exitError
+	if err := cmd.Execute(); !errors.As(err, &exit) || exit.code != 2 {
+		t.Fatalf("expected exit status 2, got %v", err)
+	}
+}
@@ -8,3 +8,8 @@ import "embed"
 //
 //go:embed skills/*
 var Skills embed.FS
+
+// WebChat contains the page of the web chat channel.
+//
+//go:embed webchat/index.html
+var WebChat embed.FS
@@ -0,0 +1,181 @@
+// Package access decides who may talk to the bot. Allowlist entries are
+// patterns rather than exact IDs, so an entry can cover a country's phone
+// numbers, a family's usernames or a block of numeric IDs:
+//
+//	15551234567       exactly this ID
+//	+55*  @ana*       globs (path.Match syntax); a leading "+" is ignored
+//	1000-1999         a numeric range, both ends included
+//
+// Matching is case-insensitive. Usernames can be changed and, once given
+// up, taken by someone else: an "@name" entry matches whoever holds the name
+// at the time, so entries that must hold (and every deny entry) should be
+// IDs.
+package access
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// List is a compiled list of patterns.
+type List struct {
+	entries []string // as configured
+	exact   map[string]struct{}
+	globs   []string
+	ranges  [][2]uint64
+}
+
+// Compile parses entries, failing on a malformed glob or range.
+func Compile(entries []string) (*List, error) {
+	l := &List{exact: make(map[string]struct{})}
+	for _, e := range entries {
+		p := normalize(e)
+		if p == "" {
+			continue
+		}
+		l.entries = append(l.entries, e)
+		if lo, hi, ok := parseRange(p); ok {
+			if lo > hi {
+				return nil, fmt.Errorf("access: range %q is reversed", e)
+			}
+			l.ranges = append(l.ranges, [2]uint64{lo, hi})
+			continue
+		}
+		if strings.ContainsAny(p, "*?[") {
+			if _, err := path.Match(p, ""); err != nil {
+				return nil, fmt.Errorf("access: bad pattern %q: %w", e, err)
+			}
+			l.globs = append(l.globs, p)
+			continue
+		}
+		l.exact[p] = struct{}{}
+	}
+	return l, nil
+}
+
+// normalize lowercases e and drops the "+" of an international phone number.
+func normalize(e string) string {
+	e = strings.ToLower(strings.TrimSpace(e))
+	if len(e) > 1 && e[0] == '+' && (e[1] >= '0' && e[1] <= '9' || e[1] == '*') {
+		e = e[1:]
+	}
+	return e
+}
+
+// parseRange parses "lo-hi" of two unsigned integers.
+func parseRange(p string) (lo, hi uint64, ok bool) {
+	a, b, found := strings.Cut(p, "-")
+	if !found {
+		return 0, 0, false
+	}
+	lo, err1 := strconv.ParseUint(a, 10, 64)
+	hi, err2 := strconv.ParseUint(b, 10, 64)
+	return lo, hi, err1 == nil && err2 == nil
+}
+
+// Len returns the number of entries of the list.
+func (l *List) Len() int { return len(l.entries) }
+
+// Entries returns the entries of the list as configured.
+func (l *List) Entries() []string { return l.entries }
+
+// Match reports whether any of ids (e.g. a user ID and "@username") matches
+// an entry of the list. Empty ids never match.
+func (l *List) Match(ids ...string) bool {
+	for _, id := range ids {
+		id = normalize(id)
+		if id == "" || id == "@" {
+			continue
+		}
+		if _, ok := l.exact[id]; ok {
+			return true
+		}
+		for _, g := range l.globs {
+			if ok, _ := path.Match(g, id); ok {
+				return true
+			}
+		}
+		if n, err := strconv.ParseUint(id, 10, 64); err == nil {
+			for _, r := range l.ranges {
+				if n >= r[0] && n <= r[1] {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Policy is the access rule of a channel: senders matching Deny are
+// refused, the others are accepted when Allow is empty (the channel is open)
+// or they match it.
+type Policy struct {
+	Allow  *List
+	Deny   *List
+	closed bool
+}
+
+// Closed returns a policy refusing everyone, for a channel whose allowlist
+// could not be compiled: failing closed rather than open.
+func Closed() *Policy {
+	empty := &List{exact: make(map[string]struct{})}
+	return &Policy{Allow: empty, Deny: empty, closed: true}
+}
+
+// NewPolicy compiles the allow and deny entries of a channel.
+func NewPolicy(allow, deny []string) (*Policy, error) {
+	a, err := Compile(allow)
+	if err != nil {
+		return nil, err
+	}
+	d, err := Compile(deny)
+	if err != nil {
+		return nil, err
+	}
+	return &Policy{Allow: a, Deny: d}, nil
+}
+
+// Open reports whether the policy accepts anyone not denied.
+func (p *Policy) Open() bool { return !p.closed && p.Allow.Len() == 0 }
+
+// Allowed reports whether the sender known by ids may talk to the bot.
+func (p *Policy) Allowed(ids ...string) bool {
+	if p.closed || p.Deny.Match(ids...) {
+		return false
+	}
+	return p.Open() || p.Allow.Match(ids...)
+}
+
+// ForChannel selects the entries of the shared access block that apply to
+// channel: unqualified ones, and those qualified with "channel:" (the
+// qualifier removed).
+func ForChannel(channel string, entries []string) []string {
+	var out []string
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if name, rest, ok := strings.Cut(e, ":"); ok && isChannelName(name) {
+			if strings.EqualFold(name, channel) {
+				out = append(out, rest)
+			}
+			continue
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// isChannelName reports whether s can be a channel qualifier: a plain word,
+// not part of a pattern.
+func isChannelName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
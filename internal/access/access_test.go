@@ -0,0 +1,62 @@
+package access
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPolicy(t *testing.T) {
+	p, err := NewPolicy([]string{"42", "+5511*", "@ana*", "1000-1999"}, []string{"1500", "@anabot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		ids  []string
+		want bool
+	}{
+		{[]string{"42"}, true},
+		{[]string{"43"}, false},
+		{[]string{"5511987654321"}, true},
+		{[]string{"5521987654321"}, false},
+		{[]string{"7", "@Ana_Lima"}, true},
+		{[]string{"7", "@anabot"}, false}, // denied
+		{[]string{"1000"}, true},
+		{[]string{"1999"}, true},
+		{[]string{"1500"}, false}, // denied inside the range
+		{[]string{"2000"}, false},
+		{[]string{"", "@"}, false},
+	}
+	for _, tt := range tests {
+		if got := p.Allowed(tt.ids...); got != tt.want {
+			t.Errorf("Allowed(%q) = %v, want %v", tt.ids, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyOpen(t *testing.T) {
+	p, err := NewPolicy(nil, []string{"666"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Open() || !p.Allowed("1") || p.Allowed("666") {
+		t.Errorf("open policy: Open=%v Allowed(1)=%v Allowed(666)=%v", p.Open(), p.Allowed("1"), p.Allowed("666"))
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, e := range []string{"[a-", "20-10"} {
+		if _, err := Compile([]string{e}); err == nil {
+			t.Errorf("Compile(%q) succeeded", e)
+		}
+	}
+}
+
+func TestForChannel(t *testing.T) {
+	entries := []string{"42", "telegram:@ana", "whatsapp:+55*", "1000-1999"}
+	if got, want := ForChannel("telegram", entries), []string{"42", "@ana", "1000-1999"}; !slices.Equal(got, want) {
+		t.Errorf("ForChannel(telegram) = %q, want %q", got, want)
+	}
+	if got, want := ForChannel("whatsapp", entries), []string{"42", "+55*", "1000-1999"}; !slices.Equal(got, want) {
+		t.Errorf("ForChannel(whatsapp) = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,131 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+// actionDetailLen caps the tool arguments and results shown in an action log.
+const actionDetailLen = 160
+
+// actionLog records what the agent did to answer a message: the tools it ran
+// and the decisions it took along the way. The last one of each person in
+// each chat is kept in memory for /what-did-you-do, so users can check what
+// the agent did on their behalf, e.g. which commands it ran or which files
+// it changed.
+type actionLog struct {
+	Message string
+	Start   time.Time
+	End     time.Time
+	Steps   []action
+}
+
+// action is a step of a turn: a tool run, or a decision when Tool is empty.
+type action struct {
+	Tool     string
+	Detail   string // the decision, or the tool's arguments
+	Result   string // the tool's result
+	Error    string
+	Duration time.Duration
+}
+
+func newActionLog(message string) *actionLog {
+	return &actionLog{Message: message, Start: time.Now()}
+}
+
+// decide records a decision.
+func (l *actionLog) decide(format string, args ...interface{}) {
+	l.Steps = append(l.Steps, action{Detail: fmt.Sprintf(format, args...)})
+}
+
+// tool records a tool run with its arguments, and its result or error.
+func (l *actionLog) tool(name string, args map[string]interface{}, result string, err error, d time.Duration) {
+	step := action{Tool: name, Result: clipAction(result), Duration: d}
+	if len(args) > 0 {
+		b, _ := json.Marshal(args)
+		step.Detail = clipAction(string(b))
+	}
+	if err != nil {
+		step.Error, step.Result = clipAction(err.Error()), ""
+	}
+	l.Steps = append(l.Steps, step)
+}
+
+// clipAction shortens s to one line of at most actionDetailLen characters.
+func clipAction(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= actionDetailLen {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:actionDetailLen-1]) + "…"
+}
+
+// String renders the log for the user.
+func (l *actionLog) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Last request (%s): %q\n", l.Start.Format("Jan 2 15:04"), clipAction(l.Message))
+	tools := 0
+	for i, s := range l.Steps {
+		if s.Tool == "" {
+			fmt.Fprintf(&b, "%d. %s\n", i+1, s.Detail)
+			continue
+		}
+		tools++
+		fmt.Fprintf(&b, "%d. Ran %s", i+1, s.Tool)
+		if s.Duration >= 10*time.Millisecond {
+			fmt.Fprintf(&b, " (%s)", s.Duration.Round(10*time.Millisecond))
+		}
+		if s.Detail != "" {
+			fmt.Fprintf(&b, " with %s", s.Detail)
+		}
+		switch {
+		case s.Error != "":
+			fmt.Fprintf(&b, "\n   failed: %s", s.Error)
+		case s.Result != "":
+			fmt.Fprintf(&b, "\n   → %s", s.Result)
+		}
+		b.WriteString("\n")
+	}
+	if tools == 0 {
+		b.WriteString("No tools were used.\n")
+	}
+	if !l.End.IsZero() {
+		fmt.Fprintf(&b, "Took %s.", l.End.Sub(l.Start).Round(100*time.Millisecond))
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// recordActions keeps l, whose turn is over, as the last turn of msg's
+// sender in its chat. Cron and heartbeat turns are not kept: they are
+// nobody's request, and would hide the user's own. Cron jobs come in on the
+// user's channel, from the sender "cron".
+func (a *AgentLoop) recordActions(msg chat.Inbound, l *actionLog) {
+	if isSystemChannel(msg.Channel) || msg.SenderID == "cron" {
+		return
+	}
+	l.End = time.Now()
+	a.actionsMu.Lock()
+	defer a.actionsMu.Unlock()
+	if a.actions == nil {
+		a.actions = make(map[string]*actionLog)
+	}
+	a.actions[senderKey(msg)] = l
+}
+
+// actionsText answers /what-did-you-do with the action log of the last
+// turn msg's sender asked for in its chat.
+func (a *AgentLoop) actionsText(msg chat.Inbound) string {
+	a.actionsMu.Lock()
+	l := a.actions[senderKey(msg)]
+	a.actionsMu.Unlock()
+	if l == nil {
+		return "I haven't done anything for you in this chat since I was last started."
+	}
+	return l.String()
+}
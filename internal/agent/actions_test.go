@@ -0,0 +1,54 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+func TestWhatDidYouDo(t *testing.T) {
+	b := chat.NewHub(10)
+	p := &FakeProvider{}
+	ag := NewAgentLoop(b, p, p.GetDefaultModel(), 3, t.TempDir(), nil)
+	ask := chat.Inbound{Channel: "telegram", SenderID: "u", ChatID: "1", Content: "/what-did-you-do"}
+
+	if reply, ok := ag.handleCommand(ask); !ok || !strings.Contains(reply, "haven't done anything") {
+		t.Fatalf("before any turn: %q, %v", reply, ok)
+	}
+
+	ag.processInbound(context.Background(), chat.Inbound{Channel: "telegram", SenderID: "u", ChatID: "1", Content: "send me a hello"})
+	reply, _ := ag.handleCommand(ask)
+	for _, want := range []string{`"send me a hello"`, "1. Used model fake", `2. Ran message`, `{"content":"hello from tool"}`, "→ sent", "Took "} {
+		if !strings.Contains(reply, want) {
+			t.Errorf("log lacks %q:\n%s", want, reply)
+		}
+	}
+
+	// The menu's spelling works too, and other chats have logs of their own.
+	ask.Content = "/what_did_you_do"
+	if again, _ := ag.handleCommand(ask); again != reply {
+		t.Errorf("/what_did_you_do = %q", again)
+	}
+	ask.ChatID = "2"
+	if other, _ := ag.handleCommand(ask); !strings.Contains(other, "haven't done anything") {
+		t.Errorf("other chat: %q", other)
+	}
+
+	// In a group each member sees only their own last request, and a cron
+	// turn in the chat leaves it in place.
+	ag.processInbound(context.Background(), chat.Inbound{Channel: "telegram", SenderID: "ana", ChatID: "-100", Content: "send me a hello"})
+	ag.processInbound(context.Background(), chat.Inbound{Channel: "cron", SenderID: "cron", ChatID: "-100", Content: "daily digest"})
+	if bob, _ := ag.handleCommand(chat.Inbound{Channel: "telegram", SenderID: "bob", ChatID: "-100", Content: "/what-did-you-do"}); !strings.Contains(bob, "haven't done anything") {
+		t.Errorf("another member's log shown: %q", bob)
+	}
+	if ana, _ := ag.handleCommand(chat.Inbound{Channel: "telegram", SenderID: "ana", ChatID: "-100", Content: "/what-did-you-do"}); !strings.Contains(ana, `"send me a hello"`) {
+		t.Errorf("own log after a cron turn: %q", ana)
+	}
+	// Cron jobs fire on the chat's own channel, from the sender "cron".
+	ag.processInbound(context.Background(), chat.Inbound{Channel: "telegram", SenderID: "cron", ChatID: "-100", Content: "send me a hello"})
+	if cron, _ := ag.handleCommand(chat.Inbound{Channel: "telegram", SenderID: "cron", ChatID: "-100", Content: "/what-did-you-do"}); !strings.Contains(cron, "haven't done anything") {
+		t.Errorf("cron turn logged as its sender's: %q", cron)
+	}
+}
@@ -0,0 +1,124 @@
+package agent
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/telemetry"
+	"github.com/local/picobot/internal/watchdog"
+)
+
+// adminCommands are answered only for senders their channel marks as admins
+// (see chat.Inbound.IsAdmin), and are not advertised in channel menus. /allow,
+// /deny and /role change the channel's own allowlist, so the channel answers
+// them.
+var adminCommands = []chat.Command{
+	{Name: "allow", Description: "Add, remove or list allowed user IDs"},
+	{Name: "deny", Description: "Block user IDs"},
+	{Name: "role", Description: "Set the role (admin or user) of user IDs"},
+	{Name: "usage", Description: "Show estimated token usage"},
+	{Name: "restart", Description: "Restart a channel, or show channel health"},
+	{Name: "broadcast", Description: "Send a message to every chat, paced to the channels' limits"},
+	{Name: "publish", Description: "Publish the draft post to its broadcast channel, or cancel it"},
+}
+
+// usageText summarizes the prompt telemetry of today and the last week.
+func (a *AgentLoop) usageText() string {
+	recs, err := telemetry.LoadPrompt(a.workspace, 7)
+	if err != nil {
+		log.Printf("error loading prompt telemetry: %v", err)
+		return "Sorry, I couldn't read the usage records."
+	}
+	if len(recs) == 0 {
+		return "No usage recorded in the last 7 days."
+	}
+	today := time.Now().UTC().Format("2006-01-02")
+	var todayTurns, todayTokens, weekTokens int
+	perChat := map[string][2]int{}    // chat -> {turns, tokens}
+	perFeature := map[string][2]int{} // feature -> {turns, tokens}
+	for _, r := range recs {
+		n := r.Tokens()
+		weekTokens += n
+		if r.Time.UTC().Format("2006-01-02") == today {
+			todayTurns++
+			todayTokens += n
+		}
+		key := r.Channel + ":" + r.ChatID
+		c := perChat[key]
+		perChat[key] = [2]int{c[0] + 1, c[1] + n}
+		f := perFeature[r.FeatureName()]
+		perFeature[r.FeatureName()] = [2]int{f[0] + 1, f[1] + n}
+	}
+	chats := byTokens(perChat)
+	features := byTokens(perFeature)
+
+	var b strings.Builder
+	b.WriteString("Estimated prompt tokens (replies are billed on top):\n")
+	fmt.Fprintf(&b, "Today: %d turns, %d tokens\n", todayTurns, todayTokens)
+	fmt.Fprintf(&b, "Last 7 days: %d turns, %d tokens\n", len(recs), weekTokens)
+	b.WriteString("\nTop chats this week:\n")
+	for i, k := range chats {
+		if i == 5 {
+			break
+		}
+		fmt.Fprintf(&b, "%s: %d tokens (%d turns)\n", k, perChat[k][1], perChat[k][0])
+	}
+	b.WriteString("\nBy feature this week:\n")
+	for i, k := range features {
+		if i == 8 {
+			break
+		}
+		fmt.Fprintf(&b, "%s: %d tokens (%d turns, %.0f%%)\n", k, perFeature[k][1], perFeature[k][0], float64(perFeature[k][1])*100/float64(max(weekTokens, 1)))
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// byTokens returns the keys of counts ({turns, tokens}), most tokens first.
+func byTokens(counts map[string][2]int) []string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]][1] != counts[keys[j]][1] {
+			return counts[keys[i]][1] > counts[keys[j]][1]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// restartText restarts the named channel, or lists the health of every
+// channel the watchdog knows when no name is given.
+func restartText(args []string) string {
+	if len(args) > 0 {
+		if !watchdog.Default.Restart(args[0]) {
+			return fmt.Sprintf("Unknown channel %q. Use /restart to list them.", args[0])
+		}
+		return fmt.Sprintf("Restarting %s.", args[0])
+	}
+	statuses := watchdog.Default.Statuses()
+	if len(statuses) == 0 {
+		return "No channels to restart."
+	}
+	var b strings.Builder
+	b.WriteString("Channels (use /restart <name>):\n")
+	for _, st := range statuses {
+		b.WriteString(formatChannelStatus(st) + "\n")
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// formatChannelStatus renders the health of one channel on a line.
+func formatChannelStatus(st watchdog.Status) string {
+	state := "ok"
+	if st.Stalled {
+		state = "stalled"
+	}
+	return fmt.Sprintf("%s: %s, last seen alive %s ago, %d restarts",
+		st.Name, state, time.Since(st.LastBeat).Round(time.Second), st.Restarts)
+}
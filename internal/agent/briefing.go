@@ -0,0 +1,115 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+)
+
+// briefingSection renders one part of a briefing, or "" when it has nothing
+// to say today. Sections are plain code fetching plain data, so the briefing
+// does not depend on a long prompt being followed to the letter.
+type briefingSection func(ctx context.Context, a *AgentLoop, b config.BriefingConfig, now time.Time) (string, error)
+
+// briefingSections are the sections a briefing can list in config, in the
+// order they are written when listed.
+var briefingSections = map[string]briefingSection{
+	"weather":   weatherSection,
+	"calendar":  calendarSection,
+	"reminders": remindersSection,
+	"todo":      todoSection,
+	"dates":     datesSection,
+	"rotations": rotationsSection,
+	"rss":       rssSection,
+	"tasks":     tasksSection,
+}
+
+// SetBriefings schedules the configured briefings. Unknown sections are
+// reported and skipped.
+func (a *AgentLoop) SetBriefings(bs []config.BriefingConfig) {
+	for _, b := range bs {
+		for _, s := range b.Sections {
+			if _, ok := briefingSections[s]; !ok {
+				log.Printf("briefing %q: unknown section %q (known: weather, calendar, reminders, todo, dates, rotations, rss, tasks)", b.Name, s)
+			}
+		}
+	}
+	a.briefings = bs
+}
+
+// composeBriefing renders the sections of b into one message. A failing
+// section is mentioned rather than failing the whole briefing.
+func (a *AgentLoop) composeBriefing(ctx context.Context, b config.BriefingConfig, now time.Time) string {
+	title := b.Name
+	if title == "" {
+		title = "Good morning!"
+	}
+	parts := []string{fmt.Sprintf("%s %s", title, now.Format("Monday, Jan 2"))}
+	for _, name := range b.Sections {
+		section, ok := briefingSections[name]
+		if !ok {
+			continue
+		}
+		text, err := section(ctx, a, b, now)
+		if err != nil {
+			log.Printf("briefing section %s: %v", name, err)
+			text = fmt.Sprintf("(%s unavailable)", name)
+		}
+		if text = strings.TrimSpace(text); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// runBriefings sends each briefing once a day at its time. A briefing whose
+// time has already passed when picobot starts waits for the next day.
+func (a *AgentLoop) runBriefings(ctx context.Context) {
+	if len(a.briefings) == 0 {
+		return
+	}
+	sent := make([]string, len(a.briefings)) // day of the last send
+	now := time.Now()
+	for i, b := range a.briefings {
+		if at, ok := briefingTime(b, now); ok && !now.Before(at) {
+			sent[i] = now.Format("2006-01-02")
+		}
+	}
+	ticker := time.NewTicker(rotationCheck)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			today := now.Format("2006-01-02")
+			for i, b := range a.briefings {
+				at, ok := briefingTime(b, now)
+				if !ok || now.Before(at) || sent[i] == today {
+					continue
+				}
+				sent[i] = today
+				out := chat.Outbound{Channel: b.Channel, ChatID: b.ChatID, Content: a.composeBriefing(ctx, b, now), Type: chat.TypeReport}
+				select {
+				case a.hub.Out <- out:
+				default:
+					log.Println("Outbound channel full, dropping message")
+				}
+			}
+		}
+	}
+}
+
+// briefingTime returns today's send time of b, in local time.
+func briefingTime(b config.BriefingConfig, now time.Time) (time.Time, bool) {
+	t, err := time.Parse("15:04", b.Time)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location()), true
+}
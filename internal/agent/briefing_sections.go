@@ -0,0 +1,306 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/useragent"
+)
+
+// briefingClient fetches the weather, calendars and feeds of briefings.
+var briefingClient = useragent.Client(20 * time.Second)
+
+// weatherURL is the wttr.in endpoint the weather section asks; tests point it
+// elsewhere.
+var weatherURL = "https://wttr.in/"
+
+const (
+	maxBriefingBody = 1 << 20 // bytes read from a calendar or feed
+	maxFeedItems    = 5       // items listed per feed
+)
+
+// briefingGet fetches u, returning at most maxBriefingBody bytes of it.
+func briefingGet(ctx context.Context, u string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := briefingClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %s: %s", u, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxBriefingBody))
+}
+
+// weatherSection is a one-line forecast for the configured location.
+func weatherSection(ctx context.Context, a *AgentLoop, b config.BriefingConfig, now time.Time) (string, error) {
+	if b.Weather == "" {
+		return "", nil
+	}
+	body, err := briefingGet(ctx, weatherURL+url.PathEscape(b.Weather)+"?format=3")
+	if err != nil {
+		return "", err
+	}
+	return "Weather: " + strings.TrimSpace(string(body)), nil
+}
+
+// calendarSection lists today's events of the configured iCalendar feed.
+func calendarSection(ctx context.Context, a *AgentLoop, b config.BriefingConfig, now time.Time) (string, error) {
+	if b.CalendarURL == "" {
+		return "", nil
+	}
+	body, err := briefingGet(ctx, b.CalendarURL)
+	if err != nil {
+		return "", err
+	}
+	events := todaysEvents(string(body), now)
+	if len(events) == 0 {
+		return "Calendar: nothing today.", nil
+	}
+	return "Calendar:\n" + strings.Join(events, "\n"), nil
+}
+
+// todaysEvents returns the events of an iCalendar document starting on the
+// day of now, in order, as "- 09:30 Dentist" (or "- all day: Holiday").
+// Recurring events are not expanded.
+func todaysEvents(ics string, now time.Time) []string {
+	type event struct {
+		start  time.Time
+		allDay bool
+		title  string
+	}
+	// unfold continuation lines
+	ics = strings.NewReplacer("\r\n ", "", "\r\n\t", "", "\n ", "", "\n\t", "").Replace(ics)
+	var events []event
+	var cur *event
+	sc := bufio.NewScanner(strings.NewReader(ics))
+	sc.Buffer(make([]byte, 64*1024), maxBriefingBody)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name, params, _ := strings.Cut(name, ";")
+		switch name {
+		case "BEGIN":
+			if value == "VEVENT" {
+				cur = &event{}
+			}
+		case "END":
+			if value == "VEVENT" && cur != nil {
+				if y, m, d := cur.start.Date(); !cur.start.IsZero() && y == now.Year() && m == now.Month() && d == now.Day() {
+					events = append(events, *cur)
+				}
+				cur = nil
+			}
+		case "SUMMARY":
+			if cur != nil {
+				cur.title = strings.NewReplacer(`\,`, ",", `\;`, ";", `\n`, " ", `\\`, `\`).Replace(value)
+			}
+		case "DTSTART":
+			if cur != nil {
+				cur.start, cur.allDay = parseICSTime(value, params, now.Location())
+			}
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].start.Before(events[j].start) })
+	lines := make([]string, len(events))
+	for i, e := range events {
+		if e.allDay {
+			lines[i] = "- all day: " + e.title
+		} else {
+			lines[i] = fmt.Sprintf("- %s %s", e.start.Format("15:04"), e.title)
+		}
+	}
+	return lines
+}
+
+// parseICSTime parses a DTSTART value into loc, reporting whether it is a
+// whole day. Floating times are taken as local.
+func parseICSTime(value, params string, loc *time.Location) (time.Time, bool) {
+	if t, err := time.ParseInLocation("20060102", value, loc); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t.In(loc), false
+	}
+	in := loc
+	for _, p := range strings.Split(params, ";") {
+		if tz, ok := strings.CutPrefix(p, "TZID="); ok {
+			if l, err := time.LoadLocation(strings.Trim(tz, `"`)); err == nil {
+				in = l
+			}
+		}
+	}
+	if t, err := time.ParseInLocation("20060102T150405", value, in); err == nil {
+		return t.In(loc), false
+	}
+	return time.Time{}, false
+}
+
+// remindersSection lists the reminders scheduled in the chat for today.
+func remindersSection(ctx context.Context, a *AgentLoop, b config.BriefingConfig, now time.Time) (string, error) {
+	if a.scheduler == nil {
+		return "", nil
+	}
+	end := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+	jobs := a.scheduler.List()
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].FireAt.Before(jobs[j].FireAt) })
+	var lines []string
+	for _, j := range jobs {
+		if j.Channel == b.Channel && j.ChatID == b.ChatID && j.FireAt.Before(end) {
+			lines = append(lines, fmt.Sprintf("- %s %s", j.FireAt.In(now.Location()).Format("15:04"), j.Message))
+		}
+	}
+	if len(lines) == 0 {
+		return "", nil
+	}
+	return "Reminders today:\n" + strings.Join(lines, "\n"), nil
+}
+
+// todoSection lists the open items of the to-do checklist.
+func todoSection(ctx context.Context, a *AgentLoop, b config.BriefingConfig, now time.Time) (string, error) {
+	list, err := a.loadTodo()
+	if err != nil {
+		return "", err
+	}
+	var lines []string
+	for _, it := range list.items {
+		if !it.done {
+			lines = append(lines, "- "+it.text)
+		}
+	}
+	if len(lines) == 0 {
+		return "", nil
+	}
+	return "To-do:\n" + strings.Join(lines, "\n"), nil
+}
+
+// datesSection lists the chat's birthdays and anniversaries of the coming
+// week.
+func datesSection(ctx context.Context, a *AgentLoop, b config.BriefingConfig, now time.Time) (string, error) {
+	ds, err := a.dates.Upcoming(b.Channel, b.ChatID, now, 7)
+	if err != nil {
+		return "", err
+	}
+	if len(ds) == 0 {
+		return "", nil
+	}
+	lines := make([]string, len(ds))
+	for i, d := range ds {
+		lines[i] = "- " + d.Describe(now)
+	}
+	return "Coming up:\n" + strings.Join(lines, "\n"), nil
+}
+
+// rotationsSection tells whose turn it is in the chat's rotations.
+func rotationsSection(ctx context.Context, a *AgentLoop, b config.BriefingConfig, now time.Time) (string, error) {
+	rs, err := a.rotations.List(b.Channel, b.ChatID)
+	if err != nil {
+		return "", err
+	}
+	if len(rs) == 0 {
+		return "", nil
+	}
+	lines := make([]string, len(rs))
+	for i, r := range rs {
+		lines[i] = "- " + r.Describe(now)
+	}
+	return "Chores:\n" + strings.Join(lines, "\n"), nil
+}
+
+// rssSection lists the items of the configured RSS or Atom feeds published
+// in the last day.
+func rssSection(ctx context.Context, a *AgentLoop, b config.BriefingConfig, now time.Time) (string, error) {
+	var parts []string
+	var errs []string
+	for _, u := range b.Feeds {
+		body, err := briefingGet(ctx, u)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		title, items, err := recentFeedItems(body, now.Add(-24*time.Hour))
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", u, err))
+			continue
+		}
+		if len(items) > 0 {
+			parts = append(parts, title+":\n"+strings.Join(items, "\n"))
+		}
+	}
+	if len(parts) == 0 && len(errs) > 0 {
+		return "", fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
+
+// feedDoc covers both RSS 2.0 (<rss><channel><item>) and Atom
+// (<feed><entry>) documents.
+type feedDoc struct {
+	Title   string     `xml:"title"`
+	Channel *feedDoc   `xml:"channel"`
+	Items   []feedItem `xml:"item"`
+	Entries []feedItem `xml:"entry"`
+}
+
+type feedItem struct {
+	Title     string `xml:"title"`
+	PubDate   string `xml:"pubDate"`
+	Published string `xml:"published"`
+	Updated   string `xml:"updated"`
+	Date      string `xml:"http://purl.org/dc/elements/1.1/ date"`
+}
+
+// recentFeedItems returns the title of a feed and its newest items published
+// after since, as "- title" lines. Items without a date are left out.
+func recentFeedItems(body []byte, since time.Time) (string, []string, error) {
+	var doc feedDoc
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		return "", nil, err
+	}
+	if doc.Channel != nil {
+		doc.Title, doc.Items = doc.Channel.Title, doc.Channel.Items
+	}
+	items := append(doc.Items, doc.Entries...)
+	var lines []string
+	for _, it := range items {
+		if len(lines) == maxFeedItems {
+			break
+		}
+		var published time.Time
+		for _, raw := range []string{it.PubDate, it.Published, it.Updated, it.Date} {
+			if t, ok := parseFeedTime(strings.TrimSpace(raw)); ok {
+				published = t
+				break
+			}
+		}
+		if published.After(since) {
+			lines = append(lines, "- "+strings.TrimSpace(it.Title))
+		}
+	}
+	return strings.TrimSpace(doc.Title), lines, nil
+}
+
+func parseFeedTime(s string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC1123Z, time.RFC1123, time.RFC3339, "Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,84 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/cron"
+)
+
+func TestComposeBriefing(t *testing.T) {
+	now := time.Date(2026, 3, 14, 7, 30, 0, 0, time.Local)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/Lisbon":
+			fmt.Fprint(w, "Lisbon: ☀️ +18°C\n")
+		case "/cal.ics":
+			fmt.Fprint(w, "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTART:20260314T093000\r\nSUMMARY:Dentist\r\nEND:VEVENT\r\n"+
+				"BEGIN:VEVENT\r\nDTSTART;VALUE=DATE:20260314\r\nSUMMARY:Pi day\\, again\r\nEND:VEVENT\r\n"+
+				"BEGIN:VEVENT\r\nDTSTART:20260315T093000\r\nSUMMARY:Tomorrow\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n")
+		case "/feed.xml":
+			fmt.Fprintf(w, `<rss><channel><title>Local news</title>
+<item><title>Fresh</title><pubDate>%s</pubDate></item>
+<item><title>Stale</title><pubDate>%s</pubDate></item></channel></rss>`,
+				now.Add(-2*time.Hour).Format(time.RFC1123Z), now.Add(-72*time.Hour).Format(time.RFC1123Z))
+		case "/down.xml":
+			http.Error(w, "nope", http.StatusBadGateway)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	defer func(u string) { weatherURL = u }(weatherURL)
+	weatherURL = srv.URL + "/"
+
+	ws := t.TempDir()
+	if err := os.WriteFile(filepath.Join(ws, todoFile), []byte("- [ ] buy bread\n- [x] call mum\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sched := cron.NewScheduler(func(cron.Job) {})
+	sched.Add("reminder", "take the pills", time.Until(now.Add(time.Hour)), "telegram", "1")
+	sched.Add("reminder", "someone else's", time.Until(now.Add(time.Hour)), "telegram", "2")
+	ag := NewAgentLoop(chat.NewHub(10), &modelRecorder{}, "main", 3, ws, sched)
+
+	b := config.BriefingConfig{
+		Time: "07:30", Channel: "telegram", ChatID: "1",
+		Sections:    []string{"weather", "calendar", "reminders", "todo", "dates", "rss"},
+		Weather:     "Lisbon",
+		CalendarURL: srv.URL + "/cal.ics",
+		Feeds:       []string{srv.URL + "/feed.xml", srv.URL + "/down.xml"},
+	}
+	got := ag.composeBriefing(context.Background(), b, now)
+	for _, want := range []string{
+		"Good morning! Saturday, Mar 14",
+		"Weather: Lisbon: ☀️ +18°C",
+		"Calendar:\n- all day: Pi day, again\n- 09:30 Dentist",
+		"Reminders today:\n- ",
+		"take the pills",
+		"To-do:\n- buy bread",
+		"Local news:\n- Fresh",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("briefing lacks %q:\n%s", want, got)
+		}
+	}
+	for _, unwanted := range []string{"Tomorrow", "someone else's", "call mum", "Stale", "Coming up", "unavailable"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("briefing has %q:\n%s", unwanted, got)
+		}
+	}
+
+	b.Sections, b.Feeds = []string{"rss"}, []string{srv.URL + "/down.xml"}
+	if got := ag.composeBriefing(context.Background(), b, now); !strings.Contains(got, "(rss unavailable)") {
+		t.Errorf("a failing section should be reported, got:\n%s", got)
+	}
+}
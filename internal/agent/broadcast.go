@@ -0,0 +1,64 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/local/picobot/internal/broadcast"
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+)
+
+// SetBroadcastLimits replaces the default pace of /broadcast for the
+// channels in limits (see broadcast.DefaultLimits).
+func (a *AgentLoop) SetBroadcastLimits(limits map[string]config.BroadcastLimit) {
+	overrides := make(map[string]broadcast.Limit, len(limits))
+	for channel, l := range limits {
+		overrides[channel] = broadcast.Limit{
+			PerSecond: l.PerSecond,
+			PerChat:   time.Duration(l.PerChatMs) * time.Millisecond,
+			MaxLen:    l.MaxLength,
+		}
+	}
+	a.broadcaster = broadcast.New(a.hub.Out, overrides)
+}
+
+// broadcastText starts sending text to every chat the agent has a
+// conversation with, except the admin's own, and returns the
+// acknowledgement. The progress is reported in the admin's chat.
+func (a *AgentLoop) broadcastText(msg chat.Inbound, text string) string {
+	if text == "" {
+		return "Usage: /broadcast <message>. The message goes to every chat I've talked with."
+	}
+	keys, err := a.sessions.Keys()
+	if err != nil {
+		log.Printf("error listing sessions: %v", err)
+		return "Sorry, I couldn't list the chats to broadcast to."
+	}
+	own := msg.Channel + ":" + msg.ChatID
+	var targets []broadcast.Target
+	for _, k := range keys {
+		t, err := broadcast.ParseTarget(k)
+		if err != nil || k == own || isSystemChannel(t.Channel) || t.Channel == "cli" {
+			continue
+		}
+		targets = append(targets, t)
+	}
+	if len(targets) == 0 {
+		return "There are no other chats to broadcast to."
+	}
+	ctx := a.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	report := func(p broadcast.Progress) {
+		a.hub.Out <- chat.Outbound{Channel: msg.Channel, ChatID: msg.ChatID, Content: p.String()}
+	}
+	go func() {
+		n, err := a.broadcaster.Send(ctx, targets, text, report)
+		log.Printf("broadcast: sent to %d of %d chats (err=%v)", n, len(targets), err)
+	}()
+	return fmt.Sprintf("Broadcasting to %d chats. I'll report the progress here.", len(targets))
+}
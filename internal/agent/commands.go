@@ -0,0 +1,170 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/session"
+	"github.com/local/picobot/internal/telemetry"
+)
+
+// builtinCommands are the slash commands answered by the agent itself,
+// without a round trip to the provider.
+var builtinCommands = []chat.Command{
+	{Name: "start", Description: "Say hello and show what I can do"},
+	{Name: "help", Description: "List commands and capabilities"},
+	{Name: "reset", Description: "Forget this conversation's history"},
+	{Name: "model", Description: "Show or switch the model for this chat"},
+	{Name: "trace", Description: "Show details of a failed request by its trace ID"},
+	{Name: "search", Description: "Find past messages of this chat"},
+	{Name: "links", Description: "List the links archived from this chat"},
+	{Name: "private", Description: "Stop or resume saving this conversation (on|off)"},
+	{Name: "tasks", Description: "Find commitments in today's conversation and schedule reminders"},
+	{Name: "profile", Description: "Show what I know about you, or reset to tell me again"},
+	{Name: "confirm", Description: "Run a request held back as expensive"},
+	{Name: "last", Description: "Get the full text of a reply that could not be delivered (full)"},
+	{Name: "research", Description: "Research a question on the web and answer with sources"},
+	// Telegram command names cannot have hyphens, so the menu offers the
+	// spelling with underscores; both are answered.
+	{Name: "what_did_you_do", Description: "Show the tools I ran and the decisions I took for your last request"},
+}
+
+// modelFor returns the model to use for a chat: its /model override, if any,
+// or the agent's default model.
+func (a *AgentLoop) modelFor(channel, chatID string) string {
+	if m, ok := a.chatModels[channel+":"+chatID]; ok {
+		return m
+	}
+	return a.model
+}
+
+// handleCommand answers built-in slash commands and the "!" grammar (see
+// handleBang). It returns false when msg is not one of them, so it goes to the
+// LLM as usual (unknown commands included).
+func (a *AgentLoop) handleCommand(msg chat.Inbound) (string, bool) {
+	if isSystemChannel(msg.Channel) {
+		return "", false
+	}
+	if strings.HasPrefix(msg.Content, "!") {
+		return a.handleBang(msg)
+	}
+	if !strings.HasPrefix(msg.Content, "/") {
+		return "", false
+	}
+	fields := strings.Fields(msg.Content)
+	name, _, _ := strings.Cut(strings.TrimPrefix(fields[0], "/"), "@")
+	args := fields[1:]
+	key := msg.Channel + ":" + msg.ChatID
+
+	switch strings.ToLower(name) {
+	case "start":
+		return "Hi! I'm picobot, your personal assistant. Just write to me in plain language.\n\n" + a.helpText(msg.IsAdmin()), true
+	case "help":
+		return a.helpText(msg.IsAdmin()), true
+	case "reset":
+		if a.private[key] != nil {
+			a.private[key] = &session.Session{Key: key}
+		}
+		if err := a.sessions.Reset(key); err != nil {
+			log.Printf("error resetting session %s: %v", key, err)
+			return "Sorry, I couldn't clear the conversation history.", true
+		}
+		return "Conversation history cleared. Long-term memory is kept.", true
+	case "model":
+		if len(args) == 0 {
+			return fmt.Sprintf("Current model: %s", a.modelFor(msg.Channel, msg.ChatID)), true
+		}
+		if args[0] == "default" || args[0] == a.model {
+			delete(a.chatModels, key)
+			return fmt.Sprintf("Switched back to the default model: %s", a.model), true
+		}
+		a.chatModels[key] = args[0]
+		return fmt.Sprintf("Switched to model %s for this chat. Use /model default to go back.", args[0]), true
+	case "trace":
+		if len(args) == 0 {
+			return "Usage: /trace <id>", true
+		}
+		rec, ok, err := telemetry.FindTrace(a.workspace, args[0])
+		if err != nil {
+			log.Printf("error looking up trace %s: %v", args[0], err)
+		}
+		// Traces hold the failed message, so only its own chat may read it.
+		if !ok || rec.Channel != msg.Channel || rec.ChatID != msg.ChatID {
+			return fmt.Sprintf("No trace %s found for this chat in the last %d days.", args[0], telemetry.TraceDays), true
+		}
+		return rec.Format(), true
+	case "search":
+		return a.searchText(key, args), true
+	case "links":
+		return a.linksText(key), true
+	case "private":
+		return a.privateText(key, args), true
+	case "profile":
+		return a.profileText(msg, args), true
+	case "last":
+		return a.lastText(msg, args), true
+	case "research":
+		_, question, _ := strings.Cut(strings.TrimSpace(msg.Content), fields[0])
+		return a.researchText(msg, strings.TrimSpace(question)), true
+	case "what-did-you-do", "what_did_you_do":
+		return a.actionsText(msg), true
+	case "confirm":
+		// Reached only when no request is held back (see heldTurnFor).
+		return "There is no request waiting for confirmation.", true
+	case "tasks":
+		ctx := a.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		return a.tasksText(ctx, msg.Channel, msg.ChatID, args), true
+	case "usage", "restart", "broadcast", "publish":
+		if !msg.IsAdmin() {
+			return fmt.Sprintf("Only admins can use /%s.", strings.ToLower(name)), true
+		}
+		switch strings.ToLower(name) {
+		case "usage":
+			return a.usageText(), true
+		case "broadcast":
+			_, text, _ := strings.Cut(strings.TrimSpace(msg.Content), fields[0])
+			return a.broadcastText(msg, strings.TrimSpace(text)), true
+		case "publish":
+			return a.publishText(msg, args), true
+		}
+		return restartText(args), true
+	}
+	return "", false
+}
+
+// helpText lists the built-in commands and the tools the agent can use, and
+// the admin commands for admins.
+func (a *AgentLoop) helpText(admin bool) string {
+	var b strings.Builder
+	b.WriteString("Commands:\n")
+	for _, c := range builtinCommands {
+		fmt.Fprintf(&b, "/%s - %s\n", c.Name, c.Description)
+	}
+	if admin {
+		b.WriteString("\nAdmin commands:\n")
+		for _, c := range adminCommands {
+			fmt.Fprintf(&b, "/%s - %s\n", c.Name, c.Description)
+		}
+	}
+	b.WriteString("\nQuick actions (instant, no AI involved):\n")
+	for _, c := range bangCommands {
+		fmt.Fprintf(&b, "%s - %s\n", c.usage, c.description)
+	}
+	b.WriteString("\nSay \"remember ...\" to save a note for later.\n")
+	var names []string
+	for _, d := range a.tools.Definitions() {
+		names = append(names, d.Name)
+	}
+	sort.Strings(names)
+	if len(names) > 0 {
+		fmt.Fprintf(&b, "\nTools I can use: %s", strings.Join(names, ", "))
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
@@ -0,0 +1,474 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/agent/tools"
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/cron"
+	"github.com/local/picobot/internal/providers"
+	"github.com/local/picobot/internal/telemetry"
+	"github.com/local/picobot/internal/watchdog"
+)
+
+// modelRecorder records the model of each call and replies with it.
+type modelRecorder struct {
+	models []string
+}
+
+func (p *modelRecorder) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string) (providers.LLMResponse, error) {
+	p.models = append(p.models, model)
+	return providers.LLMResponse{Content: "answered by " + model}, nil
+}
+
+func (p *modelRecorder) GetDefaultModel() string { return "main" }
+
+func TestSlashCommands(t *testing.T) {
+	b := chat.NewHub(10)
+	p := &modelRecorder{}
+	ag := NewAgentLoop(b, p, "main", 3, t.TempDir(), nil)
+	if len(b.Commands()) == 0 {
+		t.Fatal("agent should register its commands with the hub")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	go ag.Run(ctx)
+
+	send := func(content string) string {
+		b.In <- chat.Inbound{Channel: "telegram", SenderID: "u", ChatID: "1", Content: content}
+		select {
+		case out := <-b.Out:
+			return out.Content
+		case <-ctx.Done():
+			t.Fatalf("timeout waiting for reply to %q", content)
+			return ""
+		}
+	}
+
+	if got := send("/help"); !strings.Contains(got, "/reset") || !strings.Contains(got, "message") {
+		t.Fatalf("unexpected /help reply: %q", got)
+	}
+	if got := send("/model"); got != "Current model: main" {
+		t.Fatalf("unexpected /model reply: %q", got)
+	}
+	send("/model fast-model")
+	if got := send("hello"); got != "answered by fast-model" {
+		t.Fatalf("expected the chat's model to be used, got %q", got)
+	}
+	send("/model default")
+	if got := send("hello again"); got != "answered by main" {
+		t.Fatalf("expected the default model, got %q", got)
+	}
+	if len(p.models) != 2 {
+		t.Fatalf("commands must not reach the provider, got %d calls", len(p.models))
+	}
+
+	if h := ag.sessions.GetOrCreate("telegram:1").GetHistory(); len(h) == 0 {
+		t.Fatal("expected history before /reset")
+	}
+	send("/reset")
+	if h := ag.sessions.GetOrCreate("telegram:1").GetHistory(); len(h) != 0 {
+		t.Fatalf("expected empty history after /reset, got %v", h)
+	}
+}
+
+// brokenProvider always fails.
+type brokenProvider struct{}
+
+func (brokenProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string) (providers.LLMResponse, error) {
+	return providers.LLMResponse{}, errors.New("upstream returned 502")
+}
+
+func (brokenProvider) GetDefaultModel() string { return "main" }
+
+func TestFailedTurnShowsTraceID(t *testing.T) {
+	b := chat.NewHub(10)
+	ag := NewAgentLoop(b, brokenProvider{}, "main", 3, t.TempDir(), nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	go ag.Run(ctx)
+
+	send := func(chatID, content string) string {
+		b.In <- chat.Inbound{Channel: "telegram", SenderID: "u", ChatID: chatID, Content: content}
+		select {
+		case out := <-b.Out:
+			return out.Content
+		case <-ctx.Done():
+			t.Fatalf("timeout waiting for reply to %q", content)
+			return ""
+		}
+	}
+
+	m := regexp.MustCompile(`\(trace ([0-9a-f]{8})\)`).FindStringSubmatch(send("1", "hello"))
+	if m == nil {
+		t.Fatal("expected a trace ID in the apology")
+	}
+	if got := send("1", "/trace "+m[1]); !strings.Contains(got, "upstream returned 502") || !strings.Contains(got, "message: hello") {
+		t.Fatalf("unexpected /trace reply: %q", got)
+	}
+	if got := send("2", "/trace "+m[1]); strings.Contains(got, "502") {
+		t.Fatalf("another chat must not read the trace: %q", got)
+	}
+}
+
+func TestEventsAreRecordedWithoutReply(t *testing.T) {
+	b := chat.NewHub(10)
+	p := &modelRecorder{}
+	ag := NewAgentLoop(b, p, "main", 3, t.TempDir(), nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	go ag.Run(ctx)
+
+	b.In <- chat.Inbound{Channel: "telegram", ChatID: "1", Content: `[poll "Lunch?": @ana voted Sushi]`,
+		Metadata: map[string]interface{}{"event": "poll_answer"}}
+	b.In <- chat.Inbound{Channel: "telegram", ChatID: "1", Content: "who voted?"}
+	select {
+	case out := <-b.Out:
+		if out.Content != "answered by main" {
+			t.Fatalf("unexpected reply: %q", out.Content)
+		}
+	case <-ctx.Done():
+		t.Fatal("timeout waiting for reply")
+	}
+	h := ag.sessions.GetOrCreate("telegram:1").GetHistory()
+	if len(h) == 0 || h[0] != `event: [poll "Lunch?": @ana voted Sushi]` {
+		t.Fatalf("expected the event in history, got %v", h)
+	}
+	if len(p.models) != 1 {
+		t.Fatalf("events must not reach the provider, got %d calls", len(p.models))
+	}
+}
+
+func TestBangCommands(t *testing.T) {
+	b := chat.NewHub(10)
+	p := &modelRecorder{}
+	sched := cron.NewScheduler(func(cron.Job) {})
+	ag := NewAgentLoop(b, p, "main", 3, t.TempDir(), sched)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	go ag.Run(ctx)
+
+	send := func(content string) string {
+		b.In <- chat.Inbound{Channel: "telegram", SenderID: "u", ChatID: "1", Content: content}
+		select {
+		case out := <-b.Out:
+			return out.Content
+		case <-ctx.Done():
+			t.Fatalf("timeout waiting for reply to %q", content)
+			return ""
+		}
+	}
+
+	if got := send("!remind 9h buy bread"); got != "OK, I'll remind you in 9h: buy bread" {
+		t.Fatalf("unexpected !remind reply: %q", got)
+	}
+	if jobs := sched.List(); len(jobs) != 1 || jobs[0].Message != "buy bread" || jobs[0].ChatID != "1" {
+		t.Fatalf("unexpected jobs: %+v", jobs)
+	}
+	if got := send("!remind soon buy bread"); !strings.HasPrefix(got, "Invalid delay") {
+		t.Fatalf("expected an invalid delay error, got %q", got)
+	}
+
+	send("!todo add call mom")
+	send("!todo add pay rent")
+	send("!todo done 1")
+	if got := send("!todo"); got != "To-do:\n1. [x] call mom\n2. [ ] pay rent" {
+		t.Fatalf("unexpected !todo list: %q", got)
+	}
+	if got := send("!todo clear"); got != "Removed 1 finished item(s)." {
+		t.Fatalf("unexpected !todo clear reply: %q", got)
+	}
+	if got := send("!todo list"); got != "To-do:\n1. [ ] pay rent" {
+		t.Fatalf("unexpected !todo list: %q", got)
+	}
+	if got := send("!wat"); got != "answered by main" {
+		t.Fatalf("unknown ! commands should reach the LLM, got %q", got)
+	}
+	if len(p.models) != 1 {
+		t.Fatalf("expected a single LLM call, got %d", len(p.models))
+	}
+}
+
+func TestAdminCommands(t *testing.T) {
+	ws := t.TempDir()
+	ag := NewAgentLoop(chat.NewHub(10), &modelRecorder{}, "main", 3, ws, nil)
+	if err := telemetry.RecordPrompt(ws, telemetry.PromptRecord{Channel: "telegram", ChatID: "1", Stats: telemetry.PromptStats{System: 100, Current: 20}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := telemetry.RecordPrompt(ws, telemetry.PromptRecord{Channel: "telegram", ChatID: "2", Stats: telemetry.PromptStats{System: 100}, Followup: 200, Feature: "skill:weather"}); err != nil {
+		t.Fatal(err)
+	}
+	user := chat.Inbound{Channel: "telegram", SenderID: "u", ChatID: "1"}
+	admin := chat.Inbound{Channel: "telegram", SenderID: "a", ChatID: "1", Metadata: map[string]interface{}{"admin": true}}
+	run := func(msg chat.Inbound, content string) string {
+		msg.Content = content
+		reply, ok := ag.handleCommand(msg)
+		if !ok {
+			t.Fatalf("%q was not handled", content)
+		}
+		return reply
+	}
+
+	if got := run(user, "/usage"); got != "Only admins can use /usage." {
+		t.Fatalf("non-admin got %q", got)
+	}
+	if got := run(user, "/help"); strings.Contains(got, "/restart") {
+		t.Fatalf("admin commands shown to a non-admin: %q", got)
+	}
+	if got := run(admin, "/usage"); !strings.Contains(got, "Today: 2 turns, 420 tokens") || !strings.Contains(got, "telegram:1: 120 tokens") ||
+		!strings.Contains(got, "skill:weather: 300 tokens (1 turns, 71%)\nchat: 120 tokens") {
+		t.Fatalf("unexpected /usage reply: %q", got)
+	}
+
+	restarted := make(chan struct{}, 1)
+	watchdog.Default.Register("testchannel", time.Hour, func() { restarted <- struct{}{} })
+	if got := run(admin, "/restart"); !strings.Contains(got, "testchannel: ok") {
+		t.Fatalf("unexpected /restart listing: %q", got)
+	}
+	if got := run(admin, "/restart testchannel"); got != "Restarting testchannel." {
+		t.Fatalf("unexpected /restart reply: %q", got)
+	}
+	select {
+	case <-restarted:
+	default:
+		t.Fatal("channel was not restarted")
+	}
+}
+
+func TestBroadcastCommand(t *testing.T) {
+	hub := chat.NewHub(10)
+	ag := NewAgentLoop(hub, &modelRecorder{}, "main", 3, t.TempDir(), nil)
+	for _, key := range []string{"telegram:1", "telegram:2", "whatsapp:3@s.whatsapp.net", "heartbeat:default"} {
+		ag.sessions.Save(ag.sessions.GetOrCreate(key))
+	}
+	admin := chat.Inbound{Channel: "telegram", SenderID: "a", ChatID: "1", Content: "/broadcast  Maintenance tonight\nat 10pm", Metadata: map[string]interface{}{"admin": true}}
+	reply, ok := ag.handleCommand(admin)
+	if !ok || reply != "Broadcasting to 2 chats. I'll report the progress here." {
+		t.Fatalf("/broadcast = %q, %v", reply, ok)
+	}
+
+	got := map[string]string{}
+	for len(got) < 3 {
+		select {
+		case out := <-hub.Out:
+			got[out.Channel+":"+out.ChatID] = out.Content
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout, got %v", got)
+		}
+	}
+	for _, key := range []string{"telegram:2", "whatsapp:3@s.whatsapp.net"} {
+		if got[key] != "Maintenance tonight\nat 10pm" {
+			t.Errorf("%s got %q", key, got[key])
+		}
+	}
+	if got["telegram:1"] != "Broadcast finished: sent to 2 of 2 chats." {
+		t.Errorf("admin got %q", got["telegram:1"])
+	}
+}
+
+func TestPublishCommand(t *testing.T) {
+	hub := chat.NewHub(10)
+	scheduler := cron.NewScheduler(nil)
+	ag := NewAgentLoop(hub, &modelRecorder{}, "main", 3, t.TempDir(), scheduler)
+	ag.SetPublishChannels([]string{"@news"})
+	admin := chat.Inbound{Channel: "telegram", SenderID: "a", ChatID: "1", Content: "/publish", Metadata: map[string]interface{}{"admin": true}}
+
+	if reply, _ := ag.handleCommand(chat.Inbound{Channel: "telegram", SenderID: "u", ChatID: "1", Content: "/publish"}); reply != "Only admins can use /publish." {
+		t.Fatalf("non-admin /publish = %q", reply)
+	}
+	if reply, _ := ag.handleCommand(admin); !strings.Contains(reply, "no draft post") {
+		t.Fatalf("/publish without a draft = %q", reply)
+	}
+
+	ag.postDrafts.Put("telegram:1", tools.PostDraft{Channel: "@news", Text: "Release 2.0 is out!", Created: time.Now()})
+	if reply, _ := ag.handleCommand(admin); reply != "Posted to @news." {
+		t.Fatalf("/publish = %q", reply)
+	}
+	out := <-hub.Out
+	if out.Channel != "telegram" || out.ChatID != "@news" || out.Content != "Release 2.0 is out!" || out.Metadata["channel_post"] != true {
+		t.Fatalf("unexpected post: %+v", out)
+	}
+	if posts := ag.postDrafts.RecentPosts(); len(posts) != 1 || posts[0] != "[post in @news] Release 2.0 is out!" {
+		t.Fatalf("recent posts = %q", posts)
+	}
+
+	// A post drafted for later is scheduled.
+	at := time.Now().Add(time.Hour)
+	ag.postDrafts.Put("telegram:1", tools.PostDraft{Channel: "@news", Text: "Tomorrow's digest", At: at, Created: time.Now()})
+	if reply, _ := ag.handleCommand(admin); !strings.HasPrefix(reply, "Scheduled the post to @news") {
+		t.Fatalf("/publish = %q", reply)
+	}
+	jobs := scheduler.List()
+	if len(jobs) != 1 || !jobs[0].Post || jobs[0].ChatID != "@news" || jobs[0].Message != "Tomorrow's digest" {
+		t.Fatalf("unexpected jobs: %+v", jobs)
+	}
+
+	ag.postDrafts.Put("telegram:1", tools.PostDraft{Channel: "@news", Text: "draft", Created: time.Now()})
+	admin.Content = "/publish cancel"
+	if reply, _ := ag.handleCommand(admin); reply != "OK, dropped the draft post." {
+		t.Fatalf("/publish cancel = %q", reply)
+	}
+	if _, ok := ag.postDrafts.Take("telegram:1", time.Now()); ok {
+		t.Fatal("expected the draft to be dropped")
+	}
+}
+
+// promptRecorder records the system prompt of each call.
+type promptRecorder struct {
+	systems []string
+}
+
+func (p *promptRecorder) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string) (providers.LLMResponse, error) {
+	var system strings.Builder
+	for _, m := range messages {
+		if m.Role == "system" {
+			system.WriteString(m.Content + "\n")
+		}
+	}
+	p.systems = append(p.systems, system.String())
+	return providers.LLMResponse{Content: "ok"}, nil
+}
+
+func (p *promptRecorder) GetDefaultModel() string { return "main" }
+
+func TestChannelPostsReachAdminsDrafting(t *testing.T) {
+	p := &promptRecorder{}
+	ag := NewAgentLoop(chat.NewHub(10), p, "main", 3, t.TempDir(), nil)
+	ag.SetPublishChannels([]string{"@news"})
+
+	ag.processInbound(context.Background(), chat.Inbound{Channel: "telegram", ChatID: "-1001", Content: "[post in @news] Meetup on Friday",
+		Metadata: map[string]interface{}{"event": "channel_post"}})
+	ag.processInbound(context.Background(), chat.Inbound{Channel: "telegram", SenderID: "a", ChatID: "1", Content: "draft the next post",
+		Metadata: map[string]interface{}{"admin": true}})
+	ag.processInbound(context.Background(), chat.Inbound{Channel: "telegram", SenderID: "u", ChatID: "2", Content: "hi"})
+
+	if len(p.systems) != 2 {
+		t.Fatalf("got %d model calls, want 2", len(p.systems))
+	}
+	if !strings.Contains(p.systems[0], "[post in @news] Meetup on Friday") {
+		t.Errorf("the admin's prompt lacks the channel post:\n%s", p.systems[0])
+	}
+	if strings.Contains(p.systems[1], "Meetup on Friday") {
+		t.Errorf("a non-admin's prompt has the channel post:\n%s", p.systems[1])
+	}
+}
+
+func TestSearchCommand(t *testing.T) {
+	ag := NewAgentLoop(chat.NewHub(10), &modelRecorder{}, "main", 3, t.TempDir(), nil)
+	ag.archiveTurn("telegram:1", "olha esse link sobre pão de fermentação natural https://example.com/pao", "Thanks!")
+	ag.archiveTurn("telegram:1", "what's the weather?", "Sunny.")
+	ag.archiveTurn("telegram:2", "another chat's pao link", "ok")
+	msg := chat.Inbound{Channel: "telegram", SenderID: "u", ChatID: "1"}
+	run := func(content string) string {
+		msg.Content = content
+		reply, ok := ag.handleCommand(msg)
+		if !ok {
+			t.Fatalf("%q was not handled", content)
+		}
+		return reply
+	}
+
+	got := run("/search PAO link")
+	if !strings.Contains(got, "you: olha esse link") || !strings.Contains(got, time.Now().Format("2006-01-02")) {
+		t.Fatalf("unexpected /search reply: %q", got)
+	}
+	if strings.Contains(got, "another chat") {
+		t.Fatalf("/search leaked another chat's messages: %q", got)
+	}
+	if got := run("/search pao weather"); got != `No messages matching "pao weather".` {
+		t.Fatalf("all terms should have to match, got %q", got)
+	}
+	if got := run("/search"); got != "Usage: /search <terms>" {
+		t.Fatalf("unexpected reply without terms: %q", got)
+	}
+}
+
+func TestPrivateMode(t *testing.T) {
+	b := chat.NewHub(10)
+	ws := t.TempDir()
+	ag := NewAgentLoop(b, &modelRecorder{}, "main", 3, ws, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	go ag.Run(ctx)
+
+	send := func(content string) string {
+		b.In <- chat.Inbound{Channel: "telegram", SenderID: "u", ChatID: "1", Content: content}
+		select {
+		case out := <-b.Out:
+			// Private replies are flagged, so channels keep them off disk.
+			if out.Private != strings.HasPrefix(out.Content, privateMark) {
+				t.Fatalf("reply %q has Private = %v", out.Content, out.Private)
+			}
+			return out.Content
+		case <-ctx.Done():
+			t.Fatalf("timeout waiting for reply to %q", content)
+			return ""
+		}
+	}
+
+	send("before")
+	if got := send("/private on"); !strings.HasPrefix(got, privateMark+"Private mode is on") {
+		t.Fatalf("unexpected /private on reply: %q", got)
+	}
+	if got := send("secret diagnosis"); got != privateMark+"answered by main" {
+		t.Fatalf("private replies should be marked, got %q", got)
+	}
+	if got := send("remember my PIN is 1234"); !strings.Contains(got, "won't save") {
+		t.Fatalf("unexpected reply to remember: %q", got)
+	}
+	if h := ag.privateSession("telegram:1").GetHistory(); len(h) != 6 || !strings.Contains(h[0], "before") {
+		t.Fatalf("private session should continue the saved history in RAM, got %v", h)
+	}
+	if today, _ := ag.memory.ReadToday(); strings.Contains(today, "1234") {
+		t.Fatalf("private note saved to memory: %q", today)
+	}
+	if got := ag.searchText("telegram:1", []string{"diagnosis"}); !strings.HasPrefix(got, "No messages") {
+		t.Fatalf("private turn archived: %q", got)
+	}
+
+	if got := send("/private off"); !strings.HasPrefix(got, "Private mode is off") {
+		t.Fatalf("unexpected /private off reply: %q", got)
+	}
+	send("after")
+	h := strings.Join(ag.sessions.GetOrCreate("telegram:1").GetHistory(), "\n")
+	if strings.Contains(h, "secret") || !strings.Contains(h, "before") || !strings.Contains(h, "after") {
+		t.Fatalf("unexpected saved history: %q", h)
+	}
+}
+
+func TestTodoKeepsOtherLines(t *testing.T) {
+	ws := t.TempDir()
+	path := filepath.Join(ws, todoFile)
+	orig := "# Groceries\n\nFrom the market:\n- [ ] apples\n  - [X] green ones\n\nNotes: pay cash.\n"
+	if err := os.WriteFile(path, []byte(orig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ag := NewAgentLoop(chat.NewHub(10), providers.NewStubProvider(), "stub", 5, ws, nil)
+
+	ag.bangTodo([]string{"add", "pears"})
+	ag.bangTodo([]string{"done", "1"})
+	ag.bangTodo([]string{"clear"})
+	data, _ := os.ReadFile(path)
+	want := "# Groceries\n\nFrom the market:\n- [ ] pears\n\nNotes: pay cash.\n"
+	if string(data) != want {
+		t.Fatalf("todo.md = %q, want %q", data, want)
+	}
+
+	os.Remove(path)
+	ag.bangTodo([]string{"add", "call mom"})
+	if data, _ := os.ReadFile(path); string(data) != "# To-do\n\n- [ ] call mom\n" {
+		t.Fatalf("new todo.md = %q", data)
+	}
+}
@@ -0,0 +1,230 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/providers"
+	"github.com/local/picobot/internal/telemetry"
+)
+
+const (
+	// costDefaultTokens is the confirmation threshold when neither prices
+	// nor a token threshold are configured.
+	costDefaultTokens = 100000
+	// costOutputPerStep is the output assumed for each model call.
+	costOutputPerStep = 500
+	// costResearchSteps is the number of model calls assumed for a research
+	// task (capped by the iteration limit).
+	costResearchSteps = 8
+	// costHoldFor is how long a request waits for /confirm.
+	costHoldFor = 15 * time.Minute
+	// costConfirmButton is the ID of the button that confirms on channels
+	// with buttons.
+	costConfirmButton = "cost_confirm"
+)
+
+// costResearchRE spots requests likely to take many tool calls.
+var costResearchRE = regexp.MustCompile(`(?i)\b(research|investigate|deep[ -]dive|in-depth|thorough(ly)?|comprehensive|pesquis[ae]|investigue|aprofundad[ao]|detalhad[ao])\b`)
+
+// turnEstimate is what a turn is expected to use before it runs.
+type turnEstimate struct {
+	Prompt      int // tokens of the prompt sent with each model call
+	Attachments int // tokens of the attached files, once read
+	Steps       int // model calls expected
+}
+
+// Input is the prompt tokens of all the turn's model calls: the whole
+// prompt, attachments included, is sent again with each one.
+func (e turnEstimate) Input() int {
+	return (e.Prompt + e.Attachments) * e.Steps
+}
+
+// Output is the completion tokens of all the turn's model calls.
+func (e turnEstimate) Output() int {
+	return costOutputPerStep * e.Steps
+}
+
+// Cost is the turn's price in USD at the configured prices.
+func (e turnEstimate) Cost(cfg *config.CostPreviewConfig) float64 {
+	return (float64(e.Input())*cfg.InputPerMTok + float64(e.Output())*cfg.OutputPerMTok) / 1e6
+}
+
+// heldTurn is a costly request awaiting the user's confirmation.
+type heldTurn struct {
+	msg   chat.Inbound
+	until time.Time
+}
+
+// SetCostPreview makes the agent ask before running a turn predicted to be
+// expensive: a large attachment, or a task taking many tool calls.
+func (a *AgentLoop) SetCostPreview(cfg config.CostPreviewConfig) {
+	if !cfg.Enabled {
+		a.costPreview = nil
+		return
+	}
+	a.costPreview = &cfg
+}
+
+// estimateTurn predicts what msg's turn will use from the size of its
+// prompt (stats plus the tool definitions), its attachments and whether it
+// reads like a research task.
+func (a *AgentLoop) estimateTurn(msg chat.Inbound, stats telemetry.PromptStats, toolDefs []providers.ToolDefinition) turnEstimate {
+	est := turnEstimate{Prompt: stats.Total(), Steps: 1}
+	if b, err := json.Marshal(toolDefs); err == nil {
+		est.Prompt += telemetry.EstimateTokens(string(b))
+	}
+	for _, path := range msg.Media {
+		est.Attachments += attachmentTokens(path)
+	}
+	if len(msg.Media) > 0 {
+		est.Steps = 2 // one call to read them, one to answer
+	}
+	if costResearchRE.MatchString(msg.Content) {
+		est.Steps = min(costResearchSteps, max(a.maxIterations, 1))
+	}
+	return est
+}
+
+// attachmentTokens estimates the prompt tokens of the file at path once
+// read: about 4 bytes a token for text, and nothing for images and other
+// binary files, which are not read into the prompt as they are.
+func attachmentTokens(path string) int {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return 0
+	}
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	switch kind, _, _ := strings.Cut(http.DetectContentType(head[:n]), ";"); {
+	case strings.HasPrefix(kind, "text/"), kind == "application/json", kind == "application/xml":
+		return int(fi.Size() / 4)
+	}
+	return 0
+}
+
+// senderKey keys what is kept per person (a request held back, the last
+// action log) by msg's sender in its chat, so that in a group one member
+// neither drops nor sees another's.
+func senderKey(msg chat.Inbound) string {
+	return msg.Channel + ":" + msg.ChatID + ":" + msg.SenderID
+}
+
+// previewCost holds msg back and returns the question to ask when its turn
+// is predicted to cost more than the configured threshold. Requests the
+// user already confirmed, and system triggers, always run.
+func (a *AgentLoop) previewCost(msg chat.Inbound, stats telemetry.PromptStats, toolDefs []providers.ToolDefinition) (string, bool) {
+	cfg := a.costPreview
+	if cfg == nil || isSystemChannel(msg.Channel) {
+		return "", false
+	}
+	if confirmed, _ := msg.Metadata["cost_confirmed"].(bool); confirmed {
+		return "", false
+	}
+	est := a.estimateTurn(msg, stats, toolDefs)
+	tokens := est.Input() + est.Output()
+	priced := cfg.InputPerMTok > 0 || cfg.OutputPerMTok > 0
+	cost := est.Cost(cfg)
+	switch {
+	case priced && cfg.ConfirmAboveUSD > 0:
+		if cost <= cfg.ConfirmAboveUSD {
+			return "", false
+		}
+	case cfg.ConfirmAboveTokens > 0:
+		if tokens <= cfg.ConfirmAboveTokens {
+			return "", false
+		}
+	default:
+		if tokens <= costDefaultTokens {
+			return "", false
+		}
+	}
+
+	a.costMu.Lock()
+	if a.heldTurns == nil {
+		a.heldTurns = make(map[string]heldTurn)
+	}
+	a.heldTurns[senderKey(msg)] = heldTurn{msg: msg, until: time.Now().Add(costHoldFor)}
+	a.costMu.Unlock()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "This request looks expensive: about %s tokens", formatTokens(tokens))
+	if priced {
+		fmt.Fprintf(&b, " (~$%.2f)", cost)
+	}
+	var why []string
+	if est.Attachments > 0 {
+		why = append(why, formatTokens(est.Attachments)+" of them for the attachments")
+	}
+	if est.Steps > 2 {
+		why = append(why, fmt.Sprintf("as a research task of up to %d steps", est.Steps))
+	}
+	if len(why) > 0 {
+		b.WriteString(", " + strings.Join(why, ", "))
+	}
+	b.WriteString(".\nReply /confirm to run it anyway, or send something else to drop it.")
+	return b.String(), true
+}
+
+// heldTurnFor settles the request msg's sender has held back in its chat,
+// if any: msg confirming it (/confirm, or the button offered with the
+// question) returns it to be run now; any other message drops it.
+func (a *AgentLoop) heldTurnFor(msg chat.Inbound) (chat.Inbound, bool) {
+	key := senderKey(msg)
+	a.costMu.Lock()
+	held, ok := a.heldTurns[key]
+	delete(a.heldTurns, key)
+	a.costMu.Unlock()
+	if !ok || time.Now().After(held.until) {
+		return msg, false
+	}
+	fields := strings.Fields(msg.Content)
+	confirm := msg.ButtonID() == costConfirmButton
+	if len(fields) == 1 {
+		name, _, _ := strings.Cut(fields[0], "@")
+		confirm = confirm || strings.EqualFold(name, "/confirm")
+	}
+	if !confirm {
+		return msg, false
+	}
+	meta := maps.Clone(held.msg.Metadata)
+	if meta == nil {
+		meta = make(map[string]interface{})
+	}
+	meta["cost_confirmed"] = true
+	held.msg.Metadata = meta
+	return held.msg, true
+}
+
+// costButtons offers the confirmation as a button, on channels that show
+// buttons.
+func costButtons() map[string]interface{} {
+	return map[string]interface{}{"buttons": []chat.Button{{ID: costConfirmButton, Text: "Run it"}}}
+}
+
+// formatTokens renders a token count briefly: 950, 12k, 1.2M.
+func formatTokens(n int) string {
+	switch {
+	case n >= 1e6:
+		return fmt.Sprintf("%.1fM", float64(n)/1e6)
+	case n >= 1e4:
+		return fmt.Sprintf("%dk", n/1000)
+	case n >= 1e3:
+		return fmt.Sprintf("%.1fk", float64(n)/1e3)
+	}
+	return fmt.Sprint(n)
+}
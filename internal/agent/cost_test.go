@@ -0,0 +1,106 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/providers"
+	"github.com/local/picobot/internal/telemetry"
+)
+
+func TestCostPreview(t *testing.T) {
+	hub := chat.NewHub(10)
+	ws := t.TempDir()
+	ag := NewAgentLoop(hub, providers.NewStubProvider(), "stub", 5, ws, nil)
+	ag.SetCostPreview(config.CostPreviewConfig{Enabled: true, InputPerMTok: 3, OutputPerMTok: 15, ConfirmAboveUSD: 0.5})
+
+	big := filepath.Join(ws, "dump.log")
+	if err := os.WriteFile(big, []byte(strings.Repeat("x", 800000)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	next := func() chat.Outbound {
+		t.Helper()
+		select {
+		case out := <-hub.Out:
+			return out
+		case <-time.After(2 * time.Second):
+			t.Fatal("no reply")
+		}
+		return chat.Outbound{}
+	}
+
+	// A cheap request runs straight away.
+	ag.processInbound(context.Background(), chat.Inbound{Channel: "telegram", ChatID: "1", Content: "hi"})
+	if out := next(); strings.Contains(out.Content, "/confirm") {
+		t.Fatalf("cheap request held back: %q", out.Content)
+	}
+
+	// A 200k-token attachment read twice is held back...
+	costly := chat.Inbound{Channel: "telegram", ChatID: "1", Content: "summarize this", Media: []string{big}}
+	ag.processInbound(context.Background(), costly)
+	out := next()
+	if !strings.Contains(out.Content, "looks expensive") || !strings.Contains(out.Content, "200k of them for the attachments") {
+		t.Fatalf("preview = %q", out.Content)
+	}
+	// ...until confirmed.
+	ag.processInbound(context.Background(), chat.Inbound{Channel: "telegram", ChatID: "1", Content: "/confirm"})
+	if out := next(); strings.Contains(out.Content, "looks expensive") || strings.Contains(out.Content, "no request waiting") {
+		t.Fatalf("confirmed request not run: %q", out.Content)
+	}
+	ag.processInbound(context.Background(), chat.Inbound{Channel: "telegram", ChatID: "1", Content: "/confirm"})
+	if out := next(); !strings.Contains(out.Content, "no request waiting") {
+		t.Fatalf("second /confirm = %q", out.Content)
+	}
+
+	// Another message drops the held request.
+	ag.processInbound(context.Background(), costly)
+	next()
+	if _, ok := ag.heldTurnFor(chat.Inbound{Channel: "telegram", ChatID: "1", Content: "never mind"}); ok {
+		t.Fatal("held request confirmed by an unrelated message")
+	}
+	if _, ok := ag.heldTurnFor(chat.Inbound{Channel: "telegram", ChatID: "1", Content: "/confirm"}); ok {
+		t.Fatal("dropped request still held")
+	}
+
+	// In a group, another member's message leaves the request held.
+	costly.ChatID, costly.SenderID = "-100", "ana"
+	ag.processInbound(context.Background(), costly)
+	next()
+	if _, ok := ag.heldTurnFor(chat.Inbound{Channel: "telegram", ChatID: "-100", SenderID: "bob", Content: "lol"}); ok {
+		t.Fatal("another member's message confirmed the request")
+	}
+	if held, ok := ag.heldTurnFor(chat.Inbound{Channel: "telegram", ChatID: "-100", SenderID: "ana", Content: "/confirm"}); !ok || held.Content != "summarize this" {
+		t.Fatal("the request was not held for its sender")
+	}
+}
+
+func TestEstimateTurnCountsTextAttachments(t *testing.T) {
+	ws := t.TempDir()
+	text := filepath.Join(ws, "notes.txt")
+	photo := filepath.Join(ws, "photo.png")
+	os.WriteFile(text, []byte(strings.Repeat("word ", 800)), 0o644)
+	os.WriteFile(photo, append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 400000)...), 0o644)
+	ag := NewAgentLoop(chat.NewHub(10), providers.NewStubProvider(), "stub", 5, ws, nil)
+
+	est := ag.estimateTurn(chat.Inbound{Content: "look", Media: []string{text, photo}}, telemetry.PromptStats{}, nil)
+	if est.Attachments != 1000 || est.Steps != 2 {
+		t.Errorf("estimate = %+v, want 1000 attachment tokens over 2 steps", est)
+	}
+}
+
+func TestEstimateTurnResearch(t *testing.T) {
+	ag := NewAgentLoop(chat.NewHub(10), providers.NewStubProvider(), "stub", 20, t.TempDir(), nil)
+	est := ag.estimateTurn(chat.Inbound{Content: "Do a thorough research on heat pumps"}, telemetry.PromptStats{System: 1000}, nil)
+	if est.Steps != costResearchSteps || est.Prompt < 1000 || est.Input() != est.Prompt*costResearchSteps {
+		t.Errorf("estimate = %+v, input %d", est, est.Input())
+	}
+	if got := formatTokens(1234567); got != "1.2M" {
+		t.Errorf("formatTokens = %q", got)
+	}
+}
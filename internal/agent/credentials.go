@@ -0,0 +1,44 @@
+package agent
+
+import (
+	"log"
+	"slices"
+
+	"github.com/local/picobot/internal/agent/tools"
+	"github.com/local/picobot/internal/config"
+)
+
+// SetCredentials sets the credentials the exec and web tools may use, each in
+// the chats and for the users it lists only.
+func (a *AgentLoop) SetCredentials(cs []config.CredentialConfig) {
+	for _, c := range cs {
+		if len(c.Chats) == 0 && len(c.Users) == 0 {
+			log.Printf("credential %q lists no chats or users: it will not be used", c.Name)
+		}
+		if c.Env == "" && (c.Host == "" || c.Header == "") {
+			log.Printf("credential %q sets neither env nor host and header: it will not be used", c.Name)
+		}
+	}
+	a.credentials = cs
+}
+
+// scopeCredentials hands the exec and web tools the credentials of a message
+// from senderID in channel:chatID; the others are withheld.
+func (a *AgentLoop) scopeCredentials(channel, chatID, senderID string) {
+	if len(a.credentials) == 0 {
+		return
+	}
+	creds := make([]tools.Credential, 0, len(a.credentials))
+	for _, c := range a.credentials {
+		tc := tools.Credential{Name: c.Name, Env: c.Env, Host: c.Host, Header: c.Header}
+		if slices.Contains(c.Chats, channel+":"+chatID) || (senderID != "" && slices.Contains(c.Users, channel+":"+senderID)) {
+			tc.Value = c.Value
+		}
+		creds = append(creds, tc)
+	}
+	for _, name := range []string{"exec", "web"} {
+		if t, ok := a.tools.Get(name).(interface{ SetCredentials([]tools.Credential) }); ok {
+			t.SetCredentials(creds)
+		}
+	}
+}
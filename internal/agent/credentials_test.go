@@ -0,0 +1,37 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/local/picobot/internal/agent/tools"
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/providers"
+)
+
+// credentialRecorder stands in for the exec tool to see what it is handed.
+type credentialRecorder struct {
+	tools.ExecTool
+	got []tools.Credential
+}
+
+func (r *credentialRecorder) SetCredentials(c []tools.Credential) { r.got = c }
+
+func TestScopeCredentials(t *testing.T) {
+	a := NewAgentLoop(chat.NewHub(10), providers.NewStubProvider(), "stub-model", 3, t.TempDir(), nil)
+	rec := &credentialRecorder{}
+	a.tools.Register(rec)
+	a.SetCredentials([]config.CredentialConfig{
+		{Name: "vpn", Env: "VPN_KEY", Value: "work", Users: []string{"telegram:42"}},
+		{Name: "ha", Env: "HA_TOKEN", Value: "home", Chats: []string{"telegram:-100"}},
+	})
+
+	a.scopeCredentials("telegram", "-100", "7")
+	if rec.got[0].Value != "" || rec.got[1].Value != "home" {
+		t.Fatalf("family group got %+v", rec.got)
+	}
+	a.scopeCredentials("telegram", "42", "42")
+	if rec.got[0].Value != "work" || rec.got[1].Value != "" {
+		t.Fatalf("owner got %+v", rec.got)
+	}
+}
@@ -0,0 +1,49 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+// datesHour is the local hour from which the day's birthday and anniversary
+// notifications are sent, so nobody is woken up at midnight.
+const datesHour = 9
+
+// notifyDates checks the remembered dates every rotationCheck and, from
+// datesHour on, asks the agent to greet or remind the chat of each one due.
+// The message is written by the agent like a fired reminder, so it can use
+// what USER.md and memory say about the person.
+func (a *AgentLoop) notifyDates(ctx context.Context) {
+	ticker := time.NewTicker(rotationCheck)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if now.Hour() < datesHour {
+				continue
+			}
+			due, err := a.dates.Due(now)
+			if err != nil {
+				log.Printf("error checking dates: %v", err)
+				continue
+			}
+			for _, d := range due {
+				content := fmt.Sprintf("[Date reminder] %s. Please remind the user in a friendly way.", d.Describe(now))
+				if d.Greet {
+					content = fmt.Sprintf("[Date reminder] %s. Please send %s a warm greeting in this chat.", d.Describe(now), d.Name)
+				}
+				select {
+				case a.hub.In <- chat.Inbound{Channel: d.Channel, SenderID: "cron", ChatID: d.ChatID, Content: content}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package agent
+
+import (
+	"context"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/local/picobot/internal/providers"
+	"github.com/local/picobot/internal/telemetry"
+)
+
+// draftMaxQuestionLen is the longest user message (in runes) that is still
+// considered a "simple turn" worth drafting with the small model. Longer
+// requests go straight to the main model.
+const draftMaxQuestionLen = 500
+
+// draftHedges are phrases that indicate the draft model is unsure of its answer.
+// Matching is case-insensitive.
+var draftHedges = []string{
+	"i'm not sure", "i am not sure", "i don't know", "i do not know",
+	"i'm not certain", "i cannot", "i can't", "as an ai", "unable to",
+	"não sei", "não tenho certeza", "não consigo", "não posso",
+}
+
+// draftReviewPrompt asks the main model to check the draft it has been handed.
+const draftReviewPrompt = "The assistant message above is a draft written by a smaller, faster model. Verify it for correctness and completeness, use tools if needed, and reply with the final answer only. If the draft is already good, repeat it unchanged."
+
+// SetDraftModel enables the draft/verify pipeline: simple turns are answered by
+// the given (small, fast) model first and only escalated to the main model when
+// the draft fails the confidence heuristics. An empty model disables drafting.
+func (a *AgentLoop) SetDraftModel(model string) {
+	a.draftModel = model
+}
+
+// draftReply asks the draft model for a first answer. It returns the reply and
+// true when the draft passes the confidence heuristics. Otherwise it returns
+// the messages the main model should continue from: either unchanged, or
+// extended with the rejected draft and a review instruction. The draft call's
+// prompt is recorded as rec, under the draft feature.
+func (a *AgentLoop) draftReply(ctx context.Context, rec telemetry.PromptRecord, question string, messages []providers.Message, toolDefs []providers.ToolDefinition) (string, []providers.Message, bool) {
+	if a.draftModel == "" || a.draftModel == a.model {
+		return "", messages, false
+	}
+	if utf8.RuneCountInString(question) > draftMaxQuestionLen {
+		return "", messages, false
+	}
+	rec.Feature = telemetry.FeatureDraft
+	a.recordPromptStats(rec, toolDefs)
+	resp, err := a.provider.Chat(ctx, messages, toolDefs, a.draftModel)
+	if err != nil {
+		log.Printf("draft: provider error, escalating to %s: %v", a.model, err)
+		return "", messages, false
+	}
+	if resp.HasToolCalls {
+		// Tool use means the turn is not a simple one; let the main model drive it.
+		log.Printf("draft: %s requested tools, escalating to %s", a.draftModel, a.model)
+		return "", messages, false
+	}
+	if draftConfident(resp.Content) {
+		log.Printf("draft: accepted reply from %s", a.draftModel)
+		return resp.Content, messages, true
+	}
+	log.Printf("draft: low-confidence reply from %s, asking %s to verify", a.draftModel, a.model)
+	out := make([]providers.Message, len(messages), len(messages)+2)
+	copy(out, messages)
+	out = append(out,
+		providers.Message{Role: "assistant", Content: resp.Content},
+		providers.Message{Role: "system", Content: draftReviewPrompt},
+	)
+	return "", out, false
+}
+
+// draftConfident reports whether a draft reply looks good enough to send
+// without verification by the main model.
+func draftConfident(draft string) bool {
+	draft = strings.TrimSpace(draft)
+	if utf8.RuneCountInString(draft) < 2 {
+		return false
+	}
+	lower := strings.ToLower(draft)
+	for _, h := range draftHedges {
+		if strings.Contains(lower, h) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/providers"
+)
+
+// draftProvider answers with a fixed reply per model and records which models were called.
+type draftProvider struct {
+	replies map[string]string
+	models  []string
+}
+
+func (p *draftProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string) (providers.LLMResponse, error) {
+	p.models = append(p.models, model)
+	return providers.LLMResponse{Content: p.replies[model]}, nil
+}
+func (p *draftProvider) GetDefaultModel() string { return "big" }
+
+func TestDraftAcceptedSkipsMainModel(t *testing.T) {
+	p := &draftProvider{replies: map[string]string{"small": "Paris is the capital of France.", "big": "unused"}}
+	ws := t.TempDir()
+	ag := NewAgentLoop(chat.NewHub(10), p, "big", 5, ws, nil)
+	ag.SetDraftModel("small")
+
+	resp, err := ag.ProcessDirect("capital of France?", time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp != "Paris is the capital of France." {
+		t.Fatalf("expected draft reply, got %q", resp)
+	}
+	if len(p.models) != 1 || p.models[0] != "small" {
+		t.Fatalf("expected only the draft model to be called, got %v", p.models)
+	}
+	if got := promptFeatures(t, ws); !slices.Equal(got, []string{"draft"}) {
+		t.Fatalf("recorded features %v, want [draft]", got)
+	}
+}
+
+func TestDraftLowConfidenceEscalates(t *testing.T) {
+	p := &draftProvider{replies: map[string]string{"small": "I'm not sure, maybe Lyon?", "big": "Paris."}}
+	ws := t.TempDir()
+	ag := NewAgentLoop(chat.NewHub(10), p, "big", 5, ws, nil)
+	ag.SetDraftModel("small")
+
+	resp, err := ag.ProcessDirect("capital of France?", time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp != "Paris." {
+		t.Fatalf("expected verified reply, got %q", resp)
+	}
+	if len(p.models) != 2 || p.models[1] != "big" {
+		t.Fatalf("expected draft then main model, got %v", p.models)
+	}
+	if got := promptFeatures(t, ws); !slices.Equal(got, []string{"draft", "chat"}) {
+		t.Fatalf("recorded features %v, want [draft chat]", got)
+	}
+}
+
+func TestDraftConfident(t *testing.T) {
+	tests := []struct {
+		draft string
+		want  bool
+	}{
+		{"Sure, here it is.", true},
+		{"", false},
+		{"  ", false},
+		{"Não sei responder isso.", false},
+		{"As an AI, I cannot browse.", false},
+	}
+	for _, tt := range tests {
+		if got := draftConfident(tt.draft); got != tt.want {
+			t.Errorf("draftConfident(%q) = %v, want %v", tt.draft, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package agent
+
+import (
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/webhooks"
+)
+
+// SetEventWebhooks sets the webhooks told about turns, tool runs and
+// failures (see package webhooks).
+func (a *AgentLoop) SetEventWebhooks(hooks []config.EventWebhook) {
+	a.events = webhooks.New(hooks)
+}
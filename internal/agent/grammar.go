@@ -0,0 +1,236 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+// bangCommands is the compact command grammar answered without the LLM, for
+// routine actions that should be instant and free. Listed by /help.
+var bangCommands = []struct{ usage, description string }{
+	{"!remind <delay> <text>", "Remind me after a delay, e.g. !remind 9h buy bread"},
+	{"!todo add <text>", "Add an item to the to-do list"},
+	{"!todo [list]", "Show the to-do list"},
+	{"!todo done <n>", "Check off item n"},
+	{"!todo clear", "Remove checked-off items"},
+}
+
+// todoFile is the workspace file holding the to-do list, a Markdown checklist
+// the agent can also read and edit with its filesystem tool.
+const todoFile = "todo.md"
+
+// handleBang answers the "!" command grammar. Like handleCommand it returns
+// false for anything it does not know, which then goes to the LLM.
+func (a *AgentLoop) handleBang(msg chat.Inbound) (string, bool) {
+	fields := strings.Fields(strings.TrimPrefix(msg.Content, "!"))
+	if len(fields) == 0 {
+		return "", false
+	}
+	switch strings.ToLower(fields[0]) {
+	case "remind":
+		return a.bangRemind(msg, fields[1:]), true
+	case "todo":
+		return a.bangTodo(fields[1:]), true
+	}
+	return "", false
+}
+
+func (a *AgentLoop) bangRemind(msg chat.Inbound, args []string) string {
+	const usage = "Usage: !remind <delay> <text>, e.g. !remind 9h buy bread"
+	if len(args) < 2 {
+		return usage
+	}
+	if _, err := time.ParseDuration(args[0]); err != nil {
+		return fmt.Sprintf("Invalid delay %q. %s", args[0], usage)
+	}
+	ct := a.tools.Get("cron")
+	if ct == nil {
+		return "Reminders are not available here."
+	}
+	if ctool, ok := ct.(interface{ SetContext(string, string) }); ok {
+		ctool.SetContext(msg.Channel, msg.ChatID)
+	}
+	text := strings.Join(args[1:], " ")
+	if _, err := ct.Execute(context.Background(), map[string]interface{}{
+		"action":  "add",
+		"name":    "reminder",
+		"message": text,
+		"delay":   args[0],
+	}); err != nil {
+		return "Couldn't schedule the reminder: " + err.Error()
+	}
+	return fmt.Sprintf("OK, I'll remind you in %s: %s", args[0], text)
+}
+
+// todoItem is one line of the to-do checklist.
+type todoItem struct {
+	done   bool
+	text   string
+	indent string // leading whitespace of its line, for nested items
+	line   int    // index of its line in todoList.lines; -1 for a new item
+}
+
+// todoList is todo.md line by line, with its checklist items. Lines that
+// are not items (headings, notes) are written back unchanged.
+type todoList struct {
+	lines []string
+	items []todoItem
+}
+
+func (a *AgentLoop) bangTodo(args []string) string {
+	list, err := a.loadTodo()
+	items := list.items
+	if err != nil {
+		return "Couldn't read the to-do list: " + err.Error()
+	}
+	sub := "list"
+	if len(args) > 0 {
+		sub = strings.ToLower(args[0])
+	}
+	switch sub {
+	case "list":
+		return formatTodo(items)
+	case "add":
+		text := strings.Join(args[1:], " ")
+		if text == "" {
+			return "Usage: !todo add <text>"
+		}
+		items = append(items, todoItem{text: text, line: -1})
+		if err := a.saveTodo(list.lines, items); err != nil {
+			return "Couldn't save the to-do list: " + err.Error()
+		}
+		return fmt.Sprintf("Added #%d: %s", len(items), text)
+	case "done":
+		n := 0
+		if len(args) > 1 {
+			n, _ = strconv.Atoi(args[1])
+		}
+		if n < 1 || n > len(items) {
+			return fmt.Sprintf("Usage: !todo done <n>, with n between 1 and %d", len(items))
+		}
+		items[n-1].done = true
+		if err := a.saveTodo(list.lines, items); err != nil {
+			return "Couldn't save the to-do list: " + err.Error()
+		}
+		return fmt.Sprintf("Done: %s", items[n-1].text)
+	case "clear":
+		var kept []todoItem
+		for _, it := range items {
+			if !it.done {
+				kept = append(kept, it)
+			}
+		}
+		removed := len(items) - len(kept)
+		if err := a.saveTodo(list.lines, kept); err != nil {
+			return "Couldn't save the to-do list: " + err.Error()
+		}
+		return fmt.Sprintf("Removed %d finished item(s).", removed)
+	}
+	return "Usage: !todo [list] | !todo add <text> | !todo done <n> | !todo clear"
+}
+
+func formatTodo(items []todoItem) string {
+	if len(items) == 0 {
+		return "The to-do list is empty."
+	}
+	var b strings.Builder
+	b.WriteString("To-do:\n")
+	for i, it := range items {
+		mark := "[ ]"
+		if it.done {
+			mark = "[x]"
+		}
+		fmt.Fprintf(&b, "%d. %s %s\n", i+1, mark, it.text)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// parseTodoLine returns the checklist item on line, if it holds one.
+func parseTodoLine(line string) (todoItem, bool) {
+	trimmed := strings.TrimLeft(line, " \t")
+	it := todoItem{indent: line[:len(line)-len(trimmed)]}
+	trimmed = strings.TrimRight(trimmed, " \t\r")
+	switch {
+	case strings.HasPrefix(trimmed, "- [ ] "):
+		it.text = trimmed[6:]
+	case strings.HasPrefix(trimmed, "- [x] "), strings.HasPrefix(trimmed, "- [X] "):
+		it.done, it.text = true, trimmed[6:]
+	default:
+		return todoItem{}, false
+	}
+	return it, true
+}
+
+// String renders the item as a line of todo.md.
+func (it todoItem) String() string {
+	mark := " "
+	if it.done {
+		mark = "x"
+	}
+	return fmt.Sprintf("%s- [%s] %s", it.indent, mark, it.text)
+}
+
+// loadTodo reads todo.md and its checklist items.
+func (a *AgentLoop) loadTodo() (todoList, error) {
+	data, err := os.ReadFile(filepath.Join(a.workspace, todoFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return todoList{}, nil
+		}
+		return todoList{}, err
+	}
+	list := todoList{lines: strings.Split(string(data), "\n")}
+	for i, line := range list.lines {
+		if it, ok := parseTodoLine(line); ok {
+			it.line = i
+			list.items = append(list.items, it)
+		}
+	}
+	return list, nil
+}
+
+// saveTodo writes items back into lines, the file as loaded: items keep
+// their line, removed ones lose it, new ones go after the last item, and
+// every other line is kept as it was.
+func (a *AgentLoop) saveTodo(lines []string, items []todoItem) error {
+	if len(lines) == 0 {
+		lines = []string{"# To-do", "", ""}
+	}
+	byLine := make(map[int]todoItem)
+	var added []string
+	for _, it := range items {
+		if it.line < 0 {
+			added = append(added, it.String())
+		} else {
+			byLine[it.line] = it
+		}
+	}
+	var out []string
+	at := -1 // where new items go: after the last item
+	for i, line := range lines {
+		if _, ok := parseTodoLine(line); ok {
+			if it, kept := byLine[i]; kept {
+				out = append(out, it.String())
+			}
+			at = len(out)
+			continue
+		}
+		out = append(out, line)
+	}
+	if at < 0 {
+		// No items yet: append, before the final newline.
+		at = len(out)
+		if out[at-1] == "" {
+			at--
+		}
+	}
+	out = append(out[:at], append(added, out[at:]...)...)
+	return os.WriteFile(filepath.Join(a.workspace, todoFile), []byte(strings.Join(out, "\n")), 0o644)
+}
@@ -0,0 +1,100 @@
+package agent
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/local/picobot/internal/diskguard"
+	"github.com/local/picobot/internal/telemetry"
+	"github.com/local/picobot/internal/watchdog"
+)
+
+// turnTimesKept is how many of the latest turns the health report averages.
+const turnTimesKept = 20
+
+// health is what the agent keeps of its own running for the diagnose_self
+// report; the rest comes from the hub, the watchdog, the telemetry and the
+// disk.
+type health struct {
+	mu        sync.Mutex
+	started   time.Time
+	turnTimes []time.Duration // of the latest turns, oldest first
+}
+
+// turnDone records how long a turn took.
+func (h *health) turnDone(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.turnTimes = append(h.turnTimes, d)
+	if len(h.turnTimes) > turnTimesKept {
+		h.turnTimes = h.turnTimes[len(h.turnTimes)-turnTimesKept:]
+	}
+}
+
+// healthReport describes the bot's own state for the diagnose_self tool.
+func (a *AgentLoop) healthReport() string {
+	var b strings.Builder
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	a.health.mu.Lock()
+	started, turnTimes := a.health.started, append([]time.Duration(nil), a.health.turnTimes...)
+	a.health.mu.Unlock()
+	if !started.IsZero() {
+		fmt.Fprintf(&b, "Up for %s", time.Since(started).Round(time.Second))
+	} else {
+		b.WriteString("Not running")
+	}
+	fmt.Fprintf(&b, "; %d goroutines, %.1f MiB heap\n", runtime.NumGoroutine(), float64(mem.HeapAlloc)/(1<<20))
+
+	if len(turnTimes) == 0 {
+		b.WriteString("Turns: none finished yet\n")
+	} else {
+		var total, longest time.Duration
+		for _, d := range turnTimes {
+			total += d
+			longest = max(longest, d)
+		}
+		fmt.Fprintf(&b, "Turns: the last %d took %s on average, %s at most\n", len(turnTimes),
+			(total / time.Duration(len(turnTimes))).Round(100*time.Millisecond), longest.Round(100*time.Millisecond))
+	}
+
+	b.WriteString("Queues (waiting/capacity):")
+	for i, q := range a.hub.QueueDepths() {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(&b, " %s %d/%d", q.Name, q.Len, q.Cap)
+	}
+	b.WriteString("\n")
+
+	if rec, ok, err := telemetry.LatestTrace(a.workspace); err != nil {
+		log.Printf("error reading traces: %v", err)
+		b.WriteString("Last provider error: unknown, the traces could not be read\n")
+	} else if !ok {
+		fmt.Fprintf(&b, "Last provider error: none in the last %d days\n", telemetry.TraceDays)
+	} else {
+		fmt.Fprintf(&b, "Last provider error: %s ago (trace %s, model %s): %s\n",
+			time.Since(rec.Time).Round(time.Second), rec.ID, rec.Model, rec.Error)
+	}
+
+	// Which of the provider's API keys is in use, when it has several.
+	if kp, ok := a.provider.(interface{ KeyStatus() string }); ok {
+		fmt.Fprintf(&b, "Provider API key: %s\n", kp.KeyStatus())
+	}
+
+	if statuses := watchdog.Default.Statuses(); len(statuses) == 0 {
+		b.WriteString("Channels: none watched\n")
+	} else {
+		b.WriteString("Channels:\n")
+		for _, st := range statuses {
+			b.WriteString(formatChannelStatus(st) + "\n")
+		}
+	}
+
+	fmt.Fprintf(&b, "Disk: %s", diskguard.Measure(a.workspace))
+	return b.String()
+}
@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/providers"
+	"github.com/local/picobot/internal/telemetry"
+)
+
+func TestDiagnoseSelf(t *testing.T) {
+	hub := chat.NewHub(10)
+	hub.Subscribe("telegram")
+	ws := t.TempDir()
+	ag := NewAgentLoop(hub, providers.NewStubProvider(), "stub", 3, ws, nil)
+	ag.health.turnDone(2 * time.Second)
+	ag.health.turnDone(4 * time.Second)
+	hub.In <- chat.Inbound{Channel: "telegram", ChatID: "1", Content: "waiting"}
+	if err := telemetry.RecordTrace(ws, telemetry.TraceRecord{ID: "abcd1234", Model: "stub", Error: "429 Too Many Requests"}); err != nil {
+		t.Fatal(err)
+	}
+
+	diagnose := ag.tools.Get("diagnose_self").(interface {
+		SetSender(string, bool)
+		Execute(context.Context, map[string]interface{}) (string, error)
+	})
+	diagnose.SetSender("", false)
+	if _, err := diagnose.Execute(context.Background(), nil); err == nil {
+		t.Fatal("diagnose_self ran for a non-admin")
+	}
+	diagnose.SetSender("", true)
+	report, err := diagnose.Execute(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"the last 2 took 3s on average, 4s at most",
+		"in 1/10, out 0/10, telegram 0/10",
+		"trace abcd1234, model stub): 429 Too Many Requests",
+		"Disk: workspace ",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report lacks %q:\n%s", want, report)
+		}
+	}
+}
+
+func TestDiagnoseSelfReportsProviderKey(t *testing.T) {
+	p := providers.NewOpenAIProvider("old-key-1234", "http://127.0.0.1:1", 60)
+	p.FallbackKeys = []string{"new-key-5678"}
+	ag := NewAgentLoop(chat.NewHub(10), p, "m", 3, t.TempDir(), nil)
+	if report := ag.healthReport(); !strings.Contains(report, "Provider API key: key 1 of 2 (…1234)\n") {
+		t.Errorf("report lacks the key in use:\n%s", report)
+	}
+	p.SetKeys("new-key-5678", nil)
+	if report := ag.healthReport(); !strings.Contains(report, "Provider API key: key 1 of 1 (…5678)\n") {
+		t.Errorf("report lacks the reloaded key:\n%s", report)
+	}
+}
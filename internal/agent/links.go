@@ -0,0 +1,235 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"github.com/local/picobot/internal/agent/memory"
+	"github.com/local/picobot/internal/useragent"
+)
+
+// linkRE finds the http(s) URLs in a message.
+var linkRE = regexp.MustCompile(`https?://[^\s<>"']+`)
+
+// linkClient fetches shared links for the archive.
+var linkClient = useragent.Client(30 * time.Second)
+
+const (
+	// maxLinkPage is the most of a page read when archiving it.
+	maxLinkPage = 2 << 20
+	// linksSource is the imported-notes source holding the link snapshots.
+	linksSource = "links"
+	// linksListed caps how many links /links shows.
+	linksListed = 20
+)
+
+// ArchivedLink is one entry of a chat's link index, links/<key>.jsonl.
+type ArchivedLink struct {
+	Time  time.Time `json:"time"`
+	URL   string    `json:"url"`
+	Title string    `json:"title"`
+	Files []string  `json:"files"` // snapshot notes, relative to the memory folder
+}
+
+// SetArchiveLinks turns link archiving on or off. When on, every link shared
+// in a chat is fetched in the background, and a readable snapshot is saved
+// as imported notes (so memory search can offer it) and listed by /links.
+func (a *AgentLoop) SetArchiveLinks(on bool) {
+	a.archiveLinks = on
+}
+
+// archiveLinksIn archives the links in text, shared in the chat key. It is
+// meant to run in the background; failures are only logged.
+func (a *AgentLoop) archiveLinksIn(ctx context.Context, key, text string) {
+	seen := map[string]bool{}
+	for _, u := range linkRE.FindAllString(text, -1) {
+		u = strings.TrimRight(u, ".,;:!?)]}")
+		if seen[u] {
+			continue
+		}
+		seen[u] = true
+		if err := a.archiveLink(ctx, key, u); err != nil {
+			log.Printf("error archiving link %s: %v", u, err)
+		}
+	}
+}
+
+// archiveLink saves a readable snapshot of the page at u and adds it to the
+// link index of the chat key.
+func (a *AgentLoop) archiveLink(ctx context.Context, key, u string) error {
+	title, text, err := fetchReadable(ctx, u)
+	if err != nil {
+		return err
+	}
+	if title == "" {
+		title = u
+	}
+	notes := memory.ChunkNotes([]memory.ImportedNote{{Title: title, Origin: u, Tags: []string{"link"}, Text: u + "\n\n" + text}}, memory.ImportChunkSize)
+	files, err := a.memory.AddImported(linksSource, notes)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(ArchivedLink{Time: time.Now().UTC(), URL: u, Title: title, Files: files})
+	if err != nil {
+		return err
+	}
+	a.linksMu.Lock()
+	defer a.linksMu.Unlock()
+	path := a.linksPath(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(b, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (a *AgentLoop) linksPath(key string) string {
+	return filepath.Join(a.workspace, "links", key+".jsonl")
+}
+
+// linksText answers /links: the links archived from the chat key, newest
+// first.
+func (a *AgentLoop) linksText(key string) string {
+	a.linksMu.Lock()
+	links, err := readLinks(a.linksPath(key))
+	a.linksMu.Unlock()
+	if err != nil {
+		log.Printf("error reading links of %s: %v", key, err)
+		return "Sorry, I couldn't read the archived links."
+	}
+	if len(links) == 0 {
+		if !a.archiveLinks {
+			return "No links archived. Link archiving is off (agents.defaults.archiveLinks)."
+		}
+		return "No links archived in this chat yet. Share one and I'll keep a copy."
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Archived links (%d):\n", len(links))
+	for i := len(links) - 1; i >= 0 && i >= len(links)-linksListed; i-- {
+		l := links[i]
+		fmt.Fprintf(&b, "\n%s %s\n%s", l.Time.Local().Format("2006-01-02"), l.Title, l.URL)
+	}
+	return b.String()
+}
+
+func readLinks(path string) ([]ArchivedLink, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	var links []ArchivedLink
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var l ArchivedLink
+		if json.Unmarshal(sc.Bytes(), &l) == nil {
+			links = append(links, l)
+		}
+	}
+	return links, sc.Err()
+}
+
+// fetchReadable downloads the page at u and returns its title and main text.
+// Plain-text pages are kept as they are; other non-HTML content is refused.
+func fetchReadable(ctx context.Context, u string) (title, text string, err error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return "", "", err
+	}
+	resp, err := linkClient.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("fetch: %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxLinkPage))
+	if err != nil {
+		return "", "", err
+	}
+	mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch mt {
+	case "text/plain", "text/markdown":
+		return "", strings.TrimSpace(string(body)), nil
+	case "text/html", "application/xhtml+xml", "":
+		title, text = readableText(string(body))
+		return title, text, nil
+	}
+	return "", "", fmt.Errorf("fetch: unsupported content type %q", mt)
+}
+
+// skippedElements hold no readable content: scripts, styles and the page's
+// navigation chrome.
+var skippedElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true, "svg": true,
+	"nav": true, "header": true, "footer": true, "aside": true, "form": true, "iframe": true,
+}
+
+// blockElements start a new paragraph in the extracted text.
+var blockElements = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "tr": true, "section": true, "article": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"blockquote": true, "pre": true, "table": true, "ul": true, "ol": true,
+}
+
+// readableText returns the title of an HTML page and its text, one paragraph
+// per block element, without scripts, styles and navigation.
+func readableText(page string) (title, text string) {
+	doc, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		return "", ""
+	}
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if n.Data == "title" && title == "" && n.FirstChild != nil {
+				title = strings.Join(strings.Fields(n.FirstChild.Data), " ")
+				return
+			}
+			if skippedElements[n.Data] {
+				return
+			}
+		}
+		if n.Type == html.TextNode {
+			if t := strings.Join(strings.Fields(n.Data), " "); t != "" {
+				if b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") {
+					b.WriteByte(' ')
+				}
+				b.WriteString(t)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		if n.Type == html.ElementNode && blockElements[n.Data] && b.Len() > 0 && !strings.HasSuffix(b.String(), "\n\n") {
+			b.WriteString("\n\n")
+		}
+	}
+	walk(doc)
+	return title, strings.TrimSpace(b.String())
+}
@@ -0,0 +1,51 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+func TestArchiveLinks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<html><head><title>Sourdough  basics</title><script>var x = 1;</script></head>
+<body><nav>Home | About</nav><article><h1>Sourdough</h1><p>Feed the <b>starter</b> daily.</p><p>Bake at 250C.</p></article></body></html>`)
+	}))
+	defer srv.Close()
+
+	ws := t.TempDir()
+	ag := NewAgentLoop(chat.NewHub(10), &modelRecorder{}, "main", 3, ws, nil)
+	ag.SetArchiveLinks(true)
+	ag.archiveLinksIn(context.Background(), "telegram:1", "look at this: "+srv.URL+"/bread.")
+
+	got := ag.linksText("telegram:1")
+	if !strings.Contains(got, "Sourdough basics\n"+srv.URL+"/bread") {
+		t.Fatalf("unexpected /links reply: %q", got)
+	}
+	if got := ag.linksText("telegram:2"); !strings.HasPrefix(got, "No links archived in this chat yet") {
+		t.Fatalf("links leaked to another chat: %q", got)
+	}
+
+	b, err := os.ReadFile(filepath.Join(ws, "memory", "imported", "links", "sourdough-basics.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap := string(b)
+	if !strings.Contains(snap, "Sourdough\n\nFeed the starter daily.\n\nBake at 250C.") {
+		t.Fatalf("unexpected snapshot: %q", snap)
+	}
+	if strings.Contains(snap, "var x") || strings.Contains(snap, "About") {
+		t.Fatalf("snapshot kept scripts or navigation: %q", snap)
+	}
+	if hits := ag.memory.SearchImported("how often to feed the starter", 5); len(hits) != 1 {
+		t.Fatalf("snapshot should be searchable as memory, got %v", hits)
+	}
+}
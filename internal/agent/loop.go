@@ -2,22 +2,38 @@ package agent
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"maps"
 	"os"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/local/picobot/internal/agent/memory"
 	"github.com/local/picobot/internal/agent/tools"
+	"github.com/local/picobot/internal/broadcast"
 	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
 	"github.com/local/picobot/internal/cron"
 	"github.com/local/picobot/internal/providers"
 	"github.com/local/picobot/internal/session"
+	"github.com/local/picobot/internal/telemetry"
+	"github.com/local/picobot/internal/webhooks"
 )
 
 var rememberRE = regexp.MustCompile(`(?i)^remember(?:\s+to)?\s+(.+)$`)
 
+// replyType is the outbound type of the reply to msg: replies to a fired
+// reminder (injected by the cron scheduler) are reminders themselves.
+func replyType(msg chat.Inbound) string {
+	if msg.SenderID == "cron" {
+		return chat.TypeReminder
+	}
+	return ""
+}
+
 // isSystemChannel reports whether a channel is a background/system trigger
 // (heartbeat, cron) rather than an interactive user-facing channel.
 // Messages from system channels are processed statelessly: no session history
@@ -41,8 +57,40 @@ type AgentLoop struct {
 	sessions      *session.SessionManager
 	context       *ContextBuilder
 	memory        *memory.MemoryStore
+	workspace     string
 	model         string
+	draftModel    string
+	chatModels    map[string]string           // per-chat model overrides set with /model
+	private       map[string]*session.Session // chats in private mode, with their in-RAM history (see privateText)
 	maxIterations int
+	rotations     *tools.RotationStore
+	dates         *tools.DateStore
+	postDrafts    *tools.PostDrafts // posts awaiting /publish, see SetPublishChannels
+	scheduler     *cron.Scheduler
+	briefings     []config.BriefingConfig   // see SetBriefings
+	credentials   []config.CredentialConfig // see SetCredentials
+	events        *webhooks.Dispatcher      // see SetEventWebhooks; nil = none
+	archiveLinks  bool                      // see SetArchiveLinks
+	broadcaster   *broadcast.Broadcaster    // paces /broadcast, see SetBroadcastLimits
+	ctx           context.Context           // Run's, for work that outlives a turn
+	tasksMu       sync.Mutex
+	pendingTasks  map[string][]proposedTask // per chat, awaiting /tasks accept
+	onboarding    *config.OnboardingConfig  // see SetOnboarding; nil = off
+	root          *os.Root                  // the workspace, for tools registered later
+	profilesMu    sync.Mutex                // serializes access to profiles.json
+	profiles      profileCache              // profiles.json as last read, under profilesMu
+	linksMu       sync.Mutex                // serializes access to the link indexes
+	skillHosts    skillHostIndex            // see turnFeature
+	turns         *turnJournal              // see SetTurnJournal; nil = no journal
+	turn          int64                     // journal ID of the turn being run, 0 = none
+	costPreview   *config.CostPreviewConfig // see SetCostPreview; nil = off
+	costMu        sync.Mutex
+	heldTurns     map[string]heldTurn // per chat and sender, costly requests awaiting /confirm
+	actionsMu     sync.Mutex
+	actions       map[string]*actionLog // per chat, the last turn's, see /what-did-you-do
+	health        health                // for diagnose_self, see healthReport
+	research      config.ResearchConfig // see SetResearch
+	seed          *int64                // see SetSeed; nil = a random seed per turn
 	running       bool
 }
 
@@ -55,8 +103,6 @@ func NewAgentLoop(b *chat.Hub, provider providers.LLMProvider, model string, max
 		workspace = "."
 	}
 	reg := tools.NewRegistry()
-	// register default tools
-	reg.Register(tools.NewMessageTool(b))
 
 	// Open an os.Root anchored at the workspace for kernel-enforced sandboxing.
 	root, err := os.OpenRoot(workspace)
@@ -64,6 +110,23 @@ func NewAgentLoop(b *chat.Hub, provider providers.LLMProvider, model string, max
 		log.Fatalf("failed to open workspace root %q: %v", workspace, err)
 	}
 
+	// register default tools
+	reg.Register(tools.NewMessageToolWithWorkspace(b, root))
+	reg.Register(tools.NewCreatePollTool(b))
+	reg.Register(tools.NewSendButtonsTool(b))
+	reg.Register(tools.NewPinMessageTool(b))
+	reg.Register(tools.NewChannelActionTool(b))
+	postDrafts := tools.NewPostDrafts()
+	reg.Register(tools.NewPublishPostTool(b, root, postDrafts))
+	diagnose := tools.NewDiagnoseSelfTool()
+	reg.Register(diagnose)
+	rotations := tools.NewRotationStore(root)
+	reg.Register(tools.NewCreateRotationTool(rotations))
+	reg.Register(tools.NewWhoseTurnTool(rotations))
+	dates := tools.NewDateStore(root)
+	reg.Register(tools.NewAddDateTool(dates))
+	reg.Register(tools.NewUpcomingDatesTool(dates))
+
 	fsTool, err := tools.NewFilesystemTool(workspace)
 	if err != nil {
 		log.Fatalf("failed to create filesystem tool: %v", err)
@@ -90,14 +153,50 @@ func NewAgentLoop(b *chat.Hub, provider providers.LLMProvider, model string, max
 	reg.Register(tools.NewReadSkillTool(skillMgr))
 	reg.Register(tools.NewDeleteSkillTool(skillMgr))
 
-	return &AgentLoop{hub: b, provider: provider, tools: reg, sessions: sm, context: ctx, memory: mem, model: model, maxIterations: maxIterations}
+	b.SetCommands(builtinCommands)
+
+	a := &AgentLoop{hub: b, provider: provider, tools: reg, sessions: sm, context: ctx, memory: mem, rotations: rotations, dates: dates, postDrafts: postDrafts, scheduler: scheduler, workspace: workspace, model: model, broadcaster: broadcast.New(b.Out, nil), root: root, chatModels: make(map[string]string), private: make(map[string]*session.Session), maxIterations: maxIterations}
+	diagnose.SetReport(a.healthReport)
+	return a
+}
+
+// SetObsidianVault mirrors the agent's memory into the Obsidian vault at path
+// after every memory write. An empty path disables the export.
+func (a *AgentLoop) SetObsidianVault(path string) {
+	a.memory.SetExportVault(path)
 }
 
 // Run starts processing inbound messages. This is a blocking call until context is canceled.
 func (a *AgentLoop) Run(ctx context.Context) {
+	a.start(ctx)
+	go a.announceRotations(ctx)
+	go a.notifyDates(ctx)
+	go a.runBriefings(ctx)
+	a.resumeTurns(ctx)
+	a.loop(ctx, a.runTurn)
+}
+
+// RunLocal processes inbound messages for a session in the terminal
+// (picobot repl) until ctx is canceled. Unlike Run it neither resumes the
+// turns of the journal nor starts the jobs that post to chats (rotation,
+// date and briefing announcements): those belong to the gateway.
+func (a *AgentLoop) RunLocal(ctx context.Context) {
+	a.start(ctx)
+	a.loop(ctx, a.processInbound)
+}
+
+func (a *AgentLoop) start(ctx context.Context) {
 	a.running = true
+	a.ctx = ctx
+	a.health.mu.Lock()
+	a.health.started = time.Now()
+	a.health.mu.Unlock()
 	log.Println("Agent loop started")
+}
 
+// loop hands each inbound message to turn until ctx is canceled or the
+// inbound channel is closed.
+func (a *AgentLoop) loop(ctx context.Context, turn func(context.Context, chat.Inbound)) {
 	for a.running {
 		select {
 		case <-ctx.Done():
@@ -111,122 +210,352 @@ func (a *AgentLoop) Run(ctx context.Context) {
 				return
 			}
 
-			log.Printf("Processing message from %s:%s\n", msg.Channel, msg.SenderID)
+			turn(ctx, msg)
+		default:
+			// idle tick
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+}
 
-			// Quick heuristic: if user asks the agent to remember something explicitly,
-			// store it in today's note and reply immediately without calling the LLM.
-			trimmed := strings.TrimSpace(msg.Content)
-			rememberRe := rememberRE
-			if matches := rememberRe.FindStringSubmatch(trimmed); len(matches) == 2 {
-				note := matches[1]
-				if err := a.memory.AppendToday(note); err != nil {
-					log.Printf("error appending to memory: %v", err)
-				}
-				out := chat.Outbound{Channel: msg.Channel, ChatID: msg.ChatID, Content: "OK, I've remembered that."}
-				select {
-				case a.hub.Out <- out:
-				default:
-					log.Println("Outbound channel full, dropping message")
-				}
-				// Only save session for interactive channels, not system triggers.
-				if !isSystemChannel(msg.Channel) {
-					sess := a.sessions.GetOrCreate(msg.Channel + ":" + msg.ChatID)
-					sess.AddMessage("user", msg.Content)
-					sess.AddMessage("assistant", "OK, I've remembered that.")
-					a.sessions.Save(sess)
-				}
-				continue
-			}
+// processInbound handles one inbound message: it records events, runs
+// onboarding and commands, and otherwise runs an agent turn and sends
+// the reply.
+func (a *AgentLoop) processInbound(ctx context.Context, msg chat.Inbound) {
+	log.Printf("Processing message from %s:%s\n", msg.Channel, msg.SenderID)
+	private := a.privateSession(msg.Channel + ":" + msg.ChatID)
 
-			// Set tool context (so message tool knows channel+chat)
-			if mt := a.tools.Get("message"); mt != nil {
-				if mtool, ok := mt.(interface{ SetContext(string, string) }); ok {
-					mtool.SetContext(msg.Channel, msg.ChatID)
-				}
-			}
-			if ct := a.tools.Get("cron"); ct != nil {
-				if ctool, ok := ct.(interface{ SetContext(string, string) }); ok {
-					ctool.SetContext(msg.Channel, msg.ChatID)
-				}
-			}
+	// A reply the channel could not deliver is replaced by a summary.
+	if msg.Event() == chat.EventUndelivered {
+		a.deliverFallback(ctx, msg)
+		return
+	}
 
-			// Build messages from session, long-term memory, and recent memory.
-			// System channels (heartbeat, cron) get a blank ephemeral session so
-			// their history never accumulates and bloats the context window.
-			var sess *session.Session
-			if isSystemChannel(msg.Channel) {
-				sess = &session.Session{Key: msg.Channel + ":" + msg.ChatID}
-			} else {
-				sess = a.sessions.GetOrCreate(msg.Channel + ":" + msg.ChatID)
-			}
-			// get file-backed memory context (long-term + today)
-			memCtx, _ := a.memory.GetMemoryContext()
-			memories := a.memory.Recent(5)
-			messages := a.context.BuildMessages(sess.GetHistory(), msg.Content, msg.Channel, msg.ChatID, memCtx, memories)
-
-			iteration := 0
-			finalContent := ""
-			lastToolResult := ""
-			toolDefs := a.tools.Definitions()
-			for iteration < a.maxIterations {
-				iteration++
-				resp, err := a.provider.Chat(ctx, messages, toolDefs, a.model)
-				if err != nil {
-					log.Printf("provider error: %v", err)
-					finalContent = "Sorry, I encountered an error while processing your request."
-					break
-				}
+	// Events (e.g. poll votes) are recorded for later turns, not answered.
+	if ev := msg.Event(); ev != "" {
+		if ev == "channel_post" {
+			a.postDrafts.RecordPost(msg.Content)
+		}
+		if private != nil {
+			private.AddMessage("event", msg.Content)
+		} else if !isSystemChannel(msg.Channel) {
+			sess := a.sessions.GetOrCreate(msg.Channel + ":" + msg.ChatID)
+			sess.AddMessage("event", msg.Content)
+			a.sessions.Save(sess)
+		}
+		return
+	}
 
-				if resp.HasToolCalls {
-					// append assistant message with tool_calls attached
-					messages = append(messages, providers.Message{Role: "assistant", Content: resp.Content, ToolCalls: resp.ToolCalls})
-					// Execute each tool call and return results with "tool" role
-					for _, tc := range resp.ToolCalls {
-						res, err := a.tools.Execute(ctx, tc.Name, tc.Arguments)
-						if err != nil {
-							res = "(tool error) " + err.Error()
-						}
-						lastToolResult = res
-						messages = append(messages, providers.Message{Role: "tool", Content: res, ToolCallID: tc.ID})
-					}
-					// loop again
-					continue
-				} else {
-					finalContent = resp.Content
-					break
-				}
-			}
+	// A costly request held back for confirmation runs once confirmed; any
+	// other message drops it.
+	if held, ok := a.heldTurnFor(msg); ok {
+		msg = held
+	}
 
-			if finalContent == "" && lastToolResult != "" {
-				finalContent = lastToolResult
-			} else if finalContent == "" {
-				finalContent = "I've completed processing but have no response to give."
-			}
+	// New users are onboarded before anything else; their first
+	// message is answered once onboarding completes.
+	if reply, ok, resume := a.onboard(msg); ok {
+		out := chat.Outbound{Channel: msg.Channel, ChatID: msg.ChatID, Content: reply, ReplyTo: msg.MessageID()}
+		select {
+		case a.hub.Out <- out:
+		default:
+			log.Println("Outbound channel full, dropping message")
+		}
+		if resume == "" {
+			return
+		}
+		msg.Content = resume
+	}
 
-			// Save session for interactive channels only.
-			// System channels (heartbeat, cron) are stateless triggers — their
-			// history must not be persisted, otherwise the file grows unboundedly.
-			if !isSystemChannel(msg.Channel) {
-				sess.AddMessage("user", msg.Content)
-				sess.AddMessage("assistant", finalContent)
-				a.sessions.Save(sess)
-			}
+	// Built-in slash commands are answered without calling the LLM.
+	if reply, ok := a.handleCommand(msg); ok {
+		if reply == "" {
+			return // the command sent its own reply
+		}
+		isPrivate := a.privateSession(msg.Channel+":"+msg.ChatID) != nil
+		if isPrivate {
+			reply = privateMark + reply
+		}
+		out := chat.Outbound{Channel: msg.Channel, ChatID: msg.ChatID, Content: reply, ReplyTo: msg.MessageID(), Private: isPrivate}
+		select {
+		case a.hub.Out <- out:
+		default:
+			log.Println("Outbound channel full, dropping message")
+		}
+		return
+	}
+
+	if a.archiveLinks && private == nil && !isSystemChannel(msg.Channel) {
+		go a.archiveLinksIn(ctx, msg.Channel+":"+msg.ChatID, msg.Content)
+	}
 
-			out := chat.Outbound{Channel: msg.Channel, ChatID: msg.ChatID, Content: finalContent}
+	// Quick heuristic: if user asks the agent to remember something explicitly,
+	// store it in today's note and reply immediately without calling the LLM.
+	trimmed := strings.TrimSpace(msg.Content)
+	rememberRe := rememberRE
+	if matches := rememberRe.FindStringSubmatch(trimmed); len(matches) == 2 {
+		if private != nil {
+			reply := "Private mode is on, so I won't save that. Send /private off first if you want me to remember it."
+			addPrivateTurn(private, msg.Content, reply)
+			out := chat.Outbound{Channel: msg.Channel, ChatID: msg.ChatID, Content: privateMark + reply, ReplyTo: msg.MessageID(), Private: true}
 			select {
 			case a.hub.Out <- out:
 			default:
 				log.Println("Outbound channel full, dropping message")
 			}
+			return
+		}
+		note := matches[1]
+		if msg.SenderName != "" {
+			note += " (from " + msg.SenderName + ")"
+		}
+		acts := newActionLog(msg.Content)
+		if err := a.memory.AppendToday(note); err != nil {
+			log.Printf("error appending to memory: %v", err)
+			acts.decide("Tried to save the message to today's memory notes, without asking the model, but failed: %v", err)
+		} else {
+			acts.decide("Saved the message to today's memory notes, without asking the model")
+		}
+		a.recordActions(msg, acts)
+		out := chat.Outbound{Channel: msg.Channel, ChatID: msg.ChatID, Content: "OK, I've remembered that.", ReplyTo: msg.MessageID()}
+		select {
+		case a.hub.Out <- out:
 		default:
-			// idle tick
-			time.Sleep(100 * time.Millisecond)
+			log.Println("Outbound channel full, dropping message")
+		}
+		// Only save session for interactive channels, not system triggers.
+		if !isSystemChannel(msg.Channel) {
+			sess := a.sessions.GetOrCreate(msg.Channel + ":" + msg.ChatID)
+			sess.AddMessage("user", msg.Content)
+			sess.AddMessage("assistant", "OK, I've remembered that.")
+			a.sessions.Save(sess)
+			a.archiveTurn(sess.Key, msg.Content, "OK, I've remembered that.")
 		}
+		return
+	}
+
+	// Set tool context (so message tool knows channel+chat)
+	if mt := a.tools.Get("message"); mt != nil {
+		if mtool, ok := mt.(interface{ SetContext(string, string) }); ok {
+			mtool.SetContext(msg.Channel, msg.ChatID)
+		}
+	}
+	if ct := a.tools.Get("cron"); ct != nil {
+		if ctool, ok := ct.(interface{ SetContext(string, string) }); ok {
+			ctool.SetContext(msg.Channel, msg.ChatID)
+		}
+	}
+	if pt := a.tools.Get("create_poll"); pt != nil {
+		if ptool, ok := pt.(interface{ SetContext(string, string) }); ok {
+			ptool.SetContext(msg.Channel, msg.ChatID)
+		}
+	}
+	for _, name := range []string{"send_buttons", "pin_message", "channel_action", "publish_post", "create_rotation", "whose_turn", "add_date", "upcoming_dates"} {
+		if rt, ok := a.tools.Get(name).(interface{ SetContext(string, string) }); ok {
+			rt.SetContext(msg.Channel, msg.ChatID)
+		}
+	}
+	for _, name := range []string{"pin_message", "channel_action", "post_whatsapp_status", "publish_post", "diagnose_self"} {
+		if at, ok := a.tools.Get(name).(interface{ SetSender(string, bool) }); ok {
+			at.SetSender(msg.MessageID(), msg.IsAdmin())
+		}
+	}
+	a.scopeCredentials(msg.Channel, msg.ChatID, msg.SenderID)
+
+	// Build messages from session, long-term memory, and recent memory.
+	// System channels (heartbeat, cron) get a blank ephemeral session so
+	// their history never accumulates and bloats the context window.
+	var sess *session.Session
+	if isSystemChannel(msg.Channel) {
+		sess = &session.Session{Key: msg.Channel + ":" + msg.ChatID}
+	} else if private != nil {
+		sess = private
+	} else {
+		sess = a.sessions.GetOrCreate(msg.Channel + ":" + msg.ChatID)
+	}
+	// get file-backed memory context (long-term + today)
+	memCtx, _ := a.memory.GetMemoryContext()
+	memories := append(a.memory.Recent(5), a.memory.SearchImported(msg.Content, 5)...)
+	notes := map[string]interface{}{}
+	if note := a.profileNote(msg); note != "" {
+		notes["profile"] = note
+	}
+	if posts := a.recentPostsNote(msg); posts != "" {
+		notes["channel_posts"] = posts
+	}
+	if len(notes) > 0 {
+		meta := maps.Clone(msg.Metadata)
+		if meta == nil {
+			meta = make(map[string]interface{})
+		}
+		maps.Copy(meta, notes)
+		msg.Metadata = meta
+	}
+	messages, stats := a.context.BuildInboundMessages(sess.GetHistory(), msg, memCtx, memories)
+	toolDefs := a.tools.Definitions()
+	acts := newActionLog(msg.Content)
+	if reply, held := a.previewCost(msg, stats, toolDefs); held {
+		acts.decide("Held the request back as expensive, until confirmed with /confirm")
+		a.recordActions(msg, acts)
+		out := chat.Outbound{Channel: msg.Channel, ChatID: msg.ChatID, Content: reply, ReplyTo: msg.MessageID(), Metadata: costButtons()}
+		select {
+		case a.hub.Out <- out:
+		default:
+			log.Println("Outbound channel full, dropping message")
+		}
+		return
+	}
+
+	a.turns.set(a.turn, turnProcessing)
+	turnStart := time.Now()
+	iteration := 0
+	finalContent := ""
+	outType := replyType(msg)
+	lastToolResult := ""
+	var toolsCalled []string
+	var calls []telemetry.TraceCall // for the trace of a failed turn
+	followup, defTokens := 0, toolDefTokens(toolDefs)
+	model := a.modelFor(msg.Channel, msg.ChatID)
+	seed := a.turnSeed()
+	ctx = providers.WithSeed(ctx, seed)
+	log.Printf("turn %s:%s: model %s, seed %d", msg.Channel, msg.ChatID, model, seed)
+	if model != a.model {
+		acts.decide("Used model %s, chosen for this chat with /model", model)
+	} else {
+		acts.decide("Used model %s", model)
+	}
+	if len(memories) > 0 {
+		acts.decide("Recalled %d memory notes", len(memories))
+	}
+	draft, drafted := "", false
+	if model == a.model {
+		// A model picked with /model is used as is, without drafting.
+		draft, messages, drafted = a.draftReply(ctx, telemetry.PromptRecord{Channel: msg.Channel, ChatID: msg.ChatID, Stats: stats}, msg.Content, messages, toolDefs)
+	}
+	if drafted {
+		finalContent = draft
+		acts.decide("Answered with the draft of %s, which passed the confidence checks", a.draftModel)
+	}
+	var stream *replyStream
+	if !drafted {
+		if stream = a.newReplyStream(msg); stream != nil {
+			stream.publish() // placeholder while the model is thinking
+		}
+	}
+	for !drafted && iteration < a.maxIterations {
+		iteration++
+		if iteration > 1 {
+			followup += messagesTokens(messages) + defTokens
+		}
+		resp, err := a.chat(ctx, messages, toolDefs, model, stream)
+		if err != nil {
+			failed := msg
+			if private != nil {
+				failed.Content, calls = "(private)", nil
+			}
+			id := a.recordFailure(failed, model, seed, iteration, toolsCalled, calls, err)
+			log.Printf("provider error (trace %s): %v", id, err)
+			a.events.Emit(webhooks.Event{Event: webhooks.Error, Channel: msg.Channel, ChatID: msg.ChatID, SenderID: msg.SenderID,
+				Model: model, Iterations: iteration, Tools: toolsCalled, DurationMs: time.Since(turnStart).Milliseconds(),
+				TraceID: id, Error: err.Error(), Private: private != nil, Message: msg.Content})
+			finalContent = fmt.Sprintf("Sorry, I encountered an error while processing your request (trace %s).", id)
+			acts.decide("The model call failed (trace %s), so I apologized instead of answering", id)
+			outType = chat.TypeError
+			break
+		}
+
+		if resp.HasToolCalls {
+			// append assistant message with tool_calls attached
+			messages = append(messages, providers.Message{Role: "assistant", Content: resp.Content, ToolCalls: resp.ToolCalls})
+			call := telemetry.TraceCall{Content: resp.Content}
+			for _, tc := range resp.ToolCalls {
+				call.ToolCalls = append(call.ToolCalls, telemetry.TraceToolCall{Name: tc.Name, Arguments: tc.Arguments})
+			}
+			calls = append(calls, call)
+			// Execute each tool call and return results with "tool" role
+			for _, tc := range resp.ToolCalls {
+				toolsCalled = append(toolsCalled, tc.Name)
+				var res string
+				var err error
+				toolStart := time.Now()
+				if private != nil && tc.Name == "write_memory" {
+					err = fmt.Errorf("private mode is on: nothing from this conversation may be saved to memory")
+				} else {
+					res, err = a.tools.Execute(ctx, tc.Name, tc.Arguments)
+				}
+				acts.tool(tc.Name, tc.Arguments, res, err, time.Since(toolStart))
+				ev := webhooks.Event{Event: webhooks.Tool, Channel: msg.Channel, ChatID: msg.ChatID, SenderID: msg.SenderID,
+					Tool: tc.Name, DurationMs: time.Since(toolStart).Milliseconds(), Private: private != nil, Arguments: tc.Arguments}
+				if err != nil {
+					res = "(tool error) " + err.Error()
+					ev.Error = err.Error()
+				}
+				a.events.Emit(ev)
+				a.publishToolEvent(msg, chat.ToolEvent{Name: tc.Name, Duration: time.Since(toolStart), Error: ev.Error})
+				lastToolResult = res
+				messages = append(messages, providers.Message{Role: "tool", Content: res, ToolCallID: tc.ID})
+			}
+			// loop again
+			continue
+		} else {
+			finalContent = resp.Content
+			break
+		}
+	}
+
+	if finalContent == "" && iteration >= a.maxIterations {
+		acts.decide("Stopped after %d model calls, the limit per request", iteration)
+	}
+	if finalContent == "" && lastToolResult != "" {
+		finalContent = lastToolResult
+		acts.decide("Replied with the last tool's result, as the model wrote no reply")
+	} else if finalContent == "" {
+		finalContent = "I've completed processing but have no response to give."
+	}
+	// What is kept in the history is what the user gets.
+	finalContent = a.hub.Sanitize(msg.Channel, finalContent)
+	a.recordActions(msg, acts)
+	if !drafted {
+		// A draft accepted was the turn's only model call, recorded by draftReply.
+		a.recordPromptStats(telemetry.PromptRecord{Channel: msg.Channel, ChatID: msg.ChatID, Stats: stats,
+			Followup: followup, Feature: a.turnFeature(calls)}, toolDefs)
+	}
+
+	// Save session for interactive channels only.
+	// System channels (heartbeat, cron) are stateless triggers — their
+	// history must not be persisted, otherwise the file grows unboundedly.
+	// Private chats keep their turns in RAM only.
+	if private != nil {
+		addPrivateTurn(private, msg.Content, finalContent)
+		finalContent = privateMark + finalContent
+	} else if !isSystemChannel(msg.Channel) {
+		sess.AddMessage("user", msg.Content)
+		sess.AddMessage("assistant", finalContent)
+		a.sessions.Save(sess)
+		a.archiveTurn(sess.Key, msg.Content, finalContent)
+	}
+
+	if outType != chat.TypeError {
+		a.events.Emit(webhooks.Event{Event: webhooks.Turn, Channel: msg.Channel, ChatID: msg.ChatID, SenderID: msg.SenderID,
+			Model: model, Iterations: iteration, Tools: toolsCalled, DurationMs: time.Since(turnStart).Milliseconds(),
+			Private: private != nil, Message: msg.Content, Reply: finalContent})
+	}
+
+	a.health.turnDone(time.Since(turnStart))
+
+	out := chat.Outbound{Channel: msg.Channel, ChatID: msg.ChatID, Content: finalContent, ReplyTo: msg.MessageID(), Type: outType,
+		Private: private != nil}
+	stream.finish(&out)
+	select {
+	case a.hub.Out <- out:
+	default:
+		log.Println("Outbound channel full, dropping message")
 	}
 }
 
 // ProcessDirect sends a message directly to the provider and returns the response.
 // It supports tool calling - if the model requests tools, they will be executed.
+// Running out of iterations before a final response is an error.
 func (a *AgentLoop) ProcessDirect(content string, timeout time.Duration) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
@@ -243,42 +572,78 @@ func (a *AgentLoop) ProcessDirect(content string, timeout time.Duration) (string
 			ctool.SetContext("cli", "direct")
 		}
 	}
+	if pt := a.tools.Get("create_poll"); pt != nil {
+		if ptool, ok := pt.(interface{ SetContext(string, string) }); ok {
+			ptool.SetContext("cli", "direct")
+		}
+	}
+	a.scopeCredentials("cli", "direct", "")
 
 	// Build full context (bootstrap files, skills, memory) just like the main loop
 	memCtx, _ := a.memory.GetMemoryContext()
-	memories := a.memory.Recent(5)
-	messages := a.context.BuildMessages(nil, content, "cli", "direct", memCtx, memories)
+	memories := append(a.memory.Recent(5), a.memory.SearchImported(content, 5)...)
+	messages, stats := a.context.BuildMessagesWithStats(nil, content, "cli", "direct", memCtx, memories)
+
+	toolDefs := a.tools.Definitions()
+	rec := telemetry.PromptRecord{Channel: "cli", ChatID: "direct", Stats: stats}
+	seed := a.turnSeed()
+	ctx = providers.WithSeed(ctx, seed)
+	log.Printf("turn cli:direct: model %s, seed %d", a.model, seed)
+	turnStart := time.Now()
+	var toolsCalled []string
+	answered := func(reply string, iterations int) (string, error) {
+		reply = a.hub.Sanitize("cli", reply)
+		a.events.Emit(webhooks.Event{Event: webhooks.Turn, Channel: "cli", ChatID: "direct", Model: a.model,
+			Iterations: iterations, Tools: toolsCalled, DurationMs: time.Since(turnStart).Milliseconds(), Message: content, Reply: reply})
+		return reply, nil
+	}
+	draft, messages, drafted := a.draftReply(ctx, rec, content, messages, toolDefs)
+	if drafted {
+		return answered(draft, 0)
+	}
+	a.recordPromptStats(rec, toolDefs)
 
 	// Support tool calling iterations (similar to main loop)
 	var lastToolResult string
 	for iteration := 0; iteration < a.maxIterations; iteration++ {
-		resp, err := a.provider.Chat(ctx, messages, a.tools.Definitions(), a.model)
+		resp, err := a.provider.Chat(ctx, messages, toolDefs, a.model)
 		if err != nil {
+			a.events.Emit(webhooks.Event{Event: webhooks.Error, Channel: "cli", ChatID: "direct", Model: a.model,
+				Iterations: iteration + 1, Tools: toolsCalled, DurationMs: time.Since(turnStart).Milliseconds(), Error: err.Error(), Message: content})
 			return "", err
 		}
 
 		if !resp.HasToolCalls {
 			// No tool calls, return the response (fall back to last tool result if empty)
 			if resp.Content != "" {
-				return resp.Content, nil
+				return answered(resp.Content, iteration+1)
 			}
 			if lastToolResult != "" {
-				return lastToolResult, nil
+				return answered(lastToolResult, iteration+1)
 			}
-			return resp.Content, nil
+			return answered(resp.Content, iteration+1)
 		}
 
 		// Execute tool calls
 		messages = append(messages, providers.Message{Role: "assistant", Content: resp.Content, ToolCalls: resp.ToolCalls})
 		for _, tc := range resp.ToolCalls {
+			toolsCalled = append(toolsCalled, tc.Name)
+			toolStart := time.Now()
 			result, err := a.tools.Execute(ctx, tc.Name, tc.Arguments)
+			ev := webhooks.Event{Event: webhooks.Tool, Channel: "cli", ChatID: "direct", Tool: tc.Name,
+				DurationMs: time.Since(toolStart).Milliseconds(), Arguments: tc.Arguments}
 			if err != nil {
 				result = "(tool error) " + err.Error()
+				ev.Error = err.Error()
 			}
+			a.events.Emit(ev)
 			lastToolResult = result
 			messages = append(messages, providers.Message{Role: "tool", Content: result, ToolCallID: tc.ID})
 		}
 	}
 
-	return "Max iterations reached without final response", nil
+	err := fmt.Errorf("no final response after %d iterations", a.maxIterations)
+	a.events.Emit(webhooks.Event{Event: webhooks.Error, Channel: "cli", ChatID: "direct", Model: a.model,
+		Iterations: a.maxIterations, Tools: toolsCalled, DurationMs: time.Since(turnStart).Milliseconds(), Error: err.Error(), Message: content})
+	return "", err
 }
@@ -63,3 +63,13 @@ func TestProcessDirectExecutesToolCall(t *testing.T) {
 }
 
 func contains(s, sub string) bool { return strings.Contains(s, sub) }
+
+func TestProcessDirectFailsWithoutFinalResponse(t *testing.T) {
+	prov := &writeMemoryCallingProvider{}
+	ag := NewAgentLoop(chat.NewHub(10), prov, prov.GetDefaultModel(), 1, "", nil)
+
+	resp, err := ag.ProcessDirect("please remember Test note", 2*time.Second)
+	if err == nil || resp != "" {
+		t.Fatalf("ProcessDirect = %q, %v; want an error", resp, err)
+	}
+}
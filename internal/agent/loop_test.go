@@ -1,6 +1,7 @@
 package agent
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -22,3 +23,32 @@ func TestProcessDirectWithStub(t *testing.T) {
 		t.Fatalf("expected response, got empty string")
 	}
 }
+
+// leakyProvider answers with a role marker the sanitizer removes.
+type leakyProvider struct{}
+
+func (leakyProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string) (providers.LLMResponse, error) {
+	return providers.LLMResponse{Content: "Assistant: Hello!"}, nil
+}
+
+func (leakyProvider) GetDefaultModel() string { return "fake" }
+
+func TestRepliesAreSanitizedBeforeKeeping(t *testing.T) {
+	b := chat.NewHub(10)
+	s, err := chat.NewSanitizer(map[string][]chat.SanitizeRule{"*": {{Preset: "role_markers"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.SetSanitizer(s)
+	ag := NewAgentLoop(b, leakyProvider{}, "fake", 3, t.TempDir(), nil)
+
+	if resp, err := ag.ProcessDirect("hi", time.Second); err != nil || resp != "Hello!" {
+		t.Fatalf("ProcessDirect = %q, %v", resp, err)
+	}
+	ag.processInbound(context.Background(), chat.Inbound{Channel: "telegram", SenderID: "u", ChatID: "1", Content: "hi"})
+	<-b.Out
+	history := ag.sessions.GetOrCreate("telegram:1").GetHistory()
+	if len(history) != 2 || history[1] != "assistant: Hello!" {
+		t.Fatalf("history = %q", history)
+	}
+}
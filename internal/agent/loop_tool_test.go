@@ -2,11 +2,16 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
 	"github.com/local/picobot/internal/providers"
+	"github.com/local/picobot/internal/webhooks"
 )
 
 // Fake provider that returns a tool call on first chat, then returns a final message on second chat.
@@ -59,3 +64,100 @@ func TestAgentExecutesToolCall(t *testing.T) {
 		}
 	}
 }
+
+func TestAgentEmitsEventWebhooks(t *testing.T) {
+	got := make(chan webhooks.Event, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev webhooks.Event
+		json.NewDecoder(r.Body).Decode(&ev)
+		got <- ev
+	}))
+	defer srv.Close()
+
+	b := chat.NewHub(10)
+	p := &FakeProvider{}
+	ag := NewAgentLoop(b, p, p.GetDefaultModel(), 3, t.TempDir(), nil)
+	ag.SetEventWebhooks([]config.EventWebhook{{URL: srv.URL}})
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	go ag.Run(ctx)
+	b.In <- chat.Inbound{Channel: "cli", SenderID: "user", ChatID: "one", Content: "trigger"}
+
+	kinds := map[string]webhooks.Event{}
+	for len(kinds) < 2 {
+		select {
+		case ev := <-got:
+			kinds[ev.Event] = ev
+		case <-ctx.Done():
+			t.Fatalf("timeout, got %v", kinds)
+		}
+	}
+	if ev := kinds[webhooks.Tool]; ev.Tool != "message" || ev.ChatID != "one" {
+		t.Errorf("tool event = %+v", ev)
+	}
+	if ev := kinds[webhooks.Turn]; ev.Iterations != 2 || len(ev.Tools) != 1 || ev.Reply != "" {
+		t.Errorf("turn event = %+v (content must not be sent without includeContent)", ev)
+	}
+}
+
+func TestProcessDirectEmitsEventWebhooks(t *testing.T) {
+	got := make(chan webhooks.Event, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev webhooks.Event
+		json.NewDecoder(r.Body).Decode(&ev)
+		got <- ev
+	}))
+	defer srv.Close()
+
+	p := &FakeProvider{}
+	ag := NewAgentLoop(chat.NewHub(10), p, p.GetDefaultModel(), 3, t.TempDir(), nil)
+	ag.SetEventWebhooks([]config.EventWebhook{{URL: srv.URL}})
+	if _, err := ag.ProcessDirect("trigger", 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	kinds := map[string]webhooks.Event{}
+	for len(kinds) < 2 {
+		select {
+		case ev := <-got:
+			kinds[ev.Event] = ev
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout, got %v", kinds)
+		}
+	}
+	if ev := kinds[webhooks.Turn]; ev.Channel != "cli" || ev.Iterations != 2 || len(ev.Tools) != 1 {
+		t.Errorf("turn event = %+v", ev)
+	}
+}
+
+func TestAgentPublishesToolEvents(t *testing.T) {
+	b := chat.NewHub(10)
+	b.EnableToolEvents("api")
+	p := &FakeProvider{}
+	ag := NewAgentLoop(b, p, p.GetDefaultModel(), 3, t.TempDir(), nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	go ag.Run(ctx)
+	b.In <- chat.Inbound{Channel: "api", SenderID: "svc", ChatID: "svc:one", Content: "trigger",
+		Metadata: map[string]interface{}{"message_id": "a1"}}
+
+	var events []chat.ToolEvent
+	for {
+		select {
+		case out := <-b.Out:
+			if ev, ok := out.Metadata["tool_event"].(chat.ToolEvent); ok {
+				if out.ReplyTo != "a1" || out.Content != "" {
+					t.Fatalf("tool event outbound = %+v", out)
+				}
+				events = append(events, ev)
+			}
+			if out.Content == "All done!" {
+				if len(events) != 1 || events[0].Name != "message" || events[0].Error != "" {
+					t.Fatalf("tool events = %+v", events)
+				}
+				return
+			}
+		case <-ctx.Done():
+			t.Fatalf("timeout, tool events %+v", events)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package memory
+
+import (
+	"math"
+	"sort"
+)
+
+// BM25 parameters: k1 saturates repeated terms, b normalises by length.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// BM25Ranker scores memories with Okapi BM25 over the memories being
+// ranked: query terms that are rare among them weigh more, and matches in
+// long memories less. Memories without a query term keep their order, most
+// recent first, after those that match.
+type BM25Ranker struct{}
+
+func NewBM25Ranker() *BM25Ranker { return &BM25Ranker{} }
+
+func (r *BM25Ranker) Rank(query string, memories []MemoryItem, top int) []MemoryItem {
+	scores := bm25Scores(query, memories)
+	return topByScore(memories, scores, top)
+}
+
+// bm25Scores returns the BM25 score of each memory for query.
+func bm25Scores(query string, memories []MemoryItem) []float64 {
+	scores := make([]float64, len(memories))
+	if len(memories) == 0 {
+		return scores
+	}
+	docs := make([]map[string]int, len(memories))
+	lengths := make([]int, len(memories))
+	df := make(map[string]int)
+	total := 0
+	for i, m := range memories {
+		tf := make(map[string]int)
+		for _, t := range tokenize(m.Text) {
+			tf[t]++
+			lengths[i]++
+		}
+		for t := range tf {
+			df[t]++
+		}
+		docs[i] = tf
+		total += lengths[i]
+	}
+	avgLen := float64(total) / float64(len(memories))
+	if avgLen == 0 {
+		avgLen = 1
+	}
+	n := float64(len(memories))
+
+	seen := make(map[string]bool)
+	for _, q := range tokenize(query) {
+		if seen[q] || df[q] == 0 {
+			continue
+		}
+		seen[q] = true
+		idf := math.Log(1 + (n-float64(df[q])+0.5)/(float64(df[q])+0.5))
+		for i, tf := range docs {
+			f := float64(tf[q])
+			if f == 0 {
+				continue
+			}
+			norm := 1 - bm25B + bm25B*float64(lengths[i])/avgLen
+			scores[i] += idf * f * (bm25K1 + 1) / (f + bm25K1*norm)
+		}
+	}
+	return scores
+}
+
+// topByScore returns the top memories by score, the more recent first
+// among equal scores (memories are stored oldest first).
+func topByScore(memories []MemoryItem, scores []float64, top int) []MemoryItem {
+	if top <= 0 || top > len(memories) {
+		top = len(memories)
+	}
+	order := make([]int, len(memories))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		if scores[order[i]] != scores[order[j]] {
+			return scores[order[i]] > scores[order[j]]
+		}
+		return order[i] > order[j]
+	})
+	out := make([]MemoryItem, 0, top)
+	for _, i := range order[:top] {
+		out = append(out, memories[i])
+	}
+	return out
+}
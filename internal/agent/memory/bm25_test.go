@@ -0,0 +1,24 @@
+package memory
+
+import "testing"
+
+func TestBM25RankerWeighsRareTerms(t *testing.T) {
+	mems := []MemoryItem{
+		{Text: "the dentist appointment is on tuesday"},
+		{Text: "the cat likes the garden and the sun and the sofa"},
+		{Text: "the car needs new tyres"},
+		{Text: "the cat is allergic to fish"},
+	}
+	// "the" is in every memory and weighs nothing; "cat" ranks the shorter
+	// memory first; the rest keep recency order.
+	got := NewBM25Ranker().Rank("the cat", mems, 0)
+	want := []string{mems[3].Text, mems[1].Text, mems[2].Text, mems[0].Text}
+	for i := range want {
+		if got[i].Text != want[i] {
+			t.Fatalf("rank %d = %q, want %q (all: %v)", i, got[i].Text, want[i], got)
+		}
+	}
+	if top := NewBM25Ranker().Rank("dentist tuesday", mems, 1); len(top) != 1 || top[0].Text != mems[0].Text {
+		t.Fatalf("top 1 = %v", top)
+	}
+}
@@ -0,0 +1,189 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/local/picobot/internal/useragent"
+)
+
+const (
+	// defaultEmbeddingModel is the embedding model of the OpenAI API.
+	defaultEmbeddingModel = "text-embedding-3-small"
+	// embedTimeout bounds the embedding of one query and its memories.
+	embedTimeout = 20 * time.Second
+	// embedCacheSize caps the memory embeddings kept between queries.
+	embedCacheSize = 5000
+)
+
+// Embedder turns texts into embedding vectors, one per text, in order.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float64, error)
+}
+
+// OpenAIEmbedder embeds through an OpenAI-compatible /embeddings endpoint:
+// OpenAI itself, OpenRouter, or a local server such as Ollama.
+type OpenAIEmbedder struct {
+	APIBase string
+	APIKey  string
+	Model   string
+	client  *http.Client
+}
+
+// NewOpenAIEmbedder returns an embedder for the API at apiBase (default
+// OpenAI) using model (default text-embedding-3-small).
+func NewOpenAIEmbedder(apiBase, apiKey, model string) *OpenAIEmbedder {
+	if apiBase == "" {
+		apiBase = "https://api.openai.com/v1"
+	}
+	if model == "" {
+		model = defaultEmbeddingModel
+	}
+	return &OpenAIEmbedder{APIBase: strings.TrimRight(apiBase, "/"), APIKey: apiKey, Model: model, client: useragent.Client(embedTimeout)}
+}
+
+// Embed returns the embeddings of texts, requested in one call.
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	b, err := json.Marshal(map[string]interface{}{"model": e.Model, "input": texts})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", e.APIBase+"/embeddings", bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.APIKey)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embed: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var out struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return nil, fmt.Errorf("embed: %w", err)
+	}
+	vectors := make([][]float64, len(texts))
+	for _, d := range out.Data {
+		if d.Index >= 0 && d.Index < len(vectors) {
+			vectors[d.Index] = d.Embedding
+		}
+	}
+	for i, v := range vectors {
+		if len(v) == 0 {
+			return nil, fmt.Errorf("embed: no embedding for input %d", i)
+		}
+	}
+	return vectors, nil
+}
+
+// EmbeddingRanker ranks memories by the cosine similarity of their
+// embeddings with the query's, so that memories phrased differently from
+// the query are still found. Memory embeddings are cached by text. It falls
+// back to BM25 when the embedder fails.
+type EmbeddingRanker struct {
+	embedder Embedder
+	fallback *BM25Ranker
+
+	mu    sync.Mutex
+	cache map[string][]float64
+}
+
+func NewEmbeddingRanker(e Embedder) *EmbeddingRanker {
+	return &EmbeddingRanker{embedder: e, fallback: NewBM25Ranker(), cache: make(map[string][]float64)}
+}
+
+func (r *EmbeddingRanker) Rank(query string, memories []MemoryItem, top int) []MemoryItem {
+	scores, err := r.scores(query, memories)
+	if err != nil {
+		log.Printf("EmbeddingRanker: %v; ranking with BM25", err)
+		return r.fallback.Rank(query, memories, top)
+	}
+	return topByScore(memories, scores, top)
+}
+
+// scores returns the similarity of each memory with query, embedding the
+// query and the memories not cached yet.
+func (r *EmbeddingRanker) scores(query string, memories []MemoryItem) ([]float64, error) {
+	if strings.TrimSpace(query) == "" || len(memories) == 0 {
+		return make([]float64, len(memories)), nil
+	}
+	texts := []string{query}
+	r.mu.Lock()
+	for _, m := range memories {
+		if _, ok := r.cache[m.Text]; !ok {
+			texts = append(texts, m.Text)
+		}
+	}
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), embedTimeout)
+	defer cancel()
+	vectors, err := r.embedder.Embed(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("embed: %d embeddings for %d texts", len(vectors), len(texts))
+	}
+
+	fresh := make(map[string][]float64, len(texts)-1)
+	for i, t := range texts[1:] {
+		fresh[t] = vectors[i+1]
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	scores := make([]float64, len(memories))
+	for i, m := range memories {
+		v, ok := fresh[m.Text]
+		if !ok {
+			v = r.cache[m.Text]
+		}
+		scores[i] = cosine(vectors[0], v)
+	}
+	if len(r.cache)+len(fresh) > embedCacheSize {
+		r.cache = make(map[string][]float64)
+	}
+	for t, v := range fresh {
+		r.cache[t] = v
+	}
+	return scores, nil
+}
+
+// cosine returns the cosine similarity of a and b, 0 when either is empty
+// or their lengths differ.
+func cosine(a, b []float64) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
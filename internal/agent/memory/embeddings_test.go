@@ -0,0 +1,97 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// topicEmbedder embeds texts on two axes, food and travel, counting the
+// words of each topic.
+type topicEmbedder struct {
+	calls  int
+	inputs []string
+	err    error
+}
+
+func (e *topicEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	e.calls++
+	e.inputs = append(e.inputs, texts...)
+	if e.err != nil {
+		return nil, e.err
+	}
+	var out [][]float64
+	for _, t := range texts {
+		v := []float64{0.01, 0.01}
+		for _, w := range tokenize(t) {
+			switch w {
+			case "pizza", "dinner", "hungry", "restaurant":
+				v[0]++
+			case "flight", "hotel", "trip", "lisbon":
+				v[1]++
+			}
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func TestEmbeddingRanker(t *testing.T) {
+	mems := []MemoryItem{
+		{Text: "booked the hotel in lisbon"},
+		{Text: "favourite restaurant serves pizza"},
+		{Text: "flight leaves at 9"},
+	}
+	e := &topicEmbedder{}
+	r := NewEmbeddingRanker(e)
+	// No words in common with the query, but the same topic.
+	got := r.Rank("I'm hungry, where to have dinner?", mems, 1)
+	if len(got) != 1 || got[0].Text != mems[1].Text {
+		t.Fatalf("top = %v", got)
+	}
+	got = r.Rank("what about the trip?", mems, 2)
+	if got[0].Text != mems[2].Text || got[1].Text != mems[0].Text {
+		t.Fatalf("travel = %v", got)
+	}
+	// Memories are embedded once; later queries embed only themselves.
+	if e.calls != 2 || len(e.inputs) != 5 {
+		t.Fatalf("%d calls embedding %v", e.calls, e.inputs)
+	}
+
+	// A failing embedder falls back to BM25.
+	r = NewEmbeddingRanker(&topicEmbedder{err: errors.New("down")})
+	if got := r.Rank("pizza", mems, 1); got[0].Text != mems[1].Text {
+		t.Fatalf("fallback = %v", got)
+	}
+}
+
+func TestOpenAIEmbedder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if r.URL.Path != "/v1/embeddings" || r.Header.Get("Authorization") != "Bearer k" || body.Model != "nomic-embed-text" {
+			t.Errorf("request %s %q %+v", r.URL.Path, r.Header.Get("Authorization"), body)
+		}
+		// Out of order, as the API allows.
+		w.Write([]byte(`{"data":[{"index":1,"embedding":[0,1]},{"index":0,"embedding":[1,0]}]}`))
+	}))
+	defer srv.Close()
+
+	got, err := NewOpenAIEmbedder(srv.URL+"/v1/", "k", "nomic-embed-text").Embed(context.Background(), []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0][0] != 1 || got[1][1] != 1 {
+		t.Fatalf("embeddings = %v", got)
+	}
+	if _, err := NewOpenAIEmbedder(srv.URL+"/v1", "k", "nomic-embed-text").Embed(context.Background(), []string{"a", "b", "c"}); err == nil || !strings.Contains(err.Error(), "input 2") {
+		t.Fatalf("missing embedding: err = %v", err)
+	}
+}
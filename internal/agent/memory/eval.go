@@ -0,0 +1,65 @@
+package memory
+
+import "strings"
+
+// EvalCase is a query and the memories relevant to it, each given by a
+// piece of its text (matched case-insensitively).
+type EvalCase struct {
+	Query    string   `json:"query"`
+	Relevant []string `json:"relevant"`
+}
+
+// EvalResult measures a ranker over a set of cases: the mean share of
+// relevant memories found in the top k (recall@k), and the mean reciprocal
+// rank of the first relevant one there (MRR@k, 0 when none is).
+type EvalResult struct {
+	Cases  int
+	Recall float64
+	MRR    float64
+}
+
+// Evaluate ranks memories for each case with r and measures the results.
+// Cases whose relevant memories are not among memories are skipped.
+func Evaluate(r Ranker, memories []MemoryItem, cases []EvalCase, k int) EvalResult {
+	var res EvalResult
+	for _, c := range cases {
+		relevant := 0
+		for _, m := range memories {
+			if isRelevant(m, c) {
+				relevant++
+			}
+		}
+		if relevant == 0 {
+			continue
+		}
+		res.Cases++
+		found, first := 0, 0
+		for i, m := range r.Rank(c.Query, memories, k) {
+			if isRelevant(m, c) {
+				found++
+				if first == 0 {
+					first = i + 1
+				}
+			}
+		}
+		res.Recall += float64(found) / float64(relevant)
+		if first > 0 {
+			res.MRR += 1 / float64(first)
+		}
+	}
+	if res.Cases > 0 {
+		res.Recall /= float64(res.Cases)
+		res.MRR /= float64(res.Cases)
+	}
+	return res
+}
+
+func isRelevant(m MemoryItem, c EvalCase) bool {
+	text := strings.ToLower(m.Text)
+	for _, r := range c.Relevant {
+		if r != "" && strings.Contains(text, strings.ToLower(r)) {
+			return true
+		}
+	}
+	return false
+}
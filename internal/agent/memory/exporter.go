@@ -0,0 +1,146 @@
+package memory
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// vaultFolder is the folder picobot owns inside an Obsidian vault. Nothing
+// outside it is touched.
+const vaultFolder = "Picobot"
+
+// SetExportVault enables continuous export: after every memory write, the
+// changed notes are mirrored into vault (see ExportVault). An empty path
+// disables it.
+func (s *MemoryStore) SetExportVault(vault string) {
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+	s.exportVault = vault
+}
+
+// exportAfterWrite mirrors today's note and long-term memory into the export
+// vault, if one is set. Called with fileMu held; failures are only logged so
+// they never fail the write itself.
+func (s *MemoryStore) exportAfterWrite() {
+	if s.exportVault == "" {
+		return
+	}
+	if err := s.exportNotes(s.exportVault, []string{time.Now().UTC().Format("2006-01-02")}); err != nil {
+		log.Printf("memory: vault export failed: %v", err)
+	}
+}
+
+// ExportVault writes long-term memory and every daily note into
+// <vault>/Picobot/ as Obsidian notes: frontmatter tags, wiki-links between
+// days and to the long-term memory note, and an index note. It returns the
+// number of daily notes exported.
+func (s *MemoryStore) ExportVault(vault string) (int, error) {
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+	days, err := s.dailyNoteDates()
+	if err != nil {
+		return 0, err
+	}
+	return len(days), s.exportNotes(vault, days)
+}
+
+// dailyNoteDates lists the dates (YYYY-MM-DD) of the daily notes, oldest first.
+func (s *MemoryStore) dailyNoteDates() ([]string, error) {
+	entries, err := os.ReadDir(s.memoryDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var days []string
+	for _, e := range entries {
+		day := strings.TrimSuffix(e.Name(), ".md")
+		if _, err := time.Parse("2006-01-02", day); err == nil && !e.IsDir() {
+			days = append(days, day)
+		}
+	}
+	sort.Strings(days)
+	return days, nil
+}
+
+// exportNotes writes the long-term memory note, the index and the daily notes
+// for the given days.
+func (s *MemoryStore) exportNotes(vault string, days []string) error {
+	root := filepath.Join(vault, vaultFolder)
+	if err := os.MkdirAll(filepath.Join(root, "Daily"), 0o755); err != nil {
+		return err
+	}
+	all, err := s.dailyNoteDates()
+	if err != nil {
+		return err
+	}
+
+	lt, err := s.ReadLongTerm()
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	b.WriteString("---\ntags: [picobot, memory]\n---\n\n# Long-term memory\n\n")
+	b.WriteString(strings.TrimSpace(lt))
+	b.WriteString("\n")
+	if err := os.WriteFile(filepath.Join(root, "Memory.md"), []byte(b.String()), 0o644); err != nil {
+		return err
+	}
+
+	b.Reset()
+	b.WriteString("---\ntags: [picobot]\n---\n\n# Picobot\n\n")
+	b.WriteString("- [[" + vaultFolder + "/Memory|Long-term memory]]\n\n## Daily notes\n\n")
+	for i := len(all) - 1; i >= 0; i-- {
+		fmt.Fprintf(&b, "- %s\n", dailyLink(all[i]))
+	}
+	if err := os.WriteFile(filepath.Join(root, "Picobot.md"), []byte(b.String()), 0o644); err != nil {
+		return err
+	}
+
+	for _, day := range days {
+		raw, err := os.ReadFile(filepath.Join(s.memoryDir, day+".md"))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		b.Reset()
+		fmt.Fprintf(&b, "---\ndate: %s\ntags: [picobot, daily]\n---\n\n", day)
+		nav := []string{"[[" + vaultFolder + "/Memory|Memory]]"}
+		if i := sort.SearchStrings(all, day); i > 0 {
+			nav = append([]string{"← " + dailyLink(all[i-1])}, nav...)
+		}
+		b.WriteString(strings.Join(nav, " · ") + "\n\n")
+		for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				b.WriteString("- " + exportEntry(line) + "\n")
+			}
+		}
+		if err := os.WriteFile(filepath.Join(root, "Daily", day+".md"), []byte(b.String()), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dailyLink is a wiki-link to an exported daily note. Links use the full path
+// so they cannot collide with the user's own daily notes.
+func dailyLink(day string) string {
+	return "[[" + vaultFolder + "/Daily/" + day + "|" + day + "]]"
+}
+
+// exportEntry turns a daily note line "[<RFC3339>] text" into "HH:MM text".
+func exportEntry(line string) string {
+	if strings.HasPrefix(line, "[") {
+		if end := strings.Index(line, "] "); end > 0 {
+			if ts, err := time.Parse(time.RFC3339, line[1:end]); err == nil {
+				return ts.UTC().Format("15:04") + " " + line[end+2:]
+			}
+		}
+	}
+	return line
+}
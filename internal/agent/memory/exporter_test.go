@@ -0,0 +1,51 @@
+package memory
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportVault(t *testing.T) {
+	ws := t.TempDir()
+	s := NewMemoryStoreWithWorkspace(ws, 10)
+	os.WriteFile(filepath.Join(ws, "memory", "2026-01-01.md"), []byte("[2026-01-01T09:30:00Z] Bought #groceries\n"), 0o644)
+	os.WriteFile(filepath.Join(ws, "memory", "2026-01-02.md"), []byte("[2026-01-02T18:00:00Z] Gym\n"), 0o644)
+	if err := s.WriteLongTerm("Likes green tea"); err != nil {
+		t.Fatal(err)
+	}
+
+	vault := t.TempDir()
+	n, err := s.ExportVault(vault)
+	if err != nil || n != 2 {
+		t.Fatalf("ExportVault: %d %v", n, err)
+	}
+	day, _ := os.ReadFile(filepath.Join(vault, "Picobot", "Daily", "2026-01-02.md"))
+	for _, want := range []string{"tags: [picobot, daily]", "← [[Picobot/Daily/2026-01-01|2026-01-01]]", "[[Picobot/Memory|Memory]]", "- 18:00 Gym"} {
+		if !strings.Contains(string(day), want) {
+			t.Fatalf("daily note missing %q:\n%s", want, day)
+		}
+	}
+	lt, _ := os.ReadFile(filepath.Join(vault, "Picobot", "Memory.md"))
+	if !strings.Contains(string(lt), "Likes green tea") {
+		t.Fatalf("unexpected long-term note:\n%s", lt)
+	}
+	index, _ := os.ReadFile(filepath.Join(vault, "Picobot", "Picobot.md"))
+	if !strings.Contains(string(index), "[[Picobot/Daily/2026-01-01|2026-01-01]]") {
+		t.Fatalf("index does not link the daily notes:\n%s", index)
+	}
+}
+
+func TestContinuousVaultExport(t *testing.T) {
+	s := NewMemoryStoreWithWorkspace(t.TempDir(), 10)
+	vault := t.TempDir()
+	s.SetExportVault(vault)
+	if err := s.AppendLongTerm("Allergic to peanuts"); err != nil {
+		t.Fatal(err)
+	}
+	lt, err := os.ReadFile(filepath.Join(vault, "Picobot", "Memory.md"))
+	if err != nil || !strings.Contains(string(lt), "Allergic to peanuts") {
+		t.Fatalf("long-term memory was not mirrored: %q %v", lt, err)
+	}
+}
@@ -0,0 +1,35 @@
+package memory
+
+// rrfK damps the weight of the first ranks in reciprocal rank fusion; 60 is
+// the value of the original paper and works well without tuning.
+const rrfK = 60
+
+// HybridRanker fuses the rankings of several rankers by reciprocal rank
+// fusion: a memory scores the sum of 1/(60+rank) over the rankers, so those
+// ranked well by all of them come first. It needs no score normalisation,
+// which makes BM25 and embedding similarities easy to combine.
+type HybridRanker struct {
+	rankers []Ranker
+}
+
+func NewHybridRanker(rankers ...Ranker) *HybridRanker {
+	return &HybridRanker{rankers: rankers}
+}
+
+func (r *HybridRanker) Rank(query string, memories []MemoryItem, top int) []MemoryItem {
+	scores := make([]float64, len(memories))
+	for _, ranker := range r.rankers {
+		// Identical memories are matched back to their indices in order.
+		indices := make(map[MemoryItem][]int, len(memories))
+		for i, m := range memories {
+			indices[m] = append(indices[m], i)
+		}
+		for rank, m := range ranker.Rank(query, memories, len(memories)) {
+			if idx := indices[m]; len(idx) > 0 {
+				scores[idx[0]] += 1 / float64(rrfK+rank+1)
+				indices[m] = idx[1:]
+			}
+		}
+	}
+	return topByScore(memories, scores, top)
+}
@@ -0,0 +1,73 @@
+package memory
+
+import (
+	"math"
+	"testing"
+
+	"github.com/local/picobot/internal/config"
+)
+
+func TestHybridRankerFusesRankings(t *testing.T) {
+	mems := []MemoryItem{
+		{Text: "pizza dough needs a day to rise"},
+		{Text: "the restaurant on main street is closed on mondays"},
+		{Text: "dinner with ana on friday at the pizza place"},
+		{Text: "renew the passport"},
+	}
+	// BM25 only sees "pizza"; embeddings also favour the dinner memory.
+	r := NewHybridRanker(NewBM25Ranker(), NewEmbeddingRanker(&topicEmbedder{}))
+	got := r.Rank("pizza dinner", mems, 2)
+	if got[0].Text != mems[2].Text || got[1].Text != mems[0].Text {
+		t.Fatalf("hybrid = %v", got)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	mems := []MemoryItem{
+		{Text: "dentist on tuesday"},
+		{Text: "dentist moved to wednesday"},
+		{Text: "buy milk"},
+	}
+	cases := []EvalCase{
+		{Query: "when is the dentist", Relevant: []string{"DENTIST"}},
+		{Query: "milk", Relevant: []string{"milk"}},
+		{Query: "anything", Relevant: []string{"not a memory"}}, // skipped
+	}
+	res := Evaluate(NewBM25Ranker(), mems, cases, 1)
+	// The dentist case finds one of two memories at rank 1; milk is found.
+	if res.Cases != 2 || math.Abs(res.Recall-0.75) > 1e-9 || res.MRR != 1 {
+		t.Fatalf("result = %+v", res)
+	}
+}
+
+func TestNewRanker(t *testing.T) {
+	var cfg config.Config
+	cfg.Memory.Ranker = "hybrid"
+	cfg.Memory.APIKey = "k"
+	r, err := NewRanker("", cfg, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, ok := r.(*HybridRanker)
+	if !ok || len(h.rankers) != 2 {
+		t.Fatalf("ranker = %#v", r)
+	}
+	if e := h.rankers[1].(*EmbeddingRanker).embedder.(*OpenAIEmbedder); e.APIKey != "k" || e.Model != defaultEmbeddingModel || e.APIBase != "https://api.openai.com/v1" {
+		t.Fatalf("embedder = %+v", e)
+	}
+	if _, ok := mustRanker(t, "bm25", cfg).(*BM25Ranker); !ok {
+		t.Fatal("bm25 flag did not override the config")
+	}
+	if _, err := NewRanker("tfidf", cfg, nil, ""); err == nil {
+		t.Fatal("unknown ranker accepted")
+	}
+}
+
+func mustRanker(t *testing.T, name string, cfg config.Config) Ranker {
+	t.Helper()
+	r, err := NewRanker(name, cfg, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
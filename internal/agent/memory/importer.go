@@ -0,0 +1,480 @@
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ImportedNote is one piece of external content brought into memory by
+// `picobot memory import`.
+type ImportedNote struct {
+	Title  string
+	Origin string   // where it came from, e.g. the note's path in the vault
+	Tags   []string // without the leading '#'
+	Text   string
+}
+
+// ImportChunkSize is the maximum size (in bytes) of an imported note's text;
+// longer notes are split so each chunk stays cheap to put in the prompt.
+const ImportChunkSize = 1500
+
+var (
+	wikiLinkRE  = regexp.MustCompile(`\[\[([^\]|#]+)(?:#[^\]|]*)?(?:\|([^\]]+))?\]\]`)
+	inlineTagRE = regexp.MustCompile(`(?:^|\s)#([\p{L}\p{N}_/-]*\p{L}[\p{L}\p{N}_/-]*)`)
+)
+
+// ImportMarkdownDir reads every .md file under dir. With obsidian set, wiki
+// links ([[Note|alias]]) are reduced to their text and the .obsidian settings
+// folder is skipped. Tags come from the frontmatter "tags" field and inline
+// #tags.
+func ImportMarkdownDir(dir string, obsidian bool) ([]ImportedNote, error) {
+	var notes []ImportedNote
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir // .obsidian, .git, .trash
+			}
+			return nil
+		}
+		if !strings.EqualFold(filepath.Ext(path), ".md") {
+			return nil
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		front, body := splitFrontmatter(string(b))
+		n := ImportedNote{
+			Title:  strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+			Origin: filepath.ToSlash(rel),
+			Tags:   frontmatterTags(front),
+			Text:   strings.TrimSpace(body),
+		}
+		if obsidian {
+			n.Text = wikiLinkRE.ReplaceAllStringFunc(n.Text, func(m string) string {
+				sub := wikiLinkRE.FindStringSubmatch(m)
+				if sub[2] != "" {
+					return sub[2]
+				}
+				return sub[1]
+			})
+		}
+		for _, m := range inlineTagRE.FindAllStringSubmatch(n.Text, -1) {
+			n.Tags = append(n.Tags, m[1])
+		}
+		n.Tags = uniqueStrings(n.Tags)
+		if n.Text != "" {
+			notes = append(notes, n)
+		}
+		return nil
+	})
+	return notes, err
+}
+
+// splitFrontmatter separates a leading "---" YAML block from the body.
+func splitFrontmatter(s string) (front, body string) {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	if !strings.HasPrefix(s, "---\n") {
+		return "", s
+	}
+	end := strings.Index(s[4:], "\n---")
+	if end < 0 {
+		return "", s
+	}
+	rest := s[4+end+4:]
+	return s[4 : 4+end], strings.TrimPrefix(rest, "\n")
+}
+
+// frontmatterTags reads the "tags" field of a frontmatter block, in either the
+// inline ([a, b] or "a b") or the list ("- a") form.
+func frontmatterTags(front string) []string {
+	var tags []string
+	inList := false
+	for _, line := range strings.Split(front, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if inList {
+			if strings.HasPrefix(trimmed, "- ") {
+				tags = append(tags, strings.Trim(strings.TrimSpace(trimmed[2:]), `"'#`))
+				continue
+			}
+			inList = false
+		}
+		key, val, ok := strings.Cut(trimmed, ":")
+		if !ok || (key != "tags" && key != "tag") {
+			continue
+		}
+		val = strings.TrimSpace(val)
+		if val == "" {
+			inList = true
+			continue
+		}
+		val = strings.Trim(val, "[]")
+		for _, t := range strings.FieldsFunc(val, func(r rune) bool { return r == ',' || r == ' ' }) {
+			if t = strings.Trim(t, `"'#`); t != "" {
+				tags = append(tags, t)
+			}
+		}
+	}
+	return tags
+}
+
+// chatGPTConversation is the subset of a conversations.json entry (ChatGPT
+// data export) that the importer reads.
+type chatGPTConversation struct {
+	Title      string  `json:"title"`
+	CreateTime float64 `json:"create_time"`
+	Mapping    map[string]struct {
+		Message *struct {
+			Author struct {
+				Role string `json:"role"`
+			} `json:"author"`
+			CreateTime float64 `json:"create_time"`
+			Content    struct {
+				ContentType string        `json:"content_type"`
+				Parts       []interface{} `json:"parts"`
+			} `json:"content"`
+		} `json:"message"`
+	} `json:"mapping"`
+}
+
+// ImportChatGPT reads a ChatGPT export (conversations.json). Each
+// conversation becomes a note holding its user and assistant turns in order.
+func ImportChatGPT(path string) ([]ImportedNote, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var convs []chatGPTConversation
+	if err := json.Unmarshal(b, &convs); err != nil {
+		return nil, fmt.Errorf("%s: not a ChatGPT conversations export: %w", path, err)
+	}
+	var notes []ImportedNote
+	for _, c := range convs {
+		type turn struct {
+			at   float64
+			text string
+		}
+		var turns []turn
+		for _, node := range c.Mapping {
+			m := node.Message
+			if m == nil || (m.Author.Role != "user" && m.Author.Role != "assistant") || m.Content.ContentType != "text" {
+				continue
+			}
+			var parts []string
+			for _, p := range m.Content.Parts {
+				if s, ok := p.(string); ok && strings.TrimSpace(s) != "" {
+					parts = append(parts, strings.TrimSpace(s))
+				}
+			}
+			if len(parts) > 0 {
+				turns = append(turns, turn{m.CreateTime, m.Author.Role + ": " + strings.Join(parts, "\n")})
+			}
+		}
+		if len(turns) == 0 {
+			continue
+		}
+		sort.SliceStable(turns, func(i, j int) bool { return turns[i].at < turns[j].at })
+		texts := make([]string, len(turns))
+		for i, t := range turns {
+			texts[i] = t.text
+		}
+		title := c.Title
+		if title == "" {
+			title = "Untitled conversation"
+		}
+		origin := "chatgpt"
+		if c.CreateTime > 0 {
+			origin += " " + time.Unix(int64(c.CreateTime), 0).UTC().Format("2006-01-02")
+		}
+		notes = append(notes, ImportedNote{Title: title, Origin: origin, Tags: []string{"chatgpt"}, Text: strings.Join(texts, "\n\n")})
+	}
+	return notes, nil
+}
+
+// ChunkNotes splits notes longer than size at paragraph (or, failing that,
+// line) boundaries. Chunks of one note share its tags and get "(i/n)" appended
+// to the title.
+func ChunkNotes(notes []ImportedNote, size int) []ImportedNote {
+	var out []ImportedNote
+	for _, n := range notes {
+		chunks := chunkText(n.Text, size)
+		if len(chunks) == 1 {
+			out = append(out, n)
+			continue
+		}
+		for i, c := range chunks {
+			part := n
+			part.Title = fmt.Sprintf("%s (%d/%d)", n.Title, i+1, len(chunks))
+			part.Text = c
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func chunkText(s string, size int) []string {
+	if len(s) <= size {
+		return []string{s}
+	}
+	var chunks []string
+	cur := ""
+	add := func(piece, sep string) {
+		if cur != "" && len(cur)+len(sep)+len(piece) > size {
+			chunks = append(chunks, cur)
+			cur = ""
+		}
+		if cur != "" {
+			cur += sep
+		}
+		cur += piece
+	}
+	for _, para := range strings.Split(s, "\n\n") {
+		if len(para) <= size {
+			add(para, "\n\n")
+			continue
+		}
+		for _, line := range strings.Split(para, "\n") {
+			for len(line) > size {
+				cut := strings.LastIndex(line[:size], " ")
+				if cut <= 0 {
+					cut = size
+					for cut > 0 && !utf8.RuneStart(line[cut]) {
+						cut--
+					}
+				}
+				add(line[:cut], "\n")
+				line = strings.TrimSpace(line[cut:])
+			}
+			add(line, "\n")
+		}
+	}
+	if cur != "" {
+		chunks = append(chunks, cur)
+	}
+	return chunks
+}
+
+func uniqueStrings(in []string) []string {
+	seen := make(map[string]bool, len(in))
+	out := in[:0]
+	for _, s := range in {
+		if s != "" && !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// importedDir is where imported notes live, one folder per source.
+func (s *MemoryStore) importedDir() string {
+	return filepath.Join(s.memoryDir, "imported")
+}
+
+// SaveImported writes notes under memory/imported/<source>/, one Markdown
+// file per note with its title, origin and tags in the frontmatter. A previous
+// import with the same source name is replaced. It returns the number of
+// files written.
+func (s *MemoryStore) SaveImported(source string, notes []ImportedNote) (int, error) {
+	source = slugify(source)
+	if source == "" {
+		return 0, fmt.Errorf("import source name required")
+	}
+	dir := filepath.Join(s.importedDir(), source)
+	if err := os.RemoveAll(dir); err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, err
+	}
+	used := map[string]int{}
+	for _, n := range notes {
+		name := slugify(n.Title)
+		if name == "" {
+			name = "note"
+		}
+		if used[name]++; used[name] > 1 {
+			name = fmt.Sprintf("%s-%d", name, used[name])
+		}
+		if err := os.WriteFile(filepath.Join(dir, name+".md"), []byte(importedFile(source, n)), 0o644); err != nil {
+			return 0, err
+		}
+	}
+	s.mu.Lock()
+	s.imported = nil // reload on next search
+	s.mu.Unlock()
+	return len(notes), nil
+}
+
+// AddImported writes notes under memory/imported/<source>/ like
+// SaveImported, but keeps the notes already there, so a source can grow one
+// note at a time. It returns the files written, relative to the memory folder.
+func (s *MemoryStore) AddImported(source string, notes []ImportedNote) ([]string, error) {
+	source = slugify(source)
+	if source == "" {
+		return nil, fmt.Errorf("import source name required")
+	}
+	dir := filepath.Join(s.importedDir(), source)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, n := range notes {
+		base := slugify(n.Title)
+		if base == "" {
+			base = "note"
+		}
+		name := base
+		for i := 2; ; i++ {
+			if _, err := os.Stat(filepath.Join(dir, name+".md")); os.IsNotExist(err) {
+				break
+			}
+			name = fmt.Sprintf("%s-%d", base, i)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name+".md"), []byte(importedFile(source, n)), 0o644); err != nil {
+			return files, err
+		}
+		files = append(files, filepath.Join("imported", source, name+".md"))
+	}
+	s.mu.Lock()
+	s.imported = nil // reload on next search
+	s.mu.Unlock()
+	return files, nil
+}
+
+// importedFile renders an imported note as Markdown with its title, origin
+// and tags in the frontmatter.
+func importedFile(source string, n ImportedNote) string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "title: %q\n", n.Title)
+	fmt.Fprintf(&b, "source: %q\n", source+":"+n.Origin)
+	if len(n.Tags) > 0 {
+		fmt.Fprintf(&b, "tags: [%s]\n", strings.Join(n.Tags, ", "))
+	}
+	b.WriteString("---\n\n")
+	b.WriteString(n.Text)
+	b.WriteString("\n")
+	return b.String()
+}
+
+// importedReload is how long the imported notes stay cached before
+// SearchImported looks at the disk again (e.g. after a CLI import).
+const importedReload = time.Minute
+
+// SearchImported returns up to n imported notes sharing the most words with
+// query, as "imported" MemoryItems. It is a cheap pre-filter; the ranker
+// picks among its results.
+func (s *MemoryStore) SearchImported(query string, n int) []MemoryItem {
+	terms := searchTerms(query)
+	if len(terms) == 0 || n <= 0 {
+		return nil
+	}
+	items := s.loadImported()
+	type scored struct {
+		item  MemoryItem
+		score int
+	}
+	var hits []scored
+	for _, it := range items {
+		lower := strings.ToLower(it.Text)
+		score := 0
+		for _, t := range terms {
+			if strings.Contains(lower, t) {
+				score++
+			}
+		}
+		if score > 0 {
+			hits = append(hits, scored{it, score})
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].score > hits[j].score })
+	out := make([]MemoryItem, 0, min(n, len(hits)))
+	for i := 0; i < len(hits) && i < n; i++ {
+		out = append(out, hits[i].item)
+	}
+	return out
+}
+
+// loadImported returns the imported notes, reading them from disk when the
+// cache is empty or stale.
+func (s *MemoryStore) loadImported() []MemoryItem {
+	s.mu.RLock()
+	items, loaded := s.imported, s.importedAt
+	s.mu.RUnlock()
+	if items != nil && time.Since(loaded) < importedReload {
+		return items
+	}
+	items = []MemoryItem{}
+	_ = filepath.WalkDir(s.importedDir(), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".md" {
+			return nil
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		front, body := splitFrontmatter(string(b))
+		title := strings.TrimSuffix(filepath.Base(path), ".md")
+		for _, line := range strings.Split(front, "\n") {
+			if v, ok := strings.CutPrefix(line, "title: "); ok {
+				if t, err := strconv.Unquote(v); err == nil {
+					title = t
+				}
+			}
+		}
+		text := title
+		if tags := frontmatterTags(front); len(tags) > 0 {
+			text += " #" + strings.Join(tags, " #")
+		}
+		info, _ := d.Info()
+		item := MemoryItem{Kind: "imported", Text: text + ": " + strings.TrimSpace(body)}
+		if info != nil {
+			item.Timestamp = info.ModTime().UTC()
+		}
+		items = append(items, item)
+		return nil
+	})
+	s.mu.Lock()
+	s.imported, s.importedAt = items, time.Now()
+	s.mu.Unlock()
+	return items
+}
+
+// searchTerms lowercases query and keeps its words of three or more letters.
+func searchTerms(query string) []string {
+	var terms []string
+	for _, w := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		if utf8.RuneCountInString(w) >= 3 {
+			terms = append(terms, w)
+		}
+	}
+	return uniqueStrings(terms)
+}
+
+var slugRE = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// slugify turns s into a lowercase file name made of letters, digits and '-'.
+func slugify(s string) string {
+	s = strings.Trim(slugRE.ReplaceAllString(strings.ToLower(s), "-"), "-")
+	if r := []rune(s); len(r) > 80 {
+		s = strings.TrimRight(string(r[:80]), "-")
+	}
+	return s
+}
@@ -0,0 +1,88 @@
+package memory
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImportObsidianVault(t *testing.T) {
+	vault := t.TempDir()
+	os.MkdirAll(filepath.Join(vault, ".obsidian"), 0o755)
+	os.WriteFile(filepath.Join(vault, ".obsidian", "app.md"), []byte("settings"), 0o644)
+	os.MkdirAll(filepath.Join(vault, "Garden"), 0o755)
+	os.WriteFile(filepath.Join(vault, "Garden", "Tomatoes.md"), []byte("---\ntags:\n  - garden\n---\nWater the [[Tomato Plants|tomatoes]] daily. #summer\n"), 0o644)
+
+	notes, err := ImportMarkdownDir(vault, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) != 1 {
+		t.Fatalf("expected 1 note (settings skipped), got %+v", notes)
+	}
+	n := notes[0]
+	if n.Title != "Tomatoes" || n.Origin != "Garden/Tomatoes.md" || n.Text != "Water the tomatoes daily. #summer" {
+		t.Fatalf("unexpected note: %+v", n)
+	}
+	if strings.Join(n.Tags, ",") != "garden,summer" {
+		t.Fatalf("unexpected tags: %v", n.Tags)
+	}
+}
+
+func TestImportChatGPTExport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conversations.json")
+	os.WriteFile(path, []byte(`[{"title":"Sourdough","create_time":1700000000,"mapping":{
+		"b":{"message":{"author":{"role":"assistant"},"create_time":2,"content":{"content_type":"text","parts":["Feed it daily."]}}},
+		"a":{"message":{"author":{"role":"user"},"create_time":1,"content":{"content_type":"text","parts":["How do I keep a starter?"]}}},
+		"s":{"message":{"author":{"role":"system"},"create_time":0,"content":{"content_type":"text","parts":["hidden"]}}},
+		"r":{"message":null}}}]`), 0o644)
+
+	notes, err := ImportChatGPT(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) != 1 || notes[0].Title != "Sourdough" {
+		t.Fatalf("unexpected notes: %+v", notes)
+	}
+	if want := "user: How do I keep a starter?\n\nassistant: Feed it daily."; notes[0].Text != want {
+		t.Fatalf("got %q want %q", notes[0].Text, want)
+	}
+}
+
+func TestChunkNotes(t *testing.T) {
+	long := strings.Repeat("word ", 100) + "\n\n" + strings.Repeat("more ", 100)
+	chunks := ChunkNotes([]ImportedNote{{Title: "Big", Text: long}}, 600)
+	if len(chunks) != 2 || chunks[0].Title != "Big (1/2)" {
+		t.Fatalf("unexpected chunks: %d %q", len(chunks), chunks[0].Title)
+	}
+	for _, c := range chunks {
+		if len(c.Text) > 600 {
+			t.Fatalf("chunk too long: %d", len(c.Text))
+		}
+	}
+}
+
+func TestSaveAndSearchImported(t *testing.T) {
+	s := NewMemoryStoreWithWorkspace(t.TempDir(), 10)
+	notes := []ImportedNote{
+		{Title: "Tomatoes", Origin: "Garden/Tomatoes.md", Tags: []string{"garden"}, Text: "Water the tomatoes daily."},
+		{Title: "Taxes", Origin: "Money/Taxes.md", Text: "File by April."},
+	}
+	if n, err := s.SaveImported("obsidian-vault", notes); err != nil || n != 2 {
+		t.Fatalf("SaveImported: %d %v", n, err)
+	}
+
+	got := s.SearchImported("how often should I water my tomatoes?", 5)
+	if len(got) != 1 || got[0].Kind != "imported" || got[0].Text != "Tomatoes #garden: Water the tomatoes daily." {
+		t.Fatalf("unexpected search result: %+v", got)
+	}
+
+	// Re-importing under the same name replaces the previous import.
+	if _, err := s.SaveImported("obsidian-vault", notes[1:]); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.SearchImported("tomatoes", 5); len(got) != 0 {
+		t.Fatalf("expected the old import to be gone, got %+v", got)
+	}
+}
@@ -0,0 +1,48 @@
+package memory
+
+import (
+	"fmt"
+
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/providers"
+)
+
+// RankerNames are the rankers memory.ranker can name.
+var RankerNames = []string{"llm", "bm25", "embeddings", "hybrid", "simple"}
+
+// NewRanker returns the ranker called name, or the one configured in
+// memory.ranker when name is empty (default "llm", which asks provider with
+// model). Embeddings use memory's endpoint and key, defaulting to the OpenAI
+// provider's; "hybrid" fuses BM25 with them.
+func NewRanker(name string, cfg config.Config, provider providers.LLMProvider, model string) (Ranker, error) {
+	if name == "" {
+		name = cfg.Memory.Ranker
+	}
+	switch name {
+	case "", "llm":
+		return NewLLMRanker(provider, model), nil
+	case "bm25":
+		return NewBM25Ranker(), nil
+	case "simple":
+		return NewSimpleRanker(), nil
+	case "embeddings":
+		return NewEmbeddingRanker(embedderFromConfig(cfg)), nil
+	case "hybrid":
+		return NewHybridRanker(NewBM25Ranker(), NewEmbeddingRanker(embedderFromConfig(cfg))), nil
+	}
+	return nil, fmt.Errorf("unknown memory ranker %q (want one of %v)", name, RankerNames)
+}
+
+func embedderFromConfig(cfg config.Config) *OpenAIEmbedder {
+	m := cfg.Memory
+	apiBase, apiKey := m.APIBase, m.APIKey
+	if p := cfg.Providers.OpenAI; p != nil {
+		if apiBase == "" {
+			apiBase = p.APIBase
+		}
+		if apiKey == "" {
+			apiKey = p.APIKey
+		}
+	}
+	return NewOpenAIEmbedder(apiBase, apiKey, m.EmbeddingModel)
+}
@@ -28,6 +28,12 @@ type MemoryStore struct {
 	long      []MemoryItem
 	short     []MemoryItem
 	mu        sync.RWMutex
+	fileMu    sync.Mutex // serializes writes to the memory files
+
+	exportVault string // Obsidian vault mirrored after each write (guarded by fileMu)
+
+	imported   []MemoryItem // cached imported notes (see SearchImported)
+	importedAt time.Time
 }
 
 // NewMemoryStore creates an in-memory store with short-term limit (e.g., 100).
@@ -131,13 +137,55 @@ func (s *MemoryStore) ReadLongTerm() (string, error) {
 	return string(b), nil
 }
 
-// WriteLongTerm writes content to MEMORY.md (overwrites).
+// WriteLongTerm writes content to MEMORY.md (overwrites). The file is
+// replaced atomically, so readers never see a partial write.
 func (s *MemoryStore) WriteLongTerm(content string) error {
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+	if err := s.writeLongTerm(content); err != nil {
+		return err
+	}
+	s.exportAfterWrite()
+	return nil
+}
+
+// AppendLongTerm appends text to MEMORY.md on a new line. Reading and
+// rewriting happen under one lock, so concurrent appends (e.g. from two
+// chats) are never lost.
+func (s *MemoryStore) AppendLongTerm(text string) error {
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+	prev, err := s.ReadLongTerm()
+	if err != nil {
+		return err
+	}
+	if err := s.writeLongTerm(prev + "\n" + text); err != nil {
+		return err
+	}
+	s.exportAfterWrite()
+	return nil
+}
+
+func (s *MemoryStore) writeLongTerm(content string) error {
 	if err := os.MkdirAll(s.memoryDir, 0o755); err != nil {
 		return err
 	}
-	path := filepath.Join(s.memoryDir, "MEMORY.md")
-	return os.WriteFile(path, []byte(content), 0o644)
+	f, err := os.CreateTemp(s.memoryDir, ".MEMORY.md.*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // no-op once renamed
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(s.memoryDir, "MEMORY.md"))
 }
 
 // ReadToday reads today's memory note file (YYYY-MM-DD.md)
@@ -156,6 +204,8 @@ func (s *MemoryStore) ReadToday() (string, error) {
 
 // AppendToday appends a line (with timestamp) to today's memory note file.
 func (s *MemoryStore) AppendToday(text string) error {
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
 	if err := os.MkdirAll(s.memoryDir, 0o755); err != nil {
 		return err
 	}
@@ -165,9 +215,15 @@ func (s *MemoryStore) AppendToday(text string) error {
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 	_, err = fmt.Fprintf(f, "[%s] %s\n", time.Now().UTC().Format(time.RFC3339), text)
-	return err
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	s.exportAfterWrite()
+	return nil
 }
 
 // GetRecentMemories reads last N days' files and joins them with separators.
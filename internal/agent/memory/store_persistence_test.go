@@ -1,8 +1,11 @@
 package memory
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -58,3 +61,35 @@ func TestMemoryPersistence_ReadWriteLongAndToday(t *testing.T) {
 		t.Fatalf("expected memory context, got empty")
 	}
 }
+
+func TestMemoryPersistence_ConcurrentLongTermAppends(t *testing.T) {
+	tmp := t.TempDir()
+	s := NewMemoryStoreWithWorkspace(tmp, 10)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := s.AppendLongTerm(fmt.Sprintf("fact %d", i)); err != nil {
+				t.Errorf("AppendLongTerm error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	lt, _ := s.ReadLongTerm()
+	lines := map[string]bool{}
+	for _, l := range strings.Split(lt, "\n") {
+		lines[l] = true
+	}
+	for i := 0; i < 20; i++ {
+		if !lines[fmt.Sprintf("fact %d", i)] {
+			t.Fatalf("append %d was lost: %q", i, lt)
+		}
+	}
+	entries, _ := os.ReadDir(filepath.Join(tmp, "memory"))
+	if len(entries) != 1 {
+		t.Fatalf("expected only MEMORY.md, temp files left behind: %v", entries)
+	}
+}
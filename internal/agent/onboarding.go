@@ -0,0 +1,269 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+)
+
+// profilesFile holds the profiles collected by onboarding, in the
+// workspace, keyed by "channel:senderID".
+const profilesFile = "profiles.json"
+
+// defaultOnboardingSteps are asked when onboarding is enabled without steps.
+var defaultOnboardingSteps = []config.OnboardingStep{
+	{Field: "name", Question: "What should I call you?"},
+	{Field: "timezone", Question: "Which timezone are you in? An IANA name, e.g. America/Sao_Paulo or Europe/Lisbon."},
+	{Field: "language", Question: "Which language should I answer in?"},
+}
+
+// userProfile is what onboarding knows about a user. Step is the index of
+// the question awaiting an answer; Done is set once all are answered (or
+// the user was already talking to the bot when onboarding was enabled).
+type userProfile struct {
+	Fields  map[string]string `json:"fields,omitempty"`
+	Step    int               `json:"step"`
+	Done    bool              `json:"done"`
+	Pending string            `json:"pending,omitempty"` // first message, answered after onboarding
+}
+
+// SetOnboarding enables the onboarding sequence of new users.
+func (a *AgentLoop) SetOnboarding(cfg config.OnboardingConfig) {
+	if !cfg.Enabled {
+		a.onboarding = nil
+		return
+	}
+	if len(cfg.Steps) == 0 {
+		cfg.Steps = defaultOnboardingSteps
+	}
+	a.onboarding = &cfg
+}
+
+// profileCache keeps the profiles file as last read or written, so it is
+// not read and parsed again on every turn; it is read again when its
+// modification time or size changes, e.g. when edited by hand.
+type profileCache struct {
+	profiles map[string]*userProfile
+	modTime  time.Time
+	size     int64
+}
+
+// loadProfiles returns the profiles of the profiles file; a missing file
+// means no profiles. The caller holds profilesMu.
+func (a *AgentLoop) loadProfiles() (map[string]*userProfile, error) {
+	path := filepath.Join(a.workspace, profilesFile)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return make(map[string]*userProfile), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if a.profiles.profiles != nil && info.ModTime().Equal(a.profiles.modTime) && info.Size() == a.profiles.size {
+		return a.profiles.profiles, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	profiles := make(map[string]*userProfile)
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("%s: %w", profilesFile, err)
+	}
+	a.profiles = profileCache{profiles: profiles, modTime: info.ModTime(), size: info.Size()}
+	return profiles, nil
+}
+
+// saveProfiles writes profiles to the profiles file. The caller holds
+// profilesMu.
+func (a *AgentLoop) saveProfiles(profiles map[string]*userProfile) error {
+	data, err := json.MarshalIndent(profiles, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(a.workspace, profilesFile)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		a.profiles = profileCache{} // read it again next time
+		return err
+	}
+	a.profiles = profileCache{profiles: profiles}
+	if info, err := os.Stat(path); err == nil {
+		a.profiles.modTime, a.profiles.size = info.ModTime(), info.Size()
+	}
+	return nil
+}
+
+// onboard runs the onboarding state machine for msg. It returns the reply
+// to send and whether msg was consumed by onboarding. When the last answer
+// completes it, resume holds the user's first message, to be answered now.
+//
+// A user is onboarded on their first message in a direct chat, unless the
+// chat already has a conversation. Slash commands and quick actions are not
+// taken as answers, so /help and the like work during onboarding.
+func (a *AgentLoop) onboard(msg chat.Inbound) (reply string, consumed bool, resume string) {
+	if a.onboarding == nil || isSystemChannel(msg.Channel) || msg.Channel == "cli" || msg.SenderID == "" {
+		return "", false, ""
+	}
+	if !msg.IsDM() {
+		return "", false, ""
+	}
+	a.profilesMu.Lock()
+	defer a.profilesMu.Unlock()
+	profiles, err := a.loadProfiles()
+	if err != nil {
+		log.Printf("onboarding: %v", err)
+		return "", false, ""
+	}
+	key := msg.Channel + ":" + msg.SenderID
+	p := profiles[key]
+	steps := a.onboarding.Steps
+	switch {
+	case p == nil:
+		p = &userProfile{Fields: map[string]string{}}
+		profiles[key] = p
+		if a.hasConversation(msg.Channel + ":" + msg.ChatID) {
+			p.Done = true
+			a.saveOnboarding(profiles)
+			return "", false, ""
+		}
+		if !strings.HasPrefix(msg.Content, "/") {
+			p.Pending = msg.Content
+		}
+		reply = a.onboardingGreeting() + "\n\n" + steps[0].Question
+	case p.Done:
+		return "", false, ""
+	case strings.HasPrefix(msg.Content, "/") || strings.HasPrefix(msg.Content, "!"):
+		return "", false, ""
+	default:
+		step := steps[min(p.Step, len(steps)-1)]
+		answer := strings.TrimSpace(msg.Content)
+		if strings.EqualFold(answer, "skip") {
+			answer = ""
+		} else if problem := checkOnboardingAnswer(step.Field, answer); problem != "" {
+			return problem + "\n\n" + step.Question + " (or say skip)", true, ""
+		}
+		if answer != "" {
+			if p.Fields == nil {
+				p.Fields = map[string]string{}
+			}
+			p.Fields[step.Field] = answer
+		}
+		p.Step++
+		if p.Step < len(steps) {
+			reply = steps[p.Step].Question
+		} else {
+			p.Done = true
+			reply = "Thanks, all set! You can change these with /profile reset."
+			if name := p.Fields["name"]; name != "" {
+				reply = fmt.Sprintf("Thanks, %s, all set! You can change these with /profile reset.", name)
+			}
+			resume, p.Pending = p.Pending, ""
+		}
+	}
+	a.saveOnboarding(profiles)
+	return reply, true, resume
+}
+
+func (a *AgentLoop) saveOnboarding(profiles map[string]*userProfile) {
+	if err := a.saveProfiles(profiles); err != nil {
+		log.Printf("onboarding: saving %s: %v", profilesFile, err)
+	}
+}
+
+// hasConversation reports whether the chat key already has a session, i.e.
+// the user was talking to the bot before onboarding was enabled.
+func (a *AgentLoop) hasConversation(key string) bool {
+	keys, err := a.sessions.Keys()
+	if err != nil {
+		return false
+	}
+	i := sort.SearchStrings(keys, key)
+	return i < len(keys) && keys[i] == key
+}
+
+// onboardingGreeting introduces the bot: the configured greeting, or a
+// default one listing what it can do.
+func (a *AgentLoop) onboardingGreeting() string {
+	if g := strings.TrimSpace(a.onboarding.Greeting); g != "" {
+		return g
+	}
+	return "Hi! I'm picobot, your personal assistant. I can answer questions, search the web, keep notes and to-do lists, and remind you of things; send /help any time for the full list.\n\nFirst, a few quick questions so I can help you better."
+}
+
+// checkOnboardingAnswer validates the answer for fields with a known
+// format, returning what is wrong with it or "".
+func checkOnboardingAnswer(field, answer string) string {
+	if answer == "" {
+		return "I didn't get that."
+	}
+	if field == "timezone" {
+		if _, err := time.LoadLocation(answer); err != nil || answer == "Local" {
+			return fmt.Sprintf("I don't know the timezone %q.", answer)
+		}
+	}
+	return ""
+}
+
+// profileText answers /profile: the user's onboarding answers, or with
+// "reset" starts onboarding again.
+func (a *AgentLoop) profileText(msg chat.Inbound, args []string) string {
+	if a.onboarding == nil {
+		return "Onboarding is not enabled."
+	}
+	key := msg.Channel + ":" + msg.SenderID
+	a.profilesMu.Lock()
+	defer a.profilesMu.Unlock()
+	profiles, err := a.loadProfiles()
+	if err != nil {
+		log.Printf("onboarding: %v", err)
+		return "Sorry, I couldn't read the profiles."
+	}
+	if len(args) > 0 && strings.EqualFold(args[0], "reset") {
+		profiles[key] = &userProfile{Fields: map[string]string{}}
+		a.saveOnboarding(profiles)
+		return a.onboarding.Steps[0].Question
+	}
+	p := profiles[key]
+	if p == nil || len(p.Fields) == 0 {
+		return "I don't know anything about you yet. Use /profile reset to tell me."
+	}
+	return "Your profile:\n" + describeProfile(a.onboarding.Steps, p) + "\n\nUse /profile reset to change it."
+}
+
+// profileNote returns what onboarding knows about the sender of msg, for
+// the model, or "" when nothing.
+func (a *AgentLoop) profileNote(msg chat.Inbound) string {
+	if a.onboarding == nil {
+		return ""
+	}
+	a.profilesMu.Lock()
+	profiles, err := a.loadProfiles()
+	a.profilesMu.Unlock()
+	if err != nil {
+		return ""
+	}
+	p := profiles[msg.Channel+":"+msg.SenderID]
+	if p == nil || len(p.Fields) == 0 {
+		return ""
+	}
+	return strings.ReplaceAll(describeProfile(a.onboarding.Steps, p), "\n", "; ")
+}
+
+// describeProfile lists the answered fields of p in the order of steps.
+func describeProfile(steps []config.OnboardingStep, p *userProfile) string {
+	var lines []string
+	for _, s := range steps {
+		if v := p.Fields[s.Field]; v != "" {
+			lines = append(lines, s.Field+": "+v)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/providers"
+)
+
+func TestOnboarding(t *testing.T) {
+	ag := NewAgentLoop(chat.NewHub(10), providers.NewStubProvider(), "stub", 3, t.TempDir(), nil)
+	ag.SetOnboarding(config.OnboardingConfig{Enabled: true, Greeting: "Welcome!"})
+	dm := map[string]interface{}{"is_dm": true}
+	msg := chat.Inbound{Channel: "telegram", SenderID: "7", ChatID: "7", Content: "what's the weather?", Metadata: dm}
+
+	steps := []struct{ answer, want string }{
+		{"what's the weather?", "Welcome!\n\nWhat should I call you?"},
+		{"Ana", "Which timezone"},
+		{"Mars/Olympus", `I don't know the timezone "Mars/Olympus"`},
+		{"Europe/Lisbon", "Which language"},
+	}
+	for _, s := range steps {
+		msg.Content = s.answer
+		reply, ok, resume := ag.onboard(msg)
+		if !ok || resume != "" || !strings.Contains(reply, s.want) {
+			t.Fatalf("onboard(%q) = %q, %v, %q; want %q", s.answer, reply, ok, resume, s.want)
+		}
+	}
+	msg.Content = "/help"
+	if _, ok, _ := ag.onboard(msg); ok {
+		t.Fatal("commands should pass through during onboarding")
+	}
+	msg.Content = "skip"
+	reply, ok, resume := ag.onboard(msg)
+	if !ok || !strings.HasPrefix(reply, "Thanks, Ana") || resume != "what's the weather?" {
+		t.Fatalf("last answer = %q, %v, %q", reply, ok, resume)
+	}
+	msg.Content = "hi again"
+	if _, ok, _ := ag.onboard(msg); ok {
+		t.Fatal("onboarded twice")
+	}
+	if note := ag.profileNote(msg); note != "name: Ana; timezone: Europe/Lisbon" {
+		t.Errorf("profileNote = %q", note)
+	}
+	// The profiles are cached, but an edit of the file is seen.
+	edited := `{"telegram:7": {"fields": {"name": "Ana Maria"}, "step": 3, "done": true}}`
+	if err := os.WriteFile(filepath.Join(ag.workspace, profilesFile), []byte(edited), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if note := ag.profileNote(msg); note != "name: Ana Maria" {
+		t.Errorf("profileNote after editing the file = %q", note)
+	}
+
+	// Users already talking to the bot are not onboarded, nor are groups.
+	ag.sessions.Save(ag.sessions.GetOrCreate("telegram:8"))
+	if _, ok, _ := ag.onboard(chat.Inbound{Channel: "telegram", SenderID: "8", ChatID: "8", Content: "hi", Metadata: dm}); ok {
+		t.Error("existing user onboarded")
+	}
+	for _, group := range []chat.Inbound{
+		{Channel: "whatsapp", SenderID: "9", ChatID: "g", Content: "hi", Metadata: map[string]interface{}{"is_dm": false}},
+		{Channel: "telegram", SenderID: "9", ChatID: "-100", Content: "hi"},
+	} {
+		if _, ok, _ := ag.onboard(group); ok {
+			t.Errorf("group message onboarded: %+v", group)
+		}
+	}
+
+	msg.Content = "/profile reset"
+	if reply, _ := ag.handleCommand(msg); reply != "What should I call you?" {
+		t.Fatalf("/profile reset = %q", reply)
+	}
+	msg.Content = "Bia"
+	if reply, ok, _ := ag.onboard(msg); !ok || !strings.Contains(reply, "Which timezone") {
+		t.Fatalf("answer after reset = %q, %v", reply, ok)
+	}
+}
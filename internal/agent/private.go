@@ -0,0 +1,57 @@
+package agent
+
+import (
+	"strings"
+
+	"github.com/local/picobot/internal/session"
+)
+
+// privateMark starts every reply in a chat in private mode, so the mode is
+// never forgotten.
+const privateMark = "🔒 "
+
+// privateSession returns the in-RAM session of a chat in private mode, or nil
+// when the chat is not private.
+func (a *AgentLoop) privateSession(key string) *session.Session {
+	return a.private[key]
+}
+
+// privateText answers /private on|off. While private mode is on, the chat's
+// turns are kept in RAM only: no history, memory notes, link snapshots or
+// search archive are written. It starts from a copy of the saved history, so
+// the conversation goes on where it was, and is dropped when it ends.
+func (a *AgentLoop) privateText(key string, args []string) string {
+	on := a.private[key] != nil
+	if len(args) == 0 {
+		if on {
+			return "Private mode is on: nothing from this conversation is saved. Use /private off to end it."
+		}
+		return "Private mode is off. Use /private on to stop saving this conversation."
+	}
+	switch strings.ToLower(args[0]) {
+	case "on":
+		if on {
+			return "Private mode is already on."
+		}
+		saved := a.sessions.GetOrCreate(key).GetHistory()
+		a.private[key] = &session.Session{Key: key, History: append([]string(nil), saved...)}
+		return "Private mode is on: from now on nothing from this conversation is saved to history, memory or archives, and it is forgotten when you send /private off."
+	case "off":
+		if !on {
+			return "Private mode is already off."
+		}
+		delete(a.private, key)
+		return "Private mode is off. The private part of the conversation is forgotten, and new messages are saved again."
+	}
+	return "Usage: /private on|off"
+}
+
+// addPrivateTurn adds a turn to a private session, keeping it as short as a
+// saved one would be.
+func addPrivateTurn(sess *session.Session, user, reply string) {
+	sess.AddMessage("user", user)
+	sess.AddMessage("assistant", reply)
+	if n := len(sess.History) - session.MaxHistorySize; n > 0 {
+		sess.History = sess.History[n:]
+	}
+}
@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+// SetPublishChannels sets the Telegram broadcast channels the publish_post
+// tool may draft posts for (see config.TelegramConfig.PublishTo).
+func (a *AgentLoop) SetPublishChannels(channels []string) {
+	a.postDrafts.SetChannels(channels)
+}
+
+// recentPostsNote lists the latest posts in the broadcast channels for an
+// admin, who may have the agent draft the next one, or returns "" when there
+// are none. Posts reach the agent as events of the channel's own chat (see
+// processInbound), whose session the admin's chat does not see.
+func (a *AgentLoop) recentPostsNote(msg chat.Inbound) string {
+	if !msg.IsAdmin() {
+		return ""
+	}
+	return strings.Join(a.postDrafts.RecentPosts(), "\n")
+}
+
+// publishText answers /publish: it publishes the draft post of the admin's
+// chat, or schedules it for the time it was drafted for; "/publish cancel"
+// drops it.
+func (a *AgentLoop) publishText(msg chat.Inbound, args []string) string {
+	key := msg.Channel + ":" + msg.ChatID
+	now := time.Now()
+	draft, ok := a.postDrafts.Take(key, now)
+	if len(args) > 0 {
+		if !strings.EqualFold(args[0], "cancel") {
+			if ok {
+				a.postDrafts.Put(key, draft) // let the admin try again
+			}
+			return "Usage: /publish, or /publish cancel"
+		}
+		if !ok {
+			return "There is no draft post to cancel."
+		}
+		return "OK, dropped the draft post."
+	}
+	if !ok {
+		return "There is no draft post waiting. Ask me to write one first."
+	}
+	post := chat.Outbound{Channel: "telegram", ChatID: draft.Channel, Content: draft.Text, Media: draft.Media,
+		Metadata: map[string]interface{}{"channel_post": true}}
+	if draft.At.After(now) {
+		if a.scheduler == nil {
+			a.postDrafts.Put(key, draft)
+			return "Scheduled posts are not available here. Ask me to post it now instead, or /publish cancel."
+		}
+		id := a.scheduler.AddPost("post to "+draft.Channel, draft.Text, draft.Media, draft.At.Sub(now), post.Channel, post.ChatID)
+		log.Printf("publish: %s scheduled a post to %s for %s (%s)", msg.SenderID, draft.Channel, draft.At, id)
+		return fmt.Sprintf("Scheduled the post to %s for %s.", draft.Channel, draft.At.Format("Mon Jan 2 15:04 MST"))
+	}
+	select {
+	case a.hub.Out <- post:
+	default:
+		a.postDrafts.Put(key, draft)
+		return "Sorry, I couldn't send the post right now. Try /publish again in a moment."
+	}
+	log.Printf("publish: %s published a post to %s", msg.SenderID, draft.Channel)
+	// Telegram does not report the bot's own posts (see handleChannelPost).
+	a.postDrafts.RecordPost("[post in " + draft.Channel + "] " + draft.Text)
+	return fmt.Sprintf("Posted to %s.", draft.Channel)
+}
@@ -0,0 +1,391 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/providers"
+	"github.com/local/picobot/internal/telemetry"
+)
+
+const (
+	// researchSteps is the default number of model calls of a research run,
+	// the final answer excluded.
+	researchSteps = 10
+	// researchTimeout is the default time given to searching and reading.
+	researchTimeout = 3 * time.Minute
+	// researchTokens is the default estimated token budget of a run.
+	researchTokens = 60000
+	// researchAnswerTimeout is the time given to writing the answer once
+	// the budget is spent.
+	researchAnswerTimeout = time.Minute
+	// researchPageLen is how much of a page (in runes) the model reads.
+	researchPageLen = 6000
+	// researchResults caps the results of one search.
+	researchResults = 8
+)
+
+// duckDuckGoURL is the search used when no SearXNG instance is configured.
+var duckDuckGoURL = "https://html.duckduckgo.com/html/"
+
+const researchPrompt = `You are researching a question for the user. Use web_search to find pages and web_fetch to read the most promising ones; prefer reading at least two independent sources. Every page you read is numbered as a source: cite them as [1], [2] after the statements they support. When you know enough, stop calling tools and answer in this structure:
+
+**Answer:** a direct answer in one or two sentences.
+
+**Details:** the key findings, as short bullets with their citations.
+
+**Caveats:** where sources disagree, or what could not be verified (leave it out when there is nothing to say).
+
+Do not write a list of sources: it is added to your answer.`
+
+const researchWrapUp = "The research budget is spent. Write your answer now from what you have found, in the structure asked for."
+
+// researchTools are the tools of a research run, which executes them itself.
+var researchTools = []providers.ToolDefinition{
+	{
+		Name:        "web_search",
+		Description: "Search the web; returns titles, URLs and snippets of the top results",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"query": map[string]interface{}{"type": "string", "description": "The search query"},
+			},
+			"required": []string{"query"},
+		},
+	},
+	{
+		Name:        "web_fetch",
+		Description: "Read the text of a web page, which becomes a numbered source",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"url": map[string]interface{}{"type": "string", "description": "The page's URL (http or https)"},
+			},
+			"required": []string{"url"},
+		},
+	},
+}
+
+// researchSource is a page read during a research run.
+type researchSource struct {
+	URL   string
+	Title string
+}
+
+// searchResult is one result of a web search.
+type searchResult struct {
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	Snippet string `json:"content"`
+}
+
+// SetResearch sets the budget of /research runs and the search engine they
+// use. Zero values keep the defaults.
+func (a *AgentLoop) SetResearch(cfg config.ResearchConfig) {
+	a.research = cfg
+}
+
+// researchText answers /research: it starts a research run in the
+// background, which answers in the chat when it is done, and acknowledges it
+// itself (returning "").
+func (a *AgentLoop) researchText(msg chat.Inbound, question string) string {
+	if question == "" {
+		return "Usage: /research <question>. I'll search the web, read a few sources and answer with the list of them."
+	}
+	ctx := a.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	key := msg.Channel + ":" + msg.ChatID
+	private := a.privateSession(key) != nil
+	model := a.modelFor(msg.Channel, msg.ChatID)
+	timeout := researchTimeout
+	if a.research.TimeoutS > 0 {
+		timeout = time.Duration(a.research.TimeoutS) * time.Second
+	}
+	// The acknowledgement is marked as a followup so that channels waiting
+	// for one reply per message (the REST API) wait for the answer instead.
+	ack := fmt.Sprintf("Researching %q. I'll answer here within %s.", question, timeout.Round(time.Second))
+	if private {
+		ack = privateMark + ack
+	}
+	out := chat.Outbound{Channel: msg.Channel, ChatID: msg.ChatID, Content: ack, ReplyTo: msg.MessageID(), Private: private,
+		Metadata: map[string]interface{}{"followup": true}}
+	select {
+	case a.hub.Out <- out:
+	default:
+		log.Println("Outbound channel full, dropping message")
+	}
+	go func() {
+		answer, prompt := a.runResearch(ctx, question, model)
+		stats := telemetry.PromptStats{System: telemetry.EstimateTokens(researchPrompt), Current: telemetry.EstimateTokens(question)}
+		a.recordPromptStats(telemetry.PromptRecord{Channel: msg.Channel, ChatID: msg.ChatID, Stats: stats,
+			Followup: prompt, Feature: telemetry.FeatureResearch}, researchTools)
+		if !private {
+			a.archiveTurn(key, "/research "+question, answer)
+		} else {
+			answer = privateMark + answer
+		}
+		out := chat.Outbound{Channel: msg.Channel, ChatID: msg.ChatID, Content: answer, ReplyTo: msg.MessageID(), Private: private}
+		select {
+		case a.hub.Out <- out:
+		default:
+			log.Println("Outbound channel full, dropping message")
+		}
+	}()
+	return ""
+}
+
+// runResearch searches and reads the web about question until the model
+// has its answer or the budget (steps, time, estimated tokens) is spent, and
+// returns the answer followed by the sources read, with the estimated prompt
+// tokens of the model calls after the first.
+func (a *AgentLoop) runResearch(ctx context.Context, question, model string) (string, int) {
+	steps, timeout, budget := researchSteps, researchTimeout, researchTokens
+	if a.research.MaxSteps > 0 {
+		steps = a.research.MaxSteps
+	}
+	if a.research.TimeoutS > 0 {
+		timeout = time.Duration(a.research.TimeoutS) * time.Second
+	}
+	if a.research.MaxTokens > 0 {
+		budget = a.research.MaxTokens
+	}
+	searchCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	messages := []providers.Message{
+		{Role: "system", Content: researchPrompt},
+		{Role: "user", Content: question},
+	}
+	var sources []researchSource
+	tokens, answer := 0, ""
+	followup, defTokens := 0, toolDefTokens(researchTools)
+	for step := 0; step < steps && tokens < budget && answer == ""; step++ {
+		tokens += messagesTokens(messages)
+		if step > 0 {
+			followup += messagesTokens(messages) + defTokens
+		}
+		resp, err := a.provider.Chat(searchCtx, messages, researchTools, model)
+		if err != nil {
+			if searchCtx.Err() == nil {
+				log.Printf("research: provider error: %v", err)
+			}
+			break
+		}
+		tokens += telemetry.EstimateTokens(resp.Content)
+		if !resp.HasToolCalls {
+			answer = strings.TrimSpace(resp.Content)
+			break
+		}
+		messages = append(messages, providers.Message{Role: "assistant", Content: resp.Content, ToolCalls: resp.ToolCalls})
+		for _, tc := range resp.ToolCalls {
+			res := a.researchTool(searchCtx, tc, &sources)
+			messages = append(messages, providers.Message{Role: "tool", Content: res, ToolCallID: tc.ID})
+		}
+	}
+
+	if answer == "" {
+		answerCtx, cancel := context.WithTimeout(ctx, researchAnswerTimeout)
+		defer cancel()
+		messages = append(messages, providers.Message{Role: "user", Content: researchWrapUp})
+		followup += messagesTokens(messages)
+		resp, err := a.provider.Chat(answerCtx, messages, nil, model)
+		if err != nil {
+			log.Printf("research: provider error: %v", err)
+			return "Sorry, the research failed: " + err.Error(), followup
+		}
+		answer = strings.TrimSpace(resp.Content)
+	}
+
+	var b strings.Builder
+	b.WriteString(answer)
+	if len(sources) == 0 {
+		b.WriteString("\n\n(No sources could be read.)")
+	} else {
+		b.WriteString("\n\nSources:")
+		for i, s := range sources {
+			title := s.Title
+			if title == "" {
+				title = s.URL
+			}
+			fmt.Fprintf(&b, "\n[%d] %s — %s", i+1, title, s.URL)
+		}
+	}
+	return b.String(), followup
+}
+
+// researchTool runs one tool call of a research run; pages read are added
+// to sources.
+func (a *AgentLoop) researchTool(ctx context.Context, tc providers.ToolCall, sources *[]researchSource) string {
+	switch tc.Name {
+	case "web_search":
+		query, _ := tc.Arguments["query"].(string)
+		if strings.TrimSpace(query) == "" {
+			return "(tool error) web_search: 'query' argument required"
+		}
+		results, err := a.webSearch(ctx, query)
+		if err != nil {
+			return "(tool error) web_search: " + err.Error()
+		}
+		if len(results) == 0 {
+			return "No results."
+		}
+		var b strings.Builder
+		for i, r := range results {
+			fmt.Fprintf(&b, "%d. %s\n%s\n%s\n\n", i+1, r.Title, r.URL, r.Snippet)
+		}
+		return strings.TrimSpace(b.String())
+	case "web_fetch":
+		u, _ := tc.Arguments["url"].(string)
+		if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+			return "(tool error) web_fetch: an http or https 'url' is required"
+		}
+		n := 0
+		for i, s := range *sources {
+			if s.URL == u {
+				n = i + 1
+			}
+		}
+		title, text, err := fetchReadable(ctx, u)
+		if err != nil {
+			return "(tool error) web_fetch: " + err.Error()
+		}
+		if n == 0 {
+			*sources = append(*sources, researchSource{URL: u, Title: title})
+			n = len(*sources)
+		}
+		if utf8.RuneCountInString(text) > researchPageLen {
+			text = string([]rune(text)[:researchPageLen]) + "…"
+		}
+		return fmt.Sprintf("[Source %d] %s\n%s\n\n%s", n, title, u, text)
+	}
+	return fmt.Sprintf("(tool error) unknown tool %q", tc.Name)
+}
+
+// messagesTokens estimates the prompt tokens of messages.
+func messagesTokens(messages []providers.Message) int {
+	n := 0
+	for _, m := range messages {
+		n += telemetry.EstimateTokens(m.Content)
+		for _, tc := range m.ToolCalls {
+			if b, err := json.Marshal(tc.Arguments); err == nil {
+				n += telemetry.EstimateTokens(string(b))
+			}
+		}
+	}
+	return n
+}
+
+// webSearch looks query up on the configured SearXNG instance, or else on
+// DuckDuckGo's HTML page.
+func (a *AgentLoop) webSearch(ctx context.Context, query string) ([]searchResult, error) {
+	var req *http.Request
+	var err error
+	if a.research.SearxngURL != "" {
+		u := strings.TrimRight(a.research.SearxngURL, "/") + "/search?format=json&q=" + url.QueryEscape(query)
+		req, err = http.NewRequestWithContext(ctx, "GET", u, nil)
+	} else {
+		form := url.Values{"q": {query}}
+		req, err = http.NewRequestWithContext(ctx, "POST", duckDuckGoURL, strings.NewReader(form.Encode()))
+		if req != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp, err := linkClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("search: %s", resp.Status)
+	}
+
+	var results []searchResult
+	if a.research.SearxngURL != "" {
+		var body struct {
+			Results []searchResult `json:"results"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			return nil, fmt.Errorf("search: %w", err)
+		}
+		results = body.Results
+	} else {
+		doc, err := html.Parse(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("search: %w", err)
+		}
+		results = duckDuckGoResults(doc)
+	}
+	if len(results) > researchResults {
+		results = results[:researchResults]
+	}
+	return results, nil
+}
+
+// duckDuckGoResults reads the results of DuckDuckGo's HTML page: a
+// "result__a" link per result, followed by its "result__snippet".
+func duckDuckGoResults(doc *html.Node) []searchResult {
+	var results []searchResult
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "a" {
+			class, href := "", ""
+			for _, attr := range n.Attr {
+				switch attr.Key {
+				case "class":
+					class = attr.Val
+				case "href":
+					href = attr.Val
+				}
+			}
+			switch {
+			case strings.Contains(class, "result__a"):
+				// Result links go through a redirect carrying the target in uddg.
+				if u, err := url.Parse(href); err == nil && u.Query().Get("uddg") != "" {
+					href = u.Query().Get("uddg")
+				}
+				results = append(results, searchResult{Title: nodeText(n), URL: href})
+				return
+			case strings.Contains(class, "result__snippet") && len(results) > 0:
+				results[len(results)-1].Snippet = nodeText(n)
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return results
+}
+
+// nodeText returns the text under n, with its spaces collapsed.
+func nodeText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data + " ")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
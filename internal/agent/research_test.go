@@ -0,0 +1,134 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/providers"
+)
+
+// researchProvider searches, reads the first result, then answers; with
+// endless set, it keeps searching for as long as it is offered tools.
+type researchProvider struct {
+	pageURL string
+	endless bool
+	calls   int
+	lastDef int // tools offered with the latest call
+}
+
+func (p *researchProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string) (providers.LLMResponse, error) {
+	p.calls++
+	p.lastDef = len(tools)
+	if len(tools) == 0 {
+		return providers.LLMResponse{Content: "**Answer:** wrapped up [1]"}, nil
+	}
+	switch {
+	case p.calls == 1 || p.endless:
+		return providers.LLMResponse{HasToolCalls: true, ToolCalls: []providers.ToolCall{
+			{ID: "s", Name: "web_search", Arguments: map[string]interface{}{"query": "gophers"}},
+		}}, nil
+	case p.calls == 2:
+		return providers.LLMResponse{HasToolCalls: true, ToolCalls: []providers.ToolCall{
+			{ID: "f", Name: "web_fetch", Arguments: map[string]interface{}{"url": p.pageURL}},
+		}}, nil
+	}
+	last := messages[len(messages)-1].Content
+	if !strings.Contains(last, "[Source 1] All about gophers") || !strings.Contains(last, "Gophers dig.") {
+		return providers.LLMResponse{Content: "page not read: " + last}, nil
+	}
+	return providers.LLMResponse{Content: "**Answer:** they dig [1]"}, nil
+}
+
+func (p *researchProvider) GetDefaultModel() string { return "fake" }
+
+func TestResearch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/search":
+			if r.URL.Query().Get("format") != "json" || r.URL.Query().Get("q") != "gophers" {
+				t.Errorf("search query = %v", r.URL.Query())
+			}
+			w.Write([]byte(`{"results":[{"title":"Gophers","url":"http://` + r.Host + `/page","content":"About gophers"}]}`))
+		case "/page":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head><title>All about gophers</title></head><body><nav>Menu</nav><p>Gophers dig.</p></body></html>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	hub := chat.NewHub(10)
+	p := &researchProvider{pageURL: srv.URL + "/page"}
+	ag := NewAgentLoop(hub, p, "fake", 3, t.TempDir(), nil)
+	ag.SetResearch(config.ResearchConfig{SearxngURL: srv.URL})
+
+	ag.processInbound(context.Background(), chat.Inbound{Channel: "telegram", ChatID: "1", Content: "/research what do gophers do?",
+		Metadata: map[string]interface{}{"message_id": "7"}})
+	var replies []chat.Outbound
+	for len(replies) < 2 {
+		select {
+		case out := <-hub.Out:
+			replies = append(replies, out)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout; replies so far: %+v", replies)
+		}
+	}
+	if followup, _ := replies[0].Metadata["followup"].(bool); !strings.Contains(replies[0].Content, `Researching "what do gophers do?"`) || !followup {
+		t.Errorf("acknowledgement = %+v", replies[0])
+	}
+	want := "**Answer:** they dig [1]\n\nSources:\n[1] All about gophers — " + srv.URL + "/page"
+	if replies[1].Content != want || replies[1].ReplyTo != "7" {
+		t.Errorf("answer = %q (reply to %q), want %q", replies[1].Content, replies[1].ReplyTo, want)
+	}
+}
+
+func TestResearchBudget(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results":[]}`))
+	}))
+	defer srv.Close()
+
+	p := &researchProvider{endless: true}
+	ag := NewAgentLoop(chat.NewHub(10), p, "fake", 3, t.TempDir(), nil)
+	ag.SetResearch(config.ResearchConfig{MaxSteps: 3, SearxngURL: srv.URL})
+
+	got, followup := ag.runResearch(context.Background(), "gophers?", "fake")
+	if p.calls != 4 || p.lastDef != 0 {
+		t.Fatalf("%d calls, %d tools offered last; want 3 steps and a final call without tools", p.calls, p.lastDef)
+	}
+	if got != "**Answer:** wrapped up [1]\n\n(No sources could be read.)" {
+		t.Fatalf("answer = %q", got)
+	}
+	if followup <= toolDefTokens(researchTools) {
+		t.Errorf("follow-up calls counted %d tokens", followup)
+	}
+}
+
+func TestDuckDuckGoResults(t *testing.T) {
+	page := `<div class="result"><h2><a rel="nofollow" class="result__a" href="//duckduckgo.com/l/?uddg=https%3A%2F%2Fgo.dev%2F&amp;rut=x">The <b>Go</b> Programming Language</a></h2>
+<a class="result__snippet" href="#">Go is an <b>open source</b> language.</a></div>
+<div class="result"><a class="result__a" href="https://example.com/">Example</a></div>`
+	doc, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := duckDuckGoResults(doc)
+	if len(got) != 2 {
+		t.Fatalf("results = %+v", got)
+	}
+	if got[0] != (searchResult{Title: "The Go Programming Language", URL: "https://go.dev/", Snippet: "Go is an open source language."}) {
+		t.Errorf("first result = %+v", got[0])
+	}
+	if got[1].URL != "https://example.com/" || got[1].Snippet != "" {
+		t.Errorf("second result = %+v", got[1])
+	}
+}
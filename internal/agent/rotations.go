@@ -0,0 +1,41 @@
+package agent
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+// rotationCheck is how often the agent looks for rotations whose turn
+// changed.
+const rotationCheck = time.Minute
+
+// announceRotations posts a reminder in each rotation's chat when its turn
+// passes to the next member. The text is worked out by the rotation itself,
+// without the LLM, so the turn announced is always the right one.
+func (a *AgentLoop) announceRotations(ctx context.Context) {
+	ticker := time.NewTicker(rotationCheck)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			due, err := a.rotations.Due(now)
+			if err != nil {
+				log.Printf("error checking rotations: %v", err)
+				continue
+			}
+			for _, r := range due {
+				out := chat.Outbound{Channel: r.Channel, ChatID: r.ChatID, Content: r.Describe(now), Type: chat.TypeReminder}
+				select {
+				case a.hub.Out <- out:
+				default:
+					log.Println("Outbound channel full, dropping message")
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package agent
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// searchResults caps how many excerpts /search returns.
+const searchResults = 10
+
+// searchExcerpt is how many characters of a message /search shows.
+const searchExcerpt = 200
+
+// archiveTurn adds a user message and the reply to it to the chat's archive,
+// which /search looks through long after the session history has moved on.
+func (a *AgentLoop) archiveTurn(key, user, reply string) {
+	for _, m := range [][2]string{{"user", user}, {"assistant", reply}} {
+		if err := a.sessions.Archive(key, m[0], m[1]); err != nil {
+			log.Printf("error archiving message for %s: %v", key, err)
+			return
+		}
+	}
+}
+
+// searchText answers /search: the archived messages of the chat matching all
+// of terms, newest first, each with its date.
+func (a *AgentLoop) searchText(key string, terms []string) string {
+	if len(terms) == 0 {
+		return "Usage: /search <terms>"
+	}
+	query := strings.Join(terms, " ")
+	found, err := a.sessions.SearchArchive(key, query, searchResults)
+	if err != nil {
+		log.Printf("error searching archive of %s: %v", key, err)
+		return "Sorry, I couldn't search the conversation history."
+	}
+	if len(found) == 0 {
+		return fmt.Sprintf("No messages matching %q.", query)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Messages matching %q:\n", query)
+	for _, e := range found {
+		who := "you"
+		if e.Role == "assistant" {
+			who = "me"
+		}
+		text := strings.Join(strings.Fields(e.Content), " ")
+		if r := []rune(text); len(r) > searchExcerpt {
+			text = string(r[:searchExcerpt]) + "…"
+		}
+		fmt.Fprintf(&b, "\n%s %s: %s", e.Time.Local().Format("2006-01-02"), who, text)
+	}
+	return b.String()
+}
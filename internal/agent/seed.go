@@ -0,0 +1,20 @@
+package agent
+
+import "math/rand/v2"
+
+// SetSeed makes every turn sample with seed, for reproducible runs (evals,
+// replaying a turn). Without it each turn draws a seed of its own, which is
+// logged so that a surprising reply can be asked for again with it.
+func (a *AgentLoop) SetSeed(seed int64) {
+	a.seed = &seed
+}
+
+// turnSeed returns the seed of a new turn: the one set with SetSeed, or a
+// random one small enough for every provider that accepts seeds. A drawn
+// seed is never 0, which providers take as no seed at all.
+func (a *AgentLoop) turnSeed() int64 {
+	if a.seed != nil {
+		return *a.seed
+	}
+	return 1 + rand.Int64N(1<<31-1)
+}
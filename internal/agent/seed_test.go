@@ -0,0 +1,69 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/providers"
+	"github.com/local/picobot/internal/telemetry"
+)
+
+// seedProvider records the seeds it is asked to sample with, and fails
+// when told to.
+type seedProvider struct {
+	seeds []int64
+	fail  bool
+}
+
+func (p *seedProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string) (providers.LLMResponse, error) {
+	seed, _ := providers.SeedFrom(ctx)
+	p.seeds = append(p.seeds, seed)
+	if p.fail {
+		return providers.LLMResponse{}, context.DeadlineExceeded
+	}
+	return providers.LLMResponse{Content: "ok"}, nil
+}
+
+func (p *seedProvider) GetDefaultModel() string { return "fake" }
+
+func TestTurnSeed(t *testing.T) {
+	p := &seedProvider{}
+	hub := chat.NewHub(10)
+	ws := t.TempDir()
+	ag := NewAgentLoop(hub, p, "fake", 3, ws, nil)
+	in := chat.Inbound{Channel: "telegram", SenderID: "u", ChatID: "1", Content: "hello"}
+
+	// Without a fixed seed every turn draws its own.
+	ag.processInbound(context.Background(), in)
+	ag.processInbound(context.Background(), in)
+	if len(p.seeds) != 2 || p.seeds[0] == 0 || p.seeds[0] == p.seeds[1] {
+		t.Fatalf("random seeds = %v", p.seeds)
+	}
+
+	// A fixed seed is used for every call, and kept in the trace of a
+	// failed turn.
+	p.seeds, p.fail = nil, true
+	ag.SetSeed(42)
+	ag.processInbound(context.Background(), in)
+	if len(p.seeds) != 1 || p.seeds[0] != 42 {
+		t.Fatalf("fixed seed = %v", p.seeds)
+	}
+	var apology string
+	for len(hub.Out) > 0 {
+		apology = (<-hub.Out).Content
+	}
+	id := apology[strings.Index(apology, "(trace ")+7 : strings.Index(apology, "(trace ")+15]
+	rec, ok, err := telemetry.FindTrace(ws, id)
+	if err != nil || !ok || rec.Seed != 42 || !strings.Contains(rec.Format(), "seed: 42") {
+		t.Fatalf("trace %s = %+v, %v, %v", id, rec, ok, err)
+	}
+
+	// The one-shot CLI path is seeded too.
+	p.seeds, p.fail = nil, false
+	if _, err := ag.ProcessDirect("hi", time.Second); err != nil || len(p.seeds) != 1 || p.seeds[0] != 42 {
+		t.Fatalf("ProcessDirect seeds = %v, %v", p.seeds, err)
+	}
+}
@@ -0,0 +1,171 @@
+package agent
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/local/picobot/internal/providers"
+	"github.com/local/picobot/internal/telemetry"
+)
+
+// bootstrapFiles are the workspace files that define the agent's
+// personality, instructions and tool documentation, in prompt order.
+var bootstrapFiles = []string{"SOUL.md", "AGENTS.md", "USER.md", "TOOLS.md"}
+
+const (
+	systemPrompt      = "You are SMCHouseBot, a helpful assistant. Always reply in Brazilian Portuguese unless the user explicitly asks for another language. Use a dry, sarcastic tone inspired by Dr. House, while remaining helpful, precise, and technically competent."
+	memoryInstruction = "If you decide something should be remembered, call the tool 'write_memory' with JSON arguments: {\"target\": \"today\"|\"long\", \"content\": \"...\", \"append\": true|false}. Use a tool call rather than plain chat text when writing memory."
+)
+
+// promptSnapshot is the stable prompt prefix (system prompt, bootstrap
+// files, skills) as last assembled, with the fingerprint of the files it
+// was assembled from and what it adds to each prompt section.
+type promptSnapshot struct {
+	Fingerprint string              `json:"fingerprint"`
+	Messages    []providers.Message `json:"messages"`
+	System      int                 `json:"system"`
+	Bootstrap   int                 `json:"bootstrap"`
+	Skills      int                 `json:"skills"`
+}
+
+// SetPromptSnapshot keeps the assembled stable prompt prefix in the
+// gzip-compressed file at path, so a restart reuses it instead of reading
+// the bootstrap files and skills again as long as none of them changed.
+func (a *AgentLoop) SetPromptSnapshot(path string) {
+	a.context.snapMu.Lock()
+	defer a.context.snapMu.Unlock()
+	a.context.snapPath = path
+}
+
+// fingerprint identifies the files the stable prefix is assembled from by
+// their names, sizes and modification times, which are cheap to read.
+func (cb *ContextBuilder) fingerprint() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00", systemPrompt, memoryInstruction)
+	stat := func(path string) {
+		if fi, err := os.Stat(path); err == nil {
+			fmt.Fprintf(h, "%s %d %d\x00", path, fi.Size(), fi.ModTime().UnixNano())
+		}
+	}
+	for _, name := range bootstrapFiles {
+		stat(filepath.Join(cb.workspace, name))
+	}
+	skillsDir := filepath.Join(cb.workspace, "skills")
+	entries, _ := os.ReadDir(skillsDir)
+	for _, e := range entries {
+		if e.IsDir() {
+			stat(filepath.Join(skillsDir, e.Name(), "SKILL.md"))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// stablePrefix returns the messages that start every prompt and their share
+// of each prompt section. They are assembled again only when a file they
+// come from changed since the snapshot in memory, or on disk.
+func (cb *ContextBuilder) stablePrefix() ([]providers.Message, telemetry.PromptStats) {
+	fp := cb.fingerprint()
+	cb.snapMu.Lock()
+	defer cb.snapMu.Unlock()
+	if cb.snap == nil && cb.snapPath != "" {
+		cb.snap = loadPromptSnapshot(cb.snapPath)
+	}
+	if cb.snap == nil || cb.snap.Fingerprint != fp {
+		cb.snap = cb.assemblePrefix(fp)
+		if cb.snapPath != "" {
+			if err := savePromptSnapshot(cb.snapPath, cb.snap); err != nil {
+				log.Printf("prompt snapshot: %v", err)
+			}
+		}
+	}
+	stats := telemetry.PromptStats{System: cb.snap.System, Bootstrap: cb.snap.Bootstrap, Skills: cb.snap.Skills}
+	return cb.snap.Messages, stats
+}
+
+// assemblePrefix reads the bootstrap files and skills into a new snapshot.
+func (cb *ContextBuilder) assemblePrefix(fp string) *promptSnapshot {
+	snap := &promptSnapshot{Fingerprint: fp}
+	add := func(section *int, m providers.Message) {
+		*section += telemetry.EstimateTokens(m.Content)
+		snap.Messages = append(snap.Messages, m)
+	}
+	add(&snap.System, providers.Message{Role: "system", Content: systemPrompt})
+
+	for _, name := range bootstrapFiles {
+		data, err := os.ReadFile(filepath.Join(cb.workspace, name))
+		if err != nil {
+			continue // file may not exist yet, skip silently
+		}
+		content := strings.TrimSpace(string(data))
+		if content != "" {
+			add(&snap.Bootstrap, providers.Message{Role: "system", Content: fmt.Sprintf("## %s\n\n%s", name, content)})
+		}
+	}
+
+	add(&snap.System, providers.Message{Role: "system", Content: memoryInstruction})
+
+	loadedSkills, err := cb.skillsLoader.LoadAll()
+	if err != nil {
+		log.Printf("error loading skills: %v", err)
+	}
+	if len(loadedSkills) > 0 {
+		var sb strings.Builder
+		sb.WriteString("Available Skills:\n")
+		for _, skill := range loadedSkills {
+			sb.WriteString(fmt.Sprintf("\n## %s\n%s\n\n%s\n", skill.Name, skill.Description, skill.Content))
+		}
+		add(&snap.Skills, providers.Message{Role: "system", Content: sb.String()})
+	}
+	return snap
+}
+
+// loadPromptSnapshot reads the snapshot at path; it returns nil if there is
+// none or it cannot be read.
+func loadPromptSnapshot(path string) *promptSnapshot {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil
+	}
+	var snap promptSnapshot
+	if err := json.NewDecoder(zr).Decode(&snap); err != nil || len(snap.Messages) == 0 {
+		return nil
+	}
+	return &snap
+}
+
+// savePromptSnapshot writes snap to path, replacing it atomically.
+func savePromptSnapshot(path string, snap *promptSnapshot) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".prompt-snapshot-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	zw := gzip.NewWriter(tmp)
+	if err := json.NewEncoder(zw).Encode(snap); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/providers"
+)
+
+func TestStablePrefixSnapshot(t *testing.T) {
+	ws := t.TempDir()
+	user := filepath.Join(ws, "USER.md")
+	if err := os.WriteFile(user, []byte("Name: Ana"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(ws, "prompt-snapshot.json.gz")
+
+	cb := NewContextBuilder(ws, nil, 5)
+	cb.snapPath = path
+	msgs, stats := cb.stablePrefix()
+	if len(msgs) != 3 || !strings.Contains(msgs[1].Content, "Name: Ana") || stats.Bootstrap == 0 {
+		t.Fatalf("prefix = %+v, stats %+v", msgs, stats)
+	}
+
+	// A restart reuses the snapshot on disk while the files are unchanged:
+	// plant a marker in it to tell it apart from a rebuild.
+	snap := loadPromptSnapshot(path)
+	if snap == nil {
+		t.Fatal("snapshot not saved")
+	}
+	snap.Messages[1] = providers.Message{Role: "system", Content: "from the snapshot"}
+	if err := savePromptSnapshot(path, snap); err != nil {
+		t.Fatal(err)
+	}
+	restarted := NewContextBuilder(ws, nil, 5)
+	restarted.snapPath = path
+	if msgs, _ := restarted.stablePrefix(); msgs[1].Content != "from the snapshot" {
+		t.Fatalf("snapshot not reused: %q", msgs[1].Content)
+	}
+
+	// Editing a bootstrap file rebuilds it.
+	if err := os.WriteFile(user, []byte("Name: Bia"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Second)
+	os.Chtimes(user, later, later)
+	if msgs, _ := restarted.stablePrefix(); !strings.Contains(msgs[1].Content, "Name: Bia") {
+		t.Fatalf("prefix not rebuilt after an edit: %q", msgs[1].Content)
+	}
+	if snap := loadPromptSnapshot(path); snap == nil || !strings.Contains(snap.Messages[1].Content, "Name: Bia") {
+		t.Fatal("rebuilt prefix not saved")
+	}
+}
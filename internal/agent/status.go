@@ -0,0 +1,11 @@
+//go:build !lite
+
+package agent
+
+import "github.com/local/picobot/internal/agent/tools"
+
+// EnableWhatsAppStatus offers the post_whatsapp_status tool, for a gateway
+// running the WhatsApp channel.
+func (a *AgentLoop) EnableWhatsAppStatus() {
+	a.tools.Register(tools.NewPostStatusTool(a.hub, a.root))
+}
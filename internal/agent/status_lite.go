@@ -0,0 +1,7 @@
+//go:build lite
+
+package agent
+
+// EnableWhatsAppStatus does nothing in the lite build, which has no WhatsApp
+// channel to post status updates with.
+func (a *AgentLoop) EnableWhatsAppStatus() {}
@@ -0,0 +1,21 @@
+//go:build !lite
+
+package agent
+
+import (
+	"testing"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/providers"
+)
+
+func TestWhatsAppStatusToolOnlyWhenEnabled(t *testing.T) {
+	ag := NewAgentLoop(chat.NewHub(10), providers.NewStubProvider(), "stub", 3, t.TempDir(), nil)
+	if ag.tools.Get("post_whatsapp_status") != nil {
+		t.Fatal("post_whatsapp_status offered without the WhatsApp channel")
+	}
+	ag.EnableWhatsAppStatus()
+	if ag.tools.Get("post_whatsapp_status") == nil {
+		t.Fatal("post_whatsapp_status not offered with the WhatsApp channel")
+	}
+}
@@ -0,0 +1,94 @@
+package agent
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/providers"
+)
+
+// replyStream forwards a reply to its channel as partial snapshots while the
+// provider is still generating it.
+type replyStream struct {
+	hub  *chat.Hub
+	base chat.Outbound
+	text strings.Builder
+}
+
+// newReplyStream returns a stream for replies to msg, or nil when the provider
+// cannot stream or the channel cannot render partial replies.
+func (a *AgentLoop) newReplyStream(msg chat.Inbound) *replyStream {
+	if _, ok := a.provider.(providers.StreamingProvider); !ok || !a.hub.Streams(msg.Channel) {
+		return nil
+	}
+	return &replyStream{
+		hub: a.hub,
+		base: chat.Outbound{
+			Channel:  msg.Channel,
+			ChatID:   msg.ChatID,
+			ReplyTo:  msg.MessageID(),
+			Type:     replyType(msg),
+			StreamID: msg.Channel + ":" + msg.ChatID + ":" + strconv.FormatInt(time.Now().UnixNano(), 10),
+		},
+	}
+}
+
+// publish sends the current text as a partial snapshot. Snapshots are
+// best-effort: when the outbound queue is half full they are dropped, since the
+// next one (or the final message) supersedes them, and the remaining room is
+// kept for messages that must not be lost.
+func (s *replyStream) publish() {
+	if len(s.hub.Out) >= cap(s.hub.Out)/2 {
+		return
+	}
+	out := s.base
+	out.Content = s.text.String()
+	out.Partial = true
+	select {
+	case s.hub.Out <- out:
+	default:
+	}
+}
+
+// delta appends a fragment of generated text and publishes the new snapshot.
+func (s *replyStream) delta(d string) {
+	s.text.WriteString(d)
+	s.publish()
+}
+
+// finish tags out as the final message of the stream.
+func (s *replyStream) finish(out *chat.Outbound) {
+	if s != nil {
+		out.StreamID = s.base.StreamID
+	}
+}
+
+// publishToolEvent tells msg's channel, when it wants tool events, about a
+// tool run while answering msg. Like partial snapshots, events are dropped
+// when the outbound queue is half full.
+func (a *AgentLoop) publishToolEvent(msg chat.Inbound, ev chat.ToolEvent) {
+	if !a.hub.ToolEvents(msg.Channel) || len(a.hub.Out) >= cap(a.hub.Out)/2 {
+		return
+	}
+	out := chat.Outbound{Channel: msg.Channel, ChatID: msg.ChatID, ReplyTo: msg.MessageID(),
+		Metadata: map[string]interface{}{"tool_event": ev}}
+	select {
+	case a.hub.Out <- out:
+	default:
+	}
+}
+
+// chat calls the provider with model, streaming the reply text through s when
+// it is not nil.
+func (a *AgentLoop) chat(ctx context.Context, messages []providers.Message, toolDefs []providers.ToolDefinition, model string, s *replyStream) (providers.LLMResponse, error) {
+	if s == nil {
+		return a.provider.Chat(ctx, messages, toolDefs, model)
+	}
+	// Each call starts a fresh snapshot: text streamed before a tool call is
+	// replaced by the text of the next iteration.
+	s.text.Reset()
+	return a.provider.(providers.StreamingProvider).ChatStream(ctx, messages, toolDefs, model, s.delta)
+}
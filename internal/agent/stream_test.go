@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/providers"
+)
+
+// streamingProvider streams a fixed reply in two fragments.
+type streamingProvider struct{}
+
+func (streamingProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string) (providers.LLMResponse, error) {
+	return providers.LLMResponse{Content: "Hello"}, nil
+}
+
+func (streamingProvider) ChatStream(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, onDelta func(string)) (providers.LLMResponse, error) {
+	onDelta("Hel")
+	onDelta("lo")
+	return providers.LLMResponse{Content: "Hello"}, nil
+}
+
+func (streamingProvider) GetDefaultModel() string { return "fake" }
+
+func TestAgentStreamsToStreamingChannel(t *testing.T) {
+	b := chat.NewHub(10)
+	b.EnableStreaming("telegram")
+	ag := NewAgentLoop(b, streamingProvider{}, "fake", 3, "", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	go ag.Run(ctx)
+
+	b.In <- chat.Inbound{Channel: "telegram", SenderID: "u", ChatID: "1", Content: "hi"}
+
+	want := []struct {
+		content string
+		partial bool
+	}{{"", true}, {"Hel", true}, {"Hello", true}, {"Hello", false}}
+	streamID := ""
+	for i, w := range want {
+		select {
+		case out := <-b.Out:
+			if out.Content != w.content || out.Partial != w.partial {
+				t.Fatalf("message %d: got content=%q partial=%v, want %q %v", i, out.Content, out.Partial, w.content, w.partial)
+			}
+			if out.StreamID == "" || (streamID != "" && out.StreamID != streamID) {
+				t.Fatalf("message %d: unexpected stream id %q", i, out.StreamID)
+			}
+			streamID = out.StreamID
+		case <-ctx.Done():
+			t.Fatalf("timeout waiting for message %d", i)
+		}
+	}
+}
+
+func TestAgentDoesNotStreamToPlainChannel(t *testing.T) {
+	b := chat.NewHub(10)
+	ag := NewAgentLoop(b, streamingProvider{}, "fake", 3, "", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	go ag.Run(ctx)
+
+	b.In <- chat.Inbound{Channel: "discord", SenderID: "u", ChatID: "1", Content: "hi"}
+	select {
+	case out := <-b.Out:
+		if out.Partial || out.StreamID != "" || out.Content != "Hello" {
+			t.Fatalf("unexpected outbound: %+v", out)
+		}
+	case <-ctx.Done():
+		t.Fatal("timeout waiting for reply")
+	}
+}
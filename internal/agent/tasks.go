@@ -0,0 +1,189 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/providers"
+	"github.com/local/picobot/internal/telemetry"
+)
+
+// taskWindow is how far back /tasks and the "tasks" briefing section look
+// for commitments.
+const taskWindow = 24 * time.Hour
+
+// taskMorning is the hour at which tasks without a due time are reminded,
+// the next day.
+const taskMorning = 9
+
+// taskTimeout bounds the LLM pass over a conversation.
+const taskTimeout = 2 * time.Minute
+
+// proposedTask is a commitment found in a conversation, waiting for the
+// user's approval before it is scheduled.
+type proposedTask struct {
+	Text string
+	Due  time.Time
+}
+
+// taskPrompt asks for the commitments of a conversation as JSON.
+const taskPrompt = `You find commitments in a chat conversation. List the things someone in it promised to do ("vou te mandar amanhã", "I'll call the plumber") or said needs doing ("precisamos comprar X"), that are not done yet according to the conversation. For each give a short imperative task in the conversation's language and, when the conversation implies one, when it is due.
+
+The current time is %s. Reply with only a JSON array like [{"task": "Send Ana the report", "due": "2026-10-18T09:00:00-03:00"}], "due" being RFC 3339 or "" when unknown. Reply [] when there are none.`
+
+// extractTasks asks the LLM for the commitments made in the chat key since
+// now minus taskWindow.
+func (a *AgentLoop) extractTasks(ctx context.Context, key string, now time.Time) ([]proposedTask, error) {
+	entries, err := a.sessions.ArchiveSince(key, now.Add(-taskWindow))
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	var conv strings.Builder
+	for _, e := range entries {
+		fmt.Fprintf(&conv, "[%s] %s: %s\n", e.Time.In(now.Location()).Format("Mon 15:04"), e.Role, e.Content)
+	}
+	system := fmt.Sprintf(taskPrompt, now.Format(time.RFC3339))
+	channel, chatID, _ := strings.Cut(key, ":")
+	a.recordPromptStats(telemetry.PromptRecord{Channel: channel, ChatID: chatID, Feature: telemetry.FeatureTasks,
+		Stats: telemetry.PromptStats{System: telemetry.EstimateTokens(system), History: telemetry.EstimateTokens(conv.String())}}, nil)
+	ctx, cancel := context.WithTimeout(ctx, taskTimeout)
+	defer cancel()
+	resp, err := a.provider.Chat(ctx, []providers.Message{
+		{Role: "system", Content: system},
+		{Role: "user", Content: conv.String()},
+	}, nil, a.model)
+	if err != nil {
+		return nil, err
+	}
+	return parseTasks(resp.Content, now)
+}
+
+// parseTasks reads the JSON array of the LLM's reply, ignoring text around
+// it. Tasks without a due time, or due in the past, are due at taskMorning
+// the next day.
+func parseTasks(reply string, now time.Time) ([]proposedTask, error) {
+	start, end := strings.Index(reply, "["), strings.LastIndex(reply, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no task list in reply %q", reply)
+	}
+	var raw []struct {
+		Task string `json:"task"`
+		Due  string `json:"due"`
+	}
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &raw); err != nil {
+		return nil, fmt.Errorf("invalid task list: %w", err)
+	}
+	morning := time.Date(now.Year(), now.Month(), now.Day()+1, taskMorning, 0, 0, 0, now.Location())
+	var tasks []proposedTask
+	for _, r := range raw {
+		text := strings.TrimSpace(r.Task)
+		if text == "" {
+			continue
+		}
+		due, err := time.Parse(time.RFC3339, r.Due)
+		if err != nil || !due.After(now) {
+			due = morning
+		}
+		tasks = append(tasks, proposedTask{Text: text, Due: due})
+	}
+	return tasks, nil
+}
+
+// proposeTasks keeps tasks as the chat's pending proposals and returns the
+// approval prompt.
+func (a *AgentLoop) proposeTasks(key string, tasks []proposedTask, now time.Time) string {
+	a.tasksMu.Lock()
+	defer a.tasksMu.Unlock()
+	if a.pendingTasks == nil {
+		a.pendingTasks = make(map[string][]proposedTask)
+	}
+	if len(tasks) == 0 {
+		delete(a.pendingTasks, key)
+		return ""
+	}
+	a.pendingTasks[key] = tasks
+	var b strings.Builder
+	b.WriteString("Commitments I noticed:\n")
+	for i, t := range tasks {
+		fmt.Fprintf(&b, "%d. %s (%s)\n", i+1, t.Text, t.Due.In(now.Location()).Format("Mon Jan 2 15:04"))
+	}
+	b.WriteString("\nReply /tasks accept all (or the numbers, e.g. /tasks accept 1 3) to get reminders, or /tasks dismiss.")
+	return b.String()
+}
+
+// tasksText answers /tasks: without arguments it looks for commitments in
+// the chat's recent conversation; "accept" schedules reminders for the
+// pending ones chosen, "dismiss" drops them.
+func (a *AgentLoop) tasksText(ctx context.Context, channel, chatID string, args []string) string {
+	key := channel + ":" + chatID
+	now := time.Now()
+	if len(args) == 0 {
+		tasks, err := a.extractTasks(ctx, key, now)
+		if err != nil {
+			log.Printf("error extracting tasks of %s: %v", key, err)
+			return "Sorry, I couldn't look for commitments: " + err.Error()
+		}
+		if len(tasks) == 0 {
+			return "I found no open commitments in the last day of this chat."
+		}
+		return a.proposeTasks(key, tasks, now)
+	}
+
+	a.tasksMu.Lock()
+	pending := a.pendingTasks[key]
+	delete(a.pendingTasks, key)
+	a.tasksMu.Unlock()
+	switch strings.ToLower(args[0]) {
+	case "dismiss":
+		return "OK, dropped them."
+	case "accept":
+	default:
+		return "Usage: /tasks, /tasks accept all|<numbers>, /tasks dismiss"
+	}
+	if len(pending) == 0 {
+		return "There are no proposed tasks. Use /tasks to look for some."
+	}
+	if a.scheduler == nil {
+		return "Reminders are not available here."
+	}
+	chosen := pending
+	if len(args) > 1 && !strings.EqualFold(args[1], "all") {
+		chosen = nil
+		for _, s := range args[1:] {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 || n > len(pending) {
+				a.tasksMu.Lock()
+				a.pendingTasks[key] = pending // let the user try again
+				a.tasksMu.Unlock()
+				return fmt.Sprintf("%q is not one of the tasks, 1 to %d.", s, len(pending))
+			}
+			chosen = append(chosen, pending[n-1])
+		}
+	}
+	var b strings.Builder
+	b.WriteString("Scheduled:\n")
+	for _, t := range chosen {
+		a.scheduler.Add("task", t.Text, t.Due.Sub(now), channel, chatID)
+		fmt.Fprintf(&b, "- %s (%s)\n", t.Text, t.Due.In(now.Location()).Format("Mon Jan 2 15:04"))
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// tasksSection proposes the commitments of the briefing chat's last day.
+func tasksSection(ctx context.Context, a *AgentLoop, b config.BriefingConfig, now time.Time) (string, error) {
+	key := b.Channel + ":" + b.ChatID
+	tasks, err := a.extractTasks(ctx, key, now)
+	if err != nil {
+		return "", err
+	}
+	return a.proposeTasks(key, tasks, now), nil
+}
@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/cron"
+	"github.com/local/picobot/internal/providers"
+	"github.com/local/picobot/internal/telemetry"
+)
+
+// taskProvider answers the task extraction prompt with a fixed list,
+// recording the conversation it was given.
+type taskProvider struct {
+	reply string
+	conv  string
+}
+
+func (p *taskProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string) (providers.LLMResponse, error) {
+	p.conv = messages[len(messages)-1].Content
+	return providers.LLMResponse{Content: p.reply}, nil
+}
+
+func (p *taskProvider) GetDefaultModel() string { return "main" }
+
+func TestTasksCommand(t *testing.T) {
+	due := time.Now().Add(3 * time.Hour).Truncate(time.Second)
+	p := &taskProvider{reply: `Sure: [{"task": "Send Ana the report", "due": "` + due.Format(time.RFC3339) + `"}, {"task": "Comprar pão", "due": ""}]`}
+	sched := cron.NewScheduler(func(cron.Job) {})
+	ws := t.TempDir()
+	ag := NewAgentLoop(chat.NewHub(10), p, "main", 3, ws, sched)
+	ag.archiveTurn("telegram:1", "vou mandar o relatório pra Ana hoje, e precisamos comprar pão", "Ok!")
+	msg := chat.Inbound{Channel: "telegram", SenderID: "u", ChatID: "1", Content: "/tasks"}
+
+	reply, ok := ag.handleCommand(msg)
+	if !ok || !strings.Contains(reply, "1. Send Ana the report") || !strings.Contains(reply, "2. Comprar pão") {
+		t.Fatalf("/tasks = %q, %v", reply, ok)
+	}
+	if !strings.Contains(p.conv, "user: vou mandar o relatório") {
+		t.Errorf("conversation not given to the LLM: %q", p.conv)
+	}
+	if recs, _ := telemetry.LoadPrompt(ws, 1); len(recs) != 1 || recs[0].Feature != "tasks" || recs[0].ChatID != "1" || recs[0].Stats.History == 0 {
+		t.Errorf("task extraction recorded as %+v", recs)
+	}
+
+	msg.Content = "/tasks accept 9"
+	if reply, _ := ag.handleCommand(msg); !strings.Contains(reply, "not one of the tasks") {
+		t.Fatalf("/tasks accept 9 = %q", reply)
+	}
+	msg.Content = "/tasks accept 1"
+	if reply, _ := ag.handleCommand(msg); !strings.HasPrefix(reply, "Scheduled:\n- Send Ana the report") {
+		t.Fatalf("/tasks accept 1 = %q", reply)
+	}
+	jobs := sched.List()
+	if len(jobs) != 1 || jobs[0].Message != "Send Ana the report" || jobs[0].ChatID != "1" || jobs[0].FireAt.Sub(due).Abs() > 2*time.Second {
+		t.Fatalf("scheduled jobs = %+v", jobs)
+	}
+	if reply, _ := ag.handleCommand(msg); !strings.Contains(reply, "no proposed tasks") {
+		t.Fatalf("accepted twice: %q", reply)
+	}
+}
+
+func TestParseTasksDefaultsToNextMorning(t *testing.T) {
+	now := time.Date(2026, 10, 17, 20, 0, 0, 0, time.UTC)
+	tasks, err := parseTasks(`[{"task":"Call the plumber","due":"2026-10-16T10:00:00Z"},{"task":" "}]`, now)
+	if err != nil || len(tasks) != 1 {
+		t.Fatalf("parseTasks = %+v, %v", tasks, err)
+	}
+	if want := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC); !tasks[0].Due.Equal(want) {
+		t.Errorf("due %v, want %v", tasks[0].Due, want)
+	}
+	if _, err := parseTasks("nothing here", now); err == nil {
+		t.Error("expected an error without a list")
+	}
+}
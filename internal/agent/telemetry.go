@@ -0,0 +1,148 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/providers"
+	"github.com/local/picobot/internal/telemetry"
+)
+
+// recordPromptStats logs the composition of a turn's prompt (including the
+// tool definitions sent with it) to the workspace telemetry.
+func (a *AgentLoop) recordPromptStats(rec telemetry.PromptRecord, toolDefs []providers.ToolDefinition) {
+	rec.Stats.Tools = toolDefTokens(toolDefs)
+	if err := telemetry.RecordPrompt(a.workspace, rec); err != nil {
+		log.Printf("telemetry: failed to record prompt stats: %v", err)
+	}
+}
+
+// toolDefTokens estimates the prompt tokens of the tool definitions.
+func toolDefTokens(toolDefs []providers.ToolDefinition) int {
+	b, err := json.Marshal(toolDefs)
+	if err != nil {
+		return 0
+	}
+	return telemetry.EstimateTokens(string(b))
+}
+
+// skillHostRE finds the hosts a skill's instructions reach: in URLs, and
+// before the path of a scheme-less one such as "wttr.in/London".
+var skillHostRE = regexp.MustCompile(`(?i)(?:://|[\s"'(])((?:[a-z0-9-]+\.)+[a-z]{2,})[/:?]`)
+
+// turnFeature names what a turn's tokens were spent on, from the tool calls
+// it made: the skill read with read_skill, or whose hosts (those its
+// SKILL.md mentions) a tool call reached; else the first tool called; else
+// plain chat.
+func (a *AgentLoop) turnFeature(calls []telemetry.TraceCall) string {
+	var toolCalls []telemetry.TraceToolCall
+	for _, c := range calls {
+		toolCalls = append(toolCalls, c.ToolCalls...)
+	}
+	if len(toolCalls) == 0 {
+		return telemetry.FeatureChat
+	}
+	for _, tc := range toolCalls {
+		if name, _ := tc.Arguments["name"].(string); tc.Name == "read_skill" && name != "" {
+			return "skill:" + name
+		}
+	}
+	index := a.skillHosts.load(a)
+	for _, tc := range toolCalls {
+		b, _ := json.Marshal(tc.Arguments)
+		args := strings.ToLower(string(b))
+		for _, skill := range index {
+			for _, host := range skill.hosts {
+				if strings.Contains(args, host) {
+					return "skill:" + skill.name
+				}
+			}
+		}
+	}
+	return "tool:" + toolCalls[0].Name
+}
+
+// skillHostIndex caches the hosts each skill's SKILL.md mentions, so that
+// turnFeature reads the skills again only when one of them changed.
+type skillHostIndex struct {
+	mu     sync.Mutex
+	stamp  string // of the SKILL.md files indexed, see skillsStamp
+	skills []skillHosts
+}
+
+// skillHosts are the hosts, in lower case, a skill mentions.
+type skillHosts struct {
+	name  string
+	hosts []string
+}
+
+// load returns the index of a's skills, rebuilt when the SKILL.md files
+// changed since it was last built.
+func (x *skillHostIndex) load(a *AgentLoop) []skillHosts {
+	stamp := skillsStamp(a.workspace)
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if stamp == x.stamp && x.skills != nil {
+		return x.skills
+	}
+	loaded, err := a.context.skillsLoader.LoadAll()
+	if err != nil {
+		log.Printf("error loading skills: %v", err)
+	}
+	x.skills = make([]skillHosts, 0, len(loaded))
+	for _, skill := range loaded {
+		sh := skillHosts{name: skill.Name}
+		for _, m := range skillHostRE.FindAllStringSubmatch(skill.Content, -1) {
+			sh.hosts = append(sh.hosts, strings.ToLower(m[1]))
+		}
+		x.skills = append(x.skills, sh)
+	}
+	x.stamp = stamp
+	return x.skills
+}
+
+// skillsStamp identifies the state of the workspace's SKILL.md files by
+// their names, sizes and modification times.
+func skillsStamp(workspace string) string {
+	dir := filepath.Join(workspace, "skills")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, e := range entries {
+		if fi, err := os.Stat(filepath.Join(dir, e.Name(), "SKILL.md")); err == nil {
+			fmt.Fprintf(&b, "%s:%d:%d;", e.Name(), fi.Size(), fi.ModTime().UnixNano())
+		}
+	}
+	return b.String()
+}
+
+// recordFailure logs a failed turn, sampled with seed, to the workspace trace
+// log and returns the trace ID to show the user.
+func (a *AgentLoop) recordFailure(msg chat.Inbound, model string, seed int64, iterations int, toolsCalled []string, calls []telemetry.TraceCall, err error) string {
+	rec := telemetry.TraceRecord{
+		ID:         telemetry.NewTraceID(),
+		Channel:    msg.Channel,
+		ChatID:     msg.ChatID,
+		SenderID:   msg.SenderID,
+		Model:      model,
+		Seed:       seed,
+		Iterations: iterations,
+		Tools:      toolsCalled,
+		Message:    msg.Content,
+		Calls:      calls,
+		Error:      err.Error(),
+	}
+	if werr := telemetry.RecordTrace(a.workspace, rec); werr != nil {
+		log.Printf("telemetry: failed to record trace %s: %v", rec.ID, werr)
+	}
+	return rec.ID
+}
@@ -0,0 +1,69 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/telemetry"
+)
+
+func TestTurnFeature(t *testing.T) {
+	ws := t.TempDir()
+	dir := filepath.Join(ws, "skills", "weather")
+	os.MkdirAll(dir, 0o755)
+	skill := "---\nname: weather\ndescription: Weather\n---\n\n```bash\ncurl -s \"wttr.in/London?format=3\"\n```\n"
+	if err := os.WriteFile(filepath.Join(dir, "SKILL.md"), []byte(skill), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ag := NewAgentLoop(chat.NewHub(10), &modelRecorder{}, "main", 3, ws, nil)
+	call := func(name string, args map[string]interface{}) []telemetry.TraceCall {
+		return []telemetry.TraceCall{{ToolCalls: []telemetry.TraceToolCall{{Name: name, Arguments: args}}}}
+	}
+
+	cases := []struct {
+		calls []telemetry.TraceCall
+		want  string
+	}{
+		{nil, "chat"},
+		{call("exec", map[string]interface{}{"cmd": `curl -s "wttr.in/Paris?format=3"`}), "skill:weather"},
+		{call("read_skill", map[string]interface{}{"name": "cron"}), "skill:cron"},
+		{call("web_fetch", map[string]interface{}{"url": "https://go.dev/"}), "tool:web_fetch"},
+	}
+	for _, c := range cases {
+		if got := ag.turnFeature(c.calls); got != c.want {
+			t.Errorf("turnFeature(%+v) = %q, want %q", c.calls, got, c.want)
+		}
+	}
+
+	// The skills are indexed once, and again only when a SKILL.md changes.
+	before := ag.skillHosts.stamp
+	ag.turnFeature(call("exec", map[string]interface{}{"cmd": "ls"}))
+	if ag.skillHosts.stamp != before {
+		t.Fatal("skills indexed again without a change")
+	}
+	skill = strings.Replace(skill, "wttr.in/London", "api.open-meteo.com/v1", 1)
+	if err := os.WriteFile(filepath.Join(dir, "SKILL.md"), []byte(skill), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := ag.turnFeature(call("web_fetch", map[string]interface{}{"url": "https://api.open-meteo.com/v1/forecast"})); got != "skill:weather" {
+		t.Fatalf("after editing the skill, turnFeature = %q", got)
+	}
+}
+
+// promptFeatures returns the features of the prompt records of workspace, in
+// the order they were recorded.
+func promptFeatures(t *testing.T, workspace string) []string {
+	t.Helper()
+	recs, err := telemetry.LoadPrompt(workspace, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var features []string
+	for _, r := range recs {
+		features = append(features, r.FeatureName())
+	}
+	return features
+}
@@ -0,0 +1,94 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+// buttonChannels are the channels that can render buttons.
+var buttonChannels = map[string]bool{"whatsapp": true}
+
+// SendButtonsTool sends a message with reply buttons to the chat of the
+// message being answered, set with SetContext. The button tapped comes back
+// as the user's next message, its "button_id" metadata set.
+type SendButtonsTool struct {
+	hub     *chat.Hub
+	channel string
+	chatID  string
+}
+
+func NewSendButtonsTool(b *chat.Hub) *SendButtonsTool {
+	return &SendButtonsTool{hub: b}
+}
+
+func (t *SendButtonsTool) Name() string { return "send_buttons" }
+func (t *SendButtonsTool) Description() string {
+	return "Send a message with buttons the user can tap to answer (WhatsApp only). The choice comes back as the user's next message."
+}
+
+func (t *SendButtonsTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"text": map[string]interface{}{
+				"type":        "string",
+				"description": "The message, usually a question (1-1024 characters)",
+			},
+			"options": map[string]interface{}{
+				"type":        "array",
+				"description": "The choices offered (1-10, each 1-24 characters); up to 3 are shown as buttons, more as a list",
+				"items": map[string]interface{}{
+					"type": "string",
+				},
+			},
+		},
+		"required": []string{"text", "options"},
+	}
+}
+
+// SetContext sets the current channel and chat id for the buttons.
+func (t *SendButtonsTool) SetContext(channel, chatID string) {
+	t.channel = channel
+	t.chatID = chatID
+}
+
+// Expected args: {"text": "...", "options": ["a", "b"]}
+func (t *SendButtonsTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	if !buttonChannels[t.channel] {
+		return "", fmt.Errorf("send_buttons: buttons are not supported on channel %q", t.channel)
+	}
+	text, _ := args["text"].(string)
+	text = strings.TrimSpace(text)
+	if text == "" || len([]rune(text)) > 1024 {
+		return "", fmt.Errorf("send_buttons: 'text' must be 1-1024 characters")
+	}
+	raw, _ := args["options"].([]interface{})
+	if len(raw) < 1 || len(raw) > 10 {
+		return "", fmt.Errorf("send_buttons: 'options' must have 1-10 entries")
+	}
+	var buttons []chat.Button
+	for _, o := range raw {
+		s, _ := o.(string)
+		s = strings.TrimSpace(s)
+		if s == "" || len([]rune(s)) > 24 {
+			return "", fmt.Errorf("send_buttons: each option must be 1-24 characters")
+		}
+		buttons = append(buttons, chat.Button{ID: s, Text: s})
+	}
+
+	out := chat.Outbound{
+		Channel:  t.channel,
+		ChatID:   t.chatID,
+		Content:  text,
+		Metadata: map[string]interface{}{"buttons": buttons},
+	}
+	select {
+	case t.hub.Out <- out:
+		return "buttons sent", nil
+	default:
+		return "", fmt.Errorf("outbound channel full")
+	}
+}
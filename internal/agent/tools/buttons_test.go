@@ -0,0 +1,32 @@
+package tools
+
+import (
+	"context"
+	"testing"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+func TestSendButtonsTool(t *testing.T) {
+	hub := chat.NewHub(1)
+	bt := NewSendButtonsTool(hub)
+
+	args := map[string]interface{}{"text": "Confirm the booking?", "options": []interface{}{"Yes", "No"}}
+	bt.SetContext("telegram", "1")
+	if _, err := bt.Execute(context.Background(), args); err == nil {
+		t.Fatal("expected an error on a channel without buttons")
+	}
+
+	bt.SetContext("whatsapp", "15551234567@s.whatsapp.net")
+	if _, err := bt.Execute(context.Background(), map[string]interface{}{"text": "Confirm?", "options": []interface{}{"a much too long option for a button"}}); err == nil {
+		t.Fatal("expected an error for an overlong option")
+	}
+	if _, err := bt.Execute(context.Background(), args); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	out := <-hub.Out
+	b, ok := out.Metadata["buttons"].([]chat.Button)
+	if !ok || out.Content != "Confirm the booking?" || len(b) != 2 || b[1] != (chat.Button{ID: "No", Text: "No"}) {
+		t.Fatalf("unexpected outbound: %+v", out)
+	}
+}
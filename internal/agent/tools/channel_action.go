@@ -0,0 +1,120 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+// channelActions lists the actions each channel supports, with the outbound
+// directive (see chat.Outbound) that carries them.
+var channelActions = map[string]map[string]string{
+	"telegram": {"pin": "pin_message", "unpin": "unpin", "set_title": "chat_title", "set_description": "chat_description"},
+	"whatsapp": {"set_title": "chat_title", "set_description": "chat_description", "save": "star"},
+}
+
+// ChannelActionTool performs channel-native chat-ops actions on the current
+// chat: pinning an existing message, renaming the chat, changing its
+// description, or saving a message (WhatsApp's starred messages). Only
+// admins may use it; it holds the chat, the message being answered and
+// whether its sender is an admin, set per incoming message.
+type ChannelActionTool struct {
+	hub       *chat.Hub
+	channel   string
+	chatID    string
+	messageID string
+	admin     bool
+}
+
+func NewChannelActionTool(b *chat.Hub) *ChannelActionTool {
+	return &ChannelActionTool{hub: b}
+}
+
+func (t *ChannelActionTool) Name() string { return "channel_action" }
+func (t *ChannelActionTool) Description() string {
+	return "Perform a chat-ops action on the current chat, for admins only: pin a message (the user's current one unless message_id is given) or unpin the latest pinned one (Telegram), set the chat title or description (Telegram, WhatsApp groups; the bot must be allowed to change them), or save a message to the starred messages (WhatsApp)."
+}
+
+func (t *ChannelActionTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"pin", "unpin", "set_title", "set_description", "save"},
+				"description": "The action to perform",
+			},
+			"value": map[string]interface{}{
+				"type":        "string",
+				"description": "The new title or description, for set_title and set_description",
+			},
+			"message_id": map[string]interface{}{
+				"type":        "string",
+				"description": "The message to pin or save (default: the user's current message)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+// SetContext sets the chat to act on.
+func (t *ChannelActionTool) SetContext(channel, chatID string) {
+	t.channel = channel
+	t.chatID = chatID
+}
+
+// SetSender sets the message being answered and whether its sender is an
+// admin of the channel.
+func (t *ChannelActionTool) SetSender(messageID string, admin bool) {
+	t.messageID = messageID
+	t.admin = admin
+}
+
+// Expected args: {"action": "set_title", "value": "Trip to Lisbon 🇵🇹"} or {"action": "pin"}
+func (t *ChannelActionTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	if !t.admin {
+		return "", fmt.Errorf("channel_action: only admins may change the chat")
+	}
+	action, _ := args["action"].(string)
+	supported := channelActions[t.channel]
+	directive, ok := supported[action]
+	if !ok {
+		var names []string
+		for name := range supported {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return "", fmt.Errorf("channel_action: channel %q supports no actions", t.channel)
+		}
+		return "", fmt.Errorf("channel_action: %q is not supported on %s (supported: %s)", action, t.channel, strings.Join(names, ", "))
+	}
+	var value interface{} = true
+	switch action {
+	case "set_title", "set_description":
+		v, _ := args["value"].(string)
+		if action == "set_title" && strings.TrimSpace(v) == "" {
+			return "", fmt.Errorf("channel_action: 'value' argument required for set_title")
+		}
+		value = v
+	case "pin", "save":
+		id, _ := args["message_id"].(string)
+		if id == "" {
+			id = t.messageID
+		}
+		if id == "" {
+			return "", fmt.Errorf("channel_action: no message to %s, give message_id", action)
+		}
+		value = id
+	}
+	out := chat.Outbound{Channel: t.channel, ChatID: t.chatID, Metadata: map[string]interface{}{directive: value}}
+	select {
+	case t.hub.Out <- out:
+		return fmt.Sprintf("%s requested", strings.ReplaceAll(action, "_", " ")), nil
+	default:
+		return "", fmt.Errorf("outbound channel full")
+	}
+}
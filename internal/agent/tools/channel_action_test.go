@@ -0,0 +1,44 @@
+package tools
+
+import (
+	"context"
+	"testing"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+func TestChannelActionTool(t *testing.T) {
+	hub := chat.NewHub(2)
+	at := NewChannelActionTool(hub)
+	at.SetContext("telegram", "-100")
+
+	at.SetSender("55", false)
+	if _, err := at.Execute(context.Background(), map[string]interface{}{"action": "pin"}); err == nil {
+		t.Fatal("expected an error for a non-admin")
+	}
+
+	at.SetSender("55", true)
+	if _, err := at.Execute(context.Background(), map[string]interface{}{"action": "save"}); err == nil {
+		t.Fatal("expected an error for an action Telegram lacks")
+	}
+	if _, err := at.Execute(context.Background(), map[string]interface{}{"action": "pin"}); err != nil {
+		t.Fatalf("pin: %v", err)
+	}
+	if out := <-hub.Out; out.ChatID != "-100" || out.Content != "" || out.Metadata["pin_message"] != "55" {
+		t.Fatalf("unexpected outbound: %+v", out)
+	}
+	if _, err := at.Execute(context.Background(), map[string]interface{}{"action": "set_title", "value": "Trip"}); err != nil {
+		t.Fatalf("set_title: %v", err)
+	}
+	if out := <-hub.Out; out.Metadata["chat_title"] != "Trip" {
+		t.Fatalf("unexpected outbound: %+v", out)
+	}
+
+	at.SetContext("whatsapp", "120363@g.us")
+	if _, err := at.Execute(context.Background(), map[string]interface{}{"action": "save", "message_id": "ABC"}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if out := <-hub.Out; out.Metadata["star"] != "ABC" {
+		t.Fatalf("unexpected outbound: %+v", out)
+	}
+}
@@ -0,0 +1,45 @@
+package tools
+
+import (
+	"os"
+	"strings"
+)
+
+// Credential is a secret handed to the exec and web tools: as environment
+// variable Env to commands, and as header Header on requests to Host. A
+// credential with an empty Value is withheld: its variable is removed from
+// the environment commands inherit, and no header is sent.
+type Credential struct {
+	Name   string
+	Env    string
+	Host   string
+	Header string
+	Value  string
+}
+
+// credentialEnv returns the environment for a command: picobot's own, without
+// the variables of any credential, plus those of the credentials not withheld.
+func credentialEnv(creds []Credential) []string {
+	if len(creds) == 0 {
+		return nil // inherit
+	}
+	hidden := map[string]bool{}
+	for _, c := range creds {
+		if c.Env != "" {
+			hidden[c.Env] = true
+		}
+	}
+	var env []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if !hidden[name] {
+			env = append(env, kv)
+		}
+	}
+	for _, c := range creds {
+		if c.Env != "" && c.Value != "" {
+			env = append(env, c.Env+"="+c.Value)
+		}
+	}
+	return env
+}
@@ -0,0 +1,49 @@
+package tools
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExecCredentialEnv(t *testing.T) {
+	t.Setenv("VPN_TOKEN", "inherited")
+	e := NewExecTool(2)
+	run := func() string {
+		// printenv fails when a variable is unset, but prints the others.
+		out, _ := e.Execute(context.Background(), map[string]interface{}{"cmd": []interface{}{"printenv", "HA_TOKEN", "VPN_TOKEN"}})
+		return strings.TrimSpace(out)
+	}
+	e.SetCredentials([]Credential{{Name: "ha", Env: "HA_TOKEN", Value: "secret"}, {Name: "vpn", Env: "VPN_TOKEN"}})
+	if got := run(); got != "secret" {
+		t.Fatalf("in scope: got %q, want only HA_TOKEN", got)
+	}
+	e.SetCredentials([]Credential{{Name: "ha", Env: "HA_TOKEN"}, {Name: "vpn", Env: "VPN_TOKEN"}})
+	if got := run(); got != "" {
+		t.Fatalf("withheld: got %q", got)
+	}
+}
+
+func TestWebCredentialHeader(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Authorization")
+	}))
+	defer srv.Close()
+
+	w := NewWebTool()
+	w.SetCredentials([]Credential{{Name: "ha", Host: "127.0.0.1", Header: "Authorization", Value: "Bearer abc"}})
+	if _, err := w.Execute(context.Background(), map[string]interface{}{"url": srv.URL}); err != nil {
+		t.Fatal(err)
+	}
+	if got != "Bearer abc" {
+		t.Fatalf("Authorization = %q", got)
+	}
+	w.SetCredentials([]Credential{{Name: "ha", Host: "127.0.0.1", Header: "Authorization"}})
+	w.Execute(context.Background(), map[string]interface{}{"url": srv.URL})
+	if got != "" {
+		t.Fatalf("withheld credential sent: %q", got)
+	}
+}
@@ -44,6 +44,14 @@ func (t *CronTool) Parameters() map[string]interface{} {
 				"type":        "string",
 				"description": "The reminder message or task description to deliver when the job fires",
 			},
+			"template": map[string]interface{}{
+				"type":        "string",
+				"description": "Instead of message: name of a notification template in the workspace's templates/ directory, sent as is, rendered with vars, when the job fires",
+			},
+			"vars": map[string]interface{}{
+				"type":        "object",
+				"description": "Variables for the template",
+			},
 			"delay": map[string]interface{}{
 				"type":        "string",
 				"description": "How long to wait before first firing, e.g. '2m', '1h30m', '30s', '1h'. Uses Go duration format.",
@@ -77,12 +85,14 @@ func (t *CronTool) Execute(ctx context.Context, args map[string]interface{}) (st
 		delayStr, _ := args["delay"].(string)
 		recurring, _ := args["recurring"].(bool)
 		intervalStr, _ := args["interval"].(string)
+		tmpl, _ := args["template"].(string)
+		vars, _ := args["vars"].(map[string]interface{})
 
 		if name == "" {
 			name = "reminder"
 		}
-		if message == "" {
-			return "", fmt.Errorf("cron add: 'message' is required")
+		if message == "" && tmpl == "" {
+			return "", fmt.Errorf("cron add: 'message' or 'template' is required")
 		}
 		if delayStr == "" {
 			return "", fmt.Errorf("cron add: 'delay' is required (e.g. '2m', '1h')")
@@ -109,11 +119,19 @@ func (t *CronTool) Execute(ctx context.Context, args map[string]interface{}) (st
 			if interval < 2*time.Minute {
 				return "", fmt.Errorf("cron add: recurring interval must be at least 2m (got %v)", interval)
 			}
+			if tmpl != "" {
+				id := t.scheduler.AddTemplated(name, tmpl, vars, delay, interval, t.channel, t.chatID)
+				return fmt.Sprintf("Scheduled recurring job %q (id: %s) from template %q. Will fire in %v, then repeat every %v.", name, id, tmpl, delay, interval), nil
+			}
 			id := t.scheduler.AddRecurring(name, message, interval, t.channel, t.chatID)
 			return fmt.Sprintf("Scheduled recurring job %q (id: %s). Will fire in %v, then repeat every %v.", name, id, delay, interval), nil
 		}
 
 		// One-time job
+		if tmpl != "" {
+			id := t.scheduler.AddTemplated(name, tmpl, vars, delay, 0, t.channel, t.chatID)
+			return fmt.Sprintf("Scheduled job %q (id: %s) from template %q. Will fire in %v.", name, id, tmpl, delay), nil
+		}
 		id := t.scheduler.Add(name, message, delay, t.channel, t.chatID)
 		return fmt.Sprintf("Scheduled job %q (id: %s). Will fire in %v.", name, id, delay), nil
 
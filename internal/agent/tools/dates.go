@@ -0,0 +1,337 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// datesFile is the workspace file holding the tracked dates.
+const datesFile = "dates.json"
+
+// Date is a yearly date worth remembering, like a birthday or an anniversary.
+type Date struct {
+	Name    string `json:"name"` // whose date it is, e.g. "Ana"
+	Kind    string `json:"kind"` // "birthday", "anniversary", ...
+	Month   int    `json:"month"`
+	Day     int    `json:"day"`
+	Year    int    `json:"year,omitempty"` // of the first occurrence, if known
+	Channel string `json:"channel"`
+	ChatID  string `json:"chat_id"`
+	// Greet sends a greeting to the chat on the day itself; otherwise the
+	// chat is reminded RemindDays days before.
+	Greet      bool `json:"greet,omitempty"`
+	RemindDays int  `json:"remind_days,omitempty"`
+	// Notified is the occurrence ("2006-01-02") last notified.
+	Notified string `json:"notified,omitempty"`
+}
+
+// Next returns the next occurrence of d on or after the day of t. A 29
+// February date falls on 28 February in common years.
+func (d Date) Next(t time.Time) time.Time {
+	today := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	for y := t.Year(); ; y++ {
+		day := d.Day
+		if d.Month == 2 && day == 29 && !isLeap(y) {
+			day = 28
+		}
+		if occ := time.Date(y, time.Month(d.Month), day, 0, 0, 0, 0, t.Location()); !occ.Before(today) {
+			return occ
+		}
+	}
+}
+
+// DaysUntil returns how many days from the day of t to the next occurrence.
+func (d Date) DaysUntil(t time.Time) int {
+	today := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return int(d.Next(t).Sub(today).Hours()/24 + 0.5)
+}
+
+// Describe tells what the next occurrence is and when, e.g. "Ana's birthday
+// (turning 30) on Mar 14, in 3 days".
+func (d Date) Describe(t time.Time) string {
+	next := d.Next(t)
+	s := fmt.Sprintf("%s's %s", d.Name, d.Kind)
+	if d.Year > 0 {
+		n := next.Year() - d.Year
+		if d.Kind == "birthday" {
+			s += fmt.Sprintf(" (turning %d)", n)
+		} else {
+			s += fmt.Sprintf(" (%d years)", n)
+		}
+	}
+	switch days := d.DaysUntil(t); days {
+	case 0:
+		return s + " is today"
+	case 1:
+		return s + " is tomorrow"
+	default:
+		return fmt.Sprintf("%s on %s, in %d days", s, next.Format("Jan 2"), days)
+	}
+}
+
+func isLeap(y int) bool {
+	return y%4 == 0 && (y%100 != 0 || y%400 == 0)
+}
+
+// DateStore keeps the dates of every chat in dates.json in the workspace.
+type DateStore struct {
+	mu   sync.Mutex
+	root *os.Root
+}
+
+// NewDateStore creates a store backed by the workspace root.
+func NewDateStore(root *os.Root) *DateStore {
+	return &DateStore{root: root}
+}
+
+func (s *DateStore) load() ([]Date, error) {
+	b, err := s.root.ReadFile(datesFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var ds []Date
+	if err := json.Unmarshal(b, &ds); err != nil {
+		return nil, fmt.Errorf("%s: %w", datesFile, err)
+	}
+	return ds, nil
+}
+
+func (s *DateStore) save(ds []Date) error {
+	b, err := json.MarshalIndent(ds, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.root.WriteFile(datesFile, b, 0o644)
+}
+
+// Put adds d, replacing the chat's date of the same name and kind. With
+// remove set, the date is only removed; it reports whether one existed.
+func (s *DateStore) Put(d Date, remove bool) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ds, err := s.load()
+	if err != nil {
+		return false, err
+	}
+	kept := ds[:0]
+	for _, o := range ds {
+		if !(o.Channel == d.Channel && o.ChatID == d.ChatID && strings.EqualFold(o.Name, d.Name) && strings.EqualFold(o.Kind, d.Kind)) {
+			kept = append(kept, o)
+		}
+	}
+	found := len(kept) < len(ds)
+	if !remove {
+		kept = append(kept, d)
+	}
+	return found, s.save(kept)
+}
+
+// Upcoming returns the chat's dates occurring within days of t, soonest
+// first.
+func (s *DateStore) Upcoming(channel, chatID string, t time.Time, days int) ([]Date, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ds, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	var out []Date
+	for _, d := range ds {
+		if d.Channel == channel && d.ChatID == chatID && d.DaysUntil(t) <= days {
+			out = append(out, d)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].DaysUntil(t) < out[j].DaysUntil(t) })
+	return out, nil
+}
+
+// Due returns the dates whose greeting or reminder is due at t and not sent
+// yet, and records them as notified. A notification missed while picobot
+// was down is still sent later, until the day has passed.
+func (s *DateStore) Due(t time.Time) ([]Date, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ds, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	var due []Date
+	for i := range ds {
+		lead := ds[i].RemindDays
+		if ds[i].Greet {
+			lead = 0
+		}
+		occ := ds[i].Next(t).Format("2006-01-02")
+		if ds[i].DaysUntil(t) <= lead && ds[i].Notified != occ {
+			ds[i].Notified = occ
+			due = append(due, ds[i])
+		}
+	}
+	if len(due) == 0 {
+		return nil, nil
+	}
+	return due, s.save(ds)
+}
+
+// AddDateTool records (or removes) a birthday, anniversary or other yearly
+// date. A date belongs to the chat of the message being answered, set with
+// SetContext: its reminders and greetings are posted there.
+type AddDateTool struct {
+	store   *DateStore
+	channel string
+	chatID  string
+}
+
+func NewAddDateTool(store *DateStore) *AddDateTool {
+	return &AddDateTool{store: store}
+}
+
+func (t *AddDateTool) Name() string { return "add_date" }
+func (t *AddDateTool) Description() string {
+	return "Remember a birthday, anniversary or other yearly date. Every year this chat is reminded ahead of it, or greeted on the day."
+}
+
+func (t *AddDateTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"name": map[string]interface{}{
+				"type":        "string",
+				"description": "Whose date it is, e.g. 'Ana' or 'Ana and Bruno'",
+			},
+			"date": map[string]interface{}{
+				"type":        "string",
+				"description": "The date as 'YYYY-MM-DD' (the year gives the age) or 'MM-DD' when the year is unknown",
+			},
+			"kind": map[string]interface{}{
+				"type":        "string",
+				"description": "What the date is: 'birthday' (default), 'anniversary', ...",
+			},
+			"greet": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Greet in this chat on the day itself (e.g. a group the person is in) instead of reminding it beforehand",
+			},
+			"remind_days_before": map[string]interface{}{
+				"type":        "integer",
+				"description": "When not greeting: how many days ahead to remind (default 1, 0 = on the day)",
+			},
+			"remove": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Forget the date of this name and kind instead",
+			},
+		},
+		"required": []string{"name"},
+	}
+}
+
+// SetContext sets the chat to notify.
+func (t *AddDateTool) SetContext(channel, chatID string) {
+	t.channel = channel
+	t.chatID = chatID
+}
+
+// Expected args: {"name": "Ana", "date": "1996-03-14", "kind": "birthday", "greet": false, "remind_days_before": 1}
+func (t *AddDateTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	name, _ := args["name"].(string)
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("add_date: 'name' argument required")
+	}
+	d := Date{Name: name, Kind: "birthday", Channel: t.channel, ChatID: t.chatID, RemindDays: 1}
+	if k, _ := args["kind"].(string); strings.TrimSpace(k) != "" {
+		d.Kind = strings.ToLower(strings.TrimSpace(k))
+	}
+	if remove, _ := args["remove"].(bool); remove {
+		found, err := t.store.Put(d, true)
+		if err != nil {
+			return "", err
+		}
+		if !found {
+			return "", fmt.Errorf("add_date: no %s of %s in this chat", d.Kind, name)
+		}
+		return fmt.Sprintf("%s's %s forgotten", name, d.Kind), nil
+	}
+	raw, _ := args["date"].(string)
+	if tm, err := time.Parse("2006-01-02", raw); err == nil {
+		d.Year, d.Month, d.Day = tm.Year(), int(tm.Month()), tm.Day()
+	} else if tm, err := time.Parse("01-02", raw); err == nil {
+		d.Month, d.Day = int(tm.Month()), tm.Day()
+	} else {
+		return "", fmt.Errorf("add_date: 'date' must look like 1996-03-14 or 03-14")
+	}
+	d.Greet, _ = args["greet"].(bool)
+	if n, ok := args["remind_days_before"].(float64); ok {
+		if n < 0 || n > 60 {
+			return "", fmt.Errorf("add_date: 'remind_days_before' must be between 0 and 60")
+		}
+		d.RemindDays = int(n)
+	}
+	if _, err := t.store.Put(d, false); err != nil {
+		return "", err
+	}
+	return "saved: " + d.Describe(time.Now()), nil
+}
+
+// UpcomingDatesTool lists the dates coming up in the current chat.
+type UpcomingDatesTool struct {
+	store   *DateStore
+	channel string
+	chatID  string
+}
+
+func NewUpcomingDatesTool(store *DateStore) *UpcomingDatesTool {
+	return &UpcomingDatesTool{store: store}
+}
+
+func (t *UpcomingDatesTool) Name() string { return "upcoming_dates" }
+func (t *UpcomingDatesTool) Description() string {
+	return "List the birthdays, anniversaries and other dates remembered in this chat that are coming up, soonest first"
+}
+
+func (t *UpcomingDatesTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"days": map[string]interface{}{
+				"type":        "integer",
+				"description": "How many days ahead to look (default 30, at most 366)",
+			},
+		},
+	}
+}
+
+// SetContext sets the chat whose dates are listed.
+func (t *UpcomingDatesTool) SetContext(channel, chatID string) {
+	t.channel = channel
+	t.chatID = chatID
+}
+
+// Expected args: {"days": 30}
+func (t *UpcomingDatesTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	days := 30
+	if n, ok := args["days"].(float64); ok && n >= 0 {
+		days = min(int(n), 366)
+	}
+	now := time.Now()
+	ds, err := t.store.Upcoming(t.channel, t.chatID, now, days)
+	if err != nil {
+		return "", err
+	}
+	if len(ds) == 0 {
+		return fmt.Sprintf("no dates in the next %d days", days), nil
+	}
+	lines := make([]string, len(ds))
+	for i, d := range ds {
+		lines[i] = d.Describe(now)
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,70 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDateTools(t *testing.T) {
+	root, err := os.OpenRoot(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+	store := NewDateStore(root)
+	add := NewAddDateTool(store)
+	upcoming := NewUpcomingDatesTool(store)
+	add.SetContext("telegram", "1")
+	upcoming.SetContext("telegram", "1")
+
+	in3 := time.Now().AddDate(0, 0, 3)
+	res, err := add.Execute(context.Background(), map[string]interface{}{"name": "Ana", "date": in3.AddDate(-30, 0, 0).Format("2006-01-02")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(res, "Ana's birthday (turning 30) on "+in3.Format("Jan 2")+", in 3 days") {
+		t.Fatalf("unexpected add_date result: %q", res)
+	}
+	if _, err := add.Execute(context.Background(), map[string]interface{}{"name": "Ana and Bruno", "kind": "Anniversary", "date": time.Now().AddDate(0, 2, 0).Format("01-02"), "greet": true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := add.Execute(context.Background(), map[string]interface{}{"name": "X", "date": "14/03"}); err == nil {
+		t.Fatal("expected an error for a malformed date")
+	}
+	if got, _ := upcoming.Execute(context.Background(), map[string]interface{}{"days": 7.0}); !strings.HasPrefix(got, "Ana's birthday") || strings.Contains(got, "anniversary") {
+		t.Fatalf("unexpected upcoming_dates result: %q", got)
+	}
+
+	// Reminded the day before, once.
+	if due, _ := store.Due(time.Now()); len(due) != 0 {
+		t.Fatalf("nothing should be due yet, got %+v", due)
+	}
+	dayBefore := time.Now().AddDate(0, 0, 2)
+	due, err := store.Due(dayBefore)
+	if err != nil || len(due) != 1 || due[0].Describe(dayBefore) != "Ana's birthday (turning 30) is tomorrow" {
+		t.Fatalf("unexpected due dates: %+v (%v)", due, err)
+	}
+	if due, _ := store.Due(in3); len(due) != 0 {
+		t.Fatalf("a date must be notified once a year, got %+v", due)
+	}
+
+	if _, err := add.Execute(context.Background(), map[string]interface{}{"name": "ana", "remove": true}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := upcoming.Execute(context.Background(), map[string]interface{}{"days": 7.0}); got != "no dates in the next 7 days" {
+		t.Fatalf("date was not removed: %q", got)
+	}
+}
+
+func TestDateLeapDay(t *testing.T) {
+	d := Date{Name: "Leo", Kind: "birthday", Month: 2, Day: 29}
+	if got := d.Next(time.Date(2027, 1, 10, 12, 0, 0, 0, time.UTC)); got.Format("2006-01-02") != "2027-02-28" {
+		t.Fatalf("leap-day birthday in a common year: %s", got)
+	}
+	if got := d.Next(time.Date(2028, 2, 29, 12, 0, 0, 0, time.UTC)); got.Format("2006-01-02") != "2028-02-29" {
+		t.Fatalf("leap-day birthday in a leap year: %s", got)
+	}
+}
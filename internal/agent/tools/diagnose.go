@@ -0,0 +1,52 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+)
+
+// DiagnoseSelfTool reports the bot's own health, so an admin can ask why it
+// is slow or deaf: queue depths, recent turn times, the last provider
+// error, the provider's API key in use, channel status and disk usage. The report itself is built by the
+// agent (see SetReport); only admins may read it.
+type DiagnoseSelfTool struct {
+	report func() string
+	admin  bool
+}
+
+func NewDiagnoseSelfTool() *DiagnoseSelfTool {
+	return &DiagnoseSelfTool{}
+}
+
+func (t *DiagnoseSelfTool) Name() string { return "diagnose_self" }
+func (t *DiagnoseSelfTool) Description() string {
+	return "Report your own health, for admins only: uptime and memory, how long recent turns took, how many messages wait in each queue, the last provider error, which API key is in use, each channel's status and the workspace's disk usage. Use it when an admin asks why you are slow, not answering, or failing."
+}
+
+func (t *DiagnoseSelfTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{},
+	}
+}
+
+// SetReport sets the function building the health report.
+func (t *DiagnoseSelfTool) SetReport(report func() string) {
+	t.report = report
+}
+
+// SetSender sets whether the sender of the message being answered is an
+// admin of the channel.
+func (t *DiagnoseSelfTool) SetSender(messageID string, admin bool) {
+	t.admin = admin
+}
+
+func (t *DiagnoseSelfTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	if !t.admin {
+		return "", fmt.Errorf("diagnose_self: only admins may read the bot's health")
+	}
+	if t.report == nil {
+		return "", fmt.Errorf("diagnose_self: no health report available")
+	}
+	return t.report(), nil
+}
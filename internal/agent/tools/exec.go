@@ -17,10 +17,12 @@ import (
 // - blacklist dangerous program names (rm, sudo, dd, mkfs, shutdown, reboot)
 // - arguments containing absolute paths, ~ or .. are rejected
 // - optional allowedDir enforces a working directory
+// - credentials are only in the environment of the chats they are scoped to
 
 type ExecTool struct {
-	timeout    time.Duration
-	allowedDir string
+	timeout     time.Duration
+	allowedDir  string
+	credentials []Credential
 }
 
 func NewExecTool(timeoutSecs int) *ExecTool {
@@ -32,6 +34,9 @@ func NewExecToolWithWorkspace(timeoutSecs int, allowedDir string) *ExecTool {
 	return &ExecTool{timeout: time.Duration(timeoutSecs) * time.Second, allowedDir: allowedDir}
 }
 
+// SetCredentials sets the credentials of the current chat; see Credential.
+func (t *ExecTool) SetCredentials(creds []Credential) { t.credentials = creds }
+
 func (t *ExecTool) Name() string { return "exec" }
 func (t *ExecTool) Description() string {
 	return "Execute shell commands (array form only, restricted for safety)"
@@ -126,6 +131,7 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]interface{}) (st
 	if t.allowedDir != "" {
 		cmd.Dir = t.allowedDir
 	}
+	cmd.Env = credentialEnv(t.credentials)
 	b, err := cmd.CombinedOutput()
 	if err != nil {
 		return string(b), fmt.Errorf("exec error: %w", err)
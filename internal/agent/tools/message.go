@@ -4,14 +4,18 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 
 	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/templates"
 )
 
 // MessageTool sends messages to a channel via the chat Hub.
 // It holds a context (channel + chatID) which should be set per-incoming-message.
 type MessageTool struct {
 	hub     *chat.Hub
+	root    *os.Root // workspace root for attachments; nil disables them
 	channel string
 	chatID  string
 }
@@ -20,8 +24,17 @@ func NewMessageTool(b *chat.Hub) *MessageTool {
 	return &MessageTool{hub: b}
 }
 
-func (m *MessageTool) Name() string        { return "message" }
-func (m *MessageTool) Description() string { return "Send a message to the current channel/chat" }
+// NewMessageToolWithWorkspace creates a MessageTool that can also attach files
+// from the workspace. Attachment paths are resolved through root, so they
+// cannot escape the workspace.
+func NewMessageToolWithWorkspace(b *chat.Hub, root *os.Root) *MessageTool {
+	return &MessageTool{hub: b, root: root}
+}
+
+func (m *MessageTool) Name() string { return "message" }
+func (m *MessageTool) Description() string {
+	return "Send a message to the current channel/chat, optionally with files from the workspace attached"
+}
 
 func (m *MessageTool) Parameters() map[string]interface{} {
 	return map[string]interface{}{
@@ -29,10 +42,42 @@ func (m *MessageTool) Parameters() map[string]interface{} {
 		"properties": map[string]interface{}{
 			"content": map[string]interface{}{
 				"type":        "string",
-				"description": "The message content to send",
+				"description": "The message content to send, unless a template is given",
+			},
+			"template": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional name of a notification template in the workspace's templates/ directory, rendered with vars as the content. Use it for recurring alerts so they read the same every time",
+			},
+			"vars": map[string]interface{}{
+				"type":        "object",
+				"description": "Variables for the template",
+			},
+			"media": map[string]interface{}{
+				"type":        "array",
+				"description": "Optional workspace-relative file paths to attach (images are sent as photos, other files as documents)",
+				"items": map[string]interface{}{
+					"type": "string",
+				},
+			},
+			"sticker": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional emoji of a sticker to send after the text (Telegram; sent as the emoji itself where no sticker matches)",
+			},
+			"type": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{chat.TypeReport, chat.TypeReminder, chat.TypeError},
+				"description": "Optional kind of message; the channel prefixes it with a matching icon, so do not add one yourself",
+			},
+			"delete_after": map[string]interface{}{
+				"type":        "integer",
+				"description": "Optional seconds after which the message is deleted from the chat (Telegram). Use it for passwords, one-time codes and other private data",
+			},
+			"urgent": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Deliver the message even during the chat's quiet hours. Only for things that cannot wait until morning",
 			},
 		},
-		"required": []string{"content"},
+		"required": []string{},
 	}
 }
 
@@ -42,7 +87,11 @@ func (m *MessageTool) SetContext(channel, chatID string) {
 	m.chatID = chatID
 }
 
-// Expected args: {"content": "..."}
+// maxDeleteAfter is the longest self-destruct delay: Telegram only lets bots
+// delete their messages within 48 hours.
+const maxDeleteAfter = 48 * 60 * 60
+
+// Expected args: {"content": "...", "media": ["report.pdf", ...], "sticker": "👍", "type": "report", "delete_after": 60, "urgent": true}
 func (m *MessageTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
 	content := ""
 	if c, ok := args["content"]; ok {
@@ -54,7 +103,23 @@ func (m *MessageTool) Execute(ctx context.Context, args map[string]interface{})
 			content = string(b)
 		}
 	}
-	if content == "" {
+	if name, _ := args["template"].(string); name != "" {
+		if m.root == nil {
+			return "", fmt.Errorf("message tool: templates need a workspace")
+		}
+		vars, _ := args["vars"].(map[string]interface{})
+		text, err := templates.Render(m.root.FS(), name, vars)
+		if err != nil {
+			return "", fmt.Errorf("message tool: %w", err)
+		}
+		content = text
+	}
+	media, err := m.resolveMedia(args["media"])
+	if err != nil {
+		return "", err
+	}
+	sticker, _ := args["sticker"].(string)
+	if content == "" && len(media) == 0 && sticker == "" {
 		return "", fmt.Errorf("message tool: 'content' argument required")
 	}
 	// Publish outbound message to hub
@@ -62,6 +127,27 @@ func (m *MessageTool) Execute(ctx context.Context, args map[string]interface{})
 		Channel: m.channel,
 		ChatID:  m.chatID,
 		Content: content,
+		Media:   media,
+	}
+	if sticker != "" {
+		out.Metadata = map[string]interface{}{"sticker": sticker}
+	}
+	if t, _ := args["type"].(string); t != "" {
+		if _, ok := chat.DefaultPrefixes[t]; !ok {
+			return "", fmt.Errorf("message tool: unknown type %q (use report, reminder or error)", t)
+		}
+		out.Type = t
+	}
+	out.Urgent, _ = args["urgent"].(bool)
+	if raw, ok := args["delete_after"]; ok {
+		secs, ok := raw.(float64)
+		if !ok || secs < 1 || secs > maxDeleteAfter {
+			return "", fmt.Errorf("message tool: 'delete_after' must be between 1 and %d seconds", maxDeleteAfter)
+		}
+		if out.Metadata == nil {
+			out.Metadata = map[string]interface{}{}
+		}
+		out.Metadata["delete_after"] = int(secs)
 	}
 	select {
 	case m.hub.Out <- out:
@@ -70,3 +156,48 @@ func (m *MessageTool) Execute(ctx context.Context, args map[string]interface{})
 		return "", fmt.Errorf("outbound channel full")
 	}
 }
+
+// resolveMedia validates the requested attachments against the workspace root
+// and returns their absolute paths so channels can open them directly.
+func (m *MessageTool) resolveMedia(raw interface{}) ([]string, error) {
+	return resolveWorkspaceFiles(m.root, "message tool", raw)
+}
+
+// resolveWorkspaceFiles validates raw, a 'media' argument of workspace-relative
+// paths, against root and returns the absolute paths. Errors are prefixed
+// with the name of the tool.
+func resolveWorkspaceFiles(root *os.Root, tool string, raw interface{}) ([]string, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	items, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: 'media' must be an array of paths", tool)
+	}
+	if len(items) == 0 {
+		return nil, nil
+	}
+	if root == nil {
+		return nil, fmt.Errorf("%s: attachments are not available", tool)
+	}
+	base, err := filepath.Abs(root.Name())
+	if err != nil {
+		return nil, fmt.Errorf("%s: resolve workspace: %w", tool, err)
+	}
+	paths := make([]string, 0, len(items))
+	for _, it := range items {
+		p, ok := it.(string)
+		if !ok || p == "" {
+			return nil, fmt.Errorf("%s: 'media' must contain non-empty strings", tool)
+		}
+		info, err := root.Stat(p)
+		if err != nil {
+			return nil, fmt.Errorf("%s: attachment %q: %w", tool, p, err)
+		}
+		if info.IsDir() {
+			return nil, fmt.Errorf("%s: attachment %q is a directory", tool, p)
+		}
+		paths = append(paths, filepath.Join(base, filepath.Clean(p)))
+	}
+	return paths, nil
+}
@@ -0,0 +1,131 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+func TestMessageToolAttachesWorkspaceFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "chart.png"), []byte("png"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+
+	hub := chat.NewHub(1)
+	mt := NewMessageToolWithWorkspace(hub, root)
+	mt.SetContext("telegram", "42")
+
+	if _, err := mt.Execute(context.Background(), map[string]interface{}{
+		"content": "here you go",
+		"media":   []interface{}{"chart.png"},
+	}); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	out := <-hub.Out
+	if len(out.Media) != 1 || out.Media[0] != filepath.Join(dir, "chart.png") {
+		t.Fatalf("unexpected media: %v", out.Media)
+	}
+}
+
+func TestMessageToolRejectsEscapingAttachment(t *testing.T) {
+	root, err := os.OpenRoot(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+
+	mt := NewMessageToolWithWorkspace(chat.NewHub(1), root)
+	_, err = mt.Execute(context.Background(), map[string]interface{}{
+		"content": "x",
+		"media":   []interface{}{"../../etc/passwd"},
+	})
+	if err == nil {
+		t.Fatal("expected error for attachment outside the workspace")
+	}
+}
+
+func TestMessageToolSendsSticker(t *testing.T) {
+	hub := chat.NewHub(1)
+	mt := NewMessageTool(hub)
+	mt.SetContext("telegram", "42")
+
+	if _, err := mt.Execute(context.Background(), map[string]interface{}{"sticker": "👍"}); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	out := <-hub.Out
+	if out.Content != "" || out.Metadata["sticker"] != "👍" {
+		t.Fatalf("unexpected outbound: %+v", out)
+	}
+}
+
+func TestMessageToolDeleteAfter(t *testing.T) {
+	hub := chat.NewHub(1)
+	mt := NewMessageTool(hub)
+	mt.SetContext("telegram", "42")
+
+	if _, err := mt.Execute(context.Background(), map[string]interface{}{"content": "code: 123456", "delete_after": float64(60)}); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if out := <-hub.Out; out.DeleteAfter() != time.Minute {
+		t.Fatalf("unexpected outbound: %+v", out)
+	}
+	if _, err := mt.Execute(context.Background(), map[string]interface{}{"content": "x", "delete_after": float64(0)}); err == nil {
+		t.Fatal("expected an error for a zero delay")
+	}
+}
+
+func TestMessageToolType(t *testing.T) {
+	hub := chat.NewHub(1)
+	mt := NewMessageTool(hub)
+	mt.SetContext("telegram", "42")
+
+	if _, err := mt.Execute(context.Background(), map[string]interface{}{"content": "Weekly summary", "type": "report"}); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if out := <-hub.Out; out.Type != chat.TypeReport {
+		t.Fatalf("unexpected outbound: %+v", out)
+	}
+	if _, err := mt.Execute(context.Background(), map[string]interface{}{"content": "x", "type": "party"}); err == nil {
+		t.Fatal("expected an error for an unknown type")
+	}
+	if _, err := mt.Execute(context.Background(), map[string]interface{}{"content": "Door left open", "urgent": true}); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if out := <-hub.Out; !out.Urgent {
+		t.Fatalf("message should be urgent: %+v", out)
+	}
+}
+
+func TestMessageToolRendersTemplate(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "templates"), 0o755)
+	os.WriteFile(filepath.Join(dir, "templates", "backup_failed.tmpl"), []byte("Backup of {{.host}} failed"), 0o644)
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+
+	hub := chat.NewHub(1)
+	mt := NewMessageToolWithWorkspace(hub, root)
+	mt.SetContext("telegram", "42")
+	if _, err := mt.Execute(context.Background(), map[string]interface{}{
+		"template": "backup_failed",
+		"vars":     map[string]interface{}{"host": "nas"},
+	}); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if out := <-hub.Out; out.Content != "Backup of nas failed" {
+		t.Fatalf("Content = %q", out.Content)
+	}
+}
@@ -0,0 +1,94 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+// pinChannels are the channels that can pin messages.
+var pinChannels = map[string]bool{"telegram": true}
+
+// PinMessageTool sends a message and pins it, or unpins the latest pinned
+// message, in the chat of the message being answered, set with SetContext.
+// Pins change what the whole chat sees, so only admins may use it, as with
+// channel_action.
+type PinMessageTool struct {
+	hub     *chat.Hub
+	channel string
+	chatID  string
+	admin   bool
+}
+
+func NewPinMessageTool(b *chat.Hub) *PinMessageTool {
+	return &PinMessageTool{hub: b}
+}
+
+func (t *PinMessageTool) Name() string { return "pin_message" }
+func (t *PinMessageTool) Description() string {
+	return "Send a message to the current chat and pin it, for admins only: summaries, schedules or decisions the group should keep at hand (Telegram only; in groups the bot must be an admin allowed to pin). Set unpin to unpin the latest pinned message instead."
+}
+
+func (t *PinMessageTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"content": map[string]interface{}{
+				"type":        "string",
+				"description": "The message to send and pin",
+			},
+			"notify": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Notify the chat members about the pin (default false)",
+			},
+			"unpin": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Unpin the chat's latest pinned message instead of pinning",
+			},
+		},
+	}
+}
+
+// SetContext sets the chat to pin in.
+func (t *PinMessageTool) SetContext(channel, chatID string) {
+	t.channel = channel
+	t.chatID = chatID
+}
+
+// SetSender sets whether the sender of the message being answered is an
+// admin of the channel.
+func (t *PinMessageTool) SetSender(messageID string, admin bool) {
+	t.admin = admin
+}
+
+// Expected args: {"content": "Dinner rota: ...", "notify": false} or {"unpin": true}
+func (t *PinMessageTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	if !t.admin {
+		return "", fmt.Errorf("pin_message: only admins may pin or unpin messages")
+	}
+	if !pinChannels[t.channel] {
+		return "", fmt.Errorf("pin_message: pinning is not supported on channel %q", t.channel)
+	}
+	out := chat.Outbound{Channel: t.channel, ChatID: t.chatID}
+	result := "message sent and pinned"
+	if unpin, _ := args["unpin"].(bool); unpin {
+		out.Metadata = map[string]interface{}{"unpin": true}
+		result = "latest pinned message unpinned"
+	} else {
+		content, _ := args["content"].(string)
+		if strings.TrimSpace(content) == "" {
+			return "", fmt.Errorf("pin_message: 'content' argument required")
+		}
+		notify, _ := args["notify"].(bool)
+		out.Content = content
+		out.Metadata = map[string]interface{}{"pin": true, "pin_notify": notify}
+	}
+	select {
+	case t.hub.Out <- out:
+		return result, nil
+	default:
+		return "", fmt.Errorf("outbound channel full")
+	}
+}
@@ -0,0 +1,43 @@
+package tools
+
+import (
+	"context"
+	"testing"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+func TestPinMessageTool(t *testing.T) {
+	hub := chat.NewHub(2)
+	pt := NewPinMessageTool(hub)
+
+	pt.SetContext("telegram", "42")
+	if _, err := pt.Execute(context.Background(), map[string]interface{}{"content": "x"}); err == nil {
+		t.Fatal("expected an error for a non-admin")
+	}
+
+	pt.SetSender("7", true)
+	pt.SetContext("discord", "1")
+	if _, err := pt.Execute(context.Background(), map[string]interface{}{"content": "x"}); err == nil {
+		t.Fatal("expected an error on a channel without pins")
+	}
+
+	pt.SetContext("telegram", "42")
+	if _, err := pt.Execute(context.Background(), map[string]interface{}{}); err == nil {
+		t.Fatal("expected an error without content")
+	}
+	if _, err := pt.Execute(context.Background(), map[string]interface{}{"content": "Dinner: Ana cooks", "notify": true}); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	out := <-hub.Out
+	if out.ChatID != "42" || out.Content != "Dinner: Ana cooks" || out.Metadata["pin"] != true || out.Metadata["pin_notify"] != true {
+		t.Fatalf("unexpected outbound: %+v", out)
+	}
+
+	if _, err := pt.Execute(context.Background(), map[string]interface{}{"unpin": true}); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if out := <-hub.Out; out.Content != "" || out.Metadata["unpin"] != true {
+		t.Fatalf("unexpected outbound: %+v", out)
+	}
+}
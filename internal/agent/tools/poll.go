@@ -0,0 +1,98 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+// pollChannels are the channels that can render polls.
+var pollChannels = map[string]bool{"telegram": true}
+
+// CreatePollTool sends a poll to the chat of the message being answered, set
+// with SetContext. Votes come back as "poll_answer" events in that chat's
+// history, so the agent can tally them.
+type CreatePollTool struct {
+	hub     *chat.Hub
+	channel string
+	chatID  string
+}
+
+func NewCreatePollTool(b *chat.Hub) *CreatePollTool {
+	return &CreatePollTool{hub: b}
+}
+
+func (t *CreatePollTool) Name() string { return "create_poll" }
+func (t *CreatePollTool) Description() string {
+	return "Send a poll to the current chat (Telegram only). Votes are recorded in the conversation as they arrive."
+}
+
+func (t *CreatePollTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"question": map[string]interface{}{
+				"type":        "string",
+				"description": "The poll question (1-300 characters)",
+			},
+			"options": map[string]interface{}{
+				"type":        "array",
+				"description": "The answer options (2-10, each 1-100 characters)",
+				"items": map[string]interface{}{
+					"type": "string",
+				},
+			},
+			"multiple_answers": map[string]interface{}{
+				"type":        "boolean",
+				"description": "If true, voters may pick more than one option",
+			},
+		},
+		"required": []string{"question", "options"},
+	}
+}
+
+// SetContext sets the current channel and chat id for the poll.
+func (t *CreatePollTool) SetContext(channel, chatID string) {
+	t.channel = channel
+	t.chatID = chatID
+}
+
+// Expected args: {"question": "...", "options": ["a", "b"], "multiple_answers": false}
+func (t *CreatePollTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	if !pollChannels[t.channel] {
+		return "", fmt.Errorf("create_poll: polls are not supported on channel %q", t.channel)
+	}
+	question, _ := args["question"].(string)
+	question = strings.TrimSpace(question)
+	if question == "" || len([]rune(question)) > 300 {
+		return "", fmt.Errorf("create_poll: 'question' must be 1-300 characters")
+	}
+	raw, _ := args["options"].([]interface{})
+	if len(raw) < 2 || len(raw) > 10 {
+		return "", fmt.Errorf("create_poll: 'options' must have 2-10 entries")
+	}
+	poll := chat.Poll{Question: question}
+	for _, o := range raw {
+		s, _ := o.(string)
+		s = strings.TrimSpace(s)
+		if s == "" || len([]rune(s)) > 100 {
+			return "", fmt.Errorf("create_poll: each option must be 1-100 characters")
+		}
+		poll.Options = append(poll.Options, s)
+	}
+	poll.MultipleAnswers, _ = args["multiple_answers"].(bool)
+
+	out := chat.Outbound{
+		Channel:  t.channel,
+		ChatID:   t.chatID,
+		Metadata: map[string]interface{}{"poll": poll},
+	}
+	select {
+	case t.hub.Out <- out:
+		return "poll sent", nil
+	default:
+		return "", fmt.Errorf("outbound channel full")
+	}
+}
@@ -0,0 +1,32 @@
+package tools
+
+import (
+	"context"
+	"testing"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+func TestCreatePollTool(t *testing.T) {
+	hub := chat.NewHub(1)
+	pt := NewCreatePollTool(hub)
+
+	args := map[string]interface{}{"question": "Lunch?", "options": []interface{}{"Pizza", "Sushi"}}
+	pt.SetContext("discord", "1")
+	if _, err := pt.Execute(context.Background(), args); err == nil {
+		t.Fatal("expected an error on a channel without polls")
+	}
+
+	pt.SetContext("telegram", "42")
+	if _, err := pt.Execute(context.Background(), map[string]interface{}{"question": "Lunch?", "options": []interface{}{"Pizza"}}); err == nil {
+		t.Fatal("expected an error for a single option")
+	}
+	if _, err := pt.Execute(context.Background(), args); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	out := <-hub.Out
+	p, ok := out.Metadata["poll"].(chat.Poll)
+	if !ok || out.ChatID != "42" || p.Question != "Lunch?" || len(p.Options) != 2 {
+		t.Fatalf("unexpected outbound: %+v", out)
+	}
+}
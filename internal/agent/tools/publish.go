@@ -0,0 +1,251 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+// PostDraftTTL is how long a draft post waits for /publish before it is
+// dropped.
+const PostDraftTTL = 30 * time.Minute
+
+// PostDraft is a post to a Telegram broadcast channel, shown to an admin as
+// a preview and published only once they approve it with /publish.
+type PostDraft struct {
+	Channel string    // the broadcast channel, "@username" or numeric ID
+	Text    string    // the post's Markdown text
+	Media   []string  // absolute paths of the files posted after the text
+	At      time.Time // when to publish; zero = as soon as approved
+	Created time.Time
+}
+
+// RecentPostsKept is how many of the latest channel posts are kept to show
+// the agent when it drafts the next one.
+const RecentPostsKept = 5
+
+// recentPostRunes caps the length of a kept post.
+const recentPostRunes = 500
+
+// PostDrafts keeps the draft post awaiting approval in each chat, the
+// broadcast channels posts may go to, and the latest posts seen in them.
+type PostDrafts struct {
+	mu       sync.Mutex
+	channels []string
+	drafts   map[string]PostDraft // by channel:chatID of the admin's chat
+	posts    []string             // the latest RecentPostsKept, oldest first
+}
+
+// NewPostDrafts creates an empty store, with no channels to post to.
+func NewPostDrafts() *PostDrafts {
+	return &PostDrafts{drafts: make(map[string]PostDraft)}
+}
+
+// SetChannels sets the broadcast channels posts may go to.
+func (d *PostDrafts) SetChannels(channels []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.channels = d.channels[:0]
+	for _, c := range channels {
+		if c = NormalizeBroadcastChannel(c); c != "" {
+			d.channels = append(d.channels, c)
+		}
+	}
+}
+
+// Channels returns the broadcast channels posts may go to.
+func (d *PostDrafts) Channels() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.channels...)
+}
+
+// Put makes p the draft awaiting approval in chat key, replacing any other.
+func (d *PostDrafts) Put(key string, p PostDraft) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.drafts[key] = p
+}
+
+// Take removes and returns the draft of chat key, unless there is none or it
+// expired before now.
+func (d *PostDrafts) Take(key string, now time.Time) (PostDraft, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	p, ok := d.drafts[key]
+	delete(d.drafts, key)
+	if !ok || now.Sub(p.Created) > PostDraftTTL {
+		return PostDraft{}, false
+	}
+	return p, true
+}
+
+// RecordPost keeps post, published in one of the broadcast channels, among
+// the recent ones, dropping the oldest beyond RecentPostsKept.
+func (d *PostDrafts) RecordPost(post string) {
+	post = strings.TrimSpace(post)
+	if post == "" {
+		return
+	}
+	if r := []rune(post); len(r) > recentPostRunes {
+		post = string(r[:recentPostRunes]) + "…"
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.posts = append(d.posts, post)
+	if len(d.posts) > RecentPostsKept {
+		d.posts = d.posts[len(d.posts)-RecentPostsKept:]
+	}
+}
+
+// RecentPosts returns the recent posts, oldest first.
+func (d *PostDrafts) RecentPosts() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.posts...)
+}
+
+// NormalizeBroadcastChannel returns the Telegram channel c, given as
+// "@username", "username", "t.me/username" or a numeric ID, in the form the
+// Bot API takes: "@username" in lower case, or the ID.
+func NormalizeBroadcastChannel(c string) string {
+	c = strings.TrimSpace(c)
+	c = strings.TrimPrefix(strings.TrimPrefix(c, "https://"), "http://")
+	c = strings.TrimPrefix(c, "t.me/")
+	if c == "" {
+		return ""
+	}
+	if _, err := strconv.ParseInt(c, 10, 64); err == nil {
+		return c
+	}
+	return "@" + strings.ToLower(strings.TrimPrefix(c, "@"))
+}
+
+// PublishPostTool drafts a post to one of the Telegram broadcast channels the
+// bot administers. Posts reach everyone following the channel, so nothing is
+// published by the tool itself: it sends the admin a preview, and the post
+// goes out (or is scheduled) when they reply /publish, which the agent
+// answers from the drafts the tool shares with it.
+type PublishPostTool struct {
+	hub     *chat.Hub
+	root    *os.Root // workspace root for the files; nil disables them
+	drafts  *PostDrafts
+	channel string
+	chatID  string
+	admin   bool
+}
+
+func NewPublishPostTool(b *chat.Hub, root *os.Root, drafts *PostDrafts) *PublishPostTool {
+	return &PublishPostTool{hub: b, root: root, drafts: drafts}
+}
+
+func (t *PublishPostTool) Name() string { return "publish_post" }
+func (t *PublishPostTool) Description() string {
+	return "Draft a post to a Telegram broadcast channel the bot administers, for admins only. The admin gets a preview and publishes it by replying /publish, so write the post exactly as it should appear. Optionally schedule it with 'at'."
+}
+
+func (t *PublishPostTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"text": map[string]interface{}{
+				"type":        "string",
+				"description": "The post, in Markdown",
+			},
+			"media": map[string]interface{}{
+				"type":        "array",
+				"description": "Optional workspace-relative paths of files to post after the text (images are sent as photos)",
+				"items": map[string]interface{}{
+					"type": "string",
+				},
+			},
+			"channel": map[string]interface{}{
+				"type":        "string",
+				"description": "The channel to post to, as @username or ID; may be omitted when only one is configured",
+			},
+			"at": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional RFC 3339 time (e.g. 2025-05-01T09:00:00+02:00) to publish the post at once approved, instead of right away",
+			},
+		},
+		"required": []string{"text"},
+	}
+}
+
+// SetContext sets the chat the preview is sent to.
+func (t *PublishPostTool) SetContext(channel, chatID string) {
+	t.channel = channel
+	t.chatID = chatID
+}
+
+// SetSender sets whether the sender of the message being answered is an
+// admin of the channel.
+func (t *PublishPostTool) SetSender(messageID string, admin bool) {
+	t.admin = admin
+}
+
+// Expected args: {"text": "Release 2.0 is out!", "media": ["banner.png"], "channel": "@news", "at": "2025-05-01T09:00:00+02:00"}
+func (t *PublishPostTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	if !t.admin {
+		return "", fmt.Errorf("publish_post: only admins may publish posts")
+	}
+	channels := t.drafts.Channels()
+	if len(channels) == 0 {
+		return "", fmt.Errorf("publish_post: no broadcast channels are configured (channels.telegram.publishTo)")
+	}
+	text, _ := args["text"].(string)
+	if strings.TrimSpace(text) == "" {
+		return "", fmt.Errorf("publish_post: 'text' argument required")
+	}
+	target := channels[0]
+	if c, _ := args["channel"].(string); c != "" {
+		target = NormalizeBroadcastChannel(c)
+		found := false
+		for _, ch := range channels {
+			found = found || ch == target
+		}
+		if !found {
+			return "", fmt.Errorf("publish_post: %s is not a channel I may post to (%s)", c, strings.Join(channels, ", "))
+		}
+	} else if len(channels) > 1 {
+		return "", fmt.Errorf("publish_post: 'channel' argument required, one of %s", strings.Join(channels, ", "))
+	}
+	media, err := resolveWorkspaceFiles(t.root, "publish_post", args["media"])
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	draft := PostDraft{Channel: target, Text: text, Media: media, Created: now}
+	when := "now"
+	if s, _ := args["at"].(string); s != "" {
+		at, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return "", fmt.Errorf("publish_post: 'at' must be an RFC 3339 time: %w", err)
+		}
+		if !at.After(now) {
+			return "", fmt.Errorf("publish_post: 'at' is in the past")
+		}
+		draft.At = at
+		when = "on " + at.Format("Mon Jan 2 15:04 MST")
+	}
+
+	// The preview is the post as it will appear, followed by how to approve it.
+	preview := chat.Outbound{Channel: t.channel, ChatID: t.chatID, Content: text, Media: media}
+	prompt := chat.Outbound{Channel: t.channel, ChatID: t.chatID,
+		Content: fmt.Sprintf("Reply /publish to post this to %s %s, or /publish cancel.", target, when)}
+	for _, out := range []chat.Outbound{preview, prompt} {
+		select {
+		case t.hub.Out <- out:
+		default:
+			return "", fmt.Errorf("outbound channel full")
+		}
+	}
+	t.drafts.Put(t.channel+":"+t.chatID, draft)
+	return fmt.Sprintf("Preview sent. The post goes to %s only when the admin replies /publish (within %s); do not repeat the preview.", target, PostDraftTTL), nil
+}
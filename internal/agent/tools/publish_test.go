@@ -0,0 +1,76 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+func TestPublishPostTool(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "banner.png"), []byte("png"), 0o644)
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+	hub := chat.NewHub(4)
+	drafts := NewPostDrafts()
+	pt := NewPublishPostTool(hub, root, drafts)
+	pt.SetContext("telegram", "42")
+	args := map[string]interface{}{"text": "Release 2.0 is out!", "media": []interface{}{"banner.png"}}
+
+	pt.SetSender("7", true)
+	if _, err := pt.Execute(context.Background(), args); err == nil {
+		t.Fatal("expected an error without channels")
+	}
+	drafts.SetChannels([]string{"@News", "https://t.me/Updates"})
+	if got := drafts.Channels(); len(got) != 2 || got[0] != "@news" || got[1] != "@updates" {
+		t.Fatalf("channels = %v", got)
+	}
+
+	pt.SetSender("7", false)
+	if _, err := pt.Execute(context.Background(), args); err == nil {
+		t.Fatal("expected an error for a non-admin")
+	}
+	pt.SetSender("7", true)
+	if _, err := pt.Execute(context.Background(), args); err == nil {
+		t.Fatal("expected an error without a channel when several are configured")
+	}
+	args["channel"] = "@elsewhere"
+	if _, err := pt.Execute(context.Background(), args); err == nil {
+		t.Fatal("expected an error for a channel not configured")
+	}
+
+	args["channel"] = "news"
+	args["at"] = time.Now().Add(time.Hour).Format(time.RFC3339)
+	if _, err := pt.Execute(context.Background(), args); err != nil {
+		t.Fatalf("draft: %v", err)
+	}
+	preview, prompt := <-hub.Out, <-hub.Out
+	if preview.ChatID != "42" || preview.Content != "Release 2.0 is out!" || len(preview.Media) != 1 || preview.Metadata != nil {
+		t.Fatalf("unexpected preview: %+v", preview)
+	}
+	if !strings.Contains(prompt.Content, "/publish") || !strings.Contains(prompt.Content, "@news") {
+		t.Fatalf("unexpected prompt: %q", prompt.Content)
+	}
+
+	d, ok := drafts.Take("telegram:42", time.Now())
+	if !ok || d.Channel != "@news" || d.At.IsZero() || filepath.Base(d.Media[0]) != "banner.png" {
+		t.Fatalf("unexpected draft: %+v, %v", d, ok)
+	}
+	if _, ok := drafts.Take("telegram:42", time.Now()); ok {
+		t.Fatal("a draft is taken once")
+	}
+
+	// Drafts left waiting expire.
+	drafts.Put("telegram:42", PostDraft{Channel: "@news", Text: "old", Created: time.Now().Add(-PostDraftTTL - time.Minute)})
+	if _, ok := drafts.Take("telegram:42", time.Now()); ok {
+		t.Fatal("expected the draft to have expired")
+	}
+}
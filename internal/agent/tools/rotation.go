@@ -0,0 +1,338 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotationsFile is the workspace file holding the rotations.
+const rotationsFile = "rotations.json"
+
+// Rotation is a chore that passes from member to member every period, like
+// taking out the trash. Whose turn it is follows from the start time, so it
+// never drifts however often it is asked.
+type Rotation struct {
+	Name    string    `json:"name"`
+	Channel string    `json:"channel"`
+	ChatID  string    `json:"chat_id"`
+	Members []string  `json:"members"`
+	Period  string    `json:"period"` // "daily" or "weekly"
+	Start   time.Time `json:"start"`  // when the first member's turn began
+	Remind  bool      `json:"remind"` // announce each new turn in the chat
+	// Announced is the last turn announced in the chat.
+	Announced int `json:"announced"`
+}
+
+// rotationPeriods are the supported periods of a rotation.
+var rotationPeriods = map[string]time.Duration{
+	"daily":  24 * time.Hour,
+	"weekly": 7 * 24 * time.Hour,
+}
+
+// Turn returns the number of the turn running at t, counted from 0. Before
+// the start it is 0.
+func (r Rotation) Turn(t time.Time) int {
+	if t.Before(r.Start) {
+		return 0
+	}
+	return int(t.Sub(r.Start) / rotationPeriods[r.Period])
+}
+
+// Member returns who is on duty for turn n.
+func (r Rotation) Member(n int) string {
+	return r.Members[n%len(r.Members)]
+}
+
+// Describe says whose turn it is at t and who comes next.
+func (r Rotation) Describe(t time.Time) string {
+	n := r.Turn(t)
+	unit := map[string]string{"daily": "today", "weekly": "this week"}[r.Period]
+	return fmt.Sprintf("%s: %s's turn %s (next: %s)", r.Name, r.Member(n), unit, r.Member(n+1))
+}
+
+// RotationStore keeps the rotations of every chat in rotations.json in the
+// workspace.
+type RotationStore struct {
+	mu   sync.Mutex
+	root *os.Root
+}
+
+// NewRotationStore creates a store backed by the workspace root.
+func NewRotationStore(root *os.Root) *RotationStore {
+	return &RotationStore{root: root}
+}
+
+func (s *RotationStore) load() ([]Rotation, error) {
+	b, err := s.root.ReadFile(rotationsFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var rs []Rotation
+	if err := json.Unmarshal(b, &rs); err != nil {
+		return nil, fmt.Errorf("%s: %w", rotationsFile, err)
+	}
+	return rs, nil
+}
+
+func (s *RotationStore) save(rs []Rotation) error {
+	b, err := json.MarshalIndent(rs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.root.WriteFile(rotationsFile, b, 0o644)
+}
+
+// Put adds r, replacing the chat's rotation of the same name.
+func (s *RotationStore) Put(r Rotation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rs, err := s.load()
+	if err != nil {
+		return err
+	}
+	kept := rs[:0]
+	for _, o := range rs {
+		if !o.is(r.Channel, r.ChatID, r.Name) {
+			kept = append(kept, o)
+		}
+	}
+	return s.save(append(kept, r))
+}
+
+// Delete removes the chat's rotation called name, reporting whether it
+// existed.
+func (s *RotationStore) Delete(channel, chatID, name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rs, err := s.load()
+	if err != nil {
+		return false, err
+	}
+	kept := rs[:0]
+	for _, o := range rs {
+		if !o.is(channel, chatID, name) {
+			kept = append(kept, o)
+		}
+	}
+	if len(kept) == len(rs) {
+		return false, nil
+	}
+	return true, s.save(kept)
+}
+
+// List returns the rotations of a chat, by name.
+func (s *RotationStore) List(channel, chatID string) ([]Rotation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rs, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	var out []Rotation
+	for _, r := range rs {
+		if r.Channel == channel && r.ChatID == chatID {
+			out = append(out, r)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// Due returns the rotations with reminders whose turn changed since it was
+// last announced at now, and records them as announced.
+func (s *RotationStore) Due(now time.Time) ([]Rotation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rs, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	var due []Rotation
+	for i := range rs {
+		if rs[i].Remind && rs[i].Turn(now) > rs[i].Announced {
+			rs[i].Announced = rs[i].Turn(now)
+			due = append(due, rs[i])
+		}
+	}
+	if len(due) == 0 {
+		return nil, nil
+	}
+	return due, s.save(rs)
+}
+
+func (r Rotation) is(channel, chatID, name string) bool {
+	return r.Channel == channel && r.ChatID == chatID && strings.EqualFold(r.Name, name)
+}
+
+// CreateRotationTool sets up (or removes) a rotation. A rotation belongs to
+// the chat of the message being answered, set with SetContext, where whose
+// turn it is gets announced.
+type CreateRotationTool struct {
+	store   *RotationStore
+	channel string
+	chatID  string
+}
+
+func NewCreateRotationTool(store *RotationStore) *CreateRotationTool {
+	return &CreateRotationTool{store: store}
+}
+
+func (t *CreateRotationTool) Name() string { return "create_rotation" }
+func (t *CreateRotationTool) Description() string {
+	return "Create or replace a chore rotation in this chat (e.g. who takes out the trash), passing from member to member every day or week, with a reminder in the chat at each change. Call it with the name and an empty members list to remove a rotation."
+}
+
+func (t *CreateRotationTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"name": map[string]interface{}{
+				"type":        "string",
+				"description": "The chore, e.g. 'Trash'",
+			},
+			"members": map[string]interface{}{
+				"type":        "array",
+				"description": "Who takes turns, in order; the first one is on duty now (or from 'start')",
+				"items": map[string]interface{}{
+					"type": "string",
+				},
+			},
+			"period": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"weekly", "daily"},
+				"description": "How often the turn passes to the next member (default weekly)",
+			},
+			"start": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional local date and time the first turn begins, as 'YYYY-MM-DD HH:MM'; the turn then changes at that time of day. Default: now",
+			},
+			"remind": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Announce in this chat whose turn it is whenever it changes (default true)",
+			},
+		},
+		"required": []string{"name", "members"},
+	}
+}
+
+// SetContext sets the chat the rotation belongs to.
+func (t *CreateRotationTool) SetContext(channel, chatID string) {
+	t.channel = channel
+	t.chatID = chatID
+}
+
+// Expected args: {"name": "Trash", "members": ["Ana", "Bruno"], "period": "weekly", "start": "2026-01-05 08:00", "remind": true}
+func (t *CreateRotationTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	name, _ := args["name"].(string)
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("create_rotation: 'name' argument required")
+	}
+	raw, _ := args["members"].([]interface{})
+	if len(raw) == 0 {
+		found, err := t.store.Delete(t.channel, t.chatID, name)
+		if err != nil {
+			return "", err
+		}
+		if !found {
+			return "", fmt.Errorf("create_rotation: no rotation %q in this chat (give 'members' to create one)", name)
+		}
+		return fmt.Sprintf("rotation %q removed", name), nil
+	}
+	r := Rotation{Name: name, Channel: t.channel, ChatID: t.chatID, Period: "weekly", Start: time.Now(), Remind: true}
+	for _, m := range raw {
+		s, _ := m.(string)
+		if s = strings.TrimSpace(s); s == "" {
+			return "", fmt.Errorf("create_rotation: 'members' must contain non-empty names")
+		}
+		r.Members = append(r.Members, s)
+	}
+	if p, _ := args["period"].(string); p != "" {
+		if _, ok := rotationPeriods[p]; !ok {
+			return "", fmt.Errorf("create_rotation: 'period' must be daily or weekly")
+		}
+		r.Period = p
+	}
+	if s, _ := args["start"].(string); s != "" {
+		start, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+		if err != nil {
+			return "", fmt.Errorf("create_rotation: 'start' must look like 2026-01-05 08:00")
+		}
+		r.Start = start
+	}
+	if remind, ok := args["remind"].(bool); ok {
+		r.Remind = remind
+	}
+	now := time.Now()
+	r.Announced = r.Turn(now) // the current turn is announced by this reply
+	if err := t.store.Put(r); err != nil {
+		return "", err
+	}
+	return "rotation saved. " + r.Describe(now), nil
+}
+
+// WhoseTurnTool tells whose turn it is in the rotations of the current chat.
+type WhoseTurnTool struct {
+	store   *RotationStore
+	channel string
+	chatID  string
+}
+
+func NewWhoseTurnTool(store *RotationStore) *WhoseTurnTool {
+	return &WhoseTurnTool{store: store}
+}
+
+func (t *WhoseTurnTool) Name() string { return "whose_turn" }
+func (t *WhoseTurnTool) Description() string {
+	return "Tell whose turn it is, and who is next, in this chat's chore rotations. Always use it instead of working the turns out yourself."
+}
+
+func (t *WhoseTurnTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"name": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional rotation name; omit to list every rotation of this chat",
+			},
+		},
+	}
+}
+
+// SetContext sets the chat whose rotations are looked up.
+func (t *WhoseTurnTool) SetContext(channel, chatID string) {
+	t.channel = channel
+	t.chatID = chatID
+}
+
+// Expected args: {"name": "Trash"}
+func (t *WhoseTurnTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	rs, err := t.store.List(t.channel, t.chatID)
+	if err != nil {
+		return "", err
+	}
+	name, _ := args["name"].(string)
+	now := time.Now()
+	var lines []string
+	for _, r := range rs {
+		if name == "" || strings.EqualFold(r.Name, strings.TrimSpace(name)) {
+			lines = append(lines, r.Describe(now))
+		}
+	}
+	if len(lines) == 0 {
+		if name != "" {
+			return fmt.Sprintf("no rotation %q in this chat", name), nil
+		}
+		return "no rotations in this chat", nil
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,60 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotationTools(t *testing.T) {
+	root, err := os.OpenRoot(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+	store := NewRotationStore(root)
+	create := NewCreateRotationTool(store)
+	whose := NewWhoseTurnTool(store)
+	create.SetContext("telegram", "-100")
+	whose.SetContext("telegram", "-100")
+
+	// Started two weeks and a bit ago: Carla's turn, Ana's next.
+	start := time.Now().Add(-15 * 24 * time.Hour).Format("2006-01-02 15:04")
+	res, err := create.Execute(context.Background(), map[string]interface{}{"name": "Trash", "members": []interface{}{"Ana", "Bruno", "Carla"}, "start": start})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(res, "Trash: Carla's turn this week (next: Ana)") {
+		t.Fatalf("unexpected create_rotation result: %q", res)
+	}
+	if got, _ := whose.Execute(context.Background(), map[string]interface{}{"name": "trash"}); got != "Trash: Carla's turn this week (next: Ana)" {
+		t.Fatalf("unexpected whose_turn result: %q", got)
+	}
+	other := NewWhoseTurnTool(store)
+	other.SetContext("telegram", "7")
+	if got, _ := other.Execute(context.Background(), map[string]interface{}{}); got != "no rotations in this chat" {
+		t.Fatalf("rotation leaked to another chat: %q", got)
+	}
+
+	// The current turn was announced on creation; the next one is due in a week.
+	if due, err := store.Due(time.Now()); err != nil || len(due) != 0 {
+		t.Fatalf("nothing should be due yet, got %v (%v)", due, err)
+	}
+	nextWeek := time.Now().Add(7 * 24 * time.Hour)
+	due, err := store.Due(nextWeek)
+	if err != nil || len(due) != 1 || due[0].Describe(nextWeek) != "Trash: Ana's turn this week (next: Bruno)" {
+		t.Fatalf("unexpected due rotations: %+v (%v)", due, err)
+	}
+	if due, _ := store.Due(nextWeek); len(due) != 0 {
+		t.Fatalf("a turn must be announced only once, got %+v", due)
+	}
+
+	if _, err := create.Execute(context.Background(), map[string]interface{}{"name": "Trash", "members": []interface{}{}}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := whose.Execute(context.Background(), map[string]interface{}{}); got != "no rotations in this chat" {
+		t.Fatalf("rotation was not removed: %q", got)
+	}
+}
@@ -0,0 +1,102 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+// statusChatID is WhatsApp's status broadcast list, where status updates go.
+const statusChatID = "status@broadcast"
+
+// PostStatusTool posts a WhatsApp status update, seen by the account's
+// contacts: a text, or an image from the workspace captioned with it. It
+// changes what everyone sees of the account, so only admins may use it.
+// Heartbeat and cron turns may not: their tasks live in workspace files that
+// the agent can be asked to edit by anyone it talks to.
+type PostStatusTool struct {
+	hub   *chat.Hub
+	root  *os.Root // workspace root for the image; nil disables images
+	admin bool
+}
+
+func NewPostStatusTool(b *chat.Hub, root *os.Root) *PostStatusTool {
+	return &PostStatusTool{hub: b, root: root}
+}
+
+func (t *PostStatusTool) Name() string { return "post_whatsapp_status" }
+func (t *PostStatusTool) Description() string {
+	return "Post a WhatsApp status update, seen by all of the account's contacts for 24 hours, for admins only: a text, or an image from the workspace with the text as its caption. Use it when asked to post or share something as a status, e.g. a daily summary."
+}
+
+func (t *PostStatusTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"text": map[string]interface{}{
+				"type":        "string",
+				"description": "The status text, or the image's caption",
+			},
+			"image": map[string]interface{}{
+				"type":        "string",
+				"description": "Path of an image relative to the workspace, to post as an image status",
+			},
+		},
+	}
+}
+
+// SetSender sets whether the sender of the message being answered is an
+// admin of the channel.
+func (t *PostStatusTool) SetSender(messageID string, admin bool) {
+	t.admin = admin
+}
+
+// Expected args: {"text": "Today: 3 meetings, gym at 6"} or {"text": "Sunset", "image": "photos/sunset.jpg"}
+func (t *PostStatusTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	if !t.admin {
+		return "", fmt.Errorf("post_whatsapp_status: only admins may post status updates")
+	}
+	text, _ := args["text"].(string)
+	image, _ := args["image"].(string)
+	if strings.TrimSpace(text) == "" && image == "" {
+		return "", fmt.Errorf("post_whatsapp_status: 'text' or 'image' argument required")
+	}
+	out := chat.Outbound{Channel: "whatsapp", ChatID: statusChatID, Content: text, Metadata: map[string]interface{}{"status": true}}
+	if image != "" {
+		path, err := t.resolveImage(image)
+		if err != nil {
+			return "", err
+		}
+		out.Media = []string{path}
+	}
+	select {
+	case t.hub.Out <- out:
+		return "status update requested", nil
+	default:
+		return "", fmt.Errorf("outbound channel full")
+	}
+}
+
+// resolveImage validates the image against the workspace root and returns
+// its absolute path for the channel to open.
+func (t *PostStatusTool) resolveImage(p string) (string, error) {
+	if t.root == nil {
+		return "", fmt.Errorf("post_whatsapp_status: images are not available")
+	}
+	base, err := filepath.Abs(t.root.Name())
+	if err != nil {
+		return "", fmt.Errorf("post_whatsapp_status: resolve workspace: %w", err)
+	}
+	info, err := t.root.Stat(p)
+	if err != nil {
+		return "", fmt.Errorf("post_whatsapp_status: image %q: %w", p, err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("post_whatsapp_status: image %q is a directory", p)
+	}
+	return filepath.Join(base, filepath.Clean(p)), nil
+}
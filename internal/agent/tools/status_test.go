@@ -0,0 +1,42 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+func TestPostStatusTool(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "summary.png"), []byte("png"), 0o644)
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+	hub := chat.NewHub(2)
+	st := NewPostStatusTool(hub, root)
+
+	st.SetSender("7", false)
+	if _, err := st.Execute(context.Background(), map[string]interface{}{"text": "hi"}); err == nil {
+		t.Fatal("expected an error for a non-admin")
+	}
+
+	st.SetSender("7", true)
+	if _, err := st.Execute(context.Background(), map[string]interface{}{"text": "hi", "image": "../escape.png"}); err == nil {
+		t.Fatal("expected an error for an image outside the workspace")
+	}
+	if _, err := st.Execute(context.Background(), map[string]interface{}{"text": "Today", "image": "summary.png"}); err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	out := <-hub.Out
+	if out.Channel != "whatsapp" || out.ChatID != "status@broadcast" || out.Content != "Today" || out.Metadata["status"] != true {
+		t.Fatalf("unexpected outbound: %+v", out)
+	}
+	if len(out.Media) != 1 || filepath.Base(out.Media[0]) != "summary.png" {
+		t.Fatalf("media = %v", out.Media)
+	}
+}
@@ -2,18 +2,30 @@ package tools
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
+
+	"github.com/local/picobot/internal/useragent"
 )
 
 // WebTool supports fetch operations.
 // Args: {"url": "https://..."}
 
-type WebTool struct{}
+type WebTool struct {
+	credentials []Credential
+}
+
+// webClient sends picobot's User-Agent, since some sites refuse unidentified clients.
+var webClient = useragent.Client(0)
 
 func NewWebTool() *WebTool { return &WebTool{} }
 
+// SetCredentials sets the credentials of the current chat; see Credential.
+func (t *WebTool) SetCredentials(creds []Credential) { t.credentials = creds }
+
 func (t *WebTool) Name() string        { return "web" }
 func (t *WebTool) Description() string { return "Fetch web content from a URL" }
 
@@ -39,7 +51,28 @@ func (t *WebTool) Execute(ctx context.Context, args map[string]interface{}) (str
 	if err != nil {
 		return "", err
 	}
-	resp, err := http.DefaultClient.Do(req)
+	client := webClient
+	if headers := t.headersFor(req.URL.Hostname()); len(headers) > 0 {
+		for name, v := range headers {
+			req.Header.Set(name, v)
+		}
+		// Never follow a redirect elsewhere with the credentials.
+		host := req.URL.Hostname()
+		c := *webClient
+		c.CheckRedirect = func(r *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			if !strings.EqualFold(r.URL.Hostname(), host) {
+				for name := range headers {
+					r.Header.Del(name)
+				}
+			}
+			return nil
+		}
+		client = &c
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return "", err
 	}
@@ -50,3 +83,17 @@ func (t *WebTool) Execute(ctx context.Context, args map[string]interface{}) (str
 	}
 	return string(b), nil
 }
+
+// headersFor returns the credential headers to send to host.
+func (t *WebTool) headersFor(host string) map[string]string {
+	var headers map[string]string
+	for _, c := range t.credentials {
+		if c.Header != "" && c.Value != "" && strings.EqualFold(c.Host, host) {
+			if headers == nil {
+				headers = map[string]string{}
+			}
+			headers[c.Header] = c.Value
+		}
+	}
+	return headers
+}
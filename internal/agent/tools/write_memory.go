@@ -2,7 +2,9 @@ package tools
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/local/picobot/internal/agent/memory"
 )
@@ -70,29 +72,58 @@ func (w *WriteMemoryTool) Execute(ctx context.Context, args map[string]interface
 		}
 	}
 
+	var write func() error
+	action := ""
 	switch target {
 	case "today":
-		if err := w.mem.AppendToday(content); err != nil {
-			return "", err
-		}
-		return "appended to today", nil
+		write, action = func() error { return w.mem.AppendToday(content) }, "appended"
 	case "long":
 		if appendFlag {
-			prev, err := w.mem.ReadLongTerm()
-			if err != nil {
-				return "", err
-			}
-			new := prev + "\n" + content
-			if err := w.mem.WriteLongTerm(new); err != nil {
-				return "", err
-			}
-			return "appended to long-term memory", nil
-		}
-		if err := w.mem.WriteLongTerm(content); err != nil {
-			return "", err
+			write, action = func() error { return w.mem.AppendLongTerm(content) }, "appended"
+		} else {
+			write, action = func() error { return w.mem.WriteLongTerm(content) }, "overwrote"
 		}
-		return "wrote long-term memory", nil
 	default:
 		return "", fmt.Errorf("write_memory: unknown target '%s'", target)
 	}
+
+	// Retry transient I/O failures; the model gets a structured result either
+	// way, so it can tell the user whether the note was saved.
+	res := writeMemoryResult{Target: target, Action: action}
+	var err error
+	for res.Attempts < writeMemoryAttempts {
+		res.Attempts++
+		if err = write(); err == nil {
+			break
+		}
+		if res.Attempts < writeMemoryAttempts {
+			select {
+			case <-ctx.Done():
+				err = ctx.Err()
+				res.Attempts = writeMemoryAttempts
+			case <-time.After(time.Duration(res.Attempts) * writeMemoryRetryDelay):
+			}
+		}
+	}
+	res.OK = err == nil
+	if err != nil {
+		res.Error = err.Error()
+	}
+	b, _ := json.Marshal(res)
+	return string(b), nil
+}
+
+// writeMemoryAttempts is how many times a failed write is tried in total;
+// writeMemoryRetryDelay grows linearly between attempts.
+const writeMemoryAttempts = 3
+
+var writeMemoryRetryDelay = 100 * time.Millisecond
+
+// writeMemoryResult is the JSON reported back to the model.
+type writeMemoryResult struct {
+	OK       bool   `json:"ok"`
+	Target   string `json:"target"`
+	Action   string `json:"action"` // "appended" or "overwrote"
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
 }
@@ -2,10 +2,12 @@ package tools
 
 import (
 	"context"
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/local/picobot/internal/agent/memory"
 )
@@ -45,3 +47,27 @@ func TestWriteMemoryTool_TodayAndLong(t *testing.T) {
 		t.Fatalf("expected LT1 to be gone after overwrite, got %q", lt2)
 	}
 }
+
+func TestWriteMemoryToolReportsFailureAfterRetries(t *testing.T) {
+	defer func(d time.Duration) { writeMemoryRetryDelay = d }(writeMemoryRetryDelay)
+	writeMemoryRetryDelay = time.Millisecond
+
+	tmp := t.TempDir()
+	// A file where the memory directory should be makes every write fail.
+	if err := os.WriteFile(filepath.Join(tmp, "memory"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w := NewWriteMemoryTool(memory.NewMemoryStoreWithWorkspace(tmp, 10))
+
+	out, err := w.Execute(context.Background(), map[string]interface{}{"target": "long", "content": "x"})
+	if err != nil {
+		t.Fatalf("failures should be reported as a result, got error %v", err)
+	}
+	var res writeMemoryResult
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("result is not JSON: %q", out)
+	}
+	if res.OK || res.Attempts != writeMemoryAttempts || res.Error == "" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+}
@@ -0,0 +1,254 @@
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+// Turn states, in the order a turn goes through them.
+const (
+	turnReceived   = "received"   // taken from the hub, not yet answered
+	turnProcessing = "processing" // the model has been asked; tools may have run
+	turnAnswered   = "answered"   // the reply was queued
+	turnFailed     = "failed"     // given up after turnMaxAttempts runs
+)
+
+// turnMaxAttempts is how many times a turn is run before it is given up: a
+// message that crashes the process every time must not be run again at
+// every start.
+const turnMaxAttempts = 3
+
+// turnKeep is how long answered turns are remembered, so a message
+// delivered again by its channel is recognised and not answered twice.
+const turnKeep = 7 * 24 * time.Hour
+
+// turnJournal records every inbound message and how far its turn got, in a
+// SQLite database, so a crash neither loses a message nor answers it twice:
+// turns not answered when the process died are run again when it starts,
+// and a message whose turn was answered (or failed) is ignored if delivered
+// again. A nil journal records nothing.
+type turnJournal struct {
+	db *sql.DB
+}
+
+func openTurnJournal(path string) (*turnJournal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(wal)")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS turns (
+		id       INTEGER PRIMARY KEY AUTOINCREMENT,
+		msg_key  TEXT UNIQUE,
+		message  TEXT NOT NULL,
+		state    TEXT NOT NULL,
+		updated  INTEGER NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0
+	)`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("turn journal: %w", err)
+	}
+	// Journals written before attempts were counted lack the column.
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('turns') WHERE name = 'attempts'`).Scan(&n); err == nil && n == 0 {
+		if _, err := db.Exec(`ALTER TABLE turns ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0`); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("turn journal: %w", err)
+		}
+	}
+	cutoff := time.Now().Add(-turnKeep).Unix()
+	if _, err := db.Exec(`DELETE FROM turns WHERE state IN (?, ?) AND updated < ?`, turnAnswered, turnFailed, cutoff); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("turn journal: %w", err)
+	}
+	return &turnJournal{db: db}, nil
+}
+
+// SetTurnJournal keeps a journal of turns in the SQLite database at path, so
+// turns interrupted by a crash are run again by Run and messages delivered
+// twice are answered once.
+func (a *AgentLoop) SetTurnJournal(path string) error {
+	j, err := openTurnJournal(path)
+	if err != nil {
+		return err
+	}
+	a.turns = j
+	return nil
+}
+
+// turnKey identifies msg across deliveries; it is empty when the channel
+// gave the message no ID.
+func turnKey(msg chat.Inbound) string {
+	if id := msg.MessageID(); id != "" {
+		return msg.Channel + ":" + msg.ChatID + ":" + id
+	}
+	return ""
+}
+
+// receive records msg as received and returns its turn, or ok false when
+// the message was already answered or given up. Events, heartbeat and cron
+// turns and private chats are not recorded (turn 0): events are not
+// answered, heartbeat and cron turns fire again on their own, and private
+// chats must not reach the disk.
+func (j *turnJournal) receive(msg chat.Inbound, private bool) (id int64, ok bool) {
+	if j == nil || msg.Event() != "" || isSystemChannel(msg.Channel) || msg.SenderID == "cron" || private {
+		return 0, true
+	}
+	key := turnKey(msg)
+	if key != "" {
+		var state string
+		err := j.db.QueryRow(`SELECT id, state FROM turns WHERE msg_key = ?`, key).Scan(&id, &state)
+		if err == nil {
+			return id, state != turnAnswered && state != turnFailed
+		}
+	}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("turn journal: %v", err)
+		return 0, true
+	}
+	var k interface{}
+	if key != "" {
+		k = key
+	}
+	res, err := j.db.Exec(`INSERT INTO turns (msg_key, message, state, updated) VALUES (?, ?, ?, ?)`,
+		k, string(b), turnReceived, time.Now().Unix())
+	if err != nil {
+		log.Printf("turn journal: %v", err)
+		return 0, true
+	}
+	id, _ = res.LastInsertId()
+	return id, true
+}
+
+// set moves turn id to state. Answered and failed turns keep only their key.
+func (j *turnJournal) set(id int64, state string) {
+	if j == nil || id == 0 {
+		return
+	}
+	q := `UPDATE turns SET state = ?, updated = ? WHERE id = ?`
+	if state == turnAnswered || state == turnFailed {
+		q = `UPDATE turns SET state = ?, updated = ?, message = '' WHERE id = ?`
+	}
+	if _, err := j.db.Exec(q, state, time.Now().Unix(), id); err != nil {
+		log.Printf("turn journal: %v", err)
+	}
+}
+
+// attempt counts a run of turn id and returns how many runs it has had,
+// this one included.
+func (j *turnJournal) attempt(id int64) int {
+	if j == nil || id == 0 {
+		return 1
+	}
+	var n int
+	err := j.db.QueryRow(`UPDATE turns SET attempts = attempts + 1, updated = ? WHERE id = ? RETURNING attempts`,
+		time.Now().Unix(), id).Scan(&n)
+	if err != nil {
+		log.Printf("turn journal: %v", err)
+		return 1
+	}
+	return n
+}
+
+// pendingTurn is a turn left unanswered by the previous run.
+type pendingTurn struct {
+	id          int64
+	msg         chat.Inbound
+	interrupted bool // it was processing: the model was asked, tools may have run
+}
+
+// pending returns the turns not answered yet, oldest first.
+func (j *turnJournal) pending() ([]pendingTurn, error) {
+	if j == nil {
+		return nil, nil
+	}
+	rows, err := j.db.Query(`SELECT id, message, state FROM turns WHERE state NOT IN (?, ?) ORDER BY id`, turnAnswered, turnFailed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var turns []pendingTurn
+	for rows.Next() {
+		var t pendingTurn
+		var raw, state string
+		if err := rows.Scan(&t.id, &raw, &state); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(raw), &t.msg); err != nil {
+			return nil, err
+		}
+		t.interrupted = state == turnProcessing
+		turns = append(turns, t)
+	}
+	return turns, rows.Err()
+}
+
+// runTurn journals msg around processInbound, skipping it if its turn was
+// already answered.
+func (a *AgentLoop) runTurn(ctx context.Context, msg chat.Inbound) {
+	id, ok := a.turns.receive(msg, a.privateSession(msg.Channel+":"+msg.ChatID) != nil)
+	if !ok {
+		log.Printf("turn journal: %s:%s message %s already answered, skipping", msg.Channel, msg.ChatID, msg.MessageID())
+		return
+	}
+	a.journalled(ctx, id, msg)
+}
+
+// journalled runs turn id of msg, counting the attempt first. A turn already
+// run turnMaxAttempts times without being answered is marked failed instead,
+// and the user told.
+func (a *AgentLoop) journalled(ctx context.Context, id int64, msg chat.Inbound) {
+	if n := a.turns.attempt(id); n > turnMaxAttempts {
+		log.Printf("turn journal: %s:%s message %s failed %d times, giving up", msg.Channel, msg.ChatID, msg.MessageID(), n-1)
+		a.turns.set(id, turnFailed)
+		out := chat.Outbound{Channel: msg.Channel, ChatID: msg.ChatID, ReplyTo: msg.MessageID(), Type: chat.TypeError,
+			Content: fmt.Sprintf("Sorry, I couldn't answer this message: I tried %d times and failed each time.", n-1)}
+		select {
+		case a.hub.Out <- out:
+		default:
+			log.Println("Outbound channel full, dropping message")
+		}
+		return
+	}
+	a.turn = id
+	a.processInbound(ctx, msg)
+	a.turns.set(id, turnAnswered)
+	a.turn = 0
+}
+
+// resumeTurns runs again the turns the previous run left unanswered. Turns
+// that were interrupted while processing are flagged, so the model checks
+// what its tools already did before acting again.
+func (a *AgentLoop) resumeTurns(ctx context.Context) {
+	turns, err := a.turns.pending()
+	if err != nil {
+		log.Printf("turn journal: %v", err)
+		return
+	}
+	if len(turns) > 0 {
+		log.Printf("turn journal: resuming %d unanswered turns", len(turns))
+	}
+	for _, t := range turns {
+		if t.interrupted {
+			if t.msg.Metadata == nil {
+				t.msg.Metadata = make(map[string]interface{})
+			}
+			t.msg.Metadata["resumed"] = true
+		}
+		a.journalled(ctx, t.id, t.msg)
+	}
+}
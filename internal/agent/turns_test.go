@@ -0,0 +1,161 @@
+package agent
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/providers"
+)
+
+func TestTurnJournalResumesAndSkipsAnswered(t *testing.T) {
+	ws := t.TempDir()
+	path := filepath.Join(ws, "turns.db")
+	msg := chat.Inbound{Channel: "telegram", ChatID: "1", SenderID: "u", Content: "hello",
+		Metadata: map[string]interface{}{"message_id": "42"}}
+
+	// A previous run took the message and crashed while the model worked.
+	j, err := openTurnJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, ok := j.receive(msg, false)
+	if !ok || id == 0 {
+		t.Fatalf("receive = %d, %v", id, ok)
+	}
+	j.set(id, turnProcessing)
+	j.db.Close()
+
+	hub := chat.NewHub(10)
+	p := providers.NewStubProvider()
+	ag := NewAgentLoop(hub, p, p.GetDefaultModel(), 5, ws, nil)
+	if err := ag.SetTurnJournal(path); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := ag.turns.pending()
+	if err != nil || len(pending) != 1 || !pending[0].interrupted || pending[0].msg.MessageID() != "42" {
+		t.Fatalf("pending = %+v, %v", pending, err)
+	}
+
+	ag.resumeTurns(context.Background())
+	select {
+	case out := <-hub.Out:
+		if out.ChatID != "1" || out.ReplyTo != "42" {
+			t.Fatalf("unexpected reply %+v", out)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the interrupted turn was not run again")
+	}
+	if pending, _ := ag.turns.pending(); len(pending) != 0 {
+		t.Fatalf("turn still pending after resuming: %+v", pending)
+	}
+
+	// The channel delivers the message again: it is not answered twice.
+	ag.runTurn(context.Background(), msg)
+	select {
+	case out := <-hub.Out:
+		t.Fatalf("answered twice: %+v", out)
+	default:
+	}
+}
+
+func TestTurnJournalSkipsPrivateChats(t *testing.T) {
+	j, err := openTurnJournal(filepath.Join(t.TempDir(), "turns.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, ok := j.receive(chat.Inbound{Channel: "telegram", ChatID: "1", Content: "secret"}, true); id != 0 || !ok {
+		t.Fatalf("private message journalled: %d, %v", id, ok)
+	}
+	if pending, _ := j.pending(); len(pending) != 0 {
+		t.Fatalf("pending = %+v", pending)
+	}
+}
+
+func TestTurnJournalGivesUpAfterMaxAttempts(t *testing.T) {
+	ws := t.TempDir()
+	path := filepath.Join(ws, "turns.db")
+	msg := chat.Inbound{Channel: "telegram", ChatID: "1", SenderID: "u", Content: "hello",
+		Metadata: map[string]interface{}{"message_id": "42"}}
+
+	// Every previous run crashed while answering the message.
+	j, err := openTurnJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := j.receive(msg, false)
+	for i := 0; i < turnMaxAttempts; i++ {
+		j.attempt(id)
+	}
+	j.set(id, turnProcessing)
+
+	hub := chat.NewHub(10)
+	p := providers.NewStubProvider()
+	ag := NewAgentLoop(hub, p, p.GetDefaultModel(), 5, ws, nil)
+	ag.turns = j
+	ag.resumeTurns(context.Background())
+	select {
+	case out := <-hub.Out:
+		if out.Type != chat.TypeError || out.ReplyTo != "42" {
+			t.Fatalf("unexpected message %+v, want the failure notice", out)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the user was not told the turn failed")
+	}
+	if pending, _ := j.pending(); len(pending) != 0 {
+		t.Fatalf("failed turn still pending: %+v", pending)
+	}
+	if _, ok := j.receive(msg, false); ok {
+		t.Fatal("a failed message delivered again would be run again")
+	}
+}
+
+func TestTurnJournalSkipsSystemTurns(t *testing.T) {
+	j, err := openTurnJournal(filepath.Join(t.TempDir(), "turns.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []chat.Inbound{
+		{Channel: "heartbeat", ChatID: "heartbeat", Content: "check"},
+		{Channel: "cron", ChatID: "cron", Content: "job"},
+		{Channel: "telegram", ChatID: "1", SenderID: "cron", Content: "reminder"},
+	} {
+		if id, ok := j.receive(msg, false); id != 0 || !ok {
+			t.Fatalf("%s turn journalled: %d, %v", msg.Channel, id, ok)
+		}
+	}
+}
+
+func TestRunLocalLeavesTheJournalAlone(t *testing.T) {
+	ws := t.TempDir()
+	path := filepath.Join(ws, "turns.db")
+	j, err := openTurnJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A turn of the gateway, still unanswered.
+	j.receive(chat.Inbound{Channel: "telegram", ChatID: "1", SenderID: "u", Content: "hello",
+		Metadata: map[string]interface{}{"message_id": "42"}}, false)
+
+	hub := chat.NewHub(10)
+	p := providers.NewStubProvider()
+	ag := NewAgentLoop(hub, p, p.GetDefaultModel(), 5, ws, nil)
+	ag.turns = j
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ag.RunLocal(ctx)
+	hub.In <- chat.Inbound{Channel: "repl", ChatID: "repl", SenderID: "user", Content: "hi"}
+	select {
+	case out := <-hub.Out:
+		if out.ChatID != "repl" {
+			t.Fatalf("replied %+v, want only the terminal's message answered", out)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no reply")
+	}
+	if pending, _ := j.pending(); len(pending) != 1 {
+		t.Fatalf("pending = %+v, want the gateway's turn left alone", pending)
+	}
+}
@@ -0,0 +1,145 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/providers"
+	"github.com/local/picobot/internal/telemetry"
+)
+
+// undeliveredDir is the workspace directory keeping the replies a channel
+// could not deliver, one subdirectory per chat, for /last full.
+const undeliveredDir = "undelivered"
+
+// fallbackMaxLen is the longest summary (in runes) sent in place of an
+// undelivered reply.
+const fallbackMaxLen = 600
+
+const fallbackPrompt = "The reply below could not be delivered to the user (too long, badly formatted, or the channel is failing). Summarize it in at most three short sentences of plain text, without any Markdown, keeping what the user most needs to know."
+
+// fallbackPartPrompt replaces fallbackPrompt when the channel delivered the
+// reply in part: only the parts that did not arrive are summarized.
+const fallbackPartPrompt = "The reply below is the part of a longer reply that could not be delivered to the user; the rest of it was. Summarize this part in at most three short sentences of plain text, without any Markdown, keeping what the user most needs to know."
+
+// undeliveredPath returns the directory of the undelivered replies of the
+// chat key, in the workspace.
+func (a *AgentLoop) undeliveredPath(key string) string {
+	name := strings.NewReplacer("/", "_", "\\", "_", ":", "_").Replace(key)
+	return filepath.Join(a.workspace, undeliveredDir, name)
+}
+
+// deliverFallback handles the report of a reply its channel gave up on: it
+// keeps the full text in the workspace and sends a short plain-text summary
+// instead, with a pointer to /last full. Replies of chats in private mode,
+// or sent while it was on, are not kept.
+func (a *AgentLoop) deliverFallback(ctx context.Context, msg chat.Inbound) {
+	key := msg.Channel + ":" + msg.ChatID
+	reason, _ := msg.Metadata["error"].(string)
+	log.Printf("reply to %s not delivered (%s), sending a summary", key, reason)
+
+	saved := false
+	wasPrivate, _ := msg.Metadata["private"].(bool)
+	private := wasPrivate || a.privateSession(key) != nil
+	dir := a.undeliveredPath(key)
+	path := filepath.Join(dir, time.Now().UTC().Format("20060102-150405")+".md")
+	if private {
+		// Nothing of a private conversation is written to disk.
+	} else if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Printf("error saving undelivered reply: %v", err)
+	} else if err := os.WriteFile(path, []byte(msg.Content), 0o644); err != nil {
+		log.Printf("error saving undelivered reply: %v", err)
+	} else {
+		saved = true
+	}
+
+	summary := a.summarizeUndelivered(ctx, msg)
+	if saved {
+		summary += "\n\n(The full reply could not be delivered here. Send /last full to get it as a file.)"
+	}
+	if _, ok := msg.Metadata["missing"].(string); ok {
+		summary = "(Part of my reply could not be delivered. In short:) " + summary
+	}
+	if private {
+		summary = privateMark + summary
+	}
+	out := chat.Outbound{Channel: msg.Channel, ChatID: msg.ChatID, Content: summary, ReplyTo: msg.MessageID(), Private: private,
+		Metadata: map[string]interface{}{"fallback": true}}
+	select {
+	case a.hub.Out <- out:
+	default:
+		log.Println("Outbound channel full, dropping message")
+	}
+}
+
+// summarizeUndelivered asks the model for a short plain-text version of the
+// undelivered reply, or of its undelivered parts when the rest arrived; if
+// that fails, their start stands in for it.
+func (a *AgentLoop) summarizeUndelivered(ctx context.Context, msg chat.Inbound) string {
+	prompt, text := fallbackPrompt, msg.Content
+	if missing, _ := msg.Metadata["missing"].(string); missing != "" {
+		prompt, text = fallbackPartPrompt, missing
+	}
+	messages := []providers.Message{
+		{Role: "system", Content: prompt},
+		{Role: "user", Content: text},
+	}
+	a.recordPromptStats(telemetry.PromptRecord{Channel: msg.Channel, ChatID: msg.ChatID, Feature: telemetry.FeatureUndelivered,
+		Stats: telemetry.PromptStats{System: telemetry.EstimateTokens(prompt), Current: telemetry.EstimateTokens(text)}}, nil)
+	resp, err := a.provider.Chat(ctx, messages, nil, a.modelFor(msg.Channel, msg.ChatID))
+	summary := ""
+	if err != nil {
+		log.Printf("error summarizing undelivered reply: %v", err)
+	} else {
+		summary = strings.TrimSpace(resp.Content)
+	}
+	if summary == "" {
+		summary = strings.TrimSpace(text)
+	}
+	if utf8.RuneCountInString(summary) > fallbackMaxLen {
+		summary = string([]rune(summary)[:fallbackMaxLen-1]) + "…"
+	}
+	return summary
+}
+
+// lastText answers /last full by sending the chat's latest undelivered
+// reply as a file.
+func (a *AgentLoop) lastText(msg chat.Inbound, args []string) string {
+	if len(args) != 1 || !strings.EqualFold(args[0], "full") {
+		return "Usage: /last full, to get the full text of the last reply that could not be delivered."
+	}
+	entries, _ := os.ReadDir(a.undeliveredPath(msg.Channel + ":" + msg.ChatID))
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".md") {
+			names = append(names, e.Name())
+		}
+	}
+	if len(names) == 0 {
+		return "There is no undelivered reply in this chat."
+	}
+	sort.Strings(names)
+	latest := names[len(names)-1]
+	path, err := filepath.Abs(filepath.Join(a.undeliveredPath(msg.Channel+":"+msg.ChatID), latest))
+	if err != nil {
+		return "Sorry, I couldn't find the reply: " + err.Error()
+	}
+	when, _ := time.ParseInLocation("20060102-150405", strings.TrimSuffix(latest, ".md"), time.UTC)
+	out := chat.Outbound{Channel: msg.Channel, ChatID: msg.ChatID, ReplyTo: msg.MessageID(), Media: []string{path},
+		Content:  fmt.Sprintf("The full reply of %s:", when.Local().Format("Jan 2 15:04")),
+		Metadata: map[string]interface{}{"fallback": true}}
+	select {
+	case a.hub.Out <- out:
+	default:
+		log.Println("Outbound channel full, dropping message")
+	}
+	return ""
+}
@@ -0,0 +1,86 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/providers"
+)
+
+func TestUndeliveredReplyFallback(t *testing.T) {
+	hub := chat.NewHub(10)
+	ws := t.TempDir()
+	ag := NewAgentLoop(hub, providers.NewStubProvider(), "stub", 3, ws, nil)
+	next := func() chat.Outbound {
+		t.Helper()
+		select {
+		case out := <-hub.Out:
+			return out
+		case <-time.After(2 * time.Second):
+			t.Fatal("no reply")
+		}
+		return chat.Outbound{}
+	}
+
+	long := strings.Repeat("A very long reply with `broken *markup. ", 200)
+	hub.ReportUndelivered(chat.Outbound{Channel: "telegram", ChatID: "1", Content: long, ReplyTo: "42"}, "message is too long")
+	ag.processInbound(context.Background(), <-hub.In)
+	out := next()
+	if fallback, _ := out.Metadata["fallback"].(bool); !fallback || out.ReplyTo != "42" {
+		t.Fatalf("fallback = %+v", out)
+	}
+	if !strings.Contains(out.Content, "/last full") || len([]rune(out.Content)) > fallbackMaxLen+200 {
+		t.Errorf("summary = %q", out.Content)
+	}
+	if got := promptFeatures(t, ws); len(got) != 1 || got[0] != "undelivered" {
+		t.Errorf("recorded features %v, want [undelivered]", got)
+	}
+
+	// The fallback itself is never reported again.
+	hub.ReportUndelivered(out, "still failing")
+	select {
+	case in := <-hub.In:
+		t.Fatalf("fallback reported: %+v", in)
+	default:
+	}
+
+	ag.processInbound(context.Background(), chat.Inbound{Channel: "telegram", ChatID: "1", Content: "/last full"})
+	out = next()
+	if len(out.Media) != 1 {
+		t.Fatalf("/last full = %+v", out)
+	}
+	if data, err := os.ReadFile(out.Media[0]); err != nil || string(data) != long {
+		t.Errorf("saved reply = %d bytes, %v", len(data), err)
+	}
+	select {
+	case extra := <-hub.Out:
+		t.Errorf("unexpected extra reply %q", extra.Content)
+	default:
+	}
+
+	ag.processInbound(context.Background(), chat.Inbound{Channel: "telegram", ChatID: "2", Content: "/last full"})
+	if out := next(); !strings.Contains(out.Content, "no undelivered reply") {
+		t.Errorf("/last full without one = %q", out.Content)
+	}
+}
+
+func TestUndeliveredPartIsSummarizedAlone(t *testing.T) {
+	hub := chat.NewHub(10)
+	ag := NewAgentLoop(hub, providers.NewStubProvider(), "stub", 3, t.TempDir(), nil)
+
+	hub.ReportUndelivered(chat.Outbound{Channel: "slack", ChatID: "C1", Content: "delivered start. lost end."}, "timeout", "lost end.")
+	ag.processInbound(context.Background(), <-hub.In)
+	select {
+	case out := <-hub.Out:
+		// The stub echoes what it is asked to summarize.
+		if !strings.Contains(out.Content, "Echo: lost end.") || strings.Contains(out.Content, "delivered start") {
+			t.Fatalf("summary = %q, want only the undelivered part", out.Content)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no reply")
+	}
+}
@@ -0,0 +1,204 @@
+// Package broadcast sends one message to many chats (announcements, digests)
+// at a pace each channel's API accepts, instead of a burst that gets
+// throttled half-way through.
+package broadcast
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+// Limit is how fast a channel may send: PerSecond messages overall, and one
+// message per PerChat to the same chat. MaxLen is the length above which the
+// channel splits a message, each part counting as a message.
+type Limit struct {
+	PerSecond float64
+	PerChat   time.Duration
+	MaxLen    int
+}
+
+// DefaultLimits are the documented (Telegram, Discord, Slack) or safe
+// (WhatsApp, whose personal accounts get banned for bulk sending) limits of
+// each channel.
+var DefaultLimits = map[string]Limit{
+	"telegram": {PerSecond: 30, PerChat: time.Second, MaxLen: 4096},
+	"discord":  {PerSecond: 5, PerChat: time.Second, MaxLen: 2000},
+	"slack":    {PerSecond: 1, PerChat: time.Second, MaxLen: 4000},
+	"whatsapp": {PerSecond: 0.5, PerChat: 2 * time.Second, MaxLen: 4096},
+}
+
+// fallback is the limit of channels without one.
+var fallback = Limit{PerSecond: 1, PerChat: time.Second}
+
+// ProgressEvery is how often a running broadcast reports its progress.
+const ProgressEvery = 10 * time.Second
+
+// Target is a chat to broadcast to.
+type Target struct {
+	Channel string
+	ChatID  string
+}
+
+// ParseTarget parses "channel:chatID".
+func ParseTarget(s string) (Target, error) {
+	channel, chatID, ok := strings.Cut(s, ":")
+	if !ok || channel == "" || chatID == "" {
+		return Target{}, fmt.Errorf("invalid broadcast target %q, want channel:chatID", s)
+	}
+	return Target{Channel: channel, ChatID: chatID}, nil
+}
+
+func (t Target) String() string { return t.Channel + ":" + t.ChatID }
+
+// Progress is the state of a broadcast.
+type Progress struct {
+	Sent, Total int
+	Done        bool
+}
+
+func (p Progress) String() string {
+	if p.Done {
+		return fmt.Sprintf("Broadcast finished: sent to %d of %d chats.", p.Sent, p.Total)
+	}
+	return fmt.Sprintf("Broadcast in progress: sent to %d of %d chats.", p.Sent, p.Total)
+}
+
+// Broadcaster paces the messages it queues on a hub's outbound channel. The
+// pace is shared by all its broadcasts, so two at once do not go over the
+// limits either.
+type Broadcaster struct {
+	out    chan<- chat.Outbound
+	limits map[string]Limit
+
+	mu       sync.Mutex
+	nextSlot map[string]time.Time // per channel
+	chatNext map[string]time.Time // per chat
+	now      func() time.Time
+	sleep    func(ctx context.Context, d time.Duration) error
+}
+
+// New returns a Broadcaster sending to out. overrides replace the default
+// limits of the channels they name.
+func New(out chan<- chat.Outbound, overrides map[string]Limit) *Broadcaster {
+	limits := make(map[string]Limit, len(DefaultLimits)+len(overrides))
+	for k, v := range DefaultLimits {
+		limits[k] = v
+	}
+	for k, v := range overrides {
+		limits[k] = v
+	}
+	return &Broadcaster{
+		out:      out,
+		limits:   limits,
+		nextSlot: make(map[string]time.Time),
+		chatNext: make(map[string]time.Time),
+		now:      time.Now,
+		sleep:    sleepCtx,
+	}
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// Send sends content to every target and returns how many were sent. The
+// channels are served in parallel, each at its own pace. report, if not
+// nil, is called every ProgressEvery and once at the end. Send stops early
+// when ctx is done.
+func (b *Broadcaster) Send(ctx context.Context, targets []Target, content string, report func(Progress)) (int, error) {
+	byChannel := make(map[string][]Target)
+	for _, t := range targets {
+		byChannel[t.Channel] = append(byChannel[t.Channel], t)
+	}
+	var sent atomic.Int64
+	var wg sync.WaitGroup
+	errs := make(chan error, len(byChannel))
+	for channel, ts := range byChannel {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, t := range ts {
+				if err := b.wait(ctx, channel, t.String(), content); err != nil {
+					errs <- err
+					return
+				}
+				select {
+				case b.out <- chat.Outbound{Channel: t.Channel, ChatID: t.ChatID, Content: content}:
+					sent.Add(1)
+				case <-ctx.Done():
+					errs <- ctx.Err()
+					return
+				}
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() { wg.Wait(); close(done) }()
+	tick := time.NewTicker(ProgressEvery)
+	defer tick.Stop()
+wait:
+	for {
+		select {
+		case <-tick.C:
+			if report != nil {
+				report(Progress{Sent: int(sent.Load()), Total: len(targets)})
+			}
+		case <-done:
+			break wait
+		}
+	}
+	n := int(sent.Load())
+	if report != nil {
+		report(Progress{Sent: n, Total: len(targets), Done: true})
+	}
+	select {
+	case err := <-errs:
+		return n, err
+	default:
+		return n, nil
+	}
+}
+
+// wait reserves the next slot of channel and chat for content, and sleeps
+// until it comes.
+func (b *Broadcaster) wait(ctx context.Context, channel, chatKey, content string) error {
+	lim, ok := b.limits[channel]
+	if !ok {
+		lim = fallback
+	}
+	parts := 1
+	if lim.MaxLen > 0 {
+		parts = max(1, (len([]rune(content))+lim.MaxLen-1)/lim.MaxLen)
+	}
+	b.mu.Lock()
+	now := b.now()
+	at := now
+	if t := b.nextSlot[channel]; t.After(at) {
+		at = t
+	}
+	if t := b.chatNext[chatKey]; t.After(at) {
+		at = t
+	}
+	if lim.PerSecond > 0 {
+		b.nextSlot[channel] = at.Add(time.Duration(float64(parts) * float64(time.Second) / lim.PerSecond))
+	}
+	b.chatNext[chatKey] = at.Add(time.Duration(parts) * lim.PerChat)
+	b.mu.Unlock()
+	return b.sleep(ctx, at.Sub(now))
+}
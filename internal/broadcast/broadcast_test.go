@@ -0,0 +1,82 @@
+package broadcast
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+// fakeClock makes sleeps advance the time instead of waiting, and records
+// when each message was sent.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(_ context.Context, d time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if d > 0 {
+		c.now = c.now.Add(d)
+	}
+	return nil
+}
+
+func TestSendPacesPerChannel(t *testing.T) {
+	out := make(chan chat.Outbound, 100)
+	b := New(out, map[string]Limit{"slow": {PerSecond: 2, PerChat: time.Second}})
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	b.now, b.sleep = clock.Now, clock.Sleep
+
+	var targets []Target
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		targets = append(targets, Target{Channel: "slow", ChatID: id})
+	}
+	var last Progress
+	n, err := b.Send(context.Background(), targets, "hello", func(p Progress) { last = p })
+	if err != nil || n != 5 {
+		t.Fatalf("Send = %d, %v; want 5, nil", n, err)
+	}
+	if !last.Done || last.Sent != 5 || last.Total != 5 {
+		t.Errorf("last progress = %+v", last)
+	}
+	if len(out) != 5 {
+		t.Fatalf("queued %d messages, want 5", len(out))
+	}
+	// 5 messages at 2/s: the last one goes out 2s after the first.
+	if got := clock.Now().Sub(time.Unix(0, 0)); got != 2*time.Second {
+		t.Errorf("broadcast took %v, want 2s", got)
+	}
+}
+
+func TestWaitCountsPartsPerChat(t *testing.T) {
+	b := New(make(chan chat.Outbound, 1), nil)
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	b.now, b.sleep = clock.Now, clock.Sleep
+
+	long := strings.Repeat("a", 4096*3) // three Telegram messages
+	b.wait(context.Background(), "telegram", "telegram:1", long)
+	b.wait(context.Background(), "telegram", "telegram:1", "short")
+	if got := clock.Now().Sub(time.Unix(0, 0)); got != 3*time.Second {
+		t.Errorf("second message to the chat after %v, want 3s", got)
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	if tg, err := ParseTarget("whatsapp:1555@s.whatsapp.net"); err != nil || tg.Channel != "whatsapp" || tg.ChatID != "1555@s.whatsapp.net" {
+		t.Errorf("ParseTarget = %+v, %v", tg, err)
+	}
+	if _, err := ParseTarget("telegram"); err == nil {
+		t.Error("expected an error without a chat ID")
+	}
+}
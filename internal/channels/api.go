@@ -0,0 +1,569 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/netguard"
+	"github.com/local/picobot/internal/useragent"
+	"github.com/local/picobot/internal/webhooks"
+)
+
+const (
+	// apiDefaultListen is the address the REST API listens on by default:
+	// local only, to be exposed through a reverse proxy or a VPN.
+	apiDefaultListen = "127.0.0.1:8792"
+	// apiDefaultTimeout is how long a request waits for the reply.
+	apiDefaultTimeout = 120 * time.Second
+	// apiMaxBody caps the size of a request.
+	apiMaxBody = 256 << 10
+	// apiCallbackAttempts is how many times a callback is posted before the
+	// reply is given up on.
+	apiCallbackAttempts = 3
+	// apiCallbackTTL is how long a chat's callback URL is kept for later
+	// messages after it was last given or posted to.
+	apiCallbackTTL = 30 * 24 * time.Hour
+)
+
+// StartAPI serves the REST API on cfg.Listen, through which other services
+// use the agent as a backend: POST /v1/messages sends a message and answers
+// with the reply, streams it as server-sent events when asked to with
+// "Accept: text/event-stream", or, given a callback URL, answers at once
+// and posts the reply there when it is ready. Callers authenticate with one
+// of the configured tokens, as a bearer token. With cfg.SigningSecret,
+// requests must be signed, and responses are.
+func StartAPI(ctx context.Context, hub *chat.Hub, cfg config.APIConfig) error {
+	if len(cfg.Tokens) == 0 {
+		return fmt.Errorf("api: at least one token is required")
+	}
+	s, err := newAPIServer(ctx, hub, cfg)
+	if err != nil {
+		return err
+	}
+	addr := cfg.Listen
+	if addr == "" {
+		addr = apiDefaultListen
+	}
+	ln, err := netguard.Listen("api", addr, cfg.Transport, "http/1.1")
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: s.handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+	go func() {
+		log.Printf("api: listening on %s://%s", netguard.Scheme(cfg.Transport), ln.Addr())
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("api: %v", err)
+		}
+	}()
+	go s.runOutbound()
+	return nil
+}
+
+// apiServer is the REST API: its callers and the requests waiting for
+// their replies.
+type apiServer struct {
+	hub     *chat.Hub
+	outCh   <-chan chat.Outbound
+	ctx     context.Context
+	tokens  []config.APIToken
+	timeout time.Duration
+	client  *http.Client   // posts the callbacks
+	secret  string         // signs the callbacks
+	signer  *messageSigner // signs the responses and checks the requests; nil: none
+	private bool           // callbacks may reach private addresses
+
+	upgrader websocket.Upgrader
+
+	mu        sync.Mutex
+	waiting   map[string]chan apiReply     // by message ID, synchronous requests
+	streams   map[string]*apiStream        // by message ID, requests answered as events
+	callbacks map[string]apiCallback       // by chat ID, the last callback URL given
+	sockets   map[string]map[*webConn]bool // by chat ID, the WebSockets subscribed
+	nextID    int
+	pruned    time.Time // when expired callbacks were last removed
+}
+
+// apiCallback is the callback URL of a chat, kept until it expires or a
+// reply posted to it fails.
+type apiCallback struct {
+	url     string
+	expires time.Time
+}
+
+// apiRequest is the body of POST /v1/messages. ChatID (default "default")
+// names the conversation, whose history the agent keeps; each caller has
+// chats of its own. With CallbackURL, the request is answered at once and
+// the reply posted there, as are later messages for the chat (reminders).
+type apiRequest struct {
+	ChatID      string `json:"chatId"`
+	Text        string `json:"text"`
+	Sender      string `json:"sender"`
+	CallbackURL string `json:"callbackUrl"`
+}
+
+// apiReply is a reply of the agent: the body of a synchronous response,
+// and of a callback.
+type apiReply struct {
+	ID     string   `json:"id,omitempty"` // of the message replied to
+	ChatID string   `json:"chatId"`
+	Text   string   `json:"text"`
+	Type   string   `json:"type,omitempty"` // error, reminder or report
+	Files  []string `json:"files,omitempty"`
+}
+
+// checkAPITokens reports the first of the channel's tokens without a name
+// or a token. Names may not hold ":", which separates the caller from the
+// chat in chat IDs.
+func checkAPITokens(channel string, tokens []config.APIToken) error {
+	for i, t := range tokens {
+		if t.Name == "" || t.Token == "" || strings.Contains(t.Name, ":") {
+			return fmt.Errorf("%s: tokens[%d] needs a name (without \":\") and a token", channel, i)
+		}
+	}
+	return nil
+}
+
+// apiTokenName returns the name of the token among tokens equal to token,
+// or "" when there is none.
+func apiTokenName(tokens []config.APIToken, token string) string {
+	if token == "" {
+		return ""
+	}
+	for _, t := range tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t.Token)) == 1 {
+			return t.Name
+		}
+	}
+	return ""
+}
+
+func newAPIServer(ctx context.Context, hub *chat.Hub, cfg config.APIConfig) (*apiServer, error) {
+	if err := checkAPITokens("api", cfg.Tokens); err != nil {
+		return nil, err
+	}
+	timeout := time.Duration(cfg.TimeoutS) * time.Second
+	if timeout <= 0 {
+		timeout = apiDefaultTimeout
+	}
+	// WebSocket and event stream clients see replies as they are written,
+	// and the tools run for them.
+	hub.EnableStreaming("api")
+	hub.EnableToolEvents("api")
+	return &apiServer{
+		hub:     hub,
+		outCh:   hub.Subscribe("api"),
+		ctx:     ctx,
+		tokens:  cfg.Tokens,
+		timeout: timeout,
+		client:  callbackClient(cfg.AllowPrivateCallbacks),
+		secret:  cfg.CallbackSecret,
+		signer:  newMessageSigner(cfg.SigningSecret),
+		private: cfg.AllowPrivateCallbacks,
+		// Clients authenticate with a token rather than a cookie, so pages
+		// of any origin may connect.
+		upgrader:  websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }},
+		waiting:   make(map[string]chan apiReply),
+		streams:   make(map[string]*apiStream),
+		callbacks: make(map[string]apiCallback),
+		sockets:   make(map[string]map[*webConn]bool),
+	}, nil
+}
+
+// handler returns the API's routes:
+//
+//	POST /v1/messages     a message for the agent (apiRequest), answered with
+//	                      the reply (apiReply), as apiFrame events with
+//	                      "Accept: text/event-stream", or 202 when a callback
+//	                      URL is given
+//	GET  /v1/ws?chatId=   a WebSocket exchanging apiFrames with the chat
+//
+// With a signing secret, requests carry webhooks.TimestampHeader and
+// webhooks.SignatureHeader, signing their body as webhooks.Sign does, and
+// responses carry them too; frames and events travel as apiSignedFrames.
+func (s *apiServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/messages", s.handleMessage)
+	mux.HandleFunc("GET /v1/ws", s.handleSocket)
+	return mux
+}
+
+// caller returns the name of the token r carries, or "" when it carries
+// none of them. The token is a bearer token, or for WebSockets, which
+// browsers open without headers, the "token" query parameter.
+func (s *apiServer) caller(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok && r.URL.Path == "/v1/ws" {
+		token, ok = r.URL.Query().Get("token"), true
+	}
+	if !ok {
+		return ""
+	}
+	return apiTokenName(s.tokens, token)
+}
+
+func (s *apiServer) handleMessage(w http.ResponseWriter, r *http.Request) {
+	caller := s.caller(r)
+	if caller == "" {
+		s.fail(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, apiMaxBody))
+	if err != nil {
+		s.fail(w, http.StatusBadRequest, "reading the request: "+err.Error())
+		return
+	}
+	if s.signer != nil {
+		if err := s.signer.verify(r.Header.Get(webhooks.TimestampHeader), r.Header.Get(webhooks.SignatureHeader), body); err != nil {
+			log.Printf("api: refused a request of %s: %v", caller, err)
+			s.fail(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+	}
+	var req apiRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		s.fail(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	text := strings.TrimSpace(req.Text)
+	if text == "" {
+		s.fail(w, http.StatusBadRequest, "text is required")
+		return
+	}
+	if req.ChatID == "" {
+		req.ChatID = "default"
+	}
+	if !webChatIDRE.MatchString(req.ChatID) {
+		s.fail(w, http.StatusBadRequest, "chatId may only have letters, digits, _ and - (at most 64)")
+		return
+	}
+	if req.CallbackURL != "" {
+		u, err := url.Parse(req.CallbackURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			s.fail(w, http.StatusBadRequest, "callbackUrl must be an http(s) URL")
+			return
+		}
+		if ip := net.ParseIP(u.Hostname()); ip != nil && !s.private && !publicIP(ip) {
+			s.fail(w, http.StatusBadRequest, "callbackUrl may not be a private address")
+			return
+		}
+	}
+	// Chats are kept apart by caller.
+	chatID := caller + ":" + req.ChatID
+
+	s.mu.Lock()
+	id := s.newMessageID()
+	var replies chan apiReply
+	var stream *apiStream
+	switch {
+	case req.CallbackURL != "":
+		s.pruneCallbacks()
+		s.callbacks[chatID] = apiCallback{url: req.CallbackURL, expires: time.Now().Add(apiCallbackTTL)}
+	case wantsEvents(r):
+		stream = newAPIStream()
+		s.streams[id] = stream
+	default:
+		replies = make(chan apiReply, 1)
+		s.waiting[id] = replies
+	}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.waiting, id)
+		delete(s.streams, id)
+		s.mu.Unlock()
+	}()
+
+	if !s.send(r.Context(), caller, chatID, id, req.Sender, text) {
+		return
+	}
+
+	if stream != nil {
+		s.serveEvents(w, r, id, req.ChatID, stream)
+		return
+	}
+
+	if replies == nil {
+		s.respond(w, http.StatusAccepted, map[string]string{"id": id, "chatId": req.ChatID, "status": "queued"})
+		return
+	}
+	timer := time.NewTimer(s.timeout)
+	defer timer.Stop()
+	select {
+	case reply := <-replies:
+		s.respond(w, http.StatusOK, reply)
+	case <-timer.C:
+		s.fail(w, http.StatusGatewayTimeout, "no reply within "+s.timeout.String()+"; use a callbackUrl for long tasks")
+	case <-r.Context().Done():
+	}
+}
+
+// newMessageID returns the ID of a new message. Called with mu held.
+func (s *apiServer) newMessageID() string {
+	s.nextID++
+	return "a" + strconv.Itoa(s.nextID)
+}
+
+// send hands a message of caller in chatID (qualified with the caller) to
+// the agent, reporting false when ctx is done first.
+func (s *apiServer) send(ctx context.Context, caller, chatID, id, sender, text string) bool {
+	if sender == "" {
+		sender = caller
+	}
+	log.Printf("api: message from %s in %s: %s", caller, chatID, truncate(text, 50))
+	in := chat.Inbound{
+		Channel:    "api",
+		SenderID:   caller,
+		SenderName: sender,
+		ChatID:     chatID,
+		Content:    text,
+		Timestamp:  time.Now(),
+		Metadata:   map[string]interface{}{"message_id": id, "is_dm": true},
+	}
+	select {
+	case s.hub.In <- in:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// respond answers with v as JSON, signed when the API has a signing secret.
+func (s *apiServer) respond(w http.ResponseWriter, status int, v any) {
+	body, _ := json.Marshal(v)
+	body = append(body, '\n')
+	w.Header().Set("Content-Type", "application/json")
+	if s.signer != nil {
+		ts, sig := s.signer.sign(body)
+		w.Header().Set(webhooks.TimestampHeader, ts)
+		w.Header().Set(webhooks.SignatureHeader, sig)
+	}
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// fail answers with a JSON error.
+func (s *apiServer) fail(w http.ResponseWriter, status int, msg string) {
+	s.respond(w, status, map[string]string{"error": msg})
+}
+
+// runOutbound reads replies from the hub's api subscription and sends each
+// to the chat's WebSockets and the request waiting for it, or else posts it
+// to the chat's callback URL.
+func (s *apiServer) runOutbound() {
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case out := <-s.outCh:
+			s.deliver(out)
+		}
+	}
+}
+
+func (s *apiServer) deliver(out chat.Outbound) {
+	_, chatID, _ := strings.Cut(out.ChatID, ":")
+	reply := apiReply{ID: out.ReplyTo, ChatID: chatID, Text: stripHidingMarkers(out.Content, false), Type: out.Type, Files: out.Media}
+	tool, isTool := out.Metadata["tool_event"].(chat.ToolEvent)
+	// Partial snapshots and tool events are only of use while the reply is
+	// being written.
+	passing := out.Partial || isTool
+	// A followup (such as /research's acknowledgement) announces the reply
+	// still to come, which the waiting request takes instead.
+	followup, _ := out.Metadata["followup"].(bool)
+	s.mu.Lock()
+	var conns []*webConn
+	for c := range s.sockets[out.ChatID] {
+		conns = append(conns, c)
+	}
+	replies, waiting := s.waiting[out.ReplyTo]
+	stream := s.streams[out.ReplyTo]
+	if !passing && !followup {
+		// A request takes the first reply to its message.
+		delete(s.waiting, out.ReplyTo)
+		delete(s.streams, out.ReplyTo)
+	}
+	callback := s.callbacks[out.ChatID].url
+	if time.Now().After(s.callbacks[out.ChatID].expires) {
+		delete(s.callbacks, out.ChatID)
+		callback = ""
+	}
+	s.mu.Unlock()
+
+	frame := apiFrame{Type: "message", ID: out.StreamID, ReplyTo: out.ReplyTo, ChatID: chatID, Text: reply.Text, Kind: out.Type, Files: out.Media}
+	switch {
+	case isTool:
+		frame = apiFrame{Type: "tool", ReplyTo: out.ReplyTo, ChatID: chatID, Tool: tool.Name,
+			DurationMs: tool.Duration.Milliseconds(), Error: tool.Error}
+	case out.Partial:
+		frame.Type = "partial"
+	}
+	sealed := s.seal(frame)
+	for _, c := range conns {
+		if passing {
+			c.offer(sealed)
+		} else {
+			c.send(sealed)
+		}
+	}
+	if stream != nil {
+		if passing || followup {
+			stream.offer(frame)
+		} else {
+			stream.final <- frame
+		}
+		return
+	}
+	if passing || (waiting && followup) {
+		return
+	}
+	if waiting {
+		replies <- reply
+		return
+	}
+	if len(conns) > 0 {
+		return
+	}
+	if callback == "" {
+		// A late reply to a request that timed out, or a reminder for a
+		// chat with no callback: nobody to give it to.
+		log.Printf("api: dropped a message for %s: no request waiting and no callback URL", out.ChatID)
+		return
+	}
+	go func() {
+		err := s.postCallback(callback, reply)
+		s.mu.Lock()
+		// Unless the caller gave another URL meanwhile.
+		if cb, ok := s.callbacks[out.ChatID]; ok && cb.url == callback {
+			if err != nil {
+				delete(s.callbacks, out.ChatID)
+			} else {
+				s.callbacks[out.ChatID] = apiCallback{url: callback, expires: time.Now().Add(apiCallbackTTL)}
+			}
+		}
+		s.mu.Unlock()
+		if err != nil {
+			log.Printf("api: callback %s: %v", callback, err)
+			s.hub.ReportUndelivered(out, err.Error())
+		}
+	}()
+}
+
+// pruneCallbacks removes the expired callbacks, at most once an hour. The
+// caller holds s.mu.
+func (s *apiServer) pruneCallbacks() {
+	now := time.Now()
+	if now.Sub(s.pruned) < time.Hour {
+		return
+	}
+	for chatID, cb := range s.callbacks {
+		if now.After(cb.expires) {
+			delete(s.callbacks, chatID)
+		}
+	}
+	s.pruned = now
+}
+
+// postCallback posts reply to url, retrying on network and server errors.
+func (s *apiServer) postCallback(url string, reply apiReply) error {
+	body, err := json.Marshal(reply)
+	if err != nil {
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(s.ctx, "POST", url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if s.secret != "" {
+			ts := strconv.FormatInt(time.Now().Unix(), 10)
+			req.Header.Set(webhooks.TimestampHeader, ts)
+			req.Header.Set(webhooks.SignatureHeader, webhooks.Sign(s.secret, ts, body))
+		}
+		resp, err := s.client.Do(req)
+		if err == nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+			if resp.StatusCode < 300 {
+				return nil
+			}
+			err = fmt.Errorf("%s", resp.Status)
+			if resp.StatusCode < 500 {
+				return err
+			}
+		}
+		if attempt == apiCallbackAttempts || errors.Is(err, errPrivateCallback) {
+			return err
+		}
+		select {
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		case <-time.After(time.Duration(attempt) * 2 * time.Second):
+		}
+	}
+}
+
+// errPrivateCallback refuses a callback to a private address.
+var errPrivateCallback = errors.New("not a public address")
+
+// callbackClient returns the client posting the callbacks. Unless
+// allowPrivate, it only connects to public addresses, checked once the host
+// is resolved, so that callers cannot make picobot reach the services of its
+// own network.
+func callbackClient(allowPrivate bool) *http.Client {
+	c := useragent.Client(30 * time.Second)
+	if allowPrivate {
+		return c
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: func(_, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+			return fmt.Errorf("%s is %w", host, errPrivateCallback)
+		}
+		return nil
+	}}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would connect on our behalf, past the check.
+	tr.Proxy = nil
+	tr.DialContext = dialer.DialContext
+	c.Transport = &useragent.Transport{Base: tr}
+	return c
+}
+
+// sharedAddressSpace is 100.64.0.0/10, the carrier-grade NAT range (RFC
+// 6598), which net.IP.IsPrivate leaves out.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// publicIP reports whether ip is neither loopback, private, shared (CGNAT),
+// link-local, multicast nor unspecified.
+func publicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip) && !ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified()
+}
@@ -0,0 +1,119 @@
+package channels
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/local/picobot/internal/webhooks"
+)
+
+// signatureWindow is how far a signed message's timestamp may be from the
+// clock before the message is refused. Signatures are remembered as long,
+// so that none is accepted twice.
+const signatureWindow = 5 * time.Minute
+
+// errSignature refuses a message that is not signed, or whose signature is
+// stale, replayed or does not match.
+var errSignature = errors.New("bad signature")
+
+// messageSigner signs the messages of the API and gRPC channels with their
+// signing secret, and checks the messages of their clients, the way
+// webhooks.Sign signs events: an HMAC-SHA256 of "<timestamp>.<body>".
+type messageSigner struct {
+	secret string
+	now    func() time.Time
+
+	mu     sync.Mutex
+	seen   map[string]time.Time // by signature, until when it is remembered
+	pruned time.Time
+}
+
+// newMessageSigner returns the signer of secret, or nil when it is empty:
+// messages are then neither signed nor checked.
+func newMessageSigner(secret string) *messageSigner {
+	if secret == "" {
+		return nil
+	}
+	return &messageSigner{secret: secret, now: time.Now, seen: make(map[string]time.Time)}
+}
+
+// sign returns the timestamp and signature of body.
+func (m *messageSigner) sign(body []byte) (timestamp, signature string) {
+	timestamp = strconv.FormatInt(m.now().Unix(), 10)
+	return timestamp, webhooks.Sign(m.secret, timestamp, body)
+}
+
+// verify checks that signature signs body at timestamp, which is within
+// signatureWindow of the clock, and that it was not seen before. The same
+// body signed twice in one second is taken for a replay.
+func (m *messageSigner) verify(timestamp, signature string, body []byte) error {
+	if timestamp == "" || signature == "" {
+		return fmt.Errorf("%w: not signed", errSignature)
+	}
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: the timestamp is not in Unix seconds", errSignature)
+	}
+	now, at := m.now(), time.Unix(sec, 0)
+	if at.Before(now.Add(-signatureWindow)) || at.After(now.Add(signatureWindow)) {
+		return fmt.Errorf("%w: the timestamp is more than %s away", errSignature, signatureWindow)
+	}
+	signature = strings.ToLower(signature)
+	if !hmac.Equal([]byte(signature), []byte(webhooks.Sign(m.secret, timestamp, body))) {
+		return fmt.Errorf("%w: it does not match", errSignature)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now.Sub(m.pruned) > time.Minute {
+		for sig, until := range m.seen {
+			if now.After(until) {
+				delete(m.seen, sig)
+			}
+		}
+		m.pruned = now
+	}
+	if _, ok := m.seen[signature]; ok {
+		return fmt.Errorf("%w: replayed", errSignature)
+	}
+	m.seen[signature] = at.Add(signatureWindow)
+	return nil
+}
+
+// apiSignedFrame is an apiFrame of a signed WebSocket or event stream: the
+// frame's JSON, signed as a body.
+type apiSignedFrame struct {
+	Timestamp string          `json:"timestamp"`
+	Signature string          `json:"signature"`
+	Frame     json.RawMessage `json:"frame"`
+}
+
+// seal returns f as the API sends it: signed when the API has a signing
+// secret.
+func (s *apiServer) seal(f apiFrame) any {
+	if s.signer == nil {
+		return f
+	}
+	data, _ := json.Marshal(f)
+	ts, sig := s.signer.sign(data)
+	return apiSignedFrame{Timestamp: ts, Signature: sig, Frame: data}
+}
+
+// open checks the signature of a signed frame sent by a client and returns
+// the frame.
+func (s *apiServer) open(sf apiSignedFrame) (apiFrame, error) {
+	var f apiFrame
+	if err := s.signer.verify(sf.Timestamp, sf.Signature, sf.Frame); err != nil {
+		return f, err
+	}
+	if err := json.Unmarshal(sf.Frame, &f); err != nil {
+		return f, fmt.Errorf("invalid frame: %w", err)
+	}
+	return f, nil
+}
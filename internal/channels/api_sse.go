@@ -0,0 +1,89 @@
+package channels
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// apiStreamQueue is how many events wait for a slow event stream before its
+// partial replies and tool events are dropped.
+const apiStreamQueue = 32
+
+// apiStream is a request answered as server-sent events: what happens while
+// the reply is written, then the reply, which ends the stream.
+type apiStream struct {
+	events chan apiFrame // partial replies, tool events and followups
+	final  chan apiFrame // the reply
+}
+
+func newAPIStream() *apiStream {
+	return &apiStream{events: make(chan apiFrame, apiStreamQueue), final: make(chan apiFrame, 1)}
+}
+
+// offer queues f unless the queue is full: partial replies are superseded
+// by the next one, and the reply comes anyway.
+func (st *apiStream) offer(f apiFrame) {
+	select {
+	case st.events <- f:
+	default:
+	}
+}
+
+// wantsEvents reports whether r asks to be answered with server-sent events.
+func wantsEvents(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// serveEvents answers the request for message id in chat name with st's
+// events: an "ack" giving the message's ID, "partial" snapshots of the
+// reply, "tool" events, and the final "message", after which the response
+// ends. Each event is named after its frame's type, with the frame as data,
+// sealed when the API has a signing secret.
+func (s *apiServer) serveEvents(w http.ResponseWriter, r *http.Request, id, name string, st *apiStream) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Reverse proxies such as nginx would buffer the events otherwise.
+	w.Header().Set("X-Accel-Buffering", "no")
+	rc := http.NewResponseController(w)
+	write := func(f apiFrame) error {
+		data, err := json.Marshal(s.seal(f))
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", f.Type, data); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	if write(apiFrame{Type: "ack", ID: id, ChatID: name}) != nil {
+		return
+	}
+
+	timer := time.NewTimer(s.timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case f := <-st.events:
+			if write(f) != nil {
+				return
+			}
+		case f := <-st.final:
+			// Events queued before the reply still go first.
+			for len(st.events) > 0 {
+				if write(<-st.events) != nil {
+					return
+				}
+			}
+			write(f)
+			return
+		case <-timer.C:
+			write(apiFrame{Type: "error", ChatID: name, Text: "no reply within " + s.timeout.String() + "; use a callbackUrl for long tasks"})
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,445 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/webhooks"
+)
+
+func TestAPIMessages(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hub := chat.NewHub(10)
+	s, err := newAPIServer(ctx, hub, config.APIConfig{Tokens: []config.APIToken{{Name: "crm", Token: "tok"}}, TimeoutS: 2,
+		CallbackSecret: "k", AllowPrivateCallbacks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub.StartRouter(ctx)
+	go s.runOutbound()
+	srv := httptest.NewServer(s.handler())
+	defer srv.Close()
+
+	post := func(token, body string) *http.Response {
+		req, _ := http.NewRequest("POST", srv.URL+"/v1/messages", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	if resp := post("wrong", `{"text":"hi"}`); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("wrong token: %s", resp.Status)
+	}
+	if resp := post("tok", `{"text":"hi","chatId":"a/b"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("bad chat ID: %s", resp.Status)
+	}
+
+	// A synchronous request gets the reply to its message.
+	go func() {
+		in := <-hub.In
+		if in.Channel != "api" || in.ChatID != "crm:c1" || in.SenderID != "crm" || in.Content != "hi" {
+			t.Errorf("inbound = %+v", in)
+		}
+		hub.Out <- chat.Outbound{Channel: "api", ChatID: in.ChatID, Content: "not this one", ReplyTo: "other"}
+		hub.Out <- chat.Outbound{Channel: "api", ChatID: in.ChatID, Content: "Hello!", ReplyTo: in.MessageID()}
+	}()
+	resp := post("tok", `{"chatId":"c1","text":"hi"}`)
+	var reply apiReply
+	json.NewDecoder(resp.Body).Decode(&reply)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || reply.Text != "Hello!" || reply.ChatID != "c1" {
+		t.Fatalf("reply = %s %+v", resp.Status, reply)
+	}
+
+	// An acknowledgement announcing a later answer is not the reply.
+	go func() {
+		in := <-hub.In
+		hub.Out <- chat.Outbound{Channel: "api", ChatID: in.ChatID, Content: "Researching…", ReplyTo: in.MessageID(),
+			Metadata: map[string]interface{}{"followup": true}}
+		hub.Out <- chat.Outbound{Channel: "api", ChatID: in.ChatID, Content: "Found it.", ReplyTo: in.MessageID()}
+	}()
+	resp = post("tok", `{"chatId":"c1","text":"/research gophers"}`)
+	reply = apiReply{}
+	json.NewDecoder(resp.Body).Decode(&reply)
+	resp.Body.Close()
+	if reply.Text != "Found it." {
+		t.Fatalf("reply after a followup = %s %+v", resp.Status, reply)
+	}
+
+	// With a callback URL, the request is accepted and the reply posted,
+	// signed.
+	callbacks := make(chan apiReply, 1)
+	cb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ts := r.Header.Get(webhooks.TimestampHeader)
+		if ts == "" || r.Header.Get(webhooks.SignatureHeader) != webhooks.Sign("k", ts, body) {
+			t.Errorf("bad callback signature %q at %q", r.Header.Get(webhooks.SignatureHeader), ts)
+		}
+		var reply apiReply
+		json.Unmarshal(body, &reply)
+		callbacks <- reply
+	}))
+	defer cb.Close()
+	resp = post("tok", `{"text":"research this","callbackUrl":"`+cb.URL+`"}`)
+	var accepted struct{ ID, ChatID string }
+	json.NewDecoder(resp.Body).Decode(&accepted)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted || accepted.ChatID != "default" {
+		t.Fatalf("async = %s %+v", resp.Status, accepted)
+	}
+	in := <-hub.In
+	hub.Out <- chat.Outbound{Channel: "api", ChatID: in.ChatID, Content: "Done.", ReplyTo: in.MessageID()}
+	select {
+	case got := <-callbacks:
+		if got.ID != accepted.ID || got.Text != "Done." || got.ChatID != "default" {
+			t.Fatalf("callback = %+v", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for the callback")
+	}
+}
+
+func TestAPIEventStream(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hub := chat.NewHub(10)
+	s, err := newAPIServer(ctx, hub, config.APIConfig{Tokens: []config.APIToken{{Name: "crm", Token: "tok"}}, TimeoutS: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hub.Streams("api") || !hub.ToolEvents("api") {
+		t.Fatal("the api channel wants neither partial replies nor tool events")
+	}
+	hub.StartRouter(ctx)
+	go s.runOutbound()
+	srv := httptest.NewServer(s.handler())
+	defer srv.Close()
+
+	go func() {
+		in := <-hub.In
+		hub.Out <- chat.Outbound{Channel: "api", ChatID: in.ChatID, Content: "Hel", ReplyTo: in.MessageID(), StreamID: "r1", Partial: true}
+		hub.Out <- chat.Outbound{Channel: "api", ChatID: in.ChatID, ReplyTo: in.MessageID(),
+			Metadata: map[string]interface{}{"tool_event": chat.ToolEvent{Name: "web_search", Duration: 1500 * time.Millisecond}}}
+		hub.Out <- chat.Outbound{Channel: "api", ChatID: in.ChatID, Content: "Hello!", ReplyTo: in.MessageID(), StreamID: "r1"}
+	}()
+	req, _ := http.NewRequest("POST", srv.URL+"/v1/messages", strings.NewReader(`{"chatId":"c1","text":"hi"}`))
+	req.Header.Set("Authorization", "Bearer tok")
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type = %q", ct)
+	}
+	want := []string{
+		`event: ack` + "\n" + `data: {"type":"ack","id":"a1","chatId":"c1"}`,
+		`event: partial` + "\n" + `data: {"type":"partial","id":"r1","replyTo":"a1","chatId":"c1","text":"Hel"}`,
+		`event: tool` + "\n" + `data: {"type":"tool","replyTo":"a1","chatId":"c1","tool":"web_search","durationMs":1500}`,
+		`event: message` + "\n" + `data: {"type":"message","id":"r1","replyTo":"a1","chatId":"c1","text":"Hello!"}`,
+	}
+	if got := strings.Split(strings.TrimSpace(string(body)), "\n\n"); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("events:\n%s", body)
+	}
+}
+
+func TestAPIRefusesPrivateCallbacks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hub := chat.NewHub(10)
+	s, err := newAPIServer(ctx, hub, config.APIConfig{Tokens: []config.APIToken{{Name: "crm", Token: "tok"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(s.handler())
+	defer srv.Close()
+
+	for _, cb := range []string{"http://127.0.0.1:8080/hook", "http://169.254.169.254/latest", "http://[::1]/", "http://10.0.0.5/", "http://100.64.1.2/"} {
+		req, _ := http.NewRequest("POST", srv.URL+"/v1/messages", strings.NewReader(`{"text":"hi","callbackUrl":"`+cb+`"}`))
+		req.Header.Set("Authorization", "Bearer tok")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("callback %s: %s", cb, resp.Status)
+		}
+	}
+
+	// A name resolving to a private address is refused when connecting.
+	local := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		t.Error("callback reached a private address")
+	}))
+	defer local.Close()
+	url := strings.Replace(local.URL, "127.0.0.1", "localhost", 1)
+	if err := s.postCallback(url, apiReply{Text: "hi"}); err == nil || !strings.Contains(err.Error(), "not a public address") {
+		t.Fatalf("postCallback = %v", err)
+	}
+}
+
+func TestAPIForgetsCallbacks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hub := chat.NewHub(10)
+	s, err := newAPIServer(ctx, hub, config.APIConfig{Tokens: []config.APIToken{{Name: "crm", Token: "tok"}}, AllowPrivateCallbacks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub.StartRouter(ctx)
+	go s.runOutbound()
+	srv := httptest.NewServer(s.handler())
+	defer srv.Close()
+	gone := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no such hook", http.StatusNotFound)
+	}))
+	defer gone.Close()
+	post := func(chatID string) chat.Inbound {
+		req, _ := http.NewRequest("POST", srv.URL+"/v1/messages", strings.NewReader(`{"chatId":"`+chatID+`","text":"hi","callbackUrl":"`+gone.URL+`"}`))
+		req.Header.Set("Authorization", "Bearer tok")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return <-hub.In
+	}
+	callback := func(chatID string) (apiCallback, bool) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		cb, ok := s.callbacks[chatID]
+		return cb, ok
+	}
+
+	// A callback that fails is not posted to again.
+	in := post("c1")
+	hub.Out <- chat.Outbound{Channel: "api", ChatID: in.ChatID, Content: "Done.", ReplyTo: in.MessageID()}
+	deadline := time.Now().Add(2 * time.Second)
+	for _, ok := callback("crm:c1"); ok; _, ok = callback("crm:c1") {
+		if time.Now().After(deadline) {
+			t.Fatal("failed callback kept")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case report := <-hub.In:
+		if report.Event() != chat.EventUndelivered {
+			t.Fatalf("unexpected inbound %+v", report)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("failed callback not reported undelivered")
+	}
+
+	// Expired callbacks are dropped when the next one is given.
+	post("c2")
+	s.mu.Lock()
+	s.callbacks["crm:c2"] = apiCallback{url: gone.URL, expires: time.Now().Add(-time.Minute)}
+	s.pruned = time.Time{}
+	s.mu.Unlock()
+	post("c3")
+	if _, ok := callback("crm:c2"); ok {
+		t.Error("expired callback kept")
+	}
+	if cb, ok := callback("crm:c3"); !ok || cb.url != gone.URL || time.Until(cb.expires) < apiCallbackTTL-time.Minute {
+		t.Errorf("new callback = %+v, %v", cb, ok)
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	for ip, want := range map[string]bool{
+		"93.184.216.34": true, "2606:4700::1111": true, "100.63.255.255": true, "100.128.0.1": true,
+		"127.0.0.1": false, "10.1.2.3": false, "192.168.0.1": false, "169.254.169.254": false,
+		"100.64.0.1": false, "100.127.255.254": false, "::1": false, "fe80::1": false, "0.0.0.0": false,
+	} {
+		if got := publicIP(net.ParseIP(ip)); got != want {
+			t.Errorf("publicIP(%s) = %v, want %v", ip, got, want)
+		}
+	}
+}
+
+func TestAPIWebSocket(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hub := chat.NewHub(10)
+	s, err := newAPIServer(ctx, hub, config.APIConfig{Tokens: []config.APIToken{{Name: "app", Token: "tok"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub.StartRouter(ctx)
+	go s.runOutbound()
+	srv := httptest.NewServer(s.handler())
+	defer srv.Close()
+	if !hub.Streams("api") {
+		t.Fatal("the API does not receive partial replies")
+	}
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/v1/ws?chatId=c1"
+	if _, _, err := websocket.DefaultDialer.Dial(wsURL, nil); err == nil {
+		t.Fatal("socket opened without a token")
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL+"&token=tok", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	conn.WriteJSON(apiFrame{Type: "message", Text: "hello"})
+	var ack apiFrame
+	if err := conn.ReadJSON(&ack); err != nil || ack.Type != "ack" || ack.ID == "" {
+		t.Fatalf("ack = %+v, %v", ack, err)
+	}
+	in := <-hub.In
+	if in.Channel != "api" || in.ChatID != "app:c1" || in.MessageID() != ack.ID {
+		t.Fatalf("inbound = %+v", in)
+	}
+
+	// The reply streams in, then the agent starts a message of its own.
+	hub.Out <- chat.Outbound{Channel: "api", ChatID: in.ChatID, Content: "Hel", ReplyTo: ack.ID, StreamID: "s1", Partial: true}
+	hub.Out <- chat.Outbound{Channel: "api", ChatID: in.ChatID, Content: "Hello!", ReplyTo: ack.ID, StreamID: "s1"}
+	hub.Out <- chat.Outbound{Channel: "api", ChatID: in.ChatID, Content: "Time to stretch.", Type: chat.TypeReminder}
+	hub.Out <- chat.Outbound{Channel: "api", ChatID: "app:other", Content: "not for this socket"}
+	var partial, final, reminder apiFrame
+	conn.ReadJSON(&partial)
+	conn.ReadJSON(&final)
+	conn.ReadJSON(&reminder)
+	if partial.Type != "partial" || partial.ID != "s1" || partial.Text != "Hel" || partial.ReplyTo != ack.ID {
+		t.Errorf("partial = %+v", partial)
+	}
+	if final.Type != "message" || final.ID != "s1" || final.Text != "Hello!" || final.ChatID != "c1" {
+		t.Errorf("final = %+v", final)
+	}
+	if reminder.Kind != chat.TypeReminder || !strings.Contains(reminder.Text, "Time to stretch.") || reminder.ReplyTo != "" {
+		t.Errorf("reminder = %+v", reminder)
+	}
+
+	conn.WriteJSON(apiFrame{Type: "subscribe"})
+	var bad apiFrame
+	if conn.ReadJSON(&bad); bad.Type != "error" {
+		t.Errorf("bad frame answered with %+v", bad)
+	}
+}
+
+func TestAPISigning(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hub := chat.NewHub(10)
+	s, err := newAPIServer(ctx, hub, config.APIConfig{Tokens: []config.APIToken{{Name: "crm", Token: "tok"}}, TimeoutS: 2,
+		SigningSecret: "k"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub.StartRouter(ctx)
+	go s.runOutbound()
+	srv := httptest.NewServer(s.handler())
+	defer srv.Close()
+
+	post := func(body, ts, sig string) *http.Response {
+		req, _ := http.NewRequest("POST", srv.URL+"/v1/messages", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer tok")
+		req.Header.Set(webhooks.TimestampHeader, ts)
+		req.Header.Set(webhooks.SignatureHeader, sig)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	body := `{"chatId":"c1","text":"hi"}`
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10)
+	for name, resp := range map[string]*http.Response{
+		"unsigned":  post(body, "", ""),
+		"tampered":  post(`{"chatId":"c1","text":"rm -rf"}`, now, webhooks.Sign("k", now, []byte(body))),
+		"stale":     post(body, stale, webhooks.Sign("k", stale, []byte(body))),
+		"wrong key": post(body, now, webhooks.Sign("other", now, []byte(body))),
+	} {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s request: %s", name, resp.Status)
+		}
+	}
+
+	// A signed request is answered with a signed reply.
+	go func() {
+		in := <-hub.In
+		hub.Out <- chat.Outbound{Channel: "api", ChatID: in.ChatID, Content: "Hello!", ReplyTo: in.MessageID()}
+	}()
+	sig := webhooks.Sign("k", now, []byte(body))
+	resp := post(body, now, sig)
+	reply, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(reply), "Hello!") {
+		t.Fatalf("signed request: %s %s", resp.Status, reply)
+	}
+	if got := resp.Header.Get(webhooks.SignatureHeader); got != webhooks.Sign("k", resp.Header.Get(webhooks.TimestampHeader), reply) {
+		t.Fatalf("reply signature %q does not sign the reply", got)
+	}
+	// The same request again is a replay.
+	if resp := post(body, now, sig); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("replayed request: %s", resp.Status)
+	}
+
+	// Over the WebSocket, frames travel signed.
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/v1/ws?chatId=c1&token=tok", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	frame := []byte(`{"type":"message","text":"hello"}`)
+	signed := apiSignedFrame{Timestamp: now, Signature: webhooks.Sign("k", now, frame), Frame: frame}
+	read := func() apiFrame {
+		t.Helper()
+		var sf apiSignedFrame
+		if err := conn.ReadJSON(&sf); err != nil {
+			t.Fatal(err)
+		}
+		if sf.Signature != webhooks.Sign("k", sf.Timestamp, sf.Frame) {
+			t.Fatalf("frame %s badly signed", sf.Frame)
+		}
+		var f apiFrame
+		json.Unmarshal(sf.Frame, &f)
+		return f
+	}
+	conn.WriteJSON(signed)
+	if ack := read(); ack.Type != "ack" {
+		t.Fatalf("signed frame answered with %+v", ack)
+	}
+	<-hub.In
+	conn.WriteJSON(signed)
+	if f := read(); f.Type != "error" || !strings.Contains(f.Text, "replayed") {
+		t.Fatalf("replayed frame answered with %+v", f)
+	}
+	conn.WriteJSON(apiFrame{Type: "message", Text: "unsigned"})
+	if f := read(); f.Type != "error" || !strings.Contains(f.Text, "not signed") {
+		t.Fatalf("unsigned frame answered with %+v", f)
+	}
+}
+
+func TestStartAPIRequiresTokens(t *testing.T) {
+	if err := StartAPI(context.Background(), chat.NewHub(1), config.APIConfig{}); err == nil {
+		t.Fatal("API started without tokens")
+	}
+	_, err := newAPIServer(context.Background(), chat.NewHub(1), config.APIConfig{Tokens: []config.APIToken{{Token: "x"}}})
+	if err == nil {
+		t.Fatal("token without a name accepted")
+	}
+}
@@ -0,0 +1,108 @@
+package channels
+
+import (
+	"log"
+	"net/http"
+	"strings"
+)
+
+// apiFrame is a JSON frame of the API's WebSocket. Clients send messages,
+// {"type": "message", "text", "sender"}, each acknowledged with an "ack"
+// frame giving its ID. The server sends replies: "partial" snapshots of a
+// reply being written, then the final "message", sharing the ID of the
+// reply; ReplyTo is the ID of the message answered, empty for messages the
+// agent starts (reminders, reports), and Kind their type. While answering,
+// a "tool" frame tells of each tool the agent ran. Errors with a client's
+// frame come back as "error" frames. The same frames are the events of a
+// request answered as server-sent events. With a signing secret, frames
+// travel as apiSignedFrames, both ways.
+type apiFrame struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id,omitempty"`
+	ReplyTo    string   `json:"replyTo,omitempty"`
+	ChatID     string   `json:"chatId,omitempty"`
+	Text       string   `json:"text,omitempty"`
+	Sender     string   `json:"sender,omitempty"`
+	Kind       string   `json:"kind,omitempty"` // error, reminder or report
+	Files      []string `json:"files,omitempty"`
+	Tool       string   `json:"tool,omitempty"`
+	DurationMs int64    `json:"durationMs,omitempty"`
+	Error      string   `json:"error,omitempty"` // of the tool, when it failed
+}
+
+// handleSocket subscribes a client to a chat (?chatId=, default "default"):
+// it receives every message of the agent in the chat, and its messages go
+// to the agent.
+func (s *apiServer) handleSocket(w http.ResponseWriter, r *http.Request) {
+	caller := s.caller(r)
+	if caller == "" {
+		s.fail(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	name := r.URL.Query().Get("chatId")
+	if name == "" {
+		name = "default"
+	}
+	if !webChatIDRE.MatchString(name) {
+		s.fail(w, http.StatusBadRequest, "chatId may only have letters, digits, _ and - (at most 64)")
+		return
+	}
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	ws.SetReadLimit(apiMaxBody)
+	conn := newWebConn(ws, "api")
+	chatID := caller + ":" + name
+
+	s.mu.Lock()
+	if s.sockets[chatID] == nil {
+		s.sockets[chatID] = make(map[*webConn]bool)
+	}
+	s.sockets[chatID][conn] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.sockets[chatID], conn)
+		if len(s.sockets[chatID]) == 0 {
+			delete(s.sockets, chatID)
+		}
+		s.mu.Unlock()
+		conn.close()
+	}()
+	log.Printf("api: %s subscribed to %s", caller, name)
+
+	for {
+		var f apiFrame
+		if s.signer == nil {
+			if err := ws.ReadJSON(&f); err != nil {
+				return
+			}
+		} else {
+			var sf apiSignedFrame
+			if err := ws.ReadJSON(&sf); err != nil {
+				return
+			}
+			if f, err = s.open(sf); err != nil {
+				log.Printf("api: refused a frame of %s: %v", caller, err)
+				conn.send(s.seal(apiFrame{Type: "error", ChatID: name, Text: err.Error()}))
+				continue
+			}
+		}
+		text := strings.TrimSpace(f.Text)
+		if f.Type != "message" || text == "" {
+			conn.send(s.seal(apiFrame{Type: "error", ChatID: name, Text: `expected {"type": "message", "text": "..."}`}))
+			continue
+		}
+		s.mu.Lock()
+		id := s.newMessageID()
+		s.mu.Unlock()
+		// Acknowledge first, so the client knows the ID before the reply.
+		if err := conn.send(s.seal(apiFrame{Type: "ack", ID: id, ChatID: name})); err != nil {
+			return
+		}
+		if !s.send(s.ctx, caller, chatID, id, f.Sender, text) {
+			return
+		}
+	}
+}
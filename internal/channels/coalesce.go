@@ -0,0 +1,49 @@
+package channels
+
+import (
+	"context"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+// coalesceOutbound merges the plain-text messages that follow first on q
+// within window into first, as long as the merged text still fits (as judged
+// by fits), so a burst of small updates to one chat goes out as fewer
+// messages. Messages carrying anything but text (media, metadata, streaming)
+// are never merged. n is the number of messages merged (first included).
+// The first message read that could not be merged is returned as next, to be
+// sent after the merged one.
+func coalesceOutbound(ctx context.Context, q <-chan chat.Outbound, first chat.Outbound, window time.Duration, fits func(string) bool) (merged chat.Outbound, n int, next *chat.Outbound) {
+	n = 1
+	if window <= 0 || !coalescable(first) {
+		return first, n, nil
+	}
+	timer := time.NewTimer(window)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return first, n, nil
+		case <-timer.C:
+			return first, n, nil
+		case out := <-q:
+			text := first.Content + "\n\n" + out.Content
+			// A reply to another message keeps its own threading (and
+			// reaction), so only unthreaded messages join a reply. Private
+			// messages, which are not journalled, only join each other, so
+			// that the count acknowledged covers journalled ones only.
+			if !coalescable(out) || out.ChatID != first.ChatID || (out.ReplyTo != "" && out.ReplyTo != first.ReplyTo) ||
+				out.Private != first.Private || !fits(text) {
+				return first, n, &out
+			}
+			first.Content = text
+			n++
+		}
+	}
+}
+
+// coalescable reports whether out is a plain, complete text message.
+func coalescable(out chat.Outbound) bool {
+	return out.Content != "" && !out.Partial && out.StreamID == "" && len(out.Media) == 0 && len(out.Metadata) == 0
+}
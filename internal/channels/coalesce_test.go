@@ -0,0 +1,50 @@
+package channels
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+func TestCoalesceOutbound(t *testing.T) {
+	q := make(chan chat.Outbound, 10)
+	q <- chat.Outbound{ChatID: "1", Content: "step 2"}
+	q <- chat.Outbound{ChatID: "1", Content: "step 3"}
+	q <- chat.Outbound{ChatID: "1", Content: "photo", Media: []string{"/tmp/a.png"}}
+	q <- chat.Outbound{ChatID: "1", Content: "after"}
+
+	fits := func(s string) bool { return len(s) <= 100 }
+	first := chat.Outbound{ChatID: "1", Content: "step 1", ReplyTo: "7"}
+	merged, n, next := coalesceOutbound(context.Background(), q, first, time.Second, fits)
+	if merged.Content != "step 1\n\nstep 2\n\nstep 3" || merged.ReplyTo != "7" || n != 3 {
+		t.Fatalf("unexpected merged message: %+v", merged)
+	}
+	if next == nil || len(next.Media) != 1 {
+		t.Fatalf("the media message must be returned unmerged, got %+v", next)
+	}
+
+	// A message that would not fit is sent separately.
+	long := strings.Repeat("y", 95)
+	q <- chat.Outbound{ChatID: "1", Content: long}
+	merged, n, next = coalesceOutbound(context.Background(), q, chat.Outbound{ChatID: "1", Content: "x"}, time.Second, fits)
+	if merged.Content != "x\n\nafter" || n != 2 || next == nil || next.Content != long {
+		t.Fatalf("unexpected merge past the limit: %+v, %+v", merged, next)
+	}
+
+	// Private messages, which are not journalled, do not join others.
+	q <- chat.Outbound{ChatID: "1", Content: "secret", Private: true}
+	merged, n, next = coalesceOutbound(context.Background(), q, chat.Outbound{ChatID: "1", Content: "x"}, time.Second, fits)
+	if merged.Content != "x" || n != 1 || next == nil || !next.Private {
+		t.Fatalf("private message merged: %+v, %+v", merged, next)
+	}
+
+	// The window bounds the wait.
+	start := time.Now()
+	merged, n, next = coalesceOutbound(context.Background(), make(chan chat.Outbound), chat.Outbound{Content: "alone"}, 20*time.Millisecond, fits)
+	if merged.Content != "alone" || n != 1 || next != nil || time.Since(start) > time.Second {
+		t.Fatalf("unexpected result for a lone message: %+v, %+v", merged, next)
+	}
+}
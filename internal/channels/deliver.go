@@ -0,0 +1,58 @@
+package channels
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+// sendAttempts is how many times the channels without a retry policy of
+// their own (all but Telegram) try to send a message before giving up on it.
+const sendAttempts = 3
+
+// sendRetryDelay is the wait after a first failed attempt; it doubles after
+// each further one.
+var sendRetryDelay = 2 * time.Second
+
+// retrySend runs send until it succeeds, at most sendAttempts times, and
+// returns its last error. It stops waiting when ctx is done.
+func retrySend(ctx context.Context, send func() error) error {
+	delay := sendRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := send()
+		if err == nil || attempt == sendAttempts {
+			return err
+		}
+		log.Printf("send attempt %d failed (%v), retrying in %s", attempt, err, delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+		delay *= 2
+	}
+}
+
+// sendChunks sends the chunks of out's text with send, retrying each, and
+// reports out undelivered if some could not be sent in the end. When others
+// were delivered, only the chunks that were not are summarized.
+func sendChunks(ctx context.Context, hub *chat.Hub, out chat.Outbound, chunks []string, send func(i int, chunk string) error) {
+	var failed error
+	var missing []string
+	for i, chunk := range chunks {
+		if err := retrySend(ctx, func() error { return send(i, chunk) }); err != nil {
+			log.Printf("%s: send error (chunk %d of %d): %v", out.Channel, i+1, len(chunks), err)
+			failed = err
+			missing = append(missing, chunk)
+		}
+	}
+	switch {
+	case failed == nil:
+	case len(missing) == len(chunks):
+		hub.ReportUndelivered(out, failed.Error())
+	default:
+		hub.ReportUndelivered(out, failed.Error(), missing...)
+	}
+}
@@ -0,0 +1,53 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+func TestSendChunksRetriesAndReportsOnlyMissingChunks(t *testing.T) {
+	defer func(d time.Duration) { sendRetryDelay = d }(sendRetryDelay)
+	sendRetryDelay = time.Millisecond
+
+	hub := chat.NewHub(10)
+	out := chat.Outbound{Channel: "slack", ChatID: "C1", Content: "one two three"}
+	attempts := map[string]int{}
+	sendChunks(context.Background(), hub, out, []string{"one", "two", "three"}, func(_ int, chunk string) error {
+		attempts[chunk]++
+		switch {
+		case chunk == "two" && attempts[chunk] == 1:
+			return errors.New("timeout") // succeeds when retried
+		case chunk == "three":
+			return errors.New("down")
+		}
+		return nil
+	})
+	if attempts["one"] != 1 || attempts["two"] != 2 || attempts["three"] != sendAttempts {
+		t.Fatalf("attempts = %v", attempts)
+	}
+	select {
+	case in := <-hub.In:
+		if in.Event() != chat.EventUndelivered || in.Content != out.Content || in.Metadata["missing"] != "three" {
+			t.Fatalf("report = %+v", in)
+		}
+	default:
+		t.Fatal("the undelivered chunk was not reported")
+	}
+
+	// A transient failure alone is not reported.
+	sendChunks(context.Background(), hub, out, []string{"one"}, func(_ int, _ string) error {
+		if attempts["again"]++; attempts["again"] == 1 {
+			return errors.New("timeout")
+		}
+		return nil
+	})
+	select {
+	case in := <-hub.In:
+		t.Fatalf("reported after a successful retry: %+v", in)
+	default:
+	}
+}
@@ -9,7 +9,10 @@ import (
 	"time"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/local/picobot/internal/access"
 	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/useragent"
 )
 
 // discordSender is the subset of *discordgo.Session used for outbound operations.
@@ -20,17 +23,28 @@ type discordSender interface {
 }
 
 // StartDiscord starts a Discord bot using the discordgo library.
-// allowFrom restricts which Discord user IDs may send messages; empty means allow all.
-func StartDiscord(ctx context.Context, hub *chat.Hub, token string, allowFrom []string) error {
-	if token == "" {
+// cfg.AllowFrom restricts which Discord users (by ID or "@username") may send
+// messages; empty means allow all. Without a token, a cfg.WebhookURL makes
+// the channel send-only, posting replies to the webhook.
+func StartDiscord(ctx context.Context, hub *chat.Hub, cfg config.DiscordConfig) error {
+	if cfg.Token == "" && cfg.WebhookURL != "" {
+		startDiscordWebhook(ctx, hub, cfg.WebhookURL)
+		return nil
+	}
+	if cfg.Token == "" {
 		return fmt.Errorf("discord token not provided")
 	}
+	allowed, err := access.NewPolicy(cfg.AllowFrom, cfg.Deny)
+	if err != nil {
+		return fmt.Errorf("discord allowFrom: %w", err)
+	}
 
-	session, err := discordgo.New("Bot " + token)
+	session, err := discordgo.New("Bot " + cfg.Token)
 	if err != nil {
 		return fmt.Errorf("failed to create discord session: %w", err)
 	}
 
+	session.UserAgent = useragent.Get()
 	session.Identify.Intents = discordgo.IntentsGuilds |
 		discordgo.IntentsGuildMessages |
 		discordgo.IntentsDirectMessages |
@@ -47,7 +61,7 @@ func StartDiscord(ctx context.Context, hub *chat.Hub, token string, allowFrom []
 	}
 	log.Printf("discord: connected as %s (%s)", botUser.Username, botUser.ID)
 
-	client := newDiscordClient(ctx, session, hub, botUser.ID, allowFrom)
+	client := newDiscordClient(ctx, session, hub, botUser.ID, allowed)
 	session.AddHandler(client.handleMessage)
 	go client.runOutbound()
 	go func() {
@@ -66,7 +80,7 @@ type discordClient struct {
 	hub        *chat.Hub
 	outCh      <-chan chat.Outbound
 	botID      string
-	allowed    map[string]struct{}
+	allowed    *access.Policy // nil = everyone
 	ctx        context.Context
 	typingMu   sync.Mutex
 	typingStop map[string]chan struct{}
@@ -74,11 +88,7 @@ type discordClient struct {
 
 // newDiscordClient constructs a discordClient and registers it as the hub's
 // "discord" outbound subscriber. Inject a mock discordSender for tests.
-func newDiscordClient(ctx context.Context, sender discordSender, hub *chat.Hub, botID string, allowFrom []string) *discordClient {
-	allowed := make(map[string]struct{}, len(allowFrom))
-	for _, id := range allowFrom {
-		allowed[id] = struct{}{}
-	}
+func newDiscordClient(ctx context.Context, sender discordSender, hub *chat.Hub, botID string, allowed *access.Policy) *discordClient {
 	return &discordClient{
 		sender:     sender,
 		hub:        hub,
@@ -100,11 +110,9 @@ func (c *discordClient) handleMessage(_ *discordgo.Session, m *discordgo.Message
 	}
 
 	// Enforce allowlist when one is configured.
-	if len(c.allowed) > 0 {
-		if _, ok := c.allowed[m.Author.ID]; !ok {
-			log.Printf("discord: dropped message from unauthorised user %s (%s)", m.Author.Username, m.Author.ID)
-			return
-		}
+	if c.allowed != nil && !c.allowed.Allowed(m.Author.ID, "@"+m.Author.Username) {
+		log.Printf("discord: dropped message from unauthorised user %s (%s)", m.Author.Username, m.Author.ID)
+		return
 	}
 
 	isDM := m.GuildID == ""
@@ -148,11 +156,12 @@ func (c *discordClient) handleMessage(_ *discordgo.Session, m *discordgo.Message
 	c.startTyping(m.ChannelID)
 
 	c.hub.In <- chat.Inbound{
-		Channel:   "discord",
-		SenderID:  m.Author.ID,
-		ChatID:    m.ChannelID,
-		Content:   content,
-		Timestamp: time.Now(),
+		Channel:    "discord",
+		SenderID:   m.Author.ID,
+		SenderName: senderName,
+		ChatID:     m.ChannelID,
+		Content:    content,
+		Timestamp:  time.Now(),
 		Metadata: map[string]interface{}{
 			"username":   senderName,
 			"guild_id":   m.GuildID,
@@ -170,11 +179,10 @@ func (c *discordClient) runOutbound() {
 			return
 		case out := <-c.outCh:
 			c.stopTyping(out.ChatID)
-			for _, chunk := range splitMessage(out.Content, 2000) {
-				if _, err := c.sender.ChannelMessageSend(out.ChatID, chunk); err != nil {
-					log.Printf("discord: send error: %v", err)
-				}
-			}
+			sendChunks(c.ctx, c.hub, out, discordChunks(formatDiscord(out.Content)), func(_ int, chunk string) error {
+				_, err := c.sender.ChannelMessageSend(out.ChatID, chunk)
+				return err
+			})
 		}
 	}
 }
@@ -0,0 +1,103 @@
+package channels
+
+import (
+	"regexp"
+	"strings"
+)
+
+// discordMaxLen is Discord's message length limit, in characters.
+const discordMaxLen = 2000
+
+var (
+	discordImageRE = regexp.MustCompile(`!\[[^\]]*\]\(([^)\s]+)\)`)
+	discordRuleRE  = regexp.MustCompile(`^\s*(?:-{3,}|\*{3,}|_{3,})\s*$`)
+	discordTableRE = regexp.MustCompile(`^\s*\|.*\|\s*$`)
+)
+
+// formatDiscord adapts the Markdown of a reply to what Discord renders.
+// Discord handles emphasis, code, lists, quotes, links and headings up to
+// ###; the rest is rewritten: smaller headings become bold lines, tables a
+// code block (so their columns stay aligned), images their URL (which
+// Discord previews), rules a line and task list boxes ☐/☑. Code blocks are
+// left alone. Discord renders ||spoilers|| itself, but has no expandable
+// quotes: ">> " lines become plain quotes.
+func formatDiscord(md string) string {
+	lines := strings.Split(stripHidingMarkers(md, true), "\n")
+	out := make([]string, 0, len(lines))
+	inCode, inTable := false, false
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			if inTable {
+				out = append(out, "```")
+				inTable = false
+			}
+			inCode = !inCode
+			out = append(out, line)
+			continue
+		}
+		if inCode {
+			out = append(out, line)
+			continue
+		}
+		if discordTableRE.MatchString(line) {
+			if !inTable {
+				out = append(out, "```")
+				inTable = true
+			}
+			out = append(out, line)
+			continue
+		}
+		if inTable {
+			out = append(out, "```")
+			inTable = false
+		}
+		trimmed := strings.TrimLeft(line, " ")
+		switch {
+		case strings.HasPrefix(trimmed, "####"):
+			line = "**" + strings.TrimSpace(strings.TrimLeft(trimmed, "#")) + "**"
+		case discordRuleRE.MatchString(line):
+			line = "───────────"
+		case strings.HasPrefix(trimmed, "- [ ] "), strings.HasPrefix(trimmed, "* [ ] "):
+			line = line[:len(line)-len(trimmed)] + "- ☐ " + trimmed[6:]
+		case strings.HasPrefix(trimmed, "- [x] "), strings.HasPrefix(trimmed, "- [X] "), strings.HasPrefix(trimmed, "* [x] "):
+			line = line[:len(line)-len(trimmed)] + "- ☑ " + trimmed[6:]
+		}
+		out = append(out, discordImageRE.ReplaceAllString(line, "$1"))
+	}
+	if inTable {
+		out = append(out, "```")
+	}
+	return strings.Join(out, "\n")
+}
+
+// discordChunks splits text into messages Discord accepts. A code block cut
+// by a split is closed at the end of its chunk and reopened, with its
+// language, at the start of the next, so both halves render as code.
+func discordChunks(text string) []string {
+	if len([]rune(text)) <= discordMaxLen {
+		return []string{text}
+	}
+	// Leave room for the fences added around a cut.
+	chunks := splitMessage(text, discordMaxLen-20)
+	open := "" // fence line of the code block open at the end of the previous chunk
+	for i, chunk := range chunks {
+		if open != "" {
+			chunk = open + "\n" + chunk
+		}
+		open = ""
+		for _, line := range strings.Split(chunk, "\n") {
+			if t := strings.TrimSpace(line); strings.HasPrefix(t, "```") {
+				if open == "" {
+					open = t
+				} else {
+					open = ""
+				}
+			}
+		}
+		if open != "" {
+			chunk = strings.TrimRight(chunk, "\n") + "\n```"
+		}
+		chunks[i] = chunk
+	}
+	return chunks
+}
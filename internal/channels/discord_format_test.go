@@ -0,0 +1,97 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+)
+
+func TestFormatDiscord(t *testing.T) {
+	in := strings.Join([]string{
+		"#### Plan",
+		"| a | b |",
+		"|---|---|",
+		"| 1 | 2 |",
+		"after",
+		"---",
+		"- [ ] buy milk",
+		"- [x] call Ana",
+		"![chart](https://example.com/c.png)",
+		"```go",
+		"#### not a heading",
+		"```",
+	}, "\n")
+	want := strings.Join([]string{
+		"**Plan**",
+		"```",
+		"| a | b |",
+		"|---|---|",
+		"| 1 | 2 |",
+		"```",
+		"after",
+		"───────────",
+		"- ☐ buy milk",
+		"- ☑ call Ana",
+		"https://example.com/c.png",
+		"```go",
+		"#### not a heading",
+		"```",
+	}, "\n")
+	if got := formatDiscord(in); got != want {
+		t.Errorf("formatDiscord:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestDiscordChunks_ReopensCodeBlocks(t *testing.T) {
+	text := "intro\n```go\n" + strings.Repeat("x := 1\n", 400) + "```\nbye"
+	chunks := discordChunks(text)
+	if len(chunks) < 2 {
+		t.Fatalf("expected several chunks, got %d", len(chunks))
+	}
+	for i, c := range chunks {
+		if n := len([]rune(c)); n > discordMaxLen {
+			t.Errorf("chunk %d has %d characters", i, n)
+		}
+		if strings.Count(c, "```")%2 != 0 {
+			t.Errorf("chunk %d leaves a code block open:\n%s", i, c)
+		}
+	}
+	if !strings.HasPrefix(chunks[1], "```go\n") {
+		t.Errorf("second chunk does not reopen the code block: %q", chunks[1][:20])
+	}
+}
+
+func TestDiscordWebhook(t *testing.T) {
+	got := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Content string }
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		got <- body.Content
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hub := chat.NewHub(10)
+	if err := StartDiscord(ctx, hub, config.DiscordConfig{WebhookURL: srv.URL}); err != nil {
+		t.Fatal(err)
+	}
+	hub.StartRouter(ctx)
+	hub.Out <- chat.Outbound{Channel: "discord", ChatID: "any", Content: "#### Daily briefing"}
+	select {
+	case c := <-got:
+		if c != "**Daily briefing**" {
+			t.Errorf("posted %q", c)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for the webhook post")
+	}
+}
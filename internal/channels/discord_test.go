@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
 )
 
 // TestSplitMessage tests the splitMessage helper function.
@@ -105,7 +106,7 @@ func mockDiscordServer() *httptest.Server {
 // TestStartDiscord_EmptyToken tests that StartDiscord returns an error with empty token.
 func TestStartDiscord_EmptyToken(t *testing.T) {
 	hub := chat.NewHub(100)
-	err := StartDiscord(context.Background(), hub, "", nil)
+	err := StartDiscord(context.Background(), hub, config.DiscordConfig{})
 	if err == nil {
 		t.Error("StartDiscord with empty token should return error")
 	}
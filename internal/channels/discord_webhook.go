@@ -0,0 +1,90 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/useragent"
+)
+
+// discordWebhook posts the replies of the hub's "discord" subscription to a
+// webhook: a send-only Discord channel, for notifications (briefings,
+// reminders, alerts) without a bot account. Every message goes to the
+// webhook's channel, whatever its ChatID.
+type discordWebhook struct {
+	url    string
+	client *http.Client
+	outCh  <-chan chat.Outbound
+	ctx    context.Context
+}
+
+// startDiscordWebhook subscribes to the hub's "discord" messages and posts
+// them to url until ctx is done.
+func startDiscordWebhook(ctx context.Context, hub *chat.Hub, url string) {
+	w := &discordWebhook{url: url, client: useragent.Client(30 * time.Second), outCh: hub.Subscribe("discord"), ctx: ctx}
+	log.Println("discord: sending through a webhook (send-only)")
+	go w.run()
+}
+
+func (w *discordWebhook) run() {
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case out := <-w.outCh:
+			if out.Partial {
+				continue
+			}
+			for _, chunk := range discordChunks(formatDiscord(out.Content)) {
+				if err := w.post(chunk); err != nil {
+					log.Printf("discord: webhook send error: %v", err)
+				}
+			}
+		}
+	}
+}
+
+// post sends one message, waiting out one rate limit if need be.
+func (w *discordWebhook) post(content string) error {
+	body, err := json.Marshal(map[string]string{"content": content})
+	if err != nil {
+		return err
+	}
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(w.ctx, http.MethodPost, w.url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := w.client.Do(req)
+		if err != nil {
+			return err
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		if resp.StatusCode/100 == 2 {
+			return nil
+		}
+		if resp.StatusCode == http.StatusTooManyRequests && attempt == 0 {
+			wait := time.Second
+			if s, err := strconv.ParseFloat(resp.Header.Get("Retry-After"), 64); err == nil {
+				wait = time.Duration(s * float64(time.Second))
+			}
+			select {
+			case <-time.After(wait):
+				continue
+			case <-w.ctx.Done():
+				return w.ctx.Err()
+			}
+		}
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, data)
+	}
+}
@@ -0,0 +1,408 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/local/picobot/internal/access"
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+)
+
+const (
+	emailPollInterval = time.Minute
+	emailTimeout      = time.Minute
+	emailMaxAttach    = 20 << 20
+)
+
+// StartEmail polls an IMAP mailbox for new mail and answers it over SMTP.
+// Each email becomes an inbound message in the chat of its sender's
+// address; the reply is sent back as part of the same thread. Attachments
+// are saved in the workspace, under inbox/email/<sender>/. cfg.AllowFrom
+// restricts which sender addresses are answered; empty means all. As the
+// From header is easily forged, only emails the receiving server
+// authenticated (see emailAuthenticated) or carrying cfg.Secret are read.
+func StartEmail(ctx context.Context, hub *chat.Hub, cfg config.EmailConfig) error {
+	if cfg.IMAPServer == "" || cfg.SMTPServer == "" || cfg.Username == "" {
+		return fmt.Errorf("email imapServer, smtpServer and username are required")
+	}
+	allowed, err := access.NewPolicy(cfg.AllowFrom, cfg.Deny)
+	if err != nil {
+		return fmt.Errorf("email allowFrom: %w", err)
+	}
+	c := newEmailClient(ctx, hub, cfg, allowed)
+	c.dial = func() (*imapConn, error) { return dialIMAP(cfg.IMAPServer, emailTimeout) }
+	c.send = c.sendSMTP
+	go c.pollInbound()
+	go c.runOutbound()
+	return nil
+}
+
+// emailClient polls one mailbox and sends the replies from its address.
+type emailClient struct {
+	cfg      config.EmailConfig
+	hub      *chat.Hub
+	outCh    <-chan chat.Outbound
+	allowed  *access.Policy
+	ctx      context.Context
+	from     string
+	interval time.Duration
+	maxSize  int64
+
+	// dial opens an IMAP session and send delivers a message to its
+	// recipient; replaced in tests.
+	dial func() (*imapConn, error)
+	send func(to string, msg []byte) error
+
+	mu      sync.Mutex
+	threads map[string]emailThread // by Message-ID of the received email
+}
+
+// emailThread is what a reply needs to join the thread of an email.
+type emailThread struct {
+	subject    string
+	references string
+}
+
+func newEmailClient(ctx context.Context, hub *chat.Hub, cfg config.EmailConfig, allowed *access.Policy) *emailClient {
+	if cfg.Mailbox == "" {
+		cfg.Mailbox = "INBOX"
+	}
+	from := cfg.From
+	if from == "" {
+		from = cfg.Username
+	}
+	interval := time.Duration(cfg.PollIntervalS) * time.Second
+	if interval <= 0 {
+		interval = emailPollInterval
+	}
+	maxSize := int64(cfg.MaxAttachmentMB) << 20
+	if maxSize <= 0 {
+		maxSize = emailMaxAttach
+	}
+	return &emailClient{
+		cfg:      cfg,
+		hub:      hub,
+		outCh:    hub.Subscribe("email"),
+		allowed:  allowed,
+		ctx:      ctx,
+		from:     from,
+		interval: interval,
+		maxSize:  maxSize,
+		threads:  make(map[string]emailThread),
+	}
+}
+
+// pollInbound checks the mailbox every interval until the context ends.
+func (c *emailClient) pollInbound() {
+	log.Printf("email: polling %s for %s (every %v)", c.cfg.IMAPServer, c.cfg.Username, c.interval)
+	for {
+		if err := c.poll(); err != nil {
+			log.Printf("email: %v", err)
+		}
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(c.interval):
+		}
+	}
+}
+
+// poll hands every unseen email to the hub and flags it as seen. Emails
+// that are not answered (not allowed, automatic) are flagged all the same,
+// so they are not looked at again. An email the server refuses to return is
+// skipped, and tried again on the next poll.
+func (c *emailClient) poll() error {
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.logout()
+	if err := conn.login(c.cfg.Username, c.cfg.Password, c.cfg.Mailbox); err != nil {
+		return err
+	}
+	uids, err := conn.unseen()
+	if err != nil {
+		return err
+	}
+	for _, uid := range uids {
+		raw, err := conn.fetch(uid)
+		var refused *imapError
+		if errors.As(err, &refused) {
+			log.Printf("email: message %d: %v", uid, err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if e, err := parseEmail(raw); err != nil {
+			log.Printf("email: message %d: %v", uid, err)
+		} else {
+			c.handle(e)
+		}
+		if err := conn.markSeen(uid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handle turns a received email into an inbound message.
+func (c *emailClient) handle(e *inboundEmail) {
+	if e.From == "" || strings.EqualFold(e.From, c.from) {
+		return
+	}
+	if e.Auto {
+		log.Printf("email: ignored automatic message from %s: %s", e.From, e.Subject)
+		return
+	}
+	if !c.authentic(e) {
+		log.Printf("email: dropped message from %s: not authenticated (no DKIM or DMARC pass, nor the secret)", e.From)
+		return
+	}
+	if c.allowed != nil && !c.allowed.Allowed(e.From) {
+		log.Printf("email: dropped message from unauthorised sender %s", e.From)
+		return
+	}
+
+	content := e.Text
+	if e.Subject != "" {
+		content = "Subject: " + e.Subject + "\n\n" + content
+	}
+	var media []string
+	for _, a := range e.Attachments {
+		rel, abs, err := c.saveAttachment(e.From, a)
+		if err != nil {
+			log.Printf("email: saving attachment: %v", err)
+			content += "\n[attachment " + a.Name + " not saved: " + err.Error() + "]"
+			continue
+		}
+		media = append(media, abs)
+		content += "\n[attachment saved as " + rel + " in the workspace]"
+	}
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return
+	}
+
+	if e.MessageID != "" {
+		c.mu.Lock()
+		c.threads[e.MessageID] = emailThread{subject: e.Subject, references: strings.TrimSpace(e.References + " " + e.MessageID)}
+		c.mu.Unlock()
+	}
+	log.Printf("email: message from %s: %s", e.From, truncate(e.Subject, 50))
+	c.hub.In <- chat.Inbound{
+		Channel:    "email",
+		SenderID:   e.From,
+		SenderName: e.Name,
+		ChatID:     e.From,
+		Content:    content,
+		Media:      media,
+		Timestamp:  time.Now(),
+		Metadata: map[string]interface{}{
+			"message_id": e.MessageID,
+			"subject":    e.Subject,
+			"is_dm":      true,
+		},
+	}
+}
+
+// authentic reports whether e comes from its From address: the receiving
+// server saw a DKIM or DMARC pass for its domain, or it carries the shared
+// secret, which is then removed from it.
+func (c *emailClient) authentic(e *inboundEmail) bool {
+	if c.cfg.Secret != "" && (strings.Contains(e.Subject, c.cfg.Secret) || strings.Contains(e.Text, c.cfg.Secret)) {
+		e.Subject = strings.TrimSpace(strings.ReplaceAll(e.Subject, c.cfg.Secret, ""))
+		e.Text = strings.TrimSpace(strings.ReplaceAll(e.Text, c.cfg.Secret, ""))
+		return true
+	}
+	_, domain, _ := strings.Cut(e.From, "@")
+	return emailAuthenticated(e.AuthResults, c.cfg.AuthServID, domain)
+}
+
+// saveAttachment writes a to the sender's inbox in the workspace and
+// returns its path relative to the workspace and its absolute path. An
+// existing file of the same name is kept: the new one gets a numbered name.
+func (c *emailClient) saveAttachment(sender string, a emailAttachment) (rel, abs string, err error) {
+	if c.cfg.Workspace == "" {
+		return "", "", fmt.Errorf("no workspace to save it in")
+	}
+	if int64(len(a.Data)) > c.maxSize {
+		return "", "", fmt.Errorf("larger than %s", formatFileSize(c.maxSize))
+	}
+	name := filepath.Base(filepath.Clean("/" + a.Name))
+	if name == "/" || name == "." {
+		name = "attachment"
+	}
+	dir := filepath.Join(inboxDir, "email", filepath.Base(filepath.Clean("/"+sender)))
+	if err := os.MkdirAll(filepath.Join(c.cfg.Workspace, dir), 0o755); err != nil {
+		return "", "", err
+	}
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		rel = filepath.Join(dir, name)
+		f, err := os.OpenFile(filepath.Join(c.cfg.Workspace, rel), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if os.IsExist(err) {
+			name = fmt.Sprintf("%s-%d%s", stem, i, ext)
+			continue
+		}
+		if err != nil {
+			return "", "", err
+		}
+		_, err = f.Write(a.Data)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		abs = filepath.Join(c.cfg.Workspace, rel)
+		if err != nil {
+			os.Remove(abs)
+			return "", "", err
+		}
+		if a, err := filepath.Abs(abs); err == nil {
+			abs = a
+		}
+		return rel, abs, nil
+	}
+}
+
+// runOutbound reads replies from the hub's email subscription and mails
+// them.
+func (c *emailClient) runOutbound() {
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case out := <-c.outCh:
+			if strings.TrimSpace(out.Content) == "" {
+				continue
+			}
+			msg := c.compose(out)
+			if err := retrySend(c.ctx, func() error { return c.send(out.ChatID, msg) }); err != nil {
+				log.Printf("email: send to %s: %v", out.ChatID, err)
+				c.hub.ReportUndelivered(out, err.Error())
+			}
+		}
+	}
+}
+
+// compose renders out as an email to its chat's address. A reply to a
+// received email joins its thread: "Re:" subject, In-Reply-To and
+// References.
+func (c *emailClient) compose(out chat.Outbound) []byte {
+	subject := "Message from picobot"
+	var inReplyTo, references string
+	c.mu.Lock()
+	t, ok := c.threads[out.ReplyTo]
+	c.mu.Unlock()
+	if ok {
+		inReplyTo, references = out.ReplyTo, t.references
+		subject = t.subject
+		if !strings.HasPrefix(strings.ToLower(subject), "re:") {
+			subject = "Re: " + subject
+		}
+	}
+
+	var b bytes.Buffer
+	header := func(k, v string) {
+		if v != "" {
+			fmt.Fprintf(&b, "%s: %s\r\n", k, v)
+		}
+	}
+	header("From", (&mail.Address{Address: c.from}).String())
+	header("To", (&mail.Address{Address: out.ChatID}).String())
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", newMessageID(c.from))
+	header("In-Reply-To", inReplyTo)
+	header("References", references)
+	header("Auto-Submitted", "auto-replied")
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	b.WriteString("\r\n")
+	qp := quotedprintable.NewWriter(&b)
+	qp.Write([]byte(strings.ReplaceAll(stripHidingMarkers(out.Content, false), "\n", "\r\n")))
+	qp.Close()
+	return b.Bytes()
+}
+
+// newMessageID returns a unique Message-ID in the domain of from.
+func newMessageID(from string) string {
+	buf := make([]byte, 12)
+	rand.Read(buf)
+	domain := "picobot.local"
+	if _, d, ok := strings.Cut(from, "@"); ok && d != "" {
+		domain = d
+	}
+	return "<" + hex.EncodeToString(buf) + "@" + domain + ">"
+}
+
+// sendSMTP delivers msg to to through the configured SMTP server: over TLS
+// on port 465, else upgraded with STARTTLS when the server offers it.
+func (c *emailClient) sendSMTP(to string, msg []byte) error {
+	host, port, err := net.SplitHostPort(c.cfg.SMTPServer)
+	if err != nil {
+		return err
+	}
+	dialer := &net.Dialer{Timeout: emailTimeout}
+	var conn net.Conn
+	if port == "465" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.cfg.SMTPServer, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", c.cfg.SMTPServer)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(emailTimeout))
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok && port != "465" {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if c.cfg.Password != "" {
+		if err := client.Auth(smtp.PlainAuth("", c.cfg.Username, c.cfg.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(c.from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
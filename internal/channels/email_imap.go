@@ -0,0 +1,189 @@
+package channels
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// imapConn is the small part of an IMAP4rev1 client the email channel
+// needs: log in, select a mailbox, search it, fetch whole messages and
+// flag them as seen.
+type imapConn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	tag     int
+	timeout time.Duration // for each command
+}
+
+// imapResponse is an untagged response: its text, with each literal
+// ({n} followed by n bytes) replaced by "{}" and kept in literals.
+type imapResponse struct {
+	line     string
+	literals [][]byte
+}
+
+// dialIMAP connects to the IMAP server at addr (host:port) over TLS.
+func dialIMAP(addr string, timeout time.Duration) (*imapConn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", addr, &tls.Config{ServerName: host})
+	if err != nil {
+		return nil, err
+	}
+	return newIMAPConn(conn, timeout)
+}
+
+// newIMAPConn reads the server greeting on conn.
+func newIMAPConn(conn net.Conn, timeout time.Duration) (*imapConn, error) {
+	conn.SetDeadline(time.Now().Add(timeout))
+	c := &imapConn{conn: conn, r: bufio.NewReader(conn), timeout: timeout}
+	greeting, err := c.r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(greeting, "* OK") && !strings.HasPrefix(greeting, "* PREAUTH") {
+		conn.Close()
+		return nil, fmt.Errorf("imap: unexpected greeting %q", strings.TrimSpace(greeting))
+	}
+	return c, nil
+}
+
+func (c *imapConn) Close() error {
+	return c.conn.Close()
+}
+
+// imapError is a command the server refused (NO or BAD), leaving the
+// session usable.
+type imapError struct {
+	verb, reply string
+}
+
+func (e *imapError) Error() string { return "imap " + e.verb + ": " + e.reply }
+
+// imapQuote renders s as an IMAP quoted string.
+func imapQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// cmd sends a command and returns its untagged responses, or an error if
+// the server does not answer OK.
+func (c *imapConn) cmd(format string, args ...interface{}) ([]imapResponse, error) {
+	c.tag++
+	tag := "a" + strconv.Itoa(c.tag)
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, fmt.Sprintf(format, args...)); err != nil {
+		return nil, err
+	}
+	var resps []imapResponse
+	for {
+		resp, err := c.readResponse()
+		if err != nil {
+			return nil, err
+		}
+		if rest, ok := strings.CutPrefix(resp.line, tag+" "); ok {
+			if !strings.HasPrefix(rest, "OK") {
+				verb, _, _ := strings.Cut(format, " ")
+				return nil, &imapError{verb: verb, reply: rest}
+			}
+			return resps, nil
+		}
+		if strings.HasPrefix(resp.line, "* ") {
+			resps = append(resps, resp)
+		}
+	}
+}
+
+// readResponse reads one response line, with the literals it contains.
+func (c *imapConn) readResponse() (imapResponse, error) {
+	var resp imapResponse
+	var sb strings.Builder
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return resp, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		// A literal announces its size at the end of the line.
+		if strings.HasSuffix(line, "}") {
+			if open := strings.LastIndexByte(line, '{'); open >= 0 {
+				if n, err := strconv.Atoi(line[open+1 : len(line)-1]); err == nil {
+					lit := make([]byte, n)
+					if _, err := io.ReadFull(c.r, lit); err != nil {
+						return resp, err
+					}
+					resp.literals = append(resp.literals, lit)
+					sb.WriteString(line[:open] + "{}")
+					continue
+				}
+			}
+		}
+		sb.WriteString(line)
+		resp.line = sb.String()
+		return resp, nil
+	}
+}
+
+// login authenticates with LOGIN and selects mailbox.
+func (c *imapConn) login(user, pass, mailbox string) error {
+	if _, err := c.cmd("LOGIN %s %s", imapQuote(user), imapQuote(pass)); err != nil {
+		return err
+	}
+	_, err := c.cmd("SELECT %s", imapQuote(mailbox))
+	return err
+}
+
+// unseen returns the UIDs of the messages not yet seen.
+func (c *imapConn) unseen() ([]uint32, error) {
+	resps, err := c.cmd("UID SEARCH UNSEEN")
+	if err != nil {
+		return nil, err
+	}
+	var uids []uint32
+	for _, r := range resps {
+		rest, ok := strings.CutPrefix(r.line, "* SEARCH")
+		if !ok {
+			continue
+		}
+		for _, f := range strings.Fields(rest) {
+			if n, err := strconv.ParseUint(f, 10, 32); err == nil {
+				uids = append(uids, uint32(n))
+			}
+		}
+	}
+	return uids, nil
+}
+
+// fetch returns the whole message uid, without flagging it as seen.
+func (c *imapConn) fetch(uid uint32) ([]byte, error) {
+	resps, err := c.cmd("UID FETCH %d (BODY.PEEK[])", uid)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range resps {
+		if strings.Contains(r.line, "FETCH") && len(r.literals) > 0 {
+			return r.literals[0], nil
+		}
+	}
+	return nil, fmt.Errorf("imap: message %d not returned", uid)
+}
+
+// markSeen flags message uid as seen.
+func (c *imapConn) markSeen(uid uint32) error {
+	_, err := c.cmd(`UID STORE %d +FLAGS.SILENT (\Seen)`, uid)
+	return err
+}
+
+// logout ends the session and closes the connection.
+func (c *imapConn) logout() {
+	c.cmd("LOGOUT")
+	c.Close()
+}
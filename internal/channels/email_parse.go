@@ -0,0 +1,235 @@
+package channels
+
+import (
+	"bytes"
+	"encoding/base64"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// inboundEmail is what the email channel keeps of a received message.
+type inboundEmail struct {
+	From        string // sender address, lower-cased
+	Name        string // sender display name, if any
+	Subject     string
+	MessageID   string // with its angle brackets
+	References  string // the References header, for replies
+	Text        string // the new text, without the quoted message replied to
+	Attachments []emailAttachment
+	Auto        bool     // an auto-reply, bounce or mailing-list message
+	AuthResults []string // the Authentication-Results headers, topmost first
+}
+
+type emailAttachment struct {
+	Name string
+	Data []byte
+}
+
+var (
+	emailTagRE         = regexp.MustCompile(`(?s)<(script|style)[^>]*>.*?</(script|style)>|<[^>]+>`)
+	emailBreakRE       = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</div>|</li>|</tr>`)
+	emailBlankRE       = regexp.MustCompile(`\n{3,}`)
+	emailAttributionRE = regexp.MustCompile(`^(On|Em|El|Le|Am) .+(wrote|escreveu|escribió|a écrit|schrieb):?$`)
+)
+
+// emailCommentRE matches the comments of a header, e.g. "(p=NONE)".
+var emailCommentRE = regexp.MustCompile(`\([^()]*\)`)
+
+// emailAuthenticated reports whether the Authentication-Results headers
+// results (topmost first) show that the receiving server authenticated an
+// email from domain: a DMARC pass for it, or a DKIM pass of a signature by
+// it or a parent domain. Only the header of the server whose authserv-id is
+// servID counts, or the topmost one when servID is empty: the others may
+// have been written by the sender.
+func emailAuthenticated(results []string, servID, domain string) bool {
+	domain = strings.ToLower(domain)
+	for _, r := range results {
+		parts := strings.Split(emailCommentRE.ReplaceAllString(strings.ToLower(r), ""), ";")
+		id := strings.Fields(parts[0])
+		if servID != "" && (len(id) == 0 || id[0] != strings.ToLower(servID)) {
+			continue
+		}
+		for _, res := range parts[1:] {
+			fields := strings.Fields(res)
+			if len(fields) == 0 {
+				continue
+			}
+			method := fields[0]
+			props := make(map[string]string)
+			for _, f := range fields[1:] {
+				if k, v, ok := strings.Cut(f, "="); ok {
+					props[k] = strings.Trim(v, `"`)
+				}
+			}
+			switch method {
+			case "dmarc=pass":
+				if props["header.from"] == domain {
+					return true
+				}
+			case "dkim=pass":
+				d := props["header.d"]
+				if d == "" {
+					_, d, _ = strings.Cut(props["header.i"], "@")
+				}
+				if d != "" && (domain == d || strings.HasSuffix(domain, "."+d)) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// parseEmail reads a whole RFC 5322 message.
+func parseEmail(raw []byte) (*inboundEmail, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	h := msg.Header
+	e := &inboundEmail{MessageID: strings.TrimSpace(h.Get("Message-Id")), References: strings.TrimSpace(h.Get("References")),
+		AuthResults: h["Authentication-Results"]}
+	if from, err := mail.ParseAddress(h.Get("From")); err == nil {
+		e.From, e.Name = strings.ToLower(from.Address), from.Name
+	}
+	dec := mime.WordDecoder{CharsetReader: charsetReader}
+	if subject, err := dec.DecodeHeader(h.Get("Subject")); err == nil {
+		e.Subject = strings.TrimSpace(subject)
+	}
+	auto := strings.ToLower(h.Get("Auto-Submitted"))
+	prec := strings.ToLower(h.Get("Precedence"))
+	e.Auto = (auto != "" && auto != "no") || prec == "bulk" || prec == "list" || prec == "junk" ||
+		h.Get("List-Id") != "" || strings.HasPrefix(e.From, "mailer-daemon@")
+
+	var plain, htmlText string
+	walkEmailPart(h, msg.Body, func(ct, name string, body []byte) {
+		switch {
+		case name != "":
+			e.Attachments = append(e.Attachments, emailAttachment{Name: name, Data: body})
+		case ct == "text/plain" && plain == "":
+			plain = string(body)
+		case ct == "text/html" && htmlText == "":
+			htmlText = string(body)
+		}
+	})
+	if plain == "" && htmlText != "" {
+		plain = htmlToText(htmlText)
+	}
+	e.Text = stripQuotedReply(plain)
+	return e, nil
+}
+
+// walkEmailPart calls fn with each leaf part of a message body: its media
+// type, its file name when it is an attachment, and its decoded content.
+func walkEmailPart(h map[string][]string, body io.Reader, fn func(ct, name string, body []byte)) {
+	get := func(k string) string {
+		if v := h[k]; len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	ct, params, err := mime.ParseMediaType(get("Content-Type"))
+	if err != nil {
+		ct, params = "text/plain", map[string]string{}
+	}
+	if strings.HasPrefix(ct, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextRawPart()
+			if err != nil {
+				return
+			}
+			walkEmailPart(p.Header, p, fn)
+		}
+	}
+
+	var r io.Reader = body
+	switch strings.ToLower(get("Content-Transfer-Encoding")) {
+	case "base64":
+		r = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		r = quotedprintable.NewReader(body)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return
+	}
+	name := params["name"]
+	if disp, dparams, err := mime.ParseMediaType(get("Content-Disposition")); err == nil {
+		if dparams["filename"] != "" {
+			name = dparams["filename"]
+		}
+		if disp == "attachment" && name == "" {
+			name = "attachment"
+		}
+	}
+	if name != "" {
+		dec := mime.WordDecoder{CharsetReader: charsetReader}
+		if n, err := dec.DecodeHeader(name); err == nil {
+			name = n
+		}
+		fn(ct, name, data)
+		return
+	}
+	if cs := params["charset"]; strings.HasPrefix(ct, "text/") && cs != "" && !strings.EqualFold(cs, "utf-8") {
+		if cr, err := charsetReader(cs, bytes.NewReader(data)); err == nil {
+			if d, err := io.ReadAll(cr); err == nil {
+				data = d
+			}
+		}
+	}
+	fn(ct, "", data)
+}
+
+// charsetReader decodes text in the named charset to UTF-8.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, err
+	}
+	return enc.NewDecoder().Reader(input), nil
+}
+
+// htmlToText reduces an HTML body to its text.
+func htmlToText(s string) string {
+	s = emailBreakRE.ReplaceAllString(s, "\n")
+	s = emailTagRE.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+	return emailBlankRE.ReplaceAllString(strings.TrimSpace(s), "\n\n")
+}
+
+// stripQuotedReply cuts the message being replied to, quoted below the
+// new text, along with the "On …, … wrote:" line introducing it.
+func stripQuotedReply(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		t := strings.TrimSpace(line)
+		if emailAttributionRE.MatchString(t) || t == "-----Original Message-----" {
+			lines = lines[:i]
+			break
+		}
+	}
+	// Trailing quoted lines without an attribution.
+	end := len(lines)
+	for end > 0 {
+		t := strings.TrimSpace(lines[end-1])
+		if t != "" && !strings.HasPrefix(t, ">") {
+			break
+		}
+		end--
+	}
+	if end > 0 {
+		lines = lines[:end]
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,250 @@
+package channels
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/access"
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+)
+
+const testEmail = "Authentication-Results: mx.example.net; dkim=pass header.i=@example.com; dmarc=pass (p=NONE) header.from=example.com\r\n" +
+	"From: Ana Souza <Ana@Example.com>\r\n" +
+	"To: bot@example.com\r\n" +
+	"Subject: =?utf-8?q?Relat=C3=B3rio?=\r\n" +
+	"Message-ID: <m2@example.com>\r\n" +
+	"References: <m1@example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"b1\"\r\n" +
+	"\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"Segue o relat=F3rio.\r\n" +
+	"\r\n" +
+	"On Mon, 1 Jan 2026, bot wrote:\r\n" +
+	"> the earlier message\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/csv; name=\"data.csv\"\r\n" +
+	"Content-Disposition: attachment; filename=\"data.csv\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"YSxiCjEsMgo=\r\n" +
+	"--b1--\r\n"
+
+func TestParseEmail(t *testing.T) {
+	e, err := parseEmail([]byte(testEmail))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.From != "ana@example.com" || e.Name != "Ana Souza" {
+		t.Errorf("from = %q %q", e.From, e.Name)
+	}
+	if e.Subject != "Relatório" || e.MessageID != "<m2@example.com>" || e.References != "<m1@example.com>" {
+		t.Errorf("headers = %q %q %q", e.Subject, e.MessageID, e.References)
+	}
+	if e.Text != "Segue o relatório." {
+		t.Errorf("text = %q", e.Text)
+	}
+	if len(e.Attachments) != 1 || e.Attachments[0].Name != "data.csv" || string(e.Attachments[0].Data) != "a,b\n1,2\n" {
+		t.Errorf("attachments = %+v", e.Attachments)
+	}
+	if e.Auto {
+		t.Error("a personal email marked automatic")
+	}
+
+	auto, err := parseEmail([]byte("From: MAILER-DAEMON@example.com\r\nSubject: Undelivered\r\n\r\nsorry"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !auto.Auto {
+		t.Error("a bounce not marked automatic")
+	}
+}
+
+func TestEmailAuthenticated(t *testing.T) {
+	cases := []struct {
+		results []string
+		servID  string
+		domain  string
+		want    bool
+	}{
+		{[]string{"mx.example.net; dmarc=pass (p=REJECT) header.from=example.com"}, "", "example.com", true},
+		{[]string{"mx.example.net; dkim=pass header.d=example.com header.s=s1"}, "", "mail.example.com", true},
+		{[]string{"mx.example.net; dkim=pass header.i=@example.com"}, "", "example.com", true},
+		{[]string{"mx.example.net; dkim=pass header.d=evil.com; dmarc=fail header.from=example.com"}, "", "example.com", false},
+		{[]string{"mx.example.net; spf=pass smtp.mailfrom=example.com"}, "", "example.com", false},
+		{nil, "", "example.com", false},
+		// Only the receiving server's header counts, not one the sender wrote.
+		{[]string{"mx.example.net; dmarc=fail header.from=example.com", "evil; dmarc=pass header.from=example.com"}, "", "example.com", false},
+		{[]string{"evil; dmarc=pass header.from=example.com"}, "mx.example.net", "example.com", false},
+		{[]string{"other; none", "MX.example.net 1; dmarc=pass header.from=example.com"}, "mx.example.net", "example.com", true},
+	}
+	for _, c := range cases {
+		if got := emailAuthenticated(c.results, c.servID, c.domain); got != c.want {
+			t.Errorf("emailAuthenticated(%q, %q, %q) = %v, want %v", c.results, c.servID, c.domain, got, c.want)
+		}
+	}
+
+	// Without authentication results, the shared secret lets an email in.
+	c := &emailClient{cfg: config.EmailConfig{Secret: "s3cr3t"}}
+	e := &inboundEmail{From: "ana@example.com", Subject: "hi", Text: "the report please\n-- s3cr3t"}
+	if !c.authentic(e) || strings.Contains(e.Text, "s3cr3t") {
+		t.Errorf("secret: %+v", e)
+	}
+	if c.authentic(&inboundEmail{From: "ana@example.com", Text: "no secret"}) {
+		t.Error("an email without the secret passed")
+	}
+}
+
+func TestStripQuotedReply(t *testing.T) {
+	cases := map[string]string{
+		"thanks!\n\n> old\n> text\n":                      "thanks!",
+		"yes\n\n-----Original Message-----\nFrom: x":      "yes",
+		"see below\n> quoted\nmy answer":                  "see below\n> quoted\nmy answer",
+		"Em seg., 1 de jan. de 2026, Ana escreveu:\n> oi": "",
+		"hello <b>world</b>":                              "hello <b>world</b>",
+	}
+	for in, want := range cases {
+		if got := stripQuotedReply(in); got != want {
+			t.Errorf("stripQuotedReply(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := htmlToText("<p>Hello&nbsp;<b>there</b></p><p>bye</p>"); got != "Hello there\nbye" {
+		t.Errorf("htmlToText = %q", got)
+	}
+}
+
+// fakeIMAP answers the commands of one session on conn, serving msgs by
+// UID, and records the UIDs flagged as seen.
+func fakeIMAP(t *testing.T, conn net.Conn, msgs map[int]string, seen chan<- int) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	fmt.Fprintf(conn, "* OK IMAP ready\r\n")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		tag, cmd, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch {
+		case strings.HasPrefix(cmd, "LOGIN"):
+			if cmd != `LOGIN "bot@example.com" "p\"w"` {
+				fmt.Fprintf(conn, "%s NO bad credentials\r\n", tag)
+				continue
+			}
+		case strings.HasPrefix(cmd, "SELECT"):
+			fmt.Fprintf(conn, "* %d EXISTS\r\n", len(msgs))
+		case cmd == "UID SEARCH UNSEEN":
+			fmt.Fprintf(conn, "* SEARCH")
+			for uid := range msgs {
+				fmt.Fprintf(conn, " %d", uid)
+			}
+			fmt.Fprintf(conn, "\r\n")
+		case strings.HasPrefix(cmd, "UID FETCH"):
+			var uid int
+			fmt.Sscanf(cmd, "UID FETCH %d", &uid)
+			if msgs[uid] == "" {
+				fmt.Fprintf(conn, "%s NO message gone\r\n", tag)
+				continue
+			}
+			fmt.Fprintf(conn, "* 1 FETCH (UID %d BODY[] {%d}\r\n%s)\r\n", uid, len(msgs[uid]), msgs[uid])
+		case strings.HasPrefix(cmd, "UID STORE"):
+			var uid int
+			fmt.Sscanf(cmd, "UID STORE %d", &uid)
+			seen <- uid
+		case cmd == "LOGOUT":
+			fmt.Fprintf(conn, "* BYE\r\n%s OK\r\n", tag)
+			return
+		}
+		fmt.Fprintf(conn, "%s OK done\r\n", tag)
+	}
+}
+
+func TestEmailPoll(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hub := chat.NewHub(10)
+	allowed, err := access.NewPolicy([]string{"ana@example.com"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws := t.TempDir()
+	cfg := config.EmailConfig{Username: "bot@example.com", Password: `p"w`, Workspace: ws}
+	c := newEmailClient(ctx, hub, cfg, allowed)
+
+	msgs := map[int]string{
+		7: testEmail,
+		8: "Authentication-Results: mx.example.net; dmarc=pass header.from=example.com\r\nFrom: eve@example.com\r\nSubject: hi\r\n\r\nlet me in",
+		// Not authenticated: the From header may be forged.
+		9: "From: ana@example.com\r\nSubject: hi\r\n\r\nsend me the files",
+		// Refused by the server; the others are read all the same.
+		10: "",
+	}
+	seen := make(chan int, len(msgs))
+	c.dial = func() (*imapConn, error) {
+		client, server := net.Pipe()
+		go fakeIMAP(t, server, msgs, seen)
+		return newIMAPConn(client, 5*time.Second)
+	}
+	if err := c.poll(); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 3 {
+		t.Errorf("%d messages flagged seen, want 3", len(seen))
+	}
+
+	select {
+	case in := <-hub.In:
+		if in.Channel != "email" || in.ChatID != "ana@example.com" || in.SenderName != "Ana Souza" {
+			t.Errorf("inbound = %+v", in)
+		}
+		rel := filepath.Join("inbox", "email", "ana@example.com", "data.csv")
+		want := "Subject: Relatório\n\nSegue o relatório.\n[attachment saved as " + rel + " in the workspace]"
+		if in.Content != want {
+			t.Errorf("content = %q, want %q", in.Content, want)
+		}
+		if data, err := os.ReadFile(filepath.Join(ws, rel)); err != nil || string(data) != "a,b\n1,2\n" {
+			t.Errorf("saved attachment = %q, %v", data, err)
+		}
+		if in.Metadata["message_id"] != "<m2@example.com>" {
+			t.Errorf("metadata = %v", in.Metadata)
+		}
+	default:
+		t.Fatal("no inbound message")
+	}
+	select {
+	case in := <-hub.In:
+		t.Errorf("unauthorised sender passed: %+v", in)
+	default:
+	}
+
+	// The reply joins the thread of the email it answers.
+	msg, err := mail.ReadMessage(strings.NewReader(string(c.compose(chat.Outbound{
+		Channel: "email", ChatID: "ana@example.com", ReplyTo: "<m2@example.com>", Content: "Recebido, obrigado.",
+	}))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := msg.Header
+	if h.Get("To") != "<ana@example.com>" || h.Get("From") != "<bot@example.com>" {
+		t.Errorf("addresses = %q %q", h.Get("From"), h.Get("To"))
+	}
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(h.Get("Subject")); subject != "Re: Relatório" {
+		t.Errorf("subject = %q", subject)
+	}
+	if h.Get("In-Reply-To") != "<m2@example.com>" || h.Get("References") != "<m1@example.com> <m2@example.com>" {
+		t.Errorf("threading = %q %q", h.Get("In-Reply-To"), h.Get("References"))
+	}
+}
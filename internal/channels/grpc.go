@@ -0,0 +1,364 @@
+//go:build !lite
+
+package channels
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/local/picobot/api/picobotpb"
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/netguard"
+)
+
+const (
+	// grpcDefaultListen is the address the gRPC channel listens on by
+	// default: local only, to be exposed through a reverse proxy or a VPN.
+	grpcDefaultListen = "127.0.0.1:8793"
+	// grpcStreamQueue is how many events wait for a slow client before its
+	// partial replies and tool events are dropped, and it is disconnected
+	// when a reply finds no room.
+	grpcStreamQueue = 64
+)
+
+// errGRPCSlowClient ends the stream of a client that fell too far behind.
+var errGRPCSlowClient = errors.New("client too slow: events queue full")
+
+// StartGRPC serves the gRPC channel (service picobot.v1.Chat, see
+// api/picobotpb) on cfg.Listen, through which other services hold
+// conversations with the agent over a bidirectional stream, with the tools
+// it runs reported as it goes. Callers authenticate with one of the
+// configured tokens, as a bearer token in the call's metadata. With
+// cfg.SigningSecret, messages must be signed, and events are.
+func StartGRPC(ctx context.Context, hub *chat.Hub, cfg config.GRPCConfig) error {
+	if len(cfg.Tokens) == 0 {
+		return fmt.Errorf("grpc: at least one token is required")
+	}
+	if err := checkAPITokens("grpc", cfg.Tokens); err != nil {
+		return err
+	}
+	addr := cfg.Listen
+	if addr == "" {
+		addr = grpcDefaultListen
+	}
+	ln, err := netguard.Listen("grpc", addr, cfg.Transport, "h2")
+	if err != nil {
+		return err
+	}
+	s := newGRPCServer(ctx, hub, cfg.Tokens, cfg.SigningSecret)
+	srv := grpc.NewServer()
+	picobotpb.RegisterChatServer(srv, s)
+	go func() {
+		<-ctx.Done()
+		srv.Stop()
+	}()
+	go func() {
+		log.Printf("grpc: listening on %s", ln.Addr())
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			log.Printf("grpc: %v", err)
+		}
+	}()
+	go s.runOutbound()
+	return nil
+}
+
+// grpcServer is the gRPC channel: its callers and the streams open on each
+// chat.
+type grpcServer struct {
+	picobotpb.UnimplementedChatServer
+
+	hub    *chat.Hub
+	outCh  <-chan chat.Outbound
+	ctx    context.Context
+	tokens []config.APIToken
+	signer *messageSigner // signs the events and checks the messages; nil: none
+
+	mu      sync.Mutex
+	streams map[string]map[*grpcStream]bool // by chat ID, the streams that sent to it
+	nextID  int
+}
+
+// grpcStream is an open Converse call: the events waiting to be sent to
+// its client.
+type grpcStream struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	events chan *picobotpb.Event
+}
+
+// push queues ev for the client, waiting while the queue is full; it
+// reports false when the stream ended first.
+func (st *grpcStream) push(ev *picobotpb.Event) bool {
+	select {
+	case st.events <- ev:
+		return true
+	case <-st.ctx.Done():
+		return false
+	}
+}
+
+// offer queues ev for the client unless the queue is full: partial replies
+// and tool events are superseded by the reply, so a client that falls behind
+// does not hold up the others.
+func (st *grpcStream) offer(ev *picobotpb.Event) {
+	select {
+	case st.events <- ev:
+	default:
+	}
+}
+
+// send queues reply ev for the client. Waiting for room would hold up every
+// other chat, so a client whose queue is full is disconnected instead.
+func (st *grpcStream) send(ev *picobotpb.Event) {
+	select {
+	case st.events <- ev:
+	default:
+		st.cancel(errGRPCSlowClient)
+	}
+}
+
+func newGRPCServer(ctx context.Context, hub *chat.Hub, tokens []config.APIToken, secret string) *grpcServer {
+	// Clients see replies as they are written, and the tools run for them.
+	hub.EnableStreaming("grpc")
+	hub.EnableToolEvents("grpc")
+	return &grpcServer{
+		hub:     hub,
+		outCh:   hub.Subscribe("grpc"),
+		ctx:     ctx,
+		tokens:  tokens,
+		signer:  newMessageSigner(secret),
+		streams: make(map[string]map[*grpcStream]bool),
+	}
+}
+
+// caller returns the name of the bearer token in the metadata of ctx, or ""
+// when it carries none of the tokens.
+func (s *grpcServer) caller(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		if token, ok := strings.CutPrefix(v, "Bearer "); ok {
+			return apiTokenName(s.tokens, token)
+		}
+	}
+	return ""
+}
+
+// Converse sends the client's messages to the agent while streaming back
+// the events of the chats they went to, until the client cancels the call;
+// a client that only closes its side still receives the replies.
+func (s *grpcServer) Converse(stream picobotpb.Chat_ConverseServer) error {
+	caller := s.caller(stream.Context())
+	if caller == "" {
+		return status.Error(codes.Unauthenticated, "unauthorized")
+	}
+	ctx, cancel := context.WithCancelCause(stream.Context())
+	defer cancel(nil)
+	st := &grpcStream{ctx: ctx, cancel: cancel, events: make(chan *picobotpb.Event, grpcStreamQueue)}
+	defer s.unsubscribe(st)
+
+	received := make(chan error, 1)
+	go func() { received <- s.receive(caller, st, stream) }()
+	for {
+		select {
+		case ev := <-st.events:
+			if err := stream.Send(s.seal(ev)); err != nil {
+				return err
+			}
+		case err := <-received:
+			if err != io.EOF {
+				return err
+			}
+			received = nil
+		case <-st.ctx.Done():
+			if context.Cause(st.ctx) == errGRPCSlowClient {
+				log.Printf("grpc: disconnected %s: %v", caller, errGRPCSlowClient)
+				return status.Error(codes.ResourceExhausted, errGRPCSlowClient.Error())
+			}
+			return nil
+		}
+	}
+}
+
+// receive hands the client's messages to the agent, each acknowledged
+// first. It stops reading while the agent's queue is full, so that flow
+// control holds the client back.
+func (s *grpcServer) receive(caller string, st *grpcStream, stream picobotpb.Chat_ConverseServer) error {
+	for {
+		in, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		if s.signer != nil {
+			if in, err = s.open(in); err != nil {
+				log.Printf("grpc: refused a message of %s: %v", caller, err)
+				if !st.push(&picobotpb.Event{Event: &picobotpb.Event_Error{Error: &picobotpb.Error{Message: err.Error()}}}) {
+					return nil
+				}
+				continue
+			}
+		}
+		name := in.GetChatId()
+		if name == "" {
+			name = "default"
+		}
+		text := strings.TrimSpace(in.GetText())
+		var problem string
+		switch {
+		case !webChatIDRE.MatchString(name):
+			problem = "chat_id may only have letters, digits, _ and - (at most 64)"
+		case text == "":
+			problem = "text is required"
+		}
+		if problem != "" {
+			if !st.push(&picobotpb.Event{Event: &picobotpb.Event_Error{Error: &picobotpb.Error{ChatId: name, Message: problem}}}) {
+				return nil
+			}
+			continue
+		}
+		// Chats are kept apart by caller.
+		chatID := caller + ":" + name
+
+		s.mu.Lock()
+		s.nextID++
+		id := "g" + strconv.Itoa(s.nextID)
+		if s.streams[chatID] == nil {
+			s.streams[chatID] = make(map[*grpcStream]bool)
+		}
+		s.streams[chatID][st] = true
+		s.mu.Unlock()
+
+		// Acknowledge first, so the client knows the ID before the reply.
+		if !st.push(&picobotpb.Event{Event: &picobotpb.Event_Ack{Ack: &picobotpb.Ack{Id: id, ChatId: name}}}) {
+			return nil
+		}
+		sender := in.GetSender()
+		if sender == "" {
+			sender = caller
+		}
+		log.Printf("grpc: message from %s in %s: %s", caller, chatID, truncate(text, 50))
+		msg := chat.Inbound{
+			Channel:    "grpc",
+			SenderID:   caller,
+			SenderName: sender,
+			ChatID:     chatID,
+			Content:    text,
+			Timestamp:  time.Now(),
+			Metadata:   map[string]interface{}{"message_id": id, "is_dm": true},
+		}
+		select {
+		case s.hub.In <- msg:
+		case <-st.ctx.Done():
+			return nil
+		}
+	}
+}
+
+// seal returns ev as it is sent: signed when the channel has a signing
+// secret.
+func (s *grpcServer) seal(ev *picobotpb.Event) *picobotpb.Event {
+	if s.signer == nil {
+		return ev
+	}
+	payload, err := proto.Marshal(ev)
+	if err != nil {
+		// Not expected of the events built here; sent as they are.
+		log.Printf("grpc: signing an event: %v", err)
+		return ev
+	}
+	ts, sig := s.signer.sign(payload)
+	return &picobotpb.Event{Event: &picobotpb.Event_Signed{Signed: &picobotpb.Signed{Timestamp: ts, Signature: sig, Payload: payload}}}
+}
+
+// open checks the signature of a message sent by a client and returns the
+// message it carries.
+func (s *grpcServer) open(in *picobotpb.Inbound) (*picobotpb.Inbound, error) {
+	signed := in.GetSigned()
+	if signed == nil {
+		return nil, fmt.Errorf("%w: not signed", errSignature)
+	}
+	if err := s.signer.verify(signed.GetTimestamp(), signed.GetSignature(), signed.GetPayload()); err != nil {
+		return nil, err
+	}
+	msg := new(picobotpb.Inbound)
+	if err := proto.Unmarshal(signed.GetPayload(), msg); err != nil {
+		return nil, fmt.Errorf("invalid message: %w", err)
+	}
+	return msg, nil
+}
+
+// unsubscribe forgets st, which has ended, in every chat.
+func (s *grpcServer) unsubscribe(st *grpcStream) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for chatID, streams := range s.streams {
+		delete(streams, st)
+		if len(streams) == 0 {
+			delete(s.streams, chatID)
+		}
+	}
+}
+
+// runOutbound reads messages from the hub's grpc subscription and sends
+// each to the streams open on its chat.
+func (s *grpcServer) runOutbound() {
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case out := <-s.outCh:
+			s.deliver(out)
+		}
+	}
+}
+
+func (s *grpcServer) deliver(out chat.Outbound) {
+	_, name, _ := strings.Cut(out.ChatID, ":")
+	tool, isTool := out.Metadata["tool_event"].(chat.ToolEvent)
+	var ev *picobotpb.Event
+	if isTool {
+		ev = &picobotpb.Event{Event: &picobotpb.Event_Tool{Tool: &picobotpb.ToolEvent{
+			ReplyTo: out.ReplyTo, ChatId: name, Name: tool.Name, DurationMs: tool.Duration.Milliseconds(), Error: tool.Error,
+		}}}
+	} else {
+		ev = &picobotpb.Event{Event: &picobotpb.Event_Message{Message: &picobotpb.Outbound{
+			Id: out.StreamID, ReplyTo: out.ReplyTo, ChatId: name, Text: stripHidingMarkers(out.Content, false),
+			Partial: out.Partial, Kind: out.Type, Files: out.Media,
+		}}}
+	}
+
+	s.mu.Lock()
+	var streams []*grpcStream
+	for st := range s.streams[out.ChatID] {
+		streams = append(streams, st)
+	}
+	s.mu.Unlock()
+	if len(streams) == 0 {
+		if !isTool && !out.Partial {
+			// The client went away before the reply, or a reminder came
+			// for a chat nobody listens to.
+			log.Printf("grpc: dropped a message for %s: no stream open on the chat", out.ChatID)
+		}
+		return
+	}
+	for _, st := range streams {
+		if isTool || out.Partial {
+			st.offer(ev)
+		} else {
+			st.send(ev)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+//go:build lite
+
+package channels
+
+import (
+	"context"
+	"log"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+)
+
+// StartGRPC is a no-op stub used when the binary is built with the 'lite'
+// build tag. If the gRPC channel is enabled in the config it logs a clear
+// warning and returns nil so the gateway continues with other channels.
+func StartGRPC(ctx context.Context, hub *chat.Hub, cfg config.GRPCConfig) error {
+	log.Println("grpc: channel not available in 'lite' version.")
+	return nil
+}
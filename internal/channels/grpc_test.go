@@ -0,0 +1,221 @@
+//go:build !lite
+
+package channels
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/local/picobot/api/picobotpb"
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/webhooks"
+)
+
+func TestGRPCConverse(t *testing.T) {
+	hub := chat.NewHub(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := newGRPCServer(ctx, hub, []config.APIToken{{Name: "svc", Token: "secret"}}, "")
+	hub.StartRouter(ctx)
+	go s.runOutbound()
+
+	ln := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	picobotpb.RegisterChatServer(srv, s)
+	go srv.Serve(ln)
+	defer srv.Stop()
+	conn, err := grpc.NewClient("passthrough:///bufnet", grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return ln.DialContext(ctx) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := picobotpb.NewChatClient(conn)
+
+	// Without a token the call is refused.
+	denied, err := client.Converse(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := denied.Recv(); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("without a token: %v, want Unauthenticated", err)
+	}
+
+	callCtx := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret")
+	stream, err := client.Converse(callCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recv := func() *picobotpb.Event {
+		t.Helper()
+		ev, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("recv: %v", err)
+		}
+		return ev
+	}
+
+	stream.Send(&picobotpb.Inbound{ChatId: "bad chat", Text: "hi"})
+	if e := recv().GetError(); e == nil || e.ChatId != "bad chat" {
+		t.Fatalf("expected an error event for a bad chat ID, got %v", e)
+	}
+
+	stream.Send(&picobotpb.Inbound{ChatId: "one", Text: "what's the weather?", Sender: "Ana"})
+	ack := recv().GetAck()
+	if ack == nil || ack.Id == "" || ack.ChatId != "one" {
+		t.Fatalf("expected an ack, got %v", ack)
+	}
+	var in chat.Inbound
+	select {
+	case in = <-hub.In:
+	case <-time.After(time.Second):
+		t.Fatal("no inbound")
+	}
+	if in.Channel != "grpc" || in.ChatID != "svc:one" || in.SenderName != "Ana" || in.MessageID() != ack.Id {
+		t.Fatalf("unexpected inbound: %+v", in)
+	}
+
+	hub.Out <- chat.Outbound{Channel: "grpc", ChatID: in.ChatID, ReplyTo: ack.Id,
+		Metadata: map[string]interface{}{"tool_event": chat.ToolEvent{Name: "web", Duration: 1500 * time.Millisecond}}}
+	hub.Out <- chat.Outbound{Channel: "grpc", ChatID: in.ChatID, ReplyTo: ack.Id, StreamID: "s1", Content: "Sunny", Partial: true}
+	hub.Out <- chat.Outbound{Channel: "grpc", ChatID: in.ChatID, ReplyTo: ack.Id, StreamID: "s1", Content: "Sunny, 24°C"}
+
+	if tool := recv().GetTool(); tool == nil || tool.Name != "web" || tool.DurationMs != 1500 || tool.ReplyTo != ack.Id || tool.ChatId != "one" {
+		t.Fatalf("expected a tool event, got %v", tool)
+	}
+	if m := recv().GetMessage(); m == nil || !m.Partial || m.Text != "Sunny" || m.Id != "s1" {
+		t.Fatalf("expected a partial reply, got %v", m)
+	}
+	if m := recv().GetMessage(); m == nil || m.Partial || m.Text != "Sunny, 24°C" || m.ReplyTo != ack.Id {
+		t.Fatalf("expected the reply, got %v", m)
+	}
+
+	// A client that closes its side still receives the chat's messages.
+	stream.CloseSend()
+	hub.Out <- chat.Outbound{Channel: "grpc", ChatID: in.ChatID, Content: "Take an umbrella", Type: chat.TypeReminder}
+	if m := recv().GetMessage(); m == nil || m.Kind != chat.TypeReminder || m.ReplyTo != "" {
+		t.Fatalf("expected the reminder, got %v", m)
+	}
+}
+
+func TestGRPCSigning(t *testing.T) {
+	hub := chat.NewHub(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := newGRPCServer(ctx, hub, []config.APIToken{{Name: "svc", Token: "secret"}}, "k")
+
+	ln := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	picobotpb.RegisterChatServer(srv, s)
+	go srv.Serve(ln)
+	defer srv.Stop()
+	conn, err := grpc.NewClient("passthrough:///bufnet", grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return ln.DialContext(ctx) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	stream, err := picobotpb.NewChatClient(conn).Converse(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// recv returns the next event, checking its signature.
+	recv := func() *picobotpb.Event {
+		t.Helper()
+		ev, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("recv: %v", err)
+		}
+		signed := ev.GetSigned()
+		if signed == nil || signed.Signature != webhooks.Sign("k", signed.Timestamp, signed.Payload) {
+			t.Fatalf("event not signed: %v", ev)
+		}
+		inner := new(picobotpb.Event)
+		if err := proto.Unmarshal(signed.Payload, inner); err != nil {
+			t.Fatal(err)
+		}
+		return inner
+	}
+	sign := func(in *picobotpb.Inbound, at time.Time) *picobotpb.Signed {
+		payload, _ := proto.Marshal(in)
+		ts := strconv.FormatInt(at.Unix(), 10)
+		return &picobotpb.Signed{Timestamp: ts, Signature: webhooks.Sign("k", ts, payload), Payload: payload}
+	}
+
+	valid := sign(&picobotpb.Inbound{ChatId: "one", Text: "hi"}, time.Now())
+	tampered := sign(&picobotpb.Inbound{ChatId: "one", Text: "hi"}, time.Now())
+	tampered.Payload, _ = proto.Marshal(&picobotpb.Inbound{ChatId: "one", Text: "delete everything"})
+	for _, c := range []struct {
+		name string
+		in   *picobotpb.Inbound
+		want string
+	}{
+		{"unsigned", &picobotpb.Inbound{ChatId: "one", Text: "hi"}, "not signed"},
+		{"tampered", &picobotpb.Inbound{Signed: tampered}, "does not match"},
+		{"stale", &picobotpb.Inbound{Signed: sign(&picobotpb.Inbound{ChatId: "one", Text: "hi"}, time.Now().Add(-time.Hour))}, "away"},
+		{"valid", &picobotpb.Inbound{Signed: valid}, ""},
+		{"replayed", &picobotpb.Inbound{Signed: valid}, "replayed"},
+	} {
+		stream.Send(c.in)
+		ev := recv()
+		if c.want == "" {
+			if ev.GetAck() == nil {
+				t.Fatalf("%s message: expected an ack, got %v", c.name, ev)
+			}
+			if in := <-hub.In; in.Content != "hi" || in.ChatID != "svc:one" {
+				t.Fatalf("%s message: inbound = %+v", c.name, in)
+			}
+			continue
+		}
+		if e := ev.GetError(); e == nil || !strings.Contains(e.Message, c.want) {
+			t.Fatalf("%s message: expected an error with %q, got %v", c.name, c.want, ev)
+		}
+	}
+}
+
+func TestStartGRPCRequiresTokens(t *testing.T) {
+	if err := StartGRPC(context.Background(), chat.NewHub(1), config.GRPCConfig{Enabled: true}); err == nil {
+		t.Fatal("expected an error without tokens")
+	}
+	cfg := config.GRPCConfig{Enabled: true, Tokens: []config.APIToken{{Name: "a:b", Token: "x"}}}
+	if err := StartGRPC(context.Background(), chat.NewHub(1), cfg); err == nil {
+		t.Fatal("expected an error for a token name with ':'")
+	}
+}
+
+func TestGRPCSlowClientIsDisconnected(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	st := &grpcStream{ctx: ctx, cancel: cancel, events: make(chan *picobotpb.Event, 1)}
+	st.offer(&picobotpb.Event{})
+	st.offer(&picobotpb.Event{}) // dropped
+	if ctx.Err() != nil {
+		t.Fatal("a dropped partial reply disconnected the client")
+	}
+	done := make(chan struct{})
+	go func() {
+		st.send(&picobotpb.Event{})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("send blocked on a full queue")
+	}
+	if context.Cause(ctx) != errGRPCSlowClient {
+		t.Fatalf("cause = %v", context.Cause(ctx))
+	}
+}
@@ -0,0 +1,413 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	"github.com/local/picobot/internal/access"
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/netguard"
+	"github.com/local/picobot/internal/useragent"
+)
+
+const (
+	lineAPI           = "https://api.line.me/v2/bot/"
+	lineDefaultListen = "127.0.0.1:8790"
+	lineWebhookPath   = "/line/webhook"
+	// lineMaxLen is the longest text message LINE accepts.
+	lineMaxLen = 5000
+	// lineMaxMessages is the most messages of one reply or push request.
+	lineMaxMessages = 5
+	// lineReplyFor is how long a reply token is used after its message
+	// arrived; LINE lets it expire about a minute later.
+	lineReplyFor = 50 * time.Second
+	// lineMaxBody caps the size of a webhook request.
+	lineMaxBody = 1 << 20
+)
+
+// StartLINE runs a LINE Messaging API bot: events arrive on a webhook served
+// at cfg.Listen (path /line/webhook, to be exposed over HTTPS), and replies
+// are sent with the reply API while the message's reply token is fresh, and
+// with the push API after. One-to-one chats are always answered; in groups
+// the bot answers when mentioned. cfg.AllowFrom restricts which user IDs may
+// send messages; empty means allow all.
+func StartLINE(ctx context.Context, hub *chat.Hub, cfg config.LINEConfig) error {
+	if cfg.ChannelSecret == "" || cfg.ChannelAccessToken == "" {
+		return fmt.Errorf("line channelSecret and channelAccessToken are required")
+	}
+	allowed, err := access.NewPolicy(cfg.AllowFrom, cfg.Deny)
+	if err != nil {
+		return fmt.Errorf("line allowFrom: %w", err)
+	}
+	addr := cfg.Listen
+	if addr == "" {
+		addr = lineDefaultListen
+	}
+	ln, err := netguard.Listen("line", addr, cfg.Transport, "http/1.1")
+	if err != nil {
+		return err
+	}
+
+	c := newLINEClient(ctx, hub, cfg, allowed, lineAPI)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+lineWebhookPath, c.handleWebhook)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+	go func() {
+		log.Printf("line: webhook listening on %s%s", addr, lineWebhookPath)
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("line: %v", err)
+		}
+	}()
+	go c.runOutbound()
+	return nil
+}
+
+// lineClient is one LINE bot: its webhook and its replies.
+type lineClient struct {
+	api     string // Messaging API base URL, with a trailing slash
+	secret  string
+	token   string
+	hub     *chat.Hub
+	outCh   <-chan chat.Outbound
+	allowed *access.Policy
+	ctx     context.Context
+	http    *http.Client
+
+	mu      sync.Mutex
+	replies map[string]lineReplyToken // by chat ID, the latest unused reply token
+	names   map[string]string         // display names by user ID
+	offered map[string][]chat.Button  // by chat ID, the buttons last sent
+}
+
+// lineReplyToken is the token to reply to a message with, free of charge.
+type lineReplyToken struct {
+	token string
+	at    time.Time
+}
+
+func newLINEClient(ctx context.Context, hub *chat.Hub, cfg config.LINEConfig, allowed *access.Policy, api string) *lineClient {
+	return &lineClient{
+		api:     api,
+		secret:  cfg.ChannelSecret,
+		token:   cfg.ChannelAccessToken,
+		hub:     hub,
+		outCh:   hub.Subscribe("line"),
+		allowed: allowed,
+		ctx:     ctx,
+		http:    &http.Client{Timeout: 30 * time.Second},
+		replies: make(map[string]lineReplyToken),
+		names:   make(map[string]string),
+		offered: make(map[string][]chat.Button),
+	}
+}
+
+// lineEvent is the part of a webhook event picobot uses.
+type lineEvent struct {
+	Type       string `json:"type"`
+	ReplyToken string `json:"replyToken"`
+	Source     struct {
+		Type    string `json:"type"` // user, group or room
+		UserID  string `json:"userId"`
+		GroupID string `json:"groupId"`
+		RoomID  string `json:"roomId"`
+	} `json:"source"`
+	Message struct {
+		ID      string       `json:"id"`
+		Type    string       `json:"type"`
+		Text    string       `json:"text"`
+		Mention *lineMention `json:"mention"`
+	} `json:"message"`
+	Postback struct {
+		Data string `json:"data"`
+	} `json:"postback"`
+}
+
+// handleWebhook checks the signature of a webhook request and hands its
+// events to the hub. LINE is answered at once; the events are handled after.
+func (c *lineClient) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, lineMaxBody))
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	mac := hmac.New(sha256.New, []byte(c.secret))
+	mac.Write(body)
+	sig, _ := base64.StdEncoding.DecodeString(r.Header.Get("X-Line-Signature"))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		log.Printf("line: rejected a webhook request with a bad signature")
+		http.Error(w, "bad signature", http.StatusUnauthorized)
+		return
+	}
+	var payload struct {
+		Events []lineEvent `json:"events"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	go func() {
+		for _, ev := range payload.Events {
+			c.handleEvent(ev)
+		}
+	}()
+}
+
+// handleEvent turns a text message, or a tap on a button the bot sent, into
+// an inbound message.
+func (c *lineClient) handleEvent(ev lineEvent) {
+	src := ev.Source
+	chatID, isDM := src.UserID, src.Type == "user"
+	switch src.Type {
+	case "group":
+		chatID = src.GroupID
+	case "room":
+		chatID = src.RoomID
+	}
+	if chatID == "" || src.UserID == "" {
+		return
+	}
+
+	var content string
+	meta := map[string]interface{}{"is_dm": isDM}
+	switch {
+	case ev.Type == "message" && ev.Message.Type == "text":
+		content = ev.Message.Text
+		if !isDM {
+			var mentioned bool
+			if content, mentioned = lineStripMention(ev.Message.Text, ev.Message.Mention); !mentioned {
+				return
+			}
+		}
+		meta["message_id"] = ev.Message.ID
+	case ev.Type == "postback":
+		content = ev.Postback.Data
+		c.mu.Lock()
+		for _, b := range c.offered[chatID] {
+			if b.ID == ev.Postback.Data {
+				content = b.Text
+			}
+		}
+		c.mu.Unlock()
+		meta["button_id"] = ev.Postback.Data
+	case ev.Type == "message":
+		log.Printf("line: ignored a %s message from %s", ev.Message.Type, src.UserID)
+		return
+	default:
+		return
+	}
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return
+	}
+	if c.allowed != nil && !c.allowed.Allowed(src.UserID) {
+		log.Printf("line: dropped message from unauthorised user %s", src.UserID)
+		return
+	}
+
+	if ev.ReplyToken != "" {
+		c.mu.Lock()
+		c.replies[chatID] = lineReplyToken{token: ev.ReplyToken, at: time.Now()}
+		c.mu.Unlock()
+	}
+	name := c.displayName(src.UserID, src.Type, chatID)
+	log.Printf("line: message from %s in %s: %s", src.UserID, chatID, truncate(content, 50))
+	c.hub.In <- chat.Inbound{
+		Channel:    "line",
+		SenderID:   src.UserID,
+		SenderName: name,
+		ChatID:     chatID,
+		Content:    content,
+		Timestamp:  time.Now(),
+		Metadata:   meta,
+	}
+}
+
+// lineMention locates the mentions of a text message.
+type lineMention struct {
+	Mentionees []struct {
+		Index  int  `json:"index"`
+		Length int  `json:"length"`
+		IsSelf bool `json:"isSelf"` // the bot itself
+	} `json:"mentionees"`
+}
+
+// lineStripMention reports whether the bot is mentioned in text and returns
+// text without the mention. Mentions are located in UTF-16 code units.
+func lineStripMention(text string, mention *lineMention) (string, bool) {
+	if mention == nil {
+		return text, false
+	}
+	units := utf16.Encode([]rune(text))
+	for _, m := range mention.Mentionees {
+		if m.IsSelf && m.Index >= 0 && m.Index+m.Length <= len(units) {
+			rest := append(append([]uint16{}, units[:m.Index]...), units[m.Index+m.Length:]...)
+			return string(utf16.Decode(rest)), true
+		}
+	}
+	return text, false
+}
+
+// displayName returns the LINE display name of a user, looked up once.
+func (c *lineClient) displayName(userID, sourceType, chatID string) string {
+	c.mu.Lock()
+	name, ok := c.names[userID]
+	c.mu.Unlock()
+	if ok {
+		return name
+	}
+	endpoint := "profile/" + url.PathEscape(userID)
+	switch sourceType {
+	case "group":
+		endpoint = "group/" + url.PathEscape(chatID) + "/member/" + url.PathEscape(userID)
+	case "room":
+		endpoint = "room/" + url.PathEscape(chatID) + "/member/" + url.PathEscape(userID)
+	}
+	var profile struct {
+		DisplayName string `json:"displayName"`
+	}
+	if err := c.call(http.MethodGet, endpoint, nil, &profile); err != nil {
+		log.Printf("line: looking up %s: %v", userID, err)
+		return ""
+	}
+	c.mu.Lock()
+	c.names[userID] = profile.DisplayName
+	c.mu.Unlock()
+	return profile.DisplayName
+}
+
+// call sends a Messaging API request, with a JSON body unless body is nil,
+// and decodes the response into result, which may be nil.
+func (c *lineClient) call(method, endpoint string, body, result interface{}) error {
+	var payload io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(c.ctx, method, c.api+endpoint, payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", useragent.Get())
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		if e.Message == "" {
+			e.Message = resp.Status
+		}
+		return fmt.Errorf("%s: %s", endpoint, e.Message)
+	}
+	if result != nil {
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+	return nil
+}
+
+// runOutbound reads replies from the hub's line subscription and sends
+// them.
+func (c *lineClient) runOutbound() {
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case out := <-c.outCh:
+			if len(out.Media) > 0 {
+				log.Printf("line: %d file(s) for %s not sent: LINE only sends files from public URLs", len(out.Media), out.ChatID)
+			}
+			messages := c.lineMessages(out)
+			if len(messages) == 0 {
+				continue
+			}
+			if err := c.send(out.ChatID, messages); err != nil {
+				log.Printf("line: send error: %v", err)
+				c.hub.ReportUndelivered(out, err.Error())
+			}
+		}
+	}
+}
+
+// lineMessages renders out as LINE messages: a Flex bubble for text with
+// buttons or with headings, else plain text messages.
+func (c *lineClient) lineMessages(out chat.Outbound) []interface{} {
+	if buttons, _ := out.Metadata["buttons"].([]chat.Button); len(buttons) > 0 {
+		c.mu.Lock()
+		c.offered[out.ChatID] = buttons
+		c.mu.Unlock()
+		if flex, ok := lineButtonsFlex(out.Content, buttons); ok {
+			return []interface{}{flex}
+		}
+	}
+	if flex, ok := lineMarkdownFlex(out.Content); ok {
+		return []interface{}{flex}
+	}
+	var messages []interface{}
+	if text := linePlainText(out.Content); strings.TrimSpace(text) != "" {
+		for _, chunk := range splitMessage(text, lineMaxLen) {
+			messages = append(messages, map[string]string{"type": "text", "text": chunk})
+		}
+	}
+	return messages
+}
+
+// send delivers messages to the chat, lineMaxMessages at a time: the first
+// batch as a reply when the chat's reply token is still fresh, the rest (or
+// all, once the token is stale or refused) pushed, each push tried up to
+// sendAttempts times.
+func (c *lineClient) send(chatID string, messages []interface{}) error {
+	c.mu.Lock()
+	reply, ok := c.replies[chatID]
+	delete(c.replies, chatID)
+	c.mu.Unlock()
+	for len(messages) > 0 {
+		batch := messages[:min(lineMaxMessages, len(messages))]
+		messages = messages[len(batch):]
+		if ok && time.Since(reply.at) < lineReplyFor {
+			ok = false
+			err := c.call(http.MethodPost, "message/reply", map[string]interface{}{"replyToken": reply.token, "messages": batch}, nil)
+			if err == nil {
+				continue
+			}
+			log.Printf("line: reply failed (%v), pushing instead", err)
+		}
+		push := func() error {
+			return c.call(http.MethodPost, "message/push", map[string]interface{}{"to": chatID, "messages": batch}, nil)
+		}
+		if err := retrySend(c.ctx, push); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package channels
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+const (
+	// lineAltTextLen is the longest alternative text of a Flex message,
+	// shown in notifications and chat lists.
+	lineAltTextLen = 400
+	// lineFlexMaxBytes keeps a bubble under LINE's 30 KB limit; longer
+	// replies are sent as text.
+	lineFlexMaxBytes = 25 << 10
+	// lineButtonLabelLen is the longest label of a Flex button.
+	lineButtonLabelLen = 40
+)
+
+// linePlainText renders Markdown as LINE shows text: without markup.
+// Headings become plain lines, bullets •, links "text (url)"; code keeps its
+// content without the fences.
+func linePlainText(s string) string {
+	s = stripHidingMarkers(strings.ReplaceAll(s, "\r\n", "\n"), false)
+	lines := strings.Split(s, "\n")
+	out := lines[:0]
+	inCode := false
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCode = !inCode
+			continue
+		}
+		if !inCode {
+			if m := htmlHeadingRE.FindStringSubmatch(line); m != nil {
+				line = m[1]
+			}
+			line = lineInline(slackBulletRE.ReplaceAllString(line, "$1• "))
+		}
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n")
+}
+
+// lineInline strips the inline markup of one line: bold, italic,
+// strikethrough and code markers, and links, written "text (url)".
+func lineInline(line string) string {
+	line = htmlLinkRE.ReplaceAllString(line, "$1 ($2)")
+	line = htmlBoldRE.ReplaceAllString(line, "$1$2")
+	line = htmlItalicRE.ReplaceAllString(line, "$1$2$3$4")
+	line = htmlStrikeRE.ReplaceAllString(line, "$1")
+	return htmlInlineCodeRE.ReplaceAllString(line, "$1")
+}
+
+// lineMarkdownFlex renders structured text, with at least one heading, as
+// a Flex bubble: headings in bold, bullets as a list, rules as separators.
+// ok is false for other text, and for text too long for a bubble.
+func lineMarkdownFlex(s string) (map[string]interface{}, bool) {
+	s = stripHidingMarkers(strings.ReplaceAll(s, "\r\n", "\n"), false)
+	lines := strings.Split(s, "\n")
+	hasHeading := false
+	for _, line := range lines {
+		hasHeading = hasHeading || htmlHeadingRE.MatchString(line)
+	}
+	if !hasHeading {
+		return nil, false
+	}
+
+	var contents []interface{}
+	var para, code []string
+	flush := func() {
+		if len(para) > 0 {
+			contents = append(contents, lineFlexText(strings.Join(para, "\n"), nil))
+			para = nil
+		}
+	}
+	inCode := false
+	first := true
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			if inCode && len(code) > 0 {
+				contents = append(contents, lineFlexText(strings.Join(code, "\n"), map[string]interface{}{"size": "sm", "color": "#555555"}))
+			}
+			flush()
+			inCode, code = !inCode, nil
+			continue
+		}
+		switch {
+		case inCode:
+			code = append(code, line)
+		case strings.TrimSpace(line) == "":
+			flush()
+		case discordRuleRE.MatchString(line):
+			flush()
+			contents = append(contents, map[string]interface{}{"type": "separator", "margin": "md"})
+		case htmlHeadingRE.MatchString(line):
+			flush()
+			size := "md"
+			if first {
+				size = "lg"
+			}
+			text := lineInline(htmlHeadingRE.FindStringSubmatch(line)[1])
+			contents = append(contents, lineFlexText(text, map[string]interface{}{"weight": "bold", "size": size}))
+		case slackBulletRE.MatchString(line):
+			flush()
+			contents = append(contents, map[string]interface{}{
+				"type": "box", "layout": "baseline", "spacing": "sm",
+				"contents": []interface{}{
+					map[string]interface{}{"type": "text", "text": "•", "flex": 0},
+					lineFlexText(lineInline(slackBulletRE.ReplaceAllString(line, "")), map[string]interface{}{"flex": 1}),
+				},
+			})
+		default:
+			para = append(para, lineInline(line))
+		}
+		first = false
+	}
+	flush()
+	if len(contents) == 0 {
+		return nil, false
+	}
+	bubble := map[string]interface{}{
+		"type": "bubble",
+		"body": map[string]interface{}{"type": "box", "layout": "vertical", "spacing": "md", "contents": contents},
+	}
+	return lineFlexMessage(linePlainText(s), bubble)
+}
+
+// lineButtonsFlex renders text with buttons as a Flex bubble whose buttons
+// send their ID back as a postback.
+func lineButtonsFlex(text string, buttons []chat.Button) (map[string]interface{}, bool) {
+	plain := strings.TrimSpace(linePlainText(text))
+	if plain == "" {
+		plain = "Choose:"
+	}
+	var footer []interface{}
+	for i, b := range buttons {
+		label := b.Text
+		if utf8.RuneCountInString(label) > lineButtonLabelLen {
+			label = string([]rune(label)[:lineButtonLabelLen-1]) + "…"
+		}
+		style := "secondary"
+		if i == 0 {
+			style = "primary"
+		}
+		footer = append(footer, map[string]interface{}{
+			"type": "button", "style": style, "height": "sm",
+			"action": map[string]interface{}{"type": "postback", "label": label, "data": b.ID, "displayText": b.Text},
+		})
+	}
+	bubble := map[string]interface{}{
+		"type":   "bubble",
+		"body":   map[string]interface{}{"type": "box", "layout": "vertical", "contents": []interface{}{lineFlexText(plain, nil)}},
+		"footer": map[string]interface{}{"type": "box", "layout": "vertical", "spacing": "sm", "contents": footer},
+	}
+	return lineFlexMessage(plain, bubble)
+}
+
+// lineFlexText is a wrapping text component with the given extra
+// properties.
+func lineFlexText(text string, props map[string]interface{}) map[string]interface{} {
+	c := map[string]interface{}{"type": "text", "text": text, "wrap": true}
+	for k, v := range props {
+		c[k] = v
+	}
+	return c
+}
+
+// lineFlexMessage wraps bubble in a Flex message with alt as its
+// alternative text. ok is false when the message is too large for LINE.
+func lineFlexMessage(alt string, bubble map[string]interface{}) (map[string]interface{}, bool) {
+	alt = strings.TrimSpace(alt)
+	if alt == "" {
+		alt = "Message"
+	}
+	if utf8.RuneCountInString(alt) > lineAltTextLen {
+		alt = string([]rune(alt)[:lineAltTextLen-1]) + "…"
+	}
+	msg := map[string]interface{}{"type": "flex", "altText": alt, "contents": bubble}
+	if b, err := json.Marshal(msg); err != nil || len(b) > lineFlexMaxBytes {
+		return nil, false
+	}
+	return msg, true
+}
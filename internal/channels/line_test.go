@@ -0,0 +1,192 @@
+package channels
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/access"
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+)
+
+// lineAPIServer fakes the Messaging API: profiles, and the reply and push
+// endpoints, whose requests are sent on sent keyed by endpoint.
+func lineAPIServer(t *testing.T, sent chan<- map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			t.Errorf("%s called with %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/profile/"), strings.Contains(r.URL.Path, "/member/"):
+			w.Write([]byte(`{"displayName":"Ana"}`))
+		case r.URL.Path == "/message/reply", r.URL.Path == "/message/push":
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			if r.URL.Path == "/message/reply" && body["replyToken"] == "expired" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"message":"Invalid reply token"}`))
+				return
+			}
+			body["endpoint"] = r.URL.Path
+			sent <- body
+			w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func newTestLINEClient(t *testing.T, api string, allowFrom []string) (*lineClient, *chat.Hub) {
+	hub := chat.NewHub(10)
+	allowed, err := access.NewPolicy(allowFrom, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.LINEConfig{ChannelSecret: "secret", ChannelAccessToken: "tok"}
+	return newLINEClient(context.Background(), hub, cfg, allowed, api+"/"), hub
+}
+
+func postLINEWebhook(c *lineClient, body, secret string) int {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	req := httptest.NewRequest("POST", lineWebhookPath, strings.NewReader(body))
+	req.Header.Set("X-Line-Signature", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	rec := httptest.NewRecorder()
+	c.handleWebhook(rec, req)
+	return rec.Code
+}
+
+func TestLINEWebhook(t *testing.T) {
+	api := lineAPIServer(t, make(chan map[string]interface{}, 4))
+	defer api.Close()
+	c, hub := newTestLINEClient(t, api.URL, []string{"U1"})
+
+	if code := postLINEWebhook(c, `{"events":[]}`, "wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("badly signed request: status %d", code)
+	}
+
+	events := `{"events":[
+		{"type":"message","replyToken":"r1","source":{"type":"group","groupId":"G1","userId":"U1"},"message":{"id":"m1","type":"text","text":"just chatting"}},
+		{"type":"message","replyToken":"r2","source":{"type":"user","userId":"U2"},"message":{"id":"m2","type":"text","text":"psst"}},
+		{"type":"message","replyToken":"r3","source":{"type":"user","userId":"U1"},"message":{"id":"m3","type":"image"}},
+		{"type":"message","replyToken":"r4","source":{"type":"group","groupId":"G1","userId":"U1"},"message":{"id":"m4","type":"text","text":"@🤖 Pico hi there","mention":{"mentionees":[{"index":0,"length":8,"isSelf":true}]}}},
+		{"type":"message","replyToken":"r5","source":{"type":"user","userId":"U1"},"message":{"id":"m5","type":"text","text":"hello"}}
+	]}`
+	if code := postLINEWebhook(c, events, "secret"); code != http.StatusOK {
+		t.Fatalf("webhook status %d", code)
+	}
+	var got []chat.Inbound
+	for len(got) < 2 {
+		select {
+		case in := <-hub.In:
+			got = append(got, in)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout; inbound so far: %+v", got)
+		}
+	}
+	if got[0].ChatID != "G1" || got[0].Content != "hi there" || got[0].SenderName != "Ana" || got[0].Metadata["is_dm"] != false {
+		t.Errorf("group mention = %+v", got[0])
+	}
+	if got[1].ChatID != "U1" || got[1].Content != "hello" || got[1].Metadata["message_id"] != "m5" || got[1].Metadata["is_dm"] != true {
+		t.Errorf("direct message = %+v", got[1])
+	}
+	select {
+	case in := <-hub.In:
+		t.Errorf("unexpected inbound %+v", in)
+	default:
+	}
+
+	// A tap on an offered button comes back as the button's text.
+	c.lineMessages(chat.Outbound{ChatID: "U1", Content: "Pick one", Metadata: map[string]interface{}{
+		"buttons": []chat.Button{{ID: "yes", Text: "Yes please"}},
+	}})
+	postLINEWebhook(c, `{"events":[{"type":"postback","replyToken":"r6","source":{"type":"user","userId":"U1"},"postback":{"data":"yes"}}]}`, "secret")
+	select {
+	case in := <-hub.In:
+		if in.Content != "Yes please" || in.Metadata["button_id"] != "yes" {
+			t.Errorf("postback = %+v", in)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for the postback")
+	}
+}
+
+func TestLINESend(t *testing.T) {
+	sent := make(chan map[string]interface{}, 8)
+	api := lineAPIServer(t, sent)
+	defer api.Close()
+	c, _ := newTestLINEClient(t, api.URL, nil)
+
+	text := func(s string) interface{} { return map[string]string{"type": "text", "text": s} }
+	seven := []interface{}{text("1"), text("2"), text("3"), text("4"), text("5"), text("6"), text("7")}
+
+	// A fresh reply token answers the first batch; the rest is pushed.
+	c.replies["U1"] = lineReplyToken{token: "r1", at: time.Now()}
+	if err := c.send("U1", seven); err != nil {
+		t.Fatal(err)
+	}
+	first, second := <-sent, <-sent
+	if first["endpoint"] != "/message/reply" || first["replyToken"] != "r1" || len(first["messages"].([]interface{})) != 5 {
+		t.Errorf("first batch = %v", first)
+	}
+	if second["endpoint"] != "/message/push" || second["to"] != "U1" || len(second["messages"].([]interface{})) != 2 {
+		t.Errorf("second batch = %v", second)
+	}
+
+	// Stale and refused tokens fall back to pushing.
+	c.replies["U1"] = lineReplyToken{token: "r2", at: time.Now().Add(-time.Minute)}
+	c.send("U1", seven[:1])
+	c.replies["U1"] = lineReplyToken{token: "expired", at: time.Now()}
+	c.send("U1", seven[:1])
+	for i := 0; i < 2; i++ {
+		if got := <-sent; got["endpoint"] != "/message/push" {
+			t.Errorf("send %d went to %v", i+1, got["endpoint"])
+		}
+	}
+}
+
+func TestLINEMessages(t *testing.T) {
+	c, _ := newTestLINEClient(t, "http://unused", nil)
+
+	plain := c.lineMessages(chat.Outbound{ChatID: "U1", Content: "Some **bold** and a [link](https://go.dev).\n- item"})
+	if len(plain) != 1 || plain[0].(map[string]string)["text"] != "Some bold and a link (https://go.dev).\n• item" {
+		t.Errorf("plain text = %v", plain)
+	}
+
+	flex := c.lineMessages(chat.Outbound{ChatID: "U1", Content: "# Plan\nFirst *this*.\n\n- one\n- two\n---\n## Next\nDone."})
+	if len(flex) != 1 {
+		t.Fatalf("structured text = %v", flex)
+	}
+	msg := flex[0].(map[string]interface{})
+	if msg["type"] != "flex" || msg["altText"] != "Plan\nFirst this.\n\n• one\n• two\n---\nNext\nDone." {
+		t.Errorf("flex message = %v", msg)
+	}
+	contents := msg["contents"].(map[string]interface{})["body"].(map[string]interface{})["contents"].([]interface{})
+	var kinds []string
+	for _, c := range contents {
+		kinds = append(kinds, c.(map[string]interface{})["type"].(string))
+	}
+	if strings.Join(kinds, " ") != "text text box box separator text text" {
+		t.Errorf("bubble components = %v", kinds)
+	}
+	if h := contents[0].(map[string]interface{}); h["text"] != "Plan" || h["weight"] != "bold" || h["size"] != "lg" {
+		t.Errorf("heading = %v", h)
+	}
+
+	buttons := c.lineMessages(chat.Outbound{ChatID: "U1", Content: "Continue?", Metadata: map[string]interface{}{
+		"buttons": []chat.Button{{ID: "y", Text: "Yes"}, {ID: "n", Text: "No"}},
+	}})
+	footer := buttons[0].(map[string]interface{})["contents"].(map[string]interface{})["footer"].(map[string]interface{})["contents"].([]interface{})
+	action := footer[1].(map[string]interface{})["action"].(map[string]interface{})
+	if len(footer) != 2 || action["type"] != "postback" || action["data"] != "n" || action["label"] != "No" {
+		t.Errorf("buttons = %v", footer)
+	}
+}
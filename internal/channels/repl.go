@@ -0,0 +1,250 @@
+package channels
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+const (
+	// replChatID is the chat of the terminal: its history is kept across
+	// runs, like any other chat's.
+	replChatID = "local"
+	// replPrompt is shown when the terminal waits for a message.
+	replPrompt = "you> "
+)
+
+// REPL is the interactive terminal channel ("repl") of `picobot repl`: the
+// local user, who is an admin, talks to the agent line by line, and sees
+// replies streamed as they are written, with the tools the agent runs.
+type REPL struct {
+	hub   *chat.Hub
+	outCh <-chan chat.Outbound
+	out   io.Writer
+
+	mu      sync.Mutex
+	editor  *term.Terminal // set while a line is being edited
+	waiting string         // ID of the message whose reply is awaited
+	done    chan struct{}  // closed when that reply has been printed
+	stream  string         // StreamID of the reply being printed
+	shown   string         // text of that reply printed so far
+	midLine bool           // the cursor is not at the start of a line
+}
+
+// NewREPL subscribes the terminal channel to the hub; call it before the
+// hub's router is started.
+func NewREPL(hub *chat.Hub) *REPL {
+	hub.EnableStreaming("repl")
+	hub.EnableToolEvents("repl")
+	return &REPL{hub: hub, outCh: hub.Subscribe("repl")}
+}
+
+// Run reads messages from in and writes what the agent sends to out, until
+// the user quits (/quit, /exit or end of input) or ctx is done. Slash
+// commands go to the agent like any message.
+//
+// When in is a terminal the line is edited in place, with a history (up and
+// down arrows) and tab completion of slash commands; between lines the
+// terminal is left as it was, so Ctrl+C interrupts as usual.
+func (r *REPL) Run(ctx context.Context, in io.Reader, out io.Writer) error {
+	r.out = out
+	var readLine func() (string, error)
+	if f, ok := in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		readLine = r.terminalReader(f, out)
+	} else {
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 64<<10), 1<<20)
+		readLine = func() (string, error) {
+			if !scanner.Scan() {
+				if err := scanner.Err(); err != nil {
+					return "", err
+				}
+				return "", io.EOF
+			}
+			return scanner.Text(), nil
+		}
+	}
+
+	go r.runOutbound(ctx)
+	for n := 1; ; {
+		line, err := readLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		text := strings.TrimSpace(line)
+		switch text {
+		case "":
+			continue
+		case "/quit", "/exit":
+			return nil
+		}
+		id := "r" + strconv.Itoa(n)
+		n++
+		done := r.expect(id)
+		msg := chat.Inbound{
+			Channel:   "repl",
+			SenderID:  "local",
+			ChatID:    replChatID,
+			Content:   text,
+			Timestamp: time.Now(),
+			Metadata:  map[string]interface{}{"message_id": id, "is_dm": true, "admin": true},
+		}
+		select {
+		case r.hub.In <- msg:
+		case <-ctx.Done():
+			return nil
+		}
+		// Wait for the reply before the next prompt, so that piped input
+		// is answered line by line.
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// terminalReader returns a function reading a line from the terminal f,
+// in raw mode while the line is edited.
+func (r *REPL) terminalReader(f *os.File, out io.Writer) func() (string, error) {
+	editor := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{f, out}, replPrompt)
+	editor.AutoCompleteCallback = r.complete
+	return func() (string, error) {
+		state, err := term.MakeRaw(int(f.Fd()))
+		if err != nil {
+			return "", err
+		}
+		defer term.Restore(int(f.Fd()), state)
+		if w, _, err := term.GetSize(int(f.Fd())); err == nil {
+			editor.SetSize(w, 0)
+		}
+		r.mu.Lock()
+		r.editor = editor
+		r.mu.Unlock()
+		defer func() {
+			r.mu.Lock()
+			r.editor = nil
+			r.mu.Unlock()
+		}()
+		return editor.ReadLine()
+	}
+}
+
+// complete completes the slash command being typed on tab.
+func (r *REPL) complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' || !strings.HasPrefix(line, "/") || strings.Contains(line, " ") {
+		return "", 0, false
+	}
+	var matches []string
+	for _, c := range append(r.hub.Commands(), chat.Command{Name: "quit"}) {
+		if strings.HasPrefix("/"+c.Name, line) {
+			matches = append(matches, "/"+c.Name)
+		}
+	}
+	if len(matches) != 1 {
+		return "", 0, false
+	}
+	return matches[0] + " ", len(matches[0]) + 1, true
+}
+
+// expect notes that the reply to message id is awaited, returning a
+// channel closed once it has been printed.
+func (r *REPL) expect(id string) <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.waiting, r.done = id, make(chan struct{})
+	return r.done
+}
+
+// runOutbound prints the agent's messages until ctx is done.
+func (r *REPL) runOutbound(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case out := <-r.outCh:
+			r.print(out)
+		}
+	}
+}
+
+// print writes out to the terminal: partial snapshots as the text they
+// add, tool events on lines of their own.
+func (r *REPL) print(out chat.Outbound) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if ev, ok := out.Metadata["tool_event"].(chat.ToolEvent); ok {
+		line := fmt.Sprintf("  · %s (%s)", ev.Name, ev.Duration.Round(100*time.Millisecond))
+		if ev.Error != "" {
+			line += ": " + ev.Error
+		}
+		r.line(line)
+		return
+	}
+	text := stripHidingMarkers(out.Content, false)
+	if out.StreamID == "" || out.StreamID != r.stream {
+		r.endLine()
+		r.stream, r.shown = out.StreamID, ""
+	}
+	if rest, ok := strings.CutPrefix(text, r.shown); ok {
+		r.write(rest)
+	} else {
+		// A new snapshot replaced the text: the model ran a tool and
+		// started over.
+		r.endLine()
+		r.write(text)
+	}
+	r.shown = text
+	if out.Partial {
+		return
+	}
+	r.endLine()
+	r.stream, r.shown = "", ""
+	if out.ReplyTo != "" && out.ReplyTo == r.waiting {
+		close(r.done)
+		r.waiting = ""
+	}
+}
+
+// line writes s on a line of its own. Called with mu held.
+func (r *REPL) line(s string) {
+	r.endLine()
+	r.write(s + "\n")
+}
+
+// endLine ends the line being written, if any. Called with mu held.
+func (r *REPL) endLine() {
+	if r.midLine {
+		r.write("\n")
+	}
+}
+
+// write writes s, above the prompt while a line is edited. Called with mu
+// held.
+func (r *REPL) write(s string) {
+	if s == "" {
+		return
+	}
+	if r.editor != nil {
+		r.editor.Write([]byte(s))
+	} else {
+		io.WriteString(r.out, s)
+	}
+	r.midLine = !strings.HasSuffix(s, "\n")
+}
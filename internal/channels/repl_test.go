@@ -0,0 +1,53 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+func TestREPLStreamsReplies(t *testing.T) {
+	hub := chat.NewHub(10)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	repl := NewREPL(hub)
+	hub.StartRouter(ctx)
+
+	// A fake agent: it runs a tool, streams the reply, then answers.
+	var got []chat.Inbound
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case in := <-hub.In:
+				got = append(got, in)
+				id := in.MessageID()
+				hub.Out <- chat.Outbound{Channel: "repl", ChatID: in.ChatID, ReplyTo: id,
+					Metadata: map[string]interface{}{"tool_event": chat.ToolEvent{Name: "web", Duration: 1200 * time.Millisecond}}}
+				hub.Out <- chat.Outbound{Channel: "repl", ChatID: in.ChatID, ReplyTo: id, StreamID: id, Content: "Sunny", Partial: true}
+				hub.Out <- chat.Outbound{Channel: "repl", ChatID: in.ChatID, ReplyTo: id, StreamID: id, Content: "Sunny, 24°C"}
+			}
+		}
+	}()
+
+	var out bytes.Buffer
+	in := strings.NewReader("weather?\n\n/usage\n/quit\nnot sent\n")
+	if err := repl.Run(ctx, in, &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Content != "weather?" || got[1].Content != "/usage" {
+		t.Fatalf("inbound = %+v", got)
+	}
+	if got[0].Channel != "repl" || got[0].ChatID != "local" || !got[0].IsAdmin() || got[0].MessageID() == got[1].MessageID() {
+		t.Fatalf("unexpected inbound: %+v", got[0])
+	}
+	want := "  · web (1.2s)\nSunny, 24°C\n"
+	if out.String() != want+want {
+		t.Fatalf("output = %q, want %q twice", out.String(), want)
+	}
+}
@@ -0,0 +1,499 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/local/picobot/internal/access"
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/useragent"
+)
+
+// rocketChatMaxLen is Rocket.Chat's default message size limit
+// (Message_MaxAllowedSize).
+const rocketChatMaxLen = 5000
+
+// StartRocketChat runs picobot as a bot user of the Rocket.Chat server at
+// cfg.ServerURL: messages arrive over the realtime API (DDP over a
+// websocket), and replies are posted with the REST API. Direct messages are
+// always answered; in channels the bot answers when mentioned, in a thread,
+// and then follows that thread, remembered in cfg.StatePath. A token got by
+// logging in with a password is renewed when the server expires it.
+// cfg.AllowFrom restricts which users (by ID
+// or "@username") may send messages; empty means allow all.
+func StartRocketChat(ctx context.Context, hub *chat.Hub, cfg config.RocketChatConfig) error {
+	if cfg.ServerURL == "" {
+		return fmt.Errorf("rocketchat serverURL is required")
+	}
+	if (cfg.UserID == "" || cfg.AuthToken == "") && (cfg.Username == "" || cfg.Password == "") {
+		return fmt.Errorf("rocketchat needs userID and authToken, or username and password")
+	}
+	allowed, err := access.NewPolicy(cfg.AllowFrom, cfg.Deny)
+	if err != nil {
+		return fmt.Errorf("rocketchat allowFrom: %w", err)
+	}
+
+	c := newRocketChatClient(ctx, hub, cfg, allowed)
+	if c.statePath != "" {
+		if err := c.threads.load(c.statePath); err != nil {
+			log.Printf("rocketchat: reading %s: %v", c.statePath, err)
+		}
+	}
+	if err := c.login(cfg); err != nil {
+		return fmt.Errorf("rocketchat login: %w", err)
+	}
+	log.Printf("rocketchat: logged in to %s as @%s", c.base, c.botName)
+
+	go c.runSocket()
+	go c.runOutbound()
+	return nil
+}
+
+// rocketChatClient talks to one Rocket.Chat server as one bot user.
+type rocketChatClient struct {
+	base    string // server URL, without a trailing slash
+	hub     *chat.Hub
+	outCh   <-chan chat.Outbound
+	allowed *access.Policy
+	ctx     context.Context
+	http    *http.Client
+
+	// username and password log in again when the server expires the
+	// token they got; both are empty with a personal access token.
+	username string
+	password string
+
+	// Set by login, and again when the token is renewed (guarded by mu).
+	mu      sync.Mutex
+	userID  string
+	token   string
+	botName string
+
+	threads   *followedThreads // "rid:tmid" of channel threads the bot takes part in
+	statePath string           // where threads is kept; empty keeps it in memory
+}
+
+func newRocketChatClient(ctx context.Context, hub *chat.Hub, cfg config.RocketChatConfig, allowed *access.Policy) *rocketChatClient {
+	return &rocketChatClient{
+		base:    strings.TrimRight(cfg.ServerURL, "/"),
+		hub:     hub,
+		outCh:   hub.Subscribe("rocketchat"),
+		allowed: allowed,
+		ctx:     ctx,
+		http:    &http.Client{Timeout: 30 * time.Second},
+
+		threads:   newFollowedThreads(),
+		statePath: cfg.StatePath,
+	}
+}
+
+// errRocketChatUnauthorized is returned by rest when the server refuses
+// the auth token, as it does once the token expires.
+var errRocketChatUnauthorized = errors.New("unauthorized")
+
+// auth returns the user ID and auth token requests are sent with.
+func (c *rocketChatClient) auth() (userID, token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.userID, c.token
+}
+
+// renew logs in with the password again when the token that failed is
+// still the current one, so requests failing together log in once.
+func (c *rocketChatClient) renew(failed string) error {
+	if c.password == "" {
+		return fmt.Errorf("the auth token was refused; create a new personal access token")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != failed {
+		return nil
+	}
+	log.Printf("rocketchat: auth token expired, logging in again")
+	return c.passwordLogin()
+}
+
+// rest calls a REST API endpoint (under /api/v1/) with a JSON body, or a
+// GET without one, and decodes the response into result, which may be nil.
+// A request refused for an expired token is sent again with a new one.
+func (c *rocketChatClient) rest(endpoint string, body, result interface{}) error {
+	userID, token := c.auth()
+	err := c.restAs(userID, token, endpoint, body, result)
+	if !errors.Is(err, errRocketChatUnauthorized) || token == "" {
+		return err
+	}
+	if err := c.renew(token); err != nil {
+		return fmt.Errorf("%s: %w", endpoint, err)
+	}
+	userID, token = c.auth()
+	return c.restAs(userID, token, endpoint, body, result)
+}
+
+// restAs makes one REST API call with the given credentials, or none when
+// token is empty.
+func (c *rocketChatClient) restAs(userID, token, endpoint string, body, result interface{}) error {
+	method := http.MethodGet
+	var payload []byte
+	if body != nil {
+		method = http.MethodPost
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(c.ctx, method, c.base+"/api/v1/"+endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", useragent.Get())
+	if token != "" {
+		req.Header.Set("X-Auth-Token", token)
+		req.Header.Set("X-User-Id", userID)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var raw json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return fmt.Errorf("%s: %s", endpoint, resp.Status)
+	}
+	var status struct {
+		Success *bool  `json:"success"`
+		Status  string `json:"status"`
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	json.Unmarshal(raw, &status)
+	if resp.StatusCode >= 300 || (status.Success != nil && !*status.Success) || status.Status == "error" {
+		msg := status.Error
+		if msg == "" {
+			msg = status.Message
+		}
+		if msg == "" {
+			msg = resp.Status
+		}
+		if resp.StatusCode == http.StatusUnauthorized && token != "" {
+			return fmt.Errorf("%s: %s: %w", endpoint, msg, errRocketChatUnauthorized)
+		}
+		return fmt.Errorf("%s: %s", endpoint, msg)
+	}
+	if result != nil {
+		return json.Unmarshal(raw, result)
+	}
+	return nil
+}
+
+// login authenticates with a personal access token (cfg.UserID and
+// cfg.AuthToken) or, without one, with the bot's username and password,
+// and learns the bot's username.
+func (c *rocketChatClient) login(cfg config.RocketChatConfig) error {
+	if cfg.UserID != "" && cfg.AuthToken != "" {
+		var me struct {
+			Username string `json:"username"`
+		}
+		if err := c.restAs(cfg.UserID, cfg.AuthToken, "me", nil, &me); err != nil {
+			return err
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.userID, c.token, c.botName = cfg.UserID, cfg.AuthToken, me.Username
+		return nil
+	}
+	c.username, c.password = cfg.Username, cfg.Password
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.passwordLogin()
+}
+
+// passwordLogin logs in with the bot's username and password. Called with
+// mu held.
+func (c *rocketChatClient) passwordLogin() error {
+	var resp struct {
+		Data struct {
+			UserID    string `json:"userId"`
+			AuthToken string `json:"authToken"`
+			Me        struct {
+				Username string `json:"username"`
+			} `json:"me"`
+		} `json:"data"`
+	}
+	if err := c.restAs("", "", "login", map[string]string{"user": c.username, "password": c.password}, &resp); err != nil {
+		return err
+	}
+	c.userID, c.token, c.botName = resp.Data.UserID, resp.Data.AuthToken, resp.Data.Me.Username
+	if c.botName == "" {
+		c.botName = c.username
+	}
+	return nil
+}
+
+// runSocket keeps a realtime API connection open until the context ends,
+// reconnecting whenever it drops.
+func (c *rocketChatClient) runSocket() {
+	backoff := time.Second
+	for {
+		start := time.Now()
+		err := c.serveSocket()
+		if c.ctx.Err() != nil {
+			return
+		}
+		if time.Since(start) > time.Minute {
+			backoff = time.Second
+		}
+		log.Printf("rocketchat: realtime API: %v; reconnecting in %v", err, backoff)
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, time.Minute)
+	}
+}
+
+// ddpMessage is a message of the DDP protocol the realtime API speaks.
+type ddpMessage struct {
+	Msg        string          `json:"msg"`
+	ID         string          `json:"id,omitempty"`
+	Collection string          `json:"collection,omitempty"`
+	Fields     json.RawMessage `json:"fields,omitempty"`
+	Error      *struct {
+		Reason  string `json:"reason"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// rocketChatMessage is the part of a room message picobot uses.
+type rocketChatMessage struct {
+	ID   string `json:"_id"`
+	RID  string `json:"rid"`
+	Msg  string `json:"msg"`
+	TMID string `json:"tmid"` // thread the message is part of
+	T    string `json:"t"`    // set for system messages (joins, topic changes, ...)
+	U    struct {
+		ID       string `json:"_id"`
+		Username string `json:"username"`
+		Name     string `json:"name"`
+	} `json:"u"`
+	Mentions []struct {
+		Username string `json:"username"`
+	} `json:"mentions"`
+	EditedAt    json.RawMessage `json:"editedAt"`
+	Attachments []struct {
+		Title     string `json:"title"`
+		TitleLink string `json:"title_link"`
+	} `json:"attachments"`
+}
+
+// rocketChatRoom describes the room of a message streamed from
+// __my_messages__.
+type rocketChatRoom struct {
+	RoomType string `json:"roomType"` // d (direct), c (channel), p (private group)
+}
+
+// serveSocket opens one realtime API connection, logs in with the auth
+// token and streams the messages of every room the bot is in until the
+// connection ends.
+func (c *rocketChatClient) serveSocket() error {
+	_, token := c.auth()
+	wsURL := "ws" + strings.TrimPrefix(c.base, "http") + "/websocket"
+	header := http.Header{"User-Agent": {useragent.Get()}}
+	conn, _, err := websocket.DefaultDialer.DialContext(c.ctx, wsURL, header)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(c.ctx, func() { conn.Close() })
+	defer stop()
+
+	send := []interface{}{
+		map[string]interface{}{"msg": "connect", "version": "1", "support": []string{"1"}},
+		map[string]interface{}{"msg": "method", "method": "login", "id": "login", "params": []interface{}{map[string]string{"resume": token}}},
+		map[string]interface{}{"msg": "sub", "id": "messages", "name": "stream-room-messages", "params": []interface{}{"__my_messages__", false}},
+	}
+	for _, m := range send {
+		if err := conn.WriteJSON(m); err != nil {
+			return err
+		}
+	}
+	for {
+		var m ddpMessage
+		if err := conn.ReadJSON(&m); err != nil {
+			return err
+		}
+		switch m.Msg {
+		case "ping":
+			if err := conn.WriteJSON(map[string]string{"msg": "pong"}); err != nil {
+				return err
+			}
+		case "result", "nosub":
+			if m.Error != nil {
+				err := fmt.Errorf("%s: %s", m.ID, m.Error.Reason+m.Error.Message)
+				if m.ID == "login" {
+					// The token expired: reconnect with a new one.
+					if rerr := c.renew(token); rerr != nil {
+						err = fmt.Errorf("%w (%v)", err, rerr)
+					}
+				}
+				return err
+			}
+		case "changed":
+			if m.Collection != "stream-room-messages" {
+				continue
+			}
+			var f struct {
+				Args []json.RawMessage `json:"args"`
+			}
+			if err := json.Unmarshal(m.Fields, &f); err != nil || len(f.Args) == 0 {
+				continue
+			}
+			var msg rocketChatMessage
+			var room rocketChatRoom
+			if err := json.Unmarshal(f.Args[0], &msg); err != nil {
+				log.Printf("rocketchat: bad message: %v", err)
+				continue
+			}
+			if len(f.Args) > 1 {
+				json.Unmarshal(f.Args[1], &room)
+			}
+			c.handleMessage(msg, room)
+		}
+	}
+}
+
+// handleMessage turns a room message into an inbound message. Direct
+// messages are always answered; in channels the bot answers when
+// mentioned, and then follows the thread it replied in.
+func (c *rocketChatClient) handleMessage(m rocketChatMessage, room rocketChatRoom) {
+	c.mu.Lock()
+	userID, botName := c.userID, c.botName
+	c.mu.Unlock()
+	if m.T != "" || m.U.ID == "" || m.U.ID == userID || (len(m.EditedAt) > 0 && string(m.EditedAt) != "null") {
+		return
+	}
+	mentioned := false
+	for _, u := range m.Mentions {
+		mentioned = mentioned || strings.EqualFold(u.Username, botName)
+	}
+	isDM := room.RoomType == "d"
+	var chatID string
+	switch {
+	case isDM:
+		chatID = m.RID
+		if m.TMID != "" {
+			chatID += ":" + m.TMID
+		}
+	case mentioned:
+		thread := m.TMID
+		if thread == "" {
+			thread = m.ID
+		}
+		chatID = m.RID + ":" + thread
+		c.threads.follow(chatID)
+		if c.statePath != "" {
+			if err := c.threads.save(c.statePath); err != nil {
+				log.Printf("rocketchat: saving %s: %v", c.statePath, err)
+			}
+		}
+	default:
+		if m.TMID == "" {
+			return
+		}
+		chatID = m.RID + ":" + m.TMID
+		if !c.threads.touch(chatID) {
+			return
+		}
+	}
+
+	if c.allowed != nil && !c.allowed.Allowed(m.U.ID, "@"+m.U.Username) {
+		log.Printf("rocketchat: dropped message from unauthorised user @%s (%s)", m.U.Username, m.U.ID)
+		return
+	}
+
+	content := strings.TrimSpace(strings.ReplaceAll(m.Msg, "@"+botName, ""))
+	for _, a := range m.Attachments {
+		if a.TitleLink != "" {
+			content += fmt.Sprintf("\n[attachment %s: %s]", a.Title, c.base+a.TitleLink)
+		}
+	}
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return
+	}
+	name := m.U.Name
+	if name == "" {
+		name = m.U.Username
+	}
+	log.Printf("rocketchat: message from @%s in %s: %s", m.U.Username, chatID, truncate(content, 50))
+
+	c.hub.In <- chat.Inbound{
+		Channel:    "rocketchat",
+		SenderID:   m.U.ID,
+		SenderName: name,
+		ChatID:     chatID,
+		Content:    content,
+		Timestamp:  time.Now(),
+		Metadata: map[string]interface{}{
+			"message_id": m.ID,
+			"username":   m.U.Username,
+			"room_id":    m.RID,
+			"is_dm":      isDM,
+		},
+	}
+}
+
+// runOutbound reads replies from the hub's rocketchat subscription and
+// posts them in the room (and thread) of their chat ID.
+func (c *rocketChatClient) runOutbound() {
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case out := <-c.outCh:
+			rid, thread, _ := strings.Cut(out.ChatID, ":")
+			chunks := splitMessage(stripHidingMarkers(out.Content, false), rocketChatMaxLen)
+			// Each chunk keeps its ID across attempts: Rocket.Chat refuses a
+			// retry of a chunk that did arrive instead of posting it twice.
+			ids := make([]string, len(chunks))
+			for i := range ids {
+				ids[i] = rocketChatID()
+			}
+			tried := make([]bool, len(chunks))
+			sendChunks(c.ctx, c.hub, out, chunks, func(i int, chunk string) error {
+				msg := map[string]string{"_id": ids[i], "rid": rid, "msg": chunk}
+				if thread != "" {
+					msg["tmid"] = thread
+				}
+				err := c.rest("chat.sendMessage", map[string]interface{}{"message": msg}, nil)
+				if err != nil && tried[i] && strings.Contains(strings.ToLower(err.Error()), "duplicate") {
+					return nil // an earlier attempt posted it
+				}
+				tried[i] = true
+				return err
+			})
+		}
+	}
+}
+
+// rocketChatID returns a new random message ID. runOutbound gives one to
+// each chunk and keeps it across attempts, which is what lets the server
+// refuse a retry of a chunk that already arrived.
+func rocketChatID() string {
+	b := make([]byte, 9)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,209 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+)
+
+func TestStartRocketChat(t *testing.T) {
+	posts := make(chan map[string]string, 4)
+	messages := []string{
+		// A channel message without a mention is ignored...
+		`[{"_id":"m1","rid":"R1","msg":"just chatting","u":{"_id":"U1","username":"ana","name":"Ana"}},{"roomType":"c"}]`,
+		// ...as are the bot's own messages...
+		`[{"_id":"m2","rid":"R1","msg":"@ana hello","u":{"_id":"BOT","username":"picobot"}},{"roomType":"c"}]`,
+		// ...a mention starts a thread...
+		`[{"_id":"m3","rid":"R1","msg":"@picobot hi","mentions":[{"username":"picobot"}],"u":{"_id":"U1","username":"ana","name":"Ana"}},{"roomType":"c"}]`,
+		// ...replies in that thread are followed...
+		`[{"_id":"m4","rid":"R1","tmid":"m3","msg":"and then?","u":{"_id":"U1","username":"ana","name":"Ana"}},{"roomType":"c"}]`,
+		// ...and direct messages are always answered, from allowed users.
+		`[{"_id":"m5","rid":"D1","msg":"psst","u":{"_id":"U2","username":"bob"}},{"roomType":"d"}]`,
+		`[{"_id":"m6","rid":"D2","msg":"in private","u":{"_id":"U1","username":"ana","name":"Ana"}},{"roomType":"d"}]`,
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/login":
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			if body["user"] != "picobot" || body["password"] != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"status":"error","message":"Unauthorized"}`))
+				return
+			}
+			w.Write([]byte(`{"status":"success","data":{"userId":"BOT","authToken":"tok","me":{"username":"picobot"}}}`))
+		case "/websocket":
+			conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+			if err != nil {
+				t.Errorf("upgrade: %v", err)
+				return
+			}
+			defer conn.Close()
+			for {
+				var m map[string]interface{}
+				if err := conn.ReadJSON(&m); err != nil {
+					return
+				}
+				switch m["msg"] {
+				case "connect":
+					conn.WriteJSON(map[string]string{"msg": "connected", "session": "s1"})
+				case "method":
+					params, _ := json.Marshal(m["params"])
+					if string(params) != `[{"resume":"tok"}]` {
+						t.Errorf("login params = %s", params)
+					}
+					conn.WriteJSON(map[string]interface{}{"msg": "result", "id": m["id"], "result": map[string]string{"id": "BOT"}})
+				case "sub":
+					conn.WriteJSON(map[string]string{"msg": "ping"})
+					for _, args := range messages {
+						conn.WriteJSON(map[string]interface{}{
+							"msg":        "changed",
+							"collection": "stream-room-messages",
+							"id":         "id",
+							"fields":     json.RawMessage(`{"eventName":"__my_messages__","args":` + args + `}`),
+						})
+					}
+				case "pong":
+				}
+			}
+		case "/api/v1/chat.sendMessage":
+			if r.Header.Get("X-Auth-Token") != "tok" || r.Header.Get("X-User-Id") != "BOT" {
+				t.Errorf("sent with token %q, user %q", r.Header.Get("X-Auth-Token"), r.Header.Get("X-User-Id"))
+			}
+			var body struct {
+				Message map[string]string `json:"message"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			posts <- body.Message
+			w.Write([]byte(`{"success":true}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	hub := chat.NewHub(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg := config.RocketChatConfig{ServerURL: srv.URL + "/", Username: "picobot", Password: "secret", AllowFrom: []string{"@ana"}}
+	if err := StartRocketChat(ctx, hub, cfg); err != nil {
+		t.Fatalf("StartRocketChat: %v", err)
+	}
+	hub.StartRouter(ctx)
+
+	want := []struct{ content, chatID string }{
+		{"hi", "R1:m3"},
+		{"and then?", "R1:m3"},
+		{"in private", "D2"},
+	}
+	for _, w := range want {
+		select {
+		case msg := <-hub.In:
+			if msg.Content != w.content || msg.ChatID != w.chatID || msg.SenderName != "Ana" {
+				t.Fatalf("inbound = %+v, want %q in %s from Ana", msg, w.content, w.chatID)
+			}
+			if isDM, _ := msg.Metadata["is_dm"].(bool); isDM != (w.chatID == "D2") {
+				t.Fatalf("is_dm = %v for %s", isDM, w.chatID)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout waiting for %q", w.content)
+		}
+	}
+
+	hub.Out <- chat.Outbound{Channel: "rocketchat", ChatID: "R1:m3", Content: "||done||"}
+	select {
+	case msg := <-posts:
+		if msg["rid"] != "R1" || msg["tmid"] != "m3" || msg["msg"] != "done" || msg["_id"] == "" {
+			t.Fatalf("sent %v", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for chat.sendMessage")
+	}
+}
+
+func TestStartRocketChatBadLogin(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"status":"error","message":"Unauthorized"}`))
+	}))
+	defer srv.Close()
+
+	cfg := config.RocketChatConfig{ServerURL: srv.URL, Username: "picobot", Password: "wrong"}
+	err := StartRocketChat(context.Background(), chat.NewHub(1), cfg)
+	if err == nil || err.Error() != "rocketchat login: login: Unauthorized" {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestRocketChatRenewsExpiredToken(t *testing.T) {
+	logins := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/login":
+			logins++
+			fmt.Fprintf(w, `{"status":"success","data":{"userId":"BOT","authToken":"tok%d","me":{"username":"picobot"}}}`, logins)
+		case "/api/v1/chat.sendMessage":
+			if r.Header.Get("X-Auth-Token") != "tok2" {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"status":"error","message":"You must be logged in to do this."}`))
+				return
+			}
+			w.Write([]byte(`{"success":true}`))
+		}
+	}))
+	defer srv.Close()
+
+	cfg := config.RocketChatConfig{ServerURL: srv.URL, Username: "picobot", Password: "secret"}
+	c := newRocketChatClient(context.Background(), chat.NewHub(1), cfg, nil)
+	if err := c.login(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.rest("chat.sendMessage", map[string]interface{}{"message": map[string]string{"rid": "R1", "msg": "hi"}}, nil); err != nil {
+		t.Fatalf("send with an expired token: %v", err)
+	}
+	if logins != 2 {
+		t.Errorf("logged in %d times, want 2", logins)
+	}
+}
+
+func TestRocketChatKeepsFollowedThreads(t *testing.T) {
+	hub := chat.NewHub(10)
+	cfg := config.RocketChatConfig{ServerURL: "http://chat.invalid", StatePath: filepath.Join(t.TempDir(), "rocketchat-state.json")}
+	mention := rocketChatMessage{ID: "m1", RID: "R1", Msg: "@picobot hi"}
+	mention.U.ID, mention.U.Username = "U1", "ana"
+	mention.Mentions = append(mention.Mentions, struct {
+		Username string `json:"username"`
+	}{"picobot"})
+	c := newRocketChatClient(context.Background(), hub, cfg, nil)
+	c.botName = "picobot"
+	c.handleMessage(mention, rocketChatRoom{RoomType: "c"})
+	<-hub.In
+
+	// After a restart, replies in the thread are still followed.
+	c = newRocketChatClient(context.Background(), hub, cfg, nil)
+	c.botName = "picobot"
+	if err := c.threads.load(cfg.StatePath); err != nil {
+		t.Fatal(err)
+	}
+	reply := rocketChatMessage{ID: "m2", RID: "R1", TMID: "m1", Msg: "and then?"}
+	reply.U.ID, reply.U.Username = "U1", "ana"
+	c.handleMessage(reply, rocketChatRoom{RoomType: "c"})
+	select {
+	case msg := <-hub.In:
+		if msg.ChatID != "R1:m1" {
+			t.Fatalf("chat ID = %q", msg.ChatID)
+		}
+	default:
+		t.Fatal("reply in a followed thread was dropped after a restart")
+	}
+}
@@ -0,0 +1,375 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/local/picobot/internal/access"
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/useragent"
+)
+
+// slackAPI is the base URL of the Slack Web API.
+const slackAPI = "https://slack.com/api/"
+
+// slackMaxLen is the length Slack recommends keeping a message's text under.
+const slackMaxLen = 4000
+
+// StartSlack connects a Slack app over Socket Mode, so the gateway needs no
+// public endpoint: cfg.AppToken opens the socket events arrive on, and
+// cfg.BotToken posts the replies. Each Slack thread is a chat of its own.
+// cfg.AllowFrom restricts which Slack users (by member ID or "@handle", the
+// account's username, not its editable display name) may send messages;
+// empty means allow all.
+func StartSlack(ctx context.Context, hub *chat.Hub, cfg config.SlackConfig) error {
+	return startSlackWithBase(ctx, hub, slackAPI, cfg)
+}
+
+// startSlackWithBase starts the Slack channel against the Web API at base
+// (a test server in tests).
+func startSlackWithBase(ctx context.Context, hub *chat.Hub, base string, cfg config.SlackConfig) error {
+	if cfg.AppToken == "" || cfg.BotToken == "" {
+		return fmt.Errorf("slack appToken and botToken are both required")
+	}
+	allowed, err := access.NewPolicy(cfg.AllowFrom, cfg.Deny)
+	if err != nil {
+		return fmt.Errorf("slack allowFrom: %w", err)
+	}
+
+	c := newSlackClient(ctx, hub, base, cfg, allowed)
+	var auth struct {
+		UserID string `json:"user_id"`
+		User   string `json:"user"`
+		Team   string `json:"team"`
+	}
+	if err := c.call("auth.test", cfg.BotToken, nil, &auth); err != nil {
+		return fmt.Errorf("slack auth.test: %w", err)
+	}
+	c.botID = auth.UserID
+	log.Printf("slack: connected as %s (%s) in %s", auth.User, auth.UserID, auth.Team)
+
+	go c.runSocket()
+	go c.runOutbound()
+	return nil
+}
+
+// slackClient talks to Slack for a single app.
+type slackClient struct {
+	base     string
+	appToken string
+	botToken string
+	hub      *chat.Hub
+	outCh    <-chan chat.Outbound
+	allowed  *access.Policy
+	ctx      context.Context
+	http     *http.Client
+	botID    string // the bot's user ID, to recognise its mentions
+
+	mu      sync.Mutex
+	users   map[string]slackUser // by user ID
+	threads *followedThreads     // "channel:thread_ts" of channel threads the bot takes part in
+}
+
+// slackUser is how a Slack user is known: Handle, the account's username,
+// for allowFrom, and Name, the display name, for the agent.
+type slackUser struct {
+	Handle string
+	Name   string
+}
+
+func newSlackClient(ctx context.Context, hub *chat.Hub, base string, cfg config.SlackConfig, allowed *access.Policy) *slackClient {
+	return &slackClient{
+		base:     base,
+		appToken: cfg.AppToken,
+		botToken: cfg.BotToken,
+		hub:      hub,
+		outCh:    hub.Subscribe("slack"),
+		allowed:  allowed,
+		ctx:      ctx,
+		http:     &http.Client{Timeout: 30 * time.Second},
+		users:    make(map[string]slackUser),
+		threads:  newFollowedThreads(),
+	}
+}
+
+// call invokes a Web API method with a JSON body (nil for none) and decodes
+// the response into result, which may be nil.
+func (c *slackClient) call(method, token string, body, result interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodPost, c.base+method, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("User-Agent", useragent.Get())
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var raw json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return fmt.Errorf("%s: %s", method, resp.Status)
+	}
+	var status struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &status); err != nil {
+		return err
+	}
+	if !status.OK {
+		return fmt.Errorf("%s: %s", method, status.Error)
+	}
+	if result != nil {
+		return json.Unmarshal(raw, result)
+	}
+	return nil
+}
+
+// runSocket keeps a Socket Mode connection open until the context ends,
+// reconnecting whenever Slack closes it or it drops.
+func (c *slackClient) runSocket() {
+	backoff := time.Second
+	for {
+		start := time.Now()
+		err := c.serveSocket()
+		if c.ctx.Err() != nil {
+			return
+		}
+		if time.Since(start) > time.Minute {
+			backoff = time.Second
+		}
+		if err != nil {
+			log.Printf("slack: socket: %v; reconnecting in %v", err, backoff)
+		}
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, time.Minute)
+	}
+}
+
+// slackEnvelope is a Socket Mode message.
+type slackEnvelope struct {
+	EnvelopeID string          `json:"envelope_id"`
+	Type       string          `json:"type"` // hello, events_api, disconnect, ...
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// slackEvent is the part of an Events API message or app_mention event
+// picobot uses.
+type slackEvent struct {
+	Type        string `json:"type"`
+	Subtype     string `json:"subtype"`
+	User        string `json:"user"`
+	BotID       string `json:"bot_id"`
+	Text        string `json:"text"`
+	Channel     string `json:"channel"`
+	ChannelType string `json:"channel_type"` // im, channel, group, mpim
+	TS          string `json:"ts"`
+	ThreadTS    string `json:"thread_ts"`
+	Files       []struct {
+		Name       string `json:"name"`
+		URLPrivate string `json:"url_private"`
+	} `json:"files"`
+}
+
+// serveSocket opens one Socket Mode connection and handles its envelopes
+// until it ends. A nil error means Slack asked to reconnect.
+func (c *slackClient) serveSocket() error {
+	var open struct {
+		URL string `json:"url"`
+	}
+	if err := c.call("apps.connections.open", c.appToken, nil, &open); err != nil {
+		return err
+	}
+	header := http.Header{"User-Agent": {useragent.Get()}}
+	conn, _, err := websocket.DefaultDialer.DialContext(c.ctx, open.URL, header)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(c.ctx, func() { conn.Close() })
+	defer stop()
+
+	for {
+		var env slackEnvelope
+		if err := conn.ReadJSON(&env); err != nil {
+			return err
+		}
+		if env.EnvelopeID != "" {
+			// Acknowledge first: Slack redelivers what is not acknowledged
+			// within 3 seconds.
+			if err := conn.WriteJSON(map[string]string{"envelope_id": env.EnvelopeID}); err != nil {
+				return err
+			}
+		}
+		switch env.Type {
+		case "disconnect":
+			return nil
+		case "events_api":
+			var p struct {
+				Event slackEvent `json:"event"`
+			}
+			if err := json.Unmarshal(env.Payload, &p); err != nil {
+				log.Printf("slack: bad event: %v", err)
+				continue
+			}
+			c.handleEvent(p.Event)
+		}
+	}
+}
+
+// handleEvent turns a message into an inbound message. Direct messages are
+// always answered; in channels the bot answers when mentioned, and then
+// follows the thread it replied in.
+func (c *slackClient) handleEvent(ev slackEvent) {
+	if ev.Type != "message" && ev.Type != "app_mention" {
+		return
+	}
+	if (ev.Subtype != "" && ev.Subtype != "file_share") || ev.BotID != "" || ev.User == "" || ev.User == c.botID {
+		return
+	}
+	mention := "<@" + c.botID + ">"
+	isDM := ev.ChannelType == "im"
+	var chatID string
+	switch {
+	case isDM:
+		if ev.Type != "message" {
+			return
+		}
+		chatID = ev.Channel
+		if ev.ThreadTS != "" {
+			chatID += ":" + ev.ThreadTS
+		}
+	case ev.Type == "app_mention":
+		thread := ev.ThreadTS
+		if thread == "" {
+			thread = ev.TS
+		}
+		chatID = ev.Channel + ":" + thread
+		c.threads.follow(chatID)
+	default:
+		// A reply in a thread the bot follows; a mention in it arrives as
+		// an app_mention as well.
+		if ev.ThreadTS == "" || strings.Contains(ev.Text, mention) {
+			return
+		}
+		chatID = ev.Channel + ":" + ev.ThreadTS
+		if !c.threads.touch(chatID) {
+			return
+		}
+	}
+
+	user := c.user(ev.User)
+	name := user.Name
+	// Display names can be changed by anyone to anything, so only the ID and
+	// handle are matched.
+	if c.allowed != nil && !c.allowed.Allowed(ev.User, "@"+user.Handle) {
+		log.Printf("slack: dropped message from unauthorised user %s (%s)", name, ev.User)
+		return
+	}
+
+	content := strings.TrimSpace(html.UnescapeString(strings.ReplaceAll(ev.Text, mention, "")))
+	for _, f := range ev.Files {
+		content += fmt.Sprintf("\n[attachment: %s]", f.URLPrivate)
+	}
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return
+	}
+	log.Printf("slack: message from %s (%s) in %s: %s", name, ev.User, chatID, truncate(content, 50))
+
+	c.hub.In <- chat.Inbound{
+		Channel:    "slack",
+		SenderID:   ev.User,
+		SenderName: name,
+		ChatID:     chatID,
+		Content:    content,
+		Timestamp:  time.Now(),
+		Metadata: map[string]interface{}{
+			"message_id": ev.TS,
+			"username":   name,
+			"channel_id": ev.Channel,
+			"is_dm":      isDM,
+		},
+	}
+}
+
+// user returns the handle and display name of a Slack user, looked up once
+// with users.info; they are empty when the lookup fails.
+func (c *slackClient) user(id string) slackUser {
+	c.mu.Lock()
+	u, ok := c.users[id]
+	c.mu.Unlock()
+	if ok {
+		return u
+	}
+	var info struct {
+		User struct {
+			Name    string `json:"name"`
+			Profile struct {
+				DisplayName string `json:"display_name"`
+				RealName    string `json:"real_name"`
+			} `json:"profile"`
+		} `json:"user"`
+	}
+	if err := c.call("users.info?user="+url.QueryEscape(id), c.botToken, nil, &info); err != nil {
+		log.Printf("slack: %v", err)
+		return slackUser{}
+	}
+	u.Handle = info.User.Name
+	switch {
+	case info.User.Profile.DisplayName != "":
+		u.Name = info.User.Profile.DisplayName
+	case info.User.Profile.RealName != "":
+		u.Name = info.User.Profile.RealName
+	default:
+		u.Name = info.User.Name
+	}
+	c.mu.Lock()
+	c.users[id] = u
+	c.mu.Unlock()
+	return u
+}
+
+// runOutbound reads replies from the hub's slack subscription and posts
+// them in the conversation (and thread) of their chat ID.
+func (c *slackClient) runOutbound() {
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case out := <-c.outCh:
+			channel, thread, _ := strings.Cut(out.ChatID, ":")
+			sendChunks(c.ctx, c.hub, out, splitMessage(formatSlack(out.Content), slackMaxLen), func(_ int, chunk string) error {
+				msg := map[string]interface{}{"channel": channel, "text": chunk}
+				if thread != "" {
+					msg["thread_ts"] = thread
+				}
+				return c.call("chat.postMessage", c.botToken, msg, nil)
+			})
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package channels
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	slackLinkRE    = regexp.MustCompile(`!?\[([^\]\n]+)\]\(([^)\s]+)\)`)
+	slackBoldRE    = regexp.MustCompile(`\*\*([^*\n]+)\*\*|__([^_\n]+)__`)
+	slackItalicRE  = regexp.MustCompile(`\*([^*\s](?:[^*\n]*[^*\s])?)\*`)
+	slackStrikeRE  = regexp.MustCompile(`~~([^~\n]+)~~`)
+	slackBulletRE  = regexp.MustCompile(`^(\s*)[-*+]\s+`)
+	slackEscapeMap = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+)
+
+// formatSlack renders the Markdown an LLM typically produces as Slack
+// mrkdwn: bold becomes *bold*, italic _italic_, strikethrough ~struck~,
+// links <url|text>, headings bold lines and bullets •. Code keeps its
+// backticks but loses the language of its fence, which Slack would show.
+// &, < and > are escaped, as Slack requires. Spoilers and expandable
+// quotes, which Slack lacks, are shown as plain text.
+func formatSlack(s string) string {
+	s = stripHidingMarkers(strings.ReplaceAll(s, "\r\n", "\n"), false)
+	var b strings.Builder
+	lines := strings.Split(s, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			var code []string
+			for i++; i < len(lines) && strings.TrimSpace(lines[i]) != "```"; i++ {
+				code = append(code, lines[i])
+			}
+			b.WriteString("```\n")
+			b.WriteString(slackEscapeMap.Replace(strings.Join(code, "\n")))
+			b.WriteString("\n```")
+		} else {
+			b.WriteString(formatSlackLine(line))
+		}
+		if i < len(lines)-1 {
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// formatSlackLine formats the inline markup of one line outside code blocks.
+func formatSlackLine(line string) string {
+	// Inline code is set aside first so its content is not formatted.
+	var codes []string
+	line = htmlInlineCodeRE.ReplaceAllStringFunc(line, func(m string) string {
+		codes = append(codes, slackEscapeMap.Replace(m))
+		return fmt.Sprintf("\x00%d\x00", len(codes)-1)
+	})
+
+	if m := htmlHeadingRE.FindStringSubmatch(line); m != nil {
+		line = "**" + strings.Trim(m[1], "*") + "**"
+	}
+	line = slackBulletRE.ReplaceAllString(line, "$1• ")
+
+	// Links are set aside too, so their URLs are not formatted.
+	line = slackLinkRE.ReplaceAllStringFunc(line, func(m string) string {
+		sub := slackLinkRE.FindStringSubmatch(m)
+		codes = append(codes, "<"+sub[2]+"|"+slackEscapeMap.Replace(sub[1])+">")
+		return fmt.Sprintf("\x00%d\x00", len(codes)-1)
+	})
+	line = slackEscapeMap.Replace(line)
+
+	// Bold is marked with \x01 until italic has been converted, since both
+	// end up as asterisks.
+	line = slackBoldRE.ReplaceAllString(line, "\x01$1$2\x01")
+	line = slackItalicRE.ReplaceAllString(line, "_${1}_")
+	line = strings.ReplaceAll(line, "\x01", "*")
+	line = slackStrikeRE.ReplaceAllString(line, "~$1~")
+
+	for i, c := range codes {
+		line = strings.Replace(line, fmt.Sprintf("\x00%d\x00", i), c, 1)
+	}
+	return line
+}
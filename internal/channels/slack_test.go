@@ -0,0 +1,166 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/local/picobot/internal/access"
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+)
+
+func TestStartSlackWithBase(t *testing.T) {
+	acks := make(chan string, 4)
+	posts := make(chan map[string]string, 4)
+	events := []string{
+		// A channel message without a mention is ignored...
+		`{"type":"message","user":"U1","text":"just chatting","channel":"C1","channel_type":"channel","ts":"1.1"}`,
+		// ...a mention starts a thread...
+		`{"type":"app_mention","user":"U1","text":"<@UBOT> hi &amp; bye","channel":"C1","channel_type":"channel","ts":"2.2"}`,
+		// ...and replies in that thread are followed.
+		`{"type":"message","user":"U1","text":"and then?","channel":"C1","channel_type":"channel","ts":"3.3","thread_ts":"2.2"}`,
+	}
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/auth.test":
+			w.Write([]byte(`{"ok":true,"user_id":"UBOT","user":"picobot","team":"home"}`))
+		case "/users.info":
+			w.Write([]byte(`{"ok":true,"user":{"name":"ana","profile":{"display_name":"Ana"}}}`))
+		case "/apps.connections.open":
+			if r.Header.Get("Authorization") != "Bearer xapp-1" {
+				t.Errorf("socket opened with %q", r.Header.Get("Authorization"))
+			}
+			w.Write([]byte(`{"ok":true,"url":"ws` + strings.TrimPrefix(srv.URL, "http") + `/socket"}`))
+		case "/socket":
+			conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+			if err != nil {
+				t.Errorf("upgrade: %v", err)
+				return
+			}
+			defer conn.Close()
+			conn.WriteJSON(map[string]string{"type": "hello"})
+			for i, ev := range events {
+				conn.WriteJSON(map[string]interface{}{
+					"envelope_id": "env" + string(rune('1'+i)),
+					"type":        "events_api",
+					"payload":     json.RawMessage(`{"event":` + ev + `}`),
+				})
+				var ack map[string]string
+				if err := conn.ReadJSON(&ack); err != nil {
+					return
+				}
+				acks <- ack["envelope_id"]
+			}
+			conn.ReadMessage() // hold the socket open until the test ends
+		case "/chat.postMessage":
+			if r.Header.Get("Authorization") != "Bearer xoxb-1" {
+				t.Errorf("posted with %q", r.Header.Get("Authorization"))
+			}
+			var msg map[string]string
+			json.NewDecoder(r.Body).Decode(&msg)
+			posts <- msg
+			w.Write([]byte(`{"ok":true}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	hub := chat.NewHub(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg := config.SlackConfig{AppToken: "xapp-1", BotToken: "xoxb-1", AllowFrom: []string{"@ana"}}
+	if err := startSlackWithBase(ctx, hub, srv.URL+"/", cfg); err != nil {
+		t.Fatalf("startSlackWithBase: %v", err)
+	}
+	hub.StartRouter(ctx)
+
+	for _, want := range []string{"hi & bye", "and then?"} {
+		select {
+		case msg := <-hub.In:
+			if msg.Content != want || msg.ChatID != "C1:2.2" || msg.SenderName != "Ana" {
+				t.Fatalf("inbound = %+v, want %q in thread C1:2.2 from Ana", msg, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout waiting for %q", want)
+		}
+	}
+	for _, want := range []string{"env1", "env2", "env3"} {
+		if got := <-acks; got != want {
+			t.Fatalf("ack = %q, want %q", got, want)
+		}
+	}
+
+	hub.Out <- chat.Outbound{Channel: "slack", ChatID: "C1:2.2", Content: "**done**"}
+	select {
+	case msg := <-posts:
+		if msg["channel"] != "C1" || msg["thread_ts"] != "2.2" || msg["text"] != "*done*" {
+			t.Fatalf("posted %v", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for chat.postMessage")
+	}
+}
+
+func TestSlackAllowFromIgnoresDisplayNames(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Mallory renamed herself "ana".
+		w.Write([]byte(`{"ok":true,"user":{"name":"mallory","profile":{"display_name":"ana"}}}`))
+	}))
+	defer srv.Close()
+	hub := chat.NewHub(1)
+	allowed, _ := access.NewPolicy([]string{"@ana"}, nil)
+	c := newSlackClient(context.Background(), hub, srv.URL+"/", config.SlackConfig{}, allowed)
+	c.botID = "UBOT"
+	c.handleEvent(slackEvent{Type: "app_mention", User: "U2", Text: "<@UBOT> hi", Channel: "C1", ChannelType: "channel", TS: "1.1"})
+	select {
+	case in := <-hub.In:
+		t.Fatalf("message from a look-alike display name got through: %+v", in)
+	default:
+	}
+}
+
+func TestFollowedThreadsAreBounded(t *testing.T) {
+	th := newFollowedThreads()
+	for i := 0; i <= maxFollowedThreads; i++ {
+		th.follow(fmt.Sprintf("C1:%d", i))
+		if i == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		if i == 1 {
+			th.touch("C1:0") // the first thread is still active
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if len(th.active) != maxFollowedThreads {
+		t.Fatalf("%d threads followed", len(th.active))
+	}
+	if !th.touch("C1:0") || th.touch("C1:1") {
+		t.Error("expected the least recently active thread to be forgotten")
+	}
+}
+
+func TestFormatSlack(t *testing.T) {
+	cases := []struct{ in, want string }{
+		{"**bold** and *italic* and ~~gone~~", "*bold* and _italic_ and ~gone~"},
+		{"## Heading", "*Heading*"},
+		{"- one\n  * two", "• one\n  • two"},
+		{"see [the docs](https://example.com/a_b) now", "see <https://example.com/a_b|the docs> now"},
+		{"1 < 2 & `a<b`", "1 &lt; 2 &amp; `a&lt;b`"},
+		{"```go\nx := **y**\n```", "```\nx := **y**\n```"},
+	}
+	for _, c := range cases {
+		if got := formatSlack(c.in); got != c.want {
+			t.Errorf("formatSlack(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
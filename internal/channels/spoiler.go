@@ -0,0 +1,60 @@
+package channels
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The agent hides text with two markers: ||spoiler|| inline, and quote
+// lines starting with ">>" instead of ">" for a quote shown collapsed until
+// the reader expands it. Telegram renders both; the other channels get
+// stripHidingMarkers.
+var (
+	spoilerRE     = regexp.MustCompile(`\|\|([^|\s](?:[^|\n]*[^|\s])?)\|\|`)
+	expandQuoteRE = regexp.MustCompile(`^>>\s?`)
+	quoteRE       = regexp.MustCompile(`^>\s?`)
+)
+
+// quoteMarker returns the quote marker line starts with, if any, and
+// whether it opens an expandable quote.
+func quoteMarker(line string) (marker string, expandable bool) {
+	if m := expandQuoteRE.FindString(line); m != "" {
+		return m, true
+	}
+	return quoteRE.FindString(line), false
+}
+
+// stripHidingMarkers degrades the hiding markers for a channel that cannot
+// hide text: expandable quotes become plain "> " quotes and, unless
+// keepSpoilers (Discord renders them itself), spoilers their bare text.
+// Code is left as it is.
+func stripHidingMarkers(s string, keepSpoilers bool) string {
+	lines := strings.Split(s, "\n")
+	inCode := false
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			continue
+		}
+		if m, expandable := quoteMarker(line); expandable {
+			line = "> " + line[len(m):]
+		}
+		if !keepSpoilers {
+			var codes []string
+			line = htmlInlineCodeRE.ReplaceAllStringFunc(line, func(m string) string {
+				codes = append(codes, m)
+				return fmt.Sprintf("\x00%d\x00", len(codes)-1)
+			})
+			line = spoilerRE.ReplaceAllString(line, "$1")
+			for j, c := range codes {
+				line = strings.Replace(line, fmt.Sprintf("\x00%d\x00", j), c, 1)
+			}
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,16 @@
+package channels
+
+import "testing"
+
+func TestStripHidingMarkers(t *testing.T) {
+	in := "The answer is ||42||, not `a || b || c`.\n>> long\n>> log\n```\n>> kept\n```"
+	if got, want := stripHidingMarkers(in, false), "The answer is 42, not `a || b || c`.\n> long\n> log\n```\n>> kept\n```"; got != want {
+		t.Errorf("stripHidingMarkers = %q, want %q", got, want)
+	}
+	if got, want := stripHidingMarkers("||42||\n>> log", true), "||42||\n> log"; got != want {
+		t.Errorf("stripHidingMarkers keeping spoilers = %q, want %q", got, want)
+	}
+	if got, want := formatSlack("It was ||Rosebud||"), "It was Rosebud"; got != want {
+		t.Errorf("formatSlack = %q, want %q", got, want)
+	}
+}
@@ -1,19 +1,28 @@
 package channels
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/local/picobot/internal/access"
 	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/watchdog"
 )
 
 var markdownDoubleBoldRE = regexp.MustCompile(`\*\*([^*\n]+)\*\*`)
@@ -21,6 +30,7 @@ var markdownDoubleBoldRE = regexp.MustCompile(`\*\*([^*\n]+)\*\*`)
 func formatTelegramMarkdownV2(s string) string {
 	// Normalize common LLM output quirks.
 	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = markHidingMarkers(s)
 	s = markdownDoubleBoldRE.ReplaceAllString(s, "*$1*")
 	lines := strings.Split(s, "\n")
 	for i, line := range lines {
@@ -32,7 +42,67 @@ func formatTelegramMarkdownV2(s string) string {
 	}
 	s = strings.Join(lines, "\n")
 
-	return escapeTelegramMarkdownV2PreserveBold(s)
+	return hidingMarkersV2.Replace(escapeTelegramMarkdownV2PreserveBold(s))
+}
+
+// Placeholders for the hiding markers, which escaping must leave alone.
+const (
+	markExpandOpen  = "\x01" // opens an expandable quote: **>
+	markQuoteLine   = "\x02" // continues it: >
+	markExpandClose = "\x03" // ends its last line: ||
+	markSpoiler     = "\x04" // either side of a spoiler: ||
+)
+
+var hidingMarkersV2 = strings.NewReplacer(markExpandOpen, "**>", markQuoteLine, ">", markExpandClose, "||", markSpoiler, "||")
+
+// markHidingMarkers replaces spoilers and expandable quotes (see
+// quoteMarker) outside code with placeholders, turned into their MarkdownV2
+// syntax once the text is escaped.
+func markHidingMarkers(s string) string {
+	lines := strings.Split(s, "\n")
+	inCode, inExpand := false, false
+	for i, line := range lines {
+		fence := strings.HasPrefix(strings.TrimSpace(line), "```")
+		if fence || inCode {
+			if inExpand {
+				lines[i-1] += markExpandClose
+				inExpand = false
+			}
+			if fence {
+				inCode = !inCode
+			}
+			continue
+		}
+		var codes []string
+		line = htmlInlineCodeRE.ReplaceAllStringFunc(line, func(m string) string {
+			codes = append(codes, m)
+			return fmt.Sprintf("\x00%d\x00", len(codes)-1)
+		})
+		line = spoilerRE.ReplaceAllString(line, markSpoiler+"$1"+markSpoiler)
+		for j, c := range codes {
+			line = strings.Replace(line, fmt.Sprintf("\x00%d\x00", j), c, 1)
+		}
+		m, expandable := quoteMarker(line)
+		if !expandable {
+			if inExpand {
+				lines[i-1] += markExpandClose
+			}
+			inExpand = false
+			lines[i] = line
+			continue
+		}
+		if inExpand {
+			line = markQuoteLine + line[len(m):]
+		} else {
+			line = markExpandOpen + line[len(m):]
+		}
+		inExpand = true
+		lines[i] = line
+	}
+	if inExpand {
+		lines[len(lines)-1] += markExpandClose
+	}
+	return strings.Join(lines, "\n")
 }
 
 func escapeTelegramMarkdownV2PreserveBold(s string) string {
@@ -62,153 +132,1197 @@ func escapeTelegramMarkdownV2PreserveBold(s string) string {
 	return b.String()
 }
 
+// telegramPhotoExts lists file extensions sent with sendPhoto; everything else
+// goes through sendDocument.
+var telegramPhotoExts = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+	".webp": true,
+}
+
+const (
+	// telegramEditInterval throttles editMessageText calls for a streamed reply
+	// to stay within Telegram's per-chat rate limits.
+	telegramEditInterval = time.Second
+	// telegramMaxMessage is the Bot API limit on message text, in UTF-16 code
+	// units after entity parsing; we apply it to the escaped text to be safe.
+	telegramMaxMessage = 4096
+	// telegramMaxPartial caps the length of a streamed snapshot, keeping it
+	// under the message limit.
+	telegramMaxPartial = 4000
+	// telegramChatQueueSize is the number of outbound messages buffered per chat.
+	telegramChatQueueSize = 100
+	// telegramSendAttempts bounds how often a request failing transiently
+	// is tried (see config.TelegramSending).
+	telegramSendAttempts = 6
+	// telegramStallAfter is how long the poller may go without a successful
+	// getUpdates (which returns at least once per long-poll timeout) before
+	// the watchdog restarts it.
+	telegramStallAfter = 3 * time.Minute
+)
+
 // StartTelegram is a convenience wrapper that uses the real polling implementation
 // with the standard Telegram base URL.
-// allowFrom is a list of Telegram user IDs permitted to interact with the bot.
-// If empty, ALL users are allowed (open mode).
-func StartTelegram(ctx context.Context, hub *chat.Hub, token string, allowFrom []string) error {
-	if token == "" {
+// cfg.AllowFrom is a list of Telegram user IDs permitted to interact with the bot.
+// If empty, ALL users are allowed (open mode). cfg.AllowChats likewise
+// restricts the chats (private or group) the bot answers in.
+func StartTelegram(ctx context.Context, hub *chat.Hub, cfg config.TelegramConfig) error {
+	if cfg.Token == "" {
 		return fmt.Errorf("telegram token not provided")
 	}
-	base := "https://api.telegram.org/bot" + token
-	return StartTelegramWithBase(ctx, hub, token, base, allowFrom)
+	base := "https://api.telegram.org/bot" + cfg.Token
+	return StartTelegramWithBase(ctx, hub, base, cfg)
 }
 
 // StartTelegramWithBase starts long-polling against the given base URL (e.g., https://api.telegram.org/bot<TOKEN> or a test server URL).
-// allowFrom restricts which Telegram user IDs may send messages. Empty means allow all.
-func StartTelegramWithBase(ctx context.Context, hub *chat.Hub, token, base string, allowFrom []string) error {
+// cfg.AllowFrom restricts which Telegram user IDs may send messages and
+// cfg.AllowChats which chats they may send them in. Empty means allow all.
+func StartTelegramWithBase(ctx context.Context, hub *chat.Hub, base string, cfg config.TelegramConfig) error {
 	if base == "" {
 		return fmt.Errorf("base URL is required")
 	}
+	if _, err := telegramTransport(cfg.Proxy); err != nil {
+		return err
+	}
+	if _, err := access.NewPolicy(cfg.AllowFrom, cfg.Deny); err != nil {
+		return fmt.Errorf("telegram allowFrom: %w", err)
+	}
+
+	// Subscribe to the outbound queue before launching the goroutines so the
+	// registration is visible to the hub router from the moment this function returns.
+	c := newTelegramClient(ctx, hub, base, cfg)
+	watchdog.Default.Register("telegram", max(telegramStallAfter, 3*c.pollTimeout), c.restartPolling)
+	go c.pollInbound()
+	go c.runOutbound()
+	return nil
+}
+
+// telegramClient talks to the Telegram Bot API for a single bot.
+type telegramClient struct {
+	base    string
+	hub     *chat.Hub
+	outCh   <-chan chat.Outbound
+	allowed *access.Policy      // allowFrom and the shared access block; see telegramAccess
+	chats   map[string]struct{} // chat IDs; empty = all
+	// publishTo holds the broadcast channels admins post to, whose posts
+	// are recorded (see handleChannelPost).
+	publishTo map[string]struct{}
+	admins    map[string]struct{} // user IDs allowed to use the admin commands
+	ctx       context.Context
+	poller    *http.Client // long-polling client (timeout > getUpdates timeout)
+	sender    *http.Client // outbound client
+
+	// groupAll forwards every group message instead of only those addressed
+	// to the bot. botID and botUsername identify the bot in groups (getMe).
+	groupAll    bool
+	botID       int64
+	botUsername string
+	mentionRE   *regexp.Regexp
+
+	// stickerSet names the set replies may pick stickers from; stickers maps
+	// its emojis to file IDs once loaded (guarded by mu).
+	stickerSet string
+	stickers   map[string]string
+
+	// access is the allowlist changed at runtime with /allow and /deny,
+	// persisted to statePath (guarded by mu).
+	access    telegramAccess
+	statePath string
+
+	// pollGen is the generation of the current getUpdates loop and offset the
+	// next update it asks for; a loop whose generation is stale exits, so the
+	// watchdog can replace a stalled one (both guarded by mu).
+	pollGen int
+	offset  int64
+
+	// pollTimeout is the getUpdates long-poll timeout; polling also holds the
+	// backoff settings for failed polls.
+	pollTimeout time.Duration
+	polling     config.TelegramPolling
+
+	// polls maps the ID of each poll the bot sent to its chat (guarded by mu).
+	polls map[string]*telegramPoll
+
+	// parseMode is the Bot API parse_mode of replies and format renders the
+	// agent's Markdown for it; parseMode "entities" sends replies as plain
+	// text with an entities array instead (see setText).
+	parseMode string
+	format    func(string) string
+
+	// streams tracks the placeholder message of each reply being streamed,
+	// keyed by Outbound.StreamID. A stream belongs to one chat, so only that
+	// chat's sender touches an entry; mu guards the map itself.
+	mu           sync.Mutex
+	streams      map[string]*telegramStream
+	editInterval time.Duration
+
+	// reactWorking and reactDone are the reactions set on a message when the
+	// agent starts on it and once it is answered; empty disables them.
+	reactWorking string
+	reactDone    string
+
+	// coalesce is the window in which text replies to one chat are merged
+	// into a single message; zero disables merging.
+	coalesce time.Duration
+
+	// journal keeps the queued replies across restarts; nil when disabled.
+	journal *telegramJournal
+
+	// sending bounds the retries of failed requests; messages that still
+	// could not be sent are appended to deadLetters (guarded by deadMu).
+	sending     config.TelegramSending
+	deadLetters string
+	deadMu      sync.Mutex
+
+	// inbox is the workspace documents sent to the bot are saved in (see
+	// saveDocument), if any, and inboxMax the largest size saved.
+	inbox    string
+	inboxMax int64
+	// delivering holds, by chat, the end of the last message being handed
+	// to the agent in the background (see deliverInOrder; guarded by mu).
+	delivering map[string]chan struct{}
+}
+
+// telegramStream is the state of one streamed reply.
+type telegramStream struct {
+	messageID int64
+	shown     string // text currently displayed
+	lastEdit  time.Time
+}
+
+// newTelegramClient constructs a telegramClient and registers it as the hub's
+// "telegram" outbound subscriber.
+func newTelegramClient(ctx context.Context, hub *chat.Hub, base string, cfg config.TelegramConfig) *telegramClient {
+	// StartTelegramWithBase has already rejected malformed patterns.
+	allowed, err := access.NewPolicy(cfg.AllowFrom, cfg.Deny)
+	if err != nil {
+		allowed = access.Closed()
+	}
+	chats := make(map[string]struct{}, len(cfg.AllowChats))
+	for _, id := range cfg.AllowChats {
+		chats[id] = struct{}{}
+	}
+	admins := make(map[string]struct{}, len(cfg.Admins))
+	for _, id := range cfg.Admins {
+		admins[id] = struct{}{}
+	}
+	pollTimeout := time.Duration(cfg.Polling.TimeoutS) * time.Second
+	if pollTimeout <= 0 {
+		pollTimeout = telegramPollTimeout
+	}
+	var reactWorking, reactDone string
+	if cfg.Reactions.Enabled {
+		reactWorking, reactDone = cfg.Reactions.Working, cfg.Reactions.Done
+		if reactWorking == "" {
+			reactWorking = telegramReactWorking
+		}
+		if reactDone == "" {
+			reactDone = telegramReactDone
+		}
+	}
+	parseMode, format := "MarkdownV2", formatTelegramMarkdownV2
+	switch strings.ToLower(cfg.ParseMode) {
+	case "html":
+		parseMode, format = "HTML", formatTelegramHTML
+	case "entities":
+		parseMode, format = "entities", nil
+	}
+	// StartTelegramWithBase has already rejected a bad proxy.
+	transport, _ := telegramTransport(cfg.Proxy)
+	// Streamed replies are rendered by editing a placeholder message.
+	hub.EnableStreaming("telegram")
+	c := &telegramClient{
+		base:      base,
+		hub:       hub,
+		outCh:     hub.Subscribe("telegram"),
+		allowed:   allowed,
+		chats:     chats,
+		publishTo: telegramPublishTo(cfg.PublishTo),
+		admins:    admins,
+		ctx:       ctx,
+		poller:    telegramHTTPClient(pollTimeout+15*time.Second, transport),
+		sender:    telegramHTTPClient(60*time.Second, transport),
 
-	// Build a fast lookup set for allowed user IDs.
-	allowed := make(map[string]struct{}, len(allowFrom))
-	for _, id := range allowFrom {
-		allowed[id] = struct{}{}
+		groupAll:   cfg.GroupMode == "all",
+		stickerSet: cfg.StickerSet,
+		statePath:  cfg.StatePath,
+		parseMode:  parseMode,
+		format:     format,
+
+		polls:        make(map[string]*telegramPoll),
+		delivering:   make(map[string]chan struct{}),
+		streams:      make(map[string]*telegramStream),
+		editInterval: telegramEditInterval,
+		pollTimeout:  pollTimeout,
+		coalesce:     time.Duration(cfg.CoalesceMs) * time.Millisecond,
+		reactWorking: reactWorking,
+		reactDone:    reactDone,
+		polling:      cfg.Polling,
+		sending:      cfg.Sending,
+		deadLetters:  cfg.Sending.DeadLetterPath,
+	}
+	if c.sending.MaxAttempts <= 0 {
+		c.sending.MaxAttempts = telegramSendAttempts
 	}
+	if cfg.Inbox.Enabled && cfg.Inbox.Workspace != "" {
+		c.inbox, c.inboxMax = cfg.Inbox.Workspace, telegramMaxDownload
+		if mb := int64(cfg.Inbox.MaxMB) << 20; mb > 0 && mb < telegramMaxDownload {
+			c.inboxMax = mb
+		}
+	}
+	if cfg.QueuePath != "" {
+		j, err := openTelegramJournal(cfg.QueuePath)
+		if err != nil {
+			log.Printf("telegram: outbound queue will not survive restarts: %v", err)
+		}
+		c.journal = j
+	}
+	c.loadAccess()
+	return c
+}
 
-	client := &http.Client{Timeout: 45 * time.Second}
+// telegramMessage is the subset of a Bot API Message that picobot reads.
+type telegramMessage struct {
+	MessageID int64         `json:"message_id"`
+	From      *telegramUser `json:"from"`
+	Chat      struct {
+		ID       int64  `json:"id"`
+		Type     string `json:"type"` // "private", "group", "supergroup" or "channel"
+		Title    string `json:"title"`
+		Username string `json:"username"`
+	} `json:"chat"`
+	MessageThreadID int64            `json:"message_thread_id"` // forum topic, with IsTopicMessage
+	IsTopicMessage  bool             `json:"is_topic_message"`
+	Text            string           `json:"text"`
+	ReplyToMessage  *telegramMessage `json:"reply_to_message"`
+	Sticker         *telegramSticker `json:"sticker"`
+	Location        *struct {
+		Latitude  float64 `json:"latitude"`
+		Longitude float64 `json:"longitude"`
+	} `json:"location"`
+	Venue *struct {
+		Title   string `json:"title"`
+		Address string `json:"address"`
+	} `json:"venue"`
+	ForwardOrigin *telegramForwardOrigin `json:"forward_origin"`
+	Caption       string                 `json:"caption"`
+	Photo         []telegramFile         `json:"photo"` // available sizes, smallest first
+	Document      *telegramFile          `json:"document"`
+	Video         *telegramFile          `json:"video"`
+	Audio         *telegramFile          `json:"audio"`
+	Voice         *telegramFile          `json:"voice"`
+}
 
-	// inbound polling goroutine
-	go func() {
-		offset := int64(0)
-		for {
-			select {
-			case <-ctx.Done():
-				log.Println("telegram: stopping inbound polling")
-				return
-			default:
+// telegramFile is the subset of the Bot API file types (PhotoSize, Document,
+// Video, Audio, Voice) that picobot reads.
+type telegramFile struct {
+	FileID   string `json:"file_id"`
+	FileName string `json:"file_name"`
+	MimeType string `json:"mime_type"`
+	FileSize int64  `json:"file_size"`
+}
+
+// attachment returns the kind ("photo", "document", ...) and file of the
+// media attached to m, or "" and nil when there is none.
+func (m *telegramMessage) attachment() (string, *telegramFile) {
+	switch {
+	case len(m.Photo) > 0:
+		return "photo", &m.Photo[len(m.Photo)-1]
+	case m.Document != nil:
+		return "document", m.Document
+	case m.Video != nil:
+		return "video", m.Video
+	case m.Audio != nil:
+		return "audio", m.Audio
+	case m.Voice != nil:
+		return "voice", m.Voice
+	}
+	return "", nil
+}
+
+// describe renders an attachment as "[attached document: a.pdf (application/pdf, 120 KB)]".
+func (f *telegramFile) describe(kind string) string {
+	desc := "[attached " + kind
+	if f.FileName != "" {
+		desc += ": " + f.FileName
+	}
+	var details []string
+	if f.MimeType != "" {
+		details = append(details, f.MimeType)
+	}
+	if f.FileSize > 0 {
+		details = append(details, formatFileSize(f.FileSize))
+	}
+	if len(details) > 0 {
+		desc += " (" + strings.Join(details, ", ") + ")"
+	}
+	return desc + "]"
+}
+
+func formatFileSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%d KB", n/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// telegramForwardOrigin is the subset of a Bot API MessageOrigin that picobot
+// reads. Which fields are set depends on Type: "user", "hidden_user", "chat"
+// or "channel".
+type telegramForwardOrigin struct {
+	Type           string        `json:"type"`
+	SenderUser     *telegramUser `json:"sender_user"`
+	SenderUserName string        `json:"sender_user_name"`
+	SenderChat     *telegramChat `json:"sender_chat"`
+	Chat           *telegramChat `json:"chat"`
+}
+
+type telegramChat struct {
+	Title    string `json:"title"`
+	Username string `json:"username"`
+}
+
+// name describes who the forwarded message originally came from.
+func (o *telegramForwardOrigin) name() string {
+	chatName := func(c *telegramChat) string {
+		switch {
+		case c == nil:
+			return ""
+		case c.Title != "" && c.Username != "":
+			return c.Title + " (@" + c.Username + ")"
+		case c.Title != "":
+			return c.Title
+		case c.Username != "":
+			return "@" + c.Username
+		}
+		return ""
+	}
+	name := ""
+	switch o.Type {
+	case "user":
+		if u := o.SenderUser; u != nil {
+			name = strings.TrimSpace(u.FirstName + " " + u.LastName)
+			if u.Username != "" {
+				name = strings.TrimSpace(name + " (@" + u.Username + ")")
 			}
+		}
+	case "hidden_user":
+		name = o.SenderUserName
+	case "chat":
+		name = chatName(o.SenderChat)
+	case "channel":
+		name = chatName(o.Chat)
+	}
+	if name == "" {
+		name = "an unknown sender"
+	}
+	return name
+}
+
+type telegramSticker struct {
+	Emoji   string `json:"emoji"`
+	SetName string `json:"set_name"`
+}
+
+// telegramMessageText renders a message as text for the agent. Non-text
+// messages are described in brackets; "" means there is nothing to forward.
+func telegramMessageText(m *telegramMessage) string {
+	if m.Sticker != nil {
+		desc := "[sticker"
+		if m.Sticker.Emoji != "" {
+			desc += " " + m.Sticker.Emoji
+		}
+		if m.Sticker.SetName != "" {
+			desc += fmt.Sprintf(" from set %q", m.Sticker.SetName)
+		}
+		return desc + "]"
+	}
+	if m.Location != nil {
+		coords := fmt.Sprintf("%.6f, %.6f", m.Location.Latitude, m.Location.Longitude)
+		if m.Venue != nil {
+			return fmt.Sprintf("[venue %q, %s (%s)]", m.Venue.Title, m.Venue.Address, coords)
+		}
+		return "[location " + coords + "]"
+	}
+	text := m.Text
+	if kind, f := m.attachment(); f != nil {
+		// Media carry their text in the caption.
+		text = strings.TrimSpace(m.Caption + "\n" + f.describe(kind))
+	}
+	if m.ForwardOrigin != nil && text != "" {
+		// Make clear the text is quoted, not the user speaking.
+		return "Forwarded from " + m.ForwardOrigin.name() + ":\n" + text
+	}
+	return text
+}
+
+// telegramUser is the subset of a Bot API User that picobot reads.
+type telegramUser struct {
+	ID        int64  `json:"id"`
+	Username  string `json:"username"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+// pollInbound long-polls getUpdates and forwards messages to the hub.
+func (c *telegramClient) pollInbound() {
+	c.fetchIdentity()
+	c.registerCommands()
+	c.loadStickers()
+	c.poll(0)
+}
+
+// restartPolling replaces a stalled poller with a new one, resuming from the
+// last confirmed update. The old poller exits as soon as it notices it was
+// replaced. Called by the watchdog.
+func (c *telegramClient) restartPolling() {
+	c.mu.Lock()
+	c.pollGen++
+	gen := c.pollGen
+	c.mu.Unlock()
+	go c.poll(gen)
+}
+
+// poll is the getUpdates loop of poller generation gen.
+func (c *telegramClient) poll(gen int) {
+	backoff := newTelegramBackoff(c.polling)
+	for {
+		select {
+		case <-c.ctx.Done():
+			log.Println("telegram: stopping inbound polling")
+			return
+		default:
+		}
+		c.mu.Lock()
+		current, offset := c.pollGen == gen, c.offset
+		c.mu.Unlock()
+		if !current {
+			log.Println("telegram: replaced poller exiting")
+			return
+		}
 
-			values := url.Values{}
-			values.Set("offset", strconv.FormatInt(offset, 10))
-			values.Set("timeout", "30")
-			u := base + "/getUpdates"
-			resp, err := client.PostForm(u, values)
-			if err != nil {
-				log.Printf("telegram getUpdates error: %v", err)
-				time.Sleep(1 * time.Second)
+		values := url.Values{}
+		values.Set("offset", strconv.FormatInt(offset, 10))
+		values.Set("timeout", strconv.Itoa(int(c.pollTimeout/time.Second)))
+		var updates []struct {
+			UpdateID    int64               `json:"update_id"`
+			Message     *telegramMessage    `json:"message"`
+			ChannelPost *telegramMessage    `json:"channel_post"`
+			PollAnswer  *telegramPollAnswer `json:"poll_answer"`
+		}
+		resp, err := c.poller.PostForm(c.base+"/getUpdates", values)
+		if err == nil {
+			err = checkTelegramResponse(resp, &updates)
+		}
+		if err != nil {
+			// Back off exponentially while Telegram is unreachable or
+			// failing, instead of hammering it.
+			var retryAfter time.Duration
+			var apiErr *telegramAPIError
+			if errors.As(err, &apiErr) {
+				retryAfter = apiErr.RetryAfter
+			}
+			delay := backoff.next(retryAfter)
+			log.Printf("telegram getUpdates error: %v (retrying in %s)", err, delay.Round(time.Millisecond))
+			select {
+			case <-time.After(delay):
+			case <-c.ctx.Done():
+			}
+			continue
+		}
+		backoff.reset()
+		c.mu.Lock()
+		current = c.pollGen == gen
+		c.mu.Unlock()
+		if !current {
+			// Replaced while waiting: the updates are unconfirmed, so the new
+			// poller receives them again.
+			continue
+		}
+		watchdog.Default.Beat("telegram")
+		for _, upd := range updates {
+			if upd.UpdateID >= offset {
+				offset = upd.UpdateID + 1
+				c.mu.Lock()
+				c.offset = offset
+				c.mu.Unlock()
+			}
+			if upd.PollAnswer != nil {
+				c.handlePollAnswer(upd.PollAnswer)
 				continue
 			}
-			body, _ := io.ReadAll(resp.Body)
-			resp.Body.Close()
-			var gu struct {
-				Ok     bool `json:"ok"`
-				Result []struct {
-					UpdateID int64 `json:"update_id"`
-					Message  *struct {
-						MessageID int64 `json:"message_id"`
-						From      *struct {
-							ID int64 `json:"id"`
-						} `json:"from"`
-						Chat struct {
-							ID int64 `json:"id"`
-						} `json:"chat"`
-						Text string `json:"text"`
-					} `json:"message"`
-				} `json:"result"`
-			}
-			if err := json.Unmarshal(body, &gu); err != nil {
-				log.Printf("telegram: invalid getUpdates response: %v", err)
+			if upd.ChannelPost != nil {
+				c.handleChannelPost(upd.ChannelPost)
 				continue
 			}
-			for _, upd := range gu.Result {
-				if upd.UpdateID >= offset {
-					offset = upd.UpdateID + 1
-				}
-				if upd.Message == nil {
+			if upd.Message == nil {
+				continue
+			}
+			m := upd.Message
+			fromID := ""
+			if m.From != nil {
+				fromID = strconv.FormatInt(m.From.ID, 10)
+			}
+			// Enforce allowFrom (and its runtime changes): reject unknown senders.
+			if !c.isAllowed(fromID, m.From) {
+				log.Printf("telegram: dropping message from unauthorized user %s", fromID)
+				continue
+			}
+			// Enforce allowChats the same way for the chat the message is in.
+			chatID := telegramChatKey(m)
+			if len(c.chats) > 0 {
+				if _, ok := c.chats[telegramBaseChat(chatID)]; !ok {
+					log.Printf("telegram: dropping message in unauthorized chat %s", chatID)
 					continue
 				}
-				m := upd.Message
-				fromID := ""
-				if m.From != nil {
-					fromID = strconv.FormatInt(m.From.ID, 10)
-				}
-				// Enforce allowFrom: if the list is non-empty, reject unknown senders.
-				if len(allowed) > 0 {
-					if _, ok := allowed[fromID]; !ok {
-						log.Printf("telegram: dropping message from unauthorized user %s", fromID)
-						continue
-					}
+			}
+			content := telegramMessageText(m)
+			if m.Chat.Type == "group" || m.Chat.Type == "supergroup" {
+				var ok bool
+				if content, ok = c.groupContent(m, content); !ok {
+					continue
 				}
-				chatID := strconv.FormatInt(m.Chat.ID, 10)
-				hub.In <- chat.Inbound{
-					Channel:   "telegram",
-					SenderID:  fromID,
-					ChatID:    chatID,
-					Content:   m.Text,
-					Timestamp: time.Now(),
+			}
+			if strings.TrimSpace(content) == "" {
+				// Unsupported message types (e.g. service messages) carry no text.
+				continue
+			}
+			messageID := strconv.FormatInt(m.MessageID, 10)
+			if c.handleAdminCommand(fromID, chatID, messageID, content) {
+				continue
+			}
+			meta := map[string]interface{}{
+				"message_id": messageID,
+				"chat_type":  m.Chat.Type,
+				"is_dm":      m.Chat.Type == "private",
+			}
+			if c.isAdmin(fromID) {
+				meta["admin"] = true
+			}
+			if m.ForwardOrigin != nil {
+				meta["forwarded_from"] = m.ForwardOrigin.name()
+			}
+			var document *telegramFile
+			if kind, f := m.attachment(); f != nil {
+				meta["attachment_type"] = kind
+				meta["file_id"] = f.FileID
+				meta["file_name"] = f.FileName
+				meta["mime_type"] = f.MimeType
+				meta["file_size"] = f.FileSize
+				if kind == "document" && c.inbox != "" {
+					document = f
 				}
 			}
+			if m.Location != nil {
+				meta["latitude"] = m.Location.Latitude
+				meta["longitude"] = m.Location.Longitude
+			}
+			if c.reactWorking != "" {
+				go c.react(chatID, messageID, c.reactWorking)
+			}
+			in := chat.Inbound{
+				Channel:   "telegram",
+				SenderID:  fromID,
+				ChatID:    chatID,
+				Content:   content,
+				Timestamp: time.Now(),
+				Metadata:  meta,
+			}
+			// Documents are downloaded in the background, not to hold up the
+			// updates of other chats.
+			c.deliverInOrder(chatID, document != nil, func() {
+				if document != nil {
+					c.attachDocument(&in, document)
+				}
+				c.hub.In <- in
+			})
 		}
+	}
+}
+
+// deliverInOrder runs deliver, which hands a message of chatID to the agent,
+// after the messages of the chat still being handed over in the background.
+// It runs in the background when slow is set or some are, and right away
+// otherwise.
+func (c *telegramClient) deliverInOrder(chatID string, slow bool, deliver func()) {
+	c.mu.Lock()
+	prev := c.delivering[chatID]
+	if prev == nil && !slow {
+		c.mu.Unlock()
+		deliver()
+		return
+	}
+	done := make(chan struct{})
+	c.delivering[chatID] = done
+	c.mu.Unlock()
+	go func() {
+		if prev != nil {
+			<-prev
+		}
+		deliver()
+		close(done)
+		c.mu.Lock()
+		if c.delivering[chatID] == done {
+			delete(c.delivering, chatID)
+		}
+		c.mu.Unlock()
 	}()
+}
 
-	// Subscribe to the outbound queue before launching the goroutine so the
-	// registration is visible to the hub router from the moment this function returns.
-	outCh := hub.Subscribe("telegram")
+// fetchIdentity looks up the bot's own ID and username, needed to recognise
+// mentions of and replies to the bot in groups. On failure only slash
+// commands activate the bot in groups.
+func (c *telegramClient) fetchIdentity() {
+	var me telegramUser
+	if err := c.call("getMe", url.Values{}, &me); err != nil {
+		log.Printf("telegram getMe %v", err)
+		return
+	}
+	c.botID = me.ID
+	c.botUsername = me.Username
+	if me.Username != "" {
+		c.mentionRE = regexp.MustCompile(`(?i)@` + regexp.QuoteMeta(me.Username) + `\b`)
+	}
+}
 
-	// outbound sender goroutine
-	go func() {
-		client := &http.Client{Timeout: 10 * time.Second}
-		for {
+// loadStickers fetches the configured sticker set and indexes its stickers by
+// emoji, so replies can carry a sticker.
+func (c *telegramClient) loadStickers() {
+	if c.stickerSet == "" {
+		return
+	}
+	var set struct {
+		Stickers []struct {
+			FileID string `json:"file_id"`
+			Emoji  string `json:"emoji"`
+		} `json:"stickers"`
+	}
+	v := url.Values{}
+	v.Set("name", c.stickerSet)
+	if err := c.call("getStickerSet", v, &set); err != nil {
+		log.Printf("telegram getStickerSet %v", err)
+		return
+	}
+	stickers := make(map[string]string, len(set.Stickers))
+	for _, st := range set.Stickers {
+		if _, dup := stickers[st.Emoji]; !dup && st.Emoji != "" {
+			stickers[st.Emoji] = st.FileID
+		}
+	}
+	c.mu.Lock()
+	c.stickers = stickers
+	c.mu.Unlock()
+}
+
+// sticker returns the file ID of the configured set's sticker for emoji.
+func (c *telegramClient) sticker(emoji string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id, ok := c.stickers[strings.TrimSuffix(emoji, "\ufe0f")]
+	if !ok {
+		id, ok = c.stickers[emoji]
+	}
+	return id, ok
+}
+
+// registerCommands publishes the agent's slash commands as the bot's command
+// menu (setMyCommands), so users can pick them from the chat UI.
+func (c *telegramClient) registerCommands() {
+	cmds := c.hub.Commands()
+	if len(cmds) == 0 {
+		return
+	}
+	type botCommand struct {
+		Command     string `json:"command"`
+		Description string `json:"description"`
+	}
+	list := make([]botCommand, 0, len(cmds))
+	for _, cmd := range cmds {
+		list = append(list, botCommand{Command: cmd.Name, Description: cmd.Description})
+	}
+	b, _ := json.Marshal(list)
+	v := url.Values{}
+	v.Set("commands", string(b))
+	if err := c.call("setMyCommands", v, nil); err != nil {
+		log.Printf("telegram setMyCommands %v", err)
+	}
+}
+
+// groupContent decides whether a group message with the given text is
+// addressed to the bot: it mentions the bot, replies to one of its messages,
+// or is a slash command not aimed at another bot. It returns the text to hand
+// to the agent, with the mention (or the command's @botname suffix) removed.
+func (c *telegramClient) groupContent(m *telegramMessage, text string) (string, bool) {
+	text = strings.TrimSpace(text)
+	if c.groupAll {
+		return text, text != ""
+	}
+	if strings.HasPrefix(text, "/") {
+		cmd, rest, _ := strings.Cut(text, " ")
+		if name, target, ok := strings.Cut(cmd, "@"); ok {
+			if !strings.EqualFold(target, c.botUsername) {
+				return "", false
+			}
+			text = strings.TrimSpace(name + " " + rest)
+		}
+		return text, true
+	}
+	addressed := m.ReplyToMessage != nil && m.ReplyToMessage.From != nil &&
+		c.botID != 0 && m.ReplyToMessage.From.ID == c.botID
+	if c.mentionRE != nil && c.mentionRE.MatchString(text) {
+		addressed = true
+		text = strings.Join(strings.Fields(c.mentionRE.ReplaceAllString(text, "")), " ")
+	}
+	if !addressed || text == "" {
+		return "", false
+	}
+	return text, true
+}
+
+// runOutbound reads replies from the hub's telegram subscription and hands
+// them to a per-chat queue, so a chat that is being rate limited does not hold
+// up the others while its messages still go out in order. Complete messages
+// are journalled until sent; those left over from the previous run go first.
+func (c *telegramClient) runOutbound() {
+	queues := make(map[string]chan chat.Outbound)
+	enqueue := func(out chat.Outbound) bool {
+		q, ok := queues[out.ChatID]
+		if !ok {
+			q = make(chan chat.Outbound, telegramChatQueueSize)
+			queues[out.ChatID] = q
+			go c.runChat(q)
+		}
+		select {
+		case q <- out:
+			return true
+		case <-c.ctx.Done():
+			return false
+		}
+	}
+	pending, err := c.journal.pending()
+	if err != nil {
+		log.Printf("telegram: reading queued replies: %v", err)
+	}
+	if len(pending) > 0 {
+		log.Printf("telegram: sending %d replies queued before the restart", len(pending))
+	}
+	for _, out := range pending {
+		if !enqueue(out) {
+			return
+		}
+	}
+	for {
+		select {
+		case <-c.ctx.Done():
+			log.Println("telegram: stopping outbound sender")
+			return
+		case out := <-c.outCh:
+			// Nothing of a private chat is written to disk.
+			if !out.Partial && !out.Private {
+				if err := c.journal.add(out); err != nil {
+					log.Printf("telegram: journalling reply: %v", err)
+				}
+			}
+			if !enqueue(out) {
+				return
+			}
+		}
+	}
+}
+
+// runChat sends the messages queued for one chat, one at a time. With
+// coalescing enabled, text messages arriving within the window are merged
+// into one send (see coalesceOutbound).
+func (c *telegramClient) runChat(q <-chan chat.Outbound) {
+	fits := func(s string) bool { return telegramFits(s, telegramMaxMessage) }
+	var next *chat.Outbound
+	for {
+		var out chat.Outbound
+		if next != nil {
+			out, next = *next, nil
+		} else {
 			select {
-			case <-ctx.Done():
-				log.Println("telegram: stopping outbound sender")
+			case <-c.ctx.Done():
 				return
-			case out := <-outCh:
-				u := base + "/sendMessage"
-				v := url.Values{}
-				v.Set("chat_id", out.ChatID)
-				v.Set("text", formatTelegramMarkdownV2(out.Content))
-				v.Set("parse_mode", "MarkdownV2")
-				resp, err := client.PostForm(u, v)
-				if err != nil {
-					log.Printf("telegram sendMessage error: %v", err)
-					continue
-				}
-				body, _ := io.ReadAll(resp.Body)
-				resp.Body.Close()
+			case out = <-q:
+			}
+		}
+		var n int
+		out, n, next = coalesceOutbound(c.ctx, q, out, c.coalesce, fits)
+		c.send(out)
+		if !out.Partial && !out.Private {
+			if err := c.journal.ack(out.ChatID, n); err != nil {
+				log.Printf("telegram: clearing sent reply from journal: %v", err)
+			}
+		}
+	}
+}
 
-				if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-					log.Printf("telegram sendMessage http error: status=%s body=%s", resp.Status, string(body))
-					continue
-				}
+// send delivers one outbound message: the text first (if any), then the
+// sticker named by Metadata["sticker"] and the poll in Metadata["poll"], then
+// each attachment as a photo or document. When out.ReplyTo is set, the first
+// request is sent as a reply to that message. Text longer than a Telegram
+// message is split into several, sent in order. The final message of a
+// streamed reply replaces the text of its placeholder instead of sending a new
+// one.
+func (c *telegramClient) send(out chat.Outbound) {
+	if out.Partial {
+		c.sendPartial(out)
+		return
+	}
+	replyTo := out.ReplyTo
+	c.mu.Lock()
+	st := c.streams[out.StreamID]
+	delete(c.streams, out.StreamID)
+	c.mu.Unlock()
+	var sentIDs []int64 // for out.DeleteAfter
+	var failures []string
+	textFailed := false
+	for i, chunk := range splitTelegramMessage(out.Content, telegramMaxMessage) {
+		v := url.Values{}
+		c.setText(v, chunk)
+		method := "sendMessage"
+		if i == 0 && st != nil {
+			method = "editMessageText"
+			v.Set("chat_id", telegramBaseChat(out.ChatID))
+			v.Set("message_id", strconv.FormatInt(st.messageID, 10))
+		} else {
+			setTelegramChat(v, out.ChatID)
+			setTelegramReply(v, replyTo)
+		}
+		replyTo = ""
+		var sent telegramMessage
+		err := c.withSendRetry(func() error { return c.call(method, v, &sent) })
+		if isTelegramParseError(err) {
+			// The escaping heuristics missed something: send the raw text
+			// unformatted rather than not at all.
+			log.Printf("telegram %s: %s rejected (%v), resending as plain text", method, c.parseMode, err)
+			if c.format != nil {
+				v.Set("text", chunk)
+			}
+			v.Del("parse_mode")
+			v.Del("entities")
+			err = c.withSendRetry(func() error { return c.call(method, v, &sent) })
+		}
+		if method == "editMessageText" && isTelegramNotModified(err) {
+			// The last snapshot already shows the final text.
+			err = nil
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", method, err))
+			textFailed = true
+		} else if method == "editMessageText" {
+			sentIDs = append(sentIDs, st.messageID)
+		} else {
+			sentIDs = append(sentIDs, sent.MessageID)
+		}
+	}
+	if emoji, _ := out.Metadata["sticker"].(string); emoji != "" {
+		v := url.Values{}
+		setTelegramChat(v, out.ChatID)
+		method := "sendSticker"
+		if id, ok := c.sticker(emoji); ok {
+			v.Set("sticker", id)
+		} else {
+			// No matching sticker: the emoji itself is the next best thing,
+			// unless the reply already has text.
+			method = "sendMessage"
+			v.Set("text", emoji)
+		}
+		if method == "sendSticker" || out.Content == "" {
+			setTelegramReply(v, replyTo)
+			replyTo = ""
+			var sent telegramMessage
+			if err := c.withSendRetry(func() error { return c.call(method, v, &sent) }); err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %v", method, err))
+			} else {
+				sentIDs = append(sentIDs, sent.MessageID)
+			}
+		}
+	}
+	if p, ok := out.Metadata["poll"].(chat.Poll); ok {
+		c.sendPoll(out.ChatID, replyTo, p)
+		replyTo = ""
+	}
+	for _, path := range out.Media {
+		method, field := "sendDocument", "document"
+		if telegramPhotoExts[strings.ToLower(filepath.Ext(path))] {
+			method, field = "sendPhoto", "photo"
+		}
+		v := url.Values{}
+		setTelegramChat(v, out.ChatID)
+		setTelegramReply(v, replyTo)
+		replyTo = ""
+		var sent telegramMessage
+		if err := c.withSendRetry(func() error { return c.upload(method, v, field, path, &sent) }); err != nil {
+			failures = append(failures, fmt.Sprintf("%s %s: %v", method, path, err))
+		} else {
+			sentIDs = append(sentIDs, sent.MessageID)
+		}
+	}
+	if pin, _ := out.Metadata["pin"].(bool); pin && len(sentIDs) > 0 {
+		notify, _ := out.Metadata["pin_notify"].(bool)
+		c.pin(out.ChatID, sentIDs[0], notify)
+	}
+	if unpin, _ := out.Metadata["unpin"].(bool); unpin {
+		c.unpin(out.ChatID)
+	}
+	c.chatActions(out)
+	if len(failures) > 0 {
+		c.deadLetter(out, failures)
+	}
+	// A fallback for a channel post would be published in the channel.
+	if post, _ := out.Metadata["channel_post"].(bool); textFailed && !post {
+		c.hub.ReportUndelivered(out, strings.Join(failures, "; "))
+	}
+	if d := out.DeleteAfter(); d > 0 && len(sentIDs) > 0 {
+		c.deleteLater(out.ChatID, sentIDs, d)
+	}
+	// A reply that did not go out must not look answered.
+	if c.reactDone != "" && !textFailed && len(sentIDs) > 0 {
+		c.react(out.ChatID, out.ReplyTo, c.reactDone)
+	}
+}
 
-				var apiResp struct {
-					Ok          bool   `json:"ok"`
-					Description string `json:"description"`
-				}
-				if err := json.Unmarshal(body, &apiResp); err != nil {
-					log.Printf("telegram sendMessage invalid json response: %v body=%s", err, string(body))
-					continue
-				}
-				if !apiResp.Ok {
-					log.Printf("telegram sendMessage api error: %s", apiResp.Description)
-					continue
-				}
+// setText sets the text of a message from the agent's Markdown: rendered
+// for the parse mode, or as plain text and its entities.
+func (c *telegramClient) setText(v url.Values, md string) {
+	if c.format == nil {
+		text, entities := telegramEntities(md)
+		v.Set("text", text)
+		if len(entities) > 0 {
+			b, _ := json.Marshal(entities)
+			v.Set("entities", string(b))
+		}
+		return
+	}
+	v.Set("text", c.format(md))
+	v.Set("parse_mode", c.parseMode)
+}
+
+// deleteLater deletes the given messages of chatID after d, for replies
+// marked as self-destructing. Pending deletions do not survive a restart.
+func (c *telegramClient) deleteLater(chatID string, ids []int64, d time.Duration) {
+	time.AfterFunc(d, func() {
+		for _, id := range ids {
+			v := url.Values{}
+			v.Set("chat_id", telegramBaseChat(chatID))
+			v.Set("message_id", strconv.FormatInt(id, 10))
+			if err := c.withRetry(func() error { return c.call("deleteMessage", v, nil) }); err != nil {
+				log.Printf("telegram deleteMessage %v", err)
 			}
 		}
-	}()
+	})
+}
+
+// sendPartial shows a snapshot of a reply that is still being generated. The
+// first snapshot is sent as a new (placeholder) message; later ones edit it,
+// at most once per editInterval. Snapshots are sent as plain text because
+// half-generated markdown is rarely well formed.
+func (c *telegramClient) sendPartial(out chat.Outbound) {
+	text := out.Content
+	if r := []rune(text); len(r) > telegramMaxPartial {
+		text = string(r[:telegramMaxPartial]) + "…"
+	}
+	c.mu.Lock()
+	st := c.streams[out.StreamID]
+	c.mu.Unlock()
+	if st == nil {
+		if strings.TrimSpace(text) == "" {
+			text = "…"
+		}
+		v := url.Values{}
+		setTelegramChat(v, out.ChatID)
+		v.Set("text", text)
+		setTelegramReply(v, out.ReplyTo)
+		var sent struct {
+			MessageID int64 `json:"message_id"`
+		}
+		if err := c.call("sendMessage", v, &sent); err != nil {
+			log.Printf("telegram sendMessage %v", err)
+			return
+		}
+		c.mu.Lock()
+		c.streams[out.StreamID] = &telegramStream{messageID: sent.MessageID, shown: text, lastEdit: time.Now()}
+		c.mu.Unlock()
+		return
+	}
+	if strings.TrimSpace(text) == "" || text == st.shown || time.Since(st.lastEdit) < c.editInterval {
+		return
+	}
+	v := url.Values{}
+	v.Set("chat_id", telegramBaseChat(out.ChatID))
+	v.Set("message_id", strconv.FormatInt(st.messageID, 10))
+	v.Set("text", text)
+	st.lastEdit = time.Now()
+	if err := c.call("editMessageText", v, nil); err != nil && !isTelegramNotModified(err) {
+		// Snapshots are not retried; when rate limited, hold off further
+		// edits for as long as Telegram asks.
+		var apiErr *telegramAPIError
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+			st.lastEdit = time.Now().Add(apiErr.RetryAfter)
+		}
+		log.Printf("telegram editMessageText %v", err)
+		return
+	}
+	st.shown = text
+}
+
+// setTelegramReply adds reply_parameters referencing messageID to v. The reply
+// is still delivered if the original message was deleted in the meantime.
+func setTelegramReply(v url.Values, messageID string) {
+	id, err := strconv.ParseInt(messageID, 10, 64)
+	if err != nil {
+		return
+	}
+	b, _ := json.Marshal(map[string]interface{}{
+		"message_id":                  id,
+		"allow_sending_without_reply": true,
+	})
+	v.Set("reply_parameters", string(b))
+}
 
+// telegramChatKey returns the picobot chat ID of m. Messages in a forum topic
+// get "<chat>:<topic>", so each topic is its own conversation (with its own
+// session, queue and reminders) and replies go back to the topic.
+func telegramChatKey(m *telegramMessage) string {
+	id := strconv.FormatInt(m.Chat.ID, 10)
+	if m.IsTopicMessage && m.MessageThreadID != 0 {
+		id += ":" + strconv.FormatInt(m.MessageThreadID, 10)
+	}
+	return id
+}
+
+// telegramBaseChat returns the Telegram chat of a picobot chat ID, without its
+// forum topic.
+func telegramBaseChat(chatID string) string {
+	chat, _, _ := strings.Cut(chatID, ":")
+	return chat
+}
+
+// setTelegramChat addresses a new message to the chat (and forum topic) of
+// chatID.
+func setTelegramChat(v url.Values, chatID string) {
+	chat, topic, ok := strings.Cut(chatID, ":")
+	v.Set("chat_id", chat)
+	if ok {
+		v.Set("message_thread_id", topic)
+	}
+}
+
+// call invokes a Bot API method with form-encoded parameters. When result is
+// not nil, the API result is decoded into it.
+func (c *telegramClient) call(method string, v url.Values, result interface{}) error {
+	resp, err := c.sender.PostForm(c.base+"/"+method, v)
+	if err != nil {
+		return fmt.Errorf("error: %w", err)
+	}
+	return checkTelegramResponse(resp, result)
+}
+
+// upload invokes a Bot API method with a multipart body carrying the given
+// parameters plus the file at path in the given form field. When result is
+// not nil, the API result is decoded into it.
+func (c *telegramClient) upload(method string, params url.Values, field, path string, result interface{}) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error: %w", err)
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for k, vs := range params {
+		for _, val := range vs {
+			if err := mw.WriteField(k, val); err != nil {
+				return fmt.Errorf("error: %w", err)
+			}
+		}
+	}
+	fw, err := mw.CreateFormFile(field, filepath.Base(path))
+	if err != nil {
+		return fmt.Errorf("error: %w", err)
+	}
+	if _, err := io.Copy(fw, f); err != nil {
+		return fmt.Errorf("error reading %s: %w", path, err)
+	}
+	if err := mw.Close(); err != nil {
+		return fmt.Errorf("error: %w", err)
+	}
+
+	resp, err := c.sender.Post(c.base+"/"+method, mw.FormDataContentType(), &buf)
+	if err != nil {
+		return fmt.Errorf("error: %w", err)
+	}
+	return checkTelegramResponse(resp, result)
+}
+
+// telegramAPIError is a failure reported by the Bot API itself.
+type telegramAPIError struct {
+	Code        int
+	Description string
+	RetryAfter  time.Duration // set when rate limited (429)
+}
+
+func (e *telegramAPIError) Error() string {
+	return fmt.Sprintf("api error: %s", e.Description)
+}
+
+// isTelegramParseError reports whether err is Telegram rejecting the message
+// formatting ("Bad Request: can't parse entities: ...").
+func isTelegramParseError(err error) bool {
+	var apiErr *telegramAPIError
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusBadRequest && strings.Contains(apiErr.Description, "can't parse entities")
+}
+
+// isTelegramNotModified reports whether err is Telegram refusing an edit that
+// would leave the message as it is ("Bad Request: message is not modified"):
+// the message already shows the text, so the edit did what it should.
+func isTelegramNotModified(err error) bool {
+	var apiErr *telegramAPIError
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusBadRequest && strings.Contains(apiErr.Description, "message is not modified")
+}
+
+// checkTelegramResponse reads and closes resp, returning an error when the
+// HTTP status or the Bot API "ok" flag indicates failure. API failures are
+// returned as *telegramAPIError. On success the "result" field is decoded into
+// result when it is not nil.
+func checkTelegramResponse(resp *http.Response, result interface{}) error {
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	var apiResp struct {
+		Ok          bool            `json:"ok"`
+		ErrorCode   int             `json:"error_code"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+		Parameters  struct {
+			RetryAfter int `json:"retry_after"`
+		} `json:"parameters"`
+	}
+	jsonErr := json.Unmarshal(body, &apiResp)
+	if jsonErr == nil && !apiResp.Ok {
+		return &telegramAPIError{
+			Code:        apiResp.ErrorCode,
+			Description: apiResp.Description,
+			RetryAfter:  time.Duration(apiResp.Parameters.RetryAfter) * time.Second,
+		}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &telegramHTTPError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(body)}
+	}
+	if jsonErr != nil {
+		return fmt.Errorf("invalid json response: %v body=%s", jsonErr, string(body))
+	}
+	if result != nil && len(apiResp.Result) > 0 {
+		if err := json.Unmarshal(apiResp.Result, result); err != nil {
+			return fmt.Errorf("invalid result: %v", err)
+		}
+	}
 	return nil
 }
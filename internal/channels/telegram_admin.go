@@ -0,0 +1,267 @@
+package channels
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+// telegramAccess is the part of the allowlist changed at runtime by admins
+// with /allow, /deny and /role. It is kept in the state file so it survives
+// restarts, on top of the allowFrom list of the config: a user is allowed when
+// not denied and either listed in allowFrom or allowed here (or both lists are
+// empty, i.e. the bot is open to everyone). Roles maps user IDs to their role;
+// those with the admin role may use the admin commands like the configured
+// admins.
+type telegramAccess struct {
+	Allow []string          `json:"allow,omitempty"`
+	Deny  []string          `json:"deny,omitempty"`
+	Roles map[string]string `json:"roles,omitempty"`
+}
+
+// Roles given with /role set. A user has roleUser unless made an admin.
+const (
+	roleAdmin = "admin"
+	roleUser  = "user"
+)
+
+// loadAccess reads the runtime allowlist from the state file, if any.
+func (c *telegramClient) loadAccess() {
+	if c.statePath == "" {
+		return
+	}
+	data, err := os.ReadFile(c.statePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("telegram: reading %s: %v", c.statePath, err)
+		}
+		return
+	}
+	if err := json.Unmarshal(data, &c.access); err != nil {
+		log.Printf("telegram: invalid state file %s: %v", c.statePath, err)
+	}
+}
+
+// saveAccess writes the runtime allowlist to the state file. Called with mu held.
+func (c *telegramClient) saveAccess() error {
+	if c.statePath == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(c.access, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.statePath), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(c.statePath, data, 0o600)
+}
+
+// isAdmin reports whether userID is one of the configured admins or was
+// given the admin role.
+func (c *telegramClient) isAdmin(userID string) bool {
+	if _, ok := c.admins[userID]; ok {
+		return true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.access.Roles[userID] == roleAdmin
+}
+
+// isAllowed reports whether userID may talk to the bot. Admins always may.
+// The allowFrom patterns are matched against the ID and the "@username" of
+// user, when known.
+func (c *telegramClient) isAllowed(userID string, user *telegramUser) bool {
+	if c.isAdmin(userID) {
+		return true
+	}
+	ids := []string{userID}
+	if user != nil && user.Username != "" {
+		ids = append(ids, "@"+user.Username)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if slices.Contains(c.access.Deny, userID) || c.allowed.Deny.Match(ids...) {
+		return false
+	}
+	if c.allowed.Open() && len(c.access.Allow) == 0 {
+		return true
+	}
+	return c.allowed.Allow.Match(ids...) || slices.Contains(c.access.Allow, userID)
+}
+
+// handleAdminCommand answers /allow, /deny and /role from an admin and
+// reports whether text was one of them. The other admin commands (/usage,
+// /restart) are answered by the agent.
+func (c *telegramClient) handleAdminCommand(userID, chatID, messageID, text string) bool {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !c.isAdmin(userID) {
+		return false
+	}
+	var reply string
+	switch cmd, args := strings.ToLower(fields[0]), fields[1:]; cmd {
+	case "/allow":
+		// "/allow <ids>" is short for "/allow add <ids>".
+		sub := "add"
+		if len(args) > 0 && slices.Contains([]string{"add", "remove", "list"}, strings.ToLower(args[0])) {
+			sub, args = strings.ToLower(args[0]), args[1:]
+		}
+		switch {
+		case sub == "list" || len(args) == 0:
+			reply = c.listAccess()
+		case sub == "add":
+			reply = c.changeAccess("allow", args)
+		default:
+			reply = c.changeAccess("remove", args)
+		}
+	case "/deny":
+		if len(args) == 0 {
+			reply = c.listAccess()
+		} else {
+			reply = c.changeAccess("deny", args)
+		}
+	case "/role":
+		reply = c.setRole(args)
+	default:
+		return false
+	}
+	c.hub.Out <- chat.Outbound{Channel: "telegram", ChatID: chatID, ReplyTo: messageID, Content: reply}
+	return true
+}
+
+// checkUserIDs returns the reply refusing the first of ids that is not a
+// Telegram user ID, or "" when all are.
+func checkUserIDs(ids []string) string {
+	for _, id := range ids {
+		if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+			return fmt.Sprintf("%q is not a Telegram user ID (a number, e.g. 8881234567).", id)
+		}
+	}
+	return ""
+}
+
+// listAccess returns the effective allowlist and roles.
+func (c *telegramClient) listAccess() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.describeAccess()
+}
+
+// changeAccess applies an allow, remove or deny of the user IDs args and
+// returns the reply. Removing a user only listed in the allowFrom of the
+// config denies them, since the config cannot be changed from the chat.
+func (c *telegramClient) changeAccess(op string, args []string) string {
+	if reply := checkUserIDs(args); reply != "" {
+		return reply
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, id := range args {
+		switch op {
+		case "allow":
+			c.access.Deny = slices.DeleteFunc(c.access.Deny, func(s string) bool { return s == id })
+			if !c.allowed.Allow.Match(id) && !slices.Contains(c.access.Allow, id) {
+				c.access.Allow = append(c.access.Allow, id)
+			}
+		case "remove":
+			c.access.Allow = slices.DeleteFunc(c.access.Allow, func(s string) bool { return s == id })
+			if c.allowed.Allow.Match(id) && !slices.Contains(c.access.Deny, id) {
+				c.access.Deny = append(c.access.Deny, id)
+			}
+		case "deny":
+			c.access.Allow = slices.DeleteFunc(c.access.Allow, func(s string) bool { return s == id })
+			if !slices.Contains(c.access.Deny, id) {
+				c.access.Deny = append(c.access.Deny, id)
+			}
+		}
+	}
+	if err := c.saveAccess(); err != nil {
+		log.Printf("telegram: saving %s: %v", c.statePath, err)
+		return "Changed for now, but couldn't save it: " + err.Error()
+	}
+	verb := map[string]string{"allow": "Allowed", "remove": "Removed", "deny": "Denied"}[op]
+	return fmt.Sprintf("%s %s.\n\n%s", verb, strings.Join(args, ", "), c.describeAccess())
+}
+
+// setRole applies "/role set <ids> <role>" and returns the reply.
+func (c *telegramClient) setRole(args []string) string {
+	const usage = "Usage: /role set <user ID>... admin|user"
+	if len(args) < 3 || strings.ToLower(args[0]) != "set" {
+		return usage
+	}
+	ids, role := args[1:len(args)-1], strings.ToLower(args[len(args)-1])
+	if role != roleAdmin && role != roleUser {
+		return fmt.Sprintf("Unknown role %q. %s", role, usage)
+	}
+	if reply := checkUserIDs(ids); reply != "" {
+		return reply
+	}
+	for _, id := range ids {
+		if _, ok := c.admins[id]; ok && role != roleAdmin {
+			return fmt.Sprintf("%s is an admin in the config (telegram.admins); remove them there instead.", id)
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, id := range ids {
+		if role == roleUser {
+			delete(c.access.Roles, id)
+			continue
+		}
+		if c.access.Roles == nil {
+			c.access.Roles = make(map[string]string)
+		}
+		c.access.Roles[id] = role
+	}
+	if err := c.saveAccess(); err != nil {
+		log.Printf("telegram: saving %s: %v", c.statePath, err)
+		return "Changed for now, but couldn't save it: " + err.Error()
+	}
+	return fmt.Sprintf("Role of %s set to %s.\n\n%s", strings.Join(ids, ", "), role, c.describeAccess())
+}
+
+// describeAccess summarizes the effective allowlist and the admins. Called
+// with mu held. It says Telegram, since the other channels' allowlists are
+// not changed from the chat.
+func (c *telegramClient) describeAccess() string {
+	allowed := slices.Clone(c.allowed.Allow.Entries())
+	allowed = append(allowed, c.access.Allow...)
+	slices.Sort(allowed)
+	allowed = slices.Compact(allowed)
+	allowed = slices.DeleteFunc(allowed, func(id string) bool { return slices.Contains(c.access.Deny, id) })
+
+	var b strings.Builder
+	if c.allowed.Open() && len(c.access.Allow) == 0 {
+		b.WriteString("Open to everyone on Telegram.")
+	} else {
+		fmt.Fprintf(&b, "Allowed on Telegram: %s", strings.Join(allowed, ", "))
+		if len(allowed) == 0 {
+			b.WriteString("nobody but admins")
+		}
+	}
+	denied := append(slices.Clone(c.allowed.Deny.Entries()), c.access.Deny...)
+	if len(denied) > 0 {
+		fmt.Fprintf(&b, "\nDenied: %s", strings.Join(denied, ", "))
+	}
+	admins := make([]string, 0, len(c.admins)+len(c.access.Roles))
+	for id := range c.admins {
+		admins = append(admins, id)
+	}
+	for id, role := range c.access.Roles {
+		if role == roleAdmin {
+			admins = append(admins, id)
+		}
+	}
+	slices.Sort(admins)
+	if admins = slices.Compact(admins); len(admins) > 0 {
+		fmt.Fprintf(&b, "\nAdmins: %s", strings.Join(admins, ", "))
+	}
+	return b.String()
+}
@@ -0,0 +1,68 @@
+package channels
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/local/picobot/internal/config"
+)
+
+// Defaults of config.TelegramPolling.
+const (
+	telegramPollTimeout   = 30 * time.Second
+	telegramBackoffMin    = time.Second
+	telegramBackoffMax    = time.Minute
+	telegramBackoffFactor = 2.0
+	telegramBackoffJitter = 0.2
+)
+
+// telegramBackoff computes the delay before retrying getUpdates after
+// consecutive failures: min, growing by factor per failure up to max, each
+// randomized by ±jitter so that many bots recovering from the same outage do
+// not retry in lockstep.
+type telegramBackoff struct {
+	min, max       time.Duration
+	factor, jitter float64
+	failures       int
+}
+
+func newTelegramBackoff(p config.TelegramPolling) *telegramBackoff {
+	b := &telegramBackoff{
+		min:    time.Duration(p.BackoffMinMs) * time.Millisecond,
+		max:    time.Duration(p.BackoffMaxMs) * time.Millisecond,
+		factor: p.BackoffFactor,
+		jitter: p.Jitter,
+	}
+	if b.min <= 0 {
+		b.min = telegramBackoffMin
+	}
+	if b.max <= 0 {
+		b.max = telegramBackoffMax
+	}
+	if b.max < b.min {
+		b.max = b.min
+	}
+	if b.factor < 1 {
+		b.factor = telegramBackoffFactor
+	}
+	if b.jitter <= 0 || b.jitter >= 1 {
+		b.jitter = telegramBackoffJitter
+	}
+	return b
+}
+
+// next records a failure and returns how long to wait. A retry delay asked for
+// by Telegram (429 retry_after) is honoured when it is longer.
+func (b *telegramBackoff) next(retryAfter time.Duration) time.Duration {
+	d := float64(b.min) * math.Pow(b.factor, float64(b.failures))
+	d = math.Min(d, float64(b.max))
+	b.failures++
+	d *= 1 + b.jitter*(2*rand.Float64()-1)
+	return max(time.Duration(d), retryAfter)
+}
+
+// reset is called after a successful poll.
+func (b *telegramBackoff) reset() {
+	b.failures = 0
+}
@@ -0,0 +1,223 @@
+package channels
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// telegramEntity is a Bot API MessageEntity: formatting applied to a span
+// of the text, measured in UTF-16 code units.
+type telegramEntity struct {
+	Type          string `json:"type"`
+	Offset        int    `json:"offset"`
+	Length        int    `json:"length"`
+	URL           string `json:"url,omitempty"`
+	Language      string `json:"language,omitempty"`
+	CustomEmojiID string `json:"custom_emoji_id,omitempty"`
+}
+
+var (
+	entityLinkRE  = regexp.MustCompile(`^\[([^\]\n]+)\]\(([^)\s]+)\)`)
+	entityEmojiRE = regexp.MustCompile(`^!\[([^\]\n]+)\]\(tg://emoji\?id=(\d+)\)`)
+)
+
+// entityDelims are the paired inline markers, longest first, and the
+// entity each stands for.
+var entityDelims = []struct{ delim, kind string }{
+	{"**", "bold"},
+	{"__", "bold"},
+	{"~~", "strikethrough"},
+	{"||", "spoiler"},
+	{"*", "italic"},
+	{"_", "italic"},
+}
+
+// telegramEntities parses the Markdown an LLM typically produces into plain
+// text and the entities that format it, so a reply can be sent without
+// parse_mode and nothing needs escaping. It understands what the HTML
+// renderer does (code blocks with their language, inline code, bold,
+// italic, strikethrough, links, headings) plus ||spoilers||, "> " quotes,
+// ">> " expandable quotes and custom emoji written as ![👍](tg://emoji?id=…).
+func telegramEntities(s string) (string, []telegramEntity) {
+	var b entityBuilder
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	quoteKind, quoteStart := "", 0 // entity type and offset of the open quote
+	closeQuote := func() {
+		if quoteKind != "" {
+			b.entity(telegramEntity{Type: quoteKind}, quoteStart)
+			quoteKind = ""
+		}
+	}
+	kindOf := func(line string) (kind string, marker string) {
+		m, expandable := quoteMarker(line)
+		switch {
+		case expandable:
+			return "expandable_blockquote", m
+		case m != "":
+			return "blockquote", m
+		}
+		return "", ""
+	}
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if lang, ok := strings.CutPrefix(strings.TrimSpace(line), "```"); ok {
+			closeQuote()
+			var code []string
+			for i++; i < len(lines) && strings.TrimSpace(lines[i]) != "```"; i++ {
+				code = append(code, lines[i])
+			}
+			start := b.n
+			b.text(strings.Join(code, "\n"))
+			b.entity(telegramEntity{Type: "pre", Language: strings.TrimSpace(lang)}, start)
+		} else if kind, m := kindOf(line); kind != "" {
+			if kind != quoteKind {
+				closeQuote()
+				quoteKind, quoteStart = kind, b.n
+			}
+			b.inline(line[len(m):])
+		} else {
+			closeQuote()
+			if h := htmlHeadingRE.FindStringSubmatch(line); h != nil {
+				start := b.n
+				b.inline(strings.Trim(h[1], "*"))
+				b.entity(telegramEntity{Type: "bold"}, start)
+			} else {
+				b.inline(line)
+			}
+		}
+		if i < len(lines)-1 {
+			if next, _ := kindOf(lines[i+1]); next != quoteKind {
+				closeQuote()
+			}
+			b.text("\n")
+		}
+	}
+	closeQuote()
+	sort.SliceStable(b.entities, func(i, j int) bool {
+		if b.entities[i].Offset != b.entities[j].Offset {
+			return b.entities[i].Offset < b.entities[j].Offset
+		}
+		return b.entities[i].Length > b.entities[j].Length
+	})
+	return b.sb.String(), b.entities
+}
+
+// entityBuilder accumulates the plain text and its entities.
+type entityBuilder struct {
+	sb       strings.Builder
+	n        int // length of sb in UTF-16 code units
+	entities []telegramEntity
+}
+
+func (b *entityBuilder) text(s string) {
+	b.sb.WriteString(s)
+	b.n += len(utf16.Encode([]rune(s)))
+}
+
+// entity adds e spanning from start to the end of the text so far; empty
+// spans are dropped.
+func (b *entityBuilder) entity(e telegramEntity, start int) {
+	if b.n > start {
+		e.Offset, e.Length = start, b.n-start
+		b.entities = append(b.entities, e)
+	}
+}
+
+// inline writes one line of inline markup, recursing into the content of
+// links and paired markers.
+func (b *entityBuilder) inline(s string) {
+	for i := 0; i < len(s); {
+		rest := s[i:]
+		if rest[0] == '`' {
+			if end := strings.IndexByte(rest[1:], '`'); end > 0 {
+				start := b.n
+				b.text(rest[1 : 1+end])
+				b.entity(telegramEntity{Type: "code"}, start)
+				i += end + 2
+				continue
+			}
+		}
+		if m := entityEmojiRE.FindStringSubmatch(rest); m != nil {
+			start := b.n
+			b.text(m[1])
+			b.entity(telegramEntity{Type: "custom_emoji", CustomEmojiID: m[2]}, start)
+			i += len(m[0])
+			continue
+		}
+		if m := entityLinkRE.FindStringSubmatch(rest); m != nil {
+			start := b.n
+			b.inline(m[1])
+			b.entity(telegramEntity{Type: "text_link", URL: m[2]}, start)
+			i += len(m[0])
+			continue
+		}
+		if d, kind, inner, ok := pairedMarker(s, i); ok {
+			start := b.n
+			b.inline(inner)
+			b.entity(telegramEntity{Type: kind}, start)
+			i += 2*len(d) + len(inner)
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(rest)
+		b.text(rest[:size])
+		i += size
+	}
+}
+
+// pairedMarker reports whether a paired marker (**bold**, _italic_, ...)
+// opens at s[i], and returns it with the entity type and the text it
+// encloses. Content must not start or end with a space, and underscores
+// only count outside words, so snake_case stays as it is.
+func pairedMarker(s string, i int) (delim, kind, inner string, ok bool) {
+	for _, d := range entityDelims {
+		if !strings.HasPrefix(s[i:], d.delim) {
+			continue
+		}
+		if d.delim[0] == '_' && i > 0 && isWordRune(lastRune(s[:i])) {
+			return "", "", "", false
+		}
+		body := s[i+len(d.delim):]
+		for j := 0; j < len(body); {
+			end := strings.Index(body[j:], d.delim)
+			if end < 0 {
+				break
+			}
+			end += j
+			content := body[:end]
+			after := body[end+len(d.delim):]
+			// A single * or _ must not close on half of a double one.
+			double := len(d.delim) == 1 && strings.HasPrefix(after, d.delim)
+			boundary := d.delim[0] != '_' || after == "" || !isWordRune(firstRune(after))
+			if content != "" && !double && boundary &&
+				!unicode.IsSpace(firstRune(content)) && !unicode.IsSpace(lastRune(content)) {
+				return d.delim, d.kind, content, true
+			}
+			j = end + len(d.delim)
+			if double {
+				j++
+			}
+		}
+		if len(d.delim) == 1 {
+			return "", "", "", false
+		}
+	}
+	return "", "", "", false
+}
+
+func firstRune(s string) rune {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r
+}
+
+func lastRune(s string) rune {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return r
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
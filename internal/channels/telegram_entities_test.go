@@ -0,0 +1,74 @@
+package channels
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+)
+
+func TestTelegramEntities(t *testing.T) {
+	cases := []struct {
+		in       string
+		text     string
+		entities []telegramEntity
+	}{
+		{"plain snake_case and 2 * 3 * 4", "plain snake_case and 2 * 3 * 4", nil},
+		{"**bold _and italic_** done", "bold and italic done", []telegramEntity{
+			{Type: "bold", Offset: 0, Length: 15},
+			{Type: "italic", Offset: 5, Length: 10},
+		}},
+		{"a ||secret|| and ~~old~~", "a secret and old", []telegramEntity{
+			{Type: "spoiler", Offset: 2, Length: 6},
+			{Type: "strikethrough", Offset: 13, Length: 3},
+		}},
+		// Offsets count UTF-16 code units: the emoji takes two.
+		{"😀 [site](https://example.com) `x*y*`", "😀 site x*y*", []telegramEntity{
+			{Type: "text_link", Offset: 3, Length: 4, URL: "https://example.com"},
+			{Type: "code", Offset: 8, Length: 4},
+		}},
+		{"## Title\n> one\n> two\nafter", "Title\none\ntwo\nafter", []telegramEntity{
+			{Type: "bold", Offset: 0, Length: 5},
+			{Type: "blockquote", Offset: 6, Length: 7},
+		}},
+		{"> seen\n>> hidden\n>> more", "seen\nhidden\nmore", []telegramEntity{
+			{Type: "blockquote", Offset: 0, Length: 4},
+			{Type: "expandable_blockquote", Offset: 5, Length: 11},
+		}},
+		{"```go\nx := 1\n```", "x := 1", []telegramEntity{
+			{Type: "pre", Offset: 0, Length: 6, Language: "go"},
+		}},
+		{"nice ![👍](tg://emoji?id=5368324170671202286)", "nice 👍", []telegramEntity{
+			{Type: "custom_emoji", Offset: 5, Length: 2, CustomEmojiID: "5368324170671202286"},
+		}},
+	}
+	for _, c := range cases {
+		text, entities := telegramEntities(c.in)
+		if text != c.text || !reflect.DeepEqual(entities, c.entities) {
+			t.Errorf("telegramEntities(%q) =\n  %q %+v\nwant\n  %q %+v", c.in, text, entities, c.text, c.entities)
+		}
+	}
+}
+
+func TestTelegramEntitiesParseMode(t *testing.T) {
+	sent := make(chan url.Values, 1)
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		sent <- r.PostForm
+		w.Write([]byte(`{"ok":true,"result":{}}`))
+	}))
+	defer h.Close()
+
+	c := newTelegramClient(context.Background(), chat.NewHub(10), h.URL+"/bottok", config.TelegramConfig{ParseMode: "entities"})
+	c.send(chat.Outbound{ChatID: "1", Content: "**done**."})
+
+	v := <-sent
+	if v.Get("parse_mode") != "" || v.Get("text") != "done." || v.Get("entities") != `[{"type":"bold","offset":0,"length":4}]` {
+		t.Fatalf("unexpected entities send: %v", v)
+	}
+}
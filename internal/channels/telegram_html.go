@@ -0,0 +1,99 @@
+package channels
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	htmlInlineCodeRE = regexp.MustCompile("`([^`\n]+)`")
+	htmlLinkRE       = regexp.MustCompile(`\[([^\]\n]+)\]\(([^)\s]+)\)`)
+	htmlBoldRE       = regexp.MustCompile(`\*\*([^*\n]+)\*\*|__([^_\n]+)__`)
+	htmlItalicRE     = regexp.MustCompile(`\*([^*\s](?:[^*\n]*[^*\s])?)\*|(^|[^\p{L}\p{N}_])_([^_\n]+)_($|[^\p{L}\p{N}_])`)
+	htmlStrikeRE     = regexp.MustCompile(`~~([^~\n]+)~~`)
+	htmlHeadingRE    = regexp.MustCompile(`^#{1,6}\s+(.+)$`)
+)
+
+// formatTelegramHTML renders the Markdown an LLM typically produces as
+// Telegram HTML: fenced code blocks become <pre>, "> " quotes <blockquote>
+// (">> " ones expandable), and inline code, bold, italic, strikethrough,
+// ||spoilers||, links and headings get their tags. Everything else is
+// HTML-escaped, so unbalanced markup shows up literally instead of being
+// rejected the way MarkdownV2 rejects it.
+func formatTelegramHTML(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	var b strings.Builder
+	lines := strings.Split(s, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if lang, ok := strings.CutPrefix(strings.TrimSpace(line), "```"); ok {
+			// Collect the block up to the closing fence (or the end).
+			var code []string
+			for i++; i < len(lines) && strings.TrimSpace(lines[i]) != "```"; i++ {
+				code = append(code, lines[i])
+			}
+			if lang = strings.TrimSpace(lang); lang != "" {
+				fmt.Fprintf(&b, `<pre><code class="language-%s">`, html.EscapeString(lang))
+			} else {
+				b.WriteString("<pre><code>")
+			}
+			b.WriteString(html.EscapeString(strings.Join(code, "\n")))
+			b.WriteString("</code></pre>")
+		} else if m, expandable := quoteMarker(line); m != "" {
+			// Consecutive quote lines of the same kind make one blockquote.
+			var quoted []string
+			for {
+				quoted = append(quoted, formatTelegramHTMLLine(line[len(m):]))
+				if i+1 >= len(lines) {
+					break
+				}
+				next, nextExpandable := quoteMarker(lines[i+1])
+				if next == "" || nextExpandable != expandable {
+					break
+				}
+				i++
+				line, m = lines[i], next
+			}
+			if expandable {
+				b.WriteString("<blockquote expandable>")
+			} else {
+				b.WriteString("<blockquote>")
+			}
+			b.WriteString(strings.Join(quoted, "\n"))
+			b.WriteString("</blockquote>")
+		} else {
+			b.WriteString(formatTelegramHTMLLine(line))
+		}
+		if i < len(lines)-1 {
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// formatTelegramHTMLLine formats the inline markup of one line outside code blocks.
+func formatTelegramHTMLLine(line string) string {
+	// Inline code is set aside first so its content is not formatted.
+	var codes []string
+	line = htmlInlineCodeRE.ReplaceAllStringFunc(line, func(m string) string {
+		codes = append(codes, "<code>"+html.EscapeString(m[1:len(m)-1])+"</code>")
+		return fmt.Sprintf("\x00%d\x00", len(codes)-1)
+	})
+	line = html.EscapeString(line)
+
+	if m := htmlHeadingRE.FindStringSubmatch(line); m != nil {
+		line = "**" + m[1] + "**"
+	}
+	line = htmlLinkRE.ReplaceAllString(line, `<a href="$2">$1</a>`)
+	line = htmlBoldRE.ReplaceAllString(line, "<b>$1$2</b>")
+	line = htmlItalicRE.ReplaceAllString(line, "$2<i>$1$3</i>$4")
+	line = htmlStrikeRE.ReplaceAllString(line, "<s>$1</s>")
+	line = spoilerRE.ReplaceAllString(line, "<tg-spoiler>$1</tg-spoiler>")
+
+	for i, c := range codes {
+		line = strings.Replace(line, fmt.Sprintf("\x00%d\x00", i), c, 1)
+	}
+	return line
+}
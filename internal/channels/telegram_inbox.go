@@ -0,0 +1,108 @@
+package channels
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+// telegramMaxDownload is the largest file the Bot API lets bots download.
+const telegramMaxDownload = 20 << 20
+
+// inboxDir is the workspace directory received files are saved in, one
+// subdirectory per channel and chat.
+const inboxDir = "inbox"
+
+// attachDocument saves document f of message in into the chat's inbox and
+// adds it to the message. The agent is only told when it could not be
+// saved: the error, which may carry the bot's token, is logged redacted.
+func (c *telegramClient) attachDocument(in *chat.Inbound, f *telegramFile) {
+	rel, abs, err := c.saveDocument(in.ChatID, f)
+	if err != nil {
+		log.Printf("telegram: saving document: %s", c.redact(err.Error()))
+		in.Content += "\n[not saved]"
+		return
+	}
+	in.Metadata["file_path"] = rel
+	in.Media = append(in.Media, abs)
+	in.Content += "\n[saved as " + rel + " in the workspace]"
+}
+
+// redact hides the bot's token in s, e.g. an error naming a Bot API URL.
+func (c *telegramClient) redact(s string) string {
+	if _, token, ok := strings.Cut(c.base, "/bot"); ok && token != "" {
+		s = strings.ReplaceAll(s, token, "<token>")
+	}
+	return s
+}
+
+// saveDocument downloads a document sent to chatID into the chat's inbox in
+// the workspace and returns its path relative to the workspace, for the
+// agent's file tools, and its absolute path. An existing file of the same
+// name is kept: the new one gets a numbered name.
+func (c *telegramClient) saveDocument(chatID string, f *telegramFile) (rel, abs string, err error) {
+	if f.FileSize > c.inboxMax {
+		return "", "", fmt.Errorf("%s is larger than %s", f.FileName, formatFileSize(c.inboxMax))
+	}
+	v := url.Values{}
+	v.Set("file_id", f.FileID)
+	var file struct {
+		FilePath string `json:"file_path"`
+	}
+	if err := c.withRetry(func() error { return c.call("getFile", v, &file) }); err != nil {
+		return "", "", fmt.Errorf("getFile: %w", err)
+	}
+	// Files are served from /file/bot<token>/<file_path>.
+	u := strings.Replace(c.base, "/bot", "/file/bot", 1) + "/" + file.FilePath
+	resp, err := c.sender.Get(u)
+	if err != nil {
+		return "", "", fmt.Errorf("download: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("download: %s", resp.Status)
+	}
+
+	name := filepath.Base(filepath.Clean("/" + f.FileName))
+	if name == "/" || name == "." {
+		name = path.Base(file.FilePath)
+	}
+	dir := filepath.Join(inboxDir, "telegram", telegramBaseChat(chatID))
+	if err := os.MkdirAll(filepath.Join(c.inbox, dir), 0o755); err != nil {
+		return "", "", err
+	}
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		rel = filepath.Join(dir, name)
+		out, err := os.OpenFile(filepath.Join(c.inbox, rel), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if os.IsExist(err) {
+			name = fmt.Sprintf("%s-%d%s", stem, i, ext)
+			continue
+		}
+		if err != nil {
+			return "", "", err
+		}
+		_, err = io.Copy(out, io.LimitReader(resp.Body, c.inboxMax))
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		abs = filepath.Join(c.inbox, rel)
+		if err != nil {
+			os.Remove(abs)
+			return "", "", fmt.Errorf("download: %w", err)
+		}
+		if a, err := filepath.Abs(abs); err == nil {
+			abs = a
+		}
+		return rel, abs, nil
+	}
+}
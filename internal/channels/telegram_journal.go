@@ -0,0 +1,107 @@
+package channels
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+// telegramJournal keeps the outbound messages accepted from the hub until
+// they are sent, in a SQLite database, so replies queued when the process
+// dies go out when it starts again. Delivery is at least once: a message
+// being sent during a crash is sent again. A nil journal keeps nothing.
+type telegramJournal struct {
+	db *sql.DB
+}
+
+func openTelegramJournal(path string) (*telegramJournal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(wal)")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS outbox (
+		id      INTEGER PRIMARY KEY AUTOINCREMENT,
+		chat_id TEXT NOT NULL,
+		message TEXT NOT NULL
+	)`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("telegram journal: %w", err)
+	}
+	return &telegramJournal{db: db}, nil
+}
+
+// add records out as waiting to be sent.
+func (j *telegramJournal) add(out chat.Outbound) error {
+	if j == nil {
+		return nil
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		return err
+	}
+	_, err = j.db.Exec(`INSERT INTO outbox (chat_id, message) VALUES (?, ?)`, out.ChatID, string(b))
+	return err
+}
+
+// ack forgets the n oldest messages of the chat, once they are sent. Each
+// chat's messages are sent in the order they were added.
+func (j *telegramJournal) ack(chatID string, n int) error {
+	if j == nil {
+		return nil
+	}
+	_, err := j.db.Exec(`DELETE FROM outbox WHERE id IN (SELECT id FROM outbox WHERE chat_id = ? ORDER BY id LIMIT ?)`, chatID, n)
+	return err
+}
+
+// pending returns the messages still waiting to be sent, oldest first.
+func (j *telegramJournal) pending() ([]chat.Outbound, error) {
+	if j == nil {
+		return nil, nil
+	}
+	rows, err := j.db.Query(`SELECT message FROM outbox ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var outs []chat.Outbound
+	for rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		out, err := decodeJournalled(raw)
+		if err != nil {
+			return nil, err
+		}
+		outs = append(outs, out)
+	}
+	return outs, rows.Err()
+}
+
+// decodeJournalled restores a journalled message, including the typed
+// metadata JSON turns into plain maps.
+func decodeJournalled(raw string) (chat.Outbound, error) {
+	var out chat.Outbound
+	if err := json.Unmarshal([]byte(raw), &out); err != nil {
+		return out, err
+	}
+	if p, ok := out.Metadata["poll"]; ok {
+		b, _ := json.Marshal(p)
+		var poll chat.Poll
+		if err := json.Unmarshal(b, &poll); err != nil {
+			return out, err
+		}
+		out.Metadata["poll"] = poll
+	}
+	return out, nil
+}
@@ -0,0 +1,57 @@
+package channels
+
+import (
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+// pin pins a message of chatID, silently unless notify is set. Failures (e.g.
+// the bot may not pin in the group) are only logged.
+func (c *telegramClient) pin(chatID string, messageID int64, notify bool) {
+	v := url.Values{}
+	v.Set("chat_id", telegramBaseChat(chatID))
+	v.Set("message_id", strconv.FormatInt(messageID, 10))
+	v.Set("disable_notification", strconv.FormatBool(!notify))
+	if err := c.withRetry(func() error { return c.call("pinChatMessage", v, nil) }); err != nil {
+		log.Printf("telegram pinChatMessage %v", err)
+	}
+}
+
+// unpin unpins the latest pinned message of chatID.
+func (c *telegramClient) unpin(chatID string) {
+	v := url.Values{}
+	v.Set("chat_id", telegramBaseChat(chatID))
+	if err := c.withRetry(func() error { return c.call("unpinChatMessage", v, nil) }); err != nil {
+		log.Printf("telegram unpinChatMessage %v", err)
+	}
+}
+
+// chatActions performs the chat-ops directives of out: pinning an existing
+// message, and changing the chat's title or description. As with pin,
+// failures (e.g. the bot is not an admin of the group) are only logged.
+func (c *telegramClient) chatActions(out chat.Outbound) {
+	if id, _ := out.Metadata["pin_message"].(string); id != "" {
+		if n, err := strconv.ParseInt(id, 10, 64); err == nil {
+			notify, _ := out.Metadata["pin_notify"].(bool)
+			c.pin(out.ChatID, n, notify)
+		} else {
+			log.Printf("telegram: cannot pin message %q: not a message ID", id)
+		}
+	}
+	for key, method := range map[string]string{"chat_title": "setChatTitle", "chat_description": "setChatDescription"} {
+		value, ok := out.Metadata[key].(string)
+		if !ok {
+			continue
+		}
+		v := url.Values{}
+		v.Set("chat_id", telegramBaseChat(out.ChatID))
+		v.Set(strings.TrimPrefix(key, "chat_"), value)
+		if err := c.withRetry(func() error { return c.call(method, v, nil) }); err != nil {
+			log.Printf("telegram %s %v", method, err)
+		}
+	}
+}
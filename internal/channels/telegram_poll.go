@@ -0,0 +1,104 @@
+package channels
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+// telegramPoll remembers where a poll was sent, since poll_answer updates
+// only carry the poll ID.
+type telegramPoll struct {
+	chatID string
+	poll   chat.Poll
+}
+
+// telegramPollAnswer is the subset of a Bot API PollAnswer that picobot reads.
+type telegramPollAnswer struct {
+	PollID    string        `json:"poll_id"`
+	User      *telegramUser `json:"user"`
+	OptionIDs []int         `json:"option_ids"`
+}
+
+// sendPoll sends p to chatID as a non-anonymous poll, so votes are reported
+// back, and remembers it for handlePollAnswer.
+func (c *telegramClient) sendPoll(chatID, replyTo string, p chat.Poll) {
+	options := make([]map[string]string, len(p.Options))
+	for i, o := range p.Options {
+		options[i] = map[string]string{"text": o}
+	}
+	opts, _ := json.Marshal(options)
+	v := url.Values{}
+	setTelegramChat(v, chatID)
+	v.Set("question", p.Question)
+	v.Set("options", string(opts))
+	v.Set("is_anonymous", "false")
+	if p.MultipleAnswers {
+		v.Set("allows_multiple_answers", "true")
+	}
+	setTelegramReply(v, replyTo)
+	var sent struct {
+		Poll struct {
+			ID string `json:"id"`
+		} `json:"poll"`
+	}
+	if err := c.withSendRetry(func() error { return c.call("sendPoll", v, &sent) }); err != nil {
+		log.Printf("telegram sendPoll %v", err)
+		return
+	}
+	c.mu.Lock()
+	c.polls[sent.Poll.ID] = &telegramPoll{chatID: chatID, poll: p}
+	c.mu.Unlock()
+}
+
+// handlePollAnswer forwards a vote on one of the bot's polls to the agent as a
+// "poll_answer" event in the poll's chat.
+func (c *telegramClient) handlePollAnswer(a *telegramPollAnswer) {
+	c.mu.Lock()
+	tp := c.polls[a.PollID]
+	c.mu.Unlock()
+	if tp == nil {
+		log.Printf("telegram: dropping answer to unknown poll %s", a.PollID)
+		return
+	}
+	voter, fromID := "someone", ""
+	if a.User != nil {
+		fromID = strconv.FormatInt(a.User.ID, 10)
+		voter = fromID
+		if a.User.Username != "" {
+			voter = "@" + a.User.Username
+		}
+	}
+	if !c.isAllowed(fromID, a.User) {
+		log.Printf("telegram: dropping poll answer from unauthorized user %s", fromID)
+		return
+	}
+	var picked []string
+	for _, id := range a.OptionIDs {
+		if id >= 0 && id < len(tp.poll.Options) {
+			picked = append(picked, tp.poll.Options[id])
+		}
+	}
+	content := fmt.Sprintf("[poll %q: %s voted %s]", tp.poll.Question, voter, strings.Join(picked, ", "))
+	if len(picked) == 0 {
+		content = fmt.Sprintf("[poll %q: %s retracted their vote]", tp.poll.Question, voter)
+	}
+	c.hub.In <- chat.Inbound{
+		Channel:   "telegram",
+		SenderID:  fromID,
+		ChatID:    tp.chatID,
+		Content:   content,
+		Timestamp: time.Now(),
+		Metadata: map[string]interface{}{
+			"event":      "poll_answer",
+			"poll_id":    a.PollID,
+			"option_ids": a.OptionIDs,
+		},
+	}
+}
@@ -0,0 +1,44 @@
+package channels
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/local/picobot/internal/useragent"
+)
+
+// telegramTransport returns the transport of the Bot API clients for the
+// configured proxy: an http, https, socks5 or socks5h URL, "direct" to ignore
+// any proxy set in the environment, or "" for the environment's
+// (HTTPS_PROXY and friends).
+func telegramTransport(proxy string) (http.RoundTripper, error) {
+	if proxy == "" {
+		return nil, nil // http.DefaultTransport
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy == "direct" {
+		t.Proxy = nil
+		return t, nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("telegram proxy: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("telegram proxy: unsupported scheme %q (use http, https, socks5 or socks5h)", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("telegram proxy: %q has no host", proxy)
+	}
+	t.Proxy = http.ProxyURL(u)
+	return t, nil
+}
+
+// telegramHTTPClient is useragent.Client going through base.
+func telegramHTTPClient(timeout time.Duration, base http.RoundTripper) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: &useragent.Transport{Base: base}}
+}
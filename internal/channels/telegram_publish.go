@@ -0,0 +1,72 @@
+package channels
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+// telegramPublishTo indexes the broadcast channels of the publishTo setting
+// by numeric ID or lower-case "@username" (Telegram usernames ignore case).
+func telegramPublishTo(channels []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(channels))
+	for _, c := range channels {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		if _, err := strconv.ParseInt(c, 10, 64); err != nil {
+			c = "@" + strings.ToLower(strings.TrimPrefix(c, "@"))
+		}
+		set[c] = struct{}{}
+	}
+	return set
+}
+
+// isPublishChannel reports whether the channel of post m is one of the
+// publishTo channels.
+func (c *telegramClient) isPublishChannel(m *telegramMessage) bool {
+	if _, ok := c.publishTo[strconv.FormatInt(m.Chat.ID, 10)]; ok {
+		return true
+	}
+	if m.Chat.Username == "" {
+		return false
+	}
+	_, ok := c.publishTo["@"+strings.ToLower(m.Chat.Username)]
+	return ok
+}
+
+// handleChannelPost records a post published in one of the publishTo
+// channels by someone else (Telegram does not report the bot's own) as an
+// event of the channel's chat, so the agent knows what the channel carries
+// when drafting the next post. The bot never answers in a channel, and posts
+// in other channels it belongs to are ignored.
+func (c *telegramClient) handleChannelPost(m *telegramMessage) {
+	chatID := telegramChatKey(m)
+	if !c.isPublishChannel(m) {
+		log.Printf("telegram: ignoring a post in channel %s", chatID)
+		return
+	}
+	content := telegramMessageText(m)
+	if strings.TrimSpace(content) == "" {
+		return
+	}
+	name := m.Chat.Title
+	if m.Chat.Username != "" {
+		name = "@" + m.Chat.Username
+	}
+	c.hub.In <- chat.Inbound{
+		Channel:   "telegram",
+		ChatID:    chatID,
+		Content:   "[post in " + name + "] " + content,
+		Timestamp: time.Now(),
+		Metadata: map[string]interface{}{
+			"event":      "channel_post",
+			"message_id": strconv.FormatInt(m.MessageID, 10),
+			"chat_type":  m.Chat.Type,
+		},
+	}
+}
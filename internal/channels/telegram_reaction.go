@@ -0,0 +1,30 @@
+package channels
+
+import (
+	"encoding/json"
+	"log"
+	"net/url"
+)
+
+// Default reactions of config.TelegramReactions. ✅ would be the natural
+// "done" mark, but it is not among the emojis Telegram accepts as reactions.
+const (
+	telegramReactWorking = "👀"
+	telegramReactDone    = "👍"
+)
+
+// react sets the bot's reaction on a message, replacing its previous one.
+// Failures (e.g. reactions disabled in a group) are only logged.
+func (c *telegramClient) react(chatID, messageID, emoji string) {
+	if emoji == "" || messageID == "" {
+		return
+	}
+	reaction, _ := json.Marshal([]map[string]string{{"type": "emoji", "emoji": emoji}})
+	v := url.Values{}
+	v.Set("chat_id", telegramBaseChat(chatID))
+	v.Set("message_id", messageID)
+	v.Set("reaction", string(reaction))
+	if err := c.call("setMessageReaction", v, nil); err != nil {
+		log.Printf("telegram setMessageReaction %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package channels
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+)
+
+// telegramHTTPError is a non-2xx response that did not carry a Bot API error,
+// e.g. a 502 from a proxy in front of the API.
+type telegramHTTPError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *telegramHTTPError) Error() string {
+	return fmt.Sprintf("http error: status=%s body=%s", e.Status, e.Body)
+}
+
+// telegramTransient reports whether a request that failed with err may
+// succeed if tried again, and how long Telegram asked to wait first (429
+// retry_after), if it did. Network errors, 5xx responses and rate limits are
+// transient; anything else (a bad request, a missing chat) fails the same way
+// every time.
+func telegramTransient(err error) (retryAfter time.Duration, ok bool) {
+	var apiErr *telegramAPIError
+	var httpErr *telegramHTTPError
+	var netErr *url.Error
+	switch {
+	case err == nil:
+		return 0, false
+	case errors.As(err, &apiErr):
+		return apiErr.RetryAfter, apiErr.RetryAfter > 0 || apiErr.Code >= 500
+	case errors.As(err, &httpErr):
+		return 0, httpErr.StatusCode >= 500 || httpErr.StatusCode == http.StatusTooManyRequests
+	case errors.As(err, &netErr):
+		return 0, true
+	}
+	return 0, false
+}
+
+// telegramUnsent reports whether err is a network failure that happened
+// before the request reached Telegram: the address could not be resolved or
+// the connection could not be made.
+func telegramUnsent(err error) bool {
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) || errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// withRetry runs fn, trying again while it fails transiently, up to the
+// configured number of attempts. Rate-limited requests wait as long as
+// Telegram asks; other failures back off exponentially, with jitter.
+func (c *telegramClient) withRetry(fn func() error) error {
+	return c.retry(fn, false)
+}
+
+// withSendRetry is withRetry for requests that post a message. A network
+// failure is only retried when the request never reached Telegram: one that
+// broke after it was sent (a timeout, a reset connection) may have posted
+// the message already, and sending it again would post it twice.
+func (c *telegramClient) withSendRetry(fn func() error) error {
+	return c.retry(fn, true)
+}
+
+func (c *telegramClient) retry(fn func() error, posts bool) error {
+	var backoff *telegramBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		retryAfter, transient := telegramTransient(err)
+		var netErr *url.Error
+		if posts && errors.As(err, &netErr) && !telegramUnsent(err) {
+			transient = false
+		}
+		if !transient || attempt >= c.sending.MaxAttempts {
+			return err
+		}
+		wait := retryAfter
+		if wait <= 0 {
+			if backoff == nil {
+				backoff = newTelegramBackoff(config.TelegramPolling{BackoffMinMs: c.sending.BackoffMinMs, BackoffMaxMs: c.sending.BackoffMaxMs})
+			}
+			wait = backoff.next(0)
+		}
+		log.Printf("telegram: attempt %d failed (%v), retrying in %s", attempt, err, wait.Round(time.Millisecond))
+		select {
+		case <-time.After(wait):
+		case <-c.ctx.Done():
+			return err
+		}
+	}
+}
+
+// telegramDeadLetter is one line of the dead-letter file.
+type telegramDeadLetter struct {
+	Time    time.Time     `json:"time"`
+	ChatID  string        `json:"chat_id"`
+	Errors  []string      `json:"errors"`
+	Message chat.Outbound `json:"message"`
+}
+
+// deadLetter records out, which could not be (fully) sent, in the
+// dead-letter file so it is not silently lost. Private messages are only
+// logged, without their text.
+func (c *telegramClient) deadLetter(out chat.Outbound, errs []string) {
+	log.Printf("telegram: giving up on a message to %s: %v", out.ChatID, errs)
+	if c.deadLetters == "" || out.Private {
+		return
+	}
+	b, err := json.Marshal(telegramDeadLetter{Time: time.Now().UTC(), ChatID: out.ChatID, Errors: errs, Message: out})
+	if err != nil {
+		log.Printf("telegram: dead letter: %v", err)
+		return
+	}
+	c.deadMu.Lock()
+	defer c.deadMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(c.deadLetters), 0o755); err != nil {
+		log.Printf("telegram: dead letter: %v", err)
+		return
+	}
+	f, err := os.OpenFile(c.deadLetters, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		log.Printf("telegram: dead letter: %v", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		log.Printf("telegram: dead letter: %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package channels
+
+import (
+	"strings"
+	"unicode/utf16"
+)
+
+// splitTelegramMessage splits s into chunks whose MarkdownV2 rendering fits in
+// limit UTF-16 code units. It breaks between paragraphs where possible and
+// never inside a fenced code block unless the block alone is too long, in which
+// case the block is split by lines and each part is re-fenced. Each chunk is
+// formatted on its own, so escaping stays valid across chunks. An empty s
+// yields no chunks.
+func splitTelegramMessage(s string, limit int) []string {
+	s = strings.TrimSpace(strings.ReplaceAll(s, "\r\n", "\n"))
+	if s == "" {
+		return nil
+	}
+	if telegramFits(s, limit) {
+		return []string{s}
+	}
+
+	var chunks []string
+	cur := ""
+	flush := func() {
+		if cur != "" {
+			chunks = append(chunks, cur)
+			cur = ""
+		}
+	}
+	for _, block := range splitTelegramBlocks(s) {
+		if cur != "" && telegramFits(cur+"\n\n"+block, limit) {
+			cur += "\n\n" + block
+			continue
+		}
+		flush()
+		if telegramFits(block, limit) {
+			cur = block
+			continue
+		}
+		parts := splitTelegramOversized(block, limit)
+		chunks = append(chunks, parts[:len(parts)-1]...)
+		cur = parts[len(parts)-1]
+	}
+	flush()
+	return chunks
+}
+
+// telegramFits reports whether s, once formatted, fits in limit UTF-16 units.
+// Telegram counts the text left after parsing entities, so the MarkdownV2
+// rendering, which only adds escapes, also bounds replies sent as HTML.
+func telegramFits(s string, limit int) bool {
+	return len(utf16.Encode([]rune(formatTelegramMarkdownV2(s)))) <= limit
+}
+
+// splitTelegramBlocks splits s into paragraphs separated by blank lines,
+// keeping each fenced code block (```) whole.
+func splitTelegramBlocks(s string) []string {
+	var blocks []string
+	var cur []string
+	inFence := false
+	flush := func() {
+		if len(cur) > 0 {
+			blocks = append(blocks, strings.Join(cur, "\n"))
+			cur = nil
+		}
+	}
+	for _, line := range strings.Split(s, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			if !inFence {
+				flush()
+			}
+			cur = append(cur, line)
+			if inFence {
+				flush()
+			}
+			inFence = !inFence
+			continue
+		}
+		if !inFence && strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		cur = append(cur, line)
+	}
+	flush()
+	return blocks
+}
+
+// splitTelegramOversized splits a single block that does not fit by lines,
+// and lines that still do not fit by runes. Parts of a fenced code block are
+// closed and reopened with the original fence so each renders as code.
+func splitTelegramOversized(block string, limit int) []string {
+	lines := strings.Split(block, "\n")
+	openFence, closeFence := "", ""
+	if len(lines) >= 2 && strings.HasPrefix(strings.TrimSpace(lines[0]), "```") && strings.TrimSpace(lines[len(lines)-1]) == "```" {
+		openFence, closeFence = lines[0]+"\n", "\n```"
+		lines = lines[1 : len(lines)-1]
+	}
+	wrap := func(body string) string { return openFence + body + closeFence }
+
+	var parts []string
+	cur := ""
+	for _, line := range lines {
+		if cur != "" && telegramFits(wrap(cur+"\n"+line), limit) {
+			cur += "\n" + line
+			continue
+		}
+		if cur != "" {
+			parts = append(parts, wrap(cur))
+			cur = ""
+		}
+		if telegramFits(wrap(line), limit) {
+			cur = line
+			continue
+		}
+		// Hard-split an overlong line, taking as many runes as fit each time.
+		rest := []rune(line)
+		for len(rest) > 0 {
+			n := len(rest)
+			for n > 1 && !telegramFits(wrap(string(rest[:n])), limit) {
+				n -= max(1, n/8)
+			}
+			parts = append(parts, wrap(string(rest[:n])))
+			rest = rest[n:]
+		}
+	}
+	if cur != "" {
+		parts = append(parts, wrap(cur))
+	}
+	return parts
+}
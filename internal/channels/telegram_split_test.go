@@ -0,0 +1,75 @@
+package channels
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestSplitTelegramMessageShortIsSingleChunk(t *testing.T) {
+	if got := splitTelegramMessage("hello", 4096); len(got) != 1 || got[0] != "hello" {
+		t.Fatalf("unexpected chunks: %q", got)
+	}
+	if got := splitTelegramMessage("  ", 4096); got != nil {
+		t.Fatalf("expected no chunks for blank text, got %q", got)
+	}
+}
+
+func TestSplitTelegramMessageOnParagraphs(t *testing.T) {
+	p1 := strings.Repeat("a", 30)
+	p2 := strings.Repeat("b", 30)
+	p3 := strings.Repeat("c", 30)
+	got := splitTelegramMessage(p1+"\n\n"+p2+"\n\n"+p3, 70)
+	want := []string{p1 + "\n\n" + p2, p3}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("unexpected chunks: %q", got)
+	}
+}
+
+func TestSplitTelegramMessageKeepsCodeBlocksWhole(t *testing.T) {
+	code := "```go\nfunc main() {\n\n\tprintln(1)\n}\n```"
+	text := strings.Repeat("x", 40) + "\n\n" + code + "\n\nafter"
+	got := splitTelegramMessage(text, 60)
+	found := false
+	for _, c := range got {
+		if strings.Contains(c, "```go") {
+			found = true
+			if !strings.Contains(c, code) {
+				t.Fatalf("code block was split: %q", got)
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("code block missing: %q", got)
+	}
+}
+
+func TestSplitTelegramMessageRespectsEscapedLimit(t *testing.T) {
+	// Every '.' doubles when escaped, so the raw length alone is misleading.
+	long := strings.Repeat("Sentence one. Sentence two.\n", 400)
+	got := splitTelegramMessage(long, 4096)
+	if len(got) < 2 {
+		t.Fatalf("expected several chunks, got %d", len(got))
+	}
+	for i, c := range got {
+		if n := len(utf16.Encode([]rune(formatTelegramMarkdownV2(c)))); n > 4096 {
+			t.Fatalf("chunk %d is %d units after formatting", i, n)
+		}
+	}
+	if strings.Join(got, "\n") != strings.TrimSpace(long) {
+		t.Fatal("content was lost or reordered while splitting")
+	}
+}
+
+func TestSplitTelegramMessageRefencesOversizedCode(t *testing.T) {
+	code := "```\n" + strings.Repeat("line\n", 40) + "```"
+	got := splitTelegramMessage(code, 80)
+	if len(got) < 2 {
+		t.Fatalf("expected the block to be split, got %q", got)
+	}
+	for _, c := range got {
+		if !strings.HasPrefix(c, "```\n") || !strings.HasSuffix(c, "\n```") {
+			t.Fatalf("part is not fenced: %q", c)
+		}
+	}
+}
@@ -2,14 +2,20 @@ package channels
 
 import (
 	"context"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
 )
 
 func TestStartTelegramWithBase(t *testing.T) {
@@ -47,7 +53,7 @@ func TestStartTelegramWithBase(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	if err := StartTelegramWithBase(ctx, b, token, base, nil); err != nil {
+	if err := StartTelegramWithBase(ctx, b, base, config.TelegramConfig{Token: token}); err != nil {
 		t.Fatalf("StartTelegramWithBase failed: %v", err)
 	}
 	// Start the hub router so outbound messages sent to b.Out are dispatched
@@ -63,12 +69,15 @@ func TestStartTelegramWithBase(t *testing.T) {
 		if msg.ChatID != "456" {
 			t.Fatalf("unexpected chat id: %s", msg.ChatID)
 		}
+		if msg.MessageID() != "1" {
+			t.Fatalf("unexpected message id: %q", msg.MessageID())
+		}
 	case <-time.After(2 * time.Second):
 		t.Fatal("timeout waiting for inbound message")
 	}
 
 	// send an outbound message and ensure server receives it
-	out := chat.Outbound{Channel: "telegram", ChatID: "456", Content: "reply"}
+	out := chat.Outbound{Channel: "telegram", ChatID: "456", Content: "reply", ReplyTo: "1"}
 	b.Out <- out
 
 	select {
@@ -79,6 +88,9 @@ func TestStartTelegramWithBase(t *testing.T) {
 		if v.Get("parse_mode") != "MarkdownV2" {
 			t.Fatalf("unexpected parse_mode: %q", v.Get("parse_mode"))
 		}
+		if v.Get("reply_parameters") != `{"allow_sending_without_reply":true,"message_id":1}` {
+			t.Fatalf("unexpected reply_parameters: %q", v.Get("reply_parameters"))
+		}
 	case <-time.After(2 * time.Second):
 		t.Fatal("timeout waiting for sendMessage to be posted")
 	}
@@ -97,3 +109,1152 @@ func TestFormatTelegramMarkdownV2(t *testing.T) {
 		t.Fatalf("unexpected formatted text: got %q want %q", got, want)
 	}
 }
+
+func TestFormatTelegramMarkdownV2HidesText(t *testing.T) {
+	in := "The answer is ||42.||, not `a ||b|| c`.\n>> long\n>> log.\nDone\n```\n>> kept\n```"
+	want := "The answer is ||42\\.||, not \\`a \\|\\|b\\|\\| c\\`\\.\n**>long\n>log\\.||\nDone\n\\`\\`\\`\n\\>\\> kept\n\\`\\`\\`"
+	if got := formatTelegramMarkdownV2(in); got != want {
+		t.Fatalf("got %q want %q", got, want)
+	}
+}
+
+func TestTelegramSendsAttachments(t *testing.T) {
+	dir := t.TempDir()
+	photo := filepath.Join(dir, "chart.png")
+	doc := filepath.Join(dir, "report.pdf")
+	os.WriteFile(photo, []byte("PNGDATA"), 0o644)
+	os.WriteFile(doc, []byte("PDFDATA"), 0o644)
+
+	type upload struct{ method, field, name, data string }
+	uploads := make(chan upload, 4)
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/getUpdates") {
+			w.Write([]byte(`{"ok":true,"result":[]}`))
+			return
+		}
+		method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		if method == "sendPhoto" || method == "sendDocument" {
+			if err := r.ParseMultipartForm(1 << 20); err != nil {
+				t.Errorf("parse multipart: %v", err)
+			}
+			for field, files := range r.MultipartForm.File {
+				f, _ := files[0].Open()
+				data, _ := io.ReadAll(f)
+				f.Close()
+				uploads <- upload{method, field, files[0].Filename, string(data)}
+			}
+			if r.FormValue("chat_id") != "456" {
+				t.Errorf("unexpected chat_id %q", r.FormValue("chat_id"))
+			}
+		}
+		w.Write([]byte(`{"ok":true,"result":{}}`))
+	}))
+	defer h.Close()
+
+	b := chat.NewHub(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := StartTelegramWithBase(ctx, b, h.URL+"/bottok", config.TelegramConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	b.StartRouter(ctx)
+	b.Out <- chat.Outbound{Channel: "telegram", ChatID: "456", Media: []string{photo, doc}}
+
+	want := []upload{{"sendPhoto", "photo", "chart.png", "PNGDATA"}, {"sendDocument", "document", "report.pdf", "PDFDATA"}}
+	for _, w := range want {
+		select {
+		case got := <-uploads:
+			if got != w {
+				t.Fatalf("unexpected upload: got %+v want %+v", got, w)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout waiting for %s", w.method)
+		}
+	}
+}
+
+func TestTelegramStreamsByEditingPlaceholder(t *testing.T) {
+	type call struct {
+		method string
+		form   url.Values
+	}
+	var calls []call
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		calls = append(calls, call{method, r.PostForm})
+		w.Write([]byte(`{"ok":true,"result":{"message_id":77}}`))
+	}))
+	defer h.Close()
+
+	b := chat.NewHub(10)
+	c := newTelegramClient(context.Background(), b, h.URL+"/bottok", config.TelegramConfig{})
+	c.editInterval = 0
+	if !b.Streams("telegram") {
+		t.Fatal("telegram should be registered as a streaming channel")
+	}
+
+	base := chat.Outbound{Channel: "telegram", ChatID: "456", ReplyTo: "5", StreamID: "s1"}
+	for _, text := range []string{"", "Hel", "Hello *w", "Hello *w"} {
+		out := base
+		out.Content, out.Partial = text, true
+		c.send(out)
+	}
+	final := base
+	final.Content = "Hello *world*."
+	c.send(final)
+
+	if len(calls) != 4 {
+		t.Fatalf("expected 4 calls (placeholder, 2 edits, final edit), got %d: %+v", len(calls), calls)
+	}
+	if calls[0].method != "sendMessage" || calls[0].form.Get("text") != "…" || calls[0].form.Get("parse_mode") != "" {
+		t.Fatalf("unexpected placeholder: %+v", calls[0])
+	}
+	if calls[0].form.Get("reply_parameters") == "" {
+		t.Fatal("placeholder should reply to the original message")
+	}
+	for i, text := range []string{"Hel", "Hello *w"} {
+		c := calls[i+1]
+		if c.method != "editMessageText" || c.form.Get("message_id") != "77" || c.form.Get("text") != text {
+			t.Fatalf("unexpected edit %d: %+v", i, c)
+		}
+	}
+	last := calls[3]
+	if last.method != "editMessageText" || last.form.Get("parse_mode") != "MarkdownV2" || last.form.Get("text") != `Hello *world*\.` {
+		t.Fatalf("unexpected final edit: %+v", last)
+	}
+	if _, ok := c.streams["s1"]; ok {
+		t.Fatal("stream state should be cleared after the final message")
+	}
+}
+
+func TestTelegramRetriesAfterRateLimit(t *testing.T) {
+	var mu sync.Mutex
+	limited := false
+	delivered := make(chan string, 4)
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/sendMessage") {
+			w.Write([]byte(`{"ok":true,"result":[]}`))
+			return
+		}
+		r.ParseForm()
+		mu.Lock()
+		first := !limited && r.PostForm.Get("chat_id") == "1"
+		limited = limited || first
+		mu.Unlock()
+		if first {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 1","parameters":{"retry_after":1}}`))
+			return
+		}
+		delivered <- r.PostForm.Get("chat_id") + ":" + r.PostForm.Get("text")
+		w.Write([]byte(`{"ok":true,"result":{}}`))
+	}))
+	defer h.Close()
+
+	b := chat.NewHub(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := StartTelegramWithBase(ctx, b, h.URL+"/bottok", config.TelegramConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	b.StartRouter(ctx)
+	b.Out <- chat.Outbound{Channel: "telegram", ChatID: "1", Content: "first"}
+	b.Out <- chat.Outbound{Channel: "telegram", ChatID: "1", Content: "second"}
+	b.Out <- chat.Outbound{Channel: "telegram", ChatID: "2", Content: "other"}
+
+	// The other chat is not held up by chat 1's back-off, and chat 1's
+	// messages arrive in order once the retry succeeds.
+	for _, want := range []string{"2:other", "1:first", "1:second"} {
+		select {
+		case got := <-delivered:
+			if got != want {
+				t.Fatalf("got %q, want %q", got, want)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("timeout waiting for %q", want)
+		}
+	}
+}
+
+func TestTelegramGroupActivation(t *testing.T) {
+	c := newTelegramClient(context.Background(), chat.NewHub(10), "http://unused", config.TelegramConfig{})
+	c.botID = 99
+	c.botUsername = "pico_bot"
+	c.mentionRE = regexp.MustCompile(`(?i)@pico_bot\b`)
+
+	reply := &telegramMessage{From: &telegramUser{ID: 99}}
+	tests := []struct {
+		text    string
+		replyTo *telegramMessage
+		want    string
+		ok      bool
+	}{
+		{"just chatting", nil, "", false},
+		{"hey @Pico_Bot what's up?", nil, "hey what's up?", true},
+		{"ask @pico_bot_fan instead", nil, "", false},
+		{"/help", nil, "/help", true},
+		{"/help@pico_bot now", nil, "/help now", true},
+		{"/help@other_bot", nil, "", false},
+		{"thanks!", reply, "thanks!", true},
+		{"@pico_bot", nil, "", false},
+	}
+	for _, tt := range tests {
+		m := &telegramMessage{Text: tt.text, ReplyToMessage: tt.replyTo}
+		got, ok := c.groupContent(m, m.Text)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("groupContent(%q) = %q, %v; want %q, %v", tt.text, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	c.groupAll = true
+	if got, ok := c.groupContent(&telegramMessage{}, "just chatting"); !ok || got != "just chatting" {
+		t.Fatalf("groupMode all should forward everything, got %q %v", got, ok)
+	}
+}
+
+func TestTelegramRegistersCommands(t *testing.T) {
+	got := make(chan string, 1)
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/setMyCommands") {
+			r.ParseForm()
+			got <- r.PostForm.Get("commands")
+		}
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	}))
+	defer h.Close()
+
+	b := chat.NewHub(10)
+	b.SetCommands([]chat.Command{{Name: "help", Description: "List commands"}})
+	c := newTelegramClient(context.Background(), b, h.URL+"/bottok", config.TelegramConfig{})
+	c.registerCommands()
+
+	select {
+	case cmds := <-got:
+		if cmds != `[{"command":"help","description":"List commands"}]` {
+			t.Fatalf("unexpected commands: %s", cmds)
+		}
+	default:
+		t.Fatal("setMyCommands was not called")
+	}
+}
+
+func TestTelegramMessageTextDescribesStickers(t *testing.T) {
+	m := &telegramMessage{Sticker: &telegramSticker{Emoji: "😂", SetName: "FunnyCats"}}
+	if got, want := telegramMessageText(m), `[sticker 😂 from set "FunnyCats"]`; got != want {
+		t.Fatalf("got %q want %q", got, want)
+	}
+	if got := telegramMessageText(&telegramMessage{Text: "🎉🎉"}); got != "🎉🎉" {
+		t.Fatalf("emoji-only text should pass through, got %q", got)
+	}
+}
+
+func TestTelegramRepliesWithSticker(t *testing.T) {
+	type call struct{ method, value string }
+	calls := make(chan call, 4)
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/getStickerSet"):
+			if r.PostForm.Get("name") != "PicoPack" {
+				t.Errorf("unexpected set %q", r.PostForm.Get("name"))
+			}
+			w.Write([]byte(`{"ok":true,"result":{"stickers":[{"file_id":"STK1","emoji":"👍"}]}}`))
+			return
+		case strings.HasSuffix(r.URL.Path, "/sendSticker"):
+			calls <- call{"sendSticker", r.PostForm.Get("sticker")}
+		case strings.HasSuffix(r.URL.Path, "/sendMessage"):
+			calls <- call{"sendMessage", r.PostForm.Get("text")}
+		}
+		w.Write([]byte(`{"ok":true,"result":{}}`))
+	}))
+	defer h.Close()
+
+	c := newTelegramClient(context.Background(), chat.NewHub(10), h.URL+"/bottok", config.TelegramConfig{StickerSet: "PicoPack"})
+	c.loadStickers()
+	c.send(chat.Outbound{ChatID: "1", Metadata: map[string]interface{}{"sticker": "👍"}})
+	c.send(chat.Outbound{ChatID: "1", Metadata: map[string]interface{}{"sticker": "🦄"}})
+
+	for _, want := range []call{{"sendSticker", "STK1"}, {"sendMessage", "🦄"}} {
+		select {
+		case got := <-calls:
+			if got != want {
+				t.Fatalf("got %+v want %+v", got, want)
+			}
+		default:
+			t.Fatalf("missing %s", want.method)
+		}
+	}
+}
+
+func TestTelegramForwardsSharedLocation(t *testing.T) {
+	first := true
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/getUpdates") && first {
+			first = false
+			w.Write([]byte(`{"ok":true,"result":[{"update_id":1,"message":{"message_id":7,"from":{"id":123},"chat":{"id":456,"type":"private"},"location":{"latitude":-23.55052,"longitude":-46.633308}}}]}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true,"result":[]}`))
+	}))
+	defer h.Close()
+
+	b := chat.NewHub(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := StartTelegramWithBase(ctx, b, h.URL+"/bottok", config.TelegramConfig{}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case msg := <-b.In:
+		if msg.Content != "[location -23.550520, -46.633308]" {
+			t.Fatalf("unexpected content: %q", msg.Content)
+		}
+		loc, ok := msg.Location()
+		if !ok || loc.Latitude != -23.55052 || loc.Longitude != -46.633308 {
+			t.Fatalf("unexpected location: %+v %v", loc, ok)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for inbound location")
+	}
+}
+
+func TestTelegramSavesDocumentsInInbox(t *testing.T) {
+	first := true
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/getUpdates") && first:
+			first = false
+			w.Write([]byte(`{"ok":true,"result":[{"update_id":1,"message":{"message_id":7,"from":{"id":123},"chat":{"id":456,"type":"private"},"caption":"summarize this","document":{"file_id":"F1","file_name":"../notes.txt","mime_type":"text/plain","file_size":5}}}]}`))
+		case strings.HasSuffix(r.URL.Path, "/getFile"):
+			r.ParseForm()
+			if r.PostForm.Get("file_id") != "F1" {
+				t.Errorf("unexpected getFile form: %v", r.PostForm)
+			}
+			w.Write([]byte(`{"ok":true,"result":{"file_path":"documents/file_3.txt"}}`))
+		case r.URL.Path == "/file/bottok/documents/file_3.txt":
+			w.Write([]byte("hello"))
+		default:
+			w.Write([]byte(`{"ok":true,"result":[]}`))
+		}
+	}))
+	defer h.Close()
+
+	ws := t.TempDir()
+	os.MkdirAll(filepath.Join(ws, "inbox", "telegram", "456"), 0o755)
+	os.WriteFile(filepath.Join(ws, "inbox", "telegram", "456", "notes.txt"), []byte("older"), 0o644)
+
+	b := chat.NewHub(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := StartTelegramWithBase(ctx, b, h.URL+"/bottok", config.TelegramConfig{Inbox: config.TelegramInbox{Enabled: true, Workspace: ws}}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-b.In:
+		rel := filepath.Join("inbox", "telegram", "456", "notes-1.txt")
+		if !strings.HasSuffix(msg.Content, "[saved as "+rel+" in the workspace]") || msg.Metadata["file_path"] != rel {
+			t.Fatalf("unexpected inbound: %q %v", msg.Content, msg.Metadata)
+		}
+		if len(msg.Media) != 1 {
+			t.Fatalf("expected the saved file as media, got %v", msg.Media)
+		}
+		if b, err := os.ReadFile(msg.Media[0]); err != nil || string(b) != "hello" {
+			t.Fatalf("unexpected saved file: %q %v", b, err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for inbound document")
+	}
+}
+
+func TestTelegramDocumentNotSavedHidesToken(t *testing.T) {
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	h.Close() // every request fails, with the URL in the error
+	c := newTelegramClient(context.Background(), chat.NewHub(1), h.URL+"/bot123:SECRET", config.TelegramConfig{
+		Inbox: config.TelegramInbox{Enabled: true, Workspace: t.TempDir()}, Sending: config.TelegramSending{MaxAttempts: 1}})
+	in := chat.Inbound{ChatID: "456", Content: "see attached", Metadata: map[string]interface{}{}}
+	c.attachDocument(&in, &telegramFile{FileID: "F1", FileName: "a.pdf"})
+	if in.Content != "see attached\n[not saved]" || len(in.Media) != 0 {
+		t.Fatalf("unexpected inbound: %+v", in)
+	}
+	if got := c.redact(`Post "` + h.URL + `/bot123:SECRET/getFile": refused`); strings.Contains(got, "SECRET") {
+		t.Fatalf("token not redacted: %s", got)
+	}
+}
+
+func TestTelegramPollRoundTrip(t *testing.T) {
+	polls := make(chan url.Values, 1)
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/sendPoll") {
+			r.ParseForm()
+			polls <- r.PostForm
+			w.Write([]byte(`{"ok":true,"result":{"message_id":5,"poll":{"id":"P1"}}}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true,"result":{}}`))
+	}))
+	defer h.Close()
+
+	b := chat.NewHub(10)
+	c := newTelegramClient(context.Background(), b, h.URL+"/bottok", config.TelegramConfig{})
+	c.send(chat.Outbound{ChatID: "456", Metadata: map[string]interface{}{
+		"poll": chat.Poll{Question: "Lunch?", Options: []string{"Pizza", "Sushi"}},
+	}})
+	select {
+	case v := <-polls:
+		if v.Get("question") != "Lunch?" || v.Get("options") != `[{"text":"Pizza"},{"text":"Sushi"}]` || v.Get("is_anonymous") != "false" {
+			t.Fatalf("unexpected sendPoll form: %v", v)
+		}
+	default:
+		t.Fatal("sendPoll was not called")
+	}
+
+	c.handlePollAnswer(&telegramPollAnswer{PollID: "P1", User: &telegramUser{ID: 7, Username: "ana"}, OptionIDs: []int{1}})
+	in := <-b.In
+	if in.ChatID != "456" || in.Event() != "poll_answer" || in.Content != `[poll "Lunch?": @ana voted Sushi]` {
+		t.Fatalf("unexpected inbound: %+v", in)
+	}
+}
+
+func TestTelegramPinsSentMessage(t *testing.T) {
+	calls := make(chan string, 4)
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		switch method {
+		case "sendMessage":
+			w.Write([]byte(`{"ok":true,"result":{"message_id":77}}`))
+			return
+		case "pinChatMessage", "unpinChatMessage":
+			calls <- method + " " + r.PostForm.Get("message_id") + " " + r.PostForm.Get("disable_notification")
+		case "setChatTitle":
+			calls <- method + " " + r.PostForm.Get("title")
+		}
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	}))
+	defer h.Close()
+
+	c := newTelegramClient(context.Background(), chat.NewHub(10), h.URL+"/bottok", config.TelegramConfig{})
+	c.send(chat.Outbound{ChatID: "-100", Content: "Decision: pizza on Friday", Metadata: map[string]interface{}{"pin": true}})
+	if got := <-calls; got != "pinChatMessage 77 true" {
+		t.Fatalf("unexpected pin call: %q", got)
+	}
+	c.send(chat.Outbound{ChatID: "-100", Metadata: map[string]interface{}{"unpin": true}})
+	if got := <-calls; got != "unpinChatMessage  " {
+		t.Fatalf("unexpected unpin call: %q", got)
+	}
+	c.send(chat.Outbound{ChatID: "-100", Metadata: map[string]interface{}{"pin_message": "12", "chat_title": "Trip"}})
+	got := []string{<-calls, <-calls}
+	if got[0] != "pinChatMessage 12 true" || got[1] != "setChatTitle Trip" {
+		t.Fatalf("unexpected chat action calls: %q", got)
+	}
+}
+
+func TestTelegramMessageTextMarksForwards(t *testing.T) {
+	tests := []struct {
+		origin telegramForwardOrigin
+		want   string
+	}{
+		{telegramForwardOrigin{Type: "user", SenderUser: &telegramUser{FirstName: "Ana", LastName: "Lima", Username: "ana"}}, "Forwarded from Ana Lima (@ana):\nread this"},
+		{telegramForwardOrigin{Type: "hidden_user", SenderUserName: "Bob"}, "Forwarded from Bob:\nread this"},
+		{telegramForwardOrigin{Type: "channel", Chat: &telegramChat{Title: "Tech News", Username: "technews"}}, "Forwarded from Tech News (@technews):\nread this"},
+		{telegramForwardOrigin{Type: "chat"}, "Forwarded from an unknown sender:\nread this"},
+	}
+	for _, tt := range tests {
+		origin := tt.origin
+		if got := telegramMessageText(&telegramMessage{Text: "read this", ForwardOrigin: &origin}); got != tt.want {
+			t.Errorf("%s: got %q want %q", tt.origin.Type, got, tt.want)
+		}
+	}
+}
+
+func TestTelegramMessageTextIncludesCaptionAndAttachment(t *testing.T) {
+	m := &telegramMessage{
+		Caption:  "summarize this",
+		Document: &telegramFile{FileID: "F1", FileName: "report.pdf", MimeType: "application/pdf", FileSize: 120 * 1024},
+	}
+	if got, want := telegramMessageText(m), "summarize this\n[attached document: report.pdf (application/pdf, 120 KB)]"; got != want {
+		t.Fatalf("got %q want %q", got, want)
+	}
+	photo := &telegramMessage{Photo: []telegramFile{{FileID: "small"}, {FileID: "big", FileSize: 3 << 20}}}
+	if kind, f := photo.attachment(); kind != "photo" || f.FileID != "big" {
+		t.Fatalf("expected the largest photo size, got %s %+v", kind, f)
+	}
+	if got := telegramMessageText(photo); got != "[attached photo (3.0 MB)]" {
+		t.Fatalf("unexpected photo text: %q", got)
+	}
+}
+
+func TestTelegramFallsBackToPlainText(t *testing.T) {
+	sent := make(chan url.Values, 2)
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		sent <- r.PostForm
+		if r.PostForm.Get("parse_mode") != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: can't parse entities: Can't find end of the entity starting at byte offset 3"}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true,"result":{}}`))
+	}))
+	defer h.Close()
+
+	c := newTelegramClient(context.Background(), chat.NewHub(10), h.URL+"/bottok", config.TelegramConfig{})
+	c.send(chat.Outbound{ChatID: "1", Content: "a *b_c"})
+
+	if first := <-sent; first.Get("parse_mode") != "MarkdownV2" {
+		t.Fatalf("expected a MarkdownV2 attempt first, got %v", first)
+	}
+	select {
+	case retry := <-sent:
+		if retry.Get("parse_mode") != "" || retry.Get("text") != "a *b_c" {
+			t.Fatalf("unexpected plain-text retry: %v", retry)
+		}
+	default:
+		t.Fatal("message was dropped instead of resent as plain text")
+	}
+}
+
+func TestFormatTelegramHTML(t *testing.T) {
+	in := "# Result\n* item, 2 * 3 * 4\n**Bold** and *it* and _em_, snake_case_name, ~~old~~ <x> & [docs](https://e.com/?a=1&b=2) `a<b`\n```go\nif a < b && *p {\n}\n```"
+	want := "<b>Result</b>\n* item, 2 * 3 * 4\n<b>Bold</b> and <i>it</i> and <i>em</i>, snake_case_name, <s>old</s> &lt;x&gt; &amp; " +
+		`<a href="https://e.com/?a=1&amp;b=2">docs</a> <code>a&lt;b</code>` + "\n" +
+		`<pre><code class="language-go">if a &lt; b &amp;&amp; *p {` + "\n}</code></pre>"
+	if got := formatTelegramHTML(in); got != want {
+		t.Fatalf("unexpected HTML:\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestFormatTelegramHTMLHiddenText(t *testing.T) {
+	in := "The answer: ||42||\n> said once\n>> long\n>> log"
+	want := "The answer: <tg-spoiler>42</tg-spoiler>\n<blockquote>said once</blockquote>\n<blockquote expandable>long\nlog</blockquote>"
+	if got := formatTelegramHTML(in); got != want {
+		t.Fatalf("unexpected HTML:\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestTelegramHTMLParseMode(t *testing.T) {
+	sent := make(chan url.Values, 1)
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		sent <- r.PostForm
+		w.Write([]byte(`{"ok":true,"result":{}}`))
+	}))
+	defer h.Close()
+
+	c := newTelegramClient(context.Background(), chat.NewHub(10), h.URL+"/bottok", config.TelegramConfig{ParseMode: "html"})
+	c.send(chat.Outbound{ChatID: "1", Content: "**done**."})
+
+	if v := <-sent; v.Get("parse_mode") != "HTML" || v.Get("text") != "<b>done</b>." {
+		t.Fatalf("unexpected HTML send: %v", v)
+	}
+}
+
+func TestTelegramAllowChats(t *testing.T) {
+	first := true
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/getUpdates") && first {
+			first = false
+			w.Write([]byte(`{"ok":true,"result":[` +
+				`{"update_id":1,"message":{"message_id":1,"from":{"id":123},"chat":{"id":999,"type":"private"},"text":"elsewhere"}},` +
+				`{"update_id":2,"message":{"message_id":2,"from":{"id":123},"chat":{"id":-100,"type":"group"},"text":"/status"}}]}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true,"result":[]}`))
+	}))
+	defer h.Close()
+
+	b := chat.NewHub(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg := config.TelegramConfig{AllowFrom: []string{"123"}, AllowChats: []string{"-100"}}
+	if err := StartTelegramWithBase(ctx, b, h.URL+"/bottok", cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case msg := <-b.In:
+		if msg.ChatID != "-100" {
+			t.Fatalf("message from a chat outside allowChats was forwarded: %+v", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for inbound message")
+	}
+}
+
+func TestTelegramAdminAllowDeny(t *testing.T) {
+	state := filepath.Join(t.TempDir(), "telegram-state.json")
+	hub := chat.NewHub(10)
+	c := newTelegramClient(context.Background(), hub, "http://unused", config.TelegramConfig{
+		AllowFrom: []string{"1"}, Admins: []string{"99"}, StatePath: state,
+	})
+
+	if c.isAllowed("777", nil) {
+		t.Fatal("777 should not be allowed yet")
+	}
+	if c.handleAdminCommand("1", "1", "5", "/allow 777") {
+		t.Fatal("a non-admin's /allow must not be handled")
+	}
+	if !c.handleAdminCommand("99", "99", "5", "/allow 777") {
+		t.Fatal("admin /allow was not handled")
+	}
+	if out := <-hub.Out; !strings.HasPrefix(out.Content, "Allowed 777.") || out.ChatID != "99" {
+		t.Fatalf("unexpected reply: %+v", out)
+	}
+	c.handleAdminCommand("99", "99", "6", "/deny 1")
+	<-hub.Out
+	if !c.isAllowed("777", nil) || c.isAllowed("1", nil) || !c.isAllowed("99", nil) {
+		t.Fatal("allowlist changes not applied")
+	}
+
+	// The changes survive a restart.
+	c2 := newTelegramClient(context.Background(), chat.NewHub(10), "http://unused", config.TelegramConfig{
+		AllowFrom: []string{"1"}, StatePath: state,
+	})
+	if !c2.isAllowed("777", nil) || c2.isAllowed("1", nil) {
+		t.Fatalf("state not restored: %+v", c2.access)
+	}
+}
+
+func TestTelegramAdminAllowListAndRoles(t *testing.T) {
+	state := filepath.Join(t.TempDir(), "telegram-state.json")
+	hub := chat.NewHub(10)
+	c := newTelegramClient(context.Background(), hub, "http://unused", config.TelegramConfig{
+		AllowFrom: []string{"1"}, Admins: []string{"99"}, StatePath: state,
+	})
+	reply := func(text string) string {
+		if !c.handleAdminCommand("99", "99", "5", text) {
+			t.Fatalf("%q was not handled", text)
+		}
+		return (<-hub.Out).Content
+	}
+
+	if out := reply("/allow add 10 11 12"); !strings.HasPrefix(out, "Allowed 10, 11, 12.") {
+		t.Fatalf("add: %q", out)
+	}
+	if out := reply("/allow remove 11 1"); !strings.HasPrefix(out, "Removed 11, 1.") {
+		t.Fatalf("remove: %q", out)
+	}
+	if !c.isAllowed("10", nil) || c.isAllowed("11", nil) || c.isAllowed("1", nil) {
+		t.Fatal("removing from the runtime list or the config's allowFrom not applied")
+	}
+	if out := reply("/allow list"); !strings.Contains(out, "Allowed on Telegram: 10, 12") || !strings.Contains(out, "Admins: 99") {
+		t.Fatalf("list: %q", out)
+	}
+	if out := reply("/allow add x"); !strings.Contains(out, "not a Telegram user ID") {
+		t.Fatalf("bad ID: %q", out)
+	}
+
+	// An admin by role may use the admin commands, until demoted.
+	if c.handleAdminCommand("10", "10", "6", "/allow list") {
+		t.Fatal("a non-admin's /allow list must not be handled")
+	}
+	if out := reply("/role set 10 admin"); !strings.HasPrefix(out, "Role of 10 set to admin.") {
+		t.Fatalf("role: %q", out)
+	}
+	if !c.handleAdminCommand("10", "10", "6", "/allow list") {
+		t.Fatal("admin by role was refused")
+	}
+	<-hub.Out
+	if out := reply("/role set 99 user"); !strings.Contains(out, "in the config") {
+		t.Fatalf("demoting a configured admin: %q", out)
+	}
+	if out := reply("/role set 10 owner"); !strings.HasPrefix(out, "Unknown role") {
+		t.Fatalf("unknown role: %q", out)
+	}
+
+	// Roles survive a restart.
+	c2 := newTelegramClient(context.Background(), chat.NewHub(10), "http://unused", config.TelegramConfig{
+		AllowFrom: []string{"1"}, StatePath: state,
+	})
+	if !c2.isAdmin("10") || c2.isAllowed("11", nil) {
+		t.Fatalf("state not restored: %+v", c2.access)
+	}
+	reply("/role set 10 user")
+	if c.isAdmin("10") {
+		t.Fatal("demoted user is still an admin")
+	}
+}
+
+func TestTelegramAllowPatterns(t *testing.T) {
+	c := newTelegramClient(context.Background(), chat.NewHub(10), "http://unused", config.TelegramConfig{
+		AllowFrom: []string{"@ana*", "1000-1999"}, Deny: []string{"1500"},
+	})
+	if !c.isAllowed("1200", nil) || c.isAllowed("1500", nil) || c.isAllowed("5", nil) {
+		t.Fatal("numeric range or deny not applied")
+	}
+	if !c.isAllowed("5", &telegramUser{ID: 5, Username: "Ana_Lima"}) {
+		t.Fatal("username glob not applied")
+	}
+	err := StartTelegramWithBase(context.Background(), chat.NewHub(10), "http://unused", config.TelegramConfig{AllowFrom: []string{"[1-"}})
+	if err == nil {
+		t.Fatal("malformed allowFrom pattern accepted")
+	}
+}
+
+func TestTelegramBackoff(t *testing.T) {
+	b := newTelegramBackoff(config.TelegramPolling{BackoffMinMs: 100, BackoffMaxMs: 1000, Jitter: 0.1})
+	within := func(d, want time.Duration) bool {
+		return d >= want*9/10 && d <= want*11/10
+	}
+	for i, want := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		if d := b.next(0); !within(d, want*time.Millisecond) {
+			t.Fatalf("failure %d: delay %s, want about %dms", i+1, d, want)
+		}
+	}
+	if d := b.next(5 * time.Second); d != 5*time.Second {
+		t.Fatalf("retry_after not honoured: %s", d)
+	}
+	b.reset()
+	if d := b.next(0); !within(d, 100*time.Millisecond) {
+		t.Fatalf("delay after reset: %s", d)
+	}
+}
+
+func TestTelegramDeletesSelfDestructingReply(t *testing.T) {
+	deleted := make(chan url.Values, 1)
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if strings.HasSuffix(r.URL.Path, "/deleteMessage") {
+			deleted <- r.PostForm
+		}
+		w.Write([]byte(`{"ok":true,"result":{"message_id":77}}`))
+	}))
+	defer h.Close()
+
+	c := newTelegramClient(context.Background(), chat.NewHub(10), h.URL+"/bottok", config.TelegramConfig{})
+	c.send(chat.Outbound{ChatID: "1", Content: "password: hunter2", Metadata: map[string]interface{}{"delete_after": 0.05}})
+
+	select {
+	case v := <-deleted:
+		if v.Get("chat_id") != "1" || v.Get("message_id") != "77" {
+			t.Fatalf("unexpected deleteMessage form: %v", v)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("self-destructing reply was not deleted")
+	}
+}
+
+func TestTelegramReactions(t *testing.T) {
+	reactions := make(chan string, 2)
+	first := true
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/getUpdates") && first:
+			first = false
+			w.Write([]byte(`{"ok":true,"result":[{"update_id":1,"message":{"message_id":5,"from":{"id":123},"chat":{"id":456,"type":"private"},"text":"hi"}}]}`))
+			return
+		case strings.HasSuffix(r.URL.Path, "/sendMessage"):
+			w.Write([]byte(`{"ok":true,"result":{"message_id":6}}`))
+			return
+		case strings.HasSuffix(r.URL.Path, "/setMessageReaction"):
+			reactions <- r.PostForm.Get("message_id") + " " + r.PostForm.Get("reaction")
+		}
+		w.Write([]byte(`{"ok":true,"result":[]}`))
+	}))
+	defer h.Close()
+
+	b := chat.NewHub(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg := config.TelegramConfig{Reactions: config.TelegramReactions{Enabled: true}}
+	if err := StartTelegramWithBase(ctx, b, h.URL+"/bottok", cfg); err != nil {
+		t.Fatal(err)
+	}
+	b.StartRouter(ctx)
+
+	in := <-b.In
+	if got := <-reactions; got != `5 [{"emoji":"👀","type":"emoji"}]` {
+		t.Fatalf("unexpected working reaction: %s", got)
+	}
+	b.Out <- chat.Outbound{Channel: "telegram", ChatID: in.ChatID, Content: "hello", ReplyTo: in.MessageID()}
+	select {
+	case got := <-reactions:
+		if got != `5 [{"emoji":"👍","type":"emoji"}]` {
+			t.Fatalf("unexpected done reaction: %s", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no done reaction")
+	}
+}
+
+func TestTelegramNoDoneReactionWhenSendFails(t *testing.T) {
+	reactions := make(chan string, 2)
+	first := true
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/getUpdates") && first:
+			first = false
+			w.Write([]byte(`{"ok":true,"result":[{"update_id":1,"message":{"message_id":5,"from":{"id":123},"chat":{"id":456,"type":"private"},"text":"hi"}}]}`))
+			return
+		case strings.HasSuffix(r.URL.Path, "/sendMessage"):
+			w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`))
+			return
+		case strings.HasSuffix(r.URL.Path, "/setMessageReaction"):
+			reactions <- r.PostForm.Get("message_id") + " " + r.PostForm.Get("reaction")
+		}
+		w.Write([]byte(`{"ok":true,"result":[]}`))
+	}))
+	defer h.Close()
+
+	b := chat.NewHub(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg := config.TelegramConfig{Reactions: config.TelegramReactions{Enabled: true}, Sending: config.TelegramSending{MaxAttempts: 1}}
+	if err := StartTelegramWithBase(ctx, b, h.URL+"/bottok", cfg); err != nil {
+		t.Fatal(err)
+	}
+	b.StartRouter(ctx)
+
+	in := <-b.In
+	<-reactions // working
+	b.Out <- chat.Outbound{Channel: "telegram", ChatID: in.ChatID, Content: "hello", ReplyTo: in.MessageID()}
+	select {
+	case got := <-reactions:
+		t.Fatalf("unexpected done reaction after a failed send: %s", got)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestTelegramForumTopics(t *testing.T) {
+	sent := make(chan url.Values, 1)
+	first := true
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/getUpdates") && first:
+			first = false
+			w.Write([]byte(`{"ok":true,"result":[{"update_id":1,"message":{"message_id":5,"from":{"id":123},"chat":{"id":-100,"type":"supergroup"},"message_thread_id":42,"is_topic_message":true,"text":"/help"}}]}`))
+			return
+		case strings.HasSuffix(r.URL.Path, "/sendMessage"):
+			sent <- r.PostForm
+		}
+		w.Write([]byte(`{"ok":true,"result":[]}`))
+	}))
+	defer h.Close()
+
+	b := chat.NewHub(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := StartTelegramWithBase(ctx, b, h.URL+"/bottok", config.TelegramConfig{AllowChats: []string{"-100"}}); err != nil {
+		t.Fatal(err)
+	}
+	b.StartRouter(ctx)
+
+	in := <-b.In
+	if in.ChatID != "-100:42" {
+		t.Fatalf("expected the topic in the chat ID, got %q", in.ChatID)
+	}
+	b.Out <- chat.Outbound{Channel: "telegram", ChatID: in.ChatID, Content: "hi"}
+	select {
+	case v := <-sent:
+		if v.Get("chat_id") != "-100" || v.Get("message_thread_id") != "42" {
+			t.Fatalf("reply not sent to the topic: %v", v)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for sendMessage")
+	}
+}
+
+func TestTelegramSendsJournalledRepliesOnStart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.db")
+	j, err := openTelegramJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Left over from a run that died before sending them.
+	j.add(chat.Outbound{ChatID: "1", Content: "before the crash"})
+	j.add(chat.Outbound{ChatID: "1", Metadata: map[string]interface{}{"poll": chat.Poll{Question: "Lunch?", Options: []string{"yes", "no"}}}})
+
+	sent := make(chan string, 2)
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/sendMessage"):
+			sent <- r.PostForm.Get("text")
+		case strings.HasSuffix(r.URL.Path, "/sendPoll"):
+			sent <- r.PostForm.Get("question")
+		}
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1,"poll":{"id":"p"}}}`))
+	}))
+	defer h.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := newTelegramClient(ctx, chat.NewHub(10), h.URL+"/bottok", config.TelegramConfig{QueuePath: path})
+	go c.runOutbound()
+
+	for _, want := range []string{"before the crash", "Lunch?"} {
+		select {
+		case got := <-sent:
+			if got != want {
+				t.Fatalf("got %q, want %q", got, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("journalled reply %q was not sent", want)
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		pending, err := j.pending()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pending) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("sent replies are still journalled: %+v", pending)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTelegramKeepsPrivateRepliesOffDisk(t *testing.T) {
+	release := make(chan struct{})
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.PostForm.Get("text") == "🔒 secret" {
+			// Held until the journal was checked, then refused for good.
+			<-release
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1}}`))
+	}))
+	defer h.Close()
+	unblock := sync.OnceFunc(func() { close(release) })
+	defer unblock()
+
+	dir := t.TempDir()
+	queue, dead := filepath.Join(dir, "queue.db"), filepath.Join(dir, "dead.jsonl")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b := chat.NewHub(10)
+	c := newTelegramClient(ctx, b, h.URL+"/bottok", config.TelegramConfig{QueuePath: queue,
+		Sending: config.TelegramSending{MaxAttempts: 1, DeadLetterPath: dead}})
+	b.StartRouter(ctx)
+	go c.runOutbound()
+	b.Out <- chat.Outbound{Channel: "telegram", ChatID: "1", Content: "🔒 secret", Private: true}
+	b.Out <- chat.Outbound{Channel: "telegram", ChatID: "1", Content: "hello"}
+
+	j, err := openTelegramJournal(queue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// waitJournal waits until the journal holds want.
+	waitJournal := func(want ...string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			pending, _ := j.pending()
+			var got []string
+			for _, out := range pending {
+				got = append(got, out.Content)
+			}
+			if strings.Join(got, "|") == strings.Join(want, "|") {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("journal holds %q, want %q", got, want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitJournal("hello")
+	unblock()
+	// The private reply failing does not take the other one off the journal.
+	waitJournal()
+	if b, err := os.ReadFile(dead); err == nil && strings.Contains(string(b), "secret") {
+		t.Fatalf("private reply dead-lettered: %s", b)
+	}
+}
+
+func TestTelegramRetriesTransientSendFailures(t *testing.T) {
+	var mu sync.Mutex
+	attempts := map[string]int{}
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		chatID := r.PostForm.Get("chat_id")
+		mu.Lock()
+		attempts[chatID]++
+		n := attempts[chatID]
+		mu.Unlock()
+		switch {
+		case chatID == "flaky" && n <= 2:
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte("<html>bad gateway</html>"))
+		case chatID == "down":
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"ok":false,"error_code":500,"description":"Internal Server Error"}`))
+		case chatID == "gone":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`))
+		default:
+			w.Write([]byte(`{"ok":true,"result":{"message_id":1}}`))
+		}
+	}))
+	defer h.Close()
+
+	dead := filepath.Join(t.TempDir(), "dead.jsonl")
+	cfg := config.TelegramConfig{Sending: config.TelegramSending{MaxAttempts: 3, BackoffMinMs: 5, BackoffMaxMs: 10, DeadLetterPath: dead}}
+	c := newTelegramClient(context.Background(), chat.NewHub(10), h.URL+"/bottok", cfg)
+	c.send(chat.Outbound{ChatID: "flaky", Content: "eventually"})
+	c.send(chat.Outbound{ChatID: "down", Content: "never"})
+	c.send(chat.Outbound{ChatID: "gone", Content: "pointless"})
+
+	mu.Lock()
+	if attempts["flaky"] != 3 || attempts["down"] != 3 || attempts["gone"] != 1 {
+		t.Fatalf("unexpected attempts: %v", attempts)
+	}
+	mu.Unlock()
+	b, err := os.ReadFile(dead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"chat_id":"down"`) || !strings.Contains(lines[1], "chat not found") {
+		t.Fatalf("unexpected dead letters: %s", b)
+	}
+}
+
+func TestTelegramDoesNotResendAfterBrokenConnection(t *testing.T) {
+	var mu sync.Mutex
+	attempts := 0
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts++
+		mu.Unlock()
+		// The request arrived, so the message may have been posted, but the
+		// connection breaks before the response.
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer h.Close()
+
+	cfg := config.TelegramConfig{Sending: config.TelegramSending{MaxAttempts: 3, BackoffMinMs: 5, BackoffMaxMs: 10}}
+	c := newTelegramClient(context.Background(), chat.NewHub(10), h.URL+"/bottok", cfg)
+	c.send(chat.Outbound{ChatID: "1", Content: "once"})
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts != 1 {
+		t.Fatalf("sendMessage tried %d times, want 1: a retry may post the message twice", attempts)
+	}
+}
+
+func TestTelegramNotModifiedEditIsDelivered(t *testing.T) {
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/editMessageText") {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: message is not modified: specified new message content and reply markup are exactly the same"}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true,"result":{"message_id":77}}`))
+	}))
+	defer h.Close()
+
+	b := chat.NewHub(10)
+	dead := filepath.Join(t.TempDir(), "dead.jsonl")
+	c := newTelegramClient(context.Background(), b, h.URL+"/bottok", config.TelegramConfig{Sending: config.TelegramSending{DeadLetterPath: dead}})
+	c.editInterval = 0
+	c.send(chat.Outbound{ChatID: "1", StreamID: "s", Partial: true, Content: "done"})
+	c.send(chat.Outbound{ChatID: "1", StreamID: "s", Content: "done"})
+	if _, err := os.Stat(dead); !os.IsNotExist(err) {
+		t.Fatalf("an edit leaving the text as it is was dead-lettered: %v", err)
+	}
+	select {
+	case in := <-b.In:
+		t.Fatalf("reported as undelivered: %+v", in)
+	default:
+	}
+}
+
+func TestTelegramProxy(t *testing.T) {
+	// The proxy sees the Bot API request instead of the API itself.
+	proxied := make(chan string, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied <- r.URL.String()
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1}}`))
+	}))
+	defer proxy.Close()
+
+	c := newTelegramClient(context.Background(), chat.NewHub(10), "http://api.telegram.invalid/bottok", config.TelegramConfig{Proxy: proxy.URL})
+	c.send(chat.Outbound{ChatID: "1", Content: "via proxy"})
+	select {
+	case got := <-proxied:
+		if got != "http://api.telegram.invalid/bottok/sendMessage" {
+			t.Fatalf("unexpected proxied request: %s", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("request did not go through the proxy")
+	}
+
+	for _, bad := range []string{"ftp://proxy:21", "socks5://", "::"} {
+		if err := StartTelegramWithBase(context.Background(), chat.NewHub(10), "http://unused", config.TelegramConfig{Proxy: bad}); err == nil {
+			t.Errorf("proxy %q should be rejected", bad)
+		}
+	}
+}
+
+func TestTelegramChannelPosts(t *testing.T) {
+	first := true
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/getUpdates") && first {
+			first = false
+			w.Write([]byte(`{"ok":true,"result":[` +
+				`{"update_id":1,"channel_post":{"message_id":3,"chat":{"id":-1002,"type":"channel","title":"Other"},"text":"not ours"}},` +
+				`{"update_id":2,"channel_post":{"message_id":4,"chat":{"id":-1001,"type":"channel","title":"News","username":"News"},"text":"Release 2.0 is out"}}]}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true,"result":[]}`))
+	}))
+	defer h.Close()
+
+	b := chat.NewHub(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := StartTelegramWithBase(ctx, b, h.URL, config.TelegramConfig{PublishTo: []string{"@news"}}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-b.In:
+		if msg.Event() != "channel_post" || msg.ChatID != "-1001" || msg.Content != "[post in @News] Release 2.0 is out" {
+			t.Fatalf("unexpected inbound: %+v", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for the channel post")
+	}
+	select {
+	case msg := <-b.In:
+		t.Fatalf("unexpected inbound: %+v", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestTelegramChannelPostFailureIsNotReported(t *testing.T) {
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/sendMessage") {
+			w.Write([]byte(`{"ok":false,"error_code":403,"description":"Forbidden: bot is not a member of the channel chat"}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true,"result":[]}`))
+	}))
+	defer h.Close()
+
+	b := chat.NewHub(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := newTelegramClient(ctx, b, h.URL, config.TelegramConfig{})
+	c.send(chat.Outbound{Channel: "telegram", ChatID: "@news", Content: "Release 2.0 is out", Metadata: map[string]interface{}{"channel_post": true}})
+	select {
+	case msg := <-b.In:
+		t.Fatalf("a failed channel post was reported back: %+v", msg)
+	default:
+	}
+}
@@ -0,0 +1,81 @@
+package channels
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// maxFollowedThreads caps how many channel threads a channel follows; the
+// least recently active ones are forgotten first.
+const maxFollowedThreads = 1000
+
+// followedThreads is the set of channel threads the bot takes part in, by
+// chat ID, with when each was last active.
+type followedThreads struct {
+	mu     sync.Mutex
+	active map[string]time.Time
+}
+
+func newFollowedThreads() *followedThreads {
+	return &followedThreads{active: make(map[string]time.Time)}
+}
+
+// follow adds thread chatID, forgetting the least recently active one when
+// there are too many.
+func (t *followedThreads) follow(chatID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active[chatID] = time.Now()
+	if len(t.active) <= maxFollowedThreads {
+		return
+	}
+	oldest, at := "", time.Time{}
+	for id, last := range t.active {
+		if oldest == "" || last.Before(at) {
+			oldest, at = id, last
+		}
+	}
+	delete(t.active, oldest)
+}
+
+// touch reports whether thread chatID is followed, marking it active.
+func (t *followedThreads) touch(chatID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.active[chatID]; !ok {
+		return false
+	}
+	t.active[chatID] = time.Now()
+	return true
+}
+
+// load adds the threads saved at path, if the file exists.
+func (t *followedThreads) load(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return json.Unmarshal(data, &t.active)
+}
+
+// save writes the followed threads to path, so they outlive a restart.
+func (t *followedThreads) save(path string) error {
+	t.mu.Lock()
+	data, err := json.Marshal(t.active)
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
@@ -0,0 +1,716 @@
+package channels
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/local/picobot/embeds"
+	"github.com/local/picobot/internal/access"
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/netguard"
+)
+
+const (
+	// webDefaultListen is the address the web chat is served on by default:
+	// local only.
+	webDefaultListen = "127.0.0.1:8791"
+	// webBacklog is how many replies are kept for a chat with no page open,
+	// and shown when one opens.
+	webBacklog = 50
+	// webMaxMessage caps the size of a message sent by the page.
+	webMaxMessage = 64 << 10
+	// webDefaultMaxUploadMB caps the size of an uploaded file.
+	webDefaultMaxUploadMB = 20
+	// webCookie keeps the token once the page was opened with it.
+	webCookie = "picobot_web"
+	// webChatCookie keeps the chat of a browser, signed so that it cannot
+	// be made up to read another chat.
+	webChatCookie = "picobot_chat"
+	// webMaxMedia caps how many files sent to pages stay downloadable; the
+	// oldest go first.
+	webMaxMedia = 500
+	// webConnQueue is how many frames wait for a slow WebSocket before its
+	// partial replies are dropped, and it is closed when a message finds no
+	// room. It holds a whole backlog.
+	webConnQueue = 64
+)
+
+// errWebConnClosed is returned for a frame sent to a closed WebSocket.
+var errWebConnClosed = errors.New("websocket closed")
+
+// webChatIDRE is what a page may use as its chat ID.
+var webChatIDRE = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// StartWeb serves the web chat on cfg.Listen: a page (embeds.WebChat)
+// talking to the agent over a WebSocket at /ws, with replies streamed as
+// they are written, and uploading files into the chat's inbox in the
+// workspace through /upload. Each browser gets a chat of its own. A token
+// is always required: without cfg.Token one is made up at startup and the
+// page's address logged. The page is opened once with ?token=<token>,
+// which is then kept in a cookie. Requests naming another host than the
+// loopback names, the listen address or cfg.Hosts are refused, so that
+// other sites cannot reach the chat through DNS rebinding. With cfg.OAuth,
+// users sign in with an OAuth2 or OpenID Connect provider instead, and
+// each has one chat in every browser.
+func StartWeb(ctx context.Context, hub *chat.Hub, cfg config.WebConfig) error {
+	addr := cfg.Listen
+	if addr == "" {
+		addr = webDefaultListen
+	}
+	generated := cfg.Token == ""
+	if generated {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return fmt.Errorf("web: making up a token: %w", err)
+		}
+		cfg.Token = hex.EncodeToString(b)
+	}
+	ln, err := netguard.Listen("web", addr, cfg.Transport, "http/1.1")
+	if err != nil {
+		return err
+	}
+	cfg.Listen = addr
+	s, err := newWebServer(ctx, hub, cfg)
+	if err != nil {
+		ln.Close()
+		return err
+	}
+	if generated && s.oauth == nil {
+		log.Printf("web: no channels.web.token set; open %s://%s/?token=%s (valid until picobot restarts)", netguard.Scheme(cfg.Transport), ln.Addr(), cfg.Token)
+	}
+	srv := &http.Server{Handler: s.handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+	go func() {
+		log.Printf("web: chat served on %s://%s/", netguard.Scheme(cfg.Transport), ln.Addr())
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("web: %v", err)
+		}
+	}()
+	go s.runOutbound()
+	return nil
+}
+
+// isLoopbackHost reports whether host names the loopback interface.
+func isLoopbackHost(host string) bool {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// webHosts returns the host names the web chat answers to besides the
+// loopback ones: the host of listen, unless it is a wildcard address, and
+// hosts, in lower case.
+func webHosts(listen string, hosts []string) map[string]bool {
+	set := make(map[string]bool)
+	if host, _, err := net.SplitHostPort(listen); err == nil {
+		if ip := net.ParseIP(host); host != "" && (ip == nil || !ip.IsUnspecified()) {
+			set[strings.ToLower(host)] = true
+		}
+	}
+	for _, h := range hosts {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			set[h] = true
+		}
+	}
+	return set
+}
+
+// webServer is the web chat: its pages, their connections and the replies
+// waiting for them.
+type webServer struct {
+	hub       *chat.Hub
+	outCh     <-chan chat.Outbound
+	ctx       context.Context
+	token     string          // also the secret signing the cookies
+	oauth     *webOAuth       // nil: the token is required instead
+	hosts     map[string]bool // the hosts answered to besides the loopback ones
+	allowed   *access.Policy  // which chats may talk to the agent
+	workspace string
+	maxUpload int64
+	page      []byte
+	upgrader  websocket.Upgrader
+
+	mu         sync.Mutex
+	conns      map[string]map[*webConn]bool // by chat ID, the pages open
+	backlog    map[string][]webEvent        // by chat ID, replies no page was open for
+	media      map[string]webMedia          // by ID, the files sent to pages
+	mediaOrder []string                     // the IDs of media, oldest first
+	nextID     int
+}
+
+// webMedia is a file sent to the pages of a chat.
+type webMedia struct {
+	chatID string
+	path   string
+}
+
+// webConn is the WebSocket of one open page, or of a client of the API.
+// Frames are written by a goroutine of its own, so that a slow client holds
+// up no one else.
+type webConn struct {
+	ws        *websocket.Conn
+	channel   string // for the log
+	queue     chan any
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newWebConn(ws *websocket.Conn, channel string) *webConn {
+	c := &webConn{ws: ws, channel: channel, queue: make(chan any, webConnQueue), done: make(chan struct{})}
+	go c.write()
+	return c
+}
+
+// write writes the queued frames until the connection is closed.
+func (c *webConn) write() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case v := <-c.queue:
+			c.ws.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := c.ws.WriteJSON(v); err != nil {
+				log.Printf("%s: send error: %v", c.channel, err)
+				c.close()
+				return
+			}
+		}
+	}
+}
+
+// send queues frame v. Waiting for room would hold up the other chats, so
+// a connection whose queue is full is closed instead; the client reconnects.
+func (c *webConn) send(v any) error {
+	select {
+	case <-c.done:
+		return errWebConnClosed
+	default:
+	}
+	select {
+	case c.queue <- v:
+		return nil
+	default:
+		log.Printf("%s: closing a WebSocket too slow to keep up", c.channel)
+		c.close()
+		return errWebConnClosed
+	}
+}
+
+// offer queues frame v unless the queue is full: partial replies are
+// superseded by the next one.
+func (c *webConn) offer(v any) {
+	select {
+	case c.queue <- v:
+	default:
+	}
+}
+
+// close closes the connection, which ends the read loop of its handler.
+func (c *webConn) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.ws.Close()
+	})
+}
+
+// webEvent is a message for the page: a "partial" snapshot of a reply being
+// written, or a finished "message". Snapshots and the final message of a
+// reply share its ID. A "tool" event tells of a tool the agent ran while
+// answering, failed when Error is set.
+type webEvent struct {
+	Type  string    `json:"type"`
+	ID    string    `json:"id,omitempty"`
+	Text  string    `json:"text"`
+	Files []webFile `json:"files,omitempty"`
+	Tool  string    `json:"tool,omitempty"`
+	Error string    `json:"error,omitempty"`
+}
+
+// webFile is a file sent with a reply, downloaded from URL.
+type webFile struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// webMessage is a message typed in the page, with the workspace paths of
+// the files uploaded for it.
+type webMessage struct {
+	Text  string   `json:"text"`
+	Files []string `json:"files"`
+}
+
+func newWebServer(ctx context.Context, hub *chat.Hub, cfg config.WebConfig) (*webServer, error) {
+	page, err := fs.ReadFile(embeds.WebChat, "webchat/index.html")
+	if err != nil {
+		return nil, fmt.Errorf("web: %w", err)
+	}
+	maxMB := cfg.MaxUploadMB
+	if maxMB <= 0 {
+		maxMB = webDefaultMaxUploadMB
+	}
+	allowed, err := access.NewPolicy(cfg.AllowFrom, cfg.Deny)
+	if err != nil {
+		return nil, fmt.Errorf("web: allowFrom: %w", err)
+	}
+	// Partial replies are shown as they are written, and the tools run
+	// for them.
+	var oauth *webOAuth
+	if cfg.OAuth.ClientID != "" {
+		// Anyone with an account at the provider could sign in otherwise.
+		if len(cfg.AllowFrom) == 0 {
+			return nil, fmt.Errorf("web: oauth needs allowFrom, listing the users who may sign in")
+		}
+		if oauth, err = newWebOAuth(ctx, cfg.OAuth); err != nil {
+			return nil, fmt.Errorf("web: %w", err)
+		}
+	}
+	hub.EnableStreaming("web")
+	hub.EnableToolEvents("web")
+	return &webServer{
+		hub:       hub,
+		outCh:     hub.Subscribe("web"),
+		ctx:       ctx,
+		token:     cfg.Token,
+		oauth:     oauth,
+		hosts:     webHosts(cfg.Listen, cfg.Hosts),
+		allowed:   allowed,
+		workspace: cfg.Workspace,
+		maxUpload: int64(maxMB) << 20,
+		page:      page,
+		conns:     make(map[string]map[*webConn]bool),
+		backlog:   make(map[string][]webEvent),
+		media:     make(map[string]webMedia),
+	}, nil
+}
+
+// handler returns the web chat's routes:
+//
+//	GET  /                  the page
+//	GET  /ws                the chat's WebSocket
+//	POST /upload            a file (multipart "file") for the chat's inbox
+//	GET  /media/<id>/<name> a file sent with a reply
+//	GET  /auth/login        signing in with OAuth
+//	GET  /auth/callback     where the provider sends the user back
+//	GET  /auth/logout       signing out
+//
+// The chat is the one of the browser's chat cookie, set with the page, or,
+// with OAuth, the signed-in user's.
+func (s *webServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.handlePage)
+	if s.oauth != nil {
+		mux.HandleFunc("GET /auth/login", s.handleLogin)
+		mux.HandleFunc("GET "+webCallbackPath, s.handleCallback)
+		mux.HandleFunc("GET /auth/logout", s.handleLogout)
+	}
+	mux.HandleFunc("GET /ws", s.authorized(s.handleSocket))
+	mux.HandleFunc("POST /upload", s.authorized(s.handleUpload))
+	mux.HandleFunc("GET /media/{id}/{name}", s.authorized(s.handleMedia))
+	return s.checkHost(mux)
+}
+
+// checkHost refuses requests for other hosts than the ones the chat
+// answers to.
+func (s *webServer) checkHost(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.ToLower(strings.Trim(host, "[]"))
+		if !isLoopbackHost(host) && !s.hosts[host] {
+			http.Error(w, "unknown host; add it to channels.web.hosts", http.StatusMisdirectedRequest)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tokenOK reports whether r carries the token: in the cookie, as a bearer
+// token or as the "token" query parameter. With OAuth, it reports whether
+// r has a session instead.
+func (s *webServer) tokenOK(r *http.Request) bool {
+	if s.oauth != nil {
+		_, ok := s.session(r)
+		return ok
+	}
+	token := r.URL.Query().Get("token")
+	if t, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		token = t
+	} else if c, err := r.Cookie(webCookie); err == nil && token == "" {
+		token = c.Value
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+func (s *webServer) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.tokenOK(r) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// chatSig signs chat ID id with the token.
+func (s *webServer) chatSig(id string) string {
+	mac := hmac.New(sha256.New, []byte(s.token))
+	mac.Write([]byte("chat:" + id))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// requestUser returns who r comes from: the user of its session with
+// OAuth, else the chat of its chat cookie, if it was set by the server.
+func (s *webServer) requestUser(r *http.Request) (webUser, bool) {
+	if s.oauth != nil {
+		return s.session(r)
+	}
+	c, err := r.Cookie(webChatCookie)
+	if err != nil {
+		return webUser{}, false
+	}
+	id, sig, ok := strings.Cut(c.Value, ".")
+	if !ok || !webChatIDRE.MatchString(id) || !hmac.Equal([]byte(sig), []byte(s.chatSig(id))) {
+		return webUser{}, false
+	}
+	return webUser{ID: id, Name: "web", chat: id}, true
+}
+
+// handlePage serves the page. Opened with the token in the URL, it keeps
+// the token in a cookie and drops it from the address bar. A browser
+// without a chat gets a new one in its chat cookie. With OAuth, a browser
+// without a session is sent to sign in.
+func (s *webServer) handlePage(w http.ResponseWriter, r *http.Request) {
+	if s.oauth != nil {
+		if _, ok := s.session(r); !ok {
+			http.Redirect(w, r, "/auth/login", http.StatusFound)
+			return
+		}
+	} else if !s.tokenOK(r) {
+		http.Error(w, "unauthorized: open this page with ?token=<channels.web.token>", http.StatusUnauthorized)
+		return
+	}
+	if _, ok := s.requestUser(r); !ok {
+		b := make([]byte, 8)
+		rand.Read(b)
+		id := "web-" + hex.EncodeToString(b)
+		http.SetCookie(w, &http.Cookie{Name: webChatCookie, Value: id + "." + s.chatSig(id), Path: "/", MaxAge: 10 * 365 * 24 * 3600,
+			HttpOnly: true, SameSite: http.SameSiteStrictMode, Secure: r.TLS != nil})
+	}
+	if r.URL.Query().Has("token") {
+		http.SetCookie(w, &http.Cookie{Name: webCookie, Value: s.token, Path: "/", HttpOnly: true, SameSite: http.SameSiteStrictMode, Secure: r.TLS != nil})
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(s.page)
+}
+
+// user returns who r comes from, answering the request with an error when
+// it has no chat or may not talk to the agent.
+func (s *webServer) user(w http.ResponseWriter, r *http.Request) (webUser, bool) {
+	u, ok := s.requestUser(r)
+	if !ok {
+		http.Error(w, "no chat: reload the page", http.StatusBadRequest)
+		return webUser{}, false
+	}
+	if !s.allowed.Allowed(u.ID) {
+		log.Printf("web: refused %s, not in allowFrom", u.ID)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return webUser{}, false
+	}
+	return u, true
+}
+
+// handleSocket connects a page to its chat: replies kept while no page was
+// open are sent first, then the page's messages go to the agent.
+func (s *webServer) handleSocket(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.user(w, r)
+	if !ok {
+		return
+	}
+	chatID := u.chat
+	// The upgrader refuses pages of other origins.
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	ws.SetReadLimit(webMaxMessage)
+	conn := newWebConn(ws, "web")
+
+	s.mu.Lock()
+	if s.conns[chatID] == nil {
+		s.conns[chatID] = make(map[*webConn]bool)
+	}
+	s.conns[chatID][conn] = true
+	backlog := s.backlog[chatID]
+	delete(s.backlog, chatID)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns[chatID], conn)
+		if len(s.conns[chatID]) == 0 {
+			delete(s.conns, chatID)
+		}
+		s.mu.Unlock()
+		conn.close()
+	}()
+	for _, ev := range backlog {
+		if err := conn.send(ev); err != nil {
+			return
+		}
+	}
+
+	for {
+		var msg webMessage
+		if err := ws.ReadJSON(&msg); err != nil {
+			return
+		}
+		s.handleMessage(u, msg)
+	}
+}
+
+// handleMessage turns a message typed in a page into an inbound message.
+func (s *webServer) handleMessage(u webUser, msg webMessage) {
+	chatID := u.chat
+	content := strings.TrimSpace(msg.Text)
+	var media []string
+	for _, rel := range msg.Files {
+		abs, ok := s.inboxFile(chatID, rel)
+		if !ok {
+			log.Printf("web: ignored file %q outside the chat's inbox", rel)
+			continue
+		}
+		media = append(media, abs)
+		content += "\n[file saved as " + filepath.ToSlash(rel) + " in the workspace]"
+	}
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return
+	}
+	s.mu.Lock()
+	s.nextID++
+	id := "w" + strconv.Itoa(s.nextID)
+	s.mu.Unlock()
+	log.Printf("web: message in %s: %s", chatID, truncate(content, 50))
+	meta := map[string]interface{}{"message_id": id, "is_dm": true}
+	if u.admin {
+		meta["admin"] = true
+	}
+	s.hub.In <- chat.Inbound{
+		Channel:    "web",
+		SenderID:   u.ID,
+		SenderName: u.Name,
+		ChatID:     chatID,
+		Content:    content,
+		Media:      media,
+		Timestamp:  time.Now(),
+		Metadata:   meta,
+	}
+}
+
+// inboxDir returns the chat's inbox, relative to the workspace.
+func (s *webServer) inboxDir(chatID string) string {
+	return filepath.Join(inboxDir, "web", chatID)
+}
+
+// inboxFile returns the absolute path of rel if it is a file in the chat's
+// inbox.
+func (s *webServer) inboxFile(chatID, rel string) (string, bool) {
+	rel = filepath.Clean(filepath.FromSlash(rel))
+	dir := s.inboxDir(chatID)
+	if filepath.Dir(rel) != dir || s.workspace == "" {
+		return "", false
+	}
+	abs, err := filepath.Abs(filepath.Join(s.workspace, rel))
+	if err != nil {
+		return "", false
+	}
+	if fi, err := os.Stat(abs); err != nil || !fi.Mode().IsRegular() {
+		return "", false
+	}
+	return abs, true
+}
+
+// handleUpload saves a file into the chat's inbox and answers with its
+// path relative to the workspace, which the page sends with its next
+// message.
+func (s *webServer) handleUpload(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.user(w, r)
+	if !ok {
+		return
+	}
+	chatID := u.chat
+	if s.workspace == "" {
+		http.Error(w, "no workspace to save files in", http.StatusServiceUnavailable)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxUpload+1<<20)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			http.Error(w, "file larger than "+formatFileSize(s.maxUpload), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "a multipart \"file\" is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	rel, err := s.saveUpload(chatID, header, file)
+	if err != nil {
+		log.Printf("web: saving upload: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"path": filepath.ToSlash(rel), "name": filepath.Base(rel)})
+}
+
+// saveUpload writes an uploaded file into the chat's inbox and returns its
+// path relative to the workspace. An existing file of the same name is
+// kept: the new one gets a numbered name.
+func (s *webServer) saveUpload(chatID string, header *multipart.FileHeader, file io.Reader) (string, error) {
+	if header.Size > s.maxUpload {
+		return "", fmt.Errorf("file larger than %s", formatFileSize(s.maxUpload))
+	}
+	name := filepath.Base(filepath.Clean("/" + header.Filename))
+	if name == "/" || name == "." {
+		name = "upload"
+	}
+	dir := s.inboxDir(chatID)
+	if err := os.MkdirAll(filepath.Join(s.workspace, dir), 0o755); err != nil {
+		return "", err
+	}
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		rel := filepath.Join(dir, name)
+		f, err := os.OpenFile(filepath.Join(s.workspace, rel), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if os.IsExist(err) {
+			name = fmt.Sprintf("%s-%d%s", stem, i, ext)
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(f, io.LimitReader(file, s.maxUpload))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(filepath.Join(s.workspace, rel))
+			return "", err
+		}
+		return rel, nil
+	}
+}
+
+// handleMedia serves a file sent with a reply to the pages of the
+// requester's chat.
+func (s *webServer) handleMedia(w http.ResponseWriter, r *http.Request) {
+	u, _ := s.requestUser(r)
+	s.mu.Lock()
+	m, ok := s.media[r.PathValue("id")]
+	s.mu.Unlock()
+	if !ok || m.chatID != u.chat {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", filepath.Base(m.path)))
+	http.ServeFile(w, r, m.path)
+}
+
+// runOutbound reads replies from the hub's web subscription and sends them
+// to the chat's open pages, or keeps them until one opens.
+func (s *webServer) runOutbound() {
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case out := <-s.outCh:
+			s.deliver(out)
+		}
+	}
+}
+
+func (s *webServer) deliver(out chat.Outbound) {
+	ev := webEvent{Type: "message", ID: out.StreamID, Text: stripHidingMarkers(out.Content, false)}
+	tool, isTool := out.Metadata["tool_event"].(chat.ToolEvent)
+	switch {
+	case isTool:
+		ev = webEvent{Type: "tool", Tool: tool.Name, Error: tool.Error}
+	case out.Partial:
+		ev.Type = "partial"
+	}
+	// Partial snapshots and tool events are of no use later.
+	passing := out.Partial || isTool
+	s.mu.Lock()
+	for _, path := range out.Media {
+		s.nextID++
+		id := strconv.Itoa(s.nextID)
+		s.media[id] = webMedia{chatID: out.ChatID, path: path}
+		s.mediaOrder = append(s.mediaOrder, id)
+		if len(s.mediaOrder) > webMaxMedia {
+			delete(s.media, s.mediaOrder[0])
+			s.mediaOrder = s.mediaOrder[1:]
+		}
+		name := filepath.Base(path)
+		ev.Files = append(ev.Files, webFile{Name: name, URL: "/media/" + id + "/" + name})
+	}
+	var conns []*webConn
+	for c := range s.conns[out.ChatID] {
+		conns = append(conns, c)
+	}
+	if len(conns) == 0 {
+		if !passing {
+			backlog := append(s.backlog[out.ChatID], ev)
+			if len(backlog) > webBacklog {
+				backlog = backlog[len(backlog)-webBacklog:]
+			}
+			s.backlog[out.ChatID] = backlog
+		}
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+	for _, c := range conns {
+		if passing {
+			c.offer(ev)
+		} else {
+			c.send(ev)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package channels
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/local/picobot/internal/access"
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/useragent"
+)
+
+const (
+	// webSessionCookie keeps a signed-in user's session.
+	webSessionCookie = "picobot_session"
+	// webLoginCookie keeps the state and PKCE verifier of a sign-in under
+	// way, until the provider redirects back.
+	webLoginCookie = "picobot_login"
+	// webSessionTTL is how long a sign-in lasts.
+	webSessionTTL = 7 * 24 * time.Hour
+	// webCallbackPath is where the provider redirects back to.
+	webCallbackPath = "/auth/callback"
+)
+
+// webOAuth signs the users of the web chat in with an OAuth2 or OpenID
+// Connect provider (authorization code flow with PKCE), and knows them by
+// a claim of their user info.
+type webOAuth struct {
+	authURL, tokenURL, userInfoURL string
+	clientID, clientSecret         string
+	redirectURL                    string
+	scopes                         []string
+	idClaim                        string
+	admins                         *access.List
+	client                         *http.Client
+}
+
+// webUser is who a request of the web chat comes from: a signed-in user,
+// or, without OAuth, the browser, known by its chat.
+type webUser struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Expiry int64  `json:"exp"` // Unix seconds
+
+	chat  string // the user's chat
+	admin bool   // whether the user may use the admin commands
+}
+
+// userChat returns the chat of a signed-in user: the same in every
+// browser, and, being a hash, a valid chat ID whatever the user's ID holds.
+func userChat(id string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(id)))
+	return "user-" + hex.EncodeToString(sum[:10])
+}
+
+// newWebOAuth returns the sign-in of cfg, discovering the provider's
+// endpoints from its issuer when they are not given.
+func newWebOAuth(ctx context.Context, cfg config.WebOAuthConfig) (*webOAuth, error) {
+	if cfg.RedirectURL == "" || !strings.HasSuffix(cfg.RedirectURL, webCallbackPath) {
+		return nil, fmt.Errorf("oauth.redirectURL must be the chat's address followed by %s", webCallbackPath)
+	}
+	admins, err := access.Compile(cfg.Admins)
+	if err != nil {
+		return nil, fmt.Errorf("oauth.admins: %w", err)
+	}
+	o := &webOAuth{
+		authURL: cfg.AuthURL, tokenURL: cfg.TokenURL, userInfoURL: cfg.UserInfoURL,
+		clientID: cfg.ClientID, clientSecret: cfg.ClientSecret, redirectURL: cfg.RedirectURL,
+		scopes: cfg.Scopes, idClaim: cfg.IDClaim, admins: admins,
+		client: useragent.Client(30 * time.Second),
+	}
+	if len(o.scopes) == 0 {
+		o.scopes = []string{"openid", "email", "profile"}
+	}
+	if o.idClaim == "" {
+		o.idClaim = "email"
+	}
+	if cfg.Issuer != "" && (o.authURL == "" || o.tokenURL == "" || o.userInfoURL == "") {
+		if err := o.discover(ctx, cfg.Issuer); err != nil {
+			return nil, fmt.Errorf("oauth: discovering %s: %w", cfg.Issuer, err)
+		}
+	}
+	if o.authURL == "" || o.tokenURL == "" || o.userInfoURL == "" {
+		return nil, fmt.Errorf("oauth needs an issuer, or authURL, tokenURL and userInfoURL")
+	}
+	return o, nil
+}
+
+// discover fills in the endpoints the issuer's OpenID configuration lists.
+func (o *webOAuth) discover(ctx context.Context, issuer string) error {
+	var doc struct {
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimRight(issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return err
+	}
+	if err := o.do(req, &doc); err != nil {
+		return err
+	}
+	if o.authURL == "" {
+		o.authURL = doc.AuthorizationEndpoint
+	}
+	if o.tokenURL == "" {
+		o.tokenURL = doc.TokenEndpoint
+	}
+	if o.userInfoURL == "" {
+		o.userInfoURL = doc.UserinfoEndpoint
+	}
+	return nil
+}
+
+// do sends req, expecting JSON, and decodes the response into v.
+func (o *webOAuth) do(req *http.Request, v any) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s: %s", resp.Status, truncate(strings.TrimSpace(string(body)), 200))
+	}
+	dec := json.NewDecoder(strings.NewReader(string(body)))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// randomString returns n random bytes, URL-safe encoded.
+func randomString(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// handleLogin sends the browser to the provider to sign in, keeping the
+// state and PKCE verifier the callback checks in a short-lived cookie.
+func (s *webServer) handleLogin(w http.ResponseWriter, r *http.Request) {
+	state, verifier := randomString(16), randomString(32)
+	value := state + "." + verifier
+	http.SetCookie(w, &http.Cookie{Name: webLoginCookie, Value: value + "." + s.sign("login", value), Path: "/",
+		MaxAge: 600, HttpOnly: true, SameSite: http.SameSiteLaxMode, Secure: r.TLS != nil})
+	challenge := sha256.Sum256([]byte(verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {s.oauth.clientID},
+		"redirect_uri":          {s.oauth.redirectURL},
+		"scope":                 {strings.Join(s.oauth.scopes, " ")},
+		"state":                 {state},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(s.oauth.authURL, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, s.oauth.authURL+sep+q.Encode(), http.StatusFound)
+}
+
+// handleCallback finishes a sign-in: it exchanges the code for a token,
+// learns the user from the provider's user info, and, when allowFrom lets
+// them in, gives the browser a session.
+func (s *webServer) handleCallback(w http.ResponseWriter, r *http.Request) {
+	c, err := r.Cookie(webLoginCookie)
+	var state, verifier, sig string
+	if err == nil {
+		parts := strings.SplitN(c.Value, ".", 3)
+		if len(parts) == 3 {
+			state, verifier, sig = parts[0], parts[1], parts[2]
+		}
+	}
+	if state == "" || !hmac.Equal([]byte(sig), []byte(s.sign("login", state+"."+verifier))) || r.URL.Query().Get("state") != state {
+		http.Error(w, "sign-in expired or not started here: open the chat again", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: webLoginCookie, Path: "/", MaxAge: -1})
+	if e := r.URL.Query().Get("error"); e != "" {
+		http.Error(w, "sign-in refused by the provider: "+e, http.StatusForbidden)
+		return
+	}
+	user, err := s.oauth.user(r.Context(), r.URL.Query().Get("code"), verifier)
+	if err != nil {
+		log.Printf("web: sign-in failed: %v", err)
+		http.Error(w, "sign-in failed", http.StatusBadGateway)
+		return
+	}
+	if !s.allowed.Allowed(user.ID) {
+		log.Printf("web: refused %s, not in allowFrom", user.ID)
+		http.Error(w, "forbidden: "+user.ID+" may not use this chat", http.StatusForbidden)
+		return
+	}
+	user.Expiry = time.Now().Add(webSessionTTL).Unix()
+	payload, _ := json.Marshal(user)
+	value := base64.RawURLEncoding.EncodeToString(payload)
+	http.SetCookie(w, &http.Cookie{Name: webSessionCookie, Value: value + "." + s.sign("session", value), Path: "/",
+		MaxAge: int(webSessionTTL / time.Second), HttpOnly: true, SameSite: http.SameSiteLaxMode, Secure: r.TLS != nil})
+	log.Printf("web: %s signed in", user.ID)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// handleLogout ends the browser's session.
+func (s *webServer) handleLogout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: webSessionCookie, Path: "/", MaxAge: -1})
+	io.WriteString(w, "Signed out.")
+}
+
+// user exchanges code for an access token and returns the user its user
+// info describes.
+func (o *webOAuth) user(ctx context.Context, code, verifier string) (webUser, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {o.redirectURL},
+		"client_id":     {o.clientID},
+		"code_verifier": {verifier},
+	}
+	if o.clientSecret != "" {
+		form.Set("client_secret", o.clientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", o.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return webUser{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var tok struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := o.do(req, &tok); err != nil {
+		return webUser{}, fmt.Errorf("token: %w", err)
+	}
+	if tok.AccessToken == "" {
+		return webUser{}, fmt.Errorf("token: no access_token in the response")
+	}
+
+	req, err = http.NewRequestWithContext(ctx, "GET", o.userInfoURL, nil)
+	if err != nil {
+		return webUser{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+tok.AccessToken)
+	var info map[string]any
+	if err := o.do(req, &info); err != nil {
+		return webUser{}, fmt.Errorf("user info: %w", err)
+	}
+	id := claimString(info[o.idClaim])
+	if id == "" {
+		return webUser{}, fmt.Errorf("user info has no %q", o.idClaim)
+	}
+	if verified, ok := info["email_verified"].(bool); o.idClaim == "email" && ok && !verified {
+		return webUser{}, fmt.Errorf("%s is not verified", id)
+	}
+	name := id
+	for _, claim := range []string{"name", "preferred_username", "login"} {
+		if v := claimString(info[claim]); v != "" {
+			name = v
+			break
+		}
+	}
+	return webUser{ID: id, Name: name}, nil
+}
+
+// claimString returns a string or numeric claim as a string.
+func claimString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	}
+	return ""
+}
+
+// sign signs value for purpose with the chat's secret.
+func (s *webServer) sign(purpose, value string) string {
+	mac := hmac.New(sha256.New, []byte(s.token))
+	mac.Write([]byte(purpose + ":" + value))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// session returns the user of r's session cookie, if the server set it and
+// it has not expired.
+func (s *webServer) session(r *http.Request) (webUser, bool) {
+	c, err := r.Cookie(webSessionCookie)
+	if err != nil {
+		return webUser{}, false
+	}
+	value, sig, ok := strings.Cut(c.Value, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(s.sign("session", value))) {
+		return webUser{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(value)
+	var u webUser
+	if err != nil || json.Unmarshal(payload, &u) != nil || u.ID == "" || time.Now().Unix() > u.Expiry {
+		return webUser{}, false
+	}
+	// Not kept in the cookie, so that removing a user from admins does not
+	// wait for their session to expire.
+	u.chat, u.admin = userChat(u.ID), s.oauth.admins.Match(u.ID)
+	return u, true
+}
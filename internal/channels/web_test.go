@@ -0,0 +1,374 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+)
+
+func TestWebChat(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hub := chat.NewHub(10)
+	ws := t.TempDir()
+	s, err := newWebServer(ctx, hub, config.WebConfig{Token: "tok", Workspace: ws})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub.StartRouter(ctx)
+	go s.runOutbound()
+	srv := httptest.NewServer(s.handler())
+	defer srv.Close()
+	if !hub.Streams("web") || !hub.ToolEvents("web") {
+		t.Fatal("web chat receives neither partial replies nor tool events")
+	}
+
+	// The page needs the token, which it keeps in a cookie.
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	if resp, _ := noRedirect.Get(srv.URL + "/"); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("page without token: %s", resp.Status)
+	}
+	resp, err := noRedirect.Get(srv.URL + "/?token=tok")
+	if err != nil || resp.StatusCode != http.StatusSeeOther || len(resp.Cookies()) != 2 {
+		t.Fatalf("page with token: %v %v", resp, err)
+	}
+	// The server gives the browser its chat.
+	var cookies []*http.Cookie
+	var chatID string
+	for _, c := range resp.Cookies() {
+		cookies = append(cookies, &http.Cookie{Name: c.Name, Value: c.Value})
+		if c.Name == webChatCookie {
+			chatID, _, _ = strings.Cut(c.Value, ".")
+		}
+	}
+	if !webChatIDRE.MatchString(chatID) {
+		t.Fatalf("chat cookie = %v", resp.Cookies())
+	}
+	get := func(url string, auth bool) *http.Response {
+		req, _ := http.NewRequest("GET", url, nil)
+		if auth {
+			for _, c := range cookies {
+				req.AddCookie(c)
+			}
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	resp = get(srv.URL+"/", true)
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(page), `"/ws"`) {
+		t.Fatalf("page = %.200s", page)
+	}
+
+	// A reply for a chat with no page open waits for one.
+	hub.Out <- chat.Outbound{Channel: "web", ChatID: chatID, Content: "⏰ reminder"}
+	time.Sleep(50 * time.Millisecond)
+
+	// Upload a file for the next message.
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "../notes.txt")
+	fw.Write([]byte("hello"))
+	mw.Close()
+	req, _ := http.NewRequest("POST", srv.URL+"/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var up struct{ Path string }
+	json.NewDecoder(resp.Body).Decode(&up)
+	resp.Body.Close()
+	if up.Path != "inbox/web/"+chatID+"/notes.txt" {
+		t.Fatalf("upload saved as %q", up.Path)
+	}
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+	if _, _, err := websocket.DefaultDialer.Dial(wsURL, nil); err == nil {
+		t.Fatal("socket opened without the token")
+	}
+	// A made-up chat cookie does not open another chat.
+	forged := http.Header{"Cookie": {webCookie + "=tok; " + webChatCookie + "=" + chatID + ".0123"}}
+	if _, _, err := websocket.DefaultDialer.Dial(wsURL, forged); err == nil {
+		t.Fatal("socket opened with a forged chat")
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Cookie": {cookies[0].String() + "; " + cookies[1].String()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var ev webEvent
+	if err := conn.ReadJSON(&ev); err != nil || ev.Text != "⏰ reminder" {
+		t.Fatalf("backlog = %+v, %v", ev, err)
+	}
+
+	conn.WriteJSON(webMessage{Text: "summarise this", Files: []string{up.Path, "../../etc/passwd"}})
+	select {
+	case in := <-hub.In:
+		want := "summarise this\n[file saved as " + up.Path + " in the workspace]"
+		if in.Channel != "web" || in.ChatID != chatID || in.Content != want || len(in.Media) != 1 || in.Media[0] != filepath.Join(ws, up.Path) {
+			t.Fatalf("inbound = %+v", in)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for the inbound message")
+	}
+
+	// Streamed replies arrive as snapshots, then the final message, with a
+	// file to download.
+	file := filepath.Join(ws, "report.txt")
+	os.WriteFile(file, []byte("report"), 0o644)
+	hub.Out <- chat.Outbound{Channel: "web", ChatID: chatID, Content: "Sum", StreamID: "s1", Partial: true}
+	hub.Out <- chat.Outbound{Channel: "web", ChatID: chatID,
+		Metadata: map[string]interface{}{"tool_event": chat.ToolEvent{Name: "exec", Error: "exit status 1"}}}
+	hub.Out <- chat.Outbound{Channel: "web", ChatID: chatID, Content: "Summary.", StreamID: "s1", Media: []string{file}}
+	var partial, tool, final webEvent
+	conn.ReadJSON(&partial)
+	conn.ReadJSON(&tool)
+	conn.ReadJSON(&final)
+	if partial.Type != "partial" || partial.ID != "s1" || partial.Text != "Sum" {
+		t.Errorf("partial = %+v", partial)
+	}
+	if tool.Type != "tool" || tool.Tool != "exec" || tool.Error != "exit status 1" {
+		t.Errorf("tool event = %+v", tool)
+	}
+	if final.Type != "message" || final.ID != "s1" || final.Text != "Summary." || len(final.Files) != 1 {
+		t.Fatalf("final = %+v", final)
+	}
+	resp = get(srv.URL+final.Files[0].URL, true)
+	got, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(got) != "report" {
+		t.Errorf("downloaded %q", got)
+	}
+	// Other chats cannot download it.
+	req, _ = http.NewRequest("GET", srv.URL+final.Files[0].URL, nil)
+	req.Header.Set("Authorization", "Bearer tok")
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("download from another chat: %v %v", resp, err)
+	}
+}
+
+func TestWebChatHostsAndAccess(t *testing.T) {
+	s, err := newWebServer(context.Background(), chat.NewHub(1), config.WebConfig{Token: "tok", Listen: "0.0.0.0:8791",
+		Hosts: []string{"Chat.Example.com"}, Deny: []string{"web-*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := s.handler()
+	for host, want := range map[string]int{
+		"127.0.0.1:8791":        http.StatusOK,
+		"localhost:8791":        http.StatusOK,
+		"[::1]:8791":            http.StatusOK,
+		"chat.example.com":      http.StatusOK,
+		"attacker.example:8791": http.StatusMisdirectedRequest,
+		"0.0.0.0:8791":          http.StatusMisdirectedRequest,
+	} {
+		req := httptest.NewRequest("GET", "/?token=tok", nil)
+		req.Host = host
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if got := rec.Code; (want == http.StatusOK) != (got == http.StatusSeeOther) || want != http.StatusOK && got != want {
+			t.Errorf("host %s: %d", host, got)
+		}
+	}
+
+	// Denied chats cannot connect.
+	req := httptest.NewRequest("GET", "http://localhost/ws", nil)
+	req.AddCookie(&http.Cookie{Name: webCookie, Value: "tok"})
+	req.AddCookie(&http.Cookie{Name: webChatCookie, Value: "web-1." + s.chatSig("web-1")})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("denied chat: %d", rec.Code)
+	}
+}
+
+func TestWebChatOAuth(t *testing.T) {
+	// The provider: discovery, token and user info endpoints. The code is
+	// "code-<email>", and its token the email.
+	var challenge string
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		base := "http://" + r.Host
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{"authorization_endpoint": base + "/authorize",
+				"token_endpoint": base + "/token", "userinfo_endpoint": base + "/userinfo"})
+		case "/token":
+			r.ParseForm()
+			sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+			if r.PostForm.Get("client_secret") != "secret" || base64.RawURLEncoding.EncodeToString(sum[:]) != challenge {
+				http.Error(w, `{"error": "invalid_grant"}`, http.StatusBadRequest)
+				return
+			}
+			email, _ := strings.CutPrefix(r.PostForm.Get("code"), "code-")
+			json.NewEncoder(w).Encode(map[string]string{"access_token": email, "token_type": "Bearer"})
+		case "/userinfo":
+			email, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			json.NewEncoder(w).Encode(map[string]any{"sub": 42, "email": email, "email_verified": true, "name": "Ann"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer provider.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hub := chat.NewHub(10)
+	cfg := config.WebConfig{Token: "tok",
+		OAuth: config.WebOAuthConfig{Issuer: provider.URL, ClientID: "picobot", ClientSecret: "secret",
+			RedirectURL: "http://localhost/auth/callback", Admins: []string{"ann@example.com"}}}
+	// Without allowFrom, anyone with an account at the provider could
+	// sign in.
+	if _, err := newWebServer(ctx, hub, cfg); err == nil || !strings.Contains(err.Error(), "allowFrom") {
+		t.Fatalf("oauth without allowFrom: %v", err)
+	}
+	cfg.AllowFrom = []string{"*@example.com"}
+	s, err := newWebServer(ctx, hub, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(s.handler())
+	defer srv.Close()
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	// signIn goes through the sign-in as email and returns the session
+	// cookie, if one was given.
+	signIn := func(email string) (*http.Cookie, int) {
+		resp, err := noRedirect.Get(srv.URL + "/")
+		if err != nil || resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "/auth/login" {
+			t.Fatalf("page without a session: %v %v", resp, err)
+		}
+		resp, err = noRedirect.Get(srv.URL + "/auth/login")
+		if err != nil || resp.StatusCode != http.StatusFound || len(resp.Cookies()) != 1 {
+			t.Fatalf("login: %v %v", resp, err)
+		}
+		login := resp.Cookies()[0]
+		to, _ := url.Parse(resp.Header.Get("Location"))
+		q := to.Query()
+		if to.Path != "/authorize" || q.Get("client_id") != "picobot" || q.Get("code_challenge_method") != "S256" {
+			t.Fatalf("sent to %s", to)
+		}
+		challenge = q.Get("code_challenge")
+		req, _ := http.NewRequest("GET", srv.URL+"/auth/callback?code=code-"+url.QueryEscape(email)+"&state="+q.Get("state"), nil)
+		req.AddCookie(&http.Cookie{Name: login.Name, Value: login.Value})
+		resp, err = noRedirect.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		for _, c := range resp.Cookies() {
+			if c.Name == webSessionCookie && c.Value != "" {
+				return &http.Cookie{Name: c.Name, Value: c.Value}, resp.StatusCode
+			}
+		}
+		return nil, resp.StatusCode
+	}
+
+	// Users allowFrom does not list are refused.
+	if c, code := signIn("eve@evil.example"); c != nil || code != http.StatusForbidden {
+		t.Fatalf("eve signed in: %d", code)
+	}
+	// A callback with another state is refused.
+	if resp, _ := noRedirect.Get(srv.URL + "/auth/callback?code=code-ann@example.com&state=x"); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("callback without the login cookie: %s", resp.Status)
+	}
+	// The shared token does not open the chat.
+	if resp, _ := noRedirect.Get(srv.URL + "/?token=tok"); resp.StatusCode != http.StatusFound {
+		t.Fatalf("page with the token: %s", resp.Status)
+	}
+
+	session, code := signIn("ann@example.com")
+	if session == nil || code != http.StatusSeeOther {
+		t.Fatalf("ann not signed in: %d", code)
+	}
+	req, _ := http.NewRequest("GET", srv.URL+"/", nil)
+	req.AddCookie(session)
+	if resp, err := noRedirect.Do(req); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("page with a session: %v %v", resp, err)
+	}
+
+	// Messages come from the user, in the user's chat.
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Cookie": {session.String()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.WriteJSON(webMessage{Text: "hello"})
+	select {
+	case in := <-hub.In:
+		if in.SenderID != "ann@example.com" || in.SenderName != "Ann" || in.ChatID != userChat("ann@example.com") || !in.IsAdmin() {
+			t.Fatalf("inbound = %+v", in)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no inbound message")
+	}
+
+	// A tampered session is refused.
+	forged := &http.Cookie{Name: webSessionCookie, Value: session.Value + "0"}
+	if _, _, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Cookie": {forged.String()}}); err == nil {
+		t.Fatal("socket opened with a forged session")
+	}
+}
+
+func TestWebConnClosesWhenTooSlow(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	server := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, _ := upgrader.Upgrade(w, r, nil)
+		server <- ws
+	}))
+	defer srv.Close()
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	// No writer: the queue only fills up, as with a client that stopped
+	// reading.
+	c := &webConn{ws: <-server, channel: "test", queue: make(chan any, 2), done: make(chan struct{})}
+	c.offer("a")
+	c.offer("b")
+	c.offer("c") // dropped
+	select {
+	case <-c.done:
+		t.Fatal("a dropped partial closed the connection")
+	default:
+	}
+	if err := c.send("d"); err == nil {
+		t.Fatal("expected an error for a full queue")
+	}
+	select {
+	case <-c.done:
+	default:
+		t.Fatal("expected the connection to be closed")
+	}
+	if err := c.send("e"); err != errWebConnClosed {
+		t.Fatalf("send after close: %v", err)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	qrterminal "github.com/mdp/qrterminal/v3"
@@ -21,38 +22,72 @@ import (
 	waLog "go.mau.fi/whatsmeow/util/log"
 	_ "modernc.org/sqlite"
 
+	"github.com/local/picobot/internal/access"
 	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/stt"
+	"github.com/local/picobot/internal/tts"
+	"github.com/local/picobot/internal/watchdog"
 )
 
 // whatsappSender is the subset of *whatsmeow.Client used for outbound operations.
 // It exists to enable testing without a live WhatsApp WebSocket connection.
 type whatsappSender interface {
-	SendText(ctx context.Context, to types.JID, text string) error
+	SendText(ctx context.Context, to types.JID, text string, quote *waProto.ContextInfo) error
 	SendChatPresence(ctx context.Context, chat types.JID, state types.ChatPresence, media types.ChatPresenceMedia) error
 	MarkRead(ctx context.Context, ids []types.MessageID, timestamp time.Time, chat, sender types.JID) error
 	SendPresence(ctx context.Context, state types.Presence) error
+	Download(ctx context.Context, msg whatsmeow.DownloadableMessage) ([]byte, error)
+	SendFile(ctx context.Context, to types.JID, data []byte, name, mimeType string) error
+	SetGroupName(ctx context.Context, group types.JID, name string) error
+	SetGroupDescription(ctx context.Context, group types.JID, description string) error
+	Star(ctx context.Context, chat, sender types.JID, id types.MessageID, fromMe bool) error
+	SendVoice(ctx context.Context, to types.JID, data []byte) error
+	GetContact(ctx context.Context, jid types.JID) (types.ContactInfo, error)
+	SendButtons(ctx context.Context, to types.JID, text string, buttons []chat.Button) error
+	PostStatus(ctx context.Context, text string, image []byte, mimeType string) error
 }
 
 // realWhatsAppSender wraps *whatsmeow.Client to implement whatsappSender.
+// The client is replaced when the account is linked again (see
+// whatsappPairer).
 type realWhatsAppSender struct {
-	c *whatsmeow.Client
+	c atomic.Pointer[whatsmeow.Client]
 }
 
-func (r *realWhatsAppSender) SendText(ctx context.Context, to types.JID, text string) error {
-	_, err := r.c.SendMessage(ctx, to, &waProto.Message{Conversation: &text})
+func (r *realWhatsAppSender) client() *whatsmeow.Client { return r.c.Load() }
+func (r *realWhatsAppSender) set(c *whatsmeow.Client)   { r.c.Store(c) }
+
+// SendText sends text, quoting the message described by quote when it is
+// not nil.
+func (r *realWhatsAppSender) SendText(ctx context.Context, to types.JID, text string, quote *waProto.ContextInfo) error {
+	msg := &waProto.Message{Conversation: &text}
+	if quote != nil {
+		msg = &waProto.Message{ExtendedTextMessage: &waProto.ExtendedTextMessage{Text: &text, ContextInfo: quote}}
+	}
+	_, err := r.client().SendMessage(ctx, to, msg)
 	return err
 }
 
 func (r *realWhatsAppSender) SendChatPresence(ctx context.Context, chat types.JID, state types.ChatPresence, media types.ChatPresenceMedia) error {
-	return r.c.SendChatPresence(ctx, chat, state, media)
+	return r.client().SendChatPresence(ctx, chat, state, media)
+}
+
+// GetContact looks jid up in the device's contact store.
+func (r *realWhatsAppSender) GetContact(ctx context.Context, jid types.JID) (types.ContactInfo, error) {
+	return r.client().Store.Contacts.GetContact(ctx, jid)
 }
 
 func (r *realWhatsAppSender) MarkRead(ctx context.Context, ids []types.MessageID, timestamp time.Time, chat, sender types.JID) error {
-	return r.c.MarkRead(ctx, ids, timestamp, chat, sender)
+	return r.client().MarkRead(ctx, ids, timestamp, chat, sender)
 }
 
 func (r *realWhatsAppSender) SendPresence(ctx context.Context, state types.Presence) error {
-	return r.c.SendPresence(ctx, state)
+	return r.client().SendPresence(ctx, state)
+}
+
+func (r *realWhatsAppSender) Download(ctx context.Context, msg whatsmeow.DownloadableMessage) ([]byte, error) {
+	return r.client().Download(ctx, msg)
 }
 
 // whatsappLogger adapts the whatsmeow logger to use Go's standard logger.
@@ -81,14 +116,26 @@ func (l quietLogger) Infof(msg string, args ...interface{})  {}
 func (l quietLogger) Debugf(msg string, args ...interface{}) {}
 func (l quietLogger) Sub(module string) waLog.Logger         { return l }
 
+// whatsappStallAfter is how long the socket may stay disconnected before the
+// watchdog forces a reconnect.
+const whatsappStallAfter = 3 * time.Minute
+
 // StartWhatsApp starts a WhatsApp bot using the whatsmeow library.
-// dbPath is the path to the SQLite database for storing session data.
-// allowFrom restricts which phone numbers (digits only, e.g. "15551234567") may
-// send messages; empty means allow all.
-func StartWhatsApp(ctx context.Context, hub *chat.Hub, dbPath string, allowFrom []string) error {
+// cfg.DBPath is the path to the SQLite database for storing session data.
+// cfg.AllowFrom restricts which numbers (e.g. "15551234567", or patterns such
+// as "+5511*") may send messages; empty means allow all. When cfg.Inbox is
+// enabled, images and voice notes are saved in the workspace, and voice notes
+// are transcribed with transcriber unless it is nil. cfg.VoiceReplies has
+// replies read aloud by synthesizer and sent as voice notes.
+func StartWhatsApp(ctx context.Context, hub *chat.Hub, cfg config.WhatsAppConfig, transcriber stt.Transcriber, synthesizer tts.Synthesizer) error {
+	dbPath := cfg.DBPath
 	if dbPath == "" {
 		return fmt.Errorf("whatsapp database path not provided")
 	}
+	allowed, err := access.NewPolicy(cfg.AllowFrom, cfg.Deny)
+	if err != nil {
+		return fmt.Errorf("whatsapp allowFrom: %w", err)
+	}
 
 	if err := os.MkdirAll(filepath.Dir(dbPath), 0700); err != nil {
 		return fmt.Errorf("failed to create whatsapp db directory: %w", err)
@@ -105,31 +152,102 @@ func StartWhatsApp(ctx context.Context, hub *chat.Hub, dbPath string, allowFrom
 	}
 
 	rawClient := whatsmeow.NewClient(deviceStore, whatsappLogger{})
-	if rawClient.Store.ID == nil {
+	remotePairing := cfg.Pairing.Channel != "" && cfg.Pairing.ChatID != ""
+	if rawClient.Store.ID == nil && !remotePairing {
 		return fmt.Errorf("whatsapp not authenticated - please run 'picobot channels login' and select WhatsApp")
 	}
 
-	sender := &realWhatsAppSender{c: rawClient}
-	own := *rawClient.Store.ID
-	ownLID := rawClient.Store.GetLID()
-	waClient := newWhatsAppClient(ctx, sender, hub, allowFrom, own, ownLID)
-	rawClient.AddEventHandler(waClient.handleEvent)
-
-	if err := rawClient.Connect(); err != nil {
-		return fmt.Errorf("failed to connect to whatsapp: %w", err)
+	sender := &realWhatsAppSender{}
+	sender.set(rawClient)
+	var own, ownLID types.JID
+	if rawClient.Store.ID != nil {
+		own = *rawClient.Store.ID
+		ownLID = rawClient.Store.GetLID()
+	}
+	waClient := newWhatsAppClient(ctx, sender, hub, allowed, own, ownLID)
+	for _, g := range cfg.AllowGroups {
+		waClient.allowGroups[g] = struct{}{}
+	}
+	waClient.groupTrigger = cfg.GroupTrigger
+	if cfg.Typing != nil {
+		waClient.typing = *cfg.Typing
+	}
+	waClient.setReadReceipts(cfg.ReadReceipts)
+	waClient.setVoiceReplies(cfg.VoiceReplies, synthesizer)
+	waClient.setButtons(cfg.Buttons)
+	if cfg.Inbox.Enabled && cfg.Inbox.Workspace != "" {
+		waClient.inbox = cfg.Inbox.Workspace
+		waClient.transcriber = transcriber
+	}
+	pairer := &whatsappPairer{ctx: ctx, hub: hub, container: container, cfg: cfg.Pairing,
+		dir: filepath.Dir(dbPath), sender: sender, client: waClient}
+	var handler func(interface{})
+	handler = func(evt interface{}) {
+		if _, ok := evt.(*events.LoggedOut); ok {
+			if !remotePairing {
+				log.Printf("whatsapp: logged out - please run 'picobot channels login' and select WhatsApp")
+				return
+			}
+			log.Printf("whatsapp: logged out, sending pairing codes to %s:%s", cfg.Pairing.Channel, cfg.Pairing.ChatID)
+			go pairer.relink(handler)
+			return
+		}
+		waClient.handleEvent(evt)
 	}
-	if ownLID.IsEmpty() {
-		log.Printf("whatsapp: connected as %s", own.User)
+	rawClient.AddEventHandler(handler)
+
+	if rawClient.Store.ID == nil {
+		log.Printf("whatsapp: not linked, sending pairing codes to %s:%s", cfg.Pairing.Channel, cfg.Pairing.ChatID)
+		go func() {
+			pairer.mu.Lock()
+			defer pairer.mu.Unlock()
+			pairer.pair(rawClient)
+		}()
 	} else {
-		log.Printf("whatsapp: connected as %s (LID: %s)", own.User, ownLID.User)
+		if err := rawClient.Connect(); err != nil {
+			return fmt.Errorf("failed to connect to whatsapp: %w", err)
+		}
+		if ownLID.IsEmpty() {
+			log.Printf("whatsapp: connected as %s", own.User)
+		} else {
+			log.Printf("whatsapp: connected as %s (LID: %s)", own.User, ownLID.User)
+		}
 	}
 
+	// whatsmeow reconnects on its own, but not always successfully: let the
+	// watchdog force a fresh connection when the socket stays down. A client
+	// waiting to be paired is left alone.
+	watchdog.Default.Register("whatsapp", whatsappStallAfter, func() {
+		cli := sender.client()
+		if cli.Store.ID == nil {
+			return
+		}
+		cli.Disconnect()
+		if err := cli.Connect(); err != nil {
+			log.Printf("whatsapp: reconnect failed: %v", err)
+		}
+	})
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if cli := sender.client(); cli.IsConnected() && cli.IsLoggedIn() {
+					watchdog.Default.Beat("whatsapp")
+				}
+			}
+		}
+	}()
+
 	go waClient.runOutbound()
 	go func() {
 		<-ctx.Done()
 		log.Println("whatsapp: shutting down")
 		waClient.stopAllTyping()
-		rawClient.Disconnect()
+		sender.client().Disconnect()
 	}()
 
 	return nil
@@ -223,32 +341,69 @@ type whatsappClient struct {
 	sender     whatsappSender
 	hub        *chat.Hub
 	outCh      <-chan chat.Outbound
-	allowed    map[string]struct{}
-	own        types.JID // phone JID  (e.g. 85298765432@s.whatsapp.net)
-	ownLID     types.JID // LID JID    (e.g. 169032883908635@lid) — may be empty
+	allowed    *access.Policy // nil = everyone
+	own        types.JID      // phone JID  (e.g. 85298765432@s.whatsapp.net)
+	ownLID     types.JID      // LID JID    (e.g. 169032883908635@lid) — may be empty
+	ownMu      sync.RWMutex   // guards own and ownLID, replaced on relinking
 	ctx        context.Context
 	typingMu   sync.Mutex
 	typingStop map[string]chan struct{}
+	// inbox is the workspace images and voice notes are saved in (see
+	// receiveMedia), "" to not save them; transcriber, if set, turns the
+	// saved voice notes into text.
+	inbox       string
+	transcriber stt.Transcriber
+	// allowGroups are the groups the bot takes part in, answering messages
+	// that mention it, reply to it or start with groupTrigger.
+	allowGroups   map[string]struct{}
+	groupTrigger  string
+	ignoredGroups sync.Map // groups already logged as ignored
+	// typing shows "typing…" while a reply is generated; readReceipts is
+	// when messages are marked read (see markRead).
+	typing       bool
+	readReceipts string
+	readMu       sync.Mutex
+	unread       map[string][]whatsappUnread
+	// Recent received messages, for replies to quote (see quoteFor).
+	quoteMu       sync.Mutex
+	received      map[types.MessageID]whatsappReceived
+	receivedOrder []types.MessageID
+	latest        map[string]uint64 // seq of each chat's latest message
+	seq           uint64
+	// Replies read aloud (see sendVoice); voiceChats holds, per chat,
+	// whether its latest message was a voice note.
+	voiceReplies string
+	synthesizer  tts.Synthesizer
+	voiceChats   sync.Map
+	// How buttons are sent (see sendButtons); offered holds, per chat, the
+	// options last sent as text, answerable by number.
+	buttons string
+	offerMu sync.Mutex
+	offered map[string][]chat.Button
 }
 
 // newWhatsAppClient constructs a whatsappClient and registers it as the hub's
 // "whatsapp" outbound subscriber. Inject a mock whatsappSender for tests.
 // ownJID  = rawClient.Store.ID   (phone JID)  — pass types.JID{} in tests.
 // ownLID  = rawClient.Store.GetLID() (LID JID) — pass types.JID{} in tests.
-func newWhatsAppClient(ctx context.Context, sender whatsappSender, hub *chat.Hub, allowFrom []string, ownJID, ownLID types.JID) *whatsappClient {
-	allowed := make(map[string]struct{}, len(allowFrom))
-	for _, num := range allowFrom {
-		allowed[num] = struct{}{}
-	}
+func newWhatsAppClient(ctx context.Context, sender whatsappSender, hub *chat.Hub, allowed *access.Policy, ownJID, ownLID types.JID) *whatsappClient {
 	return &whatsappClient{
-		sender:     sender,
-		hub:        hub,
-		outCh:      hub.Subscribe("whatsapp"),
-		allowed:    allowed,
-		own:        ownJID,
-		ownLID:     ownLID,
-		ctx:        ctx,
-		typingStop: make(map[string]chan struct{}),
+		sender:       sender,
+		hub:          hub,
+		outCh:        hub.Subscribe("whatsapp"),
+		allowed:      allowed,
+		own:          ownJID,
+		ownLID:       ownLID,
+		ctx:          ctx,
+		typingStop:   make(map[string]chan struct{}),
+		allowGroups:  make(map[string]struct{}),
+		typing:       true,
+		readReceipts: whatsappReadOnReceipt,
+		buttons:      whatsappButtonsText,
+		offered:      make(map[string][]chat.Button),
+		unread:       make(map[string][]whatsappUnread),
+		received:     make(map[types.MessageID]whatsappReceived),
+		latest:       make(map[string]uint64),
 	}
 }
 
@@ -278,11 +433,27 @@ func (c *whatsappClient) isSelfChat(msg *events.Message) bool {
 		return false
 	}
 	// Match phone JID (s.whatsapp.net) or LID JID (@lid).
-	return (c.own.User != "" && chatUser == c.own.User) ||
-		(c.ownLID.User != "" && chatUser == c.ownLID.User)
+	own, ownLID := c.ownIDs()
+	return (own.User != "" && chatUser == own.User) ||
+		(ownLID.User != "" && chatUser == ownLID.User)
+}
+
+// ownIDs returns the bot account's phone and LID JIDs.
+func (c *whatsappClient) ownIDs() (own, ownLID types.JID) {
+	c.ownMu.RLock()
+	defer c.ownMu.RUnlock()
+	return c.own, c.ownLID
+}
+
+// setOwn records the bot account's JIDs after it was linked again.
+func (c *whatsappClient) setOwn(own, ownLID types.JID) {
+	c.ownMu.Lock()
+	c.own, c.ownLID = own, ownLID
+	c.ownMu.Unlock()
 }
 
-// handleMessage processes an incoming WhatsApp direct message.
+// handleMessage processes an incoming WhatsApp direct message, or a group
+// message addressed to the bot in an allowed group.
 func (c *whatsappClient) handleMessage(msg *events.Message) {
 	if msg.Info.IsFromMe {
 		// Only allow self-chat (Notes to Self); drop echoes of messages sent elsewhere.
@@ -290,18 +461,20 @@ func (c *whatsappClient) handleMessage(msg *events.Message) {
 			return
 		}
 		// Self-chat: it is always the owner. Skip allowlist and fall through.
-	} else {
-		// Regular inbound message — enforce allowlist.
-		if msg.Info.IsGroup {
+	} else if msg.Info.IsGroup {
+		// Group message — the group allowlist applies instead of allowFrom.
+		if !c.groupAllowed(msg.Info.Chat) {
+			c.logIgnoredGroup(msg.Info.Chat)
 			return
 		}
+	} else {
+		// Regular inbound message — enforce allowlist.
 		senderID := msg.Info.Sender.User
-		if len(c.allowed) > 0 {
-			if _, ok := c.allowed[senderID]; !ok {
-				log.Printf("whatsapp: dropped message from unauthorized sender %s (add '%s' to allowFrom to permit)",
-					msg.Info.Sender.String(), senderID)
-				return
-			}
+		// A sender known by its LID is also matched by its phone number.
+		if c.allowed != nil && !c.allowed.Allowed(senderID, msg.Info.SenderAlt.User) {
+			log.Printf("whatsapp: dropped message from unauthorized sender %s (add '%s' to allowFrom to permit)",
+				msg.Info.Sender.String(), senderID)
+			return
 		}
 	}
 
@@ -309,10 +482,47 @@ func (c *whatsappClient) handleMessage(msg *events.Message) {
 	senderJID := msg.Info.Sender.String()
 	senderID := msg.Info.Sender.User
 
-	// Send read receipt (blue ticks) before processing.
-	_ = c.sender.MarkRead(c.ctx, []types.MessageID{msg.Info.ID}, msg.Info.Timestamp, msg.Info.Chat, msg.Info.Sender)
-
 	content := extractMessageText(msg.Message)
+	if msg.Info.IsGroup {
+		// A tap on the bot's buttons replies to its message, so it is
+		// addressed to it; an option's number must be too.
+		text, ok := c.groupAddressed(msg.Message, content)
+		if !ok {
+			return
+		}
+		content = text
+	}
+	button, tapped := c.buttonReply(msg, content)
+	if tapped {
+		content = button.Text
+	}
+
+	c.markRead(msg)
+
+	meta := map[string]interface{}{
+		"message_id": string(msg.Info.ID),
+		"is_dm":      !msg.Info.IsGroup && msg.Info.Chat.Server != types.BroadcastServer,
+	}
+	if msg.Info.IsFromMe {
+		// Self-chat: the account owner may use the admin commands.
+		meta["admin"] = true
+	}
+	if tapped {
+		meta["button_id"] = button.ID
+	}
+	var media []string
+	if text, abs, mediaMeta, ok := c.receiveMedia(msg); ok {
+		content = text
+		if msg.Info.IsGroup {
+			content = c.groupText(content)
+		}
+		if abs != "" {
+			media = append(media, abs)
+		}
+		for k, v := range mediaMeta {
+			meta[k] = v
+		}
+	}
 	if content == "" {
 		return
 	}
@@ -321,18 +531,21 @@ func (c *whatsappClient) handleMessage(msg *events.Message) {
 
 	log.Printf("whatsapp: message from %s in chat %s: %s", senderJID, chatID, truncate(content, 50))
 
-	c.startTyping(msg.Info.Chat)
+	c.rememberMessage(msg)
+	c.noteVoice(msg)
+	if c.typing {
+		c.startTyping(msg.Info.Chat)
+	}
 
 	c.hub.In <- chat.Inbound{
-		Channel:   "whatsapp",
-		SenderID:  senderID,
-		ChatID:    chatID,
-		Content:   content,
-		Timestamp: msg.Info.Timestamp,
-		Metadata: map[string]interface{}{
-			"message_id": msg.Info.ID,
-			"is_group":   msg.Info.IsGroup,
-		},
+		Channel:    "whatsapp",
+		SenderID:   senderID,
+		SenderName: c.senderName(msg),
+		ChatID:     chatID,
+		Content:    content,
+		Timestamp:  msg.Info.Timestamp,
+		Media:      media,
+		Metadata:   meta,
 	}
 }
 
@@ -355,6 +568,12 @@ func extractMessageText(m *waProto.Message) string {
 		}
 		return caption + "\n[Image received - images not yet supported]"
 	}
+	if m.AudioMessage != nil {
+		if m.AudioMessage.GetPTT() {
+			return "[Voice note received - voice notes not yet supported]"
+		}
+		return "[Audio received - audio not yet supported]"
+	}
 	if m.DocumentMessage != nil {
 		caption := ""
 		if m.DocumentMessage.Caption != nil {
@@ -368,7 +587,8 @@ func extractMessageText(m *waProto.Message) string {
 	return ""
 }
 
-// runOutbound reads replies from the hub's whatsapp subscription and sends them.
+// runOutbound reads replies from the hub's whatsapp subscription and sends
+// them: the text first, then each attachment.
 func (c *whatsappClient) runOutbound() {
 	for {
 		select {
@@ -376,6 +596,10 @@ func (c *whatsappClient) runOutbound() {
 			log.Println("whatsapp: stopping outbound sender")
 			return
 		case out := <-c.outCh:
+			if isStatusPost(out) {
+				c.postStatus(out)
+				continue
+			}
 			recipient, err := types.ParseJID(out.ChatID)
 			if err != nil {
 				log.Printf("whatsapp: invalid chat ID %s: %v", out.ChatID, err)
@@ -383,11 +607,24 @@ func (c *whatsappClient) runOutbound() {
 			}
 			c.stopTyping(out.ChatID)
 			// WhatsApp has a ~65 KB hard limit; use 4096 runes as a safe chunk size.
-			for i, chunk := range splitMessage(out.Content, 4096) {
-				if err := c.sender.SendText(c.ctx, recipient, chunk); err != nil {
-					log.Printf("whatsapp: send error (chunk %d): %v", i+1, err)
+			// The first chunk quotes the message answered, if need be.
+			sent := c.sendButtons(recipient, out) || c.sendVoice(recipient, out)
+			if !sent && (out.Content != "" || (len(out.Media) == 0 && !hasChatActions(out))) {
+				quote := c.quoteFor(out.ChatID, out.ReplyTo)
+				sendChunks(c.ctx, c.hub, out, splitMessage(stripHidingMarkers(out.Content, false), 4096), func(i int, chunk string) error {
+					if i > 0 {
+						return c.sender.SendText(c.ctx, recipient, chunk, nil)
+					}
+					return c.sender.SendText(c.ctx, recipient, chunk, quote)
+				})
+			}
+			for _, path := range out.Media {
+				if err := c.sendFile(recipient, path); err != nil {
+					log.Printf("whatsapp: sending %s: %v", path, err)
 				}
 			}
+			c.chatActions(recipient, out)
+			c.markReplied(out.ChatID)
 		}
 	}
 }
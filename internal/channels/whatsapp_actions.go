@@ -0,0 +1,72 @@
+//go:build !lite
+
+package channels
+
+import (
+	"context"
+	"log"
+
+	"go.mau.fi/whatsmeow/appstate"
+	"go.mau.fi/whatsmeow/types"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+func (r *realWhatsAppSender) SetGroupName(ctx context.Context, group types.JID, name string) error {
+	return r.client().SetGroupName(ctx, group, name)
+}
+
+func (r *realWhatsAppSender) SetGroupDescription(ctx context.Context, group types.JID, description string) error {
+	return r.client().SetGroupDescription(ctx, group, description)
+}
+
+func (r *realWhatsAppSender) Star(ctx context.Context, chat, sender types.JID, id types.MessageID, fromMe bool) error {
+	return r.client().SendAppState(ctx, appstate.BuildStar(chat, sender, id, fromMe, true))
+}
+
+// hasChatActions reports whether out carries chat-ops directives.
+func hasChatActions(out chat.Outbound) bool {
+	for _, key := range []string{"chat_title", "chat_description", "star"} {
+		if _, ok := out.Metadata[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// chatActions performs the chat-ops directives of out: renaming a group,
+// changing its description, and starring a message. Failures (e.g. the
+// account may not edit the group info) are only logged.
+func (c *whatsappClient) chatActions(recipient types.JID, out chat.Outbound) {
+	if title, ok := out.Metadata["chat_title"].(string); ok {
+		if recipient.Server != types.GroupServer {
+			log.Printf("whatsapp: only groups can be renamed, not %s", out.ChatID)
+		} else if err := c.sender.SetGroupName(c.ctx, recipient, title); err != nil {
+			log.Printf("whatsapp: renaming %s: %v", out.ChatID, err)
+		}
+	}
+	if desc, ok := out.Metadata["chat_description"].(string); ok {
+		if recipient.Server != types.GroupServer {
+			log.Printf("whatsapp: only groups have a description, not %s", out.ChatID)
+		} else if err := c.sender.SetGroupDescription(c.ctx, recipient, desc); err != nil {
+			log.Printf("whatsapp: describing %s: %v", out.ChatID, err)
+		}
+	}
+	if id, _ := out.Metadata["star"].(string); id != "" {
+		// The sender of a recent message is known; in a direct chat it can
+		// only be the other person.
+		c.quoteMu.Lock()
+		m, ok := c.received[types.MessageID(id)]
+		c.quoteMu.Unlock()
+		sender := recipient
+		if ok {
+			sender = m.sender
+		} else if recipient.Server == types.GroupServer {
+			log.Printf("whatsapp: cannot star %s: sender unknown", id)
+			return
+		}
+		if err := c.sender.Star(c.ctx, recipient, sender, types.MessageID(id), false); err != nil {
+			log.Printf("whatsapp: starring %s: %v", id, err)
+		}
+	}
+}
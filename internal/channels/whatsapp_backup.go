@@ -0,0 +1,176 @@
+//go:build !lite
+
+package channels
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// whatsappBackupMagic starts every WhatsApp session backup, followed by the
+// scrypt salt, the AES-GCM nonce and the encrypted database.
+const whatsappBackupMagic = "PICOBOT-WA-BACKUP-1\n"
+
+// sqliteHeader starts every SQLite database file.
+const sqliteHeader = "SQLite format 3\x00"
+
+// BackupWhatsApp writes the WhatsApp session database at dbPath to dest,
+// encrypted with passphrase, so that picobot can move to another machine
+// without pairing again. The snapshot is consistent even while the gateway
+// is running.
+func BackupWhatsApp(ctx context.Context, dbPath, dest string, passphrase []byte) error {
+	if _, err := os.Stat(dbPath); err != nil {
+		return fmt.Errorf("whatsapp session: %w", err)
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(dest), ".picobot-backup-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	snapshot := filepath.Join(tmp, "whatsapp.db")
+
+	db, err := sql.Open("sqlite", "file:"+dbPath+"?mode=ro&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, "VACUUM INTO ?", snapshot)
+	db.Close()
+	if err != nil {
+		return fmt.Errorf("snapshot of %s: %w", dbPath, err)
+	}
+	data, err := os.ReadFile(snapshot)
+	if err != nil {
+		return err
+	}
+	sealed, err := sealWhatsAppBackup(data, passphrase)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(dest, sealed)
+}
+
+// RestoreWhatsApp decrypts the backup at src with passphrase and installs it
+// as the WhatsApp session database at dbPath. An existing database is only
+// replaced when force is set; the gateway must not be running.
+func RestoreWhatsApp(src, dbPath string, passphrase []byte, force bool) error {
+	sealed, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	data, err := openWhatsAppBackup(sealed, passphrase)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(data, []byte(sqliteHeader)) {
+		return errors.New("the backup does not hold a WhatsApp session database")
+	}
+	if _, err := os.Stat(dbPath); err == nil && !force {
+		return fmt.Errorf("%s already exists; use --force to replace it", dbPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0o700); err != nil {
+		return err
+	}
+	// The journal files of the old database would corrupt the new one.
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		if err := os.Remove(dbPath + suffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return writeFileAtomic(dbPath, data)
+}
+
+// whatsappBackupKey derives the encryption key from passphrase and salt.
+func whatsappBackupKey(passphrase, salt []byte) ([]byte, error) {
+	return scrypt.Key(passphrase, salt, 1<<15, 8, 1, 32)
+}
+
+// sealWhatsAppBackup encrypts data with a key derived from passphrase.
+func sealWhatsAppBackup(data, passphrase []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("a passphrase is required")
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	gcm, err := whatsappBackupCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append([]byte(whatsappBackupMagic), salt...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, data, []byte(whatsappBackupMagic)), nil
+}
+
+// openWhatsAppBackup decrypts a backup made by sealWhatsAppBackup.
+func openWhatsAppBackup(sealed, passphrase []byte) ([]byte, error) {
+	rest, ok := bytes.CutPrefix(sealed, []byte(whatsappBackupMagic))
+	if !ok {
+		return nil, errors.New("not a picobot WhatsApp backup")
+	}
+	if len(rest) < 16 {
+		return nil, errors.New("truncated backup")
+	}
+	salt, rest := rest[:16], rest[16:]
+	gcm, err := whatsappBackupCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < gcm.NonceSize() {
+		return nil, errors.New("truncated backup")
+	}
+	nonce, ciphertext := rest[:gcm.NonceSize()], rest[gcm.NonceSize():]
+	data, err := gcm.Open(nil, nonce, ciphertext, []byte(whatsappBackupMagic))
+	if err != nil {
+		return nil, errors.New("wrong passphrase or damaged backup")
+	}
+	return data, nil
+}
+
+func whatsappBackupCipher(passphrase, salt []byte) (cipher.AEAD, error) {
+	key, err := whatsappBackupKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// writeFileAtomic writes data to path, readable by the owner only, through
+// a temporary file so that a failure leaves no partial file behind.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0o600); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,125 @@
+//go:build !lite
+
+package channels
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+// Button modes, set by channels.whatsapp.buttons.
+const (
+	whatsappButtonsInteractive = "interactive" // reply buttons or a list
+	whatsappButtonsText        = "text"        // numbered options, answered by number (default)
+)
+
+// whatsappMaxButtons is the most reply buttons a message holds; more choices
+// are sent as a list.
+const whatsappMaxButtons = 3
+
+// SendButtons sends text with buttons as reply buttons, or as a list when
+// there are more than whatsappMaxButtons.
+func (r *realWhatsAppSender) SendButtons(ctx context.Context, to types.JID, text string, buttons []chat.Button) error {
+	var msg *waProto.Message
+	if len(buttons) <= whatsappMaxButtons {
+		bm := &waProto.ButtonsMessage{ContentText: proto.String(text), HeaderType: waProto.ButtonsMessage_EMPTY.Enum()}
+		for _, b := range buttons {
+			bm.Buttons = append(bm.Buttons, &waProto.ButtonsMessage_Button{
+				ButtonID:   proto.String(b.ID),
+				ButtonText: &waProto.ButtonsMessage_Button_ButtonText{DisplayText: proto.String(b.Text)},
+				Type:       waProto.ButtonsMessage_Button_RESPONSE.Enum(),
+			})
+		}
+		msg = &waProto.Message{ButtonsMessage: bm}
+	} else {
+		section := &waProto.ListMessage_Section{}
+		for _, b := range buttons {
+			section.Rows = append(section.Rows, &waProto.ListMessage_Row{RowID: proto.String(b.ID), Title: proto.String(b.Text)})
+		}
+		msg = &waProto.Message{ListMessage: &waProto.ListMessage{
+			Description: proto.String(text),
+			ButtonText:  proto.String("Choose"),
+			ListType:    waProto.ListMessage_SINGLE_SELECT.Enum(),
+			Sections:    []*waProto.ListMessage_Section{section},
+		}}
+	}
+	_, err := r.client().SendMessage(ctx, to, msg)
+	return err
+}
+
+// setButtons sets how buttons are sent; unknown modes keep the default.
+func (c *whatsappClient) setButtons(mode string) {
+	switch mode {
+	case "":
+	case whatsappButtonsInteractive, whatsappButtonsText:
+		c.buttons = mode
+	default:
+		log.Printf("whatsapp: unknown buttons %q (use interactive or text), using %q", mode, c.buttons)
+	}
+}
+
+// sendButtons sends out with the buttons of its "buttons" directive and
+// reports whether it did; on false out has no buttons. Interactive messages
+// that WhatsApp refuses, and the "text" mode, list the options numbered under
+// the text instead, to be answered by number.
+func (c *whatsappClient) sendButtons(recipient types.JID, out chat.Outbound) bool {
+	buttons, _ := out.Metadata["buttons"].([]chat.Button)
+	if len(buttons) == 0 {
+		return false
+	}
+	if c.buttons != whatsappButtonsText {
+		err := c.sender.SendButtons(c.ctx, recipient, out.Content, buttons)
+		if err == nil {
+			return true
+		}
+		log.Printf("whatsapp: sending buttons: %v; sending the options as text", err)
+	}
+	var b strings.Builder
+	b.WriteString(out.Content)
+	for i, button := range buttons {
+		fmt.Fprintf(&b, "\n%d. %s", i+1, button.Text)
+	}
+	c.offerMu.Lock()
+	c.offered[out.ChatID] = buttons
+	c.offerMu.Unlock()
+	if err := c.sender.SendText(c.ctx, recipient, b.String(), c.quoteFor(out.ChatID, out.ReplyTo)); err != nil {
+		log.Printf("whatsapp: send error: %v", err)
+	}
+	return true
+}
+
+// buttonReply recognizes msg as the answer to buttons: a tap on reply
+// buttons or a list, or the number of an option sent as text. Options sent as
+// text are only answerable by the next message of the chat handed to the
+// agent: in groups, the next one addressed to the bot.
+func (c *whatsappClient) buttonReply(msg *events.Message, content string) (chat.Button, bool) {
+	if r := msg.Message.GetButtonsResponseMessage(); r != nil {
+		return chat.Button{ID: r.GetSelectedButtonID(), Text: r.GetSelectedDisplayText()}, true
+	}
+	if r := msg.Message.GetListResponseMessage(); r != nil {
+		return chat.Button{ID: r.GetSingleSelectReply().GetSelectedRowID(), Text: r.GetTitle()}, true
+	}
+	chatID := msg.Info.Chat.String()
+	c.offerMu.Lock()
+	offered, ok := c.offered[chatID]
+	delete(c.offered, chatID)
+	c.offerMu.Unlock()
+	if !ok {
+		return chat.Button{}, false
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(content))
+	if err != nil || n < 1 || n > len(offered) {
+		return chat.Button{}, false
+	}
+	return offered[n-1], true
+}
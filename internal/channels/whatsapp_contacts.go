@@ -0,0 +1,42 @@
+//go:build !lite
+
+package channels
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// senderName returns the sender of msg as the account owner knows them: the
+// name saved in the address book, else the name they chose for themselves
+// (their push name), else their business name. It returns "" when none is
+// known, e.g. for a first message from an unsaved number without a push
+// name.
+func (c *whatsappClient) senderName(msg *events.Message) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, jid := range []types.JID{msg.Info.Sender, msg.Info.SenderAlt} {
+		if jid.IsEmpty() {
+			continue
+		}
+		info, err := c.sender.GetContact(ctx, jid.ToNonAD())
+		if err != nil {
+			log.Printf("whatsapp: looking up contact %s: %v", jid, err)
+			continue
+		}
+		if !info.Found {
+			continue
+		}
+		for _, name := range []string{info.FullName, info.FirstName, info.PushName, info.BusinessName} {
+			if name = strings.TrimSpace(name); name != "" {
+				return name
+			}
+		}
+	}
+	return strings.TrimSpace(msg.Info.PushName)
+}
@@ -0,0 +1,103 @@
+//go:build !lite
+
+package channels
+
+import (
+	"log"
+	"strings"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// groupAllowed reports whether the bot takes part in the group chat. Groups
+// are listed in allowGroups by JID ("120363012345678901@g.us") or by its
+// number alone.
+func (c *whatsappClient) groupAllowed(group types.JID) bool {
+	if _, ok := c.allowGroups[group.User]; ok {
+		return true
+	}
+	_, ok := c.allowGroups[group.String()]
+	return ok
+}
+
+// logIgnoredGroup logs, once per group, that messages of a group not in
+// allowGroups are dropped, so its JID can be found.
+func (c *whatsappClient) logIgnoredGroup(group types.JID) {
+	if _, seen := c.ignoredGroups.LoadOrStore(group.User, true); !seen {
+		log.Printf("whatsapp: ignoring group %s (add '%s' to allowGroups to take part)", group.String(), group.User)
+	}
+}
+
+// contextInfo returns the context (mentions, quoted message) of the text or
+// media message m, or nil.
+func contextInfo(m *waProto.Message) *waProto.ContextInfo {
+	switch {
+	case m.GetExtendedTextMessage() != nil:
+		return m.GetExtendedTextMessage().GetContextInfo()
+	case m.GetImageMessage() != nil:
+		return m.GetImageMessage().GetContextInfo()
+	case m.GetAudioMessage() != nil:
+		return m.GetAudioMessage().GetContextInfo()
+	case m.GetDocumentMessage() != nil:
+		return m.GetDocumentMessage().GetContextInfo()
+	case m.GetButtonsResponseMessage() != nil:
+		return m.GetButtonsResponseMessage().GetContextInfo()
+	case m.GetListResponseMessage() != nil:
+		return m.GetListResponseMessage().GetContextInfo()
+	}
+	return nil
+}
+
+// isOwn reports whether jid, as found in a mention or quote, is the bot's
+// account.
+func (c *whatsappClient) isOwn(jid string) bool {
+	j, err := types.ParseJID(jid)
+	if err != nil || j.User == "" {
+		return false
+	}
+	own, ownLID := c.ownIDs()
+	return j.User == own.User || (ownLID.User != "" && j.User == ownLID.User)
+}
+
+// groupAddressed decides whether a group message with the given text is
+// addressed to the bot: it mentions the bot, replies to one of its messages,
+// or starts with the trigger prefix. It returns the text to hand to the agent
+// (see groupText).
+func (c *whatsappClient) groupAddressed(m *waProto.Message, text string) (string, bool) {
+	text = strings.TrimSpace(text)
+	if c.hasTrigger(text) {
+		return c.groupText(text), true
+	}
+	ci := contextInfo(m)
+	addressed := ci != nil && ci.GetStanzaID() != "" && c.isOwn(ci.GetParticipant())
+	for _, jid := range ci.GetMentionedJID() {
+		if c.isOwn(jid) {
+			addressed = true
+		}
+	}
+	if !addressed {
+		return "", false
+	}
+	return c.groupText(text), true
+}
+
+// hasTrigger reports whether text starts with the trigger prefix, in any case.
+func (c *whatsappClient) hasTrigger(text string) bool {
+	return c.groupTrigger != "" && len(text) >= len(c.groupTrigger) && strings.EqualFold(text[:len(c.groupTrigger)], c.groupTrigger)
+}
+
+// groupText removes the trigger prefix and @-mentions of the bot from text.
+func (c *whatsappClient) groupText(text string) string {
+	text = strings.TrimSpace(text)
+	if c.hasTrigger(text) {
+		text = text[len(c.groupTrigger):]
+	}
+	own, ownLID := c.ownIDs()
+	for _, user := range []string{own.User, ownLID.User} {
+		if user != "" {
+			text = strings.ReplaceAll(text, "@"+user, "")
+		}
+	}
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -0,0 +1,224 @@
+//go:build !lite
+
+package channels
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// whatsappMaxDownload caps the media saved in the inbox; larger files are
+// described but not downloaded.
+const whatsappMaxDownload = 32 << 20
+
+// whatsappTranscribeTimeout bounds the transcription of one voice note.
+const whatsappTranscribeTimeout = 2 * time.Minute
+
+// whatsappMediaExts maps the MIME types WhatsApp sends images and audio with
+// to file extensions. Others are saved with .bin.
+var whatsappMediaExts = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+	"audio/ogg":  ".ogg",
+	"audio/mpeg": ".mp3",
+	"audio/mp4":  ".m4a",
+	"audio/aac":  ".aac",
+	"audio/amr":  ".amr",
+}
+
+// whatsappMedia is an image or audio message of msg: what it is, the caption
+// to keep, and how to download it.
+type whatsappMedia struct {
+	kind     string // "image", "voice" or "audio"
+	caption  string
+	mimeType string
+	size     uint64
+	file     whatsmeow.DownloadableMessage
+}
+
+// mediaOf returns the image or audio attached to msg, or nil.
+func mediaOf(msg *events.Message) *whatsappMedia {
+	m := msg.Message
+	switch {
+	case m.GetImageMessage() != nil:
+		im := m.GetImageMessage()
+		return &whatsappMedia{kind: "image", caption: im.GetCaption(), mimeType: im.GetMimetype(), size: im.GetFileLength(), file: im}
+	case m.GetAudioMessage() != nil:
+		am := m.GetAudioMessage()
+		kind := "audio"
+		if am.GetPTT() {
+			kind = "voice"
+		}
+		return &whatsappMedia{kind: kind, mimeType: am.GetMimetype(), size: am.GetFileLength(), file: am}
+	}
+	return nil
+}
+
+// receiveMedia saves the image or audio of msg in the chat's inbox in the
+// workspace and transcribes audio when a transcriber is set. It returns the
+// content to deliver for the message, the absolute path of the saved file
+// ("" when saving failed) and metadata describing it. ok is false when msg
+// carries no such media or the inbox is off.
+func (c *whatsappClient) receiveMedia(msg *events.Message) (content, abs string, meta map[string]interface{}, ok bool) {
+	md := mediaOf(msg)
+	if md == nil || c.inbox == "" {
+		return "", "", nil, false
+	}
+	meta = map[string]interface{}{"attachment_type": md.kind, "mime_type": md.mimeType}
+	content = md.caption
+	rel, abs, err := c.saveMedia(msg, md)
+	if err != nil {
+		log.Printf("whatsapp: saving %s: %v", md.kind, err)
+		return strings.TrimSpace(content + "\n[" + md.kind + " received, not saved: " + err.Error() + "]"), "", meta, true
+	}
+	meta["file_path"] = rel
+	if md.kind == "image" {
+		return strings.TrimSpace(content + "\n[image saved as " + rel + " in the workspace]"), abs, meta, true
+	}
+
+	saved := "[" + md.kind + " saved as " + rel + " in the workspace]"
+	if c.transcriber == nil {
+		return saved, abs, meta, true
+	}
+	ctx, cancel := context.WithTimeout(c.ctx, whatsappTranscribeTimeout)
+	defer cancel()
+	text, err := c.transcriber.Transcribe(ctx, abs)
+	if err != nil {
+		log.Printf("whatsapp: transcribing %s: %v", rel, err)
+		return saved + "\n[transcription failed: " + err.Error() + "]", abs, meta, true
+	}
+	meta["transcribed"] = true
+	return "[" + md.kind + " transcript]: " + text + "\n" + saved, abs, meta, true
+}
+
+// saveMedia downloads md into inbox/whatsapp/<chat>/<message id><ext> and
+// returns its path relative to the workspace and its absolute path.
+func (c *whatsappClient) saveMedia(msg *events.Message, md *whatsappMedia) (rel, abs string, err error) {
+	if md.size > whatsappMaxDownload {
+		return "", "", fmt.Errorf("larger than %s", formatFileSize(whatsappMaxDownload))
+	}
+	data, err := c.sender.Download(c.ctx, md.file)
+	if err != nil {
+		return "", "", fmt.Errorf("download: %w", err)
+	}
+	ext, ok := whatsappMediaExts[strings.TrimSpace(strings.SplitN(md.mimeType, ";", 2)[0])]
+	if !ok {
+		ext = ".bin"
+	}
+	dir := filepath.Join(inboxDir, "whatsapp", msg.Info.Chat.User)
+	if err := os.MkdirAll(filepath.Join(c.inbox, dir), 0o755); err != nil {
+		return "", "", err
+	}
+	// Message IDs are unique, and safe as file names.
+	rel = filepath.Join(dir, filepath.Base(filepath.Clean("/"+string(msg.Info.ID)))+ext)
+	abs = filepath.Join(c.inbox, rel)
+	if err := os.WriteFile(abs, data, 0o644); err != nil {
+		return "", "", err
+	}
+	if a, err := filepath.Abs(abs); err == nil {
+		abs = a
+	}
+	return rel, abs, nil
+}
+
+// whatsappMaxUpload is the largest file sent; WhatsApp refuses bigger
+// documents.
+const whatsappMaxUpload = 100 << 20
+
+// whatsappMediaKind returns how a file of mimeType is sent: "image", "video",
+// "audio" or "document". Only the image and video formats WhatsApp displays
+// inline are sent as such; anything else goes as a document.
+func whatsappMediaKind(mimeType string) string {
+	switch mimeType {
+	case "image/jpeg", "image/png":
+		return "image"
+	case "video/mp4", "video/3gpp":
+		return "video"
+	case "audio/ogg", "audio/mpeg", "audio/mp4", "audio/aac", "audio/amr":
+		return "audio"
+	}
+	return "document"
+}
+
+// detectMimeType guesses the MIME type of a file from its extension, then
+// from its content.
+func detectMimeType(path string, data []byte) string {
+	if t := mime.TypeByExtension(strings.ToLower(filepath.Ext(path))); t != "" {
+		return strings.TrimSpace(strings.SplitN(t, ";", 2)[0])
+	}
+	return strings.TrimSpace(strings.SplitN(http.DetectContentType(data), ";", 2)[0])
+}
+
+// sendFile sends the file at path to recipient as an image, video, audio or
+// document, depending on its MIME type.
+func (c *whatsappClient) sendFile(recipient types.JID, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Size() > whatsappMaxUpload {
+		return fmt.Errorf("larger than %s", formatFileSize(whatsappMaxUpload))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return c.sender.SendFile(c.ctx, recipient, data, filepath.Base(path), detectMimeType(path, data))
+}
+
+// SendFile uploads data and sends it as the message kind its MIME type calls
+// for (see whatsappMediaKind).
+func (r *realWhatsAppSender) SendFile(ctx context.Context, to types.JID, data []byte, name, mimeType string) error {
+	kind := whatsappMediaKind(mimeType)
+	mediaType := map[string]whatsmeow.MediaType{
+		"image": whatsmeow.MediaImage, "video": whatsmeow.MediaVideo,
+		"audio": whatsmeow.MediaAudio, "document": whatsmeow.MediaDocument,
+	}[kind]
+	up, err := r.client().Upload(ctx, data, mediaType)
+	if err != nil {
+		return fmt.Errorf("upload: %w", err)
+	}
+	msg := &waProto.Message{}
+	switch kind {
+	case "image":
+		msg.ImageMessage = &waProto.ImageMessage{
+			URL: proto.String(up.URL), DirectPath: proto.String(up.DirectPath), MediaKey: up.MediaKey,
+			FileEncSHA256: up.FileEncSHA256, FileSHA256: up.FileSHA256, FileLength: proto.Uint64(up.FileLength),
+			Mimetype: proto.String(mimeType),
+		}
+	case "video":
+		msg.VideoMessage = &waProto.VideoMessage{
+			URL: proto.String(up.URL), DirectPath: proto.String(up.DirectPath), MediaKey: up.MediaKey,
+			FileEncSHA256: up.FileEncSHA256, FileSHA256: up.FileSHA256, FileLength: proto.Uint64(up.FileLength),
+			Mimetype: proto.String(mimeType),
+		}
+	case "audio":
+		msg.AudioMessage = &waProto.AudioMessage{
+			URL: proto.String(up.URL), DirectPath: proto.String(up.DirectPath), MediaKey: up.MediaKey,
+			FileEncSHA256: up.FileEncSHA256, FileSHA256: up.FileSHA256, FileLength: proto.Uint64(up.FileLength),
+			Mimetype: proto.String(mimeType),
+		}
+	default:
+		msg.DocumentMessage = &waProto.DocumentMessage{
+			URL: proto.String(up.URL), DirectPath: proto.String(up.DirectPath), MediaKey: up.MediaKey,
+			FileEncSHA256: up.FileEncSHA256, FileSHA256: up.FileSHA256, FileLength: proto.Uint64(up.FileLength),
+			Mimetype: proto.String(mimeType), FileName: proto.String(name), Title: proto.String(name),
+		}
+	}
+	_, err = r.client().SendMessage(ctx, to, msg)
+	return err
+}
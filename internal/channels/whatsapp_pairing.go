@@ -0,0 +1,144 @@
+//go:build !lite
+
+package channels
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/store/sqlstore"
+	"rsc.io/qr"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+)
+
+// whatsappPairRetry is how long to wait before offering new QR codes once
+// all of a pairing attempt's codes have expired unscanned.
+const whatsappPairRetry = 15 * time.Minute
+
+// whatsappPairer links the account again when the session is missing or
+// expires, by sending the pairing QR codes as images to a chat on another
+// channel, so no terminal access is needed.
+type whatsappPairer struct {
+	ctx       context.Context
+	hub       *chat.Hub
+	container *sqlstore.Container
+	cfg       config.WhatsAppPairing
+	dir       string // where QR code images are written
+	sender    *realWhatsAppSender
+	client    *whatsappClient
+	mu        sync.Mutex // one pairing at a time
+}
+
+// relink replaces the logged out client with one on a new device, with
+// handler for its events, and pairs it.
+func (p *whatsappPairer) relink(handler func(interface{})) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	old := p.sender.client()
+	if old.IsLoggedIn() {
+		return // linked again since the logout was reported
+	}
+	old.Disconnect()
+	cli := whatsmeow.NewClient(p.container.NewDevice(), whatsappLogger{})
+	cli.AddEventHandler(handler)
+	p.sender.set(cli)
+	p.pair(cli)
+}
+
+// pair connects cli, not yet linked to an account, and sends its QR codes
+// until one is scanned, offering new ones every whatsappPairRetry.
+func (p *whatsappPairer) pair(cli *whatsmeow.Client) {
+	for attempt := 1; p.ctx.Err() == nil; attempt++ {
+		qrChan, err := cli.GetQRChannel(p.ctx)
+		if err != nil {
+			log.Printf("whatsapp: pairing: %v", err)
+			return
+		}
+		if err := cli.Connect(); err != nil {
+			log.Printf("whatsapp: pairing: connect: %v", err)
+		}
+		var images []string
+		paired := false
+		for evt := range qrChan {
+			switch evt.Event {
+			case whatsmeow.QRChannelEventCode:
+				path, err := p.sendCode(evt.Code, len(images)+1, evt.Timeout)
+				if err != nil {
+					log.Printf("whatsapp: pairing: %v", err)
+					continue
+				}
+				images = append(images, path)
+			case whatsmeow.QRChannelSuccess.Event:
+				paired = true
+			case whatsmeow.QRChannelEventError:
+				log.Printf("whatsapp: pairing: %v", evt.Error)
+			case whatsmeow.QRChannelTimeout.Event:
+			default:
+				log.Printf("whatsapp: pairing: %s", evt.Event)
+			}
+		}
+		if paired {
+			// Let Telegram finish uploading the last code before removing it.
+			time.AfterFunc(time.Minute, func() { removeAll(images) })
+			p.client.setOwn(*cli.Store.ID, cli.Store.GetLID())
+			log.Printf("whatsapp: linked again as %s", cli.Store.ID.User)
+			p.notify("✅ WhatsApp is linked again.")
+			return
+		}
+		removeAll(images)
+		cli.Disconnect()
+		log.Printf("whatsapp: pairing attempt %d expired", attempt)
+		p.notify(fmt.Sprintf("The WhatsApp codes expired unscanned. New ones in %v.", whatsappPairRetry))
+		select {
+		case <-p.ctx.Done():
+		case <-time.After(whatsappPairRetry):
+		}
+	}
+}
+
+// sendCode writes QR code n of a pairing attempt as an image and sends it,
+// to be deleted from the chat once it expires. It returns the image's path.
+func (p *whatsappPairer) sendCode(code string, n int, expires time.Duration) (string, error) {
+	c, err := qr.Encode(code, qr.M)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(p.dir, fmt.Sprintf("whatsapp-qr-%d.png", n))
+	if err := os.WriteFile(path, c.PNG(), 0o600); err != nil {
+		return "", err
+	}
+	text := "📱 WhatsApp needs to be linked again. On the phone, open WhatsApp → Settings → Linked Devices → Link a Device and scan this code."
+	if n > 1 {
+		text = "📱 New WhatsApp pairing code; the previous one expired."
+	}
+	log.Printf("whatsapp: pairing code %d sent to %s:%s (also saved as %s)", n, p.cfg.Channel, p.cfg.ChatID, path)
+	p.send(chat.Outbound{Channel: p.cfg.Channel, ChatID: p.cfg.ChatID, Content: text, Media: []string{path},
+		Metadata: map[string]interface{}{"delete_after": int(expires.Seconds())}})
+	return path, nil
+}
+
+// notify sends text to the pairing chat.
+func (p *whatsappPairer) notify(text string) {
+	p.send(chat.Outbound{Channel: p.cfg.Channel, ChatID: p.cfg.ChatID, Content: text})
+}
+
+func (p *whatsappPairer) send(out chat.Outbound) {
+	select {
+	case p.hub.Out <- out:
+	case <-p.ctx.Done():
+	}
+}
+
+func removeAll(paths []string) {
+	for _, path := range paths {
+		os.Remove(path)
+	}
+}
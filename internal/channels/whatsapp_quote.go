@@ -0,0 +1,63 @@
+//go:build !lite
+
+package channels
+
+import (
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// whatsappQuoteCache is how many received messages are kept for quoting.
+const whatsappQuoteCache = 256
+
+// whatsappReceived is a received message a reply may quote. seq orders the
+// messages of a chat.
+type whatsappReceived struct {
+	chat    string
+	sender  types.JID
+	message *waProto.Message
+	seq     uint64
+}
+
+// rememberMessage keeps msg so that the reply to it can quote it.
+func (c *whatsappClient) rememberMessage(msg *events.Message) {
+	c.quoteMu.Lock()
+	defer c.quoteMu.Unlock()
+	c.seq++
+	chatID := msg.Info.Chat.String()
+	c.latest[chatID] = c.seq
+	if _, ok := c.received[msg.Info.ID]; !ok {
+		c.receivedOrder = append(c.receivedOrder, msg.Info.ID)
+	}
+	c.received[msg.Info.ID] = whatsappReceived{chatID, msg.Info.Sender, msg.Message, c.seq}
+	for len(c.receivedOrder) > whatsappQuoteCache {
+		delete(c.received, c.receivedOrder[0])
+		c.receivedOrder = c.receivedOrder[1:]
+	}
+}
+
+// quoteFor returns the context that makes a reply quote the message it
+// answers (replyTo), or nil when quoting would only add noise: in a direct
+// chat where nothing was said since that message. Groups always get quotes.
+func (c *whatsappClient) quoteFor(chatID, replyTo string) *waProto.ContextInfo {
+	if replyTo == "" {
+		return nil
+	}
+	c.quoteMu.Lock()
+	m, ok := c.received[types.MessageID(replyTo)]
+	busy := c.latest[chatID] > m.seq
+	c.quoteMu.Unlock()
+	if !ok || m.chat != chatID {
+		return nil
+	}
+	if jid, err := types.ParseJID(chatID); err != nil || (jid.Server != types.GroupServer && !busy) {
+		return nil
+	}
+	return &waProto.ContextInfo{
+		StanzaID:      proto.String(replyTo),
+		Participant:   proto.String(m.sender.ToNonAD().String()),
+		QuotedMessage: m.message,
+	}
+}
@@ -0,0 +1,66 @@
+//go:build !lite
+
+package channels
+
+import (
+	"log"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Read receipt modes, set by channels.whatsapp.readReceipts.
+const (
+	whatsappReadOnReceipt = "received" // as soon as a message arrives (default)
+	whatsappReadOnReply   = "replied"  // once the reply has been sent
+	whatsappReadOff       = "off"      // never
+)
+
+// whatsappUnread is a message to mark read once its chat is answered.
+type whatsappUnread struct {
+	id           types.MessageID
+	timestamp    time.Time
+	chat, sender types.JID
+}
+
+// setReadReceipts sets when messages are marked read; unknown modes keep the
+// default.
+func (c *whatsappClient) setReadReceipts(mode string) {
+	switch mode {
+	case "":
+	case whatsappReadOnReceipt, whatsappReadOnReply, whatsappReadOff:
+		c.readReceipts = mode
+	default:
+		log.Printf("whatsapp: unknown readReceipts %q (use received, replied or off), using %q", mode, c.readReceipts)
+	}
+}
+
+// markRead sends the read receipt (blue ticks) for msg now, or keeps it for
+// markReplied, depending on the read receipt mode.
+func (c *whatsappClient) markRead(msg *events.Message) {
+	switch c.readReceipts {
+	case whatsappReadOff:
+	case whatsappReadOnReply:
+		c.readMu.Lock()
+		key := msg.Info.Chat.String()
+		c.unread[key] = append(c.unread[key], whatsappUnread{msg.Info.ID, msg.Info.Timestamp, msg.Info.Chat, msg.Info.Sender})
+		c.readMu.Unlock()
+	default:
+		_ = c.sender.MarkRead(c.ctx, []types.MessageID{msg.Info.ID}, msg.Info.Timestamp, msg.Info.Chat, msg.Info.Sender)
+	}
+}
+
+// markReplied marks read the messages of chatID kept by markRead, now that a
+// reply went out.
+func (c *whatsappClient) markReplied(chatID string) {
+	c.readMu.Lock()
+	pending := c.unread[chatID]
+	delete(c.unread, chatID)
+	c.readMu.Unlock()
+	for _, u := range pending {
+		if err := c.sender.MarkRead(c.ctx, []types.MessageID{u.id}, u.timestamp, u.chat, u.sender); err != nil {
+			log.Printf("whatsapp: read receipt for %s: %v", u.id, err)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+//go:build !lite
+
+package channels
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/local/picobot/internal/chat"
+)
+
+// whatsappStatusBackground is the background of text statuses, WhatsApp's
+// default dark teal (ARGB).
+const whatsappStatusBackground = 0xFF075E54
+
+// PostStatus posts a status update seen by the account's contacts: an image
+// captioned with text when image is not nil, else a text status.
+func (r *realWhatsAppSender) PostStatus(ctx context.Context, text string, image []byte, mimeType string) error {
+	msg := &waProto.Message{ExtendedTextMessage: &waProto.ExtendedTextMessage{
+		Text:           proto.String(text),
+		BackgroundArgb: proto.Uint32(whatsappStatusBackground),
+		TextArgb:       proto.Uint32(0xFFFFFFFF),
+		Font:           waProto.ExtendedTextMessage_SYSTEM.Enum(),
+	}}
+	if image != nil {
+		up, err := r.client().Upload(ctx, image, whatsmeow.MediaImage)
+		if err != nil {
+			return fmt.Errorf("upload: %w", err)
+		}
+		img := &waProto.ImageMessage{
+			URL: proto.String(up.URL), DirectPath: proto.String(up.DirectPath), MediaKey: up.MediaKey,
+			FileEncSHA256: up.FileEncSHA256, FileSHA256: up.FileSHA256, FileLength: proto.Uint64(up.FileLength),
+			Mimetype: proto.String(mimeType),
+		}
+		if text != "" {
+			img.Caption = proto.String(text)
+		}
+		msg = &waProto.Message{ImageMessage: img}
+	}
+	_, err := r.client().SendMessage(ctx, types.StatusBroadcastJID, msg)
+	return err
+}
+
+// isStatusPost reports whether out is a status update to post (the
+// "status" directive of the post_whatsapp_status tool) rather than a
+// message for a chat.
+func isStatusPost(out chat.Outbound) bool {
+	post, _ := out.Metadata["status"].(bool)
+	return post
+}
+
+// postStatus posts out as a status update: its text, with its first image
+// attached, if any.
+func (c *whatsappClient) postStatus(out chat.Outbound) {
+	text := stripHidingMarkers(out.Content, false)
+	var image []byte
+	var mimeType string
+	if len(out.Media) > 0 {
+		path := out.Media[0]
+		data, err := os.ReadFile(path)
+		if err == nil && len(data) > whatsappMaxUpload {
+			err = fmt.Errorf("larger than %s", formatFileSize(whatsappMaxUpload))
+		}
+		if err != nil {
+			log.Printf("whatsapp: status image %s: %v", path, err)
+			c.hub.ReportUndelivered(out, err.Error())
+			return
+		}
+		image, mimeType = data, detectMimeType(path, data)
+		if whatsappMediaKind(mimeType) != "image" {
+			log.Printf("whatsapp: status image %s is %s, not an image", path, mimeType)
+			c.hub.ReportUndelivered(out, "the status attachment is not an image")
+			return
+		}
+	}
+	if text == "" && image == nil {
+		return
+	}
+	if err := retrySend(c.ctx, func() error { return c.sender.PostStatus(c.ctx, text, image, mimeType) }); err != nil {
+		log.Printf("whatsapp: posting status: %v", err)
+		c.hub.ReportUndelivered(out, err.Error())
+		return
+	}
+	log.Printf("whatsapp: posted a status update: %s", truncate(text, 50))
+}
@@ -8,12 +8,15 @@ import (
 	"log"
 
 	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/stt"
+	"github.com/local/picobot/internal/tts"
 )
 
 // StartWhatsApp is a no-op stub used when the binary is built with the
 // 'lite' build tag. If WhatsApp is enabled in the config it logs a clear
 // warning and returns nil so the gateway continues with other channels.
-func StartWhatsApp(ctx context.Context, hub *chat.Hub, dbPath string, allowFrom []string) error {
+func StartWhatsApp(ctx context.Context, hub *chat.Hub, cfg config.WhatsAppConfig, transcriber stt.Transcriber, synthesizer tts.Synthesizer) error {
 	log.Println("whatsapp: channel not available in 'lite' version.")
 	return nil
 }
@@ -23,3 +26,13 @@ func SetupWhatsApp(dbPath string) error {
 	return fmt.Errorf("WhatsApp support is not compiled into this binary\n" +
 		"Download the full version of picobot from the github releases page")
 }
+
+// BackupWhatsApp returns an error explaining how to build with WhatsApp support.
+func BackupWhatsApp(ctx context.Context, dbPath, dest string, passphrase []byte) error {
+	return SetupWhatsApp(dbPath)
+}
+
+// RestoreWhatsApp returns an error explaining how to build with WhatsApp support.
+func RestoreWhatsApp(src, dbPath string, passphrase []byte, force bool) error {
+	return SetupWhatsApp(dbPath)
+}
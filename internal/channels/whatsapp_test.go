@@ -4,16 +4,24 @@ package channels
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"go.mau.fi/whatsmeow"
 	waProto "go.mau.fi/whatsmeow/binary/proto"
 	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
 
+	"github.com/local/picobot/internal/access"
 	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
 )
 
 // mockWhatsAppSender records all outbound calls for assertions.
@@ -30,11 +38,93 @@ type mockWhatsAppSender struct {
 	markedRead []types.MessageID
 	presences  []types.Presence
 	sendErr    error
+	media      []byte   // returned by Download
+	files      []string // "name mimetype data" of each SendFile
+	quotes     []string // StanzaID quoted by each SendText, "" if none
+	actions    []string // "SetGroupName jid value", "Star chat sender id"...
+	voices     []string // data of each SendVoice
+	contacts   map[types.JID]types.ContactInfo
+	buttons    []string // "text: id id..." of each SendButtons
+	buttonsErr error    // returned by SendButtons
+	statuses   []string // "text mimetype" of each PostStatus
 }
 
-func (m *mockWhatsAppSender) SendText(_ context.Context, to types.JID, text string) error {
+func (m *mockWhatsAppSender) PostStatus(_ context.Context, text string, image []byte, mimeType string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.statuses = append(m.statuses, text+" "+mimeType)
+	return nil
+}
+
+func (m *mockWhatsAppSender) SendButtons(_ context.Context, _ types.JID, text string, buttons []chat.Button) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.buttonsErr != nil {
+		return m.buttonsErr
+	}
+	var ids []string
+	for _, b := range buttons {
+		ids = append(ids, b.ID)
+	}
+	m.buttons = append(m.buttons, text+": "+strings.Join(ids, " "))
+	return nil
+}
+
+func (m *mockWhatsAppSender) GetContact(_ context.Context, jid types.JID) (types.ContactInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.contacts[jid], nil
+}
+
+func (m *mockWhatsAppSender) SendVoice(_ context.Context, _ types.JID, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.voices = append(m.voices, string(data))
+	return nil
+}
+
+// allowOnly returns the access policy of an allowFrom of entries.
+func allowOnly(t *testing.T, entries ...string) *access.Policy {
+	t.Helper()
+	p, err := access.NewPolicy(entries, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// fakeSynthesizer "reads aloud" text as "voice:" + text.
+type fakeSynthesizer struct{}
+
+func (fakeSynthesizer) Synthesize(_ context.Context, text string) ([]byte, error) {
+	return []byte("voice:" + text), nil
+}
+
+func (m *mockWhatsAppSender) SetGroupName(_ context.Context, group types.JID, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.actions = append(m.actions, "SetGroupName "+group.String()+" "+name)
+	return nil
+}
+
+func (m *mockWhatsAppSender) SetGroupDescription(_ context.Context, group types.JID, description string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.actions = append(m.actions, "SetGroupDescription "+group.String()+" "+description)
+	return nil
+}
+
+func (m *mockWhatsAppSender) Star(_ context.Context, chat, sender types.JID, id types.MessageID, _ bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.actions = append(m.actions, "Star "+chat.String()+" "+sender.String()+" "+string(id))
+	return nil
+}
+
+func (m *mockWhatsAppSender) SendText(_ context.Context, to types.JID, text string, quote *waProto.ContextInfo) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.quotes = append(m.quotes, quote.GetStanzaID())
 	m.texts = append(m.texts, struct {
 		to   types.JID
 		text string
@@ -66,6 +156,17 @@ func (m *mockWhatsAppSender) SendPresence(_ context.Context, state types.Presenc
 	return nil
 }
 
+func (m *mockWhatsAppSender) Download(_ context.Context, _ whatsmeow.DownloadableMessage) ([]byte, error) {
+	return m.media, nil
+}
+
+func (m *mockWhatsAppSender) SendFile(_ context.Context, to types.JID, data []byte, name, mimeType string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files = append(m.files, name+" "+mimeType+" "+string(data))
+	return nil
+}
+
 func (m *mockWhatsAppSender) sentCount() int {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -93,7 +194,7 @@ func makeWhatsAppMsg(senderUser string, isFromMe, isGroup bool, text string) *ev
 // --- StartWhatsApp / SetupWhatsApp guard tests ---
 
 func TestStartWhatsApp_EmptyDBPath(t *testing.T) {
-	err := StartWhatsApp(context.Background(), chat.NewHub(10), "", nil)
+	err := StartWhatsApp(context.Background(), chat.NewHub(10), config.WhatsAppConfig{}, nil, nil)
 	if err == nil || err.Error() != "whatsapp database path not provided" {
 		t.Fatalf("expected 'whatsapp database path not provided', got %v", err)
 	}
@@ -194,6 +295,9 @@ func TestWhatsAppClient_HandleMessage_SelfChat(t *testing.T) {
 				if in.Content != "remind me later" {
 					t.Errorf("Content = %q, want %q", in.Content, "remind me later")
 				}
+				if !in.IsAdmin() || in.MessageID() != "testmsg001" {
+					t.Errorf("IsAdmin = %v, MessageID = %q; want true, testmsg001", in.IsAdmin(), in.MessageID())
+				}
 			case <-time.After(time.Second):
 				t.Fatalf("timeout: self-chat via %s should be processed", tt.server)
 			}
@@ -261,7 +365,7 @@ func TestWhatsAppClient_HandleMessage_AllowList_Blocked(t *testing.T) {
 	hub := chat.NewHub(10)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	c := newWhatsAppClient(ctx, &mockWhatsAppSender{}, hub, []string{"19999999999"}, types.JID{}, types.JID{})
+	c := newWhatsAppClient(ctx, &mockWhatsAppSender{}, hub, allowOnly(t, "19999999999"), types.JID{}, types.JID{})
 
 	c.handleMessage(makeWhatsAppMsg("15551234567", false, false, "from blocked user"))
 
@@ -277,7 +381,7 @@ func TestWhatsAppClient_HandleMessage_AllowList_Permitted(t *testing.T) {
 	hub := chat.NewHub(10)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	c := newWhatsAppClient(ctx, &mockWhatsAppSender{}, hub, []string{"15551234567"}, types.JID{}, types.JID{})
+	c := newWhatsAppClient(ctx, &mockWhatsAppSender{}, hub, allowOnly(t, "15551234567"), types.JID{}, types.JID{})
 
 	text := "permitted message"
 	c.handleMessage(makeWhatsAppMsg("15551234567", false, false, text))
@@ -394,6 +498,334 @@ func TestWhatsAppClient_Outbound_LongMessageSplit(t *testing.T) {
 	}
 }
 
+func TestWhatsAppClient_Outbound_Media(t *testing.T) {
+	hub := chat.NewHub(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mock := &mockWhatsAppSender{}
+	c := newWhatsAppClient(ctx, mock, hub, nil, types.JID{}, types.JID{})
+	hub.StartRouter(ctx)
+	go c.runOutbound()
+
+	dir := t.TempDir()
+	chart := filepath.Join(dir, "chart.png")
+	report := filepath.Join(dir, "report")
+	os.WriteFile(chart, []byte("PNG"), 0o644)
+	os.WriteFile(report, []byte("%PDF-1.4"), 0o644)
+	hub.Out <- chat.Outbound{Channel: "whatsapp", ChatID: "15551234567@s.whatsapp.net", Media: []string{chart, report}}
+
+	deadline := time.After(2 * time.Second)
+	for {
+		mock.mu.Lock()
+		files, texts := append([]string(nil), mock.files...), len(mock.texts)
+		mock.mu.Unlock()
+		if len(files) == 2 {
+			want := []string{"chart.png image/png PNG", "report application/pdf %PDF-1.4"}
+			if files[0] != want[0] || files[1] != want[1] {
+				t.Fatalf("files = %q, want %q", files, want)
+			}
+			if texts != 0 {
+				t.Fatalf("sent %d texts for a message without content", texts)
+			}
+			return
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("timeout: sent files %q", files)
+		default:
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestWhatsAppClient_ReadOnReply_NoTyping(t *testing.T) {
+	hub := chat.NewHub(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mock := &mockWhatsAppSender{}
+	c := newWhatsAppClient(ctx, mock, hub, nil, types.JID{}, types.JID{})
+	c.typing = false
+	c.setReadReceipts(whatsappReadOnReply)
+
+	c.handleMessage(makeWhatsAppMsg("15551234567", false, false, "hello"))
+	in := <-hub.In
+	mock.mu.Lock()
+	read, presences := len(mock.markedRead), len(mock.chatPresences)
+	mock.mu.Unlock()
+	if read != 0 || presences != 0 {
+		t.Fatalf("before the reply: %d read receipts, %d chat presences, want none", read, presences)
+	}
+
+	hub.StartRouter(ctx)
+	go c.runOutbound()
+	hub.Out <- chat.Outbound{Channel: "whatsapp", ChatID: in.ChatID, Content: "hi"}
+	deadline := time.After(2 * time.Second)
+	for {
+		mock.mu.Lock()
+		read := append([]types.MessageID(nil), mock.markedRead...)
+		mock.mu.Unlock()
+		if len(read) == 1 && read[0] == "testmsg001" {
+			return
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("timeout: marked read %q", read)
+		default:
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestWhatsAppClient_QuotesReplyInBusyChat(t *testing.T) {
+	hub := chat.NewHub(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mock := &mockWhatsAppSender{}
+	c := newWhatsAppClient(ctx, mock, hub, nil, types.JID{}, types.JID{})
+	first := makeWhatsAppMsg("15551234567", false, false, "what time is it?")
+	first.Info.ID = "q1"
+	c.handleMessage(first)
+	in := <-hub.In
+	chatID := in.ChatID
+
+	if q := c.quoteFor(chatID, "q1"); q != nil {
+		t.Fatalf("quoted the latest message of a direct chat: %v", q)
+	}
+	second := makeWhatsAppMsg("15551234567", false, false, "and the weather?")
+	second.Info.ID = "q2"
+	c.handleMessage(second)
+	<-hub.In
+
+	hub.StartRouter(ctx)
+	go c.runOutbound()
+	hub.Out <- chat.Outbound{Channel: "whatsapp", ChatID: chatID, Content: "It's noon.", ReplyTo: "q1"}
+	deadline := time.After(2 * time.Second)
+	for {
+		mock.mu.Lock()
+		quotes := append([]string(nil), mock.quotes...)
+		mock.mu.Unlock()
+		if len(quotes) == 1 {
+			if quotes[0] != "q1" {
+				t.Fatalf("quoted %q, want q1", quotes[0])
+			}
+			return
+		}
+		select {
+		case <-deadline:
+			t.Fatal("timeout waiting for the reply")
+		default:
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestWhatsAppClient_SenderName(t *testing.T) {
+	hub := chat.NewHub(10)
+	saved := types.JID{User: "15551234567", Server: "s.whatsapp.net"}
+	mock := &mockWhatsAppSender{contacts: map[types.JID]types.ContactInfo{
+		saved: {Found: true, FullName: "Ana Lima", PushName: "ana 🌻"},
+	}}
+	c := newWhatsAppClient(context.Background(), mock, hub, nil, types.JID{}, types.JID{})
+
+	c.handleMessage(makeWhatsAppMsg("15551234567", false, false, "hi"))
+	if in := <-hub.In; in.SenderName != "Ana Lima" {
+		t.Errorf("saved contact: SenderName = %q, want the address book name", in.SenderName)
+	}
+	unsaved := makeWhatsAppMsg("15559876543", false, false, "hello")
+	unsaved.Info.PushName = "Bruno"
+	c.handleMessage(unsaved)
+	if in := <-hub.In; in.SenderName != "Bruno" {
+		t.Errorf("unsaved contact: SenderName = %q, want the push name", in.SenderName)
+	}
+}
+
+func TestWhatsAppClient_Buttons(t *testing.T) {
+	hub := chat.NewHub(10)
+	mock := &mockWhatsAppSender{}
+	c := newWhatsAppClient(context.Background(), mock, hub, nil, types.JID{}, types.JID{})
+	c.setButtons(whatsappButtonsInteractive)
+	jid := types.JID{User: "15551234567", Server: "s.whatsapp.net"}
+	out := chat.Outbound{Channel: "whatsapp", ChatID: jid.String(), Content: "Confirm?",
+		Metadata: map[string]interface{}{"buttons": []chat.Button{{ID: "y", Text: "Yes"}, {ID: "n", Text: "No"}}}}
+
+	if !c.sendButtons(jid, out) || len(mock.buttons) != 1 || mock.buttons[0] != "Confirm?: y n" {
+		t.Fatalf("interactive buttons not sent: %q", mock.buttons)
+	}
+	tap := makeWhatsAppMsg("15551234567", false, false, "")
+	tap.Message = &waProto.Message{ButtonsResponseMessage: &waProto.ButtonsResponseMessage{
+		SelectedButtonID: proto.String("n"),
+		Response:         &waProto.ButtonsResponseMessage_SelectedDisplayText{SelectedDisplayText: "No"},
+	}}
+	c.handleMessage(tap)
+	if in := <-hub.In; in.Content != "No" || in.ButtonID() != "n" {
+		t.Fatalf("button tap = %q (button %q)", in.Content, in.ButtonID())
+	}
+
+	// Refused interactive messages fall back to numbered options.
+	mock.buttonsErr = errors.New("not allowed")
+	if !c.sendButtons(jid, out) || len(mock.texts) != 1 || mock.texts[0].text != "Confirm?\n1. Yes\n2. No" {
+		t.Fatalf("options not sent as text: %+v", mock.texts)
+	}
+	c.handleMessage(makeWhatsAppMsg("15551234567", false, false, " 1 "))
+	if in := <-hub.In; in.Content != "Yes" || in.ButtonID() != "y" {
+		t.Fatalf("numbered answer = %q (button %q)", in.Content, in.ButtonID())
+	}
+	c.handleMessage(makeWhatsAppMsg("15551234567", false, false, "2"))
+	if in := <-hub.In; in.Content != "2" || in.ButtonID() != "" {
+		t.Fatalf("options answered twice: %q (button %q)", in.Content, in.ButtonID())
+	}
+}
+
+func TestWhatsAppClient_GroupButtonsNeedAddressing(t *testing.T) {
+	hub := chat.NewHub(10)
+	mock := &mockWhatsAppSender{}
+	own := types.JID{User: "85298765432", Server: "s.whatsapp.net"}
+	c := newWhatsAppClient(context.Background(), mock, hub, nil, own, types.JID{})
+	group := types.JID{User: "120363012345678901", Server: "g.us"}
+	c.allowGroups[group.User] = struct{}{}
+	c.groupTrigger = "!bot"
+	out := chat.Outbound{Channel: "whatsapp", ChatID: group.String(), Content: "Which day?",
+		Metadata: map[string]interface{}{"buttons": []chat.Button{{ID: "sat", Text: "Saturday"}, {ID: "sun", Text: "Sunday"}}}}
+	if !c.sendButtons(group, out) || len(mock.texts) != 1 || len(mock.buttons) != 0 {
+		t.Fatalf("options not sent as text by default: texts %+v, buttons %q", mock.texts, mock.buttons)
+	}
+	groupMsg := func(text string) *events.Message {
+		evt := makeWhatsAppMsg("15551234567", false, true, text)
+		evt.Info.Chat = group
+		return evt
+	}
+
+	// Group members talking among themselves do not answer the options.
+	c.handleMessage(groupMsg("2"))
+	select {
+	case in := <-hub.In:
+		t.Fatalf("unaddressed number taken as an answer: %+v", in)
+	default:
+	}
+	c.handleMessage(groupMsg("!bot 2"))
+	if in := <-hub.In; in.Content != "Sunday" || in.ButtonID() != "sun" {
+		t.Fatalf("addressed answer = %q (button %q)", in.Content, in.ButtonID())
+	}
+}
+
+func TestWhatsAppClient_ChatActions(t *testing.T) {
+	hub := chat.NewHub(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mock := &mockWhatsAppSender{}
+	c := newWhatsAppClient(ctx, mock, hub, nil, types.JID{}, types.JID{})
+	hub.StartRouter(ctx)
+	go c.runOutbound()
+
+	hub.Out <- chat.Outbound{Channel: "whatsapp", ChatID: "120363@g.us", Metadata: map[string]interface{}{"chat_title": "Trip"}}
+	hub.Out <- chat.Outbound{Channel: "whatsapp", ChatID: "15551234567@s.whatsapp.net", Metadata: map[string]interface{}{"star": "ABC"}}
+	want := []string{"SetGroupName 120363@g.us Trip", "Star 15551234567@s.whatsapp.net 15551234567@s.whatsapp.net ABC"}
+	deadline := time.After(2 * time.Second)
+	for {
+		mock.mu.Lock()
+		actions, texts := append([]string(nil), mock.actions...), len(mock.texts)
+		mock.mu.Unlock()
+		if len(actions) == 2 {
+			if actions[0] != want[0] || actions[1] != want[1] {
+				t.Fatalf("actions = %q, want %q", actions, want)
+			}
+			if texts != 0 {
+				t.Fatalf("sent %d texts for messages without content", texts)
+			}
+			return
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("timeout: actions %q", actions)
+		default:
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestWhatsAppClient_PostsStatus(t *testing.T) {
+	hub := chat.NewHub(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mock := &mockWhatsAppSender{}
+	c := newWhatsAppClient(ctx, mock, hub, nil, types.JID{}, types.JID{})
+	hub.StartRouter(ctx)
+	go c.runOutbound()
+
+	img := filepath.Join(t.TempDir(), "summary.png")
+	os.WriteFile(img, []byte("\x89PNG\r\n\x1a\n0000"), 0o644)
+	status := map[string]interface{}{"status": true}
+	hub.Out <- chat.Outbound{Channel: "whatsapp", ChatID: "status@broadcast", Content: "Good morning!", Metadata: status}
+	hub.Out <- chat.Outbound{Channel: "whatsapp", ChatID: "status@broadcast", Content: "Today", Media: []string{img}, Metadata: status}
+	want := []string{"Good morning! ", "Today image/png"}
+	deadline := time.After(2 * time.Second)
+	for {
+		mock.mu.Lock()
+		statuses, texts := append([]string(nil), mock.statuses...), len(mock.texts)
+		mock.mu.Unlock()
+		if len(statuses) == 2 {
+			if statuses[0] != want[0] || statuses[1] != want[1] {
+				t.Fatalf("statuses = %q, want %q", statuses, want)
+			}
+			if texts != 0 || len(mock.files) != 0 {
+				t.Fatal("a status update was also sent as a message")
+			}
+			return
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("timeout: statuses %q", statuses)
+		default:
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestWhatsAppClient_VoiceRepliesToVoiceNotes(t *testing.T) {
+	hub := chat.NewHub(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mock := &mockWhatsAppSender{}
+	c := newWhatsAppClient(ctx, mock, hub, nil, types.JID{}, types.JID{})
+	c.setVoiceReplies(whatsappVoiceMirror, fakeSynthesizer{})
+
+	voice := makeWhatsAppMsg("15551234567", false, false, "")
+	ptt := true
+	voice.Message = &waProto.Message{AudioMessage: &waProto.AudioMessage{PTT: &ptt}}
+	c.noteVoice(voice)
+	text := makeWhatsAppMsg("15557654321", false, false, "hi")
+	c.noteVoice(text)
+
+	hub.StartRouter(ctx)
+	go c.runOutbound()
+	hub.Out <- chat.Outbound{Channel: "whatsapp", ChatID: voice.Info.Chat.String(), Content: "**Sure**, done."}
+	hub.Out <- chat.Outbound{Channel: "whatsapp", ChatID: text.Info.Chat.String(), Content: "Hello!"}
+	deadline := time.After(2 * time.Second)
+	for {
+		mock.mu.Lock()
+		voices, texts := append([]string(nil), mock.voices...), len(mock.texts)
+		mock.mu.Unlock()
+		if len(voices)+texts == 2 {
+			if len(voices) != 1 || voices[0] != "voice:Sure, done." || texts != 1 {
+				t.Fatalf("voices = %q, %d texts; want the voice note answered by voice, the text by text", voices, texts)
+			}
+			return
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("timeout: voices %q, %d texts", voices, texts)
+		default:
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
 // --- extractMessageText tests ---
 
 func TestExtractMessageText(t *testing.T) {
@@ -490,3 +922,181 @@ func TestWhatsAppClient_StopAllTyping(t *testing.T) {
 		t.Errorf("expected 0 typing stops after stopAllTyping, got %d", remaining)
 	}
 }
+
+// fakeTranscriber returns text for every file.
+type fakeTranscriber struct{ text string }
+
+func (f fakeTranscriber) Transcribe(_ context.Context, path string) (string, error) {
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+	return f.text, nil
+}
+
+func TestWhatsAppClient_SavesMediaInInbox(t *testing.T) {
+	hub := chat.NewHub(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mock := &mockWhatsAppSender{media: []byte("OggS")}
+	c := newWhatsAppClient(ctx, mock, hub, nil, types.JID{}, types.JID{})
+	c.inbox = t.TempDir()
+	c.transcriber = fakeTranscriber{"call the plumber"}
+
+	msg := makeWhatsAppMsg("15551234567", false, false, "")
+	mime, ptt := "audio/ogg; codecs=opus", true
+	msg.Message = &waProto.Message{AudioMessage: &waProto.AudioMessage{Mimetype: &mime, PTT: &ptt}}
+	c.handleMessage(msg)
+	in := <-hub.In
+	rel := filepath.Join("inbox", "whatsapp", "15551234567", "testmsg001.ogg")
+	want := "[voice transcript]: call the plumber\n[voice saved as " + rel + " in the workspace]"
+	if in.Content != want {
+		t.Errorf("Content = %q, want %q", in.Content, want)
+	}
+	if len(in.Media) != 1 || in.Metadata["file_path"] != rel || in.Metadata["attachment_type"] != "voice" {
+		t.Errorf("Media = %v, Metadata = %v", in.Media, in.Metadata)
+	}
+	if b, err := os.ReadFile(filepath.Join(c.inbox, rel)); err != nil || string(b) != "OggS" {
+		t.Errorf("saved file = %q, %v", b, err)
+	}
+
+	caption := "the leak"
+	mime = "image/jpeg"
+	msg.Message = &waProto.Message{ImageMessage: &waProto.ImageMessage{Caption: &caption, Mimetype: &mime}}
+	c.handleMessage(msg)
+	in = <-hub.In
+	rel = filepath.Join("inbox", "whatsapp", "15551234567", "testmsg001.jpg")
+	if want := "the leak\n[image saved as " + rel + " in the workspace]"; in.Content != want {
+		t.Errorf("Content = %q, want %q", in.Content, want)
+	}
+}
+
+func TestWhatsAppClient_HandleMessage_AllowedGroup(t *testing.T) {
+	hub := chat.NewHub(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	own := types.JID{User: "85298765432", Server: "s.whatsapp.net"}
+	c := newWhatsAppClient(ctx, &mockWhatsAppSender{}, hub, allowOnly(t, "nobody"), own, types.JID{})
+	c.allowGroups["120363012345678901"] = struct{}{}
+	c.groupTrigger = "!bot"
+
+	group := types.JID{User: "120363012345678901", Server: "g.us"}
+	groupMsg := func(m *waProto.Message) *events.Message {
+		evt := makeWhatsAppMsg("15551234567", false, true, "")
+		evt.Info.Chat = group
+		evt.Message = m
+		return evt
+	}
+	text := func(s string) *waProto.Message { return &waProto.Message{Conversation: &s} }
+	mention := func(s string, jids ...string) *waProto.Message {
+		return &waProto.Message{ExtendedTextMessage: &waProto.ExtendedTextMessage{Text: &s, ContextInfo: &waProto.ContextInfo{MentionedJID: jids}}}
+	}
+
+	c.handleMessage(groupMsg(text("dinner at 8?")))
+	c.handleMessage(groupMsg(mention("@15550000000 are you coming?", "15550000000@s.whatsapp.net")))
+	c.handleMessage(groupMsg(text("!BOT what's the weather")))
+	c.handleMessage(groupMsg(mention("@85298765432 add milk to the list", "85298765432@s.whatsapp.net")))
+	other := groupMsg(text("!bot hello"))
+	other.Info.Chat = types.JID{User: "120363099999999999", Server: "g.us"}
+	c.handleMessage(other)
+
+	for _, want := range []string{"what's the weather", "add milk to the list"} {
+		select {
+		case msg := <-hub.In:
+			if msg.Content != want || msg.ChatID != group.String() || msg.SenderID != "15551234567" {
+				t.Errorf("got %q in %s from %s, want %q", msg.Content, msg.ChatID, msg.SenderID, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for %q", want)
+		}
+	}
+	select {
+	case msg := <-hub.In:
+		t.Errorf("unexpected message %q", msg.Content)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWhatsAppClient_RelinkedAccountIsOwn(t *testing.T) {
+	old := types.JID{User: "85298765432", Server: "s.whatsapp.net"}
+	c := newWhatsAppClient(context.Background(), &mockWhatsAppSender{}, chat.NewHub(1), nil, old, types.JID{})
+
+	// Pairing again replaces the account while messages are being handled.
+	relinked := types.JID{User: "85211112222", Server: "s.whatsapp.net"}
+	lid := types.JID{User: "169032883908635", Server: "lid"}
+	done := make(chan struct{})
+	go func() {
+		c.setOwn(relinked, lid)
+		close(done)
+	}()
+	c.isOwn(old.String())
+	<-done
+
+	if c.isOwn(old.String()) || !c.isOwn(relinked.String()) || !c.isOwn(lid.String()) {
+		t.Fatal("isOwn does not follow the relinked account")
+	}
+	if got := c.groupText("@169032883908635 hi"); got != "hi" {
+		t.Fatalf("groupText = %q", got)
+	}
+}
+
+func TestWhatsAppPairerSendsCodeAsImage(t *testing.T) {
+	hub := chat.NewHub(10)
+	p := &whatsappPairer{ctx: context.Background(), hub: hub, dir: t.TempDir(),
+		cfg: config.WhatsAppPairing{Channel: "telegram", ChatID: "8881234567"}}
+
+	path, err := p.sendCode("2@abc,def,ghi", 1, 60*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := <-hub.Out
+	if out.Channel != "telegram" || out.ChatID != "8881234567" || len(out.Media) != 1 || out.Media[0] != path {
+		t.Fatalf("unexpected outbound: %+v", out)
+	}
+	if out.Metadata["delete_after"] != 60 {
+		t.Errorf("delete_after = %v, want 60", out.Metadata["delete_after"])
+	}
+	if b, err := os.ReadFile(path); err != nil || !strings.HasPrefix(string(b), "\x89PNG") {
+		t.Fatalf("QR image not written as PNG: %v", err)
+	}
+}
+
+func TestWhatsAppBackupRestore(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "whatsapp.db")
+	db, err := sql.Open("sqlite", "file:"+dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("CREATE TABLE device (jid TEXT); INSERT INTO device VALUES ('15551234567@s.whatsapp.net')"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	backup := filepath.Join(dir, "wa.backup")
+	if err := BackupWhatsApp(context.Background(), dbPath, backup, []byte("secret")); err != nil {
+		t.Fatalf("BackupWhatsApp: %v", err)
+	}
+	if data, _ := os.ReadFile(backup); strings.Contains(string(data), "15551234567") {
+		t.Fatal("the backup is not encrypted")
+	}
+
+	restored := filepath.Join(dir, "new", "whatsapp.db")
+	if err := RestoreWhatsApp(backup, restored, []byte("wrong"), false); err == nil {
+		t.Fatal("restored with a wrong passphrase")
+	}
+	if err := RestoreWhatsApp(backup, restored, []byte("secret"), false); err != nil {
+		t.Fatalf("RestoreWhatsApp: %v", err)
+	}
+	if err := RestoreWhatsApp(backup, restored, []byte("secret"), false); err == nil {
+		t.Fatal("replaced an existing session without force")
+	}
+	db, err = sql.Open("sqlite", "file:"+restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var jid string
+	if err := db.QueryRow("SELECT jid FROM device").Scan(&jid); err != nil || jid != "15551234567@s.whatsapp.net" {
+		t.Fatalf("restored session holds %q, %v", jid, err)
+	}
+}
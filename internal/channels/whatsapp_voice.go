@@ -0,0 +1,98 @@
+//go:build !lite
+
+package channels
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/tts"
+)
+
+// Voice reply modes, set by channels.whatsapp.voiceReplies.
+const (
+	whatsappVoiceOff    = "off"    // always text (default)
+	whatsappVoiceMirror = "voice"  // voice notes answered with voice notes
+	whatsappVoiceAlways = "always" // every reply a voice note
+)
+
+// whatsappSynthesizeTimeout bounds the reading aloud of one reply.
+const whatsappSynthesizeTimeout = time.Minute
+
+func (r *realWhatsAppSender) SendVoice(ctx context.Context, to types.JID, data []byte) error {
+	up, err := r.client().Upload(ctx, data, whatsmeow.MediaAudio)
+	if err != nil {
+		return fmt.Errorf("upload: %w", err)
+	}
+	_, err = r.client().SendMessage(ctx, to, &waProto.Message{AudioMessage: &waProto.AudioMessage{
+		URL: proto.String(up.URL), DirectPath: proto.String(up.DirectPath), MediaKey: up.MediaKey,
+		FileEncSHA256: up.FileEncSHA256, FileSHA256: up.FileSHA256, FileLength: proto.Uint64(up.FileLength),
+		Mimetype: proto.String("audio/ogg; codecs=opus"), PTT: proto.Bool(true),
+	}})
+	return err
+}
+
+// setVoiceReplies sets when replies are read aloud with synth; unknown
+// modes, or no synth, keep them as text.
+func (c *whatsappClient) setVoiceReplies(mode string, synth tts.Synthesizer) {
+	switch mode {
+	case "", whatsappVoiceOff:
+		return
+	case whatsappVoiceMirror, whatsappVoiceAlways:
+	default:
+		log.Printf("whatsapp: unknown voiceReplies %q (use off, voice or always), replying with text", mode)
+		return
+	}
+	if synth == nil {
+		log.Printf("whatsapp: voiceReplies needs speech to be enabled, replying with text")
+		return
+	}
+	c.voiceReplies, c.synthesizer = mode, synth
+}
+
+// noteVoice records whether the latest message of the chat was a voice
+// note, which the "voice" mode answers in kind.
+func (c *whatsappClient) noteVoice(msg *events.Message) {
+	if c.voiceReplies == whatsappVoiceMirror {
+		c.voiceChats.Store(msg.Info.Chat.String(), msg.Message.GetAudioMessage().GetPTT())
+	}
+}
+
+// sendVoice sends out as a voice note instead of text, when the mode asks
+// for it and the text can be read aloud. It reports whether it did; on
+// false the reply is to be sent as text.
+func (c *whatsappClient) sendVoice(recipient types.JID, out chat.Outbound) bool {
+	if c.synthesizer == nil || out.Content == "" || out.Type != "" {
+		return false
+	}
+	if c.voiceReplies == whatsappVoiceMirror {
+		if voice, _ := c.voiceChats.Load(out.ChatID); voice != true {
+			return false
+		}
+	}
+	text, ok := tts.Speakable(out.Content)
+	if !ok {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(c.ctx, whatsappSynthesizeTimeout)
+	defer cancel()
+	audio, err := c.synthesizer.Synthesize(ctx, text)
+	if err != nil {
+		log.Printf("whatsapp: reading the reply aloud: %v", err)
+		return false
+	}
+	if err := c.sender.SendVoice(c.ctx, recipient, audio); err != nil {
+		log.Printf("whatsapp: sending voice note: %v", err)
+		return false
+	}
+	return true
+}
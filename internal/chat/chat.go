@@ -3,31 +3,196 @@ package chat
 import (
 	"context"
 	"log"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
 // Inbound represents an incoming message to the agent.
+//
+// An Inbound whose "event" metadata is set (e.g. "poll_answer") reports
+// something that happened in the chat rather than a message to answer: the
+// agent records it in the chat's history without replying.
+//
+// A tap on a button the agent offered (see the "buttons" directive of
+// Outbound) arrives as a message whose Content is the button's text and whose
+// "button_id" metadata is its ID.
+//
+// SenderName is the sender's human-readable name, when the channel knows it
+// (e.g. a WhatsApp contact name); SenderID remains the stable identifier.
 type Inbound struct {
-	Channel   string
-	SenderID  string
-	ChatID    string
-	Content   string
-	Timestamp time.Time
-	Media     []string
-	Metadata  map[string]interface{}
+	Channel    string
+	SenderID   string
+	SenderName string
+	ChatID     string
+	Content    string
+	Timestamp  time.Time
+	Media      []string
+	Metadata   map[string]interface{}
 }
 
 // Outbound represents a message produced by the agent.
+// ReplyTo is the channel-native ID of the message being answered (taken from
+// the inbound "message_id" metadata); channels that support threading send the
+// reply attached to it. Media holds absolute paths of files to attach.
+//
+// Streamed replies are delivered as a series of messages sharing a StreamID:
+// zero or more Partial snapshots of the text generated so far, followed by the
+// final message with Partial unset. Only channels registered with
+// EnableStreaming receive partial snapshots.
+//
+// Type classifies messages that the hub decorates with a prefix icon, the
+// same on every channel (see Hub.SetPrefixes); it is empty for ordinary
+// replies.
+//
+// Urgent messages are delivered even during the chat's quiet hours (see
+// Hub.SetQuietHours).
+//
+// Private messages belong to a chat in private mode: channels write nothing
+// of them to disk, such as outbox journals or dead-letter files.
+//
+// Metadata carries optional channel-specific directives; channels ignore keys
+// they do not support:
+//
+//	"sticker"       string  emoji of a sticker to send after the text (Telegram)
+//	"poll"          Poll    a poll to send after the text (Telegram)
+//	"delete_after"  int     seconds after which the sent messages are deleted,
+//	                        for replies with secrets or private data (Telegram)
+//	"pin"           bool    pin the first message sent, silently unless
+//	                        "pin_notify" is set (Telegram)
+//	"unpin"         bool    unpin the chat's latest pinned message (Telegram)
+//	"pin_message"   string  ID of an existing message to pin (Telegram)
+//	"chat_title"    string  rename the chat (Telegram, WhatsApp groups)
+//	"chat_description" string  set the chat's description (Telegram,
+//	                        WhatsApp groups)
+//	"star"          string  ID of a message of the chat to star, i.e. save to
+//	                        the starred messages (WhatsApp)
+//	"buttons"       []Button  choices offered with the text, as reply buttons
+//	                        or a list (WhatsApp)
+//	"channel_post"  bool    the message is a post to the broadcast channel
+//	                        ChatID; failures are not reported back with
+//	                        ReportUndelivered (Telegram)
+//	"fallback"      bool    the message stands in for one that could not be
+//	                        delivered (see Hub.ReportUndelivered)
+//	"tool_event"    ToolEvent  a tool the agent ran while answering ReplyTo,
+//	                        sent without Content, and only to channels
+//	                        registered with EnableToolEvents
 type Outbound struct {
 	Channel  string
 	ChatID   string
 	Content  string
 	ReplyTo  string
 	Media    []string
+	StreamID string
+	Partial  bool
+	Type     string
+	Urgent   bool
+	Private  bool
 	Metadata map[string]interface{}
 }
 
+// ToolEvent reports a tool the agent ran (the "tool_event" directive).
+type ToolEvent struct {
+	Name     string
+	Duration time.Duration
+	Error    string // empty when the tool succeeded
+}
+
+// Outbound message types.
+const (
+	TypeError    = "error"    // the agent failed to answer
+	TypeReminder = "reminder" // a scheduled reminder firing
+	TypeReport   = "report"   // a summary or report the agent produced
+)
+
+// DefaultPrefixes are the icons the hub prefixes typed messages with.
+var DefaultPrefixes = map[string]string{
+	TypeError:    "⚠️",
+	TypeReminder: "⏰",
+	TypeReport:   "📊",
+}
+
+// DeleteAfter returns how long after sending the message should be deleted
+// (the "delete_after" metadata), or 0 to keep it.
+func (out Outbound) DeleteAfter() time.Duration {
+	switch v := out.Metadata["delete_after"].(type) {
+	case int:
+		return time.Duration(v) * time.Second
+	case float64:
+		return time.Duration(v * float64(time.Second))
+	}
+	return 0
+}
+
+// MessageID returns the channel-native message ID stored in the inbound
+// "message_id" metadata, or "" when the channel did not provide one.
+func (in Inbound) MessageID() string {
+	id, _ := in.Metadata["message_id"].(string)
+	return id
+}
+
+// Event returns the kind of event stored in the inbound "event" metadata, or
+// "" for ordinary messages.
+func (in Inbound) Event() string {
+	ev, _ := in.Metadata["event"].(string)
+	return ev
+}
+
+// IsAdmin reports whether the channel identified the sender as one of its
+// configured admins (the inbound "admin" metadata), who may use the admin
+// commands.
+func (in Inbound) IsAdmin() bool {
+	admin, _ := in.Metadata["admin"].(bool)
+	return admin
+}
+
+// IsDM reports whether msg was sent in a direct (one-to-one) chat with the
+// bot, as channels tell with the inbound "is_dm" metadata. Messages of
+// channels that do not set it count as group messages.
+func (in Inbound) IsDM() bool {
+	dm, _ := in.Metadata["is_dm"].(bool)
+	return dm
+}
+
+// Poll is a question with a fixed set of answers, sent to a chat.
+type Poll struct {
+	Question        string
+	Options         []string
+	MultipleAnswers bool
+}
+
+// Button is a choice offered to the user with a message. ID comes back in
+// the "button_id" metadata of the Inbound when the button is tapped.
+type Button struct {
+	ID   string
+	Text string
+}
+
+// ButtonID returns the ID of the button the user tapped, stored in the
+// inbound "button_id" metadata, or "" when msg is not a button reply.
+func (in Inbound) ButtonID() string {
+	id, _ := in.Metadata["button_id"].(string)
+	return id
+}
+
+// Location is a geographic position shared by the user.
+type Location struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// Location returns the position stored in the inbound "latitude" and
+// "longitude" metadata, which channels set when the user shares a location.
+func (in Inbound) Location() (Location, bool) {
+	lat, ok1 := in.Metadata["latitude"].(float64)
+	lon, ok2 := in.Metadata["longitude"].(float64)
+	if !ok1 || !ok2 {
+		return Location{}, false
+	}
+	return Location{Latitude: lat, Longitude: lon}, true
+}
+
 // Hub provides simple buffered channels for inbound/outbound messages.
 //
 // When only one channel (e.g. Telegram) is active, goroutines may read from
@@ -38,16 +203,32 @@ type Hub struct {
 	In  chan Inbound
 	Out chan Outbound
 
-	subMu sync.RWMutex
-	subs  map[string]chan Outbound
+	subMu     sync.RWMutex
+	subs      map[string]chan Outbound
+	streaming map[string]bool
+	toolEvts  map[string]bool
+	commands  []Command
+	prefixes  map[string]string
+	quiet     *QuietHours
+	sanitizer *Sanitizer
+}
+
+// Command describes a slash command handled by the agent, so channels can
+// advertise it to users (e.g. Telegram's command menu).
+type Command struct {
+	Name        string // without the leading slash
+	Description string
 }
 
 // NewHub constructs a new Hub with the given buffer size.
 func NewHub(buffer int) *Hub {
 	return &Hub{
-		In:   make(chan Inbound, buffer),
-		Out:  make(chan Outbound, buffer),
-		subs: make(map[string]chan Outbound),
+		In:        make(chan Inbound, buffer),
+		Out:       make(chan Outbound, buffer),
+		subs:      make(map[string]chan Outbound),
+		streaming: make(map[string]bool),
+		toolEvts:  make(map[string]bool),
+		prefixes:  DefaultPrefixes,
 	}
 }
 
@@ -62,36 +243,241 @@ func (h *Hub) Subscribe(name string) <-chan Outbound {
 	return ch
 }
 
+// QueueDepth is how many messages wait in one of the hub's queues.
+type QueueDepth struct {
+	Name string // "in", "out", or the name of a subscribed channel
+	Len  int
+	Cap  int
+}
+
+// QueueDepths reports the inbound and outbound queues, then the queue of
+// each subscribed channel in name order.
+func (h *Hub) QueueDepths() []QueueDepth {
+	depths := []QueueDepth{{"in", len(h.In), cap(h.In)}, {"out", len(h.Out), cap(h.Out)}}
+	h.subMu.RLock()
+	defer h.subMu.RUnlock()
+	names := make([]string, 0, len(h.subs))
+	for name := range h.subs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		depths = append(depths, QueueDepth{name, len(h.subs[name]), cap(h.subs[name])})
+	}
+	return depths
+}
+
+// EnableStreaming marks the named channel as able to render partial replies
+// (e.g. by editing a placeholder message as text arrives).
+func (h *Hub) EnableStreaming(name string) {
+	h.subMu.Lock()
+	h.streaming[name] = true
+	h.subMu.Unlock()
+}
+
+// Streams reports whether the named channel renders partial replies.
+func (h *Hub) Streams(name string) bool {
+	h.subMu.RLock()
+	defer h.subMu.RUnlock()
+	return h.streaming[name]
+}
+
+// EnableToolEvents marks the named channel as wanting to hear about the
+// tools the agent runs while answering (the "tool_event" directive).
+func (h *Hub) EnableToolEvents(name string) {
+	h.subMu.Lock()
+	h.toolEvts[name] = true
+	h.subMu.Unlock()
+}
+
+// ToolEvents reports whether the named channel wants tool events.
+func (h *Hub) ToolEvents(name string) bool {
+	h.subMu.RLock()
+	defer h.subMu.RUnlock()
+	return h.toolEvts[name]
+}
+
+// SetCommands records the slash commands the agent understands.
+func (h *Hub) SetCommands(cmds []Command) {
+	h.subMu.Lock()
+	h.commands = cmds
+	h.subMu.Unlock()
+}
+
+// Commands returns the slash commands registered with SetCommands.
+func (h *Hub) Commands() []Command {
+	h.subMu.RLock()
+	defer h.subMu.RUnlock()
+	return h.commands
+}
+
+// SetPrefixes changes the icons typed messages are prefixed with. Types
+// missing from prefixes keep their default; an empty icon turns the prefix off.
+func (h *Hub) SetPrefixes(prefixes map[string]string) {
+	merged := make(map[string]string, len(DefaultPrefixes)+len(prefixes))
+	for t, p := range DefaultPrefixes {
+		merged[t] = p
+	}
+	for t, p := range prefixes {
+		merged[t] = p
+	}
+	h.subMu.Lock()
+	h.prefixes = merged
+	h.subMu.Unlock()
+}
+
+// decorate cleans out's content with the sanitizer, then prefixes it with
+// the icon of its type, unless the content already starts with it.
+func (h *Hub) decorate(out *Outbound) {
+	h.subMu.RLock()
+	sanitizer, prefix := h.sanitizer, h.prefixes[out.Type]
+	h.subMu.RUnlock()
+	out.Content = sanitizer.Clean(out.Channel, out.Content)
+	if out.Type == "" || out.Content == "" {
+		return
+	}
+	if prefix != "" && !strings.HasPrefix(out.Content, prefix) {
+		out.Content = prefix + " " + out.Content
+	}
+}
+
+// SetQuietHours makes the router hold back messages sent to a chat during
+// its quiet hours, unless they are urgent or answer the user, and deliver
+// them in order when the quiet hours end. Held messages are kept in memory
+// only. A nil q turns quiet hours off.
+func (h *Hub) SetQuietHours(q *QuietHours) {
+	h.subMu.Lock()
+	h.quiet = q
+	h.subMu.Unlock()
+}
+
+// SetSanitizer makes the router clean every outbound message with s before
+// it reaches its channel. A nil s turns sanitizing off.
+func (h *Hub) SetSanitizer(s *Sanitizer) {
+	h.subMu.Lock()
+	h.sanitizer = s
+	h.subMu.Unlock()
+}
+
+// Sanitize returns text cleaned as the router cleans the messages of
+// channel (see SetSanitizer), for replies that are kept or shown without
+// going through it.
+func (h *Hub) Sanitize(channel, text string) string {
+	h.subMu.Lock()
+	s := h.sanitizer
+	h.subMu.Unlock()
+	return s.Clean(channel, text)
+}
+
+// quietRecheck is how often the router looks for held messages whose quiet
+// hours are over.
+var quietRecheck = time.Minute
+
 // StartRouter reads from Out and dispatches each message to the registered
-// subscriber for its channel. Messages for unregistered channels are dropped
-// with a warning. This must be called after all subscribers are registered.
+// subscriber for its channel, sanitizing and decorating messages on the way and
+// holding back those sent during quiet hours. Messages for unregistered
+// channels are dropped with a warning. This must be called after all
+// subscribers are registered.
 func (h *Hub) StartRouter(ctx context.Context) {
 	go func() {
+		var held []Outbound
+		ticker := time.NewTicker(quietRecheck)
+		defer ticker.Stop()
 		for {
 			select {
 			case <-ctx.Done():
+				if len(held) > 0 {
+					log.Printf("hub: dropping %d messages held for quiet hours", len(held))
+				}
 				return
+			case <-ticker.C:
+				if len(held) == 0 {
+					continue
+				}
+				h.subMu.RLock()
+				q := h.quiet
+				h.subMu.RUnlock()
+				now := time.Now()
+				waiting := held[:0:0]
+				for _, out := range held {
+					if q.holds(out, now) {
+						waiting = append(waiting, out)
+					} else if !h.route(ctx, out) {
+						return
+					}
+				}
+				held = waiting
 			case out, ok := <-h.Out:
 				if !ok {
 					return
 				}
+				h.decorate(&out)
 				h.subMu.RLock()
-				ch, exists := h.subs[out.Channel]
+				q := h.quiet
 				h.subMu.RUnlock()
-				if exists {
-					select {
-					case ch <- out:
-					case <-ctx.Done():
-						return
-					}
-				} else {
-					log.Printf("hub: no subscriber for channel %q, dropping outbound message", out.Channel)
+				if q.holds(out, time.Now()) {
+					held = append(held, out)
+					continue
+				}
+				if !h.route(ctx, out) {
+					return
 				}
 			}
 		}
 	}()
 }
 
+// route hands out to the subscriber of its channel. It returns false when ctx
+// was canceled while waiting.
+func (h *Hub) route(ctx context.Context, out Outbound) bool {
+	h.subMu.RLock()
+	ch, exists := h.subs[out.Channel]
+	h.subMu.RUnlock()
+	if !exists {
+		log.Printf("hub: no subscriber for channel %q, dropping outbound message", out.Channel)
+		return true
+	}
+	select {
+	case ch <- out:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// EventUndelivered is the "event" of the Inbound a channel sends back with
+// the content of a reply it gave up on.
+const EventUndelivered = "undelivered"
+
+// ReportUndelivered tells the agent that a channel gave up on sending out,
+// after retrying, for the reason given; the agent then delivers a short
+// plain-text version instead. When out was sent in parts and only some
+// arrived, missing gives the others, and only they are summarized. Fallback
+// messages are not reported, so a channel that is down does not loop.
+func (h *Hub) ReportUndelivered(out Outbound, reason string, missing ...string) {
+	if fallback, _ := out.Metadata["fallback"].(bool); fallback || out.Partial || strings.TrimSpace(out.Content) == "" {
+		return
+	}
+	in := Inbound{
+		Channel:   out.Channel,
+		ChatID:    out.ChatID,
+		Content:   out.Content,
+		Timestamp: time.Now(),
+		Metadata:  map[string]interface{}{"event": EventUndelivered, "error": reason, "message_id": out.ReplyTo},
+	}
+	if len(missing) > 0 {
+		in.Metadata["missing"] = strings.Join(missing, "\n\n")
+	}
+	if out.Private {
+		in.Metadata["private"] = true
+	}
+	select {
+	case h.In <- in:
+	default:
+		log.Printf("hub: inbound channel full, dropping the report of an undelivered %s message", out.Channel)
+	}
+}
+
 // Close closes the channels.
 func (h *Hub) Close() {
 	close(h.In)
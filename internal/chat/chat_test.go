@@ -0,0 +1,176 @@
+package chat
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRouterPrefixesTypedMessages(t *testing.T) {
+	h := NewHub(10)
+	h.SetPrefixes(map[string]string{TypeReport: ""})
+	sub := h.Subscribe("telegram")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h.StartRouter(ctx)
+
+	for _, out := range []Outbound{
+		{Channel: "telegram", Type: TypeError, Content: "Sorry, that failed."},
+		{Channel: "telegram", Type: TypeReminder, Content: "⏰ Call mom"}, // already decorated
+		{Channel: "telegram", Type: TypeReport, Content: "Weekly summary"},
+		{Channel: "telegram", Content: "plain"},
+	} {
+		h.Out <- out
+	}
+	for _, want := range []string{"⚠️ Sorry, that failed.", "⏰ Call mom", "Weekly summary", "plain"} {
+		select {
+		case got := <-sub:
+			if got.Content != want {
+				t.Fatalf("got %q, want %q", got.Content, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for routed message")
+		}
+	}
+}
+
+func TestQuietHours(t *testing.T) {
+	q, err := NewQuietHours("22:00-07:00", map[string]string{"telegram:2": "off", "telegram:3": "13:00-14:00"}, "UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(hm string) time.Time {
+		tm, _ := time.Parse("15:04", hm)
+		return time.Date(2026, 1, 1, tm.Hour(), tm.Minute(), 0, 0, time.UTC)
+	}
+	for _, c := range []struct {
+		chat, at string
+		want     bool
+	}{
+		{"1", "23:00", true}, {"1", "03:00", true}, {"1", "07:00", false}, {"1", "12:00", false},
+		{"2", "23:00", false},
+		{"3", "13:30", true}, {"3", "23:00", false},
+	} {
+		if got := q.Quiet("telegram", c.chat, at(c.at)); got != c.want {
+			t.Errorf("chat %s at %s: quiet = %v, want %v", c.chat, c.at, got, c.want)
+		}
+	}
+	if _, err := NewQuietHours("10pm-7am", nil, ""); err == nil {
+		t.Error("expected an error for a malformed span")
+	}
+}
+
+func TestRouterHoldsMessagesDuringQuietHours(t *testing.T) {
+	defer func(d time.Duration) { quietRecheck = d }(quietRecheck)
+	quietRecheck = 10 * time.Millisecond
+	// Quiet all day long (00:00-23:59), except for the last minute.
+	q, err := NewQuietHours("00:00-23:59", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !q.Quiet("telegram", "1", time.Now()) {
+		t.Skip("test running in the one non-quiet minute of the day")
+	}
+	h := NewHub(10)
+	h.SetQuietHours(q)
+	sub := h.Subscribe("telegram")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h.StartRouter(ctx)
+
+	h.Out <- Outbound{Channel: "telegram", ChatID: "1", Content: "held 1", Type: TypeReport}
+	h.Out <- Outbound{Channel: "telegram", ChatID: "1", Content: "urgent", Urgent: true, Type: TypeReminder}
+	h.Out <- Outbound{Channel: "telegram", ChatID: "1", Content: "held 2", Type: TypeReminder}
+	h.Out <- Outbound{Channel: "telegram", ChatID: "1", Content: "reply", ReplyTo: "42"}
+	// Messages without a reply to point to are still answers, e.g. a post
+	// an admin asked to publish, or a Discord reply.
+	h.Out <- Outbound{Channel: "telegram", ChatID: "1", Content: "post", Metadata: map[string]interface{}{"channel_post": true}}
+	recv := func() string {
+		select {
+		case got := <-sub:
+			return got.Content
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for routed message")
+			return ""
+		}
+	}
+	for _, want := range []string{"⏰ urgent", "reply", "post"} {
+		if got := recv(); got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+	select {
+	case got := <-sub:
+		t.Fatalf("%q was delivered during quiet hours", got.Content)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	h.SetQuietHours(nil) // morning
+	for _, want := range []string{"📊 held 1", "⏰ held 2"} {
+		if got := recv(); got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestQueueDepths(t *testing.T) {
+	h := NewHub(4)
+	h.Subscribe("slack")
+	h.Subscribe("discord")
+	h.Out <- Outbound{Channel: "slack"}
+	got := h.QueueDepths()
+	want := []QueueDepth{{"in", 0, 4}, {"out", 1, 4}, {"discord", 0, 4}, {"slack", 0, 4}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("QueueDepths() = %v, want %v", got, want)
+	}
+}
+
+func TestSanitizer(t *testing.T) {
+	s, err := NewSanitizer(map[string][]SanitizeRule{
+		"*":        {{Preset: "role_markers"}, {Preset: "xml_tags"}, {Preset: "special_tokens"}},
+		"whatsapp": {{Pattern: `(?i)\bcolour\b`, Replace: "color"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct{ channel, in, want string }{
+		{"telegram", "Assistant: Hello!\n<thinking>hmm</thinking>Bye.<|im_end|>", "Hello!\nhmmBye."},
+		{"telegram", "Keep <b>bold</b> and a > b", "Keep <b>bold</b> and a > b"},
+		{"telegram", "Nice colour", "Nice colour"},
+		{"whatsapp", "System: Nice colour", "Nice color"},
+		{"telegram", "Models think in `<thinking>` tags:\n```xml\n<thinking>plan</thinking>\nAssistant: hi\n```\n<answer>Done.</answer>", "Models think in `<thinking>` tags:\n```xml\n<thinking>plan</thinking>\nAssistant: hi\n```\nDone."},
+	}
+	for _, tt := range tests {
+		if got := s.Clean(tt.channel, tt.in); got != tt.want {
+			t.Errorf("Clean(%q, %q) = %q, want %q", tt.channel, tt.in, got, tt.want)
+		}
+	}
+
+	if _, err := NewSanitizer(map[string][]SanitizeRule{"*": {{Preset: "nope"}}}); err == nil {
+		t.Error("expected an error for an unknown preset")
+	}
+	if _, err := NewSanitizer(map[string][]SanitizeRule{"*": {{Pattern: "("}}}); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
+
+func TestRouterSanitizes(t *testing.T) {
+	h := NewHub(10)
+	s, _ := NewSanitizer(map[string][]SanitizeRule{"telegram": {{Preset: "role_markers"}}})
+	h.SetSanitizer(s)
+	sub := h.Subscribe("telegram")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h.StartRouter(ctx)
+
+	h.Out <- Outbound{Channel: "telegram", ChatID: "1", Content: "Assistant: done", Type: TypeReport}
+	select {
+	case out := <-sub:
+		if out.Content != DefaultPrefixes[TypeReport]+" done" {
+			t.Fatalf("content = %q", out.Content)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for routed message")
+	}
+}
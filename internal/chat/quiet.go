@@ -0,0 +1,95 @@
+package chat
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// QuietHours are the times of day when chats should not be disturbed. The
+// router holds back the non-urgent messages the agent starts on its own sent
+// to a chat during its quiet hours, and delivers them once they are over (see
+// Hub.SetQuietHours).
+type QuietHours struct {
+	loc   *time.Location
+	def   quietWindow
+	chats map[string]quietWindow // by "channel:chatID"
+}
+
+// quietWindow is a daily span in minutes since midnight; it wraps around
+// midnight when end is before start.
+type quietWindow struct {
+	on         bool
+	start, end int
+}
+
+// NewQuietHours parses quiet hours written as "HH:MM-HH:MM" (e.g.
+// "22:00-07:00"). def applies to every chat without an entry in chats, which
+// is keyed by "channel:chatID"; "off" (or "") disables quiet hours. Times are
+// in timezone, an IANA name, or the local time when it is empty.
+func NewQuietHours(def string, chats map[string]string, timezone string) (*QuietHours, error) {
+	q := &QuietHours{loc: time.Local, chats: make(map[string]quietWindow, len(chats))}
+	if timezone != "" {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			return nil, fmt.Errorf("quiet hours: %w", err)
+		}
+		q.loc = loc
+	}
+	var err error
+	if q.def, err = parseQuietWindow(def); err != nil {
+		return nil, err
+	}
+	for key, s := range chats {
+		if q.chats[key], err = parseQuietWindow(s); err != nil {
+			return nil, fmt.Errorf("%w (chat %s)", err, key)
+		}
+	}
+	return q, nil
+}
+
+func parseQuietWindow(s string) (quietWindow, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.EqualFold(s, "off") {
+		return quietWindow{}, nil
+	}
+	from, to, ok := strings.Cut(s, "-")
+	start, err1 := time.Parse("15:04", strings.TrimSpace(from))
+	end, err2 := time.Parse("15:04", strings.TrimSpace(to))
+	if !ok || err1 != nil || err2 != nil {
+		return quietWindow{}, fmt.Errorf("quiet hours: %q is not HH:MM-HH:MM", s)
+	}
+	return quietWindow{on: true, start: start.Hour()*60 + start.Minute(), end: end.Hour()*60 + end.Minute()}, nil
+}
+
+// Quiet reports whether t falls in the quiet hours of the chat.
+func (q *QuietHours) Quiet(channel, chatID string, t time.Time) bool {
+	if q == nil {
+		return false
+	}
+	w, ok := q.chats[channel+":"+chatID]
+	if !ok {
+		w = q.def
+	}
+	if !w.on || w.start == w.end {
+		return false
+	}
+	t = t.In(q.loc)
+	m := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return m >= w.start && m < w.end
+	}
+	return m >= w.start || m < w.end
+}
+
+// holds reports whether out must wait for the end of its chat's quiet hours.
+// Only messages the agent starts on its own are held, known by their type:
+// reminders and reports (such as briefings). Everything else is the answer
+// to something someone did (replies, chat actions, pins, broadcasts, channel
+// posts) and goes out, as do urgent messages.
+func (q *QuietHours) holds(out Outbound, now time.Time) bool {
+	if out.Urgent || out.Partial || out.Type != TypeReminder && out.Type != TypeReport {
+		return false
+	}
+	return q.Quiet(out.Channel, out.ChatID, now)
+}
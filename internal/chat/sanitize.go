@@ -0,0 +1,95 @@
+package chat
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// SanitizePresets are the ready-made sanitizer patterns a rule can name
+// instead of writing its own.
+var SanitizePresets = map[string]string{
+	// Role markers some models start their reply (or a line of it) with.
+	"role_markers": `(?m)^[ \t]*(?:Assistant|AI|System)[ \t]*:[ \t]*`,
+	// Stray tags of chat templates, tool calls and reasoning.
+	"xml_tags": `(?i)</?(?:assistant|system|user|response|reply|answer|output|thinking|think|function_calls|invoke|parameter|tool_call)\b[^>]*>`,
+	// Special tokens of chat templates, such as <|im_end|>.
+	"special_tokens": `<\|[A-Za-z0-9_]+\|>`,
+}
+
+// SanitizeRule is one rewrite of outbound text: the matches of Pattern (a
+// regular expression), or of the preset named Preset, are replaced with
+// Replace, which may refer to submatches as $1.
+type SanitizeRule struct {
+	Preset  string
+	Pattern string
+	Replace string
+}
+
+// Sanitizer cleans the outbound messages of each channel of what models leak
+// into their replies (see Hub.SetSanitizer).
+type Sanitizer struct {
+	rules map[string][]sanitizeRule // by channel; "*" applies to every channel first
+}
+
+type sanitizeRule struct {
+	re      *regexp.Regexp
+	replace string
+}
+
+// sanitizeCodeRE finds the code of a message, which is left as it is:
+// fenced blocks (up to the end of the text when unclosed) and inline code.
+var sanitizeCodeRE = regexp.MustCompile("(?s)```.*?(?:```|$)|`[^`\n]+`")
+
+// NewSanitizer compiles rules, keyed by channel name or "*" for every
+// channel.
+func NewSanitizer(rules map[string][]SanitizeRule) (*Sanitizer, error) {
+	s := &Sanitizer{rules: make(map[string][]sanitizeRule, len(rules))}
+	for channel, list := range rules {
+		for i, r := range list {
+			pattern := r.Pattern
+			if r.Preset != "" {
+				var ok bool
+				if pattern, ok = SanitizePresets[r.Preset]; !ok {
+					return nil, fmt.Errorf("sanitize %s rule %d: unknown preset %q", channel, i+1, r.Preset)
+				}
+			}
+			if pattern == "" {
+				return nil, fmt.Errorf("sanitize %s rule %d: a preset or a pattern is required", channel, i+1)
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("sanitize %s rule %d: %w", channel, i+1, err)
+			}
+			s.rules[channel] = append(s.rules[channel], sanitizeRule{re: re, replace: r.Replace})
+		}
+	}
+	return s, nil
+}
+
+// Clean applies the rules of every channel, then those of channel, to text
+// outside code, so that a snippet showing <thinking> tags keeps them. A nil
+// Sanitizer returns text as it is.
+func (s *Sanitizer) Clean(channel, text string) string {
+	if s == nil || text == "" || len(s.rules["*"])+len(s.rules[channel]) == 0 {
+		return text
+	}
+	// Code is set aside behind placeholders no rule matches.
+	var codes []string
+	cleaned := sanitizeCodeRE.ReplaceAllStringFunc(text, func(m string) string {
+		codes = append(codes, m)
+		return fmt.Sprintf("\x00%d\x00", len(codes)-1)
+	})
+	for _, key := range []string{"*", channel} {
+		for _, r := range s.rules[key] {
+			cleaned = r.re.ReplaceAllString(cleaned, r.replace)
+		}
+	}
+	for i, c := range codes {
+		cleaned = strings.Replace(cleaned, fmt.Sprintf("\x00%d\x00", i), c, 1)
+	}
+	if cleaned == text {
+		return text
+	}
+	return strings.TrimSpace(cleaned)
+}
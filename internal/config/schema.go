@@ -2,9 +2,203 @@ package config
 
 // Config holds picobot configuration (minimal for v0).
 type Config struct {
-	Agents    AgentsConfig    `json:"agents"`
-	Channels  ChannelsConfig  `json:"channels"`
-	Providers ProvidersConfig `json:"providers"`
+	Agents        AgentsConfig        `json:"agents"`
+	Channels      ChannelsConfig      `json:"channels"`
+	Providers     ProvidersConfig     `json:"providers"`
+	HTTP          HTTPConfig          `json:"http,omitempty"`
+	Watchdog      WatchdogConfig      `json:"watchdog,omitempty"`
+	Hooks         HooksConfig         `json:"hooks,omitempty"`
+	Briefings     []BriefingConfig    `json:"briefings,omitempty"`
+	Credentials   []CredentialConfig  `json:"credentials,omitempty"`
+	Events        EventsConfig        `json:"events,omitempty"`
+	Transcription TranscriptionConfig `json:"transcription,omitempty"`
+	Broadcast     BroadcastConfig     `json:"broadcast,omitempty"`
+	Speech        SpeechConfig        `json:"speech,omitempty"`
+	Onboarding    OnboardingConfig    `json:"onboarding,omitempty"`
+	Access        AccessConfig        `json:"access,omitempty"`
+	Disk          DiskConfig          `json:"disk,omitempty"`
+	CostPreview   CostPreviewConfig   `json:"costPreview,omitempty"`
+	Research      ResearchConfig      `json:"research,omitempty"`
+	Memory        MemoryConfig        `json:"memory,omitempty"`
+}
+
+// MemoryConfig picks how memories are ranked for the prompt: "llm" (the
+// default) asks the model, "bm25" scores keywords, "embeddings" compares
+// meanings through an OpenAI-compatible /embeddings endpoint, and "hybrid"
+// fuses BM25 with embeddings.
+type MemoryConfig struct {
+	Ranker         string `json:"ranker,omitempty"`
+	EmbeddingModel string `json:"embeddingModel,omitempty"` // default text-embedding-3-small
+	APIBase        string `json:"apiBase,omitempty"`        // default providers.openai.apiBase, else OpenAI
+	APIKey         string `json:"apiKey,omitempty"`         // default providers.openai.apiKey
+}
+
+// ResearchConfig bounds /research runs and picks their search engine. Zero
+// values use the defaults: 10 steps, 180 seconds and 60000 tokens.
+type ResearchConfig struct {
+	MaxSteps   int    `json:"maxSteps,omitempty"`   // model calls before the answer is forced
+	TimeoutS   int    `json:"timeoutS,omitempty"`   // time for searching and reading
+	MaxTokens  int    `json:"maxTokens,omitempty"`  // estimated prompt and reply tokens
+	SearxngURL string `json:"searxngURL,omitempty"` // SearXNG instance to search with; empty = DuckDuckGo
+}
+
+// CostPreviewConfig makes the agent ask before running a request predicted
+// to be expensive. With prices, the threshold is ConfirmAboveUSD; without,
+// ConfirmAboveTokens (default 100000).
+type CostPreviewConfig struct {
+	Enabled            bool    `json:"enabled"`
+	InputPerMTok       float64 `json:"inputPerMTok,omitempty"`  // USD per million prompt tokens
+	OutputPerMTok      float64 `json:"outputPerMTok,omitempty"` // USD per million completion tokens
+	ConfirmAboveUSD    float64 `json:"confirmAboveUSD,omitempty"`
+	ConfirmAboveTokens int     `json:"confirmAboveTokens,omitempty"`
+}
+
+// AccessConfig is an allowlist shared by all channels, on top of their own
+// allowFrom. Entries are patterns (see package access); an entry qualified
+// as "channel:pattern" applies to that channel only. Deny wins over any
+// allow entry.
+type AccessConfig struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// OnboardingConfig is the sequence new users go through on their first
+// message in a direct chat: Greeting, then one question per step, the
+// answers saved to the user's profile.
+type OnboardingConfig struct {
+	Enabled  bool             `json:"enabled"`
+	Greeting string           `json:"greeting,omitempty"` // default: a short introduction of the bot
+	Steps    []OnboardingStep `json:"steps,omitempty"`    // default: name, timezone, language
+}
+
+// OnboardingStep asks Question and saves the answer as Field. The
+// "timezone" field must be an IANA timezone name.
+type OnboardingStep struct {
+	Field    string `json:"field"`
+	Question string `json:"question"`
+}
+
+// BroadcastConfig sets how fast /broadcast sends, per channel name.
+type BroadcastConfig struct {
+	Limits map[string]BroadcastLimit `json:"limits,omitempty"`
+}
+
+// BroadcastLimit is the pace of a channel's broadcasts: PerSecond messages
+// overall and one message per PerChatMs to the same chat, a message longer
+// than MaxLength counting as several.
+type BroadcastLimit struct {
+	PerSecond float64 `json:"perSecond"`
+	PerChatMs int     `json:"perChatMs,omitempty"`
+	MaxLength int     `json:"maxLength,omitempty"`
+}
+
+// CredentialConfig is a secret the exec and web tools may use, only in the
+// chats and for the users listed: elsewhere the agent cannot reach it, however
+// it is asked to. Entries of Chats are "channel:chatID", of Users
+// "channel:senderID".
+type CredentialConfig struct {
+	Name   string   `json:"name"`
+	Value  string   `json:"value"`
+	Env    string   `json:"env,omitempty"`    // exec: environment variable set to Value
+	Host   string   `json:"host,omitempty"`   // web: host whose requests get Header
+	Header string   `json:"header,omitempty"` // web: header set to Value, e.g. "Authorization"
+	Chats  []string `json:"chats,omitempty"`
+	Users  []string `json:"users,omitempty"`
+}
+
+// EventsConfig sends what the agent does to external automation.
+type EventsConfig struct {
+	Webhooks []EventWebhook `json:"webhooks,omitempty"`
+}
+
+// EventWebhook receives a JSON POST for each event of the listed kinds:
+// "turn" (a turn answered), "tool" (a tool run) and "error" (a turn failed).
+type EventWebhook struct {
+	URL            string   `json:"url"`
+	Events         []string `json:"events,omitempty"`         // empty = all
+	Secret         string   `json:"secret,omitempty"`         // signs the timestamp and body, see webhooks.SignatureHeader
+	IncludeContent bool     `json:"includeContent,omitempty"` // also send message, reply and tool arguments
+}
+
+// TranscriptionConfig turns voice notes into text through an
+// OpenAI-compatible /audio/transcriptions endpoint.
+type TranscriptionConfig struct {
+	Enabled bool   `json:"enabled"`
+	Model   string `json:"model,omitempty"`   // default whisper-1
+	APIBase string `json:"apiBase,omitempty"` // default providers.openai.apiBase, else OpenAI
+	APIKey  string `json:"apiKey,omitempty"`  // default providers.openai.apiKey
+}
+
+// SpeechConfig reads replies aloud through an OpenAI-compatible
+// /audio/speech endpoint, for channels that can send voice notes.
+type SpeechConfig struct {
+	Enabled bool   `json:"enabled"`
+	Model   string `json:"model,omitempty"`   // default tts-1
+	Voice   string `json:"voice,omitempty"`   // default alloy
+	APIBase string `json:"apiBase,omitempty"` // default providers.openai.apiBase, else OpenAI
+	APIKey  string `json:"apiKey,omitempty"`  // default providers.openai.apiKey
+}
+
+// BriefingConfig is a message composed every day from the listed sections
+// and sent to one chat, e.g. a morning briefing.
+type BriefingConfig struct {
+	Name     string   `json:"name,omitempty"` // heading, default "Good morning!"
+	Time     string   `json:"time"`           // local time of day, "07:30"
+	Channel  string   `json:"channel"`
+	ChatID   string   `json:"chatId"`
+	Sections []string `json:"sections"` // weather, calendar, reminders, todo, dates, rotations, rss, tasks
+	// Settings of the sections that need them.
+	Weather     string   `json:"weather,omitempty"`     // location for wttr.in, e.g. "Lisbon"
+	CalendarURL string   `json:"calendarUrl,omitempty"` // iCalendar (.ics) feed
+	Feeds       []string `json:"feeds,omitempty"`       // RSS or Atom feed URLs
+}
+
+// HooksConfig controls the gateway's webhook endpoint, through which
+// companion apps report events for the agent to act on.
+type HooksConfig struct {
+	Enabled   bool            `json:"enabled"`
+	Listen    string          `json:"listen,omitempty"` // default 127.0.0.1:8787
+	Token     string          `json:"token"`            // required from every caller
+	Geofences []GeofenceHook  `json:"geofences,omitempty"`
+	Transport TransportConfig `json:"transport,omitempty"`
+	// Workspace is the agent workspace, whose templates /hooks/notify
+	// renders; set by the gateway.
+	Workspace string `json:"-"`
+}
+
+// GeofenceHook maps entering or leaving a region to a prompt for the agent,
+// answered in the given chat.
+type GeofenceHook struct {
+	Region  string `json:"region"` // region or zone name, e.g. "home"
+	Event   string `json:"event"`  // "enter" or "leave"
+	Prompt  string `json:"prompt"` // e.g. "Check the to-do list and tell me what to do at home"
+	Channel string `json:"channel"`
+	ChatID  string `json:"chatId"`
+}
+
+// WatchdogConfig controls the gateway's liveness checks of its channels. A
+// channel that goes silent is restarted and reported to the alert chat.
+type WatchdogConfig struct {
+	IntervalS    int    `json:"intervalS,omitempty"`    // how often to check; default 60
+	AlertChannel string `json:"alertChannel,omitempty"` // e.g. "telegram"; empty = log only
+	AlertChatID  string `json:"alertChatId,omitempty"`
+}
+
+// DiskConfig sets the workspace quota and the free disk space the gateway
+// keeps, pruning old workspace files when they are exceeded. Alerts go to
+// the watchdog's alert chat.
+type DiskConfig struct {
+	Enabled        bool     `json:"enabled,omitempty"`
+	IntervalS      int      `json:"intervalS,omitempty"`      // how often to check; default 600
+	MaxWorkspaceMB int      `json:"maxWorkspaceMB,omitempty"` // 0 = no quota
+	MinFreeMB      int      `json:"minFreeMB,omitempty"`      // 0 = free space not checked
+	Prune          []string `json:"prune,omitempty"`          // default ["telemetry", "inbox"]
+	KeepDays       int      `json:"keepDays,omitempty"`       // files younger than this are kept; default 7
+}
+
+// HTTPConfig holds settings shared by all outbound HTTP clients.
+type HTTPConfig struct {
+	UserAgent string `json:"userAgent,omitempty"` // default: picobot/<version> (+homepage)
 }
 
 type AgentsConfig struct {
@@ -14,42 +208,332 @@ type AgentsConfig struct {
 type AgentDefaults struct {
 	Workspace          string  `json:"workspace"`
 	Model              string  `json:"model"`
+	DraftModel         string  `json:"draftModel,omitempty"`
+	ObsidianVault      string  `json:"obsidianVault,omitempty"`
+	ArchiveLinks       bool    `json:"archiveLinks,omitempty"`
 	MaxTokens          int     `json:"maxTokens"`
 	Temperature        float64 `json:"temperature"`
 	MaxToolIterations  int     `json:"maxToolIterations"`
 	HeartbeatIntervalS int     `json:"heartbeatIntervalS"`
 	RequestTimeoutS    int     `json:"requestTimeoutS"`
+	// Seed, when set, makes every turn sample with it; otherwise each turn
+	// draws a seed, which is logged.
+	Seed *int64 `json:"seed,omitempty"`
 }
 
 type ChannelsConfig struct {
-	Telegram TelegramConfig `json:"telegram"`
-	Discord  DiscordConfig  `json:"discord"`
-	WhatsApp WhatsAppConfig `json:"whatsapp"`
+	Telegram   TelegramConfig   `json:"telegram"`
+	Discord    DiscordConfig    `json:"discord"`
+	WhatsApp   WhatsAppConfig   `json:"whatsapp"`
+	Slack      SlackConfig      `json:"slack,omitempty"`
+	Email      EmailConfig      `json:"email,omitempty"`
+	RocketChat RocketChatConfig `json:"rocketchat,omitempty"`
+	LINE       LINEConfig       `json:"line,omitempty"`
+	Web        WebConfig        `json:"web,omitempty"`
+	API        APIConfig        `json:"api,omitempty"`
+	GRPC       GRPCConfig       `json:"grpc,omitempty"`
+	// Prefixes overrides the icons of typed messages (error, reminder,
+	// report) on every channel; an empty icon turns one off.
+	Prefixes map[string]string `json:"prefixes,omitempty"`
+	// QuietHours holds back non-urgent messages that would disturb a chat
+	// at night.
+	QuietHours QuietHoursConfig `json:"quietHours,omitempty"`
+	// Sanitize cleans what models leak into replies (role markers, stray
+	// tags), by channel name; "*" applies to every channel.
+	Sanitize map[string][]SanitizeRule `json:"sanitize,omitempty"`
+}
+
+// SanitizeRule replaces the matches of a regular expression (Pattern, or a
+// named Preset) in outbound messages with Replace.
+type SanitizeRule struct {
+	Preset  string `json:"preset,omitempty"` // role_markers, xml_tags or special_tokens
+	Pattern string `json:"pattern,omitempty"`
+	Replace string `json:"replace,omitempty"`
+}
+
+// QuietHoursConfig sets when chats are not to be disturbed, as
+// "HH:MM-HH:MM" spans (e.g. "22:00-07:00").
+type QuietHoursConfig struct {
+	Default  string            `json:"default,omitempty"`  // every chat without an entry in Chats
+	Chats    map[string]string `json:"chats,omitempty"`    // by "channel:chatID"; "off" disables
+	Timezone string            `json:"timezone,omitempty"` // IANA name; empty = local time
 }
 
 type DiscordConfig struct {
 	Enabled   bool     `json:"enabled"`
 	Token     string   `json:"token"`
 	AllowFrom []string `json:"allowFrom"`
+	// WebhookURL, used without a token, makes the channel send-only: replies
+	// are posted to this channel webhook.
+	WebhookURL string `json:"webhookURL,omitempty"`
+	// Deny is set by the gateway from the shared access block.
+	Deny []string `json:"-"`
 }
 
-type TelegramConfig struct {
+// SlackConfig connects a Slack app over Socket Mode: AppToken (xapp-…)
+// opens the socket, BotToken (xoxb-…) posts the replies.
+type SlackConfig struct {
 	Enabled   bool     `json:"enabled"`
-	Token     string   `json:"token"`
+	AppToken  string   `json:"appToken"`
+	BotToken  string   `json:"botToken"`
 	AllowFrom []string `json:"allowFrom"`
+	// Deny is set by the gateway from the shared access block.
+	Deny []string `json:"-"`
 }
 
-type WhatsAppConfig struct {
+// WebConfig serves a chat page on Listen (default 127.0.0.1:8791). Without
+// a Token, one is made up each time the gateway starts.
+type WebConfig struct {
+	Enabled     bool     `json:"enabled"`
+	Listen      string   `json:"listen,omitempty"`
+	Token       string   `json:"token,omitempty"`
+	Hosts       []string `json:"hosts,omitempty"`       // names the page is reached by, besides localhost and listen's host
+	AllowFrom   []string `json:"allowFrom,omitempty"`   // chat IDs; empty = any browser with the token
+	MaxUploadMB int      `json:"maxUploadMB,omitempty"` // empty = 20
+
+	OAuth     WebOAuthConfig  `json:"oauth,omitempty"`
+	Transport TransportConfig `json:"transport,omitempty"`
+	// Workspace, where uploads are saved, and Deny are set by the gateway.
+	Workspace string   `json:"-"`
+	Deny      []string `json:"-"`
+}
+
+// WebOAuthConfig signs the users of the web chat in with an OAuth2 or
+// OpenID Connect provider instead of the shared token, when ClientID is
+// set. The provider's endpoints are discovered from Issuer, or given as
+// AuthURL, TokenURL and UserInfoURL. Users are known by the IDClaim of
+// their user info, which allowFrom and Admins match.
+type WebOAuthConfig struct {
+	Issuer       string   `json:"issuer,omitempty"`
+	AuthURL      string   `json:"authURL,omitempty"`
+	TokenURL     string   `json:"tokenURL,omitempty"`
+	UserInfoURL  string   `json:"userInfoURL,omitempty"`
+	ClientID     string   `json:"clientID,omitempty"`
+	ClientSecret string   `json:"clientSecret,omitempty"`
+	RedirectURL  string   `json:"redirectURL,omitempty"` // https://<host>/auth/callback
+	Scopes       []string `json:"scopes,omitempty"`      // empty = openid, email, profile
+	IDClaim      string   `json:"idClaim,omitempty"`     // empty = email
+	Admins       []string `json:"admins,omitempty"`      // users who may use the admin commands
+}
+
+// APIConfig serves a REST API on Listen (default 127.0.0.1:8792) through
+// which other services talk to the agent. Every caller needs one of Tokens.
+type APIConfig struct {
+	Enabled  bool       `json:"enabled"`
+	Listen   string     `json:"listen,omitempty"`
+	Tokens   []APIToken `json:"tokens"`
+	TimeoutS int        `json:"timeoutS,omitempty"` // wait for a reply; empty = 120
+	// CallbackSecret, when set, signs the callbacks as events.webhooks[].secret
+	// signs events.
+	CallbackSecret string `json:"callbackSecret,omitempty"`
+	// SigningSecret, when set, signs the responses and events the same way,
+	// and requests and WebSocket frames must come signed with it.
+	SigningSecret string `json:"signingSecret,omitempty"`
+	// AllowPrivateCallbacks lets callback URLs reach loopback, private and
+	// link-local addresses, which are refused by default.
+	AllowPrivateCallbacks bool `json:"allowPrivateCallbacks,omitempty"`
+
+	Transport TransportConfig `json:"transport,omitempty"`
+}
+
+// TransportConfig guards one of the gateway's listeners. AllowCIDRs, when
+// set, closes connections from other addresses. TLSCert and TLSKey (PEM
+// files) serve TLS; with ClientCA, clients must also present a certificate
+// it signed (mutual TLS).
+type TransportConfig struct {
+	AllowCIDRs []string `json:"allowCIDRs,omitempty"` // e.g. "10.0.0.0/8", "192.0.2.7"
+	TLSCert    string   `json:"tlsCert,omitempty"`
+	TLSKey     string   `json:"tlsKey,omitempty"`
+	ClientCA   string   `json:"clientCA,omitempty"`
+}
+
+// APIToken is a token of the REST API. Name identifies the caller: it is
+// the sender of its messages, and keeps its chats apart from other callers'.
+type APIToken struct {
+	Name  string `json:"name"`
+	Token string `json:"token"`
+}
+
+// GRPCConfig serves the gRPC channel (see api/picobotpb) on Listen
+// (default 127.0.0.1:8793), through which other services converse with the
+// agent over a bidirectional stream. Every caller needs one of Tokens,
+// which work as the REST API's.
+type GRPCConfig struct {
+	Enabled bool       `json:"enabled"`
+	Listen  string     `json:"listen,omitempty"`
+	Tokens  []APIToken `json:"tokens"`
+	// SigningSecret, when set, signs the events, and messages must come
+	// signed with it (see picobotpb.Signed).
+	SigningSecret string          `json:"signingSecret,omitempty"`
+	Transport     TransportConfig `json:"transport,omitempty"`
+}
+
+// LINEConfig runs a LINE Messaging API bot, whose webhook is served on
+// Listen (default 127.0.0.1:8790) at /line/webhook.
+type LINEConfig struct {
+	Enabled            bool     `json:"enabled"`
+	ChannelSecret      string   `json:"channelSecret"`
+	ChannelAccessToken string   `json:"channelAccessToken"`
+	Listen             string   `json:"listen,omitempty"`
+	AllowFrom          []string `json:"allowFrom"`
+
+	Transport TransportConfig `json:"transport,omitempty"`
+	// Deny is set by the gateway from the shared access block.
+	Deny []string `json:"-"`
+}
+
+// RocketChatConfig logs in to the Rocket.Chat server at ServerURL as a bot
+// user: with a personal access token (UserID and AuthToken) or, without
+// one, Username and Password.
+type RocketChatConfig struct {
 	Enabled   bool     `json:"enabled"`
-	DBPath    string   `json:"dbPath"`
+	ServerURL string   `json:"serverURL"`
+	UserID    string   `json:"userID,omitempty"`
+	AuthToken string   `json:"authToken,omitempty"`
+	Username  string   `json:"username,omitempty"`
+	Password  string   `json:"password,omitempty"`
 	AllowFrom []string `json:"allowFrom"`
+	StatePath string   `json:"statePath,omitempty"` // where the followed threads are kept
+	// Deny is set by the gateway from the shared access block.
+	Deny []string `json:"-"`
+}
+
+// EmailConfig polls an IMAP mailbox (IMAPServer, host:993) for new mail
+// and sends the replies through SMTPServer (host:465 or host:587), both
+// logged in as Username.
+type EmailConfig struct {
+	Enabled         bool     `json:"enabled"`
+	IMAPServer      string   `json:"imapServer"`
+	SMTPServer      string   `json:"smtpServer"`
+	Username        string   `json:"username"`
+	Password        string   `json:"password"`
+	From            string   `json:"from,omitempty"`            // address replies are sent from; empty = Username
+	Mailbox         string   `json:"mailbox,omitempty"`         // empty = INBOX
+	PollIntervalS   int      `json:"pollIntervalS,omitempty"`   // empty = 60
+	MaxAttachmentMB int      `json:"maxAttachmentMB,omitempty"` // larger attachments are not saved; empty = 20
+	AllowFrom       []string `json:"allowFrom"`                 // sender addresses
+	// AuthServID is the authserv-id of the receiving server's
+	// Authentication-Results header (e.g. "mx.google.com"); empty = the
+	// topmost header. Secret, when found in an email's subject or text, lets
+	// it in without a DKIM or DMARC pass.
+	AuthServID string `json:"authServId,omitempty"`
+	Secret     string `json:"secret,omitempty"`
+	// Workspace, where attachments are saved, and Deny are set by the
+	// gateway.
+	Workspace string   `json:"-"`
+	Deny      []string `json:"-"`
+}
+
+type TelegramConfig struct {
+	Enabled    bool              `json:"enabled"`
+	Token      string            `json:"token"`
+	AllowFrom  []string          `json:"allowFrom"`
+	AllowChats []string          `json:"allowChats,omitempty"` // chat IDs the bot answers in; empty = any chat
+	Admins     []string          `json:"admins,omitempty"`     // user IDs allowed to use the admin commands
+	StatePath  string            `json:"statePath,omitempty"`  // where /allow and /deny changes are kept
+	QueuePath  string            `json:"queuePath,omitempty"`  // journal of replies not sent yet; empty = in memory only
+	Proxy      string            `json:"proxy,omitempty"`      // http(s):// or socks5:// URL, or "direct"; empty = environment
+	Polling    TelegramPolling   `json:"polling,omitempty"`
+	Sending    TelegramSending   `json:"sending,omitempty"`
+	Inbox      TelegramInbox     `json:"inbox,omitempty"`
+	CoalesceMs int               `json:"coalesceMs,omitempty"` // merge text replies sent within this window; 0 = off
+	Reactions  TelegramReactions `json:"reactions,omitempty"`
+	GroupMode  string            `json:"groupMode,omitempty"`  // "mention" (default) or "all"
+	StickerSet string            `json:"stickerSet,omitempty"` // sticker set the agent may reply with
+	ParseMode  string            `json:"parseMode,omitempty"`  // "markdownv2" (default), "html" or "entities"
+	PublishTo  []string          `json:"publishTo,omitempty"`  // broadcast channels (@username or ID) admins may post to
+	// Deny is set by the gateway from the shared access block.
+	Deny []string `json:"-"`
+}
+
+// TelegramPolling tunes the getUpdates long-poll and how it backs off while
+// Telegram is unreachable. Zero values use the defaults.
+type TelegramPolling struct {
+	TimeoutS      int     `json:"timeoutS,omitempty"`      // long-poll timeout; default 30
+	BackoffMinMs  int     `json:"backoffMinMs,omitempty"`  // delay after the first failure; default 1000
+	BackoffMaxMs  int     `json:"backoffMaxMs,omitempty"`  // cap on the delay; default 60000
+	BackoffFactor float64 `json:"backoffFactor,omitempty"` // growth per consecutive failure; default 2
+	Jitter        float64 `json:"jitter,omitempty"`        // random ± fraction of each delay; default 0.2
+}
+
+// TelegramSending bounds how sends failing with network errors, 5xx
+// responses or rate limits are retried. Zero values use the defaults.
+type TelegramSending struct {
+	MaxAttempts    int    `json:"maxAttempts,omitempty"`    // tries per request; default 6
+	BackoffMinMs   int    `json:"backoffMinMs,omitempty"`   // delay after the first failure; default 1000
+	BackoffMaxMs   int    `json:"backoffMaxMs,omitempty"`   // cap on the delay; default 60000
+	DeadLetterPath string `json:"deadLetterPath,omitempty"` // where messages that could not be sent are logged
+}
+
+// TelegramInbox saves documents sent to the bot in the workspace, under
+// inbox/telegram/<chat>/, where the agent's file tools can open them.
+type TelegramInbox struct {
+	Enabled bool `json:"enabled"`
+	MaxMB   int  `json:"maxMB,omitempty"` // larger documents are not saved; default and most 20
+	// Workspace is the agent workspace, set by the gateway.
+	Workspace string `json:"-"`
+}
+
+// TelegramReactions acknowledges messages with reactions: Working as soon as
+// the agent starts on a message, replaced by Done once its reply is sent.
+type TelegramReactions struct {
+	Enabled bool   `json:"enabled"`
+	Working string `json:"working,omitempty"` // default 👀
+	Done    string `json:"done,omitempty"`    // default 👍
+}
+
+type WhatsAppConfig struct {
+	Enabled   bool          `json:"enabled"`
+	DBPath    string        `json:"dbPath"`
+	AllowFrom []string      `json:"allowFrom"`
+	Inbox     WhatsAppInbox `json:"inbox,omitempty"`
+	// AllowGroups lists the groups the bot takes part in, by JID or number.
+	// In them it answers messages that mention it, reply to it, or start
+	// with GroupTrigger; allowFrom does not apply.
+	AllowGroups  []string `json:"allowGroups,omitempty"`
+	GroupTrigger string   `json:"groupTrigger,omitempty"` // e.g. "!bot"
+	Typing       *bool    `json:"typing,omitempty"`       // show "typing…" while replying; default true
+	ReadReceipts string   `json:"readReceipts,omitempty"` // "received" (default), "replied" or "off"
+	VoiceReplies string   `json:"voiceReplies,omitempty"` // "off" (default), "voice" or "always"; needs speech
+	Buttons      string   `json:"buttons,omitempty"`      // "text" (default) or "interactive"
+	// Pairing is where pairing QR codes are sent when the account needs to
+	// be linked (again), e.g. the admin's Telegram chat.
+	Pairing WhatsAppPairing `json:"pairing,omitempty"`
+	// Deny is set by the gateway from the shared access block.
+	Deny []string `json:"-"`
+}
+
+// WhatsAppPairing names the chat, on another channel, that receives the
+// WhatsApp pairing QR codes as images.
+type WhatsAppPairing struct {
+	Channel string `json:"channel"`
+	ChatID  string `json:"chatId"`
+}
+
+// WhatsAppInbox saves the images and voice notes sent to the bot in the
+// workspace, under inbox/whatsapp/<chat>/, where the agent's file tools can
+// open them. Voice notes are also transcribed when transcription is on.
+type WhatsAppInbox struct {
+	Enabled bool `json:"enabled"`
+	// Workspace is the agent workspace, set by the gateway.
+	Workspace string `json:"-"`
 }
 
 type ProvidersConfig struct {
-	OpenAI *ProviderConfig `json:"openai,omitempty"`
+	OpenAI *ProviderConfig     `json:"openai,omitempty"`
+	Stub   *StubProviderConfig `json:"stub,omitempty"`
+}
+
+// StubProviderConfig configures the offline stub provider used when no real
+// provider is configured.
+type StubProviderConfig struct {
+	Scenarios string `json:"scenarios,omitempty"` // path to a YAML scenario file
 }
 
 type ProviderConfig struct {
-	APIKey  string `json:"apiKey"`
-	APIBase string `json:"apiBase"`
+	APIKey        string   `json:"apiKey"`
+	APIKeys       []string `json:"apiKeys,omitempty"` // fallback keys, tried in order when apiKey is rejected
+	APIBase       string   `json:"apiBase"`
+	PromptCaching bool     `json:"promptCaching,omitempty"`
+	Stop          []string `json:"stop,omitempty"` // stop sequences sent with every request (at most 4 for OpenAI)
 }
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// KeyringPrefix marks a secret kept in the operating system's keyring
+// instead of the config file: "keyring:<name>" is the secret stored as name
+// by "picobot keyring set", "keyring:<service>/<account>" any entry of the
+// keyring.
+const KeyringPrefix = "keyring:"
+
+// ParseKeyringRef splits a keyring reference into the service and account
+// to look up; defaultService is used when the reference names no service.
+// ok is false when value is not a keyring reference.
+func ParseKeyringRef(value, defaultService string) (service, account string, ok bool) {
+	ref, found := strings.CutPrefix(value, KeyringPrefix)
+	if !found {
+		return "", "", false
+	}
+	if s, a, found := strings.Cut(ref, "/"); found {
+		return s, a, true
+	}
+	return defaultService, ref, true
+}
+
+// secretField is a config field that may hold a secret, with its JSON path
+// for error messages.
+type secretField struct {
+	path  string
+	value *string
+}
+
+// secrets lists the fields of c that hold secrets.
+func (c *Config) secrets() []secretField {
+	fields := []secretField{
+		{"channels.telegram.token", &c.Channels.Telegram.Token},
+		{"channels.discord.token", &c.Channels.Discord.Token},
+		{"channels.discord.webhookURL", &c.Channels.Discord.WebhookURL},
+		{"channels.slack.appToken", &c.Channels.Slack.AppToken},
+		{"channels.slack.botToken", &c.Channels.Slack.BotToken},
+		{"channels.email.password", &c.Channels.Email.Password},
+		{"channels.email.secret", &c.Channels.Email.Secret},
+		{"channels.rocketchat.authToken", &c.Channels.RocketChat.AuthToken},
+		{"channels.line.channelSecret", &c.Channels.LINE.ChannelSecret},
+		{"channels.line.channelAccessToken", &c.Channels.LINE.ChannelAccessToken},
+		{"channels.web.token", &c.Channels.Web.Token},
+		{"channels.web.oauth.clientSecret", &c.Channels.Web.OAuth.ClientSecret},
+		{"channels.api.callbackSecret", &c.Channels.API.CallbackSecret},
+		{"channels.api.signingSecret", &c.Channels.API.SigningSecret},
+		{"channels.grpc.signingSecret", &c.Channels.GRPC.SigningSecret},
+		{"channels.rocketchat.password", &c.Channels.RocketChat.Password},
+		{"hooks.token", &c.Hooks.Token},
+		{"transcription.apiKey", &c.Transcription.APIKey},
+		{"speech.apiKey", &c.Speech.APIKey},
+		{"memory.apiKey", &c.Memory.APIKey},
+	}
+	if p := c.Providers.OpenAI; p != nil {
+		fields = append(fields, secretField{"providers.openai.apiKey", &p.APIKey})
+		for i := range p.APIKeys {
+			fields = append(fields, secretField{"providers.openai.apiKeys[" + strconv.Itoa(i) + "]", &p.APIKeys[i]})
+		}
+	}
+	for i := range c.Credentials {
+		fields = append(fields, secretField{"credentials[" + strconv.Itoa(i) + "].value", &c.Credentials[i].Value})
+	}
+	for i := range c.Channels.API.Tokens {
+		fields = append(fields, secretField{"channels.api.tokens[" + strconv.Itoa(i) + "].token", &c.Channels.API.Tokens[i].Token})
+	}
+	for i := range c.Channels.GRPC.Tokens {
+		fields = append(fields, secretField{"channels.grpc.tokens[" + strconv.Itoa(i) + "].token", &c.Channels.GRPC.Tokens[i].Token})
+	}
+	for i := range c.Events.Webhooks {
+		fields = append(fields, secretField{"events.webhooks[" + strconv.Itoa(i) + "].secret", &c.Events.Webhooks[i].Secret})
+	}
+	return fields
+}
+
+// ResolveSecrets replaces the keyring references among the secrets of c
+// with the secrets themselves, looked up with get (keyring.Get, in
+// practice). A secret that cannot be looked up is left empty, and reported
+// in the error, so the rest of the config remains usable.
+func ResolveSecrets(c *Config, get func(service, account string) (string, error)) error {
+	if p := c.Providers.OpenAI; p != nil {
+		// Resolve into a copy: the pointer may be shared with another Config.
+		cp := *p
+		cp.APIKeys = append([]string(nil), p.APIKeys...)
+		c.Providers.OpenAI = &cp
+	}
+	var errs []error
+	for _, f := range c.secrets() {
+		service, account, ok := ParseKeyringRef(*f.value, "picobot")
+		if !ok {
+			continue
+		}
+		secret, err := get(service, account)
+		if err != nil {
+			*f.value = ""
+			errs = append(errs, fmt.Errorf("%s: %s/%s: %w", f.path, service, account, err))
+			continue
+		}
+		*f.value = secret
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestResolveSecrets(t *testing.T) {
+	cfg := Config{
+		Channels:    ChannelsConfig{Telegram: TelegramConfig{Token: "keyring:telegram"}},
+		Providers:   ProvidersConfig{OpenAI: &ProviderConfig{APIKey: "sk-plain", APIKeys: []string{"keyring:work/openai"}}},
+		Credentials: []CredentialConfig{{Name: "gh", Value: "keyring:missing"}},
+	}
+	shared := cfg.Providers.OpenAI
+	get := func(service, account string) (string, error) {
+		switch service + "/" + account {
+		case "picobot/telegram":
+			return "123:abc", nil
+		case "work/openai":
+			return "sk-work", nil
+		}
+		return "", errors.New("not found")
+	}
+
+	err := ResolveSecrets(&cfg, get)
+	if err == nil || !strings.Contains(err.Error(), "credentials[0].value: picobot/missing") {
+		t.Fatalf("err = %v, want the missing credential reported", err)
+	}
+	if cfg.Channels.Telegram.Token != "123:abc" || cfg.Providers.OpenAI.APIKey != "sk-plain" || cfg.Providers.OpenAI.APIKeys[0] != "sk-work" {
+		t.Errorf("secrets not resolved: %+v %+v", cfg.Channels.Telegram, cfg.Providers.OpenAI)
+	}
+	if cfg.Credentials[0].Value != "" {
+		t.Errorf("unresolved secret kept as %q", cfg.Credentials[0].Value)
+	}
+	if shared.APIKeys[0] != "keyring:work/openai" {
+		t.Error("resolved into the shared provider config")
+	}
+}
@@ -17,7 +17,16 @@ type Job struct {
 	ChatID    string // originating chat ID
 	Recurring bool   // if true, re-schedule after firing
 	Interval  time.Duration
-	fired     bool
+	// Template, when set, names the workspace template the job's
+	// notification is rendered from, with Vars, instead of Message being
+	// relayed by the agent.
+	Template string
+	Vars     map[string]interface{}
+	// Post, when set, marks a post published as is to the broadcast
+	// channel ChatID: Message is its text and Media its files.
+	Post  bool
+	Media []string
+	fired bool
 }
 
 // FireCallback is called when a job fires. The scheduler passes the job details.
@@ -78,6 +87,51 @@ func (s *Scheduler) AddRecurring(name, message string, interval time.Duration, c
 	return id
 }
 
+// AddTemplated schedules a job whose notification is rendered from template
+// with vars. It fires after delay, then every interval if interval is not
+// zero. Returns the job ID.
+func (s *Scheduler) AddTemplated(name, template string, vars map[string]interface{}, delay, interval time.Duration, channel, chatID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	id := fmt.Sprintf("job-%d", s.nextID)
+	s.jobs[id] = &Job{
+		ID:        id,
+		Name:      name,
+		Message:   "template " + template,
+		FireAt:    time.Now().Add(delay),
+		Channel:   channel,
+		ChatID:    chatID,
+		Recurring: interval > 0,
+		Interval:  interval,
+		Template:  template,
+		Vars:      vars,
+	}
+	log.Printf("cron: scheduled templated job %q (%s) to fire in %v", name, id, delay)
+	return id
+}
+
+// AddPost schedules a post of text and media to the broadcast channel chatID
+// of channel, published after delay. Returns the job ID.
+func (s *Scheduler) AddPost(name, text string, media []string, delay time.Duration, channel, chatID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	id := fmt.Sprintf("job-%d", s.nextID)
+	s.jobs[id] = &Job{
+		ID:      id,
+		Name:    name,
+		Message: text,
+		FireAt:  time.Now().Add(delay),
+		Channel: channel,
+		ChatID:  chatID,
+		Post:    true,
+		Media:   media,
+	}
+	log.Printf("cron: scheduled post %q (%s) to fire in %v", name, id, delay)
+	return id
+}
+
 // Cancel removes a job by ID. Returns true if found.
 func (s *Scheduler) Cancel(id string) bool {
 	s.mu.Lock()
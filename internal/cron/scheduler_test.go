@@ -88,3 +88,25 @@ func TestSchedulerDoesNotFireCancelled(t *testing.T) {
 		t.Errorf("expected 0 fired jobs after cancel, got %d", len(fired))
 	}
 }
+
+func TestSchedulerFiresPost(t *testing.T) {
+	var fired []Job
+	s := NewScheduler(func(job Job) { fired = append(fired, job) })
+	s.AddPost("post to @news", "Release 2.0 is out", []string{"/ws/banner.png"}, time.Minute, "telegram", "@news")
+
+	s.tick(time.Now())
+	if len(fired) != 0 {
+		t.Fatal("post fired early")
+	}
+	s.tick(time.Now().Add(2 * time.Minute))
+	if len(fired) != 1 {
+		t.Fatalf("expected 1 fired post, got %d", len(fired))
+	}
+	j := fired[0]
+	if !j.Post || j.ChatID != "@news" || j.Message != "Release 2.0 is out" || len(j.Media) != 1 || j.Recurring {
+		t.Fatalf("unexpected job: %+v", j)
+	}
+	if len(s.List()) != 0 {
+		t.Error("expected the post to be removed once fired")
+	}
+}
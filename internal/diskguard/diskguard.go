@@ -0,0 +1,247 @@
+// Package diskguard keeps the workspace from silently filling a small disk.
+//
+// The guard periodically measures the workspace and the free space of the
+// disk it lives on. When the workspace outgrows its quota, or the disk runs
+// low, it deletes the oldest files of the prunable workspace directories
+// (telemetry, the inbox, ...) until the limits are met again, and alerts the
+// admin with what it removed, or that pruning was not enough.
+package diskguard
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Dirs maps the names accepted in Config.Prune to the workspace directories
+// they stand for.
+var Dirs = map[string]string{
+	"telemetry": "telemetry", // prompt statistics and traces of failed turns
+	"inbox":     "inbox",     // media received by the channels
+	"links":     "links",     // archived link previews
+	"archive":   "archive",   // archived conversation history
+}
+
+// DefaultPrune is what is pruned when Config.Prune is empty: files that can
+// be lost without losing memories or conversations.
+var DefaultPrune = []string{"telemetry", "inbox"}
+
+// Config sets the limits the guard enforces.
+type Config struct {
+	Workspace    string
+	MaxWorkspace int64         // bytes; 0 = no quota
+	MinFree      int64         // bytes free on the workspace's disk; 0 = not checked
+	Prune        []string      // keys of Dirs, pruned together oldest file first
+	KeepFor      time.Duration // files younger than this are never pruned
+}
+
+// Usage is a measurement of the workspace and its disk.
+type Usage struct {
+	Workspace int64 // bytes used by the workspace
+	Free      int64 // bytes available on its disk, -1 if unknown
+}
+
+// Guard enforces a Config. The zero value is not usable; use New.
+type Guard struct {
+	cfg   Config
+	alert func(msg string)
+	now   func() time.Time
+	free  func(path string) (int64, error)
+
+	mu   sync.Mutex
+	over bool // the limits were still exceeded after the last check
+}
+
+// New creates a guard for cfg that reports to alert (which may be nil to only
+// log). It returns an error if cfg names an unknown directory to prune.
+func New(cfg Config, alert func(msg string)) (*Guard, error) {
+	if len(cfg.Prune) == 0 {
+		cfg.Prune = DefaultPrune
+	}
+	for _, name := range cfg.Prune {
+		if _, ok := Dirs[name]; !ok {
+			return nil, fmt.Errorf("diskguard: unknown directory %q to prune", name)
+		}
+	}
+	return &Guard{cfg: cfg, alert: alert, now: time.Now, free: freeSpace}, nil
+}
+
+// Measure returns the current usage of the workspace and its disk.
+func (g *Guard) Measure() Usage {
+	u := Usage{Workspace: dirSize(g.cfg.Workspace), Free: -1}
+	if free, err := g.free(g.cfg.Workspace); err == nil {
+		u.Free = free
+	}
+	return u
+}
+
+// Measure returns the current usage of the workspace at path and its disk,
+// for callers without a guard.
+func Measure(workspace string) Usage {
+	u := Usage{Workspace: dirSize(workspace), Free: -1}
+	if free, err := freeSpace(workspace); err == nil {
+		u.Free = free
+	}
+	return u
+}
+
+// String renders u as "workspace 12.0 MiB, 3.1 GiB free".
+func (u Usage) String() string {
+	return fmt.Sprintf("workspace %s, %s free", formatBytes(u.Workspace), formatFree(u.Free))
+}
+
+// excess returns how many bytes must go for u to meet the limits.
+func (g *Guard) excess(u Usage) int64 {
+	var need int64
+	if g.cfg.MaxWorkspace > 0 && u.Workspace > g.cfg.MaxWorkspace {
+		need = u.Workspace - g.cfg.MaxWorkspace
+	}
+	if g.cfg.MinFree > 0 && u.Free >= 0 && u.Free < g.cfg.MinFree {
+		need = max(need, g.cfg.MinFree-u.Free)
+	}
+	return need
+}
+
+// Check measures the workspace and, when a limit is exceeded, prunes it and
+// alerts. Failing to get back under the limits is alerted about only once
+// until the limits are met again.
+func (g *Guard) Check() {
+	u := g.Measure()
+	need := g.excess(u)
+	if need == 0 {
+		g.mu.Lock()
+		recovered := g.over
+		g.over = false
+		g.mu.Unlock()
+		if recovered {
+			g.report(fmt.Sprintf("diskguard: back under the limits (workspace %s, %s free)", formatBytes(u.Workspace), formatFree(u.Free)))
+		}
+		return
+	}
+
+	files, freed := g.prune(need)
+	if files > 0 {
+		g.report(fmt.Sprintf("🧹 Disk limits exceeded (workspace %s, %s free): deleted %d old files from %s, freeing %s.",
+			formatBytes(u.Workspace), formatFree(u.Free), files, strings.Join(g.cfg.Prune, ", "), formatBytes(freed)))
+	}
+	if freed >= need {
+		return
+	}
+	u = g.Measure()
+	g.mu.Lock()
+	first := !g.over
+	g.over = true
+	g.mu.Unlock()
+	if first {
+		g.report(fmt.Sprintf("⚠️ Disk limits still exceeded after pruning (workspace %s, %s free); nothing older than %s is left to delete.",
+			formatBytes(u.Workspace), formatFree(u.Free), g.cfg.KeepFor))
+	}
+}
+
+type candidate struct {
+	path string
+	size int64
+	mod  time.Time
+}
+
+// prune deletes the oldest prunable files until need bytes are freed, and
+// returns how many files it deleted and the bytes freed.
+func (g *Guard) prune(need int64) (files int, freed int64) {
+	cutoff := g.now().Add(-g.cfg.KeepFor)
+	var cands []candidate
+	for _, name := range g.cfg.Prune {
+		root := filepath.Join(g.cfg.Workspace, Dirs[name])
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil || !info.Mode().IsRegular() || !info.ModTime().Before(cutoff) {
+				return nil
+			}
+			cands = append(cands, candidate{path, info.Size(), info.ModTime()})
+			return nil
+		})
+	}
+	sort.Slice(cands, func(i, j int) bool { return cands[i].mod.Before(cands[j].mod) })
+	for _, c := range cands {
+		if freed >= need {
+			break
+		}
+		if err := os.Remove(c.path); err != nil {
+			log.Printf("diskguard: %v", err)
+			continue
+		}
+		files++
+		freed += c.size
+	}
+	return files, freed
+}
+
+// Start runs Check every interval until ctx is done.
+func (g *Guard) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		log.Printf("diskguard: started (every %v)", interval)
+		g.Check()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				g.Check()
+			}
+		}
+	}()
+}
+
+func (g *Guard) report(msg string) {
+	log.Print(msg)
+	if g.alert != nil {
+		g.alert(msg)
+	}
+}
+
+// dirSize returns the total size of the regular files under root.
+func dirSize(root string) int64 {
+	var size int64
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// formatBytes renders n in the largest unit that keeps it at least 1.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func formatFree(n int64) string {
+	if n < 0 {
+		return "unknown"
+	}
+	return formatBytes(n)
+}
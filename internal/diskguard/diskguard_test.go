@@ -0,0 +1,92 @@
+package diskguard
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile creates a file of size bytes under the workspace, last modified
+// age ago.
+func writeFile(t *testing.T, ws, name string, size int, age time.Duration) string {
+	t.Helper()
+	path := filepath.Join(ws, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, make([]byte, size), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mod := time.Now().Add(-age)
+	if err := os.Chtimes(path, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestGuardPrunesOldestFilesOverQuota(t *testing.T) {
+	ws := t.TempDir()
+	oldest := writeFile(t, ws, "telemetry/traces-2026-01-01.jsonl", 400, 30*24*time.Hour)
+	older := writeFile(t, ws, "inbox/whatsapp/123/a.jpg", 400, 20*24*time.Hour)
+	recent := writeFile(t, ws, "telemetry/traces-2026-10-16.jsonl", 400, time.Hour)
+	memory := writeFile(t, ws, "memory/MEMORY.md", 400, 60*24*time.Hour)
+
+	var alerts []string
+	g, err := New(Config{Workspace: ws, MaxWorkspace: 1200, KeepFor: 7 * 24 * time.Hour}, func(msg string) { alerts = append(alerts, msg) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.free = func(string) (int64, error) { return 1 << 30, nil }
+
+	g.Check()
+	if exists(oldest) || !exists(older) || !exists(recent) || !exists(memory) {
+		t.Fatalf("expected only the oldest prunable file deleted: oldest=%v older=%v recent=%v memory=%v",
+			exists(oldest), exists(older), exists(recent), exists(memory))
+	}
+	if len(alerts) != 1 || !strings.Contains(alerts[0], "deleted 1 old files") {
+		t.Fatalf("alerts = %v", alerts)
+	}
+
+	g.Check() // under the quota now
+	if len(alerts) != 1 {
+		t.Fatalf("alerted while under the limits: %v", alerts)
+	}
+}
+
+func TestGuardAlertsOnceWhenPruningIsNotEnough(t *testing.T) {
+	ws := t.TempDir()
+	writeFile(t, ws, "telemetry/prompt-2026-10-16.jsonl", 100, time.Hour)
+
+	var alerts []string
+	g, err := New(Config{Workspace: ws, MinFree: 1000, KeepFor: 24 * time.Hour}, func(msg string) { alerts = append(alerts, msg) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	free := int64(10)
+	g.free = func(string) (int64, error) { return free, nil }
+
+	g.Check()
+	g.Check()
+	if len(alerts) != 1 || !strings.Contains(alerts[0], "still exceeded") {
+		t.Fatalf("expected a single alert, got %v", alerts)
+	}
+
+	free = 5000
+	g.Check()
+	if len(alerts) != 2 || !strings.Contains(alerts[1], "back under the limits") {
+		t.Fatalf("expected a recovery alert, got %v", alerts)
+	}
+}
+
+func TestNewRejectsUnknownDirectory(t *testing.T) {
+	if _, err := New(Config{Prune: []string{"memory"}}, nil); err == nil {
+		t.Fatal("expected an error for a directory that may not be pruned")
+	}
+}
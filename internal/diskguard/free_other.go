@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package diskguard
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// freeSpace is not implemented here: without it the guard only checks the
+// size of the workspace.
+func freeSpace(path string) (int64, error) {
+	return 0, fmt.Errorf("diskguard: free space is unsupported on %s", runtime.GOOS)
+}
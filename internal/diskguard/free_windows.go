@@ -0,0 +1,17 @@
+package diskguard
+
+import "golang.org/x/sys/windows"
+
+// freeSpace returns the bytes available to the current user on the disk
+// holding path.
+func freeSpace(path string) (int64, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var avail uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &avail, nil, nil); err != nil {
+		return 0, err
+	}
+	return int64(avail), nil
+}
@@ -0,0 +1,217 @@
+// Package hooks serves the gateway's webhook endpoint, through which
+// companion apps (OwnTracks, Home Assistant) report events that the agent
+// acts on, such as the user arriving home, and scripts send notifications.
+package hooks
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/netguard"
+	"github.com/local/picobot/internal/templates"
+)
+
+// DefaultListen is the address the hooks endpoint listens on by default:
+// local only, to be exposed through a reverse proxy or a VPN.
+const DefaultListen = "127.0.0.1:8787"
+
+// maxBody caps the size of a webhook payload.
+const maxBody = 64 << 10
+
+// Server turns webhooks into inbound messages for the agent.
+type Server struct {
+	hub       *chat.Hub
+	token     string
+	geofences []config.GeofenceHook
+	workspace string
+}
+
+// NewServer creates a Server for cfg.
+func NewServer(hub *chat.Hub, cfg config.HooksConfig) *Server {
+	workspace := cfg.Workspace
+	if workspace == "" {
+		workspace = "."
+	}
+	return &Server{hub: hub, token: cfg.Token, geofences: cfg.Geofences, workspace: workspace}
+}
+
+// Handler returns the endpoint's routes:
+//
+//	POST /hooks/location  region enter/leave events (OwnTracks "transition"
+//	                      messages, or {"event", "region", "person"} JSON)
+//	POST /hooks/notify    a notification rendered from a workspace template,
+//	                      {"template", "vars", "channel", "chatId"}
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /hooks/location", s.authorized(s.handleLocation))
+	mux.HandleFunc("POST /hooks/notify", s.authorized(s.handleNotify))
+	return mux
+}
+
+// StartHooks serves the hooks endpoint on cfg.Listen until ctx is done.
+func StartHooks(ctx context.Context, hub *chat.Hub, cfg config.HooksConfig) error {
+	if cfg.Token == "" {
+		return fmt.Errorf("hooks: a token is required")
+	}
+	addr := cfg.Listen
+	if addr == "" {
+		addr = DefaultListen
+	}
+	ln, err := netguard.Listen("hooks", addr, cfg.Transport)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: NewServer(hub, cfg).Handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+	go func() {
+		log.Printf("hooks: listening on %s", addr)
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("hooks: %v", err)
+		}
+	}()
+	return nil
+}
+
+// authorized checks the token, given as a bearer token, as the basic-auth
+// password (OwnTracks) or as the "token" query parameter.
+func (s *Server) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if t, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			token = t
+		} else if _, p, ok := r.BasicAuth(); ok {
+			token = p
+		}
+		if s.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// locationEvent is a region transition. OwnTracks sends {"_type":
+// "transition", "event", "desc", "tid"}; other senders (e.g. a Home
+// Assistant rest_command) can use {"event", "region" or "zone", "person"}.
+type locationEvent struct {
+	Type   string `json:"_type"`
+	Event  string `json:"event"` // "enter" or "leave"
+	Desc   string `json:"desc"`
+	Region string `json:"region"`
+	Zone   string `json:"zone"`
+	Person string `json:"person"`
+	TID    string `json:"tid"`
+}
+
+func (s *Server) handleLocation(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var ev locationEvent
+	if err := json.Unmarshal(body, &ev); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	// OwnTracks also posts its location reports here; only transitions count.
+	if ev.Type != "" && ev.Type != "transition" {
+		writeOwnTracksOK(w)
+		return
+	}
+	region := firstNonEmpty(ev.Region, ev.Zone, ev.Desc)
+	event := strings.ToLower(ev.Event)
+	person := firstNonEmpty(ev.Person, ev.TID, "the user")
+	if region == "" || (event != "enter" && event != "leave") {
+		http.Error(w, "expected an enter or leave event with a region", http.StatusBadRequest)
+		return
+	}
+	matched := 0
+	for _, g := range s.geofences {
+		if !strings.EqualFold(g.Region, region) || !strings.EqualFold(g.Event, event) {
+			continue
+		}
+		matched++
+		verb := map[string]string{"enter": "arrived at", "leave": "left"}[event]
+		in := chat.Inbound{
+			Channel:  g.Channel,
+			SenderID: "hooks",
+			ChatID:   g.ChatID,
+			Content:  fmt.Sprintf("[Location event] %s %s %s. %s", person, verb, region, g.Prompt),
+		}
+		select {
+		case s.hub.In <- in:
+		default:
+			http.Error(w, "agent busy", http.StatusServiceUnavailable)
+			return
+		}
+	}
+	log.Printf("hooks: %s %s %s, %d geofence(s) matched", person, event, region, matched)
+	writeOwnTracksOK(w)
+}
+
+// notifyRequest asks for a notification rendered from a template.
+type notifyRequest struct {
+	Template string                 `json:"template"`
+	Vars     map[string]interface{} `json:"vars"`
+	Channel  string                 `json:"channel"`
+	ChatID   string                 `json:"chatId"`
+}
+
+// handleNotify renders a template of the workspace and sends the result to
+// the chat as is, without involving the agent.
+func (s *Server) handleNotify(w http.ResponseWriter, r *http.Request) {
+	var req notifyRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBody)).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Template == "" || req.Channel == "" || req.ChatID == "" {
+		http.Error(w, "template, channel and chatId are required", http.StatusBadRequest)
+		return
+	}
+	text, err := templates.Render(os.DirFS(s.workspace), req.Template, req.Vars)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	select {
+	case s.hub.Out <- chat.Outbound{Channel: req.Channel, ChatID: req.ChatID, Content: text}:
+	default:
+		http.Error(w, "outbound queue full", http.StatusServiceUnavailable)
+		return
+	}
+	log.Printf("hooks: sent template %q to %s:%s", req.Template, req.Channel, req.ChatID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeOwnTracksOK answers with the empty JSON array OwnTracks expects.
+func writeOwnTracksOK(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("[]"))
+}
+
+func firstNonEmpty(ss ...string) string {
+	for _, s := range ss {
+		if s != "" {
+			return s
+		}
+	}
+	return ""
+}
@@ -0,0 +1,88 @@
+package hooks
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+)
+
+func TestLocationHook(t *testing.T) {
+	hub := chat.NewHub(10)
+	srv := httptest.NewServer(NewServer(hub, config.HooksConfig{
+		Token: "s3cret",
+		Geofences: []config.GeofenceHook{
+			{Region: "Home", Event: "enter", Prompt: "Check the to-do list.", Channel: "telegram", ChatID: "1"},
+			{Region: "home", Event: "leave", Prompt: "Did I lock the door?", Channel: "telegram", ChatID: "1"},
+		},
+	}).Handler())
+	defer srv.Close()
+
+	post := func(auth func(*http.Request), body string) int {
+		req, _ := http.NewRequest("POST", srv.URL+"/hooks/location", strings.NewReader(body))
+		auth(req)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	basic := func(r *http.Request) { r.SetBasicAuth("phone", "s3cret") }
+
+	if code := post(func(r *http.Request) {}, `{"event":"enter","region":"home"}`); code != http.StatusUnauthorized {
+		t.Fatalf("missing token: got %d", code)
+	}
+	// An OwnTracks transition, authenticated with basic auth.
+	if code := post(basic, `{"_type":"transition","event":"enter","desc":"home","tid":"ana"}`); code != http.StatusOK {
+		t.Fatalf("transition: got %d", code)
+	}
+	in := <-hub.In
+	if in.Channel != "telegram" || in.ChatID != "1" || in.Content != "[Location event] ana arrived at home. Check the to-do list." {
+		t.Fatalf("unexpected inbound: %+v", in)
+	}
+	// Location reports and unmapped regions are accepted and ignored.
+	post(basic, `{"_type":"location","lat":1,"lon":2}`)
+	post(func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cret") }, `{"event":"enter","zone":"work"}`)
+	select {
+	case in := <-hub.In:
+		t.Fatalf("unexpected inbound: %+v", in)
+	default:
+	}
+	if code := post(basic, `{"event":"arrive","region":"home"}`); code != http.StatusBadRequest {
+		t.Fatalf("unknown event: got %d", code)
+	}
+}
+
+func TestNotifyHook(t *testing.T) {
+	ws := t.TempDir()
+	os.MkdirAll(filepath.Join(ws, "templates"), 0o755)
+	os.WriteFile(filepath.Join(ws, "templates", "disk_full.tmpl"), []byte("💾 {{.host}} is {{.percent}}% full"), 0o644)
+	hub := chat.NewHub(10)
+	srv := httptest.NewServer(NewServer(hub, config.HooksConfig{Token: "s3cret", Workspace: ws}).Handler())
+	defer srv.Close()
+
+	post := func(body string) int {
+		resp, err := http.Post(srv.URL+"/hooks/notify?token=s3cret", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := post(`{"template":"disk_full","vars":{"host":"nas","percent":93},"channel":"telegram","chatId":"1"}`); code != http.StatusNoContent {
+		t.Fatalf("notify: got %d", code)
+	}
+	out := <-hub.Out
+	if out.Channel != "telegram" || out.ChatID != "1" || out.Content != "💾 nas is 93% full" {
+		t.Fatalf("unexpected outbound: %+v", out)
+	}
+	if code := post(`{"template":"disk_full","vars":{},"channel":"telegram","chatId":"1"}`); code != http.StatusUnprocessableEntity {
+		t.Fatalf("missing variable: got %d", code)
+	}
+}
@@ -0,0 +1,30 @@
+// Package keyring reads and stores secrets in the operating system's
+// keyring, so bot tokens and API keys need not sit in the config file: the
+// Secret Service (GNOME Keyring, KWallet) through secret-tool on Linux and
+// other Unix systems, the login keychain through security on macOS, and the
+// Credential Manager on Windows.
+package keyring
+
+import "errors"
+
+// Service is the keyring service picobot's own secrets are stored under.
+const Service = "picobot"
+
+// ErrNotFound is returned by Get when the keyring has no such secret.
+var ErrNotFound = errors.New("keyring: secret not found")
+
+// Get returns the secret stored for account of service.
+func Get(service, account string) (string, error) {
+	if service == "" || account == "" {
+		return "", errors.New("keyring: service and account are required")
+	}
+	return get(service, account)
+}
+
+// Set stores secret for account of service, replacing any previous one.
+func Set(service, account, secret string) error {
+	if service == "" || account == "" {
+		return errors.New("keyring: service and account are required")
+	}
+	return set(service, account, secret)
+}
@@ -0,0 +1,44 @@
+//go:build darwin
+
+package keyring
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// securityNotFound is the exit status of security(1) when the item does not
+// exist (errSecItemNotFound).
+const securityNotFound = 44
+
+// get reads a generic password of the login keychain.
+func get(service, account string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w")
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) && exit.ExitCode() == securityNotFound {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("keyring: security find-generic-password: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSuffix(stdout.String(), "\n"), nil
+}
+
+// set adds or updates (-U) a generic password of the login keychain. The
+// secret is passed as an argument, briefly visible to other processes of
+// the same user.
+func set(service, account, secret string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("security", "add-generic-password", "-U", "-s", service, "-a", account, "-w", secret)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("keyring: security add-generic-password: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+//go:build !darwin && !windows
+
+package keyring
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// get looks the secret up with secret-tool (libsecret), which exits with
+// status 1 and no output when there is none.
+func get(service, account string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("secret-tool", "lookup", "service", service, "account", account)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) && exit.ExitCode() == 1 && stdout.Len() == 0 && stderr.Len() == 0 {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("keyring: secret-tool lookup: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSuffix(stdout.String(), "\n"), nil
+}
+
+// set stores the secret with secret-tool, passing it on stdin.
+func set(service, account, secret string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("secret-tool", "store", "--label", service+" "+account, "service", service, "account", account)
+	cmd.Stdin = strings.NewReader(secret)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("keyring: secret-tool store: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
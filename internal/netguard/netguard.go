@@ -0,0 +1,141 @@
+// Package netguard guards the gateway's listeners (the web chat, the REST
+// and gRPC APIs, the hooks endpoint and the LINE webhook) at the transport
+// level: connections from addresses outside an allowlist are closed before
+// a byte is read, and the listener can serve TLS, optionally requiring
+// client certificates (mutual TLS).
+package netguard
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/local/picobot/internal/config"
+)
+
+// Listen listens on TCP address addr for the listener called name (used in
+// errors and logs), guarded as cfg says. protos are the application
+// protocols offered over TLS (ALPN), e.g. "h2" for gRPC.
+func Listen(name, addr string, cfg config.TransportConfig, protos ...string) (net.Listener, error) {
+	nets, err := parseCIDRs(cfg.AllowCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("%s: transport.allowCIDRs: %w", name, err)
+	}
+	tlsCfg, err := tlsConfig(cfg, protos)
+	if err != nil {
+		return nil, fmt.Errorf("%s: transport: %w", name, err)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if len(nets) > 0 {
+		ln = &allowListener{Listener: ln, name: name, nets: nets}
+	}
+	if tlsCfg != nil {
+		ln = tls.NewListener(ln, tlsCfg)
+	}
+	return ln, nil
+}
+
+// Scheme returns "https" when cfg serves TLS and "http" otherwise, for the
+// addresses logged at startup.
+func Scheme(cfg config.TransportConfig) string {
+	if cfg.TLSCert != "" {
+		return "https"
+	}
+	return "http"
+}
+
+// parseCIDRs parses an allowlist of networks ("10.0.0.0/8") and single
+// addresses ("192.0.2.7").
+func parseCIDRs(list []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("%q is neither an address nor a network", s)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// tlsConfig returns the TLS configuration cfg asks for, or nil to serve
+// plain TCP.
+func tlsConfig(cfg config.TransportConfig, protos []string) (*tls.Config, error) {
+	if cfg.TLSCert == "" && cfg.TLSKey == "" {
+		if cfg.ClientCA != "" {
+			return nil, fmt.Errorf("clientCA needs tlsCert and tlsKey")
+		}
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+	if err != nil {
+		return nil, err
+	}
+	tc := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12, NextProtos: protos}
+	if cfg.ClientCA != "" {
+		pem, err := os.ReadFile(cfg.ClientCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("clientCA %s holds no PEM certificate", cfg.ClientCA)
+		}
+		tc.ClientCAs, tc.ClientAuth = pool, tls.RequireAndVerifyClientCert
+	}
+	return tc, nil
+}
+
+// allowListener closes the connections of peers outside nets.
+type allowListener struct {
+	net.Listener
+	name string
+	nets []*net.IPNet
+}
+
+func (l *allowListener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if l.allowed(c.RemoteAddr()) {
+			return c, nil
+		}
+		log.Printf("%s: refused a connection from %s, outside transport.allowCIDRs", l.name, c.RemoteAddr())
+		c.Close()
+	}
+}
+
+func (l *allowListener) allowed(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, n := range l.nets {
+		if n.Contains(tcp.IP) {
+			return true
+		}
+	}
+	return false
+}
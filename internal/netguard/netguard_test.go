@@ -0,0 +1,140 @@
+package netguard
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/config"
+)
+
+// serve answers "ok" over HTTP on ln until the test ends.
+func serve(t *testing.T, ln net.Listener) {
+	t.Helper()
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "ok") })}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+}
+
+func TestListenAllowCIDRs(t *testing.T) {
+	if _, err := Listen("test", "127.0.0.1:0", config.TransportConfig{AllowCIDRs: []string{"10.0.0.0/33"}}); err == nil {
+		t.Fatal("bad network accepted")
+	}
+	for _, tc := range []struct {
+		allow []string
+		ok    bool
+	}{
+		{[]string{"10.0.0.0/8"}, false},
+		{[]string{"10.0.0.0/8", "127.0.0.1"}, true},
+		{nil, true},
+	} {
+		ln, err := Listen("test", "127.0.0.1:0", config.TransportConfig{AllowCIDRs: tc.allow})
+		if err != nil {
+			t.Fatal(err)
+		}
+		serve(t, ln)
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if got := err == nil; got != tc.ok {
+			t.Errorf("allow %v: got through = %v (%v)", tc.allow, got, err)
+		}
+		if err == nil {
+			resp.Body.Close()
+		}
+	}
+}
+
+// certs writes a CA, and a server and a client certificate it signed, to
+// dir, returning the CA's pool and the client's certificate.
+func certs(t *testing.T, dir string) (*x509.CertPool, tls.Certificate) {
+	t.Helper()
+	write := func(name, typ string, der []byte) {
+		if err := os.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ca := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "test CA"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour),
+		IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ = x509.ParseCertificate(caDER)
+	write("ca.pem", "CERTIFICATE", caDER)
+
+	issue := func(name string, serial int64, usage x509.ExtKeyUsage) tls.Certificate {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		tmpl := &x509.Certificate{SerialNumber: big.NewInt(serial), Subject: pkix.Name{CommonName: name},
+			NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour),
+			ExtKeyUsage: []x509.ExtKeyUsage{usage}, IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)}}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyDER, _ := x509.MarshalECPrivateKey(key)
+		write(name+".pem", "CERTIFICATE", der)
+		write(name+"-key.pem", "EC PRIVATE KEY", keyDER)
+		cert, err := tls.LoadX509KeyPair(filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+	issue("server", 2, x509.ExtKeyUsageServerAuth)
+	client := issue("client", 3, x509.ExtKeyUsageClientAuth)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	return pool, client
+}
+
+func TestListenMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	pool, client := certs(t, dir)
+	cfg := config.TransportConfig{ClientCA: filepath.Join(dir, "ca.pem")}
+	if _, err := Listen("test", "127.0.0.1:0", cfg); err == nil || !strings.Contains(err.Error(), "needs tlsCert") {
+		t.Fatalf("clientCA without a certificate: %v", err)
+	}
+	cfg.TLSCert, cfg.TLSKey = filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem")
+	ln, err := Listen("test", "127.0.0.1:0", cfg, "http/1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serve(t, ln)
+	if Scheme(cfg) != "https" {
+		t.Errorf("scheme = %q", Scheme(cfg))
+	}
+
+	get := func(certs ...tls.Certificate) error {
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, Certificates: certs}}}
+		resp, err := c.Get("https://" + ln.Addr().String())
+		if err != nil {
+			return err
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "ok" {
+			t.Errorf("body = %q", body)
+		}
+		return nil
+	}
+	if err := get(); err == nil {
+		t.Error("client without a certificate got through")
+	}
+	if err := get(client); err != nil {
+		t.Errorf("client with a certificate: %v", err)
+	}
+}
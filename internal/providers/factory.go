@@ -1,18 +1,41 @@
 package providers
 
-import "github.com/local/picobot/internal/config"
+import (
+	"log"
+
+	"github.com/local/picobot/internal/config"
+)
 
 // NewProviderFromConfig creates a provider based on the configuration.
 // Simple rules (v0):
 //   - if OpenAI API key present or API base is set (for Ollama) -> OpenAI
-//   - else fallback to stub
+//   - else fallback to stub (scripted, if providers.stub.scenarios is set)
 func NewProviderFromConfig(cfg config.Config) LLMProvider {
-	if cfg.Providers.OpenAI != nil && (cfg.Providers.OpenAI.APIKey != "" || cfg.Providers.OpenAI.APIBase != "") {
-		return NewOpenAIProvider(
+	if cfg.Providers.OpenAI != nil && (cfg.Providers.OpenAI.APIKey != "" || len(cfg.Providers.OpenAI.APIKeys) > 0 || cfg.Providers.OpenAI.APIBase != "") {
+		p := NewOpenAIProvider(
 			cfg.Providers.OpenAI.APIKey,
 			cfg.Providers.OpenAI.APIBase,
 			cfg.Agents.Defaults.RequestTimeoutS,
 		)
+		p.FallbackKeys = cfg.Providers.OpenAI.APIKeys
+		p.PromptCaching = cfg.Providers.OpenAI.PromptCaching
+		p.Stop = cfg.Providers.OpenAI.Stop
+		return p
+	}
+	return NewStubProviderFromConfig(cfg)
+}
+
+// NewStubProviderFromConfig returns a StubProvider, loaded with the scenarios
+// file from providers.stub.scenarios when one is configured. If the file cannot
+// be loaded the error is logged and the plain echo stub is returned.
+func NewStubProviderFromConfig(cfg config.Config) *StubProvider {
+	if cfg.Providers.Stub == nil || cfg.Providers.Stub.Scenarios == "" {
+		return NewStubProvider()
+	}
+	p, err := NewScriptedStubProvider(cfg.Providers.Stub.Scenarios)
+	if err != nil {
+		log.Printf("stub provider: %v; falling back to echo", err)
+		return NewStubProvider()
 	}
-	return NewStubProvider()
+	return p
 }
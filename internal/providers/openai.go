@@ -1,6 +1,7 @@
 package providers
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"errors"
@@ -9,14 +10,34 @@ import (
 	"log"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/local/picobot/internal/useragent"
 )
 
 // OpenAIProvider calls an OpenAI-compatible API (OpenAI, OpenRouter, or similar).
 type OpenAIProvider struct {
-	APIKey  string
-	APIBase string // e.g. https://api.openai.com/v1 or https://openrouter.ai/api/v1
-	Client  *http.Client
+	APIKey string
+	// FallbackKeys are tried in turn when the active key is rejected (401)
+	// or rate limited (429), wrapping around to APIKey after the last one.
+	// To rotate a key without downtime, add its replacement here, then
+	// revoke the old one: requests in flight finish with the old key and the
+	// next one switches over. Once the provider is in use, change the keys
+	// with SetKeys.
+	FallbackKeys []string
+	APIBase      string // e.g. https://api.openai.com/v1 or https://openrouter.ai/api/v1
+	Client       *http.Client
+	// PromptCaching sends explicit cache_control breakpoints on messages marked
+	// with Cache (needed for Anthropic models behind OpenRouter; OpenAI caches
+	// stable prefixes automatically).
+	PromptCaching bool
+	// Stop are sequences that end the model's reply, for models that run on
+	// into a made-up next turn ("\nUser:").
+	Stop []string
+
+	keyMu  sync.Mutex
+	keyIdx int // index into keys() of the key in use
 }
 
 func NewOpenAIProvider(apiKey, apiBase string, timeoutSecs int) *OpenAIProvider {
@@ -29,19 +50,91 @@ func NewOpenAIProvider(apiKey, apiBase string, timeoutSecs int) *OpenAIProvider
 	return &OpenAIProvider{
 		APIKey:  apiKey,
 		APIBase: strings.TrimRight(apiBase, "/"),
-		Client: &http.Client{
-			Timeout: time.Duration(timeoutSecs) * time.Second,
-		},
+		Client:  useragent.Client(time.Duration(timeoutSecs) * time.Second),
 	}
 }
 
 func (p *OpenAIProvider) GetDefaultModel() string { return "gpt-4o-mini" }
 
+// keys returns the configured keys in the order they are tried.
+func (p *OpenAIProvider) keys() []string {
+	p.keyMu.Lock()
+	defer p.keyMu.Unlock()
+	return p.keysLocked()
+}
+
+// keysLocked is keys with keyMu held.
+func (p *OpenAIProvider) keysLocked() []string {
+	keys := make([]string, 0, 1+len(p.FallbackKeys))
+	for _, k := range append([]string{p.APIKey}, p.FallbackKeys...) {
+		if k != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// ActiveKey returns a masked form of the API key currently in use, suitable
+// for logs and status output.
+func (p *OpenAIProvider) ActiveKey() string {
+	keys := p.keys()
+	if len(keys) == 0 {
+		return ""
+	}
+	p.keyMu.Lock()
+	defer p.keyMu.Unlock()
+	return maskKey(keys[min(p.keyIdx, len(keys)-1)])
+}
+
+// KeyStatus describes the key in use for status output: its place among the
+// configured keys and its masked form, e.g. "key 2 of 3 (…5678)".
+func (p *OpenAIProvider) KeyStatus() string {
+	p.keyMu.Lock()
+	defer p.keyMu.Unlock()
+	keys := p.keysLocked()
+	if len(keys) == 0 {
+		return "no API key"
+	}
+	idx := min(p.keyIdx, len(keys)-1)
+	return fmt.Sprintf("key %d of %d (%s)", idx+1, len(keys), maskKey(keys[idx]))
+}
+
+// SetKeys replaces the API key and the fallback keys, as when the
+// configuration is reloaded. The key in use stays active when it is still
+// configured; otherwise the first key is used.
+func (p *OpenAIProvider) SetKeys(apiKey string, fallback []string) {
+	p.keyMu.Lock()
+	defer p.keyMu.Unlock()
+	var active string
+	if keys := p.keysLocked(); len(keys) > 0 {
+		active = keys[min(p.keyIdx, len(keys)-1)]
+	}
+	p.APIKey, p.FallbackKeys = apiKey, append([]string(nil), fallback...)
+	p.keyIdx = 0
+	for i, k := range p.keysLocked() {
+		if k == active {
+			p.keyIdx = i
+			break
+		}
+	}
+}
+
+// maskKey hides all but the last four characters of key.
+func maskKey(key string) string {
+	if len(key) <= 4 {
+		return "…"
+	}
+	return "…" + key[len(key)-4:]
+}
+
 // Request/response shapes using the modern OpenAI "tools" format.
 type chatRequest struct {
 	Model    string        `json:"model"`
 	Messages []messageJSON `json:"messages"`
 	Tools    []toolWrapper `json:"tools,omitempty"`
+	Stream   bool          `json:"stream,omitempty"`
+	Stop     []string      `json:"stop,omitempty"`
+	Seed     *int64        `json:"seed,omitempty"`
 }
 
 // toolWrapper is the OpenAI tools array element: {"type": "function", "function": {...}}
@@ -58,11 +151,18 @@ type functionDef struct {
 
 type messageJSON struct {
 	Role       string         `json:"role"`
-	Content    string         `json:"content"`
+	Content    interface{}    `json:"content"` // string, or []contentPartJSON when caching
 	ToolCallID string         `json:"tool_call_id,omitempty"`
 	ToolCalls  []toolCallJSON `json:"tool_calls,omitempty"`
 }
 
+// contentPartJSON is a text content part carrying a cache breakpoint.
+type contentPartJSON struct {
+	Type         string            `json:"type"`
+	Text         string            `json:"text"`
+	CacheControl map[string]string `json:"cache_control,omitempty"`
+}
+
 type toolCallJSON struct {
 	ID       string               `json:"id"`
 	Type     string               `json:"type"`
@@ -88,16 +188,113 @@ type chatResponse struct {
 
 // Chat calls an OpenAI-compatible chat completion endpoint and returns a simplified response.
 func (p *OpenAIProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string) (LLMResponse, error) {
-	if p.APIKey == "" {
-		return LLMResponse{}, errors.New("OpenAI provider: API key is not configured")
+	resp, err := p.post(ctx, p.buildRequest(ctx, messages, tools, model, false))
+	if err != nil {
+		return LLMResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var out chatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return LLMResponse{}, err
+	}
+
+	if len(out.Choices) == 0 {
+		return LLMResponse{}, errors.New("OpenAI API returned no choices")
+	}
+
+	msg := out.Choices[0].Message
+	return toLLMResponse(msg.Content, msg.ToolCalls), nil
+}
+
+// ChatStream is like Chat but requests a streamed completion, calling onDelta
+// with each fragment of reply text as it arrives.
+func (p *OpenAIProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, onDelta func(string)) (LLMResponse, error) {
+	resp, err := p.post(ctx, p.buildRequest(ctx, messages, tools, model, true))
+	if err != nil {
+		return LLMResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var content strings.Builder
+	var toolCalls []toolCallJSON // indexed by the delta's tool call index
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue // blank separators and SSE comments
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+		var chunk streamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return LLMResponse{}, fmt.Errorf("OpenAI API: invalid stream chunk: %w", err)
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		delta := chunk.Choices[0].Delta
+		if delta.Content != "" {
+			content.WriteString(delta.Content)
+			if onDelta != nil {
+				onDelta(delta.Content)
+			}
+		}
+		for _, tc := range delta.ToolCalls {
+			for len(toolCalls) <= tc.Index {
+				toolCalls = append(toolCalls, toolCallJSON{Type: "function"})
+			}
+			acc := &toolCalls[tc.Index]
+			if tc.ID != "" {
+				acc.ID = tc.ID
+			}
+			acc.Function.Name += tc.Function.Name
+			acc.Function.Arguments += tc.Function.Arguments
+		}
 	}
+	if err := sc.Err(); err != nil {
+		return LLMResponse{}, err
+	}
+	return toLLMResponse(content.String(), toolCalls), nil
+}
+
+// streamChunk is one server-sent event of a streamed chat completion.
+type streamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Index    int                  `json:"index"`
+				ID       string               `json:"id"`
+				Function toolCallFunctionJSON `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+	} `json:"choices"`
+}
+
+// buildRequest converts messages and tools into the OpenAI request body,
+// sampled with the seed of ctx if it has one (see WithSeed).
+func (p *OpenAIProvider) buildRequest(ctx context.Context, messages []Message, tools []ToolDefinition, model string, stream bool) chatRequest {
 	if model == "" {
 		model = p.GetDefaultModel()
 	}
 
-	reqBody := chatRequest{Model: model, Messages: make([]messageJSON, 0, len(messages))}
+	reqBody := chatRequest{Model: model, Messages: make([]messageJSON, 0, len(messages)), Stream: stream, Stop: p.Stop}
+	if seed, ok := SeedFrom(ctx); ok {
+		reqBody.Seed = &seed
+	}
 	for _, m := range messages {
 		mj := messageJSON{Role: m.Role, Content: m.Content, ToolCallID: m.ToolCallID}
+		if m.Cache && p.PromptCaching {
+			mj.Content = []contentPartJSON{{
+				Type:         "text",
+				Text:         m.Content,
+				CacheControl: map[string]string{"type": "ephemeral"},
+			}}
+		}
 		// Convert provider ToolCall to JSON-serializable toolCallJSON
 		for _, tc := range m.ToolCalls {
 			argsBytes, _ := json.Marshal(tc.Arguments)
@@ -132,50 +329,83 @@ func (p *OpenAIProvider) Chat(ctx context.Context, messages []Message, tools []T
 		}
 	}
 
+	return reqBody
+}
+
+// post sends reqBody to the chat completions endpoint and returns the response
+// when the status is 2xx. The caller must close the body.
+// When the key in use is rejected or rate limited and another key is
+// configured, the request is retried with the next key (after the last, the
+// first again), which stays active for later requests. Each key is tried
+// at most once per request.
+func (p *OpenAIProvider) post(ctx context.Context, reqBody chatRequest) (*http.Response, error) {
+	keys := p.keys()
+	if len(keys) == 0 {
+		return nil, errors.New("OpenAI provider: API key is not configured")
+	}
 	b, err := json.Marshal(reqBody)
 	if err != nil {
-		return LLMResponse{}, err
+		return nil, err
 	}
 
-	url := fmt.Sprintf("%s/chat/completions", p.APIBase)
-	req, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(string(b)))
-	if err != nil {
-		return LLMResponse{}, err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	for tried := 1; ; tried++ {
+		p.keyMu.Lock()
+		idx := min(p.keyIdx, len(keys)-1)
+		p.keyMu.Unlock()
 
-	resp, err := p.Client.Do(req)
-	if err != nil {
-		return LLMResponse{}, err
+		url := fmt.Sprintf("%s/chat/completions", p.APIBase)
+		req, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(string(b)))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+keys[idx])
+		// App attribution, as understood by OpenRouter; ignored elsewhere.
+		req.Header.Set("HTTP-Referer", useragent.Homepage)
+		req.Header.Set("X-Title", "picobot")
+
+		resp, err := p.Client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		rotate := resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusTooManyRequests
+		if rotate && tried < len(keys) {
+			resp.Body.Close()
+			next := (idx + 1) % len(keys)
+			p.keyMu.Lock()
+			if p.keyIdx == idx {
+				p.keyIdx = next
+			}
+			p.keyMu.Unlock()
+			log.Printf("OpenAI provider: key %s refused (%s), switching to %s", maskKey(keys[idx]), resp.Status, maskKey(keys[next]))
+			continue
+		}
+		return checkOpenAIResponse(resp)
 	}
-	defer resp.Body.Close()
+}
 
+// checkOpenAIResponse returns resp when its status is 2xx and an error otherwise.
+func checkOpenAIResponse(resp *http.Response) (*http.Response, error) {
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		// attempt to read response body for more details (do not expose API key)
 		bodyBytes, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
 		body := strings.TrimSpace(string(bodyBytes))
 		log.Printf("OpenAI API non-2xx: %s body=%q", resp.Status, body)
 		if body == "" {
-			return LLMResponse{}, fmt.Errorf("OpenAI API error: %s", resp.Status)
+			return nil, fmt.Errorf("OpenAI API error: %s", resp.Status)
 		}
-		return LLMResponse{}, fmt.Errorf("OpenAI API error: %s - %s", resp.Status, body)
-	}
-
-	var out chatResponse
-	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-		return LLMResponse{}, err
-	}
-
-	if len(out.Choices) == 0 {
-		return LLMResponse{}, errors.New("OpenAI API returned no choices")
+		return nil, fmt.Errorf("OpenAI API error: %s - %s", resp.Status, body)
 	}
+	return resp, nil
+}
 
-	msg := out.Choices[0].Message
+// toLLMResponse normalizes the assistant content and raw tool calls.
+func toLLMResponse(content string, toolCalls []toolCallJSON) LLMResponse {
 	// If the model requested tool calls, parse them
-	if len(msg.ToolCalls) > 0 {
+	if len(toolCalls) > 0 {
 		var tcs []ToolCall
-		for _, tc := range msg.ToolCalls {
+		for _, tc := range toolCalls {
 			var parsed map[string]interface{}
 			if err := json.Unmarshal([]byte(tc.Function.Arguments), &parsed); err != nil {
 				// skip unparseable tool calls
@@ -184,10 +414,10 @@ func (p *OpenAIProvider) Chat(ctx context.Context, messages []Message, tools []T
 			tcs = append(tcs, ToolCall{ID: tc.ID, Name: tc.Function.Name, Arguments: parsed})
 		}
 		if len(tcs) > 0 {
-			return LLMResponse{Content: strings.TrimSpace(msg.Content), HasToolCalls: true, ToolCalls: tcs}, nil
+			return LLMResponse{Content: strings.TrimSpace(content), HasToolCalls: true, ToolCalls: tcs}
 		}
 	}
 
 	// No tool calls
-	return LLMResponse{Content: strings.TrimSpace(msg.Content), HasToolCalls: false}, nil
+	return LLMResponse{Content: strings.TrimSpace(content), HasToolCalls: false}
 }
@@ -2,6 +2,7 @@ package providers
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -57,3 +58,240 @@ func TestOpenAIFunctionCallParsing(t *testing.T) {
 		t.Fatalf("unexpected argument content: %v", resp.ToolCalls[0].Arguments)
 	}
 }
+
+func TestOpenAIPromptCachingMarksStablePrefix(t *testing.T) {
+	var body map[string]interface{}
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer h.Close()
+
+	p := NewOpenAIProvider("test-key", h.URL, 60)
+	p.PromptCaching = true
+	msgs := []Message{{Role: "system", Content: "stable", Cache: true}, {Role: "user", Content: "hi"}}
+	if _, err := p.Chat(context.Background(), msgs, nil, "model-x"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sent := body["messages"].([]interface{})
+	parts, ok := sent[0].(map[string]interface{})["content"].([]interface{})
+	if !ok || len(parts) != 1 {
+		t.Fatalf("expected cached message to be sent as content parts, got %v", sent[0])
+	}
+	cc := parts[0].(map[string]interface{})["cache_control"].(map[string]interface{})
+	if cc["type"] != "ephemeral" {
+		t.Fatalf("unexpected cache_control: %v", cc)
+	}
+	if _, ok := sent[1].(map[string]interface{})["content"].(string); !ok {
+		t.Fatalf("expected uncached message to keep plain string content, got %v", sent[1])
+	}
+}
+
+func TestOpenAISendsStopSequences(t *testing.T) {
+	var body map[string]interface{}
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer h.Close()
+
+	p := NewOpenAIProvider("test-key", h.URL, 60)
+	if _, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, "model-x"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := body["stop"]; ok {
+		t.Fatalf("stop sent without stop sequences: %v", body["stop"])
+	}
+
+	p.Stop = []string{"\nUser:", "<|im_end|>"}
+	if _, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, "model-x"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stop, _ := body["stop"].([]interface{})
+	if len(stop) != 2 || stop[0] != "\nUser:" || stop[1] != "<|im_end|>" {
+		t.Fatalf("unexpected stop: %v", body["stop"])
+	}
+}
+
+func TestOpenAISendsSeed(t *testing.T) {
+	var body map[string]interface{}
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer h.Close()
+
+	p := NewOpenAIProvider("test-key", h.URL, 60)
+	msgs := []Message{{Role: "user", Content: "hi"}}
+	if _, err := p.Chat(context.Background(), msgs, nil, "model-x"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := body["seed"]; ok {
+		t.Fatalf("seed sent without one: %v", body["seed"])
+	}
+	if _, err := p.Chat(WithSeed(context.Background(), 1234567), msgs, nil, "model-x"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if body["seed"] != float64(1234567) {
+		t.Fatalf("unexpected seed: %v", body["seed"])
+	}
+}
+
+func TestOpenAIChatStream(t *testing.T) {
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req["stream"] != true {
+			t.Errorf("expected stream=true, got %v", req["stream"])
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(": keep-alive\n\n" +
+			`data: {"choices":[{"delta":{"role":"assistant","content":"Hel"}}]}` + "\n\n" +
+			`data: {"choices":[{"delta":{"content":"lo"}}]}` + "\n\n" +
+			`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","function":{"name":"message","arguments":"{\"con"}}]}}]}` + "\n\n" +
+			`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"tent\":\"hi\"}"}}]}}]}` + "\n\n" +
+			"data: [DONE]\n\n"))
+	}))
+	defer h.Close()
+
+	p := NewOpenAIProvider("test-key", h.URL, 60)
+	var deltas []string
+	resp, err := p.ChatStream(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, "model-x", func(d string) {
+		deltas = append(deltas, d)
+	})
+	if err != nil {
+		t.Fatalf("ChatStream: %v", err)
+	}
+	if len(deltas) != 2 || deltas[0] != "Hel" || deltas[1] != "lo" {
+		t.Fatalf("unexpected deltas: %q", deltas)
+	}
+	if resp.Content != "Hello" {
+		t.Fatalf("unexpected content: %q", resp.Content)
+	}
+	if !resp.HasToolCalls || len(resp.ToolCalls) != 1 || resp.ToolCalls[0].ID != "call_1" || resp.ToolCalls[0].Arguments["content"] != "hi" {
+		t.Fatalf("unexpected tool calls: %+v", resp.ToolCalls)
+	}
+}
+
+func TestOpenAIRotatesToFallbackKey(t *testing.T) {
+	var seen []string
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		seen = append(seen, auth)
+		if auth != "Bearer new-key-5678" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"message":"invalid key"}}`))
+			return
+		}
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer h.Close()
+
+	p := NewOpenAIProvider("old-key-1234", h.URL, 60)
+	p.FallbackKeys = []string{"new-key-5678"}
+	if p.ActiveKey() != "…1234" {
+		t.Fatalf("unexpected active key before rotation: %q", p.ActiveKey())
+	}
+	for i := 0; i < 2; i++ {
+		resp, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, "m")
+		if err != nil || resp.Content != "ok" {
+			t.Fatalf("call %d: resp=%+v err=%v", i, resp, err)
+		}
+	}
+	// The rejected key is tried once; afterwards the new key stays active.
+	want := []string{"Bearer old-key-1234", "Bearer new-key-5678", "Bearer new-key-5678"}
+	if len(seen) != len(want) {
+		t.Fatalf("unexpected requests: %q", seen)
+	}
+	for i := range want {
+		if seen[i] != want[i] {
+			t.Fatalf("unexpected requests: %q", seen)
+		}
+	}
+	if p.ActiveKey() != "…5678" {
+		t.Fatalf("unexpected active key after rotation: %q", p.ActiveKey())
+	}
+}
+
+func TestOpenAIRotatesBackOnRateLimit(t *testing.T) {
+	limited := map[string]bool{"Bearer old-key-1234": true}
+	var seen []string
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		seen = append(seen, auth)
+		switch {
+		case auth == "Bearer bad-key-0000":
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error":{"message":"model not allowed"}}`))
+		case limited[auth]:
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":{"message":"slow down"}}`))
+		default:
+			w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`))
+		}
+	}))
+	defer h.Close()
+
+	p := NewOpenAIProvider("old-key-1234", h.URL, 60)
+	p.FallbackKeys = []string{"new-key-5678"}
+	chat := func() error {
+		_, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, "m")
+		return err
+	}
+	if err := chat(); err != nil || p.ActiveKey() != "…5678" {
+		t.Fatalf("rate limited key kept: err=%v, active %s", err, p.ActiveKey())
+	}
+	// The fallback is limited in turn: rotate back to the first key.
+	limited = map[string]bool{"Bearer new-key-5678": true}
+	if err := chat(); err != nil || p.ActiveKey() != "…1234" {
+		t.Fatalf("did not rotate back: err=%v, active %s", err, p.ActiveKey())
+	}
+	// Every key limited: the request fails after trying each once.
+	limited = map[string]bool{"Bearer old-key-1234": true, "Bearer new-key-5678": true}
+	seen = nil
+	if err := chat(); err == nil || len(seen) != 2 {
+		t.Fatalf("all keys limited: err=%v after %d requests", err, len(seen))
+	}
+
+	// A 403 is about the request, not the key, and does not rotate.
+	p = NewOpenAIProvider("bad-key-0000", h.URL, 60)
+	p.FallbackKeys = []string{"new-key-5678"}
+	limited = nil
+	if err := chat(); err == nil || p.ActiveKey() != "…0000" {
+		t.Fatalf("403 rotated the key: err=%v, active %s", err, p.ActiveKey())
+	}
+}
+
+func TestOpenAISetKeys(t *testing.T) {
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer old-key-1234" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer h.Close()
+
+	p := NewOpenAIProvider("old-key-1234", h.URL, 60)
+	p.FallbackKeys = []string{"new-key-5678"}
+	if _, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, "m"); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.KeyStatus(); got != "key 2 of 2 (…5678)" {
+		t.Fatalf("status after rotation: %q", got)
+	}
+	// The key in use stays active when the reloaded keys still hold it.
+	p.SetKeys("new-key-5678", []string{"spare-key-9999"})
+	if got := p.KeyStatus(); got != "key 1 of 2 (…5678)" {
+		t.Fatalf("status after reload: %q", got)
+	}
+	// Dropped: the first key takes over.
+	p.SetKeys("", []string{"spare-key-9999", "last-key-4321"})
+	if got := p.KeyStatus(); got != "key 1 of 2 (…9999)" {
+		t.Fatalf("status after the active key was dropped: %q", got)
+	}
+	if got := NewOpenAIProvider("", h.URL, 60).KeyStatus(); got != "no API key" {
+		t.Fatalf("status without keys: %q", got)
+	}
+}
@@ -8,6 +8,9 @@ type Message struct {
 	Content    string     `json:"content"`
 	ToolCallID string     `json:"tool_call_id,omitempty"` // set when Role == "tool"
 	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`   // set on assistant msgs with tool calls
+	// Cache marks the end of a stable prompt prefix. Providers with explicit
+	// prompt caching (e.g. Anthropic cache_control) place a breakpoint here.
+	Cache bool `json:"-"`
 }
 
 // ToolDefinition is a lightweight description of a tool available to the model.
@@ -39,3 +42,11 @@ type LLMProvider interface {
 	// GetDefaultModel returns the provider's default model string.
 	GetDefaultModel() string
 }
+
+// StreamingProvider is implemented by providers that can deliver reply text
+// incrementally. onDelta is called with each text fragment as it arrives; the
+// returned response is the same one Chat would have produced.
+type StreamingProvider interface {
+	LLMProvider
+	ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, onDelta func(string)) (LLMResponse, error)
+}
@@ -2,6 +2,8 @@ package providers
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -20,3 +22,60 @@ func TestStubProviderEcho(t *testing.T) {
 		t.Fatalf("expected non-empty content")
 	}
 }
+
+func TestScriptedStubProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenarios.yaml")
+	os.WriteFile(path, []byte(`
+scenarios:
+  - match: "(?i)weather"
+    responses:
+      - tool_calls:
+          - name: web
+            arguments:
+              url: https://wttr.in/?format=3
+      - content: It's sunny.
+  - match: "^ping$"
+    responses:
+      - content: pong
+`), 0o644)
+	p, err := NewScriptedStubProvider(path)
+	if err != nil {
+		t.Fatalf("NewScriptedStubProvider: %v", err)
+	}
+	ctx := context.Background()
+
+	msgs := []Message{{Role: "user", Content: "What's the Weather?"}}
+	resp, _ := p.Chat(ctx, msgs, nil, "")
+	if !resp.HasToolCalls || resp.ToolCalls[0].Name != "web" || resp.ToolCalls[0].Arguments["url"] != "https://wttr.in/?format=3" {
+		t.Fatalf("expected web tool call, got %+v", resp)
+	}
+
+	// After the tool round, the next response of the scenario is returned.
+	msgs = append(msgs,
+		Message{Role: "assistant", ToolCalls: resp.ToolCalls},
+		Message{Role: "tool", Content: "Lisbon: sunny", ToolCallID: resp.ToolCalls[0].ID},
+	)
+	resp, _ = p.Chat(ctx, msgs, nil, "")
+	if resp.HasToolCalls || resp.Content != "It's sunny." {
+		t.Fatalf("expected final content, got %+v", resp)
+	}
+
+	resp, _ = p.Chat(ctx, []Message{{Role: "user", Content: "ping"}}, nil, "")
+	if resp.Content != "pong" {
+		t.Fatalf("expected pong, got %q", resp.Content)
+	}
+
+	// Unmatched messages fall back to echo.
+	resp, _ = p.Chat(ctx, []Message{{Role: "user", Content: "hello"}}, nil, "")
+	if resp.Content != "(stub) Echo: hello" {
+		t.Fatalf("expected echo, got %q", resp.Content)
+	}
+}
+
+func TestScriptedStubProviderRejectsInvalidScenario(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenarios.yaml")
+	os.WriteFile(path, []byte("scenarios:\n  - match: \"(\"\n    responses:\n      - content: x\n"), 0o644)
+	if _, err := NewScriptedStubProvider(path); err == nil {
+		t.Fatal("expected error for invalid pattern")
+	}
+}
@@ -0,0 +1,20 @@
+package providers
+
+import "context"
+
+type seedKey struct{}
+
+// WithSeed returns a context asking the provider to sample with seed, so
+// that the same request is answered the same way again. Providers without
+// seeded sampling ignore it, and those with it reproduce replies on a best
+// effort basis (the model version must not have changed).
+func WithSeed(ctx context.Context, seed int64) context.Context {
+	return context.WithValue(ctx, seedKey{}, seed)
+}
+
+// SeedFrom returns the seed set with WithSeed; ok is false when there is
+// none.
+func SeedFrom(ctx context.Context) (seed int64, ok bool) {
+	seed, ok = ctx.Value(seedKey{}).(int64)
+	return seed, ok
+}
@@ -3,21 +3,130 @@ package providers
 import (
 	"context"
 	"fmt"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
 )
 
-// StubProvider is a simple provider useful for local testing. It echoes back the last user message.
-type StubProvider struct{}
+// StubProvider is a simple provider useful for local testing. It echoes back the last user message,
+// unless it was loaded with scripted scenarios (see NewScriptedStubProvider).
+type StubProvider struct {
+	scenarios []stubScenario
+}
 
 func NewStubProvider() *StubProvider { return &StubProvider{} }
 
+// stubScenario is a compiled scenario: when match finds the last user message,
+// the n-th model call of the turn returns responses[n].
+type stubScenario struct {
+	match     *regexp.Regexp
+	responses []stubResponse
+}
+
+// stubResponse is a scripted model call: a response, or an error when err is
+// set.
+type stubResponse struct {
+	resp LLMResponse
+	err  string
+}
+
+// stubScenarioFile is the YAML layout of a scenario file:
+//
+//	scenarios:
+//	  - match: "(?i)weather"        # regexp matched against the last user message
+//	    responses:                  # one per model call within the turn
+//	      - tool_calls:
+//	          - name: web
+//	            arguments: {url: "https://wttr.in/?format=3"}
+//	      - content: "It's sunny."
+//	  - match: "(?i)flaky"
+//	    responses:
+//	      - error: "status 502"         # the model call fails
+//	  - match: ".*"
+//	    responses:
+//	      - content: "I only know about the weather."
+type stubScenarioFile struct {
+	Scenarios []struct {
+		Match     string `yaml:"match"`
+		Responses []struct {
+			Content   string `yaml:"content"`
+			Error     string `yaml:"error"`
+			ToolCalls []struct {
+				Name      string                 `yaml:"name"`
+				Arguments map[string]interface{} `yaml:"arguments"`
+			} `yaml:"tool_calls"`
+		} `yaml:"responses"`
+	} `yaml:"scenarios"`
+}
+
+// NewScriptedStubProvider creates a StubProvider that answers from the scenarios
+// in the YAML file at path. Scenarios are tried in order; the first whose
+// pattern matches the last user message is used. Within a turn, each model
+// call returns the next response, so a response with tool_calls followed by
+// one with content exercises the full tool loop. Once a scenario runs out of
+// responses its last one is repeated. A response with an error makes that model
+// call fail. Messages matching no scenario are echoed.
+func NewScriptedStubProvider(path string) (*StubProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f stubScenarioFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("stub scenarios %s: %w", path, err)
+	}
+	p := &StubProvider{}
+	for i, s := range f.Scenarios {
+		re, err := regexp.Compile(s.Match)
+		if err != nil {
+			return nil, fmt.Errorf("stub scenario %d: invalid match: %w", i+1, err)
+		}
+		if len(s.Responses) == 0 {
+			return nil, fmt.Errorf("stub scenario %d: no responses", i+1)
+		}
+		sc := stubScenario{match: re}
+		for j, r := range s.Responses {
+			resp := LLMResponse{Content: r.Content}
+			for k, tc := range r.ToolCalls {
+				if tc.Name == "" {
+					return nil, fmt.Errorf("stub scenario %d, response %d: tool call without name", i+1, j+1)
+				}
+				args := tc.Arguments
+				if args == nil {
+					args = map[string]interface{}{}
+				}
+				resp.ToolCalls = append(resp.ToolCalls, ToolCall{ID: fmt.Sprintf("stub_%d_%d_%d", i+1, j+1, k+1), Name: tc.Name, Arguments: args})
+			}
+			resp.HasToolCalls = len(resp.ToolCalls) > 0
+			sc.responses = append(sc.responses, stubResponse{resp: resp, err: r.Error})
+		}
+		p.scenarios = append(p.scenarios, sc)
+	}
+	return p, nil
+}
+
 func (p *StubProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string) (LLMResponse, error) {
-	// Find last user message
+	// Find last user message, counting the tool-calling rounds that followed it
 	last := ""
+	step := 0
 	for i := len(messages) - 1; i >= 0; i-- {
 		if messages[i].Role == "user" {
 			last = messages[i].Content
 			break
 		}
+		if messages[i].Role == "assistant" && len(messages[i].ToolCalls) > 0 {
+			step++
+		}
+	}
+	for _, sc := range p.scenarios {
+		if sc.match.MatchString(last) {
+			r := sc.responses[min(step, len(sc.responses)-1)]
+			if r.err != "" {
+				return LLMResponse{}, fmt.Errorf("(stub) %s", r.err)
+			}
+			return r.resp, nil
+		}
 	}
 	if last == "" {
 		return LLMResponse{Content: "(stub) Hello from StubProvider"}, nil
@@ -0,0 +1,137 @@
+package session
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// ArchiveEntry is one message in a chat's archive.
+type ArchiveEntry struct {
+	Time    time.Time `json:"time"`
+	Role    string    `json:"role"` // "user" or "assistant"
+	Content string    `json:"content"`
+}
+
+// archivePath returns the archive file of the session key.
+func (sm *SessionManager) archivePath(key string) string {
+	return filepath.Join(sm.workspace, "archive", key+".jsonl")
+}
+
+// Archive appends a message to the permanent archive of the session key,
+// workspace/archive/<key>.jsonl. Unlike the session history, the archive is
+// never trimmed or reset; it is what SearchArchive searches.
+func (sm *SessionManager) Archive(key, role, content string) error {
+	sm.archiveMu.Lock()
+	defer sm.archiveMu.Unlock()
+	path := sm.archivePath(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	b, err := json.Marshal(ArchiveEntry{Time: time.Now().UTC(), Role: role, Content: content})
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(b, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// SearchArchive returns up to n archived messages of the session key that
+// contain every word of query, newest first. Matching ignores case and
+// accents, so "pao" finds "pão".
+func (sm *SessionManager) SearchArchive(key, query string, n int) ([]ArchiveEntry, error) {
+	terms := strings.Fields(foldText(query))
+	if len(terms) == 0 || n <= 0 {
+		return nil, nil
+	}
+	sm.archiveMu.Lock()
+	defer sm.archiveMu.Unlock()
+	f, err := os.Open(sm.archivePath(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var matches []ArchiveEntry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var e ArchiveEntry
+		if json.Unmarshal(sc.Bytes(), &e) != nil {
+			continue
+		}
+		text := foldText(e.Content)
+		all := true
+		for _, t := range terms {
+			if !strings.Contains(text, t) {
+				all = false
+				break
+			}
+		}
+		if all {
+			matches = append(matches, e)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	// Newest first.
+	out := make([]ArchiveEntry, 0, min(n, len(matches)))
+	for i := len(matches) - 1; i >= 0 && len(out) < n; i-- {
+		out = append(out, matches[i])
+	}
+	return out, nil
+}
+
+// ArchiveSince returns the archived messages of the session key sent at or
+// after since, oldest first.
+func (sm *SessionManager) ArchiveSince(key string, since time.Time) ([]ArchiveEntry, error) {
+	sm.archiveMu.Lock()
+	defer sm.archiveMu.Unlock()
+	f, err := os.Open(sm.archivePath(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []ArchiveEntry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var e ArchiveEntry
+		if json.Unmarshal(sc.Bytes(), &e) == nil && !e.Time.Before(since) {
+			entries = append(entries, e)
+		}
+	}
+	return entries, sc.Err()
+}
+
+// foldText lowercases s and strips its diacritics.
+func foldText(s string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(strings.ToLower(s)) {
+		if !unicode.Is(unicode.Mn, r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 )
 
@@ -24,6 +26,7 @@ type SessionManager struct {
 	mu        sync.RWMutex
 	sessions  map[string]*Session
 	workspace string
+	archiveMu sync.Mutex // serializes access to the archive files
 }
 
 func NewSessionManager(workspace string) *SessionManager {
@@ -56,6 +59,18 @@ func (sm *SessionManager) Save(s *Session) error {
 	return os.WriteFile(fpath, b, 0644)
 }
 
+// Reset forgets the session with the given key and removes its file.
+func (sm *SessionManager) Reset(key string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	delete(sm.sessions, key)
+	err := os.Remove(filepath.Join(sm.workspace, "sessions", key+".json"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
 func (sm *SessionManager) LoadAll() error {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
@@ -82,6 +97,32 @@ func (sm *SessionManager) LoadAll() error {
 	return nil
 }
 
+// Keys returns the keys ("channel:chatID") of the sessions in memory or on
+// disk, sorted.
+func (sm *SessionManager) Keys() ([]string, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	seen := make(map[string]bool, len(sm.sessions))
+	for k := range sm.sessions {
+		seen[k] = true
+	}
+	entries, err := os.ReadDir(filepath.Join(sm.workspace, "sessions"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, e := range entries {
+		if name, ok := strings.CutSuffix(e.Name(), ".json"); ok && !e.IsDir() {
+			seen[name] = true
+		}
+	}
+	keys := make([]string, 0, len(seen))
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
 func (s *Session) AddMessage(role, content string) {
 	s.History = append(s.History, role+": "+content)
 }
@@ -0,0 +1,114 @@
+// Package stt turns speech into text, for the voice notes users send.
+package stt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/useragent"
+)
+
+// Transcriber transcribes the audio file at path.
+type Transcriber interface {
+	Transcribe(ctx context.Context, path string) (string, error)
+}
+
+// defaultModel is the transcription model of the OpenAI API.
+const defaultModel = "whisper-1"
+
+// OpenAI transcribes through an OpenAI-compatible /audio/transcriptions
+// endpoint: OpenAI itself, Groq, or a local whisper server.
+type OpenAI struct {
+	APIBase string
+	APIKey  string
+	Model   string
+	client  *http.Client
+}
+
+// NewFromConfig returns the transcriber configured in cfg, or nil when
+// transcription is off. The endpoint and key default to the OpenAI provider's.
+func NewFromConfig(cfg config.Config) Transcriber {
+	t := cfg.Transcription
+	if !t.Enabled {
+		return nil
+	}
+	o := &OpenAI{APIBase: t.APIBase, APIKey: t.APIKey, Model: t.Model, client: useragent.Client(2 * time.Minute)}
+	if p := cfg.Providers.OpenAI; p != nil {
+		if o.APIBase == "" {
+			o.APIBase = p.APIBase
+		}
+		if o.APIKey == "" {
+			o.APIKey = p.APIKey
+		}
+	}
+	if o.APIBase == "" {
+		o.APIBase = "https://api.openai.com/v1"
+	}
+	if o.Model == "" {
+		o.Model = defaultModel
+	}
+	return o
+}
+
+// Transcribe uploads the file at path and returns its text.
+func (o *OpenAI) Transcribe(ctx context.Context, path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	if err := mw.WriteField("model", o.Model); err != nil {
+		return "", err
+	}
+	fw, err := mw.CreateFormFile("file", filepath.Base(path))
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(fw, f); err != nil {
+		return "", err
+	}
+	if err := mw.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimRight(o.APIBase, "/")+"/audio/transcriptions", &buf)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	if o.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.APIKey)
+	}
+	client := o.client
+	if client == nil {
+		client = useragent.Client(2 * time.Minute)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("transcribe: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("transcribe: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var out struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return "", fmt.Errorf("transcribe: %w", err)
+	}
+	return strings.TrimSpace(out.Text), nil
+}
@@ -0,0 +1,44 @@
+package stt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/local/picobot/internal/config"
+)
+
+func TestOpenAITranscribe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/audio/transcriptions" || r.Header.Get("Authorization") != "Bearer k" {
+			t.Errorf("unexpected request %s %v", r.URL.Path, r.Header)
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatal(err)
+		}
+		f, h, err := r.FormFile("file")
+		if err != nil || h.Filename != "note.ogg" || r.FormValue("model") != "whisper-1" {
+			t.Errorf("unexpected form: %v %v", r.MultipartForm.Value, err)
+		} else {
+			f.Close()
+		}
+		w.Write([]byte(`{"text":" buy milk \n"}`))
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "note.ogg")
+	os.WriteFile(path, []byte("OggS"), 0o644)
+	cfg := config.Config{Transcription: config.TranscriptionConfig{Enabled: true}, Providers: config.ProvidersConfig{OpenAI: &config.ProviderConfig{APIKey: "k", APIBase: srv.URL + "/v1"}}}
+	tr := NewFromConfig(cfg)
+	got, err := tr.Transcribe(context.Background(), path)
+	if err != nil || got != "buy milk" {
+		t.Fatalf("Transcribe = %q, %v", got, err)
+	}
+
+	if NewFromConfig(config.Config{}) != nil {
+		t.Fatal("transcription should be off by default")
+	}
+}
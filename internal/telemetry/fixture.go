@@ -0,0 +1,179 @@
+package telemetry
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fixtureFile mirrors the stub provider's scenario file (see
+// providers.NewScriptedStubProvider).
+type fixtureFile struct {
+	Scenarios []fixtureScenario `yaml:"scenarios"`
+}
+
+type fixtureScenario struct {
+	Match     string            `yaml:"match"`
+	Responses []fixtureResponse `yaml:"responses"`
+}
+
+type fixtureResponse struct {
+	Content   string            `yaml:"content,omitempty"`
+	Error     string            `yaml:"error,omitempty"`
+	ToolCalls []fixtureToolCall `yaml:"tool_calls,omitempty"`
+}
+
+type fixtureToolCall struct {
+	Name      string                 `yaml:"name"`
+	Arguments map[string]interface{} `yaml:"arguments,omitempty"`
+}
+
+// Fixture turns traces of failed turns into a stub provider scenario file
+// that replays them: each message gets the recorded model responses, then the
+// recorded error. Personal data is replaced first (see Redactor), the same
+// way throughout the file, so a replayed message still matches its scenario.
+// Redaction is best effort: review the file before sharing it.
+func Fixture(recs []TraceRecord) ([]byte, error) {
+	r := NewRedactor()
+	var f fixtureFile
+	var ids, seeds []string
+	for _, rec := range recs {
+		ids = append(ids, rec.ID)
+		if rec.Seed != 0 {
+			seeds = append(seeds, fmt.Sprintf("%s=%d", rec.ID, rec.Seed))
+		}
+		sc := fixtureScenario{Match: "^" + regexp.QuoteMeta(r.Text(rec.Message)) + "$"}
+		for _, call := range rec.Calls {
+			resp := fixtureResponse{Content: r.Text(call.Content)}
+			for _, tc := range call.ToolCalls {
+				resp.ToolCalls = append(resp.ToolCalls, fixtureToolCall{Name: tc.Name, Arguments: r.Args(tc.Arguments)})
+			}
+			sc.Responses = append(sc.Responses, resp)
+		}
+		sc.Responses = append(sc.Responses, fixtureResponse{Error: r.Text(rec.Error)})
+		f.Scenarios = append(f.Scenarios, sc)
+	}
+	b, err := yaml.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+	header := fmt.Sprintf("# Replays the failed turns of trace(s) %s with names and numbers replaced.\n# Redaction is best effort: review before sharing.\n", strings.Join(ids, ", "))
+	if len(seeds) > 0 {
+		header += fmt.Sprintf("# Sampled with seed(s) %s: run one against the model again with\n# picobot agent --seed <seed> -m <message>.\n", strings.Join(seeds, ", "))
+	}
+	return append([]byte(header), b...), nil
+}
+
+var (
+	// contactRE finds e-mail addresses and, when not part of one, @handles.
+	contactRE = regexp.MustCompile(`[\w.+-]+@[\w-]+(?:\.[\w-]+)+|@\w{2,}`)
+	numberRE  = regexp.MustCompile(`\d{4,}`)
+	// nameRE finds capitalized words; those starting a sentence are left
+	// alone unless seen as names before (see Redactor.Text).
+	nameRE = regexp.MustCompile(`\p{Lu}\p{Ll}+`)
+)
+
+// commonCapitalized are capitalized words that are not personal data.
+var commonCapitalized = map[string]bool{
+	"Monday": true, "Tuesday": true, "Wednesday": true, "Thursday": true, "Friday": true, "Saturday": true, "Sunday": true,
+	"January": true, "February": true, "March": true, "April": true, "May": true, "June": true, "July": true,
+	"August": true, "September": true, "October": true, "November": true, "December": true,
+}
+
+// Redactor replaces e-mail addresses, @handles, numbers of four digits or
+// more and capitalized words in the middle of a sentence (most often names)
+// with placeholders: user1@example.com, @user1, numbers of the same length,
+// Name1. The same value always gets the same placeholder, and a word replaced
+// once is replaced at the start of sentences too.
+type Redactor struct {
+	seen  map[string]string
+	count map[string]int
+}
+
+// NewRedactor returns a Redactor with no replacements made yet.
+func NewRedactor() *Redactor {
+	return &Redactor{seen: make(map[string]string), count: make(map[string]int)}
+}
+
+// placeholder returns the replacement of s, making one with gen from the next
+// number of the kind the first time s is seen.
+func (r *Redactor) placeholder(kind, s string, gen func(n int) string) string {
+	if p, ok := r.seen[kind+":"+s]; ok {
+		return p
+	}
+	r.count[kind]++
+	p := gen(r.count[kind])
+	r.seen[kind+":"+s] = p
+	return p
+}
+
+// Text returns s with its personal data replaced.
+func (r *Redactor) Text(s string) string {
+	s = contactRE.ReplaceAllStringFunc(s, func(m string) string {
+		if strings.HasPrefix(m, "@") {
+			return r.placeholder("handle", m, func(n int) string { return fmt.Sprintf("@user%d", n) })
+		}
+		return r.placeholder("email", m, func(n int) string { return fmt.Sprintf("user%d@example.com", n) })
+	})
+	s = numberRE.ReplaceAllStringFunc(s, func(m string) string {
+		return r.placeholder("number", m, func(n int) string {
+			// Keep the length, so IDs and phone numbers still look the part.
+			return fmt.Sprintf("%0*d", len(m), n)[:len(m)]
+		})
+	})
+	var b strings.Builder
+	last := 0
+	for _, loc := range nameRE.FindAllStringIndex(s, -1) {
+		word := s[loc[0]:loc[1]]
+		_, known := r.seen["name:"+word]
+		if commonCapitalized[word] || (!known && sentenceStart(s[:loc[0]])) || (loc[0] > 0 && isWordByte(s[loc[0]-1])) {
+			continue
+		}
+		b.WriteString(s[last:loc[0]])
+		b.WriteString(r.placeholder("name", word, func(n int) string { return fmt.Sprintf("Name%d", n) }))
+		last = loc[1]
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// Args returns a copy of tool call arguments with the personal data of every
+// string replaced.
+func (r *Redactor) Args(args map[string]interface{}) map[string]interface{} {
+	if args == nil {
+		return nil
+	}
+	out := make(map[string]interface{}, len(args))
+	for k, v := range args {
+		out[k] = r.value(v)
+	}
+	return out
+}
+
+func (r *Redactor) value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return r.Text(v)
+	case map[string]interface{}:
+		return r.Args(v)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = r.value(e)
+		}
+		return out
+	}
+	return v
+}
+
+// sentenceStart reports whether a word following before starts a sentence.
+func sentenceStart(before string) bool {
+	before = strings.TrimRight(before, " \t\"'(")
+	return before == "" || strings.ContainsAny(before[len(before)-1:], ".!?:\n")
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
@@ -0,0 +1,61 @@
+package telemetry
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/local/picobot/internal/providers"
+)
+
+func TestRedactor(t *testing.T) {
+	r := NewRedactor()
+	got := r.Text("Ask Maria (maria.silva@mail.com, @msilva) to call 5511987654321 on Friday. Maria said ok")
+	want := "Ask Name1 (user1@example.com, @user1) to call 0000000000001 on Friday. Name1 said ok"
+	if got != want {
+		t.Fatalf("got  %q\nwant %q", got, want)
+	}
+	// The same value gets the same placeholder, in arguments too.
+	args := r.Args(map[string]interface{}{"to": []interface{}{"call Maria"}, "n": 3.0})
+	if args["to"].([]interface{})[0] != "call Name1" || args["n"] != 3.0 {
+		t.Fatalf("unexpected arguments: %v", args)
+	}
+}
+
+func TestFixtureReplaysTrace(t *testing.T) {
+	rec := TraceRecord{
+		ID:      "abcd1234",
+		Message: "remind Joana about the 8871 invoice",
+		Calls:   []TraceCall{{ToolCalls: []TraceToolCall{{Name: "cron", Arguments: map[string]interface{}{"message": "Joana: invoice 8871"}}}}},
+		Error:   "status 500 from api.example.com",
+		Seed:    42,
+	}
+	b, err := Fixture([]TraceRecord{rec})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "# Sampled with seed(s) abcd1234=42") {
+		t.Fatalf("fixture does not give the seed:\n%s", b)
+	}
+	if s := string(b); strings.Contains(s, "Joana") || strings.Contains(s, "8871") {
+		t.Fatalf("fixture leaks personal data:\n%s", s)
+	}
+	path := filepath.Join(t.TempDir(), "fixture.yaml")
+	os.WriteFile(path, b, 0o644)
+	p, err := providers.NewScriptedStubProvider(path)
+	if err != nil {
+		t.Fatalf("fixture does not load: %v\n%s", err, b)
+	}
+
+	msgs := []providers.Message{{Role: "user", Content: "remind Name1 about the 0001 invoice"}}
+	resp, err := p.Chat(context.Background(), msgs, nil, "")
+	if err != nil || !resp.HasToolCalls || resp.ToolCalls[0].Arguments["message"] != "Name1: invoice 0001" {
+		t.Fatalf("unexpected first response: %+v %v", resp, err)
+	}
+	msgs = append(msgs, providers.Message{Role: "assistant", ToolCalls: resp.ToolCalls}, providers.Message{Role: "tool", Content: "ok"})
+	if _, err := p.Chat(context.Background(), msgs, nil, ""); err == nil || !strings.Contains(err.Error(), "status 500") {
+		t.Fatalf("expected the recorded error, got %v", err)
+	}
+}
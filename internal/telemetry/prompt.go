@@ -0,0 +1,165 @@
+// Package telemetry records lightweight per-turn metrics under the workspace
+// so operators can see where their token budget goes.
+package telemetry
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+	"unicode/utf8"
+)
+
+// PromptStats is the estimated token count of each section of one prompt.
+type PromptStats struct {
+	System    int `json:"system"`    // built-in system prompt and instructions
+	Bootstrap int `json:"bootstrap"` // SOUL.md, AGENTS.md, USER.md, TOOLS.md
+	Skills    int `json:"skills"`
+	Memory    int `json:"memory"` // file memory context and ranked memories
+	History   int `json:"history"`
+	Current   int `json:"current"` // the user message being answered
+	Tools     int `json:"tools"`   // tool definitions sent alongside the prompt
+}
+
+// Total returns the sum of all sections.
+func (s PromptStats) Total() int {
+	return s.System + s.Bootstrap + s.Skills + s.Memory + s.History + s.Current + s.Tools
+}
+
+// PromptRecord is one line of the prompt telemetry log: the prompt of a
+// turn's first model call, and the estimated prompt tokens of the calls that
+// followed it (the conversation sent again with tool results).
+type PromptRecord struct {
+	Time     time.Time   `json:"time"`
+	Channel  string      `json:"channel"`
+	ChatID   string      `json:"chatId"`
+	Stats    PromptStats `json:"stats"`
+	Followup int         `json:"followup,omitempty"`
+	// Feature is what the tokens were spent on: "chat", "research",
+	// "draft", "undelivered", "tasks", "skill:<name>" or "tool:<name>".
+	// Empty in older records (chat).
+	Feature string `json:"feature,omitempty"`
+}
+
+// Feature names of PromptRecord.
+const (
+	FeatureChat        = "chat"
+	FeatureResearch    = "research"
+	FeatureDraft       = "draft"       // the draft model's answer, see AgentLoop.SetDraftModel
+	FeatureUndelivered = "undelivered" // summaries of replies a channel could not deliver
+	FeatureTasks       = "tasks"       // commitments found for /tasks and the briefing
+)
+
+// Tokens returns the estimated prompt tokens of all the turn's model calls.
+func (r PromptRecord) Tokens() int {
+	return r.Stats.Total() + r.Followup
+}
+
+// FeatureName returns the feature of r, "chat" for older records.
+func (r PromptRecord) FeatureName() string {
+	if r.Feature == "" {
+		return FeatureChat
+	}
+	return r.Feature
+}
+
+// EstimateTokens approximates the token count of s (about 4 characters per token).
+func EstimateTokens(s string) int {
+	n := utf8.RuneCountInString(s)
+	if n == 0 {
+		return 0
+	}
+	return (n + 3) / 4
+}
+
+// dir returns the telemetry directory under workspace.
+func dir(workspace string) string {
+	return filepath.Join(workspace, "telemetry")
+}
+
+// promptFile returns the daily prompt log for day.
+func promptFile(workspace string, day time.Time) string {
+	return filepath.Join(dir(workspace), "prompt-"+day.UTC().Format("2006-01-02")+".jsonl")
+}
+
+// RecordPrompt appends rec to the daily prompt log under workspace/telemetry/.
+func RecordPrompt(workspace string, rec PromptRecord) error {
+	if err := os.MkdirAll(dir(workspace), 0o755); err != nil {
+		return err
+	}
+	if rec.Time.IsZero() {
+		rec.Time = time.Now().UTC()
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(promptFile(workspace, rec.Time), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// LoadPrompt returns the prompt records of the last days days (today included).
+// Malformed lines are skipped.
+func LoadPrompt(workspace string, days int) ([]PromptRecord, error) {
+	if days <= 0 {
+		days = 1
+	}
+	var out []PromptRecord
+	for i := days - 1; i >= 0; i-- {
+		path := promptFile(workspace, time.Now().UTC().AddDate(0, 0, -i))
+		f, err := os.Open(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		sc := bufio.NewScanner(f)
+		sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for sc.Scan() {
+			var rec PromptRecord
+			if json.Unmarshal(sc.Bytes(), &rec) == nil {
+				out = append(out, rec)
+			}
+		}
+		f.Close()
+		if err := sc.Err(); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+	}
+	return out, nil
+}
+
+// AveragePrompt returns the per-section average over recs.
+func AveragePrompt(recs []PromptRecord) PromptStats {
+	var sum PromptStats
+	if len(recs) == 0 {
+		return sum
+	}
+	for _, r := range recs {
+		sum.System += r.Stats.System
+		sum.Bootstrap += r.Stats.Bootstrap
+		sum.Skills += r.Stats.Skills
+		sum.Memory += r.Stats.Memory
+		sum.History += r.Stats.History
+		sum.Current += r.Stats.Current
+		sum.Tools += r.Stats.Tools
+	}
+	n := len(recs)
+	return PromptStats{
+		System:    sum.System / n,
+		Bootstrap: sum.Bootstrap / n,
+		Skills:    sum.Skills / n,
+		Memory:    sum.Memory / n,
+		History:   sum.History / n,
+		Current:   sum.Current / n,
+		Tools:     sum.Tools / n,
+	}
+}
@@ -0,0 +1,49 @@
+package telemetry
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecordAndLoadPrompt(t *testing.T) {
+	ws := t.TempDir()
+	recs := []PromptRecord{
+		{Channel: "telegram", ChatID: "1", Stats: PromptStats{System: 100, Bootstrap: 400, History: 200}},
+		{Channel: "telegram", ChatID: "1", Stats: PromptStats{System: 100, Bootstrap: 400, History: 600, Tools: 50}},
+	}
+	for _, r := range recs {
+		if err := RecordPrompt(ws, r); err != nil {
+			t.Fatalf("RecordPrompt: %v", err)
+		}
+	}
+	// A record from long ago must fall outside a 1-day window.
+	old := PromptRecord{Time: time.Now().AddDate(0, 0, -10), Stats: PromptStats{System: 9999}}
+	if err := RecordPrompt(ws, old); err != nil {
+		t.Fatalf("RecordPrompt: %v", err)
+	}
+
+	got, err := LoadPrompt(ws, 1)
+	if err != nil {
+		t.Fatalf("LoadPrompt: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(got))
+	}
+	avg := AveragePrompt(got)
+	want := PromptStats{System: 100, Bootstrap: 400, History: 400, Tools: 25}
+	if avg != want {
+		t.Fatalf("unexpected average: %+v", avg)
+	}
+	if avg.Total() != 925 {
+		t.Fatalf("unexpected total: %d", avg.Total())
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	if EstimateTokens("") != 0 {
+		t.Fatal("empty string should be 0 tokens")
+	}
+	if got := EstimateTokens("abcdefgh"); got != 2 {
+		t.Fatalf("expected 2, got %d", got)
+	}
+}
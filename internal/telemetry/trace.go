@@ -0,0 +1,151 @@
+package telemetry
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// TraceRecord describes a failed turn in enough detail to debug it later. Its
+// short ID is shown to the user alongside the apology.
+type TraceRecord struct {
+	ID         string      `json:"id"`
+	Time       time.Time   `json:"time"`
+	Channel    string      `json:"channel"`
+	ChatID     string      `json:"chatId"`
+	SenderID   string      `json:"senderId,omitempty"`
+	Model      string      `json:"model"`
+	Seed       int64       `json:"seed,omitempty"`  // sampling seed of the turn, see providers.WithSeed
+	Iterations int         `json:"iterations"`      // model calls made, the failed one included
+	Tools      []string    `json:"tools,omitempty"` // tools called before the failure, in order
+	Message    string      `json:"message"`         // the user message being answered
+	Calls      []TraceCall `json:"calls,omitempty"` // model responses before the failure, in order
+	Error      string      `json:"error"`
+}
+
+// TraceCall is one model response of a failed turn: the tools it asked for
+// and any text along with them.
+type TraceCall struct {
+	Content   string          `json:"content,omitempty"`
+	ToolCalls []TraceToolCall `json:"toolCalls,omitempty"`
+}
+
+// TraceToolCall is a tool call asked for by the model.
+type TraceToolCall struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+}
+
+// TraceDays is how far back FindTrace looks.
+const TraceDays = 7
+
+// NewTraceID returns a random 8-character hex ID.
+func NewTraceID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// traceFile returns the daily trace log for day.
+func traceFile(workspace string, day time.Time) string {
+	return filepath.Join(dir(workspace), "traces-"+day.UTC().Format("2006-01-02")+".jsonl")
+}
+
+// RecordTrace appends rec to the daily trace log under workspace/telemetry/.
+func RecordTrace(workspace string, rec TraceRecord) error {
+	if err := os.MkdirAll(dir(workspace), 0o755); err != nil {
+		return err
+	}
+	if rec.Time.IsZero() {
+		rec.Time = time.Now().UTC()
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(traceFile(workspace, rec.Time), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// FindTrace looks up the trace with the given ID among the last TraceDays days
+// of logs, newest first. ok is false when no such trace exists.
+func FindTrace(workspace, id string) (rec TraceRecord, ok bool, err error) {
+	for i := 0; i < TraceDays; i++ {
+		path := traceFile(workspace, time.Now().UTC().AddDate(0, 0, -i))
+		f, err := os.Open(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return TraceRecord{}, false, err
+		}
+		sc := bufio.NewScanner(f)
+		sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for sc.Scan() {
+			var r TraceRecord
+			if json.Unmarshal(sc.Bytes(), &r) == nil && r.ID == id {
+				f.Close()
+				return r, true, nil
+			}
+		}
+		f.Close()
+		if err := sc.Err(); err != nil {
+			return TraceRecord{}, false, fmt.Errorf("reading %s: %w", path, err)
+		}
+	}
+	return TraceRecord{}, false, nil
+}
+
+// LatestTrace returns the newest trace of the last TraceDays days of logs.
+// ok is false when there is none.
+func LatestTrace(workspace string) (rec TraceRecord, ok bool, err error) {
+	for i := 0; i < TraceDays; i++ {
+		path := traceFile(workspace, time.Now().UTC().AddDate(0, 0, -i))
+		f, err := os.Open(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return TraceRecord{}, false, err
+		}
+		sc := bufio.NewScanner(f)
+		sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for sc.Scan() {
+			var r TraceRecord
+			if json.Unmarshal(sc.Bytes(), &r) == nil {
+				rec, ok = r, true
+			}
+		}
+		f.Close()
+		if err := sc.Err(); err != nil {
+			return TraceRecord{}, false, fmt.Errorf("reading %s: %w", path, err)
+		}
+		if ok {
+			return rec, true, nil
+		}
+	}
+	return TraceRecord{}, false, nil
+}
+
+// Format renders rec as a few human-readable lines.
+func (rec TraceRecord) Format() string {
+	s := fmt.Sprintf("trace %s at %s\nchat: %s:%s\nmodel: %s, %d model call(s)\n",
+		rec.ID, rec.Time.UTC().Format(time.RFC3339), rec.Channel, rec.ChatID, rec.Model, rec.Iterations)
+	if rec.Seed != 0 {
+		s += fmt.Sprintf("seed: %d\n", rec.Seed)
+	}
+	if len(rec.Tools) > 0 {
+		s += fmt.Sprintf("tools: %v\n", rec.Tools)
+	}
+	return s + fmt.Sprintf("message: %s\nerror: %s", rec.Message, rec.Error)
+}
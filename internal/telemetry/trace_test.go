@@ -0,0 +1,50 @@
+package telemetry
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRecordAndFindTrace(t *testing.T) {
+	ws := t.TempDir()
+	rec := TraceRecord{ID: NewTraceID(), Channel: "telegram", ChatID: "1", Model: "m", Iterations: 2, Tools: []string{"web"}, Message: "hi", Error: "boom"}
+	if len(rec.ID) != 8 {
+		t.Fatalf("unexpected trace ID %q", rec.ID)
+	}
+	if err := RecordTrace(ws, TraceRecord{ID: "other", Error: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RecordTrace(ws, rec); err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok, err := FindTrace(ws, rec.ID)
+	if err != nil || !ok {
+		t.Fatalf("FindTrace: %v %v", ok, err)
+	}
+	if got.Error != "boom" || got.Tools[0] != "web" {
+		t.Fatalf("unexpected trace: %+v", got)
+	}
+	if s := got.Format(); !strings.Contains(s, "tools: [web]") || !strings.Contains(s, "error: boom") {
+		t.Fatalf("unexpected format: %q", s)
+	}
+	if _, ok, _ := FindTrace(ws, "missing"); ok {
+		t.Fatal("expected no trace for an unknown ID")
+	}
+}
+
+func TestLatestTrace(t *testing.T) {
+	ws := t.TempDir()
+	if _, ok, err := LatestTrace(ws); ok || err != nil {
+		t.Fatalf("LatestTrace of an empty workspace: %v %v", ok, err)
+	}
+	for _, id := range []string{"first", "second"} {
+		if err := RecordTrace(ws, TraceRecord{ID: id, Error: "boom"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, ok, err := LatestTrace(ws)
+	if err != nil || !ok || got.ID != "second" {
+		t.Fatalf("LatestTrace = %+v, %v, %v", got, ok, err)
+	}
+}
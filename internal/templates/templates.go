@@ -0,0 +1,94 @@
+// Package templates renders the notification templates kept in the
+// workspace, so repeated alerts read the same every time without going
+// through the model.
+package templates
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Dir is the workspace directory templates are read from, one file per
+// template, named <name>.tmpl.
+const Dir = "templates"
+
+// ext is the extension of template files.
+const ext = ".tmpl"
+
+// funcs are the functions templates may call besides the text/template
+// builtins.
+var funcs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"join": func(sep string, items []interface{}) string {
+		s := make([]string, len(items))
+		for i, it := range items {
+			s[i] = fmt.Sprint(it)
+		}
+		return strings.Join(s, sep)
+	},
+	// default returns def when v is empty: {{default "n/a" .value}}.
+	"default": func(def, v interface{}) interface{} {
+		if v == nil || v == "" {
+			return def
+		}
+		return v
+	},
+}
+
+// noValue is what text/template prints for a variable missing from vars.
+const noValue = "<no value>"
+
+// Render executes the template name of the workspace fsys with vars. A
+// variable missing from vars is empty to functions, so {{default "n/a" .x}}
+// covers it, but printing one is an error: a notification never goes out
+// with a hole in it.
+func Render(fsys fs.FS, name string, vars map[string]interface{}) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("template %q: invalid name", name)
+	}
+	src, err := fs.ReadFile(fsys, path.Join(Dir, name+ext))
+	if err != nil {
+		return "", fmt.Errorf("template %q: %w", name, err)
+	}
+	t, err := template.New(name).Funcs(funcs).Option("missingkey=zero").Parse(string(src))
+	if err != nil {
+		return "", err
+	}
+	if vars == nil {
+		vars = map[string]interface{}{}
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, vars); err != nil {
+		return "", err
+	}
+	if strings.Contains(b.String(), noValue) {
+		return "", fmt.Errorf("template %q: uses a variable that was not given (wrap optional ones in default)", name)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// List returns the names of the templates of the workspace fsys, sorted.
+func List(fsys fs.FS) ([]string, error) {
+	entries, err := fs.ReadDir(fsys, Dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ext) {
+			names = append(names, strings.TrimSuffix(e.Name(), ext))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
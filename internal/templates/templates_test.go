@@ -0,0 +1,32 @@
+package templates
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRender(t *testing.T) {
+	fsys := fstest.MapFS{
+		"templates/backup_failed.tmpl": {Data: []byte("⚠️ Backup of {{.host}} failed: {{default \"unknown error\" .error}}\n")},
+		"templates/notes.txt":          {Data: []byte("not a template")},
+	}
+	for _, vars := range []map[string]interface{}{{"host": "nas", "error": ""}, {"host": "nas"}} {
+		got, err := Render(fsys, "backup_failed", vars)
+		if err != nil || got != "⚠️ Backup of nas failed: unknown error" {
+			t.Fatalf("Render(%v) = %q, %v", vars, got, err)
+		}
+	}
+	if got, err := Render(fsys, "backup_failed", map[string]interface{}{"host": "nas", "error": "disk full"}); err != nil || got != "⚠️ Backup of nas failed: disk full" {
+		t.Fatalf("Render = %q, %v", got, err)
+	}
+	if _, err := Render(fsys, "backup_failed", nil); err == nil || !strings.Contains(err.Error(), "not given") {
+		t.Fatalf("missing variable: err = %v", err)
+	}
+	if _, err := Render(fsys, "../secrets", nil); err == nil {
+		t.Fatal("expected an error for a name outside the templates directory")
+	}
+	if names, _ := List(fsys); len(names) != 1 || names[0] != "backup_failed" {
+		t.Fatalf("List = %v", names)
+	}
+}
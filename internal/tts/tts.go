@@ -0,0 +1,122 @@
+// Package tts turns text into speech, for replies sent as voice notes.
+package tts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/useragent"
+)
+
+// Synthesizer reads text aloud and returns the audio as Ogg Opus, the
+// format of WhatsApp voice notes.
+type Synthesizer interface {
+	Synthesize(ctx context.Context, text string) ([]byte, error)
+}
+
+// Default model and voice of the OpenAI API.
+const (
+	defaultModel = "tts-1"
+	defaultVoice = "alloy"
+)
+
+// MaxInput is the longest text the OpenAI API reads in one request; longer
+// replies are sent as text.
+const MaxInput = 4096
+
+// OpenAI synthesizes through an OpenAI-compatible /audio/speech endpoint.
+type OpenAI struct {
+	APIBase string
+	APIKey  string
+	Model   string
+	Voice   string
+	client  *http.Client
+}
+
+// NewFromConfig returns the synthesizer configured in cfg, or nil when
+// speech is off. The endpoint and key default to the OpenAI provider's.
+func NewFromConfig(cfg config.Config) Synthesizer {
+	s := cfg.Speech
+	if !s.Enabled {
+		return nil
+	}
+	o := &OpenAI{APIBase: s.APIBase, APIKey: s.APIKey, Model: s.Model, Voice: s.Voice, client: useragent.Client(2 * time.Minute)}
+	if p := cfg.Providers.OpenAI; p != nil {
+		if o.APIBase == "" {
+			o.APIBase = p.APIBase
+		}
+		if o.APIKey == "" {
+			o.APIKey = p.APIKey
+		}
+	}
+	if o.APIBase == "" {
+		o.APIBase = "https://api.openai.com/v1"
+	}
+	if o.Model == "" {
+		o.Model = defaultModel
+	}
+	if o.Voice == "" {
+		o.Voice = defaultVoice
+	}
+	return o
+}
+
+// Synthesize returns text read aloud, as Ogg Opus.
+func (o *OpenAI) Synthesize(ctx context.Context, text string) ([]byte, error) {
+	body, err := json.Marshal(map[string]string{"model": o.Model, "voice": o.Voice, "input": text, "response_format": "opus"})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimRight(o.APIBase, "/")+"/audio/speech", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.APIKey)
+	}
+	client := o.client
+	if client == nil {
+		client = useragent.Client(2 * time.Minute)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("synthesize: %w", err)
+	}
+	defer resp.Body.Close()
+	audio, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return nil, fmt.Errorf("synthesize: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("synthesize: %s: %s", resp.Status, strings.TrimSpace(string(audio)))
+	}
+	return audio, nil
+}
+
+var (
+	markupRE = regexp.MustCompile("[*_~`#>]+")
+	linkRE   = regexp.MustCompile(`\[([^\]]+)\]\([^)]+\)`)
+)
+
+// Speakable returns text without its Markdown markup, for reading aloud,
+// and false when it is not fit to be read: too long, or holding code.
+func Speakable(text string) (string, bool) {
+	if strings.Contains(text, "```") {
+		return "", false
+	}
+	text = linkRE.ReplaceAllString(text, "$1")
+	text = strings.TrimSpace(markupRE.ReplaceAllString(text, ""))
+	if text == "" || len(text) > MaxInput {
+		return "", false
+	}
+	return text, true
+}
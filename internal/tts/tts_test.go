@@ -0,0 +1,51 @@
+package tts
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/local/picobot/internal/config"
+)
+
+func TestOpenAISynthesize(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		if r.URL.Path != "/v1/audio/speech" || r.Header.Get("Authorization") != "Bearer k" {
+			t.Errorf("unexpected request %s %v", r.URL.Path, r.Header)
+		}
+		if req["model"] != "tts-1" || req["voice"] != "nova" || req["input"] != "hello" || req["response_format"] != "opus" {
+			t.Errorf("unexpected body %v", req)
+		}
+		w.Write([]byte("OggS"))
+	}))
+	defer srv.Close()
+
+	cfg := config.Config{Speech: config.SpeechConfig{Enabled: true, Voice: "nova"}, Providers: config.ProvidersConfig{OpenAI: &config.ProviderConfig{APIKey: "k", APIBase: srv.URL + "/v1"}}}
+	audio, err := NewFromConfig(cfg).Synthesize(context.Background(), "hello")
+	if err != nil || string(audio) != "OggS" {
+		t.Fatalf("Synthesize = %q, %v", audio, err)
+	}
+}
+
+func TestNewFromConfigDisabled(t *testing.T) {
+	if s := NewFromConfig(config.Config{}); s != nil {
+		t.Fatalf("expected no synthesizer, got %v", s)
+	}
+}
+
+func TestSpeakable(t *testing.T) {
+	if got, ok := Speakable("**Tomorrow**: see [the forecast](https://x.y/z) _now_"); !ok || got != "Tomorrow: see the forecast now" {
+		t.Errorf("Speakable = %q, %v", got, ok)
+	}
+	if _, ok := Speakable("run:\n```\nls\n```"); ok {
+		t.Error("code should not be read aloud")
+	}
+	if _, ok := Speakable(strings.Repeat("a", MaxInput+1)); ok {
+		t.Error("too long a text should not be read aloud")
+	}
+}
@@ -0,0 +1,65 @@
+// Package useragent identifies picobot on outbound HTTP requests. Some
+// self-hosted gateways and websites reject clients without a recognisable
+// User-Agent, so every HTTP client in picobot goes through Transport.
+package useragent
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Homepage is sent with the default User-Agent so operators of the sites and
+// APIs picobot talks to can find out what it is.
+const Homepage = "https://github.com/saviomotac/picobot"
+
+var (
+	mu    sync.RWMutex
+	value = Default("dev")
+)
+
+// Default returns the standard User-Agent for the given picobot version.
+func Default(version string) string {
+	return "picobot/" + version + " (+" + Homepage + ")"
+}
+
+// Set replaces the User-Agent sent on outbound requests. An empty ua is ignored.
+func Set(ua string) {
+	if ua == "" {
+		return
+	}
+	mu.Lock()
+	value = ua
+	mu.Unlock()
+}
+
+// Get returns the User-Agent sent on outbound requests.
+func Get() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return value
+}
+
+// Transport sets the User-Agent header on requests that do not carry one and
+// hands them to Base (http.DefaultTransport when nil).
+type Transport struct {
+	Base http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", Get())
+	}
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
+
+// Client returns an http.Client with the given timeout (0 for none) that sends
+// the configured User-Agent.
+func Client(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: &Transport{}}
+}
@@ -0,0 +1,46 @@
+package useragent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientSendsUserAgent(t *testing.T) {
+	got := make(chan string, 2)
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got <- r.Header.Get("User-Agent")
+	}))
+	defer h.Close()
+
+	Set("picobot-test/1.0")
+	defer Set(Default("dev"))
+	c := Client(0)
+
+	resp, err := c.Get(h.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if ua := <-got; ua != "picobot-test/1.0" {
+		t.Fatalf("unexpected User-Agent %q", ua)
+	}
+
+	// An explicit header is left alone.
+	req, _ := http.NewRequest("GET", h.URL, nil)
+	req.Header.Set("User-Agent", "custom")
+	resp, err = c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if ua := <-got; ua != "custom" {
+		t.Fatalf("explicit User-Agent overwritten: %q", ua)
+	}
+}
+
+func TestDefault(t *testing.T) {
+	if got := Default("1.2.3"); got != "picobot/1.2.3 (+https://github.com/saviomotac/picobot)" {
+		t.Fatalf("unexpected default: %q", got)
+	}
+}
@@ -0,0 +1,184 @@
+// Package watchdog tracks the liveness of long-running subsystems, such as a
+// channel's poller or socket, and restarts those that silently stop.
+//
+// A subsystem registers itself with a restart function and then calls Beat
+// whenever it proves it is alive (a completed poll, a connected socket). Once
+// started, the watchdog restarts any subsystem that has not beaten for longer
+// than its allowed idle time and raises an alert, so a deaf bot is noticed in
+// minutes rather than hours.
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Status is a snapshot of one registered subsystem.
+type Status struct {
+	Name     string
+	LastBeat time.Time
+	MaxIdle  time.Duration
+	Restarts int
+	Stalled  bool
+}
+
+type probe struct {
+	maxIdle  time.Duration
+	restart  func()
+	last     time.Time
+	restarts int
+	stalled  bool
+}
+
+// Watchdog watches the registered subsystems. The zero value is not usable;
+// use New. Beat and Register are safe to call before Start.
+type Watchdog struct {
+	mu     sync.Mutex
+	probes map[string]*probe
+	alert  func(msg string)
+	now    func() time.Time
+}
+
+// New creates a watchdog that reports stalls and recoveries to alert (which
+// may be nil to only log them).
+func New(alert func(msg string)) *Watchdog {
+	return &Watchdog{probes: make(map[string]*probe), alert: alert, now: time.Now}
+}
+
+// Default is the watchdog the channels register with. It does nothing until
+// started (see Start), so channels can always beat it.
+var Default = New(nil)
+
+// Register adds (or replaces) the subsystem name. It counts as alive now and
+// is restarted with restart once it has not beaten for maxIdle.
+func (w *Watchdog) Register(name string, maxIdle time.Duration, restart func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.probes[name] = &probe{maxIdle: maxIdle, restart: restart, last: w.now()}
+}
+
+// Beat records that name is alive. Beats for unregistered names are ignored.
+func (w *Watchdog) Beat(name string) {
+	w.mu.Lock()
+	p := w.probes[name]
+	if p == nil {
+		w.mu.Unlock()
+		return
+	}
+	p.last = w.now()
+	recovered := p.stalled
+	p.stalled = false
+	w.mu.Unlock()
+	if recovered {
+		w.report(fmt.Sprintf("watchdog: %s recovered", name))
+	}
+}
+
+// Check restarts every subsystem that has been idle for longer than allowed.
+// A stalled subsystem is restarted again each time it stays idle for another
+// maxIdle, but alerted about only once until it recovers.
+func (w *Watchdog) Check() {
+	type stall struct {
+		name    string
+		idle    time.Duration
+		restart func()
+		alert   bool
+	}
+	var stalls []stall
+	w.mu.Lock()
+	now := w.now()
+	for name, p := range w.probes {
+		idle := now.Sub(p.last)
+		if idle <= p.maxIdle {
+			continue
+		}
+		stalls = append(stalls, stall{name, idle, p.restart, !p.stalled})
+		p.stalled = true
+		p.restarts++
+		p.last = now // give the restarted subsystem a full maxIdle to come back
+	}
+	w.mu.Unlock()
+
+	sort.Slice(stalls, func(i, j int) bool { return stalls[i].name < stalls[j].name })
+	for _, s := range stalls {
+		log.Printf("watchdog: %s silent for %s, restarting", s.name, s.idle.Round(time.Second))
+		if s.alert {
+			w.report(fmt.Sprintf("⚠️ %s has been silent for %s; restarting it.", s.name, s.idle.Round(time.Second)))
+		}
+		if s.restart != nil {
+			s.restart()
+		}
+	}
+}
+
+// Restart restarts name right away, as if it had stalled, and reports whether
+// it is registered.
+func (w *Watchdog) Restart(name string) bool {
+	w.mu.Lock()
+	p := w.probes[name]
+	var restart func()
+	if p != nil {
+		restart = p.restart
+		p.restarts++
+		p.last = w.now()
+	}
+	w.mu.Unlock()
+	if p == nil {
+		return false
+	}
+	log.Printf("watchdog: restarting %s on request", name)
+	if restart != nil {
+		restart()
+	}
+	return true
+}
+
+// Start runs Check every interval until ctx is done.
+func (w *Watchdog) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		log.Printf("watchdog: started (every %v)", interval)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				w.Check()
+			}
+		}
+	}()
+}
+
+// SetAlert replaces the function stalls and recoveries are reported to.
+func (w *Watchdog) SetAlert(alert func(msg string)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.alert = alert
+}
+
+// Statuses returns a snapshot of every registered subsystem, sorted by name.
+func (w *Watchdog) Statuses() []Status {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	out := make([]Status, 0, len(w.probes))
+	for name, p := range w.probes {
+		out = append(out, Status{Name: name, LastBeat: p.last, MaxIdle: p.maxIdle, Restarts: p.restarts, Stalled: p.stalled})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func (w *Watchdog) report(msg string) {
+	w.mu.Lock()
+	alert := w.alert
+	w.mu.Unlock()
+	log.Print(msg)
+	if alert != nil {
+		alert(msg)
+	}
+}
@@ -0,0 +1,47 @@
+package watchdog
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchdogRestartsStalledSubsystem(t *testing.T) {
+	var alerts []string
+	w := New(func(msg string) { alerts = append(alerts, msg) })
+	now := time.Unix(1000, 0)
+	w.now = func() time.Time { return now }
+
+	restarts := 0
+	w.Register("telegram", time.Minute, func() { restarts++ })
+
+	now = now.Add(30 * time.Second)
+	w.Beat("telegram")
+	now = now.Add(50 * time.Second)
+	w.Check()
+	if restarts != 0 || len(alerts) != 0 {
+		t.Fatalf("a live subsystem was restarted: %d restarts, alerts %v", restarts, alerts)
+	}
+
+	now = now.Add(20 * time.Second) // 70s since the last beat
+	w.Check()
+	if restarts != 1 || len(alerts) != 1 || !strings.Contains(alerts[0], "telegram has been silent") {
+		t.Fatalf("expected one restart and alert, got %d restarts, alerts %v", restarts, alerts)
+	}
+
+	// Still silent: restarted again, but not alerted twice.
+	now = now.Add(2 * time.Minute)
+	w.Check()
+	if restarts != 2 || len(alerts) != 1 {
+		t.Fatalf("expected a second restart without a new alert, got %d restarts, alerts %v", restarts, alerts)
+	}
+	if st := w.Statuses(); len(st) != 1 || !st[0].Stalled || st[0].Restarts != 2 {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+
+	w.Beat("telegram")
+	if len(alerts) != 2 || alerts[1] != "watchdog: telegram recovered" {
+		t.Fatalf("expected a recovery alert, got %v", alerts)
+	}
+	w.Beat("unknown") // ignored
+}
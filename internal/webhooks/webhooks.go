@@ -0,0 +1,137 @@
+// Package webhooks posts events about what the agent does (turns answered,
+// tools run, failures) to external automation such as n8n or Zapier.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/useragent"
+)
+
+// Event kinds.
+const (
+	Turn  = "turn"  // a turn was answered
+	Tool  = "tool"  // a tool was run
+	Error = "error" // a turn failed
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of "<timestamp>.<body>",
+// keyed with the webhook's secret, when it has one; TimestampHeader carries
+// the timestamp, in Unix seconds, so receivers can refuse replayed events.
+const (
+	SignatureHeader = "X-Picobot-Signature"
+	TimestampHeader = "X-Picobot-Timestamp"
+)
+
+// timeout bounds one delivery.
+const timeout = 10 * time.Second
+
+// Event is the JSON payload posted for each event. Message, Reply and
+// Arguments are only sent to webhooks with includeContent, and never for
+// private chats.
+type Event struct {
+	Event      string                 `json:"event"`
+	Time       time.Time              `json:"time"`
+	Channel    string                 `json:"channel"`
+	ChatID     string                 `json:"chatId"`
+	SenderID   string                 `json:"senderId,omitempty"`
+	Model      string                 `json:"model,omitempty"`
+	Iterations int                    `json:"iterations,omitempty"` // model calls of the turn
+	Tools      []string               `json:"tools,omitempty"`      // tools run in the turn, in order
+	Tool       string                 `json:"tool,omitempty"`       // the tool of a tool event
+	DurationMs int64                  `json:"durationMs"`
+	TraceID    string                 `json:"traceId,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	Private    bool                   `json:"private,omitempty"`
+	Message    string                 `json:"message,omitempty"`
+	Reply      string                 `json:"reply,omitempty"`
+	Arguments  map[string]interface{} `json:"arguments,omitempty"`
+}
+
+// Dispatcher posts events to the configured webhooks.
+type Dispatcher struct {
+	hooks  []config.EventWebhook
+	client *http.Client
+}
+
+// New returns a Dispatcher for hooks, or nil when there are none.
+func New(hooks []config.EventWebhook) *Dispatcher {
+	if len(hooks) == 0 {
+		return nil
+	}
+	return &Dispatcher{hooks: hooks, client: useragent.Client(timeout)}
+}
+
+// Emit posts ev, in the background, to every webhook subscribed to its kind.
+// Failures are only logged. Emit on a nil Dispatcher does nothing.
+func (d *Dispatcher) Emit(ev Event) {
+	if d == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+	for _, h := range d.hooks {
+		if len(h.Events) > 0 && !slices.Contains(h.Events, ev.Event) {
+			continue
+		}
+		e := ev
+		if !h.IncludeContent || e.Private {
+			e.Message, e.Reply, e.Arguments = "", "", nil
+		}
+		go func() {
+			if err := d.post(h, e); err != nil {
+				log.Printf("webhooks: %s event to %s: %v", e.Event, h.URL, err)
+			}
+		}()
+	}
+}
+
+func (d *Dispatcher) post(h config.EventWebhook, ev Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.Secret != "" {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(TimestampHeader, ts)
+		req.Header.Set(SignatureHeader, Sign(h.Secret, ts, body))
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
+
+// Sign returns the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with
+// secret, as sent in SignatureHeader.
+func Sign(secret, timestamp string, body []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(timestamp + "."))
+	m.Write(body)
+	return hex.EncodeToString(m.Sum(nil))
+}
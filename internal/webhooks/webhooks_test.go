@@ -0,0 +1,59 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/config"
+)
+
+func TestEmit(t *testing.T) {
+	type delivery struct {
+		path string
+		sig  string
+		ts   string
+		ev   Event
+		body []byte
+	}
+	got := make(chan delivery, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var ev Event
+		json.Unmarshal(body, &ev)
+		got <- delivery{r.URL.Path, r.Header.Get(SignatureHeader), r.Header.Get(TimestampHeader), ev, body}
+	}))
+	defer srv.Close()
+
+	d := New([]config.EventWebhook{
+		{URL: srv.URL + "/errors", Events: []string{Error}, Secret: "k"},
+		{URL: srv.URL + "/all", IncludeContent: true},
+	})
+	d.Emit(Event{Event: Turn, Channel: "telegram", ChatID: "1", Message: "hi", Reply: "hello"})
+	select {
+	case dl := <-got:
+		if dl.path != "/all" || dl.ev.Message != "hi" || dl.ev.Reply != "hello" {
+			t.Fatalf("turn delivery = %+v", dl)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("turn event not delivered")
+	}
+
+	d.Emit(Event{Event: Error, Channel: "telegram", ChatID: "1", Error: "boom", Message: "secret plans"})
+	for i := 0; i < 2; i++ {
+		select {
+		case dl := <-got:
+			if dl.path == "/errors" && (dl.ev.Message != "" || dl.ts == "" || dl.sig != Sign("k", dl.ts, dl.body)) {
+				t.Fatalf("error delivery without content and with signature expected: %+v", dl)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("error event not delivered twice")
+		}
+	}
+	if New(nil) != nil {
+		t.Fatal("New(nil) should be nil")
+	}
+}